@@ -0,0 +1,38 @@
+package adapters
+
+import (
+	"time"
+
+	"channel-adapter/models"
+)
+
+// NormalizeAPIMessage converts a synchronous REST chat request into a
+// MessageEnvelope. The deadline is the caller's timeout, so the orchestrator
+// answers within it or says it is still working.
+func NormalizeAPIMessage(sessionID, userID, text, language string, timeout time.Duration) models.MessageEnvelope {
+	now := time.Now().UTC()
+	deadline := now.Add(timeout)
+	if userID == "" {
+		userID = "anonymous"
+	}
+	if language == "" {
+		language = "en"
+	}
+	return models.MessageEnvelope{
+		MessageID: NewMessageID(),
+		SessionID: sessionID,
+		Channel:   "api",
+		UserID:    userID,
+		Timestamp: now,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language:     language,
+			PlatformData: map[string]interface{}{},
+		},
+		Deadline: &deadline,
+		TenantID: Tenant,
+	}
+}
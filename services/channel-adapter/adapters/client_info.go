@@ -0,0 +1,160 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"channel-adapter/models"
+)
+
+const maxFieldLength = 512
+
+// ClientInfo is device and page metadata captured once per WebSocket
+// connection and copied into every envelope's metadata.
+type ClientInfo struct {
+	UserAgent      string
+	AcceptLanguage string
+	Referrer       string
+	WidgetVersion  string
+	AppVersion     string
+	// IP is the client's address, resolved by the realip middleware
+	IP  string
+	Geo GeoLocation
+	// Streaming is set when the widget asked for answers as delta frames
+	// while they are generated (stream=true).
+	Streaming bool
+	// TimeZone is the browser's zone from Intl, passed as tz, or else the
+	// geo lookup's.
+	TimeZone string
+}
+
+// ClientInfoFromRequest reads the upgrade request. The widget passes its
+// version and the embedding page as query parameters, since browsers don't
+// reliably send a Referer on WebSocket handshakes; a native app embedding it
+// passes its own version as app_version.
+func ClientInfoFromRequest(ctx context.Context, r *http.Request, geo GeoResolver) ClientInfo {
+	q := r.URL.Query()
+	info := ClientInfo{
+		UserAgent:      clip(r.UserAgent()),
+		AcceptLanguage: clip(r.Header.Get("Accept-Language")),
+		Referrer:       clip(q.Get("page_url")),
+		WidgetVersion:  clip(firstNonEmpty(q.Get("widget_version"), r.Header.Get("X-Widget-Version"))),
+		AppVersion:     clip(firstNonEmpty(q.Get("app_version"), r.Header.Get("X-App-Version"))),
+		Streaming:      q.Get("stream") == "true",
+	}
+	if info.Referrer == "" {
+		info.Referrer = clip(r.Referer())
+	}
+	ip := clientIP(r)
+	if ip != nil {
+		info.IP = ip.String()
+	}
+	if geo != nil {
+		if ip != nil && !ip.IsPrivate() && !ip.IsLoopback() {
+			loc, err := geo.Resolve(ctx, ip)
+			if err != nil {
+				log.Printf("Geo lookup failed: %v", err)
+			}
+			info.Geo = loc
+		}
+	}
+	for _, tz := range []string{q.Get("tz"), info.Geo.TimeZone} {
+		if ValidTimeZone(tz) {
+			info.TimeZone = tz
+			break
+		}
+	}
+	return info
+}
+
+func (c ClientInfo) platformData() map[string]interface{} {
+	data := map[string]interface{}{}
+	set := func(k, v string) {
+		if v != "" {
+			data[k] = v
+		}
+	}
+	set("user_agent", c.UserAgent)
+	set("referrer", c.Referrer)
+	set("widget_version", c.WidgetVersion)
+	set("geo_country", c.Geo.Country)
+	set("geo_region", c.Geo.Region)
+	set("geo_city", c.Geo.City)
+	return data
+}
+
+// context is the envelope's metadata.client, or nil if the request said
+// nothing about the client.
+func (c ClientInfo) context() *models.ClientContext {
+	cc := models.ClientContext{
+		UserAgent:      c.UserAgent,
+		AcceptLanguage: c.AcceptLanguage,
+		IP:             c.IP,
+		AppVersion:     c.AppVersion,
+		WidgetVersion:  c.WidgetVersion,
+	}
+	if cc == (models.ClientContext{}) {
+		return nil
+	}
+	return &cc
+}
+
+// clientIP is the request's peer address. Behind a load balancer the
+// realip middleware has already replaced it with the client's own.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func clip(s string) string {
+	if len(s) > maxFieldLength {
+		return s[:maxFieldLength]
+	}
+	return s
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+const (
+	maxURLLength      = 2048
+	maxTitleLength    = 300
+	maxSelectedLength = 2000
+)
+
+// SanitizePageContext bounds widget-supplied page context so a large
+// selection can't blow up the prompt. It returns nil if nothing is left.
+func SanitizePageContext(pc *models.PageContext) *models.PageContext {
+	if pc == nil {
+		return nil
+	}
+	out := &models.PageContext{
+		URL:          truncateRunes(strings.TrimSpace(pc.URL), maxURLLength),
+		Title:        truncateRunes(strings.TrimSpace(pc.Title), maxTitleLength),
+		SelectedText: truncateRunes(strings.TrimSpace(pc.SelectedText), maxSelectedLength),
+	}
+	if *out == (models.PageContext{}) {
+		return nil
+	}
+	return out
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
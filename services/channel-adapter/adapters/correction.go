@@ -0,0 +1,30 @@
+package adapters
+
+import (
+	"strings"
+
+	"channel-adapter/models"
+)
+
+// CorrectionPrefix introduces a correction on channels that cannot edit a
+// message they already sent.
+var CorrectionPrefix = "Correction to my earlier answer: "
+
+// AsNotice turns a correction into a notice carrying the corrected text, for
+// channels that cannot edit a sent message. Other responses are returned
+// unchanged.
+func AsNotice(resp models.WSResponse) models.WSResponse {
+	if resp.Type != "correction" {
+		return resp
+	}
+	resp.Type = "notice"
+	resp.Text = CorrectionPrefix + resp.Text
+	return resp
+}
+
+// AnswerID is the ID of the answer a response frame belongs to: the parts
+// of a split answer are numbered after a dot.
+func AnswerID(responseID string) string {
+	id, _, _ := strings.Cut(responseID, ".")
+	return id
+}
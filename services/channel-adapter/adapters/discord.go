@@ -0,0 +1,107 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/discord"
+	"channel-adapter/models"
+)
+
+// DiscordSessionPrefix marks session IDs owned by the Discord adapter.
+const DiscordSessionPrefix = "discord-"
+
+// discordDM stands in for the guild ID of direct messages.
+const discordDM = "dm"
+
+// DiscordTarget is where a Discord session's replies go.
+type DiscordTarget struct {
+	GuildID   string
+	ChannelID string
+	UserID    string
+}
+
+// DM reports whether the session is a direct message conversation.
+func (t DiscordTarget) DM() bool {
+	return t.GuildID == ""
+}
+
+// DiscordSessionID is keyed by guild, channel and user, so each user has
+// their own history in every channel and servers never share sessions.
+func DiscordSessionID(t DiscordTarget) string {
+	guild := t.GuildID
+	if guild == "" {
+		guild = discordDM
+	}
+	return DiscordSessionPrefix + guild + "-" + t.ChannelID + "-" + t.UserID
+}
+
+// DiscordTargetFromSession reverses DiscordSessionID.
+func DiscordTargetFromSession(sessionID string) (DiscordTarget, bool) {
+	rest, ok := strings.CutPrefix(sessionID, DiscordSessionPrefix)
+	if !ok {
+		return DiscordTarget{}, false
+	}
+	parts := strings.Split(rest, "-")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return DiscordTarget{}, false
+	}
+	t := DiscordTarget{GuildID: parts[0], ChannelID: parts[1], UserID: parts[2]}
+	if t.GuildID == discordDM {
+		t.GuildID = ""
+	}
+	return t, true
+}
+
+// NormalizeDiscordMessage converts a MESSAGE_CREATE event into a
+// MessageEnvelope. In servers the bot only answers when mentioned, and the
+// mention is stripped from the text; direct messages are always answered.
+func NormalizeDiscordMessage(msg discord.Message, botUserID string) (models.MessageEnvelope, bool) {
+	if msg.Author.Bot || msg.Author.ID == "" || botUserID == "" {
+		return models.MessageEnvelope{}, false
+	}
+	text := msg.Content
+	if msg.GuildID != "" {
+		mentioned := false
+		for _, u := range msg.Mentions {
+			if u.ID == botUserID {
+				mentioned = true
+			}
+		}
+		if !mentioned {
+			return models.MessageEnvelope{}, false
+		}
+		text = strings.NewReplacer("<@"+botUserID+">", "", "<@!"+botUserID+">", "").Replace(text)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return models.MessageEnvelope{}, false
+	}
+
+	ts := msg.Timestamp.UTC()
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: msg.ID,
+		SessionID:  DiscordSessionID(DiscordTarget{GuildID: msg.GuildID, ChannelID: msg.ChannelID, UserID: msg.Author.ID}),
+		Channel:    "discord",
+		UserID:     "discord:" + msg.Author.ID,
+		Timestamp:  ts,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: "en",
+			PlatformData: map[string]interface{}{
+				"guild_id":   msg.GuildID,
+				"channel_id": msg.ChannelID,
+				"message_id": msg.ID,
+				"username":   msg.Author.Username,
+			},
+		},
+		TenantID: Tenant,
+	}, true
+}
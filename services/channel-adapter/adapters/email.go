@@ -0,0 +1,65 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"channel-adapter/email"
+	"channel-adapter/models"
+)
+
+// EmailSessionPrefix marks session IDs owned by the email adapter. Email
+// sessions are per conversation thread, not per address, so the rest of the
+// ID is random and the reply address is looked up.
+const EmailSessionPrefix = "email-"
+
+func NewEmailSessionID() string {
+	return EmailSessionPrefix + uuid.New().String()
+}
+
+// NormalizeEmailMessage converts a parsed email into a MessageEnvelope for
+// sessionID. Attachment metadata is kept in platform_data. It returns false
+// for auto-replies and emails with no new text.
+func NormalizeEmailMessage(msg *email.Message, sessionID string) (models.MessageEnvelope, bool) {
+	text := msg.Text
+	if text == "" && len(msg.Attachments) == 0 {
+		return models.MessageEnvelope{}, false
+	}
+	if msg.AutoReply || msg.From == "" {
+		return models.MessageEnvelope{}, false
+	}
+	if text == "" {
+		text = "(sent attachments)"
+	}
+
+	ts := msg.Date
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	platformData := map[string]interface{}{
+		"email_message_id": msg.MessageID,
+		"subject":          msg.Subject,
+	}
+	if len(msg.Attachments) > 0 {
+		platformData["attachments"] = msg.Attachments
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: msg.MessageID,
+		SessionID:  sessionID,
+		Channel:    "email",
+		UserID:     "email:" + strings.ToLower(msg.From),
+		Timestamp:  ts,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language:     "en",
+			PlatformData: platformData,
+		},
+		TenantID: Tenant,
+	}, true
+}
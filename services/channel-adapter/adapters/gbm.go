@@ -0,0 +1,103 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/gbm"
+	"channel-adapter/models"
+)
+
+// GBMSessionPrefix marks session IDs owned by the Business Messages adapter.
+// The conversation ID follows it; Google keeps one conversation per user and
+// agent, so it resumes across entry points.
+const GBMSessionPrefix = "gbm-"
+
+func GBMSessionID(conversationID string) string {
+	return GBMSessionPrefix + conversationID
+}
+
+// GBMConversation reverses GBMSessionID.
+func GBMConversation(sessionID string) (string, bool) {
+	id, ok := strings.CutPrefix(sessionID, GBMSessionPrefix)
+	return id, ok && id != ""
+}
+
+// NormalizeGBMEvent converts a user message or suggestion tap into a
+// MessageEnvelope. A tap carries the chip's postback data as the text. It
+// returns false for other events.
+func NormalizeGBMEvent(ev gbm.Event) (models.MessageEnvelope, bool) {
+	if ev.ConversationID == "" {
+		return models.MessageEnvelope{}, false
+	}
+	var text, externalID string
+	platformData := map[string]interface{}{}
+	switch {
+	case ev.Message != nil:
+		text, externalID = ev.Message.Text, ev.Message.MessageID
+	case ev.SuggestionResponse != nil:
+		text, externalID = ev.SuggestionResponse.PostbackData, ev.RequestID
+		if text == "" {
+			text = ev.SuggestionResponse.Text
+		}
+		platformData["suggestion_reply"] = true
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return models.MessageEnvelope{}, false
+	}
+
+	lang, zone := "en", ""
+	if c := ev.Context; c != nil {
+		if c.EntryPoint != "" {
+			platformData["entry_point"] = c.EntryPoint
+		}
+		if c.PlaceID != "" {
+			platformData["place_id"] = c.PlaceID
+		}
+		locale := c.ResolvedLocale
+		if c.UserInfo != nil {
+			if c.UserInfo.DisplayName != "" {
+				platformData["profile_name"] = c.UserInfo.DisplayName
+			}
+			if locale == "" {
+				locale = c.UserInfo.UserDeviceLocale
+			}
+		}
+		if strings.HasPrefix(locale, "ne") {
+			lang = "ne"
+		}
+		// The locale's region, as in "ne-NP", is the user's country
+		if _, region, ok := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-"); ok {
+			zone = TimeZoneForCountry(region)
+		}
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: externalID,
+		SessionID:  GBMSessionID(ev.ConversationID),
+		Channel:    "gbm",
+		UserID:     "gbm:" + ev.ConversationID,
+		Timestamp:  time.Now().UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language:     lang,
+			PlatformData: platformData,
+		},
+		TimeZone: zone,
+		TenantID: Tenant,
+	}, true
+}
+
+// GBMSuggestions renders a response's reply buttons as suggestion chips.
+func GBMSuggestions(resp models.WSResponse) []gbm.Suggestion {
+	buttons := ReplyButtons(Rich(resp))
+	out := make([]gbm.Suggestion, len(buttons))
+	for i, b := range buttons {
+		out[i] = gbm.Suggestion{Text: b.Text, PostbackData: b.Value}
+	}
+	return out
+}
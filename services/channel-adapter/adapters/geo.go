@@ -0,0 +1,81 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const geoCacheSize = 10000
+
+type GeoLocation struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+	// TimeZone is optional; most geo-IP services return it.
+	TimeZone string `json:"timezone,omitempty"`
+}
+
+// GeoResolver maps a client IP to a rough location. Implementations should
+// be fast; lookups happen once per connection, while the client waits.
+type GeoResolver interface {
+	Resolve(ctx context.Context, ip net.IP) (GeoLocation, error)
+}
+
+// HTTPGeoResolver queries a JSON geo-IP service. URL contains an {ip}
+// placeholder, e.g. https://geo.internal/lookup/{ip}, and the response must
+// have country, region and city fields. Results are cached in memory.
+type HTTPGeoResolver struct {
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]GeoLocation
+}
+
+func NewHTTPGeoResolver(url string) *HTTPGeoResolver {
+	return &HTTPGeoResolver{
+		url:    url,
+		client: &http.Client{Timeout: 2 * time.Second},
+		cache:  make(map[string]GeoLocation),
+	}
+}
+
+func (g *HTTPGeoResolver) Resolve(ctx context.Context, ip net.IP) (GeoLocation, error) {
+	key := ip.String()
+	g.mu.Lock()
+	loc, ok := g.cache[key]
+	g.mu.Unlock()
+	if ok {
+		return loc, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(g.url, "{ip}", key), nil)
+	if err != nil {
+		return GeoLocation{}, fmt.Errorf("failed to create geo request: %w", err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return GeoLocation{}, fmt.Errorf("geo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return GeoLocation{}, fmt.Errorf("geo service returned %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loc); err != nil {
+		return GeoLocation{}, fmt.Errorf("failed to decode geo response: %w", err)
+	}
+
+	g.mu.Lock()
+	if len(g.cache) >= geoCacheSize {
+		g.cache = make(map[string]GeoLocation)
+	}
+	g.cache[key] = loc
+	g.mu.Unlock()
+	return loc, nil
+}
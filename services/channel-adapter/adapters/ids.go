@@ -0,0 +1,33 @@
+package adapters
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// NewMessageID generates the ID of every inbound envelope. Replace it to use
+// a different scheme; platform IDs are carried separately in ExternalID.
+var NewMessageID = func() string {
+	return uuid.New().String()
+}
+
+// SetIDFormat selects NewMessageID by name: "uuid" (random, the default) or
+// "uuid7", which sorts by creation time.
+func SetIDFormat(format string) error {
+	switch format {
+	case "", "uuid":
+		NewMessageID = func() string { return uuid.New().String() }
+	case "uuid7":
+		NewMessageID = func() string {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return uuid.New().String()
+			}
+			return id.String()
+		}
+	default:
+		return fmt.Errorf("unknown message ID format %q", format)
+	}
+	return nil
+}
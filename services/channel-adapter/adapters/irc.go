@@ -0,0 +1,85 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/irc"
+	"channel-adapter/models"
+)
+
+// IRCSessionPrefix marks session IDs owned by the IRC adapter.
+const IRCSessionPrefix = "irc-"
+
+// IRCSessionID is keyed by network and nick, so a user keeps one
+// conversation across the bot's channels and direct messages. Nicks are
+// case-insensitive on IRC.
+func IRCSessionID(network, nick string) string {
+	return IRCSessionPrefix + network + "-" + strings.ToLower(nick)
+}
+
+// IRCNickFromSession reverses IRCSessionID for sessions on network.
+func IRCNickFromSession(network, sessionID string) (string, bool) {
+	nick, ok := strings.CutPrefix(sessionID, IRCSessionPrefix+network+"-")
+	return nick, ok && nick != ""
+}
+
+// NormalizeIRCMessage converts a PRIVMSG into a MessageEnvelope. In channels
+// the bot only answers when addressed by nick, and the "nick:" prefix is
+// stripped; direct messages are always answered.
+func NormalizeIRCMessage(network, botNick string, msg irc.Message) (models.MessageEnvelope, bool) {
+	if msg.Nick == "" || botNick == "" {
+		return models.MessageEnvelope{}, false
+	}
+	text := strings.TrimSpace(msg.Text)
+	if !msg.Private() {
+		addressed, ok := stripAddress(text, botNick)
+		if !ok {
+			return models.MessageEnvelope{}, false
+		}
+		text = addressed
+	}
+	if text == "" {
+		return models.MessageEnvelope{}, false
+	}
+
+	return models.MessageEnvelope{
+		MessageID: NewMessageID(),
+		SessionID: IRCSessionID(network, msg.Nick),
+		Channel:   "irc",
+		UserID:    "irc:" + network + ":" + strings.ToLower(msg.Nick),
+		Timestamp: time.Now().UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: "en",
+			PlatformData: map[string]interface{}{
+				"network": network,
+				"target":  msg.Target,
+				"nick":    msg.Nick,
+			},
+		},
+		TenantID: Tenant,
+	}, true
+}
+
+// stripAddress returns text without a leading "nick:" or "nick,", or the
+// whole text if the nick appears elsewhere as a word.
+func stripAddress(text, nick string) (string, bool) {
+	if len(text) > len(nick) && strings.EqualFold(text[:len(nick)], nick) {
+		switch text[len(nick)] {
+		case ':', ',':
+			return strings.TrimSpace(text[len(nick)+1:]), true
+		}
+	}
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ':' || r == '?' || r == '!' || r == '.'
+	}) {
+		if strings.EqualFold(strings.TrimPrefix(w, "@"), nick) {
+			return text, true
+		}
+	}
+	return "", false
+}
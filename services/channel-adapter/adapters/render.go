@@ -0,0 +1,98 @@
+package adapters
+
+import (
+	"fmt"
+	"strings"
+
+	"channel-adapter/models"
+)
+
+// Rich returns a response's rich content. Responses from publishers that
+// only send a structured payload get its quick replies as buttons.
+func Rich(resp models.WSResponse) models.RichContent {
+	var rc models.RichContent
+	if resp.Rich != nil {
+		rc = *resp.Rich
+	}
+	if len(rc.Buttons) == 0 {
+		for _, qr := range QuickReplies(resp.Data) {
+			rc.Buttons = append(rc.Buttons, models.Button{Text: qr.Text, Value: qr.Value})
+		}
+	}
+	return rc
+}
+
+// ReplyButtons are the buttons that send a reply, as opposed to opening a
+// link.
+func ReplyButtons(rc models.RichContent) []models.Button {
+	var out []models.Button
+	for _, b := range rc.Buttons {
+		if b.URL == "" {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// PlainText renders a response for channels that only show text. Reply
+// buttons become a "Reply with" line; links, images and sources that can be
+// opened are listed below the answer.
+func PlainText(resp models.WSResponse) string {
+	rc := Rich(resp)
+	text := WithLinks(resp.Text, rc)
+	if line := replyLine(ReplyButtons(rc)); line != "" {
+		text += "\n\n" + line
+	}
+	return text
+}
+
+// SMSText is PlainText without the links, which cost segments and are
+// rarely opened from a text message.
+func SMSText(resp models.WSResponse) string {
+	if line := replyLine(ReplyButtons(Rich(resp))); line != "" {
+		return resp.Text + "\n\n" + line
+	}
+	return resp.Text
+}
+
+// WithLinks appends the link buttons, images and openable sources of rc to
+// text, for channels that render reply buttons natively but nothing else.
+func WithLinks(text string, rc models.RichContent) string {
+	var lines []string
+	for _, b := range rc.Buttons {
+		if b.URL != "" {
+			lines = append(lines, b.Text+": "+b.URL)
+		}
+	}
+	for _, img := range rc.Images {
+		if img.Alt != "" {
+			lines = append(lines, img.Alt+": "+img.URL)
+		} else {
+			lines = append(lines, img.URL)
+		}
+	}
+	var sources []string
+	for _, c := range rc.Citations {
+		if c.URL != "" {
+			sources = append(sources, fmt.Sprintf("[%d] %s", len(sources)+1, c.URL))
+		}
+	}
+	if len(sources) > 0 {
+		lines = append(lines, "Sources:\n"+strings.Join(sources, "\n"))
+	}
+	if len(lines) == 0 {
+		return text
+	}
+	return text + "\n\n" + strings.Join(lines, "\n")
+}
+
+func replyLine(buttons []models.Button) string {
+	if len(buttons) == 0 {
+		return ""
+	}
+	labels := make([]string, len(buttons))
+	for i, b := range buttons {
+		labels[i] = b.Text
+	}
+	return "Reply with: " + strings.Join(labels, " / ")
+}
@@ -0,0 +1,61 @@
+package adapters
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// QuickReply is a suggested answer the user can tap instead of typing.
+type QuickReply struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// quickReplyKeys are the fields of a structured response that are rendered
+// as buttons on channels that support them, in order of preference.
+var quickReplyKeys = []string{"quick_replies", "buttons", "options"}
+
+// QuickReplies extracts suggested replies from a structured response
+// payload: an array of strings or of {"text","value"} objects under one of
+// quickReplyKeys. A missing value defaults to the text.
+func QuickReplies(data json.RawMessage) []QuickReply {
+	if len(data) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	for _, key := range quickReplyKeys {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			continue
+		}
+		var out []QuickReply
+		for _, item := range items {
+			var qr QuickReply
+			var s string
+			if err := json.Unmarshal(item, &s); err == nil {
+				qr.Text = s
+			} else if err := json.Unmarshal(item, &qr); err != nil {
+				continue
+			}
+			qr.Text = strings.TrimSpace(qr.Text)
+			if qr.Text == "" {
+				continue
+			}
+			if qr.Value == "" {
+				qr.Value = qr.Text
+			}
+			out = append(out, qr)
+		}
+		if len(out) > 0 {
+			return out
+		}
+	}
+	return nil
+}
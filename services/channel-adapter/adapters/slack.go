@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"fmt"
+	"strings"
+
+	"channel-adapter/models"
+)
+
+// Slack's Block Kit limits
+const (
+	maxSlackSectionText = 3000
+	maxSlackButtonText  = 75
+	maxSlackButtonValue = 2000
+	maxSlackActions     = 25
+)
+
+// SlackBlock is one Block Kit block, ready to marshal.
+type SlackBlock map[string]interface{}
+
+// SlackBlocks renders a response as Block Kit blocks: the text as sections,
+// then images, buttons and a context line listing the sources. Button taps
+// arrive as block_actions with action_id "reply_N" and the button's value.
+func SlackBlocks(resp models.WSResponse) []SlackBlock {
+	rc := Rich(resp)
+	var blocks []SlackBlock
+	runes := []rune(resp.Text)
+	for len(runes) > 0 {
+		n := min(len(runes), maxSlackSectionText)
+		blocks = append(blocks, SlackBlock{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": string(runes[:n])},
+		})
+		runes = runes[n:]
+	}
+	for _, img := range rc.Images {
+		alt := img.Alt
+		if alt == "" {
+			alt = "image"
+		}
+		blocks = append(blocks, SlackBlock{"type": "image", "image_url": img.URL, "alt_text": alt})
+	}
+
+	var elements []map[string]interface{}
+	for i, b := range rc.Buttons {
+		if len(elements) == maxSlackActions {
+			break
+		}
+		el := map[string]interface{}{
+			"type":      "button",
+			"action_id": fmt.Sprintf("reply_%d", i),
+			"text":      map[string]string{"type": "plain_text", "text": truncateRunes(b.Text, maxSlackButtonText)},
+		}
+		if b.URL != "" {
+			el["url"] = b.URL
+		} else {
+			el["value"] = truncateRunes(b.Value, maxSlackButtonValue)
+		}
+		elements = append(elements, el)
+	}
+	if len(elements) > 0 {
+		blocks = append(blocks, SlackBlock{"type": "actions", "elements": elements})
+	}
+
+	var sources []string
+	for _, c := range rc.Citations {
+		if c.URL != "" {
+			sources = append(sources, "<"+c.URL+"|"+c.Title+">")
+		} else {
+			sources = append(sources, c.Title)
+		}
+	}
+	if len(sources) > 0 {
+		blocks = append(blocks, SlackBlock{
+			"type":     "context",
+			"elements": []map[string]string{{"type": "mrkdwn", "text": "Sources: " + strings.Join(sources, ", ")}},
+		})
+	}
+	return blocks
+}
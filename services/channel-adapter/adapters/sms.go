@@ -0,0 +1,63 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/models"
+)
+
+// SMSSessionPrefix marks session IDs owned by the SMS adapter. The sender's
+// E.164 number, without the "+", follows it.
+const SMSSessionPrefix = "sms-"
+
+// smsOptOutKeywords are handled by Twilio's opt-out management and must not
+// be answered by the genie.
+var smsOptOutKeywords = map[string]bool{
+	"STOP": true, "STOPALL": true, "UNSUBSCRIBE": true, "CANCEL": true, "END": true, "QUIT": true,
+	"START": true, "YES": true, "UNSTOP": true, "HELP": true, "INFO": true,
+}
+
+// SMSSessionID is stable per phone number, so a conversation resumes across
+// messages.
+func SMSSessionID(phone string) string {
+	return SMSSessionPrefix + strings.TrimPrefix(phone, "+")
+}
+
+// SMSRecipient reverses SMSSessionID into an E.164 number.
+func SMSRecipient(sessionID string) (string, bool) {
+	n, ok := strings.CutPrefix(sessionID, SMSSessionPrefix)
+	if !ok || n == "" {
+		return "", false
+	}
+	return "+" + n, true
+}
+
+// NormalizeSMSMessage converts an inbound Twilio SMS into a MessageEnvelope.
+// It returns false for empty messages and opt-out keywords.
+func NormalizeSMSMessage(from, body, messageSID string) (models.MessageEnvelope, bool) {
+	body = strings.TrimSpace(body)
+	if from == "" || body == "" || smsOptOutKeywords[strings.ToUpper(body)] {
+		return models.MessageEnvelope{}, false
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: messageSID,
+		SessionID:  SMSSessionID(from),
+		Channel:    "sms",
+		UserID:     "sms:" + from,
+		Timestamp:  time.Now().UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: body,
+		},
+		Metadata: models.MessageMetadata{
+			Language: "en",
+			PlatformData: map[string]interface{}{
+				"message_sid": messageSID,
+			},
+		},
+		TimeZone: TimeZoneForPhone(from),
+		TenantID: Tenant,
+	}, true
+}
@@ -0,0 +1,141 @@
+package adapters
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"channel-adapter/models"
+	"channel-adapter/telegram"
+)
+
+// TelegramSessionPrefix marks session IDs owned by the Telegram adapter. The
+// chat ID follows it, so replies can be routed without a lookup.
+const TelegramSessionPrefix = "telegram-"
+
+// TelegramSessionID is stable per chat, so a conversation resumes across
+// messages and adapter restarts.
+func TelegramSessionID(chatID int64) string {
+	return TelegramSessionPrefix + strconv.FormatInt(chatID, 10)
+}
+
+// TelegramChatID reverses TelegramSessionID.
+func TelegramChatID(sessionID string) (int64, bool) {
+	if !strings.HasPrefix(sessionID, TelegramSessionPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(sessionID, TelegramSessionPrefix), 10, 64)
+	return id, err == nil
+}
+
+// NormalizeTelegramMessage converts a Bot API message into a MessageEnvelope.
+// It returns false for messages the genie should not answer, such as those
+// without text or sent by bots.
+func NormalizeTelegramMessage(msg *telegram.Message) (models.MessageEnvelope, bool) {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	if text == "" || msg.From == nil || msg.From.IsBot {
+		return models.MessageEnvelope{}, false
+	}
+
+	lang := "en"
+	if strings.HasPrefix(msg.From.LanguageCode, "ne") {
+		lang = "ne"
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: strconv.FormatInt(msg.Chat.ID, 10) + ":" + strconv.FormatInt(msg.MessageID, 10),
+		SessionID:  TelegramSessionID(msg.Chat.ID),
+		Channel:    "telegram",
+		UserID:     "telegram:" + strconv.FormatInt(msg.From.ID, 10),
+		Timestamp:  time.Unix(msg.Date, 0).UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: lang,
+			PlatformData: map[string]interface{}{
+				"chat_id":    msg.Chat.ID,
+				"chat_type":  msg.Chat.Type,
+				"message_id": msg.MessageID,
+			},
+		},
+		TenantID: Tenant,
+	}, true
+}
+
+// NormalizeTelegramCallback converts a tap on an inline keyboard button into
+// a MessageEnvelope carrying the button's callback data as the text.
+func NormalizeTelegramCallback(cb *telegram.CallbackQuery) (models.MessageEnvelope, bool) {
+	text := strings.TrimSpace(cb.Data)
+	if text == "" || cb.Message == nil || cb.From.IsBot {
+		return models.MessageEnvelope{}, false
+	}
+
+	lang := "en"
+	if strings.HasPrefix(cb.From.LanguageCode, "ne") {
+		lang = "ne"
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: "callback:" + cb.ID,
+		SessionID:  TelegramSessionID(cb.Message.Chat.ID),
+		Channel:    "telegram",
+		UserID:     "telegram:" + strconv.FormatInt(cb.From.ID, 10),
+		Timestamp:  time.Now().UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: lang,
+			PlatformData: map[string]interface{}{
+				"chat_id":          cb.Message.Chat.ID,
+				"chat_type":        cb.Message.Chat.Type,
+				"message_id":       cb.Message.MessageID,
+				"suggestion_reply": true,
+			},
+		},
+		TenantID: Tenant,
+	}, true
+}
+
+// TelegramReply renders a response as message text with openable sources
+// listed, an inline keyboard of its buttons, and the images to send after
+// it as photos.
+func TelegramReply(resp models.WSResponse) (string, *telegram.InlineKeyboard, []models.Image) {
+	rc := Rich(resp)
+	text := WithLinks(resp.Text, models.RichContent{Citations: rc.Citations})
+	if len(rc.Buttons) == 0 {
+		return text, nil, rc.Images
+	}
+	kb := &telegram.InlineKeyboard{}
+	for _, b := range rc.Buttons {
+		btn := telegram.InlineButton{Text: b.Text, URL: b.URL}
+		if b.URL == "" {
+			// Longer values don't fit in callback data; the label is sent
+			// instead, as if typed
+			btn.CallbackData = b.Value
+			if len(btn.CallbackData) > telegram.MaxCallbackData {
+				btn.CallbackData = truncateBytes(b.Text, telegram.MaxCallbackData)
+			}
+		}
+		kb.Rows = append(kb.Rows, []telegram.InlineButton{btn})
+	}
+	return text, kb, rc.Images
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a character.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,81 @@
+package adapters
+
+import "strings"
+
+// IANA names; the orchestrator checks them against its zone database
+const maxTimeZoneLength = 64
+
+// ValidTimeZone accepts names shaped like IANA zones, such as
+// "Asia/Kathmandu", "America/Argentina/Buenos_Aires" or "UTC".
+func ValidTimeZone(name string) bool {
+	if name == "" || len(name) > maxTimeZoneLength {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+		for _, r := range part {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '+') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// countryZones covers countries with a single time zone, so a channel
+// profile's country is enough to place the user. Countries spanning several
+// zones are left out rather than guessed.
+var countryZones = map[string]string{
+	"NP": "Asia/Kathmandu", "IN": "Asia/Kolkata", "BT": "Asia/Thimphu",
+	"BD": "Asia/Dhaka", "LK": "Asia/Colombo", "PK": "Asia/Karachi",
+	"CN": "Asia/Shanghai", "HK": "Asia/Hong_Kong", "JP": "Asia/Tokyo",
+	"KR": "Asia/Seoul", "SG": "Asia/Singapore", "MY": "Asia/Kuala_Lumpur",
+	"TH": "Asia/Bangkok", "VN": "Asia/Ho_Chi_Minh", "PH": "Asia/Manila",
+	"AE": "Asia/Dubai", "QA": "Asia/Qatar", "SA": "Asia/Riyadh",
+	"KW": "Asia/Kuwait", "BH": "Asia/Bahrain", "OM": "Asia/Muscat",
+	"IL": "Asia/Jerusalem", "TR": "Europe/Istanbul", "GB": "Europe/London",
+	"IE": "Europe/Dublin", "DE": "Europe/Berlin", "FR": "Europe/Paris",
+	"IT": "Europe/Rome", "NL": "Europe/Amsterdam", "BE": "Europe/Brussels",
+	"CH": "Europe/Zurich", "AT": "Europe/Vienna", "SE": "Europe/Stockholm",
+	"NO": "Europe/Oslo", "DK": "Europe/Copenhagen", "FI": "Europe/Helsinki",
+	"PL": "Europe/Warsaw", "ZA": "Africa/Johannesburg", "NG": "Africa/Lagos",
+	"KE": "Africa/Nairobi", "EG": "Africa/Cairo",
+}
+
+// callingCodes maps international dialling prefixes to countries in
+// countryZones.
+var callingCodes = map[string]string{
+	"977": "NP", "91": "IN", "975": "BT", "880": "BD", "94": "LK", "92": "PK",
+	"86": "CN", "852": "HK", "81": "JP", "82": "KR", "65": "SG", "60": "MY",
+	"66": "TH", "84": "VN", "63": "PH", "971": "AE", "974": "QA", "966": "SA",
+	"965": "KW", "973": "BH", "968": "OM", "972": "IL", "90": "TR", "44": "GB",
+	"353": "IE", "49": "DE", "33": "FR", "39": "IT", "31": "NL", "32": "BE",
+	"41": "CH", "43": "AT", "46": "SE", "47": "NO", "45": "DK", "358": "FI",
+	"48": "PL", "27": "ZA", "234": "NG", "254": "KE", "20": "EG",
+}
+
+// TimeZoneForCountry returns the zone of a single-zone country, given its
+// ISO 3166 code, or "".
+func TimeZoneForCountry(code string) string {
+	return countryZones[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// TimeZoneForPhone returns the zone of an international number such as
+// "+9779812345678" or a WhatsApp ID "9779812345678", or "" when its country
+// isn't known or spans several zones.
+func TimeZoneForPhone(number string) string {
+	digits := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(number), "+"), "00")
+	// Shorter numbers are short codes, not international numbers
+	if len(digits) < 8 {
+		return ""
+	}
+	// Calling codes are prefix-free, so the first match is the only one
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if country, ok := callingCodes[digits[:n]]; ok {
+			return countryZones[country]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package adapters
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"channel-adapter/models"
+	"channel-adapter/viber"
+)
+
+// ViberSessionPrefix marks session IDs owned by the Viber adapter. The
+// user's Viber ID follows it.
+const ViberSessionPrefix = "viber-"
+
+// ViberSessionID is stable per Viber user, so a conversation resumes across
+// messages and adapter restarts.
+func ViberSessionID(userID string) string {
+	return ViberSessionPrefix + userID
+}
+
+// ViberRecipient reverses ViberSessionID.
+func ViberRecipient(sessionID string) (string, bool) {
+	id, ok := strings.CutPrefix(sessionID, ViberSessionPrefix)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// ViberTracking is carried in tracking_data so a reply can be recognized as
+// a keyboard tap rather than typed text.
+type ViberTracking struct {
+	Buttons []string `json:"buttons,omitempty"`
+}
+
+// NormalizeViberMessage converts a Viber message callback into a
+// MessageEnvelope. It returns false for message types the genie cannot
+// answer yet, such as pictures and stickers.
+func NormalizeViberMessage(ev viber.Event) (models.MessageEnvelope, bool) {
+	if ev.Message == nil || ev.Message.Type != "text" || ev.Message.Text == "" || ev.Sender == nil || ev.Sender.ID == "" {
+		return models.MessageEnvelope{}, false
+	}
+
+	ts := time.Now().UTC()
+	if ev.Timestamp > 0 {
+		ts = time.UnixMilli(ev.Timestamp).UTC()
+	}
+	platformData := map[string]interface{}{
+		"viber_message_token": ev.MessageToken,
+	}
+	if ev.Sender.Name != "" {
+		platformData["profile_name"] = ev.Sender.Name
+	}
+	if ev.Sender.Country != "" {
+		platformData["country"] = ev.Sender.Country
+	}
+	var tracking ViberTracking
+	if json.Unmarshal([]byte(ev.Message.TrackingData), &tracking) == nil {
+		for _, b := range tracking.Buttons {
+			if b == ev.Message.Text {
+				platformData["keyboard_reply"] = true
+			}
+		}
+	}
+	lang := "en"
+	if strings.HasPrefix(ev.Sender.Language, "ne") {
+		lang = "ne"
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: strconv.FormatInt(ev.MessageToken, 10),
+		SessionID:  ViberSessionID(ev.Sender.ID),
+		Channel:    "viber",
+		UserID:     "viber:" + ev.Sender.ID,
+		Timestamp:  ts,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: ev.Message.Text,
+		},
+		Metadata: models.MessageMetadata{
+			Language:     lang,
+			PlatformData: platformData,
+		},
+		TimeZone: TimeZoneForCountry(ev.Sender.Country),
+		TenantID: Tenant,
+	}, true
+}
+
+// ViberKeyboard renders a response's reply buttons as a Viber keyboard, with
+// the tracking data that marks taps on it.
+func ViberKeyboard(resp models.WSResponse) (*viber.Keyboard, string) {
+	buttons := ReplyButtons(Rich(resp))
+	if len(buttons) == 0 {
+		return nil, ""
+	}
+	labels := make([]string, len(buttons))
+	values := make([]string, len(buttons))
+	for i, b := range buttons {
+		labels[i], values[i] = b.Text, b.Value
+	}
+	kb := viber.NewKeyboard(labels, values)
+	tracking, _ := json.Marshal(ViberTracking{Buttons: values[:len(kb.Buttons)]})
+	return kb, string(tracking)
+}
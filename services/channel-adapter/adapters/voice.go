@@ -0,0 +1,55 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/models"
+)
+
+// VoiceSessionPrefix marks session IDs owned by the voice adapter. Each call
+// is its own session, named by the Twilio call SID.
+const VoiceSessionPrefix = "voice-"
+
+// VoiceDeadline is how long a caller waits in silence before hearing that
+// the answer is on its way.
+var VoiceDeadline = 8 * time.Second
+
+func VoiceSessionID(callSID string) string {
+	return VoiceSessionPrefix + callSID
+}
+
+// NormalizeVoiceTranscript converts a transcribed utterance into a
+// MessageEnvelope. It returns false when nothing intelligible was said.
+func NormalizeVoiceTranscript(callSID, from, text, language string) (models.MessageEnvelope, bool) {
+	text = strings.TrimSpace(text)
+	if callSID == "" || text == "" {
+		return models.MessageEnvelope{}, false
+	}
+	now := time.Now().UTC()
+	deadline := now.Add(VoiceDeadline)
+	userID := "voice:anonymous"
+	if from != "" {
+		userID = "voice:" + from
+	}
+	return models.MessageEnvelope{
+		MessageID: NewMessageID(),
+		SessionID: VoiceSessionID(callSID),
+		Channel:   "voice",
+		UserID:    userID,
+		Timestamp: now,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: language,
+			PlatformData: map[string]interface{}{
+				"call_sid": callSID,
+			},
+		},
+		TimeZone: TimeZoneForPhone(from),
+		Deadline: &deadline,
+		TenantID: Tenant,
+	}, true
+}
@@ -3,15 +3,21 @@ package adapters
 import (
 	"time"
 
-	"github.com/google/uuid"
-
 	"channel-adapter/models"
 )
 
+// WebDeadline is how long a web client is willing to wait for an answer.
+var WebDeadline = 60 * time.Second
+
+// Tenant is stamped on every envelope; one adapter deployment serves
+// one tenant.
+var Tenant string
+
 // NormalizeWebMessage converts a raw WebSocket text message into a MessageEnvelope.
-func NormalizeWebMessage(sessionID, text string) models.MessageEnvelope {
+func NormalizeWebMessage(sessionID, text string, client ClientInfo) models.MessageEnvelope {
+	deadline := time.Now().UTC().Add(WebDeadline)
 	return models.MessageEnvelope{
-		MessageID: uuid.New().String(),
+		MessageID: NewMessageID(),
 		SessionID: sessionID,
 		Channel:   "web",
 		UserID:    "anonymous",
@@ -22,7 +28,12 @@ func NormalizeWebMessage(sessionID, text string) models.MessageEnvelope {
 		},
 		Metadata: models.MessageMetadata{
 			Language:     "en",
-			PlatformData: map[string]interface{}{},
+			PlatformData: client.platformData(),
+			Client:       client.context(),
 		},
+		Deadline: &deadline,
+		TenantID: Tenant,
+		Stream:   client.Streaming,
+		TimeZone: client.TimeZone,
 	}
 }
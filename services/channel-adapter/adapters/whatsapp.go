@@ -0,0 +1,68 @@
+package adapters
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"channel-adapter/models"
+	"channel-adapter/whatsapp"
+)
+
+// WhatsAppSessionPrefix marks session IDs owned by the WhatsApp adapter. The
+// user's WhatsApp ID (their phone number in international format) follows it.
+const WhatsAppSessionPrefix = "whatsapp-"
+
+// WhatsAppSessionID is stable per phone number, so a conversation resumes
+// across messages and adapter restarts.
+func WhatsAppSessionID(waID string) string {
+	return WhatsAppSessionPrefix + strings.TrimPrefix(waID, "+")
+}
+
+// WhatsAppRecipient reverses WhatsAppSessionID.
+func WhatsAppRecipient(sessionID string) (string, bool) {
+	waID, ok := strings.CutPrefix(sessionID, WhatsAppSessionPrefix)
+	if !ok || waID == "" {
+		return "", false
+	}
+	return waID, true
+}
+
+// NormalizeWhatsAppMessage converts a Cloud API message into a
+// MessageEnvelope. It returns false for message types the genie cannot
+// answer yet, such as media and reactions.
+func NormalizeWhatsAppMessage(msg whatsapp.Message, contact *whatsapp.Contact, phoneNumberID string) (models.MessageEnvelope, bool) {
+	if msg.Type != "text" || msg.Text == nil || msg.Text.Body == "" || msg.From == "" {
+		return models.MessageEnvelope{}, false
+	}
+
+	ts := time.Now().UTC()
+	if sec, err := strconv.ParseInt(msg.Timestamp, 10, 64); err == nil {
+		ts = time.Unix(sec, 0).UTC()
+	}
+	platformData := map[string]interface{}{
+		"wa_message_id":   msg.ID,
+		"phone_number_id": phoneNumberID,
+	}
+	if contact != nil && contact.Profile.Name != "" {
+		platformData["profile_name"] = contact.Profile.Name
+	}
+	return models.MessageEnvelope{
+		MessageID:  NewMessageID(),
+		ExternalID: msg.ID,
+		SessionID:  WhatsAppSessionID(msg.From),
+		Channel:    "whatsapp",
+		UserID:     "whatsapp:" + msg.From,
+		Timestamp:  ts,
+		Content: models.MessageContent{
+			Type: "text",
+			Text: msg.Text.Body,
+		},
+		Metadata: models.MessageMetadata{
+			Language:     "en",
+			PlatformData: platformData,
+		},
+		TimeZone: TimeZoneForPhone(msg.From),
+		TenantID: Tenant,
+	}, true
+}
@@ -0,0 +1,52 @@
+package adapters
+
+import (
+	"strings"
+	"time"
+
+	"channel-adapter/models"
+	"channel-adapter/xmpp"
+)
+
+// XMPPSessionPrefix marks session IDs owned by the XMPP adapter.
+const XMPPSessionPrefix = "xmpp-"
+
+// XMPPSessionID is keyed by bare JID, so a user keeps one conversation
+// across all of their clients.
+func XMPPSessionID(jid string) string {
+	return XMPPSessionPrefix + xmpp.Bare(jid)
+}
+
+// XMPPJIDFromSession reverses XMPPSessionID, returning the bare JID.
+func XMPPJIDFromSession(sessionID string) (string, bool) {
+	jid, ok := strings.CutPrefix(sessionID, XMPPSessionPrefix)
+	return jid, ok && strings.Contains(jid, "@")
+}
+
+// NormalizeXMPPMessage converts a chat message into a MessageEnvelope.
+func NormalizeXMPPMessage(msg xmpp.Message) (models.MessageEnvelope, bool) {
+	text := strings.TrimSpace(msg.Text)
+	bare := xmpp.Bare(msg.From)
+	if text == "" || !strings.Contains(bare, "@") {
+		return models.MessageEnvelope{}, false
+	}
+
+	return models.MessageEnvelope{
+		MessageID: NewMessageID(),
+		SessionID: XMPPSessionID(bare),
+		Channel:   "xmpp",
+		UserID:    "xmpp:" + bare,
+		Timestamp: time.Now().UTC(),
+		Content: models.MessageContent{
+			Type: "text",
+			Text: text,
+		},
+		Metadata: models.MessageMetadata{
+			Language: "en",
+			PlatformData: map[string]interface{}{
+				"jid": msg.From,
+			},
+		},
+		TenantID: Tenant,
+	}, true
+}
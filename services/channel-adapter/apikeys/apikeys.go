@@ -0,0 +1,114 @@
+// Package apikeys checks the API keys partner integrations send to the
+// channel adapter's non-browser endpoints. Keys are issued and revoked
+// through the orchestrator's admin API.
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keysKey and hashesKey are written by the orchestrator admin API.
+const (
+	keysKey     = "apikeys"
+	hashesKey   = "apikeys:hashes"
+	limitPrefix = "ratelimit:apikey:"
+)
+
+var (
+	ErrInvalid = errors.New("invalid API key")
+	ErrScope   = errors.New("API key is not allowed to do this")
+)
+
+// Key is the part of an issued key's record needed to authorize a request.
+type Key struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Scopes        []string   `json:"scopes"`
+	RatePerMinute int        `json:"rate_per_minute"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// LimitError is returned when a key has used up its requests for the
+// current minute.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return "API key rate limit exceeded"
+}
+
+type Authenticator struct {
+	rdb *redis.Client
+}
+
+func NewAuthenticator(rdb *redis.Client) *Authenticator {
+	return &Authenticator{rdb: rdb}
+}
+
+// Authorize returns the key a request was made with if it may use scope,
+// and counts the request against the key's rate limit.
+func (a *Authenticator) Authorize(ctx context.Context, secret, scope string) (*Key, error) {
+	if secret == "" {
+		return nil, ErrInvalid
+	}
+	sum := sha256.Sum256([]byte(secret))
+	id, err := a.rdb.HGet(ctx, hashesKey, hex.EncodeToString(sum[:])).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	data, err := a.rdb.HGet(ctx, keysKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	var k Key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+	}
+	if k.RevokedAt != nil {
+		return nil, ErrInvalid
+	}
+	if !k.allows(scope) {
+		return &k, ErrScope
+	}
+	if k.RatePerMinute <= 0 {
+		return &k, nil
+	}
+
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+	key := fmt.Sprintf("%s%s:%d", limitPrefix, k.ID, window.Unix())
+	pipe := a.rdb.TxPipeline()
+	n := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to count API key request: %w", err)
+	}
+	if n.Val() > int64(k.RatePerMinute) {
+		return &k, &LimitError{RetryAfter: window.Add(time.Minute).Sub(now)}
+	}
+	return &k, nil
+}
+
+func (k *Key) allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
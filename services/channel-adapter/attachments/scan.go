@@ -0,0 +1,124 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const scanTimeout = 30 * time.Second
+
+// Scanner checks attachment bytes for malware. Threat is empty when the
+// file is clean; an error means it could not be checked.
+type Scanner interface {
+	Scan(ctx context.Context, data []byte) (threat string, err error)
+}
+
+// ClamAV scans through a clamd sidecar's INSTREAM command.
+type ClamAV struct {
+	addr string
+}
+
+// NewClamAV talks to clamd at addr, e.g. "localhost:3310".
+func NewClamAV(addr string) *ClamAV {
+	return &ClamAV{addr: addr}
+}
+
+// clamd rejects streams over its StreamMaxLength; chunks stay well below it
+const clamChunk = 64 << 10
+
+func (c *ClamAV) Scan(ctx context.Context, data []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	var size [4]byte
+	for off := 0; off < len(data); off += clamChunk {
+		chunk := data[off:min(off+clamChunk, len(data))]
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		if _, err := conn.Write(size[:]); err != nil {
+			return "", fmt.Errorf("failed to send to clamd: %w", err)
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return "", fmt.Errorf("failed to send to clamd: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := conn.Write(size[:]); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %w", err)
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(conn, 1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	// "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+	result := strings.TrimSpace(strings.TrimRight(string(reply), "\x00"))
+	result = strings.TrimPrefix(result, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", result)
+}
+
+// HTTPScanner posts the raw bytes to a scanning API, which answers
+// {"clean": true} or {"clean": false, "threat": "..."}.
+type HTTPScanner struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPScanner(url string) *HTTPScanner {
+	return &HTTPScanner{url: url, client: &http.Client{Timeout: scanTimeout}}
+}
+
+func (s *HTTPScanner) Scan(ctx context.Context, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to build scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach scanner: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("scanner returned %d", resp.StatusCode)
+	}
+	var out struct {
+		Clean  bool   `json:"clean"`
+		Threat string `json:"threat"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode scan result: %w", err)
+	}
+	if out.Clean {
+		return "", nil
+	}
+	if out.Threat == "" {
+		out.Threat = "unknown"
+	}
+	return out.Threat, nil
+}
@@ -0,0 +1,284 @@
+// Package attachments stores files the widget sends alongside a message:
+// user-approved viewport screenshots for support, and images or documents
+// the user uploads. Blobs live in Redis, or in object storage when enabled,
+// with a short TTL; only their metadata travels in the envelope. Files that
+// fail type or malware checks are quarantined instead of forwarded.
+package attachments
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/blobstore"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+const (
+	blobPrefix    = "attachment:"
+	sessionPrefix = "attachments:session:"
+	// Screenshots may show personal data; keep them only long enough for
+	// an agent to follow up.
+	retention = 7 * 24 * time.Hour
+	MaxSize   = 2 << 20
+
+	quarantinePrefix = "attachment:quarantine:"
+	// Newest first, for the admin API
+	quarantineIndex     = "attachments:quarantine"
+	quarantineIndexMax  = 1000
+	quarantineRetention = 30 * 24 * time.Hour
+
+	maxNameLength = 255
+)
+
+// MaxUploadSize bounds uploaded files; main sets it from the environment.
+var MaxUploadSize = 10 << 20
+
+var allowedTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/webp": true}
+
+// uploadTypes maps what users may upload to the attachment kind.
+var uploadTypes = map[string]string{
+	"image/png":       models.AttachmentImage,
+	"image/jpeg":      models.AttachmentImage,
+	"image/webp":      models.AttachmentImage,
+	"image/gif":       models.AttachmentImage,
+	"application/pdf": models.AttachmentDocument,
+	"text/plain":      models.AttachmentDocument,
+}
+
+var (
+	ErrNoConsent   = errors.New("the user must approve sharing the screenshot")
+	ErrUnsupported = errors.New("unsupported attachment")
+	ErrTooLarge    = errors.New("attachment is too large")
+	ErrMismatch    = errors.New("attachment content does not match its declared type")
+	ErrInfected    = errors.New("attachment failed the malware scan")
+	ErrScanFailed  = errors.New("attachment could not be scanned")
+	ErrNotFound    = errors.New("unknown or expired attachment")
+)
+
+var scansTotal = metrics.NewCounterVec("channel_adapter_attachment_checks_total",
+	"Attachment type and malware checks by result.", "result")
+
+type Store struct {
+	rdb     *redis.Client
+	scanner Scanner
+	blobs   blobstore.Store
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// EnableScanning scans every attachment before it is stored. Attachments
+// are refused while the scanner is unreachable.
+func (s *Store) EnableScanning(scanner Scanner) {
+	s.scanner = scanner
+}
+
+// EnableObjectStorage keeps attachment bytes in blobs rather than Redis,
+// which holds only the metadata.
+func (s *Store) EnableObjectStorage(blobs blobstore.Store) {
+	s.blobs = blobs
+}
+
+// Save validates and stores an incoming attachment. The content type is
+// sniffed from the bytes rather than trusted from the client.
+func (s *Store) Save(ctx context.Context, sessionID string, in *models.WSAttachment) (models.Attachment, error) {
+	if in.Kind != models.AttachmentScreenshot {
+		return models.Attachment{}, ErrUnsupported
+	}
+	if !in.Consent {
+		return models.Attachment{}, ErrNoConsent
+	}
+	if base64.StdEncoding.DecodedLen(len(in.Data)) > MaxSize+3 {
+		return models.Attachment{}, ErrTooLarge
+	}
+	data, err := base64.StdEncoding.DecodeString(in.Data)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("%w: invalid base64", ErrUnsupported)
+	}
+	if len(data) > MaxSize {
+		return models.Attachment{}, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return models.Attachment{}, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+	return s.store(ctx, sessionID, models.Attachment{Kind: in.Kind, ContentType: contentType}, in.ContentType, data)
+}
+
+// Upload validates and stores a file the user uploaded, such as a photo of
+// a product label or a PDF receipt. name is the client's file name.
+func (s *Store) Upload(ctx context.Context, sessionID, name, declaredType string, data []byte) (models.Attachment, error) {
+	if len(data) == 0 {
+		return models.Attachment{}, fmt.Errorf("%w: empty file", ErrUnsupported)
+	}
+	if len(data) > MaxUploadSize {
+		return models.Attachment{}, ErrTooLarge
+	}
+	contentType := normalizeType(http.DetectContentType(data))
+	kind, ok := uploadTypes[contentType]
+	if !ok {
+		return models.Attachment{}, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+	// Browsers label text files by extension, e.g. text/csv; any text
+	// type matches sniffed text
+	if strings.HasPrefix(normalizeType(declaredType), "text/") && contentType == "text/plain" {
+		declaredType = contentType
+	}
+	att := models.Attachment{Kind: kind, ContentType: contentType, Name: cleanName(name)}
+	return s.store(ctx, sessionID, att, declaredType, data)
+}
+
+// Lookup returns a stored attachment of the session, for a message that
+// references an earlier upload.
+func (s *Store) Lookup(ctx context.Context, sessionID, id string) (models.Attachment, error) {
+	vals, err := s.rdb.HMGet(ctx, blobPrefix+id, "session_id", "kind", "content_type", "size", "created_at", "name").Result()
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("failed to load attachment: %w", err)
+	}
+	field := func(i int) string {
+		v, _ := vals[i].(string)
+		return v
+	}
+	if field(0) != sessionID {
+		return models.Attachment{}, ErrNotFound
+	}
+	att := models.Attachment{ID: id, Kind: field(1), ContentType: field(2), Name: field(5)}
+	att.Size, _ = strconv.Atoi(field(3))
+	att.CreatedAt, _ = time.Parse(time.RFC3339, field(4))
+	return att, nil
+}
+
+// store checks att's bytes against the declared type and the scanner, and
+// saves them for the session.
+func (s *Store) store(ctx context.Context, sessionID string, att models.Attachment, declaredType string, data []byte) (models.Attachment, error) {
+	att.ID = uuid.New().String()
+	att.Size = len(data)
+	att.CreatedAt = time.Now().UTC()
+	// A file claiming to be something it isn't is suspicious in itself
+	if declared := normalizeType(declaredType); declared != "" && declared != "application/octet-stream" && declared != att.ContentType {
+		scansTotal.Inc("mismatch")
+		s.quarantine(ctx, sessionID, att, data, fmt.Sprintf("declared %s, content is %s", declared, att.ContentType))
+		return models.Attachment{}, ErrMismatch
+	}
+	if s.scanner != nil {
+		threat, err := s.scanner.Scan(ctx, data)
+		if err != nil {
+			scansTotal.Inc("error")
+			return models.Attachment{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+		}
+		if threat != "" {
+			scansTotal.Inc("infected")
+			s.quarantine(ctx, sessionID, att, data, "malware: "+threat)
+			return models.Attachment{}, ErrInfected
+		}
+	}
+	scansTotal.Inc("clean")
+
+	fields := map[string]interface{}{
+		"session_id":   sessionID,
+		"kind":         att.Kind,
+		"content_type": att.ContentType,
+		"size":         att.Size,
+		"created_at":   att.CreatedAt.Format(time.RFC3339),
+		"name":         att.Name,
+	}
+	if err := s.putData(ctx, fields, sessionID+"/"+att.ID, att.ContentType, data); err != nil {
+		return models.Attachment{}, err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, blobPrefix+att.ID, fields)
+	pipe.Expire(ctx, blobPrefix+att.ID, retention)
+	pipe.RPush(ctx, sessionPrefix+sessionID, att.ID)
+	pipe.Expire(ctx, sessionPrefix+sessionID, retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return models.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return att, nil
+}
+
+// putData adds the bytes to an attachment's fields, or with object storage
+// enabled uploads them and records where. The orchestrator reads both
+// layouts; keep them in sync.
+func (s *Store) putData(ctx context.Context, fields map[string]interface{}, key, contentType string, data []byte) error {
+	if s.blobs == nil {
+		fields["data"] = data
+		return nil
+	}
+	if err := s.blobs.Put(ctx, key, contentType, data); err != nil {
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+	fields["storage"] = s.blobs.Name()
+	fields["location"] = key
+	return nil
+}
+
+// quarantine keeps a rejected file for review, out of reach of the session
+// and the agent console.
+func (s *Store) quarantine(ctx context.Context, sessionID string, att models.Attachment, data []byte, reason string) {
+	log.Printf("Quarantined attachment %s from session %s: %s", att.ID, sessionID, reason)
+	fields := map[string]interface{}{
+		"session_id":   sessionID,
+		"kind":         att.Kind,
+		"content_type": att.ContentType,
+		"size":         att.Size,
+		"created_at":   att.CreatedAt.Format(time.RFC3339),
+		"name":         att.Name,
+		"reason":       reason,
+	}
+	if err := s.putData(ctx, fields, "quarantine/"+att.ID, att.ContentType, data); err != nil {
+		log.Printf("Failed to quarantine attachment %s: %v", att.ID, err)
+		return
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, quarantinePrefix+att.ID, fields)
+	pipe.Expire(ctx, quarantinePrefix+att.ID, quarantineRetention)
+	pipe.LPush(ctx, quarantineIndex, att.ID)
+	pipe.LTrim(ctx, quarantineIndex, 0, quarantineIndexMax-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to quarantine attachment %s: %v", att.ID, err)
+	}
+}
+
+// normalizeType drops parameters and maps common aliases, so "image/jpg"
+// and "image/jpeg; q=1" both match sniffed JPEG bytes.
+func normalizeType(t string) string {
+	t, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(t)), ";")
+	t = strings.TrimSpace(t)
+	if t == "image/jpg" || t == "image/pjpeg" {
+		return "image/jpeg"
+	}
+	return t
+}
+
+// cleanName keeps the base name of a client's file name, without control
+// characters, for display.
+func cleanName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > maxNameLength {
+		name = strings.ToValidUTF8(name[:maxNameLength], "")
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+// Package audit records reads of customer conversations made through the
+// channel adapter, such as an agent watching a session live. The records
+// go to the orchestrator's access log, which serves them with the rest of
+// a session's access history.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The orchestrator's audit package owns these keys; keep them in sync.
+const (
+	accessStream  = "audit:access"
+	sessionPrefix = "audit:session:"
+	streamMaxLen  = 1000000
+	sessionMaxLen = 1000
+)
+
+// Access is one read of a session, in the orchestrator's format.
+type Access struct {
+	Actor      string    `json:"actor"`
+	SessionID  string    `json:"session_id"`
+	Resource   string    `json:"resource"`
+	Reason     string    `json:"reason"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+type Log struct {
+	rdb *redis.Client
+}
+
+func NewLog(rdb *redis.Client) *Log {
+	return &Log{rdb: rdb}
+}
+
+// Record appends a to the audit stream and the session's access history.
+// Callers must not serve the data if it fails.
+func (l *Log) Record(ctx context.Context, a Access) error {
+	if a.At.IsZero() {
+		a.At = time.Now().UTC()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal access: %w", err)
+	}
+	pipe := l.rdb.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: accessStream,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"access": string(data)},
+	})
+	pipe.LPush(ctx, sessionPrefix+a.SessionID, data)
+	pipe.LTrim(ctx, sessionPrefix+a.SessionID, 0, sessionMaxLen-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package channels runs the messaging platform integrations. Each channel
+// implements Adapter and is registered at startup with a factory that reads
+// its settings; which ones run is a deployment decision made with CHANNELS.
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// Adapter is one messaging platform.
+type Adapter interface {
+	// Receive starts taking the platform's inbound messages, by registering
+	// webhook routes on mux or starting a poller or gateway connection that
+	// runs until ctx is done, and publishes them on msg:inbound.
+	Receive(ctx context.Context, mux *http.ServeMux) error
+	// Normalize turns one inbound payload, in the form the platform sends
+	// it, into the envelopes Receive would publish for it. It has no side
+	// effects, so captured payloads can be checked against it.
+	Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error)
+	// Deliver forwards responses for the channel's sessions until ctx is
+	// done.
+	Deliver(ctx context.Context)
+}
+
+// Factory builds a channel's adapter. It returns nil when the channel's
+// settings are absent, so the channel is skipped unless it was asked for.
+type Factory func() (Adapter, error)
+
+var channelEnabled = metrics.NewGaugeVec("channel_adapter_channel_enabled",
+	"1 for each channel running on this instance.", "channel")
+
+type Registry struct {
+	names     []string
+	factories map[string]Factory
+	// Explicitly enabled channels; nil means every configured one
+	enabled map[string]bool
+
+	running map[string]Adapter
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewRegistry runs only the named channels, or every configured channel if
+// enabled is empty.
+func NewRegistry(enabled []string) *Registry {
+	r := &Registry{factories: make(map[string]Factory), running: make(map[string]Adapter)}
+	for _, name := range enabled {
+		if name = strings.TrimSpace(name); name != "" {
+			if r.enabled == nil {
+				r.enabled = make(map[string]bool)
+			}
+			r.enabled[name] = true
+		}
+	}
+	return r
+}
+
+// Register adds a channel. Channels start in the order they are registered.
+func (r *Registry) Register(name string, f Factory) {
+	if _, dup := r.factories[name]; dup {
+		panic("channels: " + name + " registered twice")
+	}
+	r.names = append(r.names, name)
+	r.factories[name] = f
+}
+
+// Start builds and starts every enabled channel. A channel asked for in
+// CHANNELS that is unknown or not configured is an error, so a deployment
+// never silently runs without it.
+func (r *Registry) Start(ctx context.Context, mux *http.ServeMux) error {
+	for name := range r.enabled {
+		if _, ok := r.factories[name]; !ok {
+			return fmt.Errorf("unknown channel %q", name)
+		}
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	for _, name := range r.names {
+		if r.enabled != nil && !r.enabled[name] {
+			continue
+		}
+		a, err := r.factories[name]()
+		if err != nil {
+			return fmt.Errorf("failed to configure %s: %w", name, err)
+		}
+		if a == nil {
+			if r.enabled != nil {
+				return fmt.Errorf("%s is enabled but not configured", name)
+			}
+			continue
+		}
+		if err := a.Receive(ctx, mux); err != nil {
+			return fmt.Errorf("failed to start %s: %w", name, err)
+		}
+		r.running[name] = a
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			a.Deliver(ctx)
+		}()
+		channelEnabled.Set(1, name)
+	}
+	log.Printf("Channels enabled: %s", strings.Join(r.Running(), ", "))
+	return nil
+}
+
+// Running lists the started channels.
+func (r *Registry) Running() []string {
+	names := make([]string, 0, len(r.running))
+	for name := range r.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns a running channel's adapter.
+func (r *Registry) Get(name string) (Adapter, bool) {
+	a, ok := r.running[name]
+	return a, ok
+}
+
+// Stop cancels every channel and waits up to timeout for their deliveries
+// to finish.
+func (r *Registry) Stop(timeout time.Duration) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("channels did not stop in time")
+	}
+}
@@ -0,0 +1,420 @@
+// Package client is a Go client for the channel-adapter WebSocket protocol
+// described in docs/websocket-api.md. It handles the connected handshake,
+// session persistence across reconnects, acks for delivered frames and
+// request/response correlation so services and tests don't hand-roll the
+// wire format.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"channel-adapter/models"
+)
+
+// ErrClosed is returned after Close or once reconnection has given up.
+var ErrClosed = errors.New("client: connection closed")
+
+// ErrTerminated is returned when the server ended the session.
+var ErrTerminated = errors.New("client: session terminated by server")
+
+// Protocol is the web protocol version the client speaks, offered in
+// Sec-WebSocket-Protocol.
+const Protocol = "maya.v1"
+
+type Options struct {
+	// SessionID resumes an existing session; empty lets the server assign one.
+	SessionID string
+	// SessionKey, from an earlier client's SessionKey, proves SessionID was
+	// started by this client. Signed-in users' own sessions don't need it.
+	SessionKey string
+	// ResumeToken, from an earlier client's ResumeToken, has the server send
+	// frames of SessionID that the earlier client missed.
+	ResumeToken string
+	// Header is sent with every handshake, e.g. Origin or Authorization.
+	Header http.Header
+	// MaxReconnects bounds consecutive reconnect attempts (default 5).
+	MaxReconnects int
+	// Backoff returns the wait before reconnect attempt n (starting at 1).
+	// The default doubles from one second, matching the documented strategy.
+	Backoff func(attempt int) time.Duration
+	// Buffer is the capacity of the Frames channel (default 64).
+	Buffer int
+	// Stream asks for answers as delta frames while they are generated,
+	// ahead of each message frame. Ask skips them; read Frames to show them.
+	Stream bool
+	// TimeZone is the user's IANA zone, e.g. "Asia/Kathmandu", so answers
+	// about "tomorrow" or "9am" use their clock.
+	TimeZone string
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	endpoint string
+	opts     Options
+	dialer   *websocket.Dialer
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	sessionID string
+	key       string
+	instance  string
+	resume    string
+	err       error
+
+	// seen remembers recently delivered frame IDs, so a frame redelivered
+	// after a reconnect isn't delivered twice
+	seen     map[string]bool
+	seenList []string
+
+	writeMu sync.Mutex
+	frames  chan models.WSResponse
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Dial connects to endpoint (e.g. ws://localhost:8081/ws) and waits for the
+// connected frame.
+func Dial(ctx context.Context, endpoint string, opts Options) (*Client, error) {
+	if opts.MaxReconnects == 0 {
+		opts.MaxReconnects = 5
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = func(n int) time.Duration { return time.Second << (n - 1) }
+	}
+	if opts.Buffer == 0 {
+		opts.Buffer = 64
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{Protocol}
+	c := &Client{
+		endpoint:  endpoint,
+		opts:      opts,
+		dialer:    &dialer,
+		sessionID: opts.SessionID,
+		key:       opts.SessionKey,
+		resume:    opts.ResumeToken,
+		seen:      make(map[string]bool),
+		frames:    make(chan models.WSResponse, opts.Buffer),
+		done:      make(chan struct{}),
+	}
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return fmt.Errorf("client: invalid endpoint: %w", err)
+	}
+	c.mu.Lock()
+	sid, key, instance, resume := c.sessionID, c.key, c.instance, c.resume
+	c.mu.Unlock()
+	q := u.Query()
+	q.Set("acks", "true")
+	if sid != "" {
+		q.Set("session_id", sid)
+		if key != "" {
+			q.Set("session_key", key)
+		}
+		// Ask to return to the replica that held the session
+		if instance != "" {
+			q.Set("instance", instance)
+		}
+		// Replay what was sent while disconnected
+		if resume != "" {
+			q.Set("resume", resume)
+		}
+	}
+	if c.opts.Stream {
+		q.Set("stream", "true")
+	}
+	if c.opts.TimeZone != "" {
+		q.Set("tz", c.opts.TimeZone)
+	}
+	u.RawQuery = q.Encode()
+
+	conn, _, err := c.dialer.DialContext(ctx, u.String(), c.opts.Header)
+	if err != nil {
+		return fmt.Errorf("client: dial failed: %w", err)
+	}
+	var hello models.WSResponse
+	if err := conn.ReadJSON(&hello); err != nil {
+		conn.Close()
+		return fmt.Errorf("client: handshake failed: %w", err)
+	}
+	if hello.Type != "connected" {
+		conn.Close()
+		return fmt.Errorf("client: expected connected frame, got %q", hello.Type)
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.sessionID = hello.SessionID
+	if hello.SessionKey != "" {
+		c.key = hello.SessionKey
+	}
+	c.instance = hello.Instance
+	c.resume = hello.ResumeToken
+	c.mu.Unlock()
+	return nil
+}
+
+// SessionID is the server-assigned (or resumed) session ID. Persist it to
+// continue the conversation later.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// SessionKey is the key the server bound the session to. Persist it with
+// SessionID; the session can't be resumed without it.
+func (c *Client) SessionKey() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.key
+}
+
+// ResumeToken marks the latest frame delivered. Persist it with SessionID
+// to be sent what was missed when continuing later.
+func (c *Client) ResumeToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resume
+}
+
+// Frames delivers every server frame after the handshake. It is closed when
+// the client closes or gives up reconnecting; Err then reports why.
+func (c *Client) Frames() <-chan models.WSResponse {
+	return c.frames
+}
+
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Send writes a client frame.
+func (c *Client) Send(msg models.WSIncoming) error {
+	c.mu.Lock()
+	conn, err := c.conn, c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("client: failed to marshal frame: %w", err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("client: write failed: %w", err)
+	}
+	return nil
+}
+
+// Typing tells the server the user is composing a message. Call it every
+// few seconds while they type.
+func (c *Client) Typing() error {
+	return c.Send(models.WSIncoming{Type: "typing"})
+}
+
+// Edit replaces the text of one of the user's messages, identified by the
+// id of its answer. Editing the latest message regenerates the answer, which
+// arrives as a message frame with the same id.
+func (c *Client) Edit(messageID, text string) error {
+	return c.Send(models.WSIncoming{Type: "edit", MessageID: messageID, Text: text})
+}
+
+// Delete withdraws one of the user's messages and its answer from the
+// conversation.
+func (c *Client) Delete(messageID string) error {
+	return c.Send(models.WSIncoming{Type: "delete", MessageID: messageID})
+}
+
+// Ask sends text and waits for the next message or error frame, skipping
+// typing indicators, accepted acknowledgements, deltas and notices. Frames consumed
+// by Ask are not delivered on Frames, so use one or the other.
+func (c *Client) Ask(ctx context.Context, text string) (models.WSResponse, error) {
+	if err := c.Send(models.WSIncoming{Text: text}); err != nil {
+		return models.WSResponse{}, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return models.WSResponse{}, ctx.Err()
+		case f, ok := <-c.frames:
+			if !ok {
+				return models.WSResponse{}, c.Err()
+			}
+			switch f.Type {
+			case "message":
+				return f, nil
+			case "error":
+				return f, fmt.Errorf("client: server error: %s", f.Text)
+			case "terminated":
+				return f, ErrTerminated
+			}
+		}
+	}
+}
+
+// Upload sends a file as a binary frame and waits for the server to store
+// it. Send the returned attachment's ID in the Attachments of a message to
+// share the file. Like Ask, it consumes frames until the answer.
+func (c *Client) Upload(ctx context.Context, data []byte) (models.Attachment, error) {
+	c.mu.Lock()
+	conn, err := c.conn, c.err
+	c.mu.Unlock()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	c.writeMu.Lock()
+	err = conn.WriteMessage(websocket.BinaryMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("client: write failed: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return models.Attachment{}, ctx.Err()
+		case f, ok := <-c.frames:
+			if !ok {
+				return models.Attachment{}, c.Err()
+			}
+			switch f.Type {
+			case "uploaded":
+				var att models.Attachment
+				if err := json.Unmarshal(f.Data, &att); err != nil {
+					return models.Attachment{}, fmt.Errorf("client: invalid uploaded frame: %w", err)
+				}
+				return att, nil
+			case "error", "rate_limited":
+				return models.Attachment{}, fmt.Errorf("client: upload refused: %s", f.Text)
+			case "terminated":
+				return models.Attachment{}, ErrTerminated
+			}
+		}
+	}
+}
+
+// Close sends a normal close frame and stops reconnecting.
+func (c *Client) Close() error {
+	c.shutdown(ErrClosed)
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	c.writeMu.Lock()
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return conn.Close()
+}
+
+func (c *Client) shutdown(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+func (c *Client) readLoop() {
+	defer close(c.frames)
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		var f models.WSResponse
+		err := conn.ReadJSON(&f)
+		if err == nil {
+			if f.ResumeToken != "" {
+				c.mu.Lock()
+				c.resume = f.ResumeToken
+				c.mu.Unlock()
+			}
+			if f.Type == "edited" {
+				// The answer to the edited message may be regenerated under its ID
+				delete(c.seen, f.ID)
+			}
+			tracked := f.ID != "" && (f.Type == "message" || f.Type == "notice" || f.Type == "correction")
+			if tracked && c.seen[f.ID] {
+				c.Send(models.WSIncoming{Ack: f.ID})
+				continue
+			}
+			select {
+			case c.frames <- f:
+			case <-c.done:
+				return
+			}
+			if tracked {
+				c.remember(f.ID)
+				c.Send(models.WSIncoming{Ack: f.ID})
+			}
+			if f.Type == "terminated" {
+				c.shutdown(ErrTerminated)
+				conn.Close()
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+// remember records a delivered frame ID, forgetting the oldest beyond a few
+// hundred; the server redelivers at most 50.
+func (c *Client) remember(id string) {
+	const maxSeen = 256
+	c.seen[id] = true
+	c.seenList = append(c.seenList, id)
+	if len(c.seenList) > maxSeen {
+		delete(c.seen, c.seenList[0])
+		c.seenList = c.seenList[1:]
+	}
+}
+
+func (c *Client) reconnect() bool {
+	var lastErr error
+	for attempt := 1; attempt <= c.opts.MaxReconnects; attempt++ {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(c.opts.Backoff(attempt)):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		lastErr = c.connect(ctx)
+		cancel()
+		if lastErr == nil {
+			return true
+		}
+	}
+	c.shutdown(fmt.Errorf("client: giving up after %d reconnects: %w", c.opts.MaxReconnects, lastErr))
+	return false
+}
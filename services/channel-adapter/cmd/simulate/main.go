@@ -0,0 +1,98 @@
+// Command simulate drives a locally running channel adapter the way a
+// messaging platform would, for developing channels without platform
+// accounts:
+//
+//	simulate platform -addr :9090
+//	simulate telegram -text "Do you ship to Pokhara?"
+//	simulate whatsapp -from 9779800000000 -text "Namaste"
+//	simulate slack -text "hello"
+//
+// platform fakes the APIs replies are sent through and prints each reply;
+// the others send one signed webhook and print the adapter's response.
+// Secrets default to the adapter's own environment variables.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"channel-adapter/simulator"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	if cmd == "platform" {
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		addr := fs.String("addr", ":9090", "listen address")
+		fs.Parse(args)
+		log.Printf("Fake platform APIs on %s: set TELEGRAM_API_BASE=http://localhost%s/telegram and WHATSAPP_API_BASE=http://localhost%s/whatsapp", *addr, *addr, *addr)
+		log.Fatal(http.ListenAndServe(*addr, simulator.NewPlatform()))
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	adapter := fs.String("adapter", envOr("ADAPTER_URL", "http://localhost:8081"), "channel adapter base URL")
+	text := fs.String("text", "hello", "message text")
+	var wh func() simulator.Webhook
+	switch cmd {
+	case "telegram":
+		chatID := fs.Int64("chat", 100000001, "chat and user ID")
+		callback := fs.String("callback", "", "send a button tap with this callback data instead of a message")
+		secret := fs.String("secret", os.Getenv("TELEGRAM_WEBHOOK_SECRET"), "webhook secret token")
+		wh = func() simulator.Webhook {
+			if *callback != "" {
+				return simulator.TelegramCallback(*chatID, *callback, *secret)
+			}
+			return simulator.TelegramMessage(*chatID, *text, *secret)
+		}
+	case "whatsapp":
+		from := fs.String("from", "15550000001", "sender's WhatsApp number")
+		name := fs.String("name", "Sim User", "sender's profile name")
+		phoneID := fs.String("phone-number-id", envOr("WHATSAPP_PHONE_NUMBER_ID", "sim-phone"), "business phone number ID")
+		secret := fs.String("secret", os.Getenv("WHATSAPP_APP_SECRET"), "app secret used to sign the payload")
+		wh = func() simulator.Webhook {
+			return simulator.WhatsAppMessage(*from, *name, *text, *phoneID, *secret)
+		}
+	case "slack":
+		team := fs.String("team", "TSIM0001", "workspace ID")
+		channel := fs.String("channel", "DSIM0001", "conversation ID")
+		user := fs.String("user", "USIM0001", "sender's user ID")
+		secret := fs.String("secret", os.Getenv("SLACK_SIGNING_SECRET"), "signing secret")
+		wh = func() simulator.Webhook {
+			return simulator.SlackMessage(*team, *channel, *user, *text, *secret)
+		}
+	default:
+		usage()
+	}
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	status, body, err := simulator.Send(ctx, *adapter, wh())
+	if err != nil {
+		log.Fatalf("Failed to send %s webhook: %v", cmd, err)
+	}
+	fmt.Printf("%d %s\n%s", status, http.StatusText(status), body)
+	if status >= 300 {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: simulate platform|telegram|whatsapp|slack [flags]")
+	os.Exit(2)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
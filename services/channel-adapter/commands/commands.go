@@ -0,0 +1,65 @@
+// Package commands recognizes the slash commands users can send on any
+// channel. They are handled before a message reaches the LLM: /help is
+// answered by the adapter, and the commands that change the session are
+// carried out by the orchestrator.
+package commands
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultHelp is the /help answer unless the deployment sets its own.
+const DefaultHelp = `Here's what you can send me:
+/reset – start our conversation over
+/language <code> – answer in another language, e.g. /language ne; /language auto goes back to the default
+/persona <style> – answer in a formal, friendly or concise style; /persona default goes back to the usual one
+/report [reason] [comment] – report my previous answer
+/help – show this list`
+
+// Personas are the answer styles /persona takes. They are the tones the
+// orchestrator's tone package knows; keep them in sync.
+var Personas = []string{"formal", "friendly", "concise"}
+
+// languagePattern accepts short BCP 47 tags such as "ne" or "pt-BR".
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// Command is a slash command and its argument.
+type Command struct {
+	Name string
+	Arg  string
+}
+
+// Parse recognizes "/reset", "/help", "/language <code>" and
+// "/persona <style>". Telegram's "/help@BotName" form is accepted. Other
+// slash commands, such as /report, are left to the orchestrator.
+func Parse(text string) (Command, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return Command{}, false
+	}
+	name, _, _ := strings.Cut(strings.ToLower(fields[0][1:]), "@")
+	switch name {
+	case "reset", "help", "language", "persona":
+	default:
+		return Command{}, false
+	}
+	return Command{Name: name, Arg: strings.ToLower(strings.Join(fields[1:], " "))}, true
+}
+
+// Usage returns what to tell a user whose command can't be carried out as
+// sent, or "" if it can.
+func (c Command) Usage() string {
+	switch c.Name {
+	case "language":
+		if c.Arg != "auto" && !languagePattern.MatchString(c.Arg) {
+			return "Send /language with a language code, e.g. /language ne for Nepali, or /language auto."
+		}
+	case "persona":
+		if c.Arg != "default" && !slices.Contains(Personas, c.Arg) {
+			return "Send /persona with formal, friendly, concise or default."
+		}
+	}
+	return ""
+}
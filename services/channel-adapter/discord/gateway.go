@@ -0,0 +1,274 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Gateway intents the adapter needs. MESSAGE_CONTENT is privileged and must
+// be enabled for the bot in the developer portal.
+const (
+	IntentGuildMessages  = 1 << 9
+	IntentDirectMessages = 1 << 12
+	IntentMessageContent = 1 << 15
+)
+
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+)
+
+type payload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// errFatal wraps gateway close codes that reconnecting cannot fix, such as
+// an invalid token or disallowed intents.
+var errFatal = errors.New("fatal gateway error")
+
+// Gateway keeps a single gateway connection open, resuming it after drops
+// so no MESSAGE_CREATE events are missed. Only one replica may connect
+// with a given bot token unless the bot is sharded.
+type Gateway struct {
+	client    *Client
+	token     string
+	intents   int
+	onMessage func(context.Context, Message)
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	seq       *int64
+	sessionID string
+	resumeURL string
+	userID    string
+	acked     bool
+}
+
+func NewGateway(client *Client, token string, onMessage func(context.Context, Message)) *Gateway {
+	return &Gateway{
+		client:    client,
+		token:     token,
+		intents:   IntentGuildMessages | IntentDirectMessages | IntentMessageContent,
+		onMessage: onMessage,
+	}
+}
+
+// UserID is the bot's own user ID, known once the gateway is READY.
+func (g *Gateway) UserID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.userID
+}
+
+// Run connects and reconnects until ctx is done or Discord rejects the bot.
+func (g *Gateway) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := g.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errFatal) {
+			log.Printf("Discord gateway stopped: %v", err)
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("Discord gateway disconnected, reconnecting in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (g *Gateway) session(ctx context.Context) error {
+	g.mu.Lock()
+	url, resume := g.resumeURL, g.sessionID != ""
+	g.mu.Unlock()
+	if !resume || url == "" {
+		var err error
+		if url, err = g.client.GatewayURL(ctx); err != nil {
+			return fmt.Errorf("failed to get gateway URL: %w", err)
+		}
+		resume = false
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url+"/?v=10&encoding=json", nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial gateway: %w", err)
+	}
+	defer conn.Close()
+	g.mu.Lock()
+	g.conn = conn
+	g.mu.Unlock()
+
+	var hello payload
+	if err := conn.ReadJSON(&hello); err != nil {
+		return fmt.Errorf("failed to read hello: %w", err)
+	}
+	if hello.Op != opHello {
+		return fmt.Errorf("expected hello, got op %d", hello.Op)
+	}
+	var hd struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.D, &hd); err != nil {
+		return fmt.Errorf("invalid hello: %w", err)
+	}
+
+	if resume {
+		g.mu.Lock()
+		d := map[string]interface{}{"token": g.token, "session_id": g.sessionID, "seq": g.seq}
+		g.mu.Unlock()
+		err = g.send(opResume, d)
+	} else {
+		err = g.send(opIdentify, map[string]interface{}{
+			"token":   g.token,
+			"intents": g.intents,
+			"properties": map[string]string{
+				"os":      "linux",
+				"browser": "mandala-maya-genie",
+				"device":  "mandala-maya-genie",
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go g.heartbeat(sessionCtx, conn, time.Duration(hd.HeartbeatInterval)*time.Millisecond)
+
+	for {
+		var p payload
+		if err := conn.ReadJSON(&p); err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				switch ce.Code {
+				case 4004, 4010, 4011, 4012, 4013, 4014:
+					return fmt.Errorf("%w: close %d %s", errFatal, ce.Code, ce.Text)
+				case 4007, 4009:
+					g.resetSession()
+				}
+			}
+			return err
+		}
+		switch p.Op {
+		case opDispatch:
+			g.mu.Lock()
+			g.seq = p.S
+			g.mu.Unlock()
+			g.dispatch(ctx, p)
+		case opHeartbeat:
+			g.mu.Lock()
+			seq := g.seq
+			g.mu.Unlock()
+			g.send(opHeartbeat, seq)
+		case opHeartbeatACK:
+			g.mu.Lock()
+			g.acked = true
+			g.mu.Unlock()
+		case opReconnect:
+			return errors.New("gateway requested reconnect")
+		case opInvalidSession:
+			var resumable bool
+			json.Unmarshal(p.D, &resumable)
+			if !resumable {
+				g.resetSession()
+			}
+			return errors.New("invalid session")
+		}
+	}
+}
+
+func (g *Gateway) dispatch(ctx context.Context, p payload) {
+	switch p.T {
+	case "READY":
+		var ready struct {
+			SessionID        string `json:"session_id"`
+			ResumeGatewayURL string `json:"resume_gateway_url"`
+			User             User   `json:"user"`
+		}
+		if err := json.Unmarshal(p.D, &ready); err != nil {
+			log.Printf("Invalid Discord READY event: %v", err)
+			return
+		}
+		g.mu.Lock()
+		g.sessionID, g.resumeURL, g.userID = ready.SessionID, ready.ResumeGatewayURL, ready.User.ID
+		g.mu.Unlock()
+		log.Printf("Discord gateway ready as %s", ready.User.Username)
+	case "MESSAGE_CREATE":
+		var msg Message
+		if err := json.Unmarshal(p.D, &msg); err != nil {
+			log.Printf("Invalid Discord MESSAGE_CREATE event: %v", err)
+			return
+		}
+		g.onMessage(ctx, msg)
+	}
+}
+
+// heartbeat keeps the connection alive and closes it if Discord stops
+// acknowledging, so Run can resume on a fresh connection.
+func (g *Gateway) heartbeat(ctx context.Context, conn *websocket.Conn, interval time.Duration) {
+	g.mu.Lock()
+	g.acked = true
+	g.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.mu.Lock()
+			acked, seq := g.acked, g.seq
+			g.acked = false
+			g.mu.Unlock()
+			if !acked {
+				log.Println("Discord heartbeat not acknowledged, reconnecting")
+				conn.Close()
+				return
+			}
+			if err := g.send(opHeartbeat, seq); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (g *Gateway) send(op int, d interface{}) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal gateway payload: %w", err)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.conn.WriteJSON(payload{Op: op, D: data}); err != nil {
+		return fmt.Errorf("failed to write to gateway: %w", err)
+	}
+	return nil
+}
+
+func (g *Gateway) resetSession() {
+	g.mu.Lock()
+	g.sessionID, g.resumeURL, g.seq = "", "", nil
+	g.mu.Unlock()
+}
@@ -0,0 +1,140 @@
+// Package discord is a minimal Discord bot client: a gateway connection for
+// receiving messages and the REST calls needed to reply.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultAPIBase = "https://discord.com/api/v10"
+
+// MaxMessageLength is Discord's limit on message content, in characters.
+const MaxMessageLength = 2000
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+// Message is the payload of a MESSAGE_CREATE event.
+type Message struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	GuildID   string    `json:"guild_id"`
+	Author    User      `json:"author"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Mentions  []User    `json:"mentions"`
+}
+
+// APIError is a REST failure. Code is the HTTP status, which delivery
+// receipts classify; Discord's JSON error code is kept in the description.
+type APIError struct {
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("discord API error %d: %s", e.Code, e.Description)
+}
+
+type Client struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func NewClient(token, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{
+		base:   strings.TrimRight(apiBase, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (c *Client) call(ctx context.Context, method, path string, params interface{}, out interface{}) error {
+	var body io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bot "+c.token)
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		apiErr := &APIError{Code: resp.StatusCode, Description: strings.TrimSpace(string(data))}
+		if secs, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			apiErr.RetryAfter = time.Duration(secs * float64(time.Second))
+		}
+		return apiErr
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// SendMessage posts text to a channel, split into several messages if it is
+// too long. User mentions are allowed only for the IDs given, so answers
+// can never ping @everyone.
+func (c *Client) SendMessage(ctx context.Context, channelID, text string, mentionUsers ...string) error {
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(len(runes), MaxMessageLength)
+		err := c.call(ctx, http.MethodPost, "/channels/"+channelID+"/messages", map[string]interface{}{
+			"content":          string(runes[:n]),
+			"allowed_mentions": map[string]interface{}{"parse": []string{}, "users": mentionUsers},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		runes = runes[n:]
+	}
+	return nil
+}
+
+// TriggerTyping shows the typing indicator for about ten seconds.
+func (c *Client) TriggerTyping(ctx context.Context, channelID string) error {
+	return c.call(ctx, http.MethodPost, "/channels/"+channelID+"/typing", nil, nil)
+}
+
+// GatewayURL asks Discord which gateway to connect to.
+func (c *Client) GatewayURL(ctx context.Context) (string, error) {
+	var out struct {
+		URL string `json:"url"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/gateway/bot", nil, &out); err != nil {
+		return "", err
+	}
+	return out.URL, nil
+}
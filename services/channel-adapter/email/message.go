@@ -0,0 +1,167 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const maxPartDepth = 5
+
+// Attachment describes a file attached to an inbound email. Only metadata
+// is kept; the content is not forwarded.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// Message is a parsed inbound email.
+type Message struct {
+	MessageID   string
+	InReplyTo   string
+	References  []string
+	From        string
+	FromName    string
+	Subject     string
+	Date        time.Time
+	Text        string
+	Attachments []Attachment
+	AutoReply   bool
+}
+
+var (
+	headerDecoder = &mime.WordDecoder{}
+	htmlTags      = regexp.MustCompile(`(?s)<(script|style).*?</(script|style)>|<[^>]+>`)
+	quoteHeader   = regexp.MustCompile(`(?m)^(On .+ wrote:|-----\s*Original Message\s*-----|From: .+)\s*$`)
+)
+
+// Parse reads an RFC 5322 message. Text is the sender's new content, with
+// quoted history and signatures removed.
+func Parse(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+	msg := &Message{
+		MessageID:  strings.TrimSpace(m.Header.Get("Message-ID")),
+		InReplyTo:  strings.TrimSpace(m.Header.Get("In-Reply-To")),
+		References: strings.Fields(m.Header.Get("References")),
+	}
+	if subject, err := headerDecoder.DecodeHeader(m.Header.Get("Subject")); err == nil {
+		msg.Subject = subject
+	}
+	if from, err := mail.ParseAddress(m.Header.Get("From")); err == nil {
+		msg.From, msg.FromName = strings.ToLower(from.Address), from.Name
+	}
+	if d, err := m.Header.Date(); err == nil {
+		msg.Date = d.UTC()
+	}
+	// Out-of-office and mailing list replies would loop with our answers
+	msg.AutoReply = m.Header.Get("Auto-Submitted") != "" && m.Header.Get("Auto-Submitted") != "no" ||
+		m.Header.Get("X-Autoreply") != "" || m.Header.Get("List-Id") != "" ||
+		strings.EqualFold(m.Header.Get("Precedence"), "bulk") || strings.EqualFold(m.Header.Get("Precedence"), "auto_reply")
+
+	var plain, html string
+	walk(mail.Header(m.Header), m.Body, 0, msg, &plain, &html)
+	text := plain
+	if text == "" && html != "" {
+		text = htmlTags.ReplaceAllString(html, "")
+	}
+	msg.Text = StripQuoted(text)
+	return msg, nil
+}
+
+func walk(h mail.Header, body io.Reader, depth int, msg *Message, plain, html *string) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxPartDepth {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				return
+			}
+			walk(mail.Header(p.Header), p, depth+1, msg, plain, html)
+		}
+	}
+
+	data, err := io.ReadAll(decode(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if disposition == "attachment" || filename != "" {
+		if name, err := headerDecoder.DecodeHeader(filename); err == nil {
+			filename = name
+		}
+		msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: mediaType, Size: len(data)})
+		return
+	}
+	switch {
+	case mediaType == "text/plain" && *plain == "":
+		*plain = string(data)
+	case mediaType == "text/html" && *html == "":
+		*html = string(data)
+	}
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// newlineStripper drops CR and LF so line-wrapped base64 decodes.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+// StripQuoted keeps the new part of a reply: everything before the quoted
+// history header, "> " quoted lines or the "-- " signature separator.
+func StripQuoted(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if loc := quoteHeader.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		if line == "-- " {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
@@ -0,0 +1,222 @@
+// Package gbm is a minimal Google Business Messages client: webhook payload
+// types, signature verification and sending agent messages with suggested
+// replies, authenticated as a service account.
+package gbm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultAPIBase = "https://businessmessages.googleapis.com/v1"
+
+const (
+	// MaxMessageLength is the limit on an agent message's text.
+	MaxMessageLength = 3072
+	// MaxSuggestions is the most suggested replies a message may carry.
+	MaxSuggestions = 13
+	// maxSuggestionText is the limit on a suggestion chip's label.
+	maxSuggestionText = 25
+	// maxPostbackData is the limit on the data a chip sends back.
+	maxPostbackData = 2048
+)
+
+type UserInfo struct {
+	DisplayName      string `json:"displayName"`
+	UserDeviceLocale string `json:"userDeviceLocale"`
+}
+
+// Context describes where the conversation was started, e.g. from a Maps
+// place sheet.
+type Context struct {
+	EntryPoint     string    `json:"entryPoint"`
+	PlaceID        string    `json:"placeId"`
+	ResolvedLocale string    `json:"resolvedLocale"`
+	UserInfo       *UserInfo `json:"userInfo"`
+}
+
+type Message struct {
+	MessageID  string    `json:"messageId"`
+	Text       string    `json:"text"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// SuggestionResponse is a tap on a suggested reply.
+type SuggestionResponse struct {
+	Message      string `json:"message"`
+	PostbackData string `json:"postbackData"`
+	Text         string `json:"text"`
+	Type         string `json:"type"`
+}
+
+type Receipt struct {
+	// Message is "conversations/{id}/messages/{messageId}".
+	Message     string `json:"message"`
+	ReceiptType string `json:"receiptType"`
+}
+
+// Event is the body of a webhook call. Which fields are set depends on the
+// kind of event: Message or SuggestionResponse for user input, Receipts for
+// delivery and read receipts, ClientToken and Secret for the one-time
+// webhook verification.
+type Event struct {
+	Agent              string              `json:"agent"`
+	ConversationID     string              `json:"conversationId"`
+	RequestID          string              `json:"requestId"`
+	Message            *Message            `json:"message,omitempty"`
+	SuggestionResponse *SuggestionResponse `json:"suggestionResponse,omitempty"`
+	Context            *Context            `json:"context,omitempty"`
+	Receipts           *struct {
+		Receipts []Receipt `json:"receipts"`
+	} `json:"receipts,omitempty"`
+
+	ClientToken string `json:"clientToken,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+}
+
+// VerifySignature checks X-Goog-Signature, the base64 HMAC-SHA512 of the raw
+// body keyed with the partner's client token.
+func VerifySignature(clientToken string, body []byte, header string) bool {
+	got, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(clientToken))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// Suggestion is a suggested reply chip. Tapping it sends PostbackData back
+// in a suggestion response.
+type Suggestion struct {
+	Text         string
+	PostbackData string
+}
+
+// APIError is a non-2xx answer from the API.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("business messages API error (HTTP %d): %s", e.Status, e.Message)
+}
+
+type Client struct {
+	base   string
+	tokens *TokenSource
+	client *http.Client
+}
+
+func NewClient(tokens *TokenSource, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{base: strings.TrimRight(apiBase, "/"), tokens: tokens, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// SendText sends text to a conversation as the bot, split into several
+// messages if it is too long; suggestions are attached to the last part.
+// Parts are sent with messageID, suffixed from the second part on, so
+// receipts can be matched back to it.
+func (c *Client) SendText(ctx context.Context, conversationID, messageID, text string, suggestions []Suggestion) error {
+	runes := []rune(text)
+	for part := 0; len(runes) > 0; part++ {
+		n := min(len(runes), MaxMessageLength)
+		id := messageID
+		if part > 0 {
+			id = fmt.Sprintf("%s~%d", messageID, part)
+		}
+		payload := map[string]interface{}{
+			"messageId":      id,
+			"representative": map[string]string{"representativeType": "BOT"},
+			"text":           string(runes[:n]),
+		}
+		if n == len(runes) && len(suggestions) > 0 {
+			payload["suggestions"] = chips(suggestions)
+		}
+		if err := c.post(ctx, "/conversations/"+url.PathEscape(conversationID)+"/messages", payload); err != nil {
+			return err
+		}
+		runes = runes[n:]
+	}
+	return nil
+}
+
+// Typing shows the typing indicator until the next message is sent.
+func (c *Client) Typing(ctx context.Context, conversationID string) error {
+	return c.post(ctx, "/conversations/"+url.PathEscape(conversationID)+"/events?eventId="+uuid.New().String(), map[string]interface{}{
+		"eventType":      "TYPING_STARTED",
+		"representative": map[string]string{"representativeType": "BOT"},
+	})
+}
+
+func chips(suggestions []Suggestion) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, min(len(suggestions), MaxSuggestions))
+	for _, s := range suggestions {
+		if len(out) == MaxSuggestions {
+			break
+		}
+		label := []rune(s.Text)
+		if len(label) > maxSuggestionText {
+			label = append(label[:maxSuggestionText-1], '…')
+		}
+		data := s.PostbackData
+		if len(data) > maxPostbackData {
+			data = s.Text
+		}
+		out = append(out, map[string]interface{}{
+			"reply": map[string]string{"text": string(label), "postbackData": data},
+		})
+	}
+	return out
+}
+
+func (c *Client) post(ctx context.Context, path string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("business messages request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var out struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := resp.Status
+		if json.Unmarshal(data, &out) == nil && out.Error.Message != "" {
+			msg = out.Error.Message
+		}
+		return &APIError{Status: resp.StatusCode, Message: msg}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+)
+
+// Written by the orchestrator's publisher, which holds every message,
+// notice and correction for a web session until it is acknowledged; keep
+// the field layout in sync.
+const unackedPrefix = "web:unacked:"
+
+// maxRedelivered bounds what a reconnecting client is sent; older held
+// frames are dropped.
+const maxRedelivered = 50
+
+var redeliveredTotal = metrics.NewCounterVec("channel_adapter_redelivered_total",
+	"Held frames sent again to a reconnecting web client.")
+
+type unacked struct {
+	At    int64           `json:"at"`
+	Frame json.RawMessage `json:"frame"`
+}
+
+// acknowledge releases a held frame, reporting it delivered if report is
+// set. Explicit acks come from clients that connected with acks=true; for
+// other clients a successful write is taken as the ack, and only frames
+// redelivered after a reconnect, whose status is still pending, are
+// reported.
+func (h *WSHandler) acknowledge(ctx context.Context, sessionID, id string, report bool) {
+	if id == "" {
+		return
+	}
+	n, err := h.rdb.HDel(ctx, unackedPrefix+sessionID, id).Result()
+	if err != nil {
+		log.Printf("Failed to release frame %s of session %s: %v", id, sessionID, err)
+		return
+	}
+	if report && n > 0 {
+		if err := receipts.Report(ctx, h.rdb, id, receipts.StatusDelivered, "web", 0, ""); err != nil {
+			log.Printf("Failed to report delivery of %s: %v", id, err)
+		}
+	}
+}
+
+// unackedFrames returns the frames held for a session, oldest first.
+func (h *WSHandler) unackedFrames(ctx context.Context, sessionID string) []models.WSResponse {
+	key := unackedPrefix + sessionID
+	held, err := h.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		log.Printf("Failed to load held frames of session %s: %v", sessionID, err)
+		return nil
+	}
+	items := make([]unacked, 0, len(held))
+	for id, data := range held {
+		var u unacked
+		if err := json.Unmarshal([]byte(data), &u); err != nil {
+			log.Printf("Failed to unmarshal held frame %s: %v", id, err)
+			h.rdb.HDel(ctx, key, id)
+			continue
+		}
+		items = append(items, u)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].At < items[j].At })
+
+	frames := make([]models.WSResponse, 0, len(items))
+	for _, u := range items {
+		var resp models.WSResponse
+		if err := json.Unmarshal(u.Frame, &resp); err != nil || resp.ID == "" {
+			continue
+		}
+		frames = append(frames, resp)
+	}
+	if len(frames) > maxRedelivered {
+		for _, resp := range frames[:len(frames)-maxRedelivered] {
+			h.rdb.HDel(ctx, key, resp.ID)
+		}
+		frames = frames[len(frames)-maxRedelivered:]
+	}
+	return frames
+}
+
+// held reports whether a frame is one the orchestrator holds until it is
+// acknowledged.
+func held(resp models.WSResponse) bool {
+	return resp.ID != "" && (resp.Type == "message" || resp.Type == "notice" || resp.Type == "correction")
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/apikeys"
+	"channel-adapter/audit"
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+)
+
+// maxAgentSessions bounds how many sessions one agent connection watches.
+const maxAgentSessions = 50
+
+var (
+	agentConnectionsTotal = metrics.NewCounterVec("channel_adapter_agent_connections_total",
+		"Agent console connections, by whether the API key was accepted.", "outcome")
+	agentRepliesTotal = metrics.NewCounterVec("channel_adapter_agent_replies_total",
+		"Replies agents sent to users from the agent console.")
+)
+
+// AgentIncoming is what the agent console sends: attach or detach a
+// session, or reply to its user.
+type AgentIncoming struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Text      string `json:"text,omitempty"`
+}
+
+// AgentFrame is what the agent console is sent. Frame carries what the
+// session's user was sent, on "frame"; Text and Channel the user's own
+// messages, on "user_message". Agent is the agent's name, on "connected".
+type AgentFrame struct {
+	Type      string             `json:"type"`
+	Agent     string             `json:"agent,omitempty"`
+	SessionID string             `json:"session_id,omitempty"`
+	ID        string             `json:"id,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	Channel   string             `json:"channel,omitempty"`
+	At        *time.Time         `json:"at,omitempty"`
+	Frame     *models.WSResponse `json:"frame,omitempty"`
+}
+
+// AgentHandler serves /ws/agent, where a human agent attaches to any
+// session on any channel, sees what the user and the assistant send as it
+// happens and replies to the user themself. Agents are identified by an API
+// key with the agent scope, whose name is shown to users with the reply.
+// Every attach is recorded in the access audit log, like a transcript read.
+type AgentHandler struct {
+	ws    *WSHandler
+	keys  *apikeys.Authenticator
+	audit *audit.Log
+}
+
+func NewAgentHandler(ws *WSHandler, keys *apikeys.Authenticator, accessLog *audit.Log) *AgentHandler {
+	return &AgentHandler{ws: ws, keys: keys, audit: accessLog}
+}
+
+// agentSession is an agent connection's view of the sessions it watches.
+type agentSession struct {
+	mu         sync.Mutex
+	attached   map[string]bool
+	remoteAddr string
+}
+
+func (a *agentSession) has(sessionID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.attached[sessionID]
+}
+
+func (h *AgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.checkOrigin(r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	key, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if !h.ws.track() {
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "server is shutting down", time.Second)
+		return
+	}
+	defer h.ws.open.Done()
+
+	raw, err := h.ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Agent WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	defer raw.Close()
+	raw.SetReadLimit(h.ws.maxFrameSize)
+	conn := newWSConn(raw)
+	// Agents watch more than they type
+	conn.idleExempt = true
+	log.Printf("Agent %s connected", key.Name)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go conn.keepalive(ctx)
+
+	pubsub := h.ws.rdb.Subscribe(ctx)
+	defer pubsub.Close()
+	view := &agentSession{attached: make(map[string]bool), remoteAddr: r.RemoteAddr}
+	go h.forwardFrames(ctx, conn, pubsub, cancel)
+	go h.forwardUserMessages(ctx, conn, view)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.ws.closing:
+			reapedTotal.Inc("shutdown")
+			conn.closeForShutdown()
+		}
+	}()
+	conn.WriteJSON(AgentFrame{Type: "connected", Agent: key.Name})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Printf("Agent %s disconnected: %v", key.Name, err)
+			}
+			return
+		}
+		var in AgentIncoming
+		if err := json.Unmarshal(message, &in); err != nil {
+			conn.WriteJSON(AgentFrame{Type: "error", Text: "Invalid message format."})
+			continue
+		}
+		// Sessions of other channels have addresses in their IDs
+		if in.SessionID == "" || len(in.SessionID) > maxSessionID || strings.ContainsFunc(in.SessionID, isControl) {
+			conn.WriteJSON(AgentFrame{Type: "error", Text: "a valid session_id is required"})
+			continue
+		}
+		conn.WriteJSON(h.handle(ctx, key.Name, view, pubsub, in))
+	}
+}
+
+// handle carries out one request from the agent and returns the answer to
+// send back.
+func (h *AgentHandler) handle(ctx context.Context, agent string, view *agentSession, pubsub *redis.PubSub, in AgentIncoming) AgentFrame {
+	view.mu.Lock()
+	defer view.mu.Unlock()
+	fail := func(text string) AgentFrame {
+		return AgentFrame{Type: "error", SessionID: in.SessionID, Text: text}
+	}
+	switch in.Type {
+	case "attach":
+		if view.attached[in.SessionID] {
+			return AgentFrame{Type: "attached", SessionID: in.SessionID}
+		}
+		if len(view.attached) >= maxAgentSessions {
+			return fail("too many sessions attached")
+		}
+		// Watching a session reads its conversation; the console is there to
+		// support its user
+		if err := h.audit.Record(ctx, audit.Access{
+			Actor:      agent,
+			SessionID:  in.SessionID,
+			Resource:   "live",
+			Reason:     "support_request",
+			RemoteAddr: view.remoteAddr,
+		}); err != nil {
+			log.Printf("Failed to audit agent %s attaching to session %s: %v", agent, in.SessionID, err)
+			return fail("failed to attach")
+		}
+		if err := pubsub.Subscribe(ctx, "response:"+in.SessionID); err != nil {
+			log.Printf("Failed to attach agent %s to session %s: %v", agent, in.SessionID, err)
+			return fail("failed to attach")
+		}
+		view.attached[in.SessionID] = true
+		log.Printf("Agent %s attached to session %s", agent, in.SessionID)
+		return AgentFrame{Type: "attached", SessionID: in.SessionID}
+	case "detach":
+		if view.attached[in.SessionID] {
+			pubsub.Unsubscribe(ctx, "response:"+in.SessionID)
+			delete(view.attached, in.SessionID)
+		}
+		return AgentFrame{Type: "detached", SessionID: in.SessionID}
+	case "reply":
+		if !view.attached[in.SessionID] {
+			return fail("attach to the session before replying")
+		}
+		text := strings.TrimSpace(in.Text)
+		if text == "" {
+			return fail("text is required")
+		}
+		if n := len([]rune(text)); n > MaxMessageLength {
+			return fail("text is too long")
+		}
+		envelope, err := h.reply(ctx, agent, in.SessionID, text)
+		if err != nil {
+			log.Printf("Failed to send agent %s's reply to session %s: %v", agent, in.SessionID, err)
+			return fail("failed to send reply")
+		}
+		agentRepliesTotal.Inc()
+		return AgentFrame{Type: "sent", SessionID: in.SessionID, ID: envelope.MessageID}
+	}
+	return fail(`type must be "attach", "detach" or "reply"`)
+}
+
+// reply publishes the agent's reply for the orchestrator to deliver on the
+// session's own channel, taken from its transcript.
+func (h *AgentHandler) reply(ctx context.Context, agent, sessionID, text string) (models.MessageEnvelope, error) {
+	envelope := adapters.NormalizeWebMessage(sessionID, text, adapters.ClientInfo{})
+	envelope.Deadline = nil
+	envelope.Metadata.Client = nil
+	envelope.Agent = agent
+	meta, err := h.ws.rdb.HMGet(ctx, transcriptMetaPrefix+sessionID, "channel", "user_id").Result()
+	if err != nil {
+		return envelope, err
+	}
+	if channel, _ := meta[0].(string); channel != "" {
+		envelope.Channel = channel
+	}
+	if user, _ := meta[1].(string); user != "" {
+		envelope.UserID = user
+	}
+	return envelope, h.ws.publish(ctx, envelope)
+}
+
+// forwardFrames sends the agent what the attached sessions' users are sent.
+// Echoes of web users' messages are skipped; the stream shows those.
+func (h *AgentHandler) forwardFrames(ctx context.Context, conn *wsConn, pubsub *redis.PubSub, cancel context.CancelFunc) {
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			if resp.Type == "user_message" {
+				continue
+			}
+			sessionID := strings.TrimPrefix(msg.Channel, "response:")
+			if err := conn.WriteJSON(AgentFrame{Type: "frame", SessionID: sessionID, Frame: &resp}); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// forwardUserMessages tails msg:inbound for what the attached sessions'
+// users send, on any channel.
+func (h *AgentHandler) forwardUserMessages(ctx context.Context, conn *wsConn, view *agentSession) {
+	last := "$"
+	for ctx.Err() == nil {
+		streams, err := h.ws.rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{"msg:inbound", last},
+			Count:   100,
+			Block:   5 * time.Second,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to read inbound messages for agent console: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				last = msg.ID
+				data, _ := msg.Values["envelope"].(string)
+				var envelope models.MessageEnvelope
+				if err := json.Unmarshal([]byte(data), &envelope); err != nil || !view.has(envelope.SessionID) {
+					continue
+				}
+				// Agent replies, edits and deletions show up as frames; probes
+				// and merges aren't the user speaking
+				if envelope.Agent != "" || envelope.Edits != "" || envelope.Probe || envelope.MergeFrom != "" {
+					continue
+				}
+				at := envelope.Timestamp
+				conn.WriteJSON(AgentFrame{
+					Type:      "user_message",
+					SessionID: envelope.SessionID,
+					ID:        envelope.MessageID,
+					Text:      envelope.Content.Text,
+					Channel:   envelope.Channel,
+					At:        &at,
+				})
+			}
+		}
+	}
+}
+
+// authorize checks the agent's API key, from the Authorization header only:
+// a key in the URL would end up in access logs.
+func (h *AgentHandler) authorize(w http.ResponseWriter, r *http.Request) (*apikeys.Key, bool) {
+	secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	key, err := h.keys.Authorize(r.Context(), secret, "agent")
+	var limited *apikeys.LimitError
+	switch {
+	case err == nil:
+		agentConnectionsTotal.Inc("accepted")
+		return key, true
+	case errors.Is(err, apikeys.ErrInvalid):
+		agentConnectionsTotal.Inc("unauthorized")
+		httperr.Write(w, r, http.StatusUnauthorized, "unauthorized")
+	case errors.Is(err, apikeys.ErrScope):
+		agentConnectionsTotal.Inc("forbidden")
+		httperr.Write(w, r, http.StatusForbidden, err.Error())
+	case errors.As(err, &limited):
+		agentConnectionsTotal.Inc("rate_limited")
+		httperr.WriteRetry(w, r, http.StatusTooManyRequests, err.Error(), limited.RetryAfter)
+	default:
+		log.Printf("Failed to check API key: %v", err)
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to check API key", 5*time.Second)
+	}
+	return nil, false
+}
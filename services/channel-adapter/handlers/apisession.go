@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/apikeys"
+	"channel-adapter/metrics"
+)
+
+// An API session belongs to the API key, or the shared token, that started
+// it, so a caller can't post into another partner's sessions or a web
+// user's and read their answers.
+const apiOwnerPrefix = "api:session-owner:"
+
+var apiSessionsTotal = metrics.NewCounterVec("channel_adapter_api_sessions_total",
+	"Session checks on /v1/chat and gRPC, by outcome.", "outcome")
+
+// apiOwner names the caller a session is bound to.
+func apiOwner(key *apikeys.Key) string {
+	if key == nil {
+		return "token"
+	}
+	return "key:" + key.ID
+}
+
+// claimAPISession reports whether the caller with key may use sessionID,
+// binding the session to it if it is new. A session that already exists
+// without an API owner, from the web or from before sessions had owners,
+// is refused.
+func (h *ChatHandler) claimAPISession(ctx context.Context, sessionID string, key *apikeys.Key) (bool, error) {
+	owner := apiOwner(key)
+	ownerKey := apiOwnerPrefix + sessionID
+	current, err := h.rdb.Get(ctx, ownerKey).Result()
+	if err == redis.Nil {
+		n, err := h.rdb.Exists(ctx, sessionKeyPrefix+sessionID, transcriptMetaPrefix+sessionID, replayPrefix+sessionID).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to check session: %w", err)
+		}
+		if n > 0 {
+			apiSessionsTotal.Inc("unowned")
+			return false, nil
+		}
+		won, err := h.rdb.SetNX(ctx, ownerKey, owner, sessionOwnerTTL).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to bind session: %w", err)
+		}
+		if won {
+			apiSessionsTotal.Inc("bound")
+			return true, nil
+		}
+		current, err = h.rdb.Get(ctx, ownerKey).Result()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load session owner: %w", err)
+	}
+	if current != owner {
+		apiSessionsTotal.Inc("wrong_owner")
+		return false, nil
+	}
+	// Kept for as long as the session is in use
+	h.rdb.Expire(ctx, ownerKey, sessionOwnerTTL)
+	apiSessionsTotal.Inc("verified")
+	return true, nil
+}
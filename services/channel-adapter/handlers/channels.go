@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/channels"
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+)
+
+const maxNormalizeBody = 1 << 20
+
+var (
+	_ channels.Adapter = (*TelegramHandler)(nil)
+	_ channels.Adapter = (*EmailHandler)(nil)
+	_ channels.Adapter = (*SMSHandler)(nil)
+	_ channels.Adapter = (*DiscordHandler)(nil)
+	_ channels.Adapter = (*IRCHandler)(nil)
+	_ channels.Adapter = (*XMPPHandler)(nil)
+	_ channels.Adapter = (*GBMHandler)(nil)
+	_ channels.Adapter = (*ViberHandler)(nil)
+	_ channels.Adapter = (*WhatsAppHandler)(nil)
+)
+
+// subscribeResponses subscribes to the response channels of every session
+// starting with prefix. The subscription is closed when ctx is done, which
+// ends a Deliver loop ranging over it.
+func subscribeResponses(ctx context.Context, rdb *redis.Client, prefix string) *redis.PubSub {
+	pubsub := rdb.PSubscribe(ctx, "response:"+prefix+"*")
+	context.AfterFunc(ctx, func() { pubsub.Close() })
+	return pubsub
+}
+
+// NormalizeHandler serves POST /conformance/normalize/{channel}: it runs a
+// captured platform payload through that channel's Normalize and returns the
+// envelopes it would publish, without publishing them.
+type NormalizeHandler struct {
+	registry *channels.Registry
+}
+
+func NewNormalizeHandler(registry *channels.Registry) *NormalizeHandler {
+	return &NormalizeHandler{registry: registry}
+}
+
+func (h *NormalizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	adapter, ok := h.registry.Get(r.PathValue("channel"))
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "channel is not running on this instance")
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNormalizeBody))
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	envelopes, err := adapter.Normalize(r.Context(), payload)
+	if err != nil {
+		httperr.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if envelopes == nil {
+		envelopes = []models.MessageEnvelope{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"envelopes": envelopes})
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/apikeys"
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+)
+
+const (
+	maxChatBody = 64 << 10
+	// Callers may ask for a shorter wait, or a longer one up to this cap
+	maxChatTimeout = 2 * time.Minute
+)
+
+var chatRequestsTotal = metrics.NewCounterVec("channel_adapter_chat_requests_total",
+	"Synchronous REST chat requests by outcome.", "outcome")
+
+// ChatRequest is the body of POST /v1/chat. SessionID is optional; a new
+// session is started when it is empty, and only the key that started a
+// session may use it. ExternalID is the caller's own ID for
+// the message, recorded for tracing. Format picks how the answer is rendered,
+// one of chatFormats.
+type ChatRequest struct {
+	SessionID      string          `json:"session_id,omitempty"`
+	ExternalID     string          `json:"external_id,omitempty"`
+	UserID         string          `json:"user_id,omitempty"`
+	Text           string          `json:"text"`
+	Language       string          `json:"language,omitempty"`
+	ResponseSchema json.RawMessage `json:"response_schema,omitempty"`
+	TimeoutMS      int             `json:"timeout_ms,omitempty"`
+	Format         string          `json:"format,omitempty"`
+	// TimeZone is the end user's IANA zone, for time-relative answers.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// chatFormats are the renderings /v1/chat offers: the canonical text and
+// rich content, text for plain-text channels, or Slack blocks.
+var chatFormats = map[string]bool{"": true, "plain": true, "slack": true}
+
+type ChatResponse struct {
+	SessionID string                `json:"session_id"`
+	MessageID string                `json:"message_id"`
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Data      json.RawMessage       `json:"data,omitempty"`
+	Rich      *models.RichContent   `json:"rich,omitempty"`
+	Blocks    []adapters.SlackBlock `json:"blocks,omitempty"`
+	// Sources and Usage are only sent in the done event of a streamed
+	// answer.
+	Sources []models.Citation `json:"sources,omitempty"`
+	Usage   *models.Usage     `json:"usage,omitempty"`
+}
+
+// ChatHandler serves POST /v1/chat for server-to-server integrations that
+// cannot hold a WebSocket. It publishes the message on msg:inbound and
+// blocks until the answer arrives on the session's response channel.
+type ChatHandler struct {
+	rdb     *redis.Client
+	token   string
+	timeout time.Duration
+	keys    *apikeys.Authenticator
+}
+
+func NewChatHandler(rdb *redis.Client, token string, timeout time.Duration) *ChatHandler {
+	return &ChatHandler{rdb: rdb, token: token, timeout: timeout}
+}
+
+// EnableAPIKeys also accepts API keys with the chat scope, so each partner
+// integration is identified and limited separately. The shared token, if
+// any, keeps working.
+func (h *ChatHandler) EnableAPIKeys(keys *apikeys.Authenticator) {
+	h.keys = keys
+}
+
+// authenticate checks an Authorization header and returns the API key it
+// carries, or nil for the shared token.
+func (h *ChatHandler) authenticate(ctx context.Context, header, scope string) (*apikeys.Key, error) {
+	if h.token != "" && subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+h.token)) == 1 {
+		return nil, nil
+	}
+	secret, ok := strings.CutPrefix(header, "Bearer ")
+	if h.keys == nil || !ok {
+		return nil, apikeys.ErrInvalid
+	}
+	return h.keys.Authorize(ctx, secret, scope)
+}
+
+// authorize checks the caller's credentials and returns the API key they
+// used, or nil for the shared token. It writes the error response itself
+// when the request is refused.
+func (h *ChatHandler) authorize(w http.ResponseWriter, r *http.Request, scope string) (*apikeys.Key, bool) {
+	key, err := h.authenticate(r.Context(), r.Header.Get("Authorization"), scope)
+	var limited *apikeys.LimitError
+	switch {
+	case err == nil:
+		return key, true
+	case errors.Is(err, apikeys.ErrInvalid):
+		chatRequestsTotal.Inc("unauthorized")
+		httperr.Write(w, r, http.StatusUnauthorized, "unauthorized")
+	case errors.Is(err, apikeys.ErrScope):
+		chatRequestsTotal.Inc("forbidden")
+		httperr.Write(w, r, http.StatusForbidden, err.Error())
+	case errors.As(err, &limited):
+		chatRequestsTotal.Inc("rate_limited")
+		httperr.WriteRetry(w, r, http.StatusTooManyRequests, err.Error(), limited.RetryAfter)
+	default:
+		log.Printf("Failed to check API key: %v", err)
+		chatRequestsTotal.Inc("unavailable")
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to check API key", 5*time.Second)
+	}
+	return nil, false
+}
+
+func (h *ChatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stream := wantsStream(r)
+	scope := "chat"
+	if stream {
+		scope = "stream"
+	}
+	key, ok := h.authorize(w, r, scope)
+	if !ok {
+		return
+	}
+	flusher, canFlush := w.(http.Flusher)
+	if stream && !canFlush {
+		httperr.Write(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	var req ChatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxChatBody)).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "text is required")
+		return
+	}
+	if req.SessionID != "" && !validSessionID(req.SessionID) {
+		httperr.Write(w, r, http.StatusBadRequest, fmt.Sprintf("session_id must be at most %d letters, digits, '-', '_' or '.'", maxSessionID))
+		return
+	}
+	if !chatFormats[req.Format] {
+		httperr.Write(w, r, http.StatusBadRequest, "format must be plain or slack")
+		return
+	}
+	if req.TimeZone != "" && !adapters.ValidTimeZone(req.TimeZone) {
+		httperr.Write(w, r, http.StatusBadRequest, `time_zone must be an IANA zone such as "Asia/Kathmandu"`)
+		return
+	}
+	schema, err := checkSchema(req.ResponseSchema)
+	var bad *ValidationError
+	if errors.As(err, &bad) {
+		httperr.Write(w, r, http.StatusBadRequest, bad.Text)
+		return
+	}
+	timeout := h.timeout
+	if req.TimeoutMS > 0 {
+		timeout = min(time.Duration(req.TimeoutMS)*time.Millisecond, maxChatTimeout)
+	}
+	if req.SessionID == "" {
+		req.SessionID = uuid.New().String()
+	}
+	if ok, err := h.claimAPISession(r.Context(), req.SessionID, key); err != nil {
+		log.Printf("Failed to check chat session %s: %v", req.SessionID, err)
+		chatRequestsTotal.Inc("unavailable")
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to check session", 5*time.Second)
+		return
+	} else if !ok {
+		chatRequestsTotal.Inc("forbidden")
+		httperr.Write(w, r, http.StatusForbidden, "session belongs to another client")
+		return
+	}
+
+	envelope := adapters.NormalizeAPIMessage(req.SessionID, req.UserID, req.Text, req.Language, timeout)
+	envelope.ResponseSchema = schema
+	envelope.ExternalID = req.ExternalID
+	envelope.Stream = stream
+	envelope.TimeZone = req.TimeZone
+	if key != nil {
+		envelope.Metadata.PlatformData["api_key_id"] = key.ID
+		envelope.Metadata.PlatformData["partner"] = key.Name
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Subscribe before publishing so a fast answer is not missed
+	pubsub := h.rdb.Subscribe(ctx, fmt.Sprintf("response:%s", envelope.SessionID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("Failed to subscribe for chat session %s: %v", envelope.SessionID, err)
+		chatRequestsTotal.Inc("unavailable")
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to reach message broker", 5*time.Second)
+		return
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to encode message")
+		return
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish chat message for session %s: %v", envelope.SessionID, err)
+		chatRequestsTotal.Inc("unavailable")
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to publish message", 5*time.Second)
+		return
+	}
+
+	if stream {
+		h.stream(ctx, w, r, flusher, pubsub, envelope, req.Format, timeout)
+		return
+	}
+	resp, err := h.await(ctx, pubsub, envelope.MessageID)
+	if err != nil {
+		if r.Context().Err() != nil {
+			chatRequestsTotal.Inc("cancelled")
+			return
+		}
+		chatRequestsTotal.Inc("timeout")
+		httperr.Write(w, r, http.StatusGatewayTimeout, fmt.Sprintf("no answer within %s", timeout))
+		return
+	}
+
+	out := chatResponse(envelope, resp, req.Format)
+	if resp.Type == "error" {
+		chatRequestsTotal.Inc("error")
+		httperr.Write(w, r, http.StatusBadGateway, resp.Text)
+		return
+	}
+	chatRequestsTotal.Inc("answered")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// chatResponse renders the answer to envelope in format.
+func chatResponse(envelope models.MessageEnvelope, resp models.WSResponse, format string) ChatResponse {
+	out := ChatResponse{
+		SessionID: envelope.SessionID,
+		MessageID: envelope.MessageID,
+		Type:      resp.Type,
+		Text:      resp.Text,
+		Data:      resp.Data,
+		Rich:      resp.Rich,
+	}
+	switch format {
+	case "plain":
+		out.Text, out.Rich = adapters.PlainText(resp), nil
+	case "slack":
+		out.Blocks = adapters.SlackBlocks(resp)
+	}
+	return out
+}
+
+// await waits for the answer to the message just sent. Typing and accepted
+// frames are progress only.
+func (h *ChatHandler) await(ctx context.Context, pubsub *redis.PubSub, messageID string) (models.WSResponse, error) {
+	answer := answerCollector{messageID: messageID}
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return models.WSResponse{}, ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return models.WSResponse{}, fmt.Errorf("subscription closed")
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			if resp, done := answer.add(resp); done {
+				return resp, nil
+			}
+		}
+	}
+}
+
+// answerCollector picks the answer to messageID out of a session's frames.
+// Pinned answers, notices and errors do not carry the message ID, so the
+// first user-visible frame is taken as the answer; callers should send one
+// message per session at a time. Split answers are joined back into one
+// text.
+type answerCollector struct {
+	messageID string
+	parts     []string
+}
+
+// add reports the answer once resp completes it.
+func (c *answerCollector) add(resp models.WSResponse) (models.WSResponse, bool) {
+	switch resp.Type {
+	case "message", "notice", "error":
+	default:
+		return resp, false
+	}
+	if resp.Parts > 1 {
+		if resp.ID != c.messageID && !strings.HasPrefix(resp.ID, c.messageID+".") {
+			return resp, false
+		}
+		c.parts = append(c.parts, resp.Text)
+		if len(c.parts) < resp.Parts {
+			return resp, false
+		}
+		resp.Text = strings.Join(c.parts, " ")
+	}
+	return resp, true
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+)
+
+// wantsStream reports whether a /v1/chat caller asked for the answer as
+// Server-Sent Events.
+func wantsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// stream relays the answer to envelope as it is generated: delta events
+// carry pieces of text, typing and accepted events progress, and a final
+// done event the whole answer as /v1/chat returns it, with its sources and
+// usage. The done text is the answer as verified, which can differ from the
+// deltas; it is what callers should keep. A failure ends the stream with an
+// error event.
+func (h *ChatHandler) stream(ctx context.Context, w http.ResponseWriter, r *http.Request, flusher http.Flusher, pubsub *redis.PubSub, envelope models.MessageEnvelope, format string, timeout time.Duration) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	answer := answerCollector{messageID: envelope.MessageID}
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			if r.Context().Err() != nil {
+				chatRequestsTotal.Inc("cancelled")
+				return
+			}
+			chatRequestsTotal.Inc("timeout")
+			writeChatEvent(w, "error", map[string]string{
+				"code":    "timeout",
+				"message": fmt.Sprintf("no answer within %s", timeout),
+			})
+			flusher.Flush()
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+			continue
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			switch resp.Type {
+			case "delta":
+				if resp.ID == envelope.MessageID {
+					writeChatEvent(w, "delta", map[string]string{"text": resp.Text})
+				}
+			case "typing", "accepted":
+				writeChatEvent(w, resp.Type, map[string]string{"text": resp.Text})
+			default:
+				resp, done := answer.add(resp)
+				if !done {
+					continue
+				}
+				if resp.Type == "error" {
+					chatRequestsTotal.Inc("error")
+					writeChatEvent(w, "error", map[string]string{"code": "bad_gateway", "message": resp.Text})
+					flusher.Flush()
+					return
+				}
+				out := chatResponse(envelope, resp, format)
+				if resp.Rich != nil {
+					out.Sources = resp.Rich.Citations
+				}
+				out.Usage = resp.Usage
+				chatRequestsTotal.Inc("answered")
+				writeChatEvent(w, "done", out)
+				flusher.Flush()
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeChatEvent(w http.ResponseWriter, event string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
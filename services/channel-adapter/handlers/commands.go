@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/commands"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// HelpText is the /help answer; main sets it from the environment.
+var HelpText = commands.DefaultHelp
+
+var commandsTotal = metrics.NewCounterVec("channel_adapter_commands_total",
+	"Slash commands users sent, by command.", "command")
+
+// slashCommand handles a slash command before its message is published.
+// /help and commands that were sent wrong are answered here, and it reports
+// that nothing is left to publish; the commands that change the session are
+// turned into control envelopes for the orchestrator.
+func slashCommand(ctx context.Context, rdb *redis.Client, envelope *models.MessageEnvelope) bool {
+	cmd, ok := commands.Parse(envelope.Content.Text)
+	if !ok {
+		return false
+	}
+	commandsTotal.Inc(cmd.Name)
+	if cmd.Name == "help" {
+		notify(ctx, rdb, envelope.SessionID, HelpText)
+		return true
+	}
+	if usage := cmd.Usage(); usage != "" {
+		notify(ctx, rdb, envelope.SessionID, usage)
+		return true
+	}
+	envelope.Command = cmd.Name
+	envelope.Content = models.MessageContent{Type: "command", Text: cmd.Arg}
+	return false
+}
+
+// notify sends the session a notice on whatever channel it is on.
+func notify(ctx context.Context, rdb *redis.Client, sessionID, text string) {
+	payload, err := json.Marshal(models.WSResponse{Type: "notice", Text: text, SessionID: sessionID})
+	if err != nil {
+		return
+	}
+	if err := rdb.Publish(ctx, "response:"+sessionID, string(payload)).Err(); err != nil {
+		log.Printf("Failed to answer command in session %s: %v", sessionID, err)
+	}
+}
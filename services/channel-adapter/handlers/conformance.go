@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+)
+
+const (
+	conformanceMaxDelay = 5 * time.Second
+	conformanceTimeout  = 30 * time.Second
+)
+
+// conformanceStep is either a frame the server sends or an input it waits
+// for.
+type conformanceStep struct {
+	name   string
+	expect string
+	build  func(run *conformanceRun) models.WSResponse
+}
+
+// conformanceRun is what the steps of one run share: the text of the last
+// client message and the ID of the echoed answer, which later frames refer to.
+type conformanceRun struct {
+	sessionID string
+	lastText  string
+	answerID  string
+}
+
+// conformanceScript walks through every server frame type in the order a
+// real conversation produces them. Keep it in sync with docs/websocket-api.md
+// whenever a frame type is added.
+var conformanceScript = []conformanceStep{
+	{name: "connected", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "connected", SessionID: run.sessionID, Instance: InstanceID, Reconnect: reconnectHint(run.sessionID)}
+	}},
+	{name: "welcome_back", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "welcome_back", SessionID: run.sessionID, Text: "Welcome back! Ask me anything to carry on."}
+	}},
+	{name: "await_text", expect: "text"},
+	{name: "typing", build: func(_ *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "typing"}
+	}},
+	{name: "accepted", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "accepted", Text: "Got it! I'm working on your answer and will reply shortly.", SessionID: run.sessionID}
+	}},
+	{name: "delta", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: run.answerID, Type: "delta", Text: "You said: ", SessionID: run.sessionID}
+	}},
+	{name: "delta", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: run.answerID, Type: "delta", Text: run.lastText, SessionID: run.sessionID}
+	}},
+	{name: "message", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: run.answerID, Type: "message", Text: "You said: " + run.lastText, SessionID: run.sessionID}
+	}},
+	{name: "await_ack", expect: "ack"},
+	{name: "structured_message", build: func(run *conformanceRun) models.WSResponse {
+		data, _ := json.Marshal(map[string]interface{}{"echo": run.lastText, "length": len([]rune(run.lastText))})
+		return models.WSResponse{ID: uuid.New().String(), Type: "message", Text: "Structured echo", SessionID: run.sessionID, Data: data}
+	}},
+	{name: "rich_message", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: uuid.New().String(), Type: "message", Text: "Here are some options.", SessionID: run.sessionID, Rich: &models.RichContent{
+			Buttons:   []models.Button{{Text: "Say it again", Value: run.lastText}, {Text: "Docs", URL: "https://example.com/docs"}},
+			Images:    []models.Image{{URL: "https://example.com/conformance.png", Alt: "Conformance"}},
+			Citations: []models.Citation{{Title: "conformance.md"}},
+		}}
+	}},
+	{name: "correction", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: uuid.New().String(), Type: "correction", Text: "You said, corrected: " + run.lastText, SessionID: run.sessionID, Corrects: run.answerID}
+	}},
+	{name: "user_message", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: uuid.New().String(), Type: "user_message", Text: "A message from another tab.", SessionID: run.sessionID, Connection: "conformance"}
+	}},
+	{name: "edited", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: run.answerID, Type: "edited", Text: run.lastText + " (edited)", SessionID: run.sessionID}
+	}},
+	{name: "deleted", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: run.answerID, Type: "deleted", SessionID: run.sessionID}
+	}},
+	{name: "notice", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{ID: uuid.New().String(), Type: "notice", Text: "This is a conformance notice.", SessionID: run.sessionID}
+	}},
+	{name: "rate_limited", build: func(_ *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "rate_limited", Text: "You're sending messages too quickly. Please wait a moment and try again.", RetryAfterMS: 1000}
+	}},
+	{name: "merged", build: func(run *conformanceRun) models.WSResponse {
+		data, _ := json.Marshal(map[string]interface{}{"session_id": run.sessionID, "merged_from": "conformance-merged", "turns": 2})
+		return models.WSResponse{Type: "merged", SessionID: run.sessionID, Data: data}
+	}},
+	{name: "await_invalid", expect: "invalid"},
+	{name: "error", build: func(_ *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "error", Text: "Invalid message format. Send JSON with a 'text' field."}
+	}},
+	{name: "handoff", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "handoff", Text: "You're being connected to a member of our team.", SessionID: run.sessionID, Data: json.RawMessage(`{"reason":"conformance"}`)}
+	}},
+	{name: "lifecycle", build: func(run *conformanceRun) models.WSResponse {
+		payload := fmt.Sprintf(`{"type":"conversation.handoff","session_id":%q,"reason":"conformance","occurred_at":%q}`, run.sessionID, time.Now().UTC().Format(time.RFC3339))
+		data, _ := json.Marshal(map[string]string{"event": "conversation.handoff", "payload": payload, "signature": "t=0,v1=conformance"})
+		return models.WSResponse{Type: "lifecycle", SessionID: run.sessionID, Data: data}
+	}},
+	{name: "terminated", build: func(run *conformanceRun) models.WSResponse {
+		return models.WSResponse{Type: "terminated", Text: "Conformance run complete.", SessionID: run.sessionID}
+	}},
+}
+
+// ConformanceHandler serves /ws/conformance, a scripted peer that SDK and
+// widget developers can test their clients against. It uses the same frame
+// shapes as /ws but never touches Redis or the orchestrator.
+type ConformanceHandler struct {
+	upgrader websocket.Upgrader
+}
+
+func NewConformanceHandler() *ConformanceHandler {
+	return &ConformanceHandler{upgrader: websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+		Error:       upgradeError,
+	}}
+}
+
+func (h *ConformanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delay := time.Duration(0)
+	if v := r.URL.Query().Get("step_delay_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			httperr.Write(w, r, http.StatusBadRequest, "step_delay_ms must be a non-negative integer")
+			return
+		}
+		delay = min(time.Duration(ms)*time.Millisecond, conformanceMaxDelay)
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Conformance upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	run := &conformanceRun{sessionID: "conformance-" + uuid.New().String(), answerID: uuid.New().String()}
+	for _, step := range conformanceScript {
+		if step.expect != "" {
+			text, err := awaitFrame(conn, step.expect, run.answerID)
+			if err != nil {
+				conn.WriteJSON(models.WSResponse{Type: "error", Text: fmt.Sprintf("conformance step %s failed: %v", step.name, err)})
+				return
+			}
+			if text != "" {
+				run.lastText = text
+			}
+			continue
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		if err := conn.WriteJSON(step.build(run)); err != nil {
+			log.Printf("Conformance write failed at %s: %v", step.name, err)
+			return
+		}
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "conformance complete"),
+		time.Now().Add(time.Second))
+}
+
+// awaitFrame reads one client frame and checks it against the expectation:
+// "text" requires a valid WSIncoming with non-empty text, "ack" an ack of
+// answerID, and "invalid" a frame the server would reject.
+func awaitFrame(conn *websocket.Conn, expect, answerID string) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(conformanceTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return "", fmt.Errorf("read failed: %w", err)
+	}
+	var incoming models.WSIncoming
+	parseErr := json.Unmarshal(data, &incoming)
+
+	switch expect {
+	case "text":
+		if parseErr != nil {
+			return "", fmt.Errorf("expected a JSON text frame: %v", parseErr)
+		}
+		if incoming.Text == "" {
+			return "", fmt.Errorf("expected a non-empty text field")
+		}
+		return incoming.Text, nil
+	case "ack":
+		if parseErr != nil {
+			return "", fmt.Errorf("expected a JSON ack frame: %v", parseErr)
+		}
+		if incoming.Ack != answerID {
+			return "", fmt.Errorf("expected an ack of %s", answerID)
+		}
+		return "", nil
+	case "invalid":
+		if parseErr == nil {
+			return "", fmt.Errorf("expected a malformed frame, got valid JSON")
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown expectation %q", expect)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/httperr"
+)
+
+// Written by the orchestrator's transcript archive; keep the field layout
+// in sync.
+const (
+	transcriptPrefix     = "transcript:"
+	transcriptMetaPrefix = "transcript:meta:"
+	userTranscriptsKey   = "transcripts:user:"
+)
+
+const (
+	defaultConversations = 20
+	maxConversations     = 100
+)
+
+// Conversation summarizes one of a user's past conversations.
+type Conversation struct {
+	SessionID  string    `json:"session_id"`
+	Title      string    `json:"title"`
+	Channel    string    `json:"channel"`
+	Turns      int       `json:"turns"`
+	StartedAt  time.Time `json:"started_at"`
+	LastActive time.Time `json:"last_active"`
+}
+
+// ConversationTurn is a message of a past conversation as shown to its user.
+type ConversationTurn struct {
+	MessageID   string    `json:"message_id,omitempty"`
+	Role        string    `json:"role"`
+	Content     string    `json:"content"`
+	Timestamp   time.Time `json:"timestamp"`
+	Attachments []string  `json:"attachments,omitempty"`
+	// Edits is set on a message that replaced, or when Deleted withdrew,
+	// the earlier message with that ID.
+	Edits   string `json:"edits,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// ConversationsHandler lets a signed-in web user find their past
+// conversations. One is resumed by connecting with its session_id.
+type ConversationsHandler struct {
+	ws *WSHandler
+}
+
+// NewConversationsHandler shares ws's origin policy and token verifier.
+func NewConversationsHandler(ws *WSHandler) *ConversationsHandler {
+	return &ConversationsHandler{ws: ws}
+}
+
+// List serves GET /v1/conversations, most recently active first. Older
+// pages are fetched with before set to the last_active of the last
+// conversation, in Unix seconds.
+func (h *ConversationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.signedIn(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultConversations
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			httperr.Write(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxConversations)
+	}
+	upper := "+inf"
+	if v := r.URL.Query().Get("before"); v != "" {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			httperr.Write(w, r, http.StatusBadRequest, "before must be a Unix timestamp")
+			return
+		}
+		upper = "(" + v
+	}
+
+	ctx := r.Context()
+	ids, err := h.ws.rdb.ZRevRangeByScore(ctx, userTranscriptsKey+webUserID(user), &redis.ZRangeBy{
+		Min: "-inf", Max: upper, Count: int64(limit),
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to list conversations: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list conversations")
+		return
+	}
+	pipe := h.ws.rdb.Pipeline()
+	metas := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		metas[i] = pipe.HGetAll(ctx, transcriptMetaPrefix+id)
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Failed to load conversations: %v", err)
+			httperr.Write(w, r, http.StatusInternalServerError, "failed to list conversations")
+			return
+		}
+	}
+
+	conversations := make([]Conversation, 0, len(ids))
+	for i, id := range ids {
+		m := metas[i].Val()
+		if len(m) == 0 {
+			continue
+		}
+		conversations = append(conversations, conversationFrom(id, m))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"conversations": conversations})
+}
+
+// Get serves GET /v1/conversations/{id} with the conversation's messages.
+// Conversations of other users are reported as not found.
+func (h *ConversationsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.signedIn(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	id := r.PathValue("id")
+	m, err := h.ws.rdb.HGetAll(ctx, transcriptMetaPrefix+id).Result()
+	if err != nil {
+		log.Printf("Failed to load conversation %s: %v", id, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load conversation")
+		return
+	}
+	if m["user_id"] != webUserID(user) {
+		httperr.Write(w, r, http.StatusNotFound, "conversation not found")
+		return
+	}
+	raw, err := h.ws.rdb.LRange(ctx, transcriptPrefix+id, 0, -1).Result()
+	if err != nil {
+		log.Printf("Failed to load conversation %s: %v", id, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load conversation")
+		return
+	}
+	turns := make([]ConversationTurn, 0, len(raw))
+	for _, data := range raw {
+		var t ConversationTurn
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			log.Printf("Failed to unmarshal turn of conversation %s: %v", id, err)
+			continue
+		}
+		turns = append(turns, t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversation": conversationFrom(id, m),
+		"messages":     turns,
+	})
+}
+
+// Preflight answers CORS preflight requests, which the Authorization
+// header triggers.
+func (h *ConversationsHandler) Preflight(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signedIn returns the user making the request; guests have no history.
+func (h *ConversationsHandler) signedIn(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return "", false
+	}
+	user, ok := h.ws.authenticate(w, r)
+	if !ok {
+		return "", false
+	}
+	if user == "" {
+		httperr.Write(w, r, http.StatusUnauthorized, "sign in to see past conversations")
+		return "", false
+	}
+	return user, true
+}
+
+// conversationFrom reads a conversation's summary hash.
+func conversationFrom(id string, m map[string]string) Conversation {
+	turns, _ := strconv.Atoi(m["turns"])
+	startedAt, _ := strconv.ParseInt(m["started_at"], 10, 64)
+	lastActive, _ := strconv.ParseInt(m["last_active"], 10, 64)
+	return Conversation{
+		SessionID:  id,
+		Title:      m["title"],
+		Channel:    m["channel"],
+		Turns:      turns,
+		StartedAt:  time.Unix(startedAt, 0).UTC(),
+		LastActive: time.Unix(lastActive, 0).UTC(),
+	}
+}
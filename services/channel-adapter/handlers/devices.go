@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// A session may be open on several tabs or devices at once. Each connection
+// subscribes to the session's responses, so pub/sub fans every frame out to
+// all of them; what one of them sends is echoed to the others.
+
+var echoesTotal = metrics.NewCounterVec("channel_adapter_user_message_echoes_total",
+	"User messages echoed to a session's other connections, by whether any were open.", "outcome")
+
+// connections counts the connections subscribed to the session's responses,
+// on any replica.
+func (h *WSHandler) connections(ctx context.Context, sessionID string) (int64, error) {
+	channel := "response:" + sessionID
+	counts, err := h.rdb.PubSubNumSub(ctx, channel).Result()
+	if err != nil {
+		return 0, err
+	}
+	return counts[channel], nil
+}
+
+// echo shows a message the user sent from one connection on the session's
+// other connections as a user_message frame, so every view of the
+// conversation stays in sync. The sending connection skips it by its
+// connection ID. Echoes are not buffered for replay; a device that was
+// offline finds the message in the conversation's history.
+func (h *WSHandler) echo(ctx context.Context, envelope models.MessageEnvelope, text, connID string) {
+	var data json.RawMessage
+	if len(envelope.Attachments) > 0 {
+		data, _ = json.Marshal(map[string]interface{}{"attachments": envelope.Attachments})
+	}
+	payload, err := json.Marshal(models.WSResponse{
+		ID:         envelope.MessageID,
+		Type:       "user_message",
+		Text:       text,
+		SessionID:  envelope.SessionID,
+		Data:       data,
+		Connection: connID,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal echo: %v", err)
+		return
+	}
+	n, err := h.rdb.Publish(ctx, "response:"+envelope.SessionID, string(payload)).Result()
+	if err != nil {
+		log.Printf("Failed to echo message %s: %v", envelope.MessageID, err)
+		return
+	}
+	// The sender's own connection is one of the subscribers
+	if n > 1 {
+		echoesTotal.Inc("echoed")
+	} else {
+		echoesTotal.Inc("alone")
+	}
+}
+
+// ownEcho reports whether resp is the echo of a message this connection
+// sent.
+func ownEcho(resp models.WSResponse, connID string) bool {
+	return resp.Type == "user_message" && resp.Connection != "" && resp.Connection == connID
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/discord"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+)
+
+const (
+	discordClaimPrefix = "discord:claim:"
+	discordClaimTTL    = time.Hour
+)
+
+// DiscordHandler publishes messages from the Discord gateway on msg:inbound
+// and posts replies back to the originating channel or DM.
+type DiscordHandler struct {
+	rdb     *redis.Client
+	client  *discord.Client
+	gateway *discord.Gateway
+}
+
+func NewDiscordHandler(rdb *redis.Client, client *discord.Client, token string) *DiscordHandler {
+	h := &DiscordHandler{rdb: rdb, client: client}
+	h.gateway = discord.NewGateway(client, token, h.handleMessage)
+	return h
+}
+
+// Run holds the gateway connection until ctx is done.
+func (h *DiscordHandler) Run(ctx context.Context) {
+	h.gateway.Run(ctx)
+}
+
+// Receive connects to the gateway.
+func (h *DiscordHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	go h.Run(ctx)
+	return nil
+}
+
+// Normalize takes a MESSAGE_CREATE event's message object.
+func (h *DiscordHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	var msg discord.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if envelope, ok := adapters.NormalizeDiscordMessage(msg, h.gateway.UserID()); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *DiscordHandler) handleMessage(ctx context.Context, msg discord.Message) {
+	envelope, ok := adapters.NormalizeDiscordMessage(msg, h.gateway.UserID())
+	if !ok {
+		return
+	}
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to marshal envelope: %v", err)
+		return
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish Discord message %s: %v", msg.ID, err)
+		h.client.SendMessage(ctx, msg.ChannelID, "Sorry, I'm having trouble processing your message. Please try again.")
+	}
+}
+
+// Deliver forwards orchestrator responses for Discord sessions to the REST
+// API until ctx is done.
+func (h *DiscordHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.DiscordSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		target, ok := adapters.DiscordTargetFromSession(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		if !sends.push(msg.Channel, func() { h.send(ctx, target, resp) }) {
+			log.Printf("Discord send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *DiscordHandler) send(ctx context.Context, target adapters.DiscordTarget, resp models.WSResponse) {
+	switch resp.Type {
+	case "typing":
+		if err := h.client.TriggerTyping(ctx, target.ChannelID); err != nil {
+			log.Printf("Discord typing failed for channel %s: %v", target.ChannelID, err)
+		}
+		return
+	case "message", "notice", "error", "terminated":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, discordClaimPrefix+resp.ID, 1, discordClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	// In a shared channel, address the user who asked
+	text := adapters.PlainText(resp)
+	var mentions []string
+	if !target.DM() {
+		text = "<@" + target.UserID + "> " + text
+		mentions = []string{target.UserID}
+	}
+	err := h.client.SendMessage(ctx, target.ChannelID, text, mentions...)
+	if err == nil {
+		if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "discord", 0, ""); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+
+	log.Printf("Discord send failed for channel %s: %v", target.ChannelID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, discordClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var apiErr *discord.APIError
+	if errors.As(err, &apiErr) {
+		code, desc = apiErr.Code, apiErr.Description
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "discord", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
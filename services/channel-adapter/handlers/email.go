@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/email"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+)
+
+const (
+	// Every Message-ID in a thread, ours and the user's, maps to its session
+	emailThreadPrefix  = "email:thread:"
+	emailSessionPrefix = "email:session:"
+	emailThreadTTL     = 30 * 24 * time.Hour
+	emailClaimPrefix   = "email:claim:"
+	emailClaimTTL      = time.Hour
+	emailFetchLimit    = 50
+	maxReferences      = 20
+)
+
+// EmailHandler polls an IMAP inbox, threading messages into sessions by
+// their References and In-Reply-To headers, and answers over SMTP.
+type EmailHandler struct {
+	rdb      *redis.Client
+	mailbox  *email.Mailbox
+	sender   *email.Sender
+	interval time.Duration
+}
+
+func NewEmailHandler(rdb *redis.Client, mailbox *email.Mailbox, sender *email.Sender, interval time.Duration) *EmailHandler {
+	return &EmailHandler{rdb: rdb, mailbox: mailbox, sender: sender, interval: interval}
+}
+
+// Poll checks the inbox every interval until ctx is done. Messages are
+// marked read only after they are published, so a failed poll retries them.
+func (h *EmailHandler) Poll(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		if err := h.pollOnce(ctx); err != nil {
+			log.Printf("Email poll failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *EmailHandler) pollOnce(ctx context.Context) error {
+	fetched, err := h.mailbox.FetchUnseen(ctx, emailFetchLimit)
+	if err != nil {
+		return err
+	}
+	var done []uint32
+	for _, f := range fetched {
+		msg, err := email.Parse(f.Raw)
+		if err != nil {
+			log.Printf("Skipping unparseable email %d: %v", f.UID, err)
+			done = append(done, f.UID)
+			continue
+		}
+		if err := h.handle(ctx, msg); err != nil {
+			log.Printf("Failed to publish email %s: %v", msg.MessageID, err)
+			break
+		}
+		done = append(done, f.UID)
+	}
+	return h.mailbox.MarkSeen(ctx, done)
+}
+
+// Receive polls the inbox.
+func (h *EmailHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	go h.Poll(ctx)
+	return nil
+}
+
+// Normalize takes a raw RFC 5322 message. Replies are threaded into their
+// existing session as when polling.
+func (h *EmailHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	msg, err := email.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	if envelope, ok := h.normalize(ctx, msg); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *EmailHandler) normalize(ctx context.Context, msg *email.Message) (models.MessageEnvelope, bool) {
+	sessionID := h.threadSession(ctx, msg)
+	if sessionID == "" {
+		sessionID = adapters.NewEmailSessionID()
+	}
+	return adapters.NormalizeEmailMessage(msg, sessionID)
+}
+
+func (h *EmailHandler) handle(ctx context.Context, msg *email.Message) error {
+	envelope, ok := h.normalize(ctx, msg)
+	if !ok {
+		return nil
+	}
+	sessionID := envelope.SessionID
+
+	refs := msg.References
+	if msg.MessageID != "" {
+		refs = append(refs, msg.MessageID)
+	}
+	if len(refs) > maxReferences {
+		refs = refs[len(refs)-maxReferences:]
+	}
+	pipe := h.rdb.TxPipeline()
+	if msg.MessageID != "" {
+		pipe.Set(ctx, emailThreadPrefix+msg.MessageID, sessionID, emailThreadTTL)
+	}
+	key := emailSessionPrefix + sessionID
+	// A thread's recipient is whoever started it; see threadSession
+	pipe.HSetNX(ctx, key, "to", msg.From)
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"subject":     msg.Subject,
+		"in_reply_to": msg.MessageID,
+		"references":  strings.Join(refs, " "),
+		"quoted":      msg.Text,
+		"quoted_from": quotedFrom(msg),
+		"quoted_date": msg.Date.Format(time.RFC3339),
+	})
+	pipe.Expire(ctx, key, emailThreadTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err()
+}
+
+// threadSession finds the session of the thread msg replies to, checking
+// the most recent reference first. A Message-ID is no proof of who is
+// writing, as forwarded and CC'd mail carries it too, so a thread is only
+// continued by the address its replies go to; anyone else starts a new one.
+func (h *EmailHandler) threadSession(ctx context.Context, msg *email.Message) string {
+	ids := []string{msg.InReplyTo}
+	for i := len(msg.References) - 1; i >= 0; i-- {
+		ids = append(ids, msg.References[i])
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		sid, err := h.rdb.Get(ctx, emailThreadPrefix+id).Result()
+		if err != nil {
+			continue
+		}
+		to, err := h.rdb.HGet(ctx, emailSessionPrefix+sid, "to").Result()
+		if err == nil && msg.From != "" && strings.EqualFold(strings.TrimSpace(to), msg.From) {
+			return sid
+		}
+		log.Printf("Email from %s replies to a thread of another address; starting a new session", msg.From)
+		return ""
+	}
+	return ""
+}
+
+func quotedFrom(msg *email.Message) string {
+	if msg.FromName != "" {
+		return msg.FromName + " <" + msg.From + ">"
+	}
+	return msg.From
+}
+
+// Deliver sends orchestrator responses for email sessions until ctx is done.
+func (h *EmailHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.EmailSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		sessionID := strings.TrimPrefix(msg.Channel, "response:")
+		if !sends.push(sessionID, func() { h.send(ctx, sessionID, resp) }) {
+			log.Printf("Email send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *EmailHandler) send(ctx context.Context, sessionID string, resp models.WSResponse) {
+	switch resp.Type {
+	case "message", "notice", "error":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+	thread, err := h.rdb.HGetAll(ctx, emailSessionPrefix+sessionID).Result()
+	if err != nil || thread["to"] == "" {
+		log.Printf("No email thread for session %s", sessionID)
+		return
+	}
+
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, emailClaimPrefix+resp.ID, 1, emailClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	quotedDate, _ := time.Parse(time.RFC3339, thread["quoted_date"])
+	refs := strings.Fields(thread["references"])
+	messageID, err := h.sender.Send(ctx, email.Reply{
+		To:         thread["to"],
+		Subject:    thread["subject"],
+		InReplyTo:  thread["in_reply_to"],
+		References: refs,
+		Text:       adapters.PlainText(resp),
+		Quoted:     thread["quoted"],
+		QuotedFrom: thread["quoted_from"],
+		QuotedDate: quotedDate,
+	})
+	if err == nil {
+		// The user's reply will reference our Message-ID
+		refs = append(refs, messageID)
+		if len(refs) > maxReferences {
+			refs = refs[len(refs)-maxReferences:]
+		}
+		pipe := h.rdb.TxPipeline()
+		pipe.Set(ctx, emailThreadPrefix+messageID, sessionID, emailThreadTTL)
+		pipe.HSet(ctx, emailSessionPrefix+sessionID, "in_reply_to", messageID, "references", strings.Join(refs, " "))
+		pipe.Exec(ctx)
+		if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "email", 0, ""); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+
+	log.Printf("Email send failed for session %s: %v", sessionID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, emailClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		code, desc = smtpErr.Code, smtpErr.Msg
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "email", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
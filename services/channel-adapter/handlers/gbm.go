@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/gbm"
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+)
+
+const (
+	// Google retries webhooks that are not answered with 200, so message IDs
+	// are remembered for a day to drop duplicates
+	gbmSeenPrefix  = "gbm:seen:"
+	gbmSeenTTL     = 24 * time.Hour
+	gbmClaimPrefix = "gbm:claim:"
+	gbmClaimTTL    = time.Hour
+	maxGBMBody     = 1 << 20
+)
+
+// GBMHandler receives Google Business Messages webhooks, from Maps and
+// Search entry points, and publishes user messages on msg:inbound. Replies
+// carry quick replies from structured responses as suggestion chips.
+type GBMHandler struct {
+	rdb         *redis.Client
+	client      *gbm.Client
+	clientToken string
+}
+
+func NewGBMHandler(rdb *redis.Client, client *gbm.Client, clientToken string) *GBMHandler {
+	return &GBMHandler{rdb: rdb, client: client, clientToken: clientToken}
+}
+
+func (h *GBMHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGBMBody))
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	var ev gbm.Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid webhook")
+		return
+	}
+
+	// Webhook setup: echo the secret to prove we hold the client token
+	if ev.Secret != "" {
+		if subtle.ConstantTimeCompare([]byte(ev.ClientToken), []byte(h.clientToken)) != 1 {
+			httperr.Write(w, r, http.StatusUnauthorized, "invalid client token")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, ev.Secret)
+		return
+	}
+	if !gbm.VerifySignature(h.clientToken, body, r.Header.Get("X-Goog-Signature")) {
+		httperr.Write(w, r, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	ctx := r.Context()
+	if ev.Receipts != nil {
+		for _, rc := range ev.Receipts.Receipts {
+			h.report(ctx, rc)
+		}
+	}
+	if err := h.handleMessage(ctx, ev); err != nil {
+		log.Printf("Failed to accept Business Messages message: %v", err)
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to accept message", 5*time.Second)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Receive serves the webhook.
+func (h *GBMHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	mux.Handle("POST /gbm/webhook", h)
+	return nil
+}
+
+// Normalize takes one webhook body.
+func (h *GBMHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	var ev gbm.Event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, fmt.Errorf("invalid webhook: %w", err)
+	}
+	if envelope, ok := adapters.NormalizeGBMEvent(ev); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *GBMHandler) handleMessage(ctx context.Context, ev gbm.Event) error {
+	envelope, ok := adapters.NormalizeGBMEvent(ev)
+	if !ok {
+		return nil
+	}
+	seenKey := gbmSeenPrefix + ev.ConversationID + ":" + envelope.ExternalID
+	fresh, err := h.rdb.SetNX(ctx, seenKey, 1, gbmSeenTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return nil
+	}
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	err = h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err()
+	if err != nil {
+		// Let Google's retry through
+		h.rdb.Del(ctx, seenKey)
+		return err
+	}
+	return nil
+}
+
+// report passes a Google delivery receipt on to the orchestrator. Agent
+// messages are sent with the response ID, so the message name leads
+// straight back to it; later parts of a split answer are not reported
+// separately.
+func (h *GBMHandler) report(ctx context.Context, rc gbm.Receipt) {
+	if rc.ReceiptType != "DELIVERED" {
+		return
+	}
+	id := path.Base(rc.Message)
+	if id == "" || strings.Contains(id, "~") {
+		return
+	}
+	if err := receipts.Report(ctx, h.rdb, id, receipts.StatusDelivered, "gbm", 0, ""); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Deliver forwards orchestrator responses for Business Messages sessions
+// until ctx is done.
+func (h *GBMHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.GBMSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		conversation, ok := adapters.GBMConversation(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		if !sends.push(msg.Channel, func() { h.send(ctx, conversation, resp) }) {
+			log.Printf("Business Messages send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *GBMHandler) send(ctx context.Context, conversation string, resp models.WSResponse) {
+	switch resp.Type {
+	case "typing":
+		if err := h.client.Typing(ctx, conversation); err != nil {
+			log.Printf("Business Messages typing indicator failed: %v", err)
+		}
+		return
+	case "message", "notice", "error", "terminated":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+	messageID := resp.ID
+	if messageID != "" {
+		claimed, err := h.rdb.SetNX(ctx, gbmClaimPrefix+resp.ID, 1, gbmClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	} else {
+		messageID = uuid.New().String()
+	}
+
+	err := h.client.SendText(ctx, conversation, messageID, adapters.WithLinks(resp.Text, adapters.Rich(resp)), adapters.GBMSuggestions(resp))
+	if err == nil {
+		// Delivery is confirmed later by a receipt
+		return
+	}
+	log.Printf("Business Messages send failed for response %s: %v", resp.ID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, gbmClaimPrefix+resp.ID)
+	}
+	code := 0
+	var apiErr *gbm.APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.Status
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "gbm", code, err.Error()); err != nil {
+		log.Printf("%v", err)
+	}
+}
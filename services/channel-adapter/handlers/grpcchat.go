@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/apikeys"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	chatv1 "channel-adapter/proto/chat/v1"
+	"channel-adapter/redisconn"
+)
+
+var grpcStreamsTotal = metrics.NewCounterVec("channel_adapter_grpc_streams_total",
+	"gRPC Chat streams by how they ended.", "outcome")
+
+// ChatService serves the gRPC ChatService of proto/chat/v1 for mobile and
+// native clients. It is /v1/chat as a stream: each message is published on
+// msg:inbound as a /v1/chat request would be, and every frame on the
+// session's response channel is forwarded as it arrives. It authenticates
+// like /v1/chat, with the stream scope for API keys.
+type ChatService struct {
+	chat *ChatHandler
+}
+
+func NewChatService(chat *ChatHandler) *ChatService {
+	return &ChatService{chat: chat}
+}
+
+func (s *ChatService) Chat(stream chatv1.ChatStream) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	key, err := s.chat.authenticate(ctx, stream.Header().Get("Authorization"), "stream")
+	if err != nil {
+		grpcStreamsTotal.Inc("unauthorized")
+		return authStatus(err)
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	open := first.Open
+	if open == nil {
+		return chatv1.Errorf(chatv1.InvalidArgument, "the first message must be open")
+	}
+	if open.TimeZone != "" && !adapters.ValidTimeZone(open.TimeZone) {
+		return chatv1.Errorf(chatv1.InvalidArgument, `time_zone must be an IANA zone such as "Asia/Kathmandu"`)
+	}
+	if open.SessionID != "" && !validSessionID(open.SessionID) {
+		return chatv1.Errorf(chatv1.InvalidArgument, "session_id must be at most %d letters, digits, '-', '_' or '.'", maxSessionID)
+	}
+	sessionID := open.SessionID
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	}
+	if ok, err := s.chat.claimAPISession(ctx, sessionID, key); err != nil {
+		log.Printf("Failed to check gRPC session %s: %v", sessionID, err)
+		grpcStreamsTotal.Inc("unavailable")
+		return chatv1.Errorf(chatv1.Unavailable, "failed to check session")
+	} else if !ok {
+		grpcStreamsTotal.Inc("forbidden")
+		return chatv1.Errorf(chatv1.PermissionDenied, "session belongs to another client")
+	}
+
+	pubsub := s.chat.rdb.Subscribe(ctx, fmt.Sprintf("response:%s", sessionID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("Failed to subscribe for gRPC session %s: %v", sessionID, err)
+		grpcStreamsTotal.Inc("unavailable")
+		return chatv1.Errorf(chatv1.Unavailable, "failed to reach message broker")
+	}
+	if err := stream.Send(&chatv1.ServerMessage{Type: "connected", SessionID: sessionID, Instance: InstanceID}); err != nil {
+		return err
+	}
+
+	// Only this goroutine sends; the receiving one hands its replies over
+	replies := make(chan models.WSResponse, 8)
+	received := make(chan error, 1)
+	go func() {
+		received <- s.receive(ctx, stream, sessionID, open.TimeZone, replies)
+	}()
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			grpcStreamsTotal.Inc("cancelled")
+			return ctx.Err()
+		case err := <-received:
+			if err != io.EOF {
+				grpcStreamsTotal.Inc("error")
+				return err
+			}
+			// The client has nothing more to send; answers still follow
+			// until it cancels
+			received = nil
+		case resp := <-replies:
+			if err := stream.Send(serverMessage(resp)); err != nil {
+				return err
+			}
+		case msg, ok := <-ch:
+			if !ok {
+				return chatv1.Errorf(chatv1.Unavailable, "subscription closed")
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			if err := stream.Send(serverMessage(resp)); err != nil {
+				return err
+			}
+			if resp.Type == "terminated" {
+				grpcStreamsTotal.Inc("terminated")
+				return nil
+			}
+		}
+	}
+}
+
+// receive publishes the client's messages until it closes its side, which
+// is reported as io.EOF. Messages that are refused get an error frame
+// through replies; the stream stays open. Each message counts against the
+// API key's rate limit, as a /v1/chat request does.
+func (s *ChatService) receive(ctx context.Context, stream chatv1.ChatStream, sessionID, timeZone string, replies chan<- models.WSResponse) error {
+	send := func(resp models.WSResponse) {
+		select {
+		case replies <- resp:
+		case <-ctx.Done():
+		}
+	}
+	reply := func(text string) {
+		send(models.WSResponse{Type: "error", Text: text, SessionID: sessionID})
+	}
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		var key *apikeys.Key
+		if in.Message != nil || in.Edit != nil {
+			var limited *apikeys.LimitError
+			key, err = s.chat.authenticate(ctx, stream.Header().Get("Authorization"), "stream")
+			if errors.As(err, &limited) {
+				send(models.WSResponse{Type: "rate_limited", Text: "You're sending messages too quickly. Please wait a moment and try again.", RetryAfterMS: limited.RetryAfter.Milliseconds()})
+				continue
+			}
+			if err != nil {
+				return authStatus(err)
+			}
+		}
+		switch {
+		case in.Open != nil:
+			reply("The stream is already open.")
+		case in.Feedback != nil:
+			rating := map[chatv1.Rating]string{chatv1.RatingUp: "up", chatv1.RatingDown: "down"}[in.Feedback.Rating]
+			publishFeedback(ctx, s.chat.rdb, sessionID, &models.WSFeedback{MessageID: in.Feedback.MessageID, Rating: rating})
+		case in.Edit != nil:
+			if in.Edit.MessageID == "" {
+				reply("An edit needs the message_id of the message to change.")
+				continue
+			}
+			envelope := s.envelope(sessionID, timeZone, key, in.Edit.Text)
+			envelope.Content.Type = "edit"
+			if in.Edit.Delete {
+				envelope.Content = models.MessageContent{Type: "delete"}
+			}
+			envelope.Edits = in.Edit.MessageID
+			if err := s.publish(ctx, envelope); err != nil {
+				return err
+			}
+		case in.Message != nil:
+			msg := in.Message
+			text := strings.TrimSpace(msg.Text)
+			switch {
+			case msg.Attachment != nil:
+				reply("Attachments are not supported over gRPC.")
+				continue
+			case text == "":
+				reply("Messages need text.")
+				continue
+			}
+			schema, err := checkSchema(msg.ResponseSchema)
+			var bad *ValidationError
+			if errors.As(err, &bad) {
+				reply(bad.Text)
+				continue
+			}
+			envelope := s.envelope(sessionID, timeZone, key, text)
+			envelope.ResponseSchema = schema
+			if pc := msg.PageContext; pc != nil {
+				envelope.PageContext = adapters.SanitizePageContext(&models.PageContext{URL: pc.URL, Title: pc.Title, SelectedText: pc.SelectedText})
+			}
+			if slashCommand(ctx, s.chat.rdb, &envelope) {
+				continue
+			}
+			if err := s.publish(ctx, envelope); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// envelope normalizes a message like a streamed /v1/chat request.
+func (s *ChatService) envelope(sessionID, timeZone string, key *apikeys.Key, text string) models.MessageEnvelope {
+	envelope := adapters.NormalizeAPIMessage(sessionID, "", text, "", s.chat.timeout)
+	envelope.Stream = true
+	envelope.TimeZone = timeZone
+	if key != nil {
+		envelope.Metadata.PlatformData["api_key_id"] = key.ID
+		envelope.Metadata.PlatformData["partner"] = key.Name
+	}
+	return envelope
+}
+
+func (s *ChatService) publish(ctx context.Context, envelope models.MessageEnvelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return chatv1.Errorf(chatv1.Internal, "failed to encode message")
+	}
+	if err := s.chat.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish gRPC message for session %s: %v", envelope.SessionID, err)
+		return chatv1.Errorf(chatv1.Unavailable, "failed to publish message")
+	}
+	return nil
+}
+
+// authStatus maps an authentication failure to its gRPC status.
+func authStatus(err error) error {
+	var limited *apikeys.LimitError
+	switch {
+	case errors.Is(err, apikeys.ErrInvalid):
+		return chatv1.Errorf(chatv1.Unauthenticated, "unauthorized")
+	case errors.Is(err, apikeys.ErrScope):
+		return chatv1.Errorf(chatv1.PermissionDenied, "%v", err)
+	case errors.As(err, &limited):
+		return chatv1.Errorf(chatv1.ResourceExhausted, "%v", err)
+	}
+	log.Printf("Failed to check API key: %v", err)
+	return chatv1.Errorf(chatv1.Unavailable, "failed to check API key")
+}
+
+// serverMessage converts a WebSocket frame to its protobuf form.
+func serverMessage(resp models.WSResponse) *chatv1.ServerMessage {
+	m := &chatv1.ServerMessage{
+		ID:           resp.ID,
+		Type:         resp.Type,
+		Text:         resp.Text,
+		SessionID:    resp.SessionID,
+		Data:         resp.Data,
+		Part:         int32(resp.Part),
+		Parts:        int32(resp.Parts),
+		Instance:     resp.Instance,
+		ResumeToken:  resp.ResumeToken,
+		Returning:    resp.Returning,
+		Connection:   resp.Connection,
+		Protocol:     int32(resp.Protocol),
+		SessionKey:   resp.SessionKey,
+		Seq:          resp.Seq,
+		Role:         resp.Role,
+		Agent:        resp.Agent,
+		Corrects:     resp.Corrects,
+		RetryAfterMS: resp.RetryAfterMS,
+	}
+	if resp.Rich != nil {
+		m.Rich, _ = json.Marshal(resp.Rich)
+	}
+	if h := resp.Reconnect; h != nil {
+		m.Reconnect = &chatv1.ReconnectHint{Instance: h.Instance, Query: h.Query, Cookie: h.Cookie, ValidForSeconds: int32(h.ValidForSeconds)}
+	}
+	return m
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"channel-adapter/metrics"
+)
+
+// CloseIdle is the close code for connections reaped for inactivity. The
+// widget should not reconnect until the user does something.
+const CloseIdle = 4000
+
+// Keepalive settings for WebSocket connections; main sets them from the
+// environment. A connection whose pongs stop for PongWait is dead and is
+// closed, freeing its pub/sub subscription. IdleTimeout closes connections
+// the user hasn't sent anything on for that long; 0 keeps them open.
+var (
+	PingInterval = 25 * time.Second
+	PongWait     = 60 * time.Second
+	WriteTimeout = 10 * time.Second
+	IdleTimeout  = 30 * time.Minute
+)
+
+var reapedTotal = metrics.NewCounterVec("channel_adapter_ws_reaped_total",
+	"WebSocket connections closed by the server, by reason.", "reason")
+
+// wsConn serializes writes to a connection, which gorilla/websocket does not
+// allow concurrently, and bounds each one by WriteTimeout so a stalled
+// client can't block the sender.
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+	// lastActive is when the client last sent a message, in Unix nanoseconds
+	lastActive atomic.Int64
+	// idleExempt connections are never closed for inactivity
+	idleExempt bool
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	c := &wsConn{Conn: conn}
+	c.touch()
+	// Any frame, pongs included, shows the client is still there
+	conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
+	return c
+}
+
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	return c.Conn.WriteJSON(v)
+}
+
+// ReadMessage also extends the read deadline and counts as user activity.
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	typ, data, err := c.Conn.ReadMessage()
+	if err == nil {
+		c.SetReadDeadline(time.Now().Add(PongWait))
+		c.touch()
+	}
+	return typ, data, err
+}
+
+func (c *wsConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// keepalive pings the client every PingInterval and closes the connection
+// once it has been idle for IdleTimeout, until ctx is done. Closing makes
+// the read loop return, which tears the connection down.
+func (c *wsConn) keepalive(ctx context.Context) {
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if IdleTimeout > 0 && !c.idleExempt && time.Since(time.Unix(0, c.lastActive.Load())) > IdleTimeout {
+			reapedTotal.Inc("idle")
+			c.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(CloseIdle, "idle timeout"),
+				time.Now().Add(WriteTimeout))
+			c.Close()
+			return
+		}
+		if err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteTimeout)); err != nil {
+			reapedTotal.Inc("ping_failed")
+			c.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"channel-adapter/adapters"
+	"channel-adapter/hostevents"
+	"channel-adapter/models"
+)
+
+// EnableHostEvents notifies the hosting site of conversation lifecycle
+// events, both by webhook and through the widget.
+func (h *WSHandler) EnableHostEvents(n *hostevents.Notifier) {
+	h.hosts = n
+}
+
+// hostEvent notifies the hosting site and returns the lifecycle frame the
+// widget forwards to the host page with postMessage.
+func (h *WSHandler) hostEvent(sessionID, event, reason string) (models.WSResponse, bool) {
+	signed, ok := h.hosts.Notify(hostevents.Event{Type: event, SessionID: sessionID, TenantID: adapters.Tenant, Reason: reason})
+	if !ok {
+		return models.WSResponse{}, false
+	}
+	data, err := json.Marshal(signed)
+	if err != nil {
+		return models.WSResponse{}, false
+	}
+	return models.WSResponse{Type: "lifecycle", SessionID: sessionID, Data: data}, true
+}
+
+// lifecycleFor maps a relayed frame to the lifecycle event it implies, if
+// any: handoff frames hand the conversation to a person and terminated
+// frames end it. Every connection of the session gets the frame, but the
+// webhook fires once.
+func (h *WSHandler) lifecycleFor(ctx context.Context, sessionID string, resp models.WSResponse) (models.WSResponse, bool) {
+	ev := hostevents.Event{SessionID: sessionID, TenantID: adapters.Tenant}
+	switch resp.Type {
+	case "handoff":
+		var data struct {
+			Reason string `json:"reason"`
+		}
+		json.Unmarshal(resp.Data, &data)
+		ev.Type, ev.Reason = hostevents.Handoff, data.Reason
+	case "terminated":
+		ev.Type, ev.Reason = hostevents.Ended, "terminated"
+	default:
+		return models.WSResponse{}, false
+	}
+	key := resp.ResumeToken
+	if key == "" {
+		key = resp.ID
+	}
+	signed, ok := h.hosts.NotifyOnce(ctx, ev, key)
+	if !ok {
+		return models.WSResponse{}, false
+	}
+	data, err := json.Marshal(signed)
+	if err != nil {
+		return models.WSResponse{}, false
+	}
+	return models.WSResponse{Type: "lifecycle", SessionID: sessionID, Data: data}, true
+}
+
+// hostDisconnected starts the idle timer after which the conversation counts
+// as ended, unless it already ended or the session is still open on another
+// tab or device. Call it once the connection has unsubscribed.
+func (h *WSHandler) hostDisconnected(sessionID string, ended bool) {
+	if ended || h.hosts == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if others, err := h.connections(ctx, sessionID); err == nil && others > 0 {
+		return
+	}
+	h.hosts.Disconnected(ctx, sessionID)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/irc"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+)
+
+const (
+	ircClaimPrefix = "irc:claim:"
+	ircClaimTTL    = time.Hour
+)
+
+// IRCHandler publishes messages addressed to the bot on msg:inbound and
+// replies where the user last spoke to it: in the channel, addressed by
+// nick, or by direct message.
+type IRCHandler struct {
+	rdb     *redis.Client
+	client  *irc.Client
+	network string
+
+	mu      sync.Mutex
+	targets map[string]ircTarget
+}
+
+// ircTarget is where a session last spoke to the bot. Channel is empty for
+// direct messages.
+type ircTarget struct {
+	channel string
+	nick    string
+}
+
+// NewIRCHandler connects to one network, named in session IDs so users on
+// different networks never share a conversation.
+func NewIRCHandler(rdb *redis.Client, network string, cfg irc.Config) *IRCHandler {
+	h := &IRCHandler{rdb: rdb, network: network, targets: make(map[string]ircTarget)}
+	h.client = irc.NewClient(cfg, h.handleMessage)
+	return h
+}
+
+// Run holds the IRC connection until ctx is done.
+func (h *IRCHandler) Run(ctx context.Context) {
+	h.client.Run(ctx)
+}
+
+// Receive connects to the network.
+func (h *IRCHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	go h.Run(ctx)
+	return nil
+}
+
+// Normalize takes one raw protocol line, e.g. ":nick!user@host PRIVMSG
+// #channel :text".
+func (h *IRCHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	msg, ok := irc.ParseMessage(strings.TrimRight(string(payload), "\r\n"), h.client.Nick())
+	if !ok {
+		return nil, nil
+	}
+	if envelope, ok := adapters.NormalizeIRCMessage(h.network, h.client.Nick(), msg); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *IRCHandler) handleMessage(ctx context.Context, msg irc.Message) {
+	envelope, ok := adapters.NormalizeIRCMessage(h.network, h.client.Nick(), msg)
+	if !ok {
+		return
+	}
+	t := ircTarget{nick: msg.Nick}
+	if !msg.Private() {
+		t.channel = msg.Target
+	}
+	h.mu.Lock()
+	h.targets[envelope.SessionID] = t
+	h.mu.Unlock()
+
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to marshal envelope: %v", err)
+		return
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish IRC message from %s: %v", msg.Nick, err)
+		h.client.Privmsg(ctx, msg.Nick, "Sorry, I'm having trouble processing your message. Please try again.")
+	}
+}
+
+// Deliver forwards orchestrator responses for IRC sessions until ctx is
+// done.
+func (h *IRCHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.IRCSessionPrefix+h.network+"-")
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		sessionID := strings.TrimPrefix(msg.Channel, "response:")
+		nick, ok := adapters.IRCNickFromSession(h.network, sessionID)
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		if !sends.push(msg.Channel, func() { h.send(ctx, sessionID, nick, resp) }) {
+			log.Printf("IRC send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *IRCHandler) send(ctx context.Context, sessionID, nick string, resp models.WSResponse) {
+	switch resp.Type {
+	case "message", "notice", "error", "terminated":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, ircClaimPrefix+resp.ID, 1, ircClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	h.mu.Lock()
+	last, ok := h.targets[sessionID]
+	h.mu.Unlock()
+	if ok {
+		nick = last.nick
+	}
+	target, text := nick, adapters.PlainText(resp)
+	if last.channel != "" {
+		target, text = last.channel, nick+": "+text
+	}
+	if err := h.client.Privmsg(ctx, target, text); err != nil {
+		log.Printf("IRC send to %s failed: %v", target, err)
+		if resp.ID != "" {
+			h.rdb.Del(ctx, ircClaimPrefix+resp.ID)
+		}
+		if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "irc", 0, err.Error()); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "irc", 0, ""); err != nil {
+		log.Printf("%v", err)
+	}
+}
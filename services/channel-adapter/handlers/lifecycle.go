@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+const (
+	lastSeenPrefix  = "ws:lastseen:"
+	lastInstPrefix  = "ws:instance:"
+	ReconnectWindow = 10 * time.Minute
+	// InstanceCookie and InstanceParam carry the preferred replica for
+	// sticky load balancing
+	InstanceCookie = "adapter_instance"
+	InstanceParam  = "instance"
+)
+
+// InstanceID identifies this adapter replica in connected frames and
+// reconnect hints. main sets it from INSTANCE_ID or the hostname.
+var InstanceID string
+
+var (
+	connectsTotal = metrics.NewCounterVec("channel_adapter_ws_connects_total",
+		"WebSocket connections accepted, by whether the client resumed a session.", "kind")
+	disconnectsTotal = metrics.NewCounterVec("channel_adapter_ws_disconnects_total",
+		"WebSocket disconnections by close code.", "code")
+	activeConnections = metrics.NewGaugeVec("channel_adapter_ws_active_connections",
+		"Currently open WebSocket connections.")
+	connectionDuration = metrics.NewHistogramVec("channel_adapter_ws_connection_duration_seconds",
+		"How long WebSocket connections stay open.",
+		[]float64{1, 5, 15, 60, 300, 900, 1800, 3600, 4 * 3600})
+	reconnectPlacement = metrics.NewCounterVec("channel_adapter_ws_reconnect_placement_total",
+		"Reconnects by whether they landed on the replica that last held the session.", "placement")
+	reconnectGap = metrics.NewHistogramVec("channel_adapter_ws_reconnect_gap_seconds",
+		"Time between a session's disconnect and its next reconnect.",
+		[]float64{0.5, 1, 2, 5, 10, 30, 60, 180, 600})
+)
+
+// trackConnect records a new connection. A session that disconnected within
+// ReconnectWindow counts as a reconnect, which is how flaky networks show up.
+func trackConnect(ctx context.Context, rdb *redis.Client, sessionID string, resumed bool) time.Time {
+	now := time.Now()
+	activeConnections.Add(1)
+
+	kind := "new"
+	if resumed {
+		kind = "resumed"
+		if last, err := rdb.Get(ctx, lastSeenPrefix+sessionID).Int64(); err == nil {
+			kind = "reconnect"
+			reconnectGap.Observe(now.Sub(time.UnixMilli(last)).Seconds())
+			placement := "other"
+			if prev, _ := rdb.Get(ctx, lastInstPrefix+sessionID).Result(); prev == InstanceID {
+				placement = "same"
+			}
+			reconnectPlacement.Inc(placement)
+		}
+	}
+	connectsTotal.Inc(kind)
+	return now
+}
+
+// trackDisconnect records why and when a connection closed.
+func trackDisconnect(rdb *redis.Client, sessionID string, connectedAt time.Time, err error) {
+	activeConnections.Add(-1)
+	connectionDuration.Observe(time.Since(connectedAt).Seconds())
+	disconnectsTotal.Inc(closeCode(err))
+
+	// The request context is already done; record last-seen independently
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pipe := rdb.Pipeline()
+	pipe.Set(ctx, lastSeenPrefix+sessionID, time.Now().UnixMilli(), ReconnectWindow)
+	pipe.Set(ctx, lastInstPrefix+sessionID, InstanceID, ReconnectWindow)
+	pipe.Exec(ctx)
+}
+
+// reconnectHint is sent with the connected frame so the session can return
+// to this replica within ReconnectWindow.
+func reconnectHint(sessionID string) *models.ReconnectHint {
+	q := url.Values{"session_id": {sessionID}, InstanceParam: {InstanceID}}
+	return &models.ReconnectHint{
+		Instance:        InstanceID,
+		Query:           q.Encode(),
+		Cookie:          InstanceCookie,
+		ValidForSeconds: int(ReconnectWindow.Seconds()),
+	}
+}
+
+// instanceHeader is sent on the handshake response. The cookie lets load
+// balancers with cookie-based stickiness route reconnects here.
+func instanceHeader(r *http.Request) http.Header {
+	cookie := &http.Cookie{
+		Name:     InstanceCookie,
+		Value:    InstanceID,
+		Path:     r.URL.Path,
+		MaxAge:   int(ReconnectWindow.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	h := http.Header{}
+	h.Set("X-Adapter-Instance", InstanceID)
+	h.Add("Set-Cookie", cookie.String())
+	return h
+}
+
+func closeCode(err error) string {
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		return strconv.Itoa(ce.Code)
+	}
+	if err == nil {
+		return "none"
+	}
+	return strconv.Itoa(websocket.CloseAbnormalClosure)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+const msgLimitPrefix = "ratelimit:session:"
+
+var messagesRejected = metrics.NewCounterVec("channel_adapter_messages_rate_limited_total",
+	"Web messages refused because the connection or session sent too many.", "scope")
+
+// sessionBucket is a token bucket shared by every connection of a session,
+// on any replica. It returns how many milliseconds to wait, 0 when a token
+// was taken.
+var sessionBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return wait
+`)
+
+// RateLimitError is returned for a message over the connection's or
+// session's allowance.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+// EnableMessageLimit lets each WebSocket connection, and each session across
+// all its connections, send perMinute messages with bursts of up to burst.
+// Web messages of every kind count, SSE posts included.
+func (h *WSHandler) EnableMessageLimit(perMinute, burst int) {
+	h.msgRate, h.msgBurst = perMinute, max(burst, 1)
+}
+
+// bucket is a connection's token bucket. It is only used by the
+// connection's read loop.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (h *WSHandler) newBucket() *bucket {
+	return &bucket{tokens: float64(h.msgBurst), last: time.Now()}
+}
+
+// take returns how long to wait before a message is allowed, 0 if it is.
+func (b *bucket) take(perMinute, burst int) time.Duration {
+	now := time.Now()
+	perSec := float64(perMinute) / 60
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*perSec)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / perSec * float64(time.Second))
+}
+
+// allowConnMessage checks a WebSocket connection's own allowance.
+func (h *WSHandler) allowConnMessage(b *bucket) error {
+	if h.msgRate <= 0 {
+		return nil
+	}
+	if wait := b.take(h.msgRate, h.msgBurst); wait > 0 {
+		messagesRejected.Inc("connection")
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// allowSessionMessage checks the session's allowance. Redis trouble lets
+// the message through.
+func (h *WSHandler) allowSessionMessage(ctx context.Context, sessionID string) error {
+	if h.msgRate <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	perMS := float64(h.msgRate) / 60000
+	wait, err := sessionBucket.Run(ctx, h.rdb, []string{msgLimitPrefix + sessionID},
+		perMS, h.msgBurst, time.Now().UnixMilli()).Int64()
+	if err != nil {
+		log.Printf("Failed to check message rate for session %s: %v", sessionID, err)
+		return nil
+	}
+	if wait > 0 {
+		messagesRejected.Inc("session")
+		return &RateLimitError{RetryAfter: time.Duration(wait) * time.Millisecond}
+	}
+	return nil
+}
+
+// rateLimitedFrame tells the client to slow down.
+func rateLimitedFrame(e *RateLimitError) models.WSResponse {
+	return models.WSResponse{
+		Type:         "rate_limited",
+		Text:         "You're sending messages too quickly. Please wait a moment and try again.",
+		RetryAfterMS: max(e.RetryAfter.Milliseconds(), 1),
+	}
+}
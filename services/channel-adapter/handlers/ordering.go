@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// Frames kept for replay carry a resume token and a sequence number, both
+// assigned by the orchestrator when it buffers them, before it publishes
+// them. Publishers racing on a session can still publish out of order, so
+// each connection writes buffered frames strictly in sequence: a frame that
+// arrives ahead of earlier ones is sent after them, read from the buffer,
+// and the late copies are skipped.
+
+var orderedTotal = metrics.NewCounterVec("channel_adapter_frames_reordered_total",
+	"Live frames that arrived out of sequence, by whether earlier frames were sent first from the buffer or the frame was a late duplicate.", "outcome")
+
+// frameOrder is where a connection is in its session's sequence.
+type frameOrder struct {
+	// cursor is the resume token of the latest buffered frame sent
+	cursor string
+	// seq is that frame's sequence number; 0 until one has been seen
+	seq int64
+}
+
+// sent records that resp was written to the connection.
+func (o *frameOrder) sent(resp models.WSResponse) {
+	if resp.ResumeToken != "" && streamIDAfter(resp.ResumeToken, o.cursor) {
+		o.cursor, o.seq = resp.ResumeToken, resp.Seq
+	}
+}
+
+// inOrder returns what to write for a live frame, oldest first: nothing if
+// it was sent already, otherwise any buffered frames before it that haven't
+// been, then the frame. Frames without a token aren't sequenced.
+func (h *WSHandler) inOrder(ctx context.Context, sessionID string, o *frameOrder, resp models.WSResponse) []models.WSResponse {
+	if resp.ResumeToken == "" {
+		return []models.WSResponse{resp}
+	}
+	if !streamIDAfter(resp.ResumeToken, o.cursor) {
+		orderedTotal.Inc("late")
+		return nil
+	}
+	var frames []models.WSResponse
+	if resp.Seq > 1 && resp.Seq != o.seq+1 {
+		frames = h.bufferedBetween(ctx, sessionID, o.cursor, resp.ResumeToken)
+		if len(frames) > 0 {
+			orderedTotal.Inc("reordered")
+		}
+	}
+	return append(frames, resp)
+}
+
+// bufferedBetween returns the buffered frames after token from and before
+// token to.
+func (h *WSHandler) bufferedBetween(ctx context.Context, sessionID, from, to string) []models.WSResponse {
+	entries, err := h.rdb.XRangeN(ctx, replayPrefix+sessionID, "("+from, "("+to, maxReplayed).Result()
+	if err != nil {
+		log.Printf("Failed to read replay buffer of session %s: %v", sessionID, err)
+		return nil
+	}
+	return bufferedFrames(entries)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"channel-adapter/metrics"
+)
+
+var originsRejectedTotal = metrics.NewCounterVec("channel_adapter_origins_rejected_total",
+	"WebSocket and SSE requests refused by the origin allowlist, by whether they had an Origin header.", "reason")
+
+// OriginAllowlist decides which browser origins may open WebSocket and SSE
+// connections. Entries are exact origins ("https://mandalafoods.co"),
+// wildcard subdomains ("https://*.mandalafoods.co", or "*.mandalafoods.co"
+// for any scheme), or regular expressions prefixed "re:", which must match
+// the whole origin.
+type OriginAllowlist struct {
+	exact    map[string]bool
+	wildcard []wildcardOrigin
+	patterns []*regexp.Regexp
+	// strict refuses requests without an Origin header, which are otherwise
+	// taken to come from non-browser clients
+	strict bool
+}
+
+// wildcardOrigin matches hosts under suffix, such as "shop.mandalafoods.co"
+// under ".mandalafoods.co". An empty scheme matches any.
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+// NewOriginAllowlist parses ALLOWED_ORIGINS entries. With no entries every
+// origin is allowed; strict still refuses requests without one.
+func NewOriginAllowlist(entries []string, strict bool) (*OriginAllowlist, error) {
+	a := &OriginAllowlist{exact: make(map[string]bool), strict: strict}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+		case strings.HasPrefix(e, "re:"):
+			re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(e, "re:") + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin pattern %q: %w", e, err)
+			}
+			a.patterns = append(a.patterns, re)
+		case strings.Contains(e, "*"):
+			scheme, host, found := strings.Cut(e, "://")
+			if !found {
+				scheme, host = "", e
+			}
+			if !strings.HasPrefix(host, "*.") || strings.Contains(host[2:], "*") || len(host) < 3 {
+				return nil, fmt.Errorf("invalid origin %q: a wildcard must be the leftmost label, as in *.example.com", e)
+			}
+			a.wildcard = append(a.wildcard, wildcardOrigin{scheme: strings.ToLower(scheme), suffix: strings.ToLower(host[1:])})
+		default:
+			a.exact[strings.ToLower(strings.TrimSuffix(e, "/"))] = true
+		}
+	}
+	return a, nil
+}
+
+// Allow reports whether a request with the Origin header origin may connect.
+func (a *OriginAllowlist) Allow(origin string) bool {
+	if origin == "" {
+		if a.strict {
+			originsRejectedTotal.Inc("missing")
+			return false
+		}
+		return true // allow non-browser clients
+	}
+	if a.matches(origin) {
+		return true
+	}
+	originsRejectedTotal.Inc("not_allowed")
+	return false
+}
+
+func (a *OriginAllowlist) matches(origin string) bool {
+	if len(a.exact) == 0 && len(a.wildcard) == 0 && len(a.patterns) == 0 {
+		return true
+	}
+	if a.exact[strings.ToLower(origin)] {
+		return true
+	}
+	for _, re := range a.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	if len(a.wildcard) == 0 {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	// The port is part of the host, so *.example.com doesn't match
+	// https://shop.example.com:8443
+	host := strings.ToLower(u.Host)
+	for _, w := range a.wildcard {
+		if (w.scheme == "" || w.scheme == strings.ToLower(u.Scheme)) && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The presence registry lists the web connections open on every replica,
+// for the orchestrator's admin API to tell who is online; keep the field
+// layout in sync with orchestrator/presence. A connection's entry expires
+// unless its replica refreshes it, so a replica that dies takes its
+// connections offline within presenceTTL.
+const (
+	presenceConnPrefix    = "presence:conn:"
+	presenceSessionPrefix = "presence:session:"
+	presenceOnline        = "presence:online"
+	presenceTTL           = 90 * time.Second
+)
+
+// presenceRefresh is how often an open connection's entry is refreshed.
+var presenceRefresh = 30 * time.Second
+
+// online registers a connection of the session until ctx is done. transport
+// is "websocket" or "sse"; user is the envelope user ID.
+func (h *WSHandler) online(ctx context.Context, sessionID, connID, transport, user string, connectedAt time.Time) {
+	h.refreshPresence(ctx, sessionID, connID, map[string]interface{}{
+		"session_id":   sessionID,
+		"instance":     InstanceID,
+		"transport":    transport,
+		"user_id":      user,
+		"connected_at": connectedAt.UnixMilli(),
+	})
+	go func() {
+		ticker := time.NewTicker(presenceRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				h.offline(sessionID, connID)
+				return
+			case <-ticker.C:
+				h.refreshPresence(ctx, sessionID, connID, nil)
+			}
+		}
+	}()
+}
+
+func (h *WSHandler) refreshPresence(ctx context.Context, sessionID, connID string, fields map[string]interface{}) {
+	now := time.Now()
+	key := presenceConnPrefix + connID
+	pipe := h.rdb.TxPipeline()
+	if fields != nil {
+		pipe.HSet(ctx, key, fields)
+	}
+	pipe.HSet(ctx, key, "seen", now.UnixMilli())
+	pipe.Expire(ctx, key, presenceTTL)
+	pipe.SAdd(ctx, presenceSessionPrefix+sessionID, connID)
+	pipe.Expire(ctx, presenceSessionPrefix+sessionID, presenceTTL)
+	pipe.ZAdd(ctx, presenceOnline, redis.Z{Score: float64(now.UnixMilli()), Member: sessionID})
+	if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to record presence of session %s: %v", sessionID, err)
+	}
+}
+
+// offline removes a closed connection; the session stays listed until
+// readers find it has no connections left.
+func (h *WSHandler) offline(sessionID, connID string) {
+	// The connection's context is already done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pipe := h.rdb.TxPipeline()
+	pipe.Del(ctx, presenceConnPrefix+connID)
+	pipe.SRem(ctx, presenceSessionPrefix+sessionID, connID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to clear presence of session %s: %v", sessionID, err)
+	}
+}
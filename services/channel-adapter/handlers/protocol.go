@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"channel-adapter/metrics"
+)
+
+// ProtocolVersion is the newest web protocol version this adapter speaks.
+// It goes up when a frame or client message changes shape in a way older
+// clients can't ignore; new fields and frame types don't bump it. Frames
+// for connections on an older version still supported must be converted to
+// the shape that version expects before they are written.
+const ProtocolVersion = 1
+
+// subprotocolPrefix names versions in Sec-WebSocket-Protocol, e.g. "maya.v1".
+const subprotocolPrefix = "maya.v"
+
+// MinProtocol is the oldest version accepted; main sets it from
+// WS_MIN_PROTOCOL. Clients that don't name a version count as version 0 and
+// are served version 1, the protocol as it was before negotiation; setting
+// MinProtocol to 1 refuses them.
+var MinProtocol = 0
+
+var protocolsTotal = metrics.NewCounterVec("channel_adapter_protocol_versions_total",
+	"Web connections by the protocol version the client asked for (0 when it named none).", "version")
+
+// ProtocolError refuses a connection whose client only speaks versions this
+// adapter doesn't support.
+type ProtocolError struct {
+	Asked string
+}
+
+func (e *ProtocolError) Error() string {
+	speaks := fmt.Sprintf("%s%d", subprotocolPrefix, ProtocolVersion)
+	if oldest := max(MinProtocol, 1); oldest < ProtocolVersion {
+		speaks = fmt.Sprintf("%s%d to %s", subprotocolPrefix, oldest, speaks)
+	}
+	if e.Asked == "" {
+		return "a protocol version is required; this server speaks " + speaks
+	}
+	return fmt.Sprintf("unsupported protocol version %s; this server speaks %s", e.Asked, speaks)
+}
+
+// negotiateProtocol picks the newest supported version the client offered,
+// in Sec-WebSocket-Protocol or, for SSE and clients that can't set it, the
+// protocol query parameter. subprotocol is the header value to echo in the
+// handshake response, if the version came from the header. The returned
+// version is the one the connection is served, never 0.
+func negotiateProtocol(r *http.Request) (version int, subprotocol string, err error) {
+	asked := 0
+	var offered []string
+	for _, p := range websocket.Subprotocols(r) {
+		if v, ok := strings.CutPrefix(p, subprotocolPrefix); ok {
+			offered = append(offered, p)
+			if n, err := strconv.Atoi(v); err == nil && supportedProtocol(n) && n > asked {
+				asked, subprotocol = n, p
+			}
+		}
+	}
+	if len(offered) > 0 && asked == 0 {
+		return 0, "", &ProtocolError{Asked: strings.Join(offered, ", ")}
+	}
+	if q := r.URL.Query().Get("protocol"); q != "" && len(offered) == 0 {
+		n, err := strconv.Atoi(q)
+		if err != nil || !supportedProtocol(n) {
+			return 0, "", &ProtocolError{Asked: q}
+		}
+		asked = n
+	}
+	if asked == 0 && MinProtocol > 0 {
+		return 0, "", &ProtocolError{}
+	}
+	protocolsTotal.Inc(strconv.Itoa(asked))
+	return max(asked, 1), subprotocol, nil
+}
+
+func supportedProtocol(v int) bool {
+	return v >= max(MinProtocol, 1) && v <= ProtocolVersion
+}
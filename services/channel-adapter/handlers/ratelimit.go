@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+)
+
+const connectLimitPrefix = "ratelimit:connect:"
+
+var connectsRejected = metrics.NewCounterVec("channel_adapter_connects_rate_limited_total",
+	"WebSocket and SSE connections refused because the client IP opened too many.", "transport")
+
+// EnableConnectLimit caps how many WebSocket and SSE connections one client
+// IP may open per minute, counted across replicas.
+func (h *WSHandler) EnableConnectLimit(perMinute int) {
+	h.connectLimit = perMinute
+}
+
+// allowConnect counts the connection against its client IP and, over the
+// limit, answers 429. Redis trouble lets the connection through.
+func (h *WSHandler) allowConnect(w http.ResponseWriter, r *http.Request, transport string) bool {
+	if h.connectLimit <= 0 {
+		return true
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+	key := fmt.Sprintf("%s%s:%d", connectLimitPrefix, ip, window.Unix())
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+	pipe := h.rdb.TxPipeline()
+	n := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to count connection from %s: %v", ip, err)
+		return true
+	}
+	if n.Val() <= int64(h.connectLimit) {
+		return true
+	}
+	connectsRejected.Inc(transport)
+	if n.Val() == int64(h.connectLimit)+1 {
+		log.Printf("Client %s exceeded %d connections per minute", ip, h.connectLimit)
+	}
+	httperr.WriteRetry(w, r, http.StatusTooManyRequests, "too many connections", window.Add(time.Minute).Sub(now))
+	return false
+}
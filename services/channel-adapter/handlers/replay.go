@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// Written by the orchestrator's publisher, which appends every web frame
+// but typing indicators and deltas with its resume token as the entry ID;
+// keep the field layout in sync.
+const replayPrefix = "web:replay:"
+
+// maxReplayed bounds what one reconnect is sent; the buffer holds about as
+// many.
+const maxReplayed = 200
+
+var (
+	replayedTotal = metrics.NewCounterVec("channel_adapter_replayed_total",
+		"Buffered frames sent again to a web client that reconnected with a resume token.")
+	resumesTotal = metrics.NewCounterVec("channel_adapter_resumes_total",
+		"Reconnects with a resume token, by whether the buffer still reached back to it.", "outcome")
+)
+
+// resumeCursor is where a connection's replay starts: the client's resume
+// token, or the newest buffered frame so that frames published before the
+// subscription is up aren't lost. "0-0" replays the whole buffer.
+func (h *WSHandler) resumeCursor(ctx context.Context, sessionID, token string) string {
+	if token != "" {
+		if _, _, ok := parseStreamID(token); ok {
+			return token
+		}
+	}
+	latest, err := h.rdb.XRevRangeN(ctx, replayPrefix+sessionID, "+", "-", 1).Result()
+	if err != nil {
+		log.Printf("Failed to read replay buffer of session %s: %v", sessionID, err)
+	}
+	if len(latest) == 0 {
+		return "0-0"
+	}
+	return latest[0].ID
+}
+
+// resumeFrames returns what a connection must be sent before live frames,
+// oldest first: held frames of a resumed session that were sent before the
+// cursor and are still unacknowledged, then the buffered frames after it.
+// Call it once subscribed to the session's responses.
+func (h *WSHandler) resumeFrames(ctx context.Context, sessionID, cursor string, resumed, token bool) []models.WSResponse {
+	key := replayPrefix + sessionID
+	entries, err := h.rdb.XRangeN(ctx, key, "("+cursor, "+", maxReplayed).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to replay frames of session %s: %v", sessionID, err)
+	}
+	if token {
+		outcome := "complete"
+		if oldest, err := h.rdb.XRangeN(ctx, key, "-", "+", 1).Result(); err != nil || len(oldest) == 0 || streamIDAfter(oldest[0].ID, cursor) {
+			// Trimmed or expired past the token; held frames still cover answers
+			outcome = "partial"
+		}
+		resumesTotal.Inc(outcome)
+	}
+
+	replay := bufferedFrames(entries)
+	inReplay := make(map[string]bool)
+	for _, resp := range replay {
+		if resp.ID != "" {
+			inReplay[resp.ID] = true
+		}
+	}
+	if token {
+		replayedTotal.Add(float64(len(replay)))
+	}
+	if !resumed {
+		return replay
+	}
+	var frames []models.WSResponse
+	for _, resp := range h.unackedFrames(ctx, sessionID) {
+		if !inReplay[resp.ID] {
+			// Out of sequence; a client must not move its token or
+			// sequence number back to it
+			resp.ResumeToken, resp.Seq = "", 0
+			frames = append(frames, resp)
+		}
+	}
+	return append(frames, replay...)
+}
+
+// bufferedFrames decodes replay buffer entries, with their resume tokens
+// and sequence numbers.
+func bufferedFrames(entries []redis.XMessage) []models.WSResponse {
+	var frames []models.WSResponse
+	for _, e := range entries {
+		data, _ := e.Values["frame"].(string)
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(data), &resp); err != nil {
+			log.Printf("Failed to unmarshal buffered frame %s: %v", e.ID, err)
+			continue
+		}
+		resp.ResumeToken = e.ID
+		if seq, _ := e.Values["seq"].(string); seq != "" {
+			resp.Seq, _ = strconv.ParseInt(seq, 10, 64)
+		}
+		frames = append(frames, resp)
+	}
+	return frames
+}
+
+// parseStreamID splits a Redis stream ID such as "1718000000000-3".
+func parseStreamID(id string) (ms, seq uint64, ok bool) {
+	a, b, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err1 := strconv.ParseUint(a, 10, 64)
+	seq, err2 := strconv.ParseUint(b, 10, 64)
+	return ms, seq, err1 == nil && err2 == nil
+}
+
+// streamIDAfter reports whether stream ID a comes after b.
+func streamIDAfter(a, b string) bool {
+	am, as, _ := parseStreamID(a)
+	bm, bs, _ := parseStreamID(b)
+	return am > bm || am == bm && as > bs
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import "sync"
+
+// chatQueueSize bounds the sends waiting for one chat.
+const chatQueueSize = 100
+
+// sendQueue runs the sends for each chat one at a time, in the order they
+// were pushed, so that typing frames and the parts of a split answer reach
+// the platform in order. Different chats are sent in parallel, up to limit
+// at once when limit is above zero. A chat's goroutine exits once its queue
+// is empty.
+type sendQueue struct {
+	mu    sync.Mutex
+	chats map[string]chan func()
+	slots chan struct{}
+}
+
+func newSendQueue(limit int) *sendQueue {
+	q := &sendQueue{chats: make(map[string]chan func())}
+	if limit > 0 {
+		q.slots = make(chan struct{}, limit)
+	}
+	return q
+}
+
+// push queues send behind the earlier sends for chat. It reports false,
+// without queueing, when the chat already has chatQueueSize sends waiting.
+func (q *sendQueue) push(chat string, send func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending, ok := q.chats[chat]
+	if !ok {
+		pending = make(chan func(), chatQueueSize)
+		q.chats[chat] = pending
+		go q.run(chat, pending)
+	}
+	select {
+	case pending <- send:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *sendQueue) run(chat string, pending chan func()) {
+	for {
+		q.mu.Lock()
+		if len(pending) == 0 {
+			delete(q.chats, chat)
+			q.mu.Unlock()
+			return
+		}
+		send := <-pending
+		q.mu.Unlock()
+
+		if q.slots != nil {
+			q.slots <- struct{}{}
+		}
+		send()
+		if q.slots != nil {
+			<-q.slots
+		}
+	}
+}
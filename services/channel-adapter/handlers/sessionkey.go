@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+)
+
+// A web session is bound to the client that started it by a random session
+// key, sent once on its connected frame, so knowing a session ID is not
+// enough to attach to the session and read its responses. Only a hash of
+// the key is kept.
+const (
+	sessionKeyPrefix = "web:session-key:"
+	// SessionCookie holds "{session_id}.{session_key}" for clients that
+	// can't keep the key themselves
+	SessionCookie = "maya_session"
+)
+
+var sessionKeysTotal = metrics.NewCounterVec("channel_adapter_session_keys_total",
+	"Session key checks on web connections and posts, by outcome.", "outcome")
+
+// validWebSessionID accepts the UUIDs web sessions are given, in their
+// canonical form.
+func validWebSessionID(id string) bool {
+	u, err := uuid.Parse(id)
+	return err == nil && u.String() == strings.ToLower(id)
+}
+
+// sessionKeyFrom returns the key the request presents for sessionID: the
+// session_key query parameter, the X-Session-Key header or the session
+// cookie.
+func sessionKeyFrom(r *http.Request, sessionID string) string {
+	if key := r.URL.Query().Get("session_key"); key != "" {
+		return key
+	}
+	if key := r.Header.Get("X-Session-Key"); key != "" {
+		return key
+	}
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if id, key, ok := strings.Cut(c.Value, "."); ok && id == sessionID {
+			return key
+		}
+	}
+	return ""
+}
+
+// issueSessionKey binds sessionID to a new key and returns it.
+func (h *WSHandler) issueSessionKey(ctx context.Context, sessionID string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	if err := h.rdb.Set(ctx, sessionKeyPrefix+sessionID, hashSessionKey(key), sessionOwnerTTL).Err(); err != nil {
+		return "", err
+	}
+	sessionKeysTotal.Inc("issued")
+	return key, nil
+}
+
+// checkSessionKey reports whether key is sessionID's, and whether the
+// session has a key at all.
+func (h *WSHandler) checkSessionKey(ctx context.Context, sessionID, key string) (ok, bound bool) {
+	stored, err := h.rdb.Get(ctx, sessionKeyPrefix+sessionID).Result()
+	if err == redis.Nil {
+		return false, false
+	}
+	if err != nil {
+		log.Printf("Failed to load key of session %s: %v", sessionID, err)
+		return false, true
+	}
+	if key == "" {
+		sessionKeysTotal.Inc("missing")
+		return false, true
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSessionKey(key)), []byte(stored)) != 1 {
+		sessionKeysTotal.Inc("wrong")
+		return false, true
+	}
+	sessionKeysTotal.Inc("verified")
+	// Kept for as long as the session is in use
+	h.rdb.Expire(ctx, sessionKeyPrefix+sessionID, sessionOwnerTTL)
+	return true, true
+}
+
+// hasHistory reports whether an unbound session already holds a
+// conversation, from before sessions had keys. Nobody can prove it is
+// theirs, so it can't be resumed as a guest.
+func (h *WSHandler) hasHistory(ctx context.Context, sessionID string) bool {
+	n, err := h.rdb.Exists(ctx, transcriptMetaPrefix+sessionID, replayPrefix+sessionID).Result()
+	return err != nil || n > 0
+}
+
+// sessionCookie carries the key for the browser; it is sent cross-site,
+// since the widget is served from the host site's pages.
+func sessionCookie(sessionID, key string) *http.Cookie {
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    sessionID + "." + key,
+		Path:     "/",
+		MaxAge:   int(sessionOwnerTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	}
+}
+
+func hashSessionKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
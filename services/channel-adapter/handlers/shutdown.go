@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ShutdownReason is the close reason WebSocket clients get when the adapter
+// stops, with code 1012 (service restart); the widget reconnects, landing on
+// another replica.
+const ShutdownReason = "server restarting"
+
+// track registers a web connection for Shutdown to wait on. It fails once
+// shutdown has begun, and the caller should refuse the connection.
+func (h *WSHandler) track() bool {
+	h.drainMu.RLock()
+	defer h.drainMu.RUnlock()
+	if h.draining {
+		return false
+	}
+	h.open.Add(1)
+	return true
+}
+
+// Shutdown closes every web connection and waits until each has finished
+// the message it was publishing and unsubscribed from its session's
+// responses, or ctx is done. New connections are refused from then on.
+// Messages posted over SSE are plain requests, drained when the HTTP server
+// shuts down afterwards.
+func (h *WSHandler) Shutdown(ctx context.Context) error {
+	h.drainMu.Lock()
+	if !h.draining {
+		h.draining = true
+		close(h.closing)
+	}
+	h.drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.open.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("web connections did not close in time: %w", ctx.Err())
+	}
+}
+
+// closeForShutdown sends the client the shutdown close frame. The read loop
+// returns on the client's reply, or after WriteTimeout without one, once
+// any message it is publishing is on the stream.
+func (c *wsConn) closeForShutdown() {
+	c.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseServiceRestart, ShutdownReason),
+		time.Now().Add(WriteTimeout))
+	c.SetReadDeadline(time.Now().Add(WriteTimeout))
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+	"channel-adapter/twilio"
+)
+
+const (
+	smsSeenPrefix  = "sms:seen:"
+	smsSeenTTL     = 24 * time.Hour
+	smsClaimPrefix = "sms:claim:"
+	smsClaimTTL    = time.Hour
+	// Status callbacks refer to Twilio message SIDs; this maps them back to
+	// the orchestrator's response ID for receipts
+	smsSentPrefix = "sms:sent:"
+	smsSentTTL    = 7 * 24 * time.Hour
+	maxSMSBody    = 64 << 10
+
+	emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+)
+
+var smsSegmentsTotal = metrics.NewCounterVec("channel_adapter_sms_segments_total",
+	"SMS segments sent, which is what Twilio bills.", "encoding")
+
+// SMSHandler receives Twilio SMS webhooks and status callbacks, and sends
+// replies through the Twilio REST API from a single number.
+type SMSHandler struct {
+	rdb           *redis.Client
+	client        *twilio.Client
+	from          string
+	publicURL     string
+	singleSegment bool
+	voice         *VoiceHandler
+}
+
+// NewSMSHandler needs the public base URL Twilio calls, since webhook
+// signatures cover the full URL. With singleSegment, replies are sent as
+// separate single-segment texts for carriers that don't reassemble
+// concatenated SMS; otherwise each text may be up to 1600 characters.
+func NewSMSHandler(rdb *redis.Client, client *twilio.Client, from, publicURL string, singleSegment bool) *SMSHandler {
+	return &SMSHandler{
+		rdb:           rdb,
+		client:        client,
+		from:          from,
+		publicURL:     strings.TrimRight(publicURL, "/"),
+		singleSegment: singleSegment,
+	}
+}
+
+// EnableVoice answers calls to the number as well, with vc.
+func (h *SMSHandler) EnableVoice(vc *VoiceHandler) {
+	h.voice = vc
+}
+
+// Receive serves the messaging webhook and status callback, and the voice
+// webhook and media stream if voice is enabled.
+func (h *SMSHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	mux.HandleFunc("POST /sms/inbound", h.Inbound)
+	mux.HandleFunc("POST /sms/status", h.Status)
+	if h.voice != nil {
+		mux.HandleFunc("POST /voice/inbound", h.voice.Inbound)
+		mux.HandleFunc("GET /voice/stream", h.voice.Stream)
+	}
+	return nil
+}
+
+// Normalize takes a messaging webhook's form-encoded body.
+func (h *SMSHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	form, err := url.ParseQuery(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form body: %w", err)
+	}
+	if envelope, ok := adapters.NormalizeSMSMessage(form.Get("From"), form.Get("Body"), form.Get("MessageSid")); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+// verified parses the form and checks X-Twilio-Signature.
+func (h *SMSHandler) verified(w http.ResponseWriter, r *http.Request) bool {
+	return verifyTwilio(w, r, h.client.AuthToken(), h.publicURL)
+}
+
+// verifyTwilio parses a Twilio webhook form and checks its signature, which
+// covers the public URL Twilio called.
+func verifyTwilio(w http.ResponseWriter, r *http.Request, authToken, publicURL string) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSMSBody)
+	if err := r.ParseForm(); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid form body")
+		return false
+	}
+	if !twilio.ValidateSignature(authToken, publicURL+r.URL.RequestURI(), r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+		httperr.Write(w, r, http.StatusUnauthorized, "invalid signature")
+		return false
+	}
+	return true
+}
+
+// Inbound is the messaging webhook for the Twilio number.
+func (h *SMSHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	if !h.verified(w, r) {
+		return
+	}
+	ctx := r.Context()
+	sid := r.PostForm.Get("MessageSid")
+	envelope, ok := adapters.NormalizeSMSMessage(r.PostForm.Get("From"), r.PostForm.Get("Body"), sid)
+	if ok {
+		fresh, err := h.rdb.SetNX(ctx, smsSeenPrefix+sid, 1, smsSeenTTL).Result()
+		if err == nil && fresh {
+			err = h.publish(ctx, envelope)
+			if err != nil {
+				// Let Twilio's retry through
+				h.rdb.Del(ctx, smsSeenPrefix+sid)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to accept SMS %s: %v", sid, err)
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to accept message", 5*time.Second)
+			return
+		}
+	}
+	// Replies are sent asynchronously through the REST API
+	w.Header().Set("Content-Type", "text/xml")
+	io.WriteString(w, emptyTwiML)
+}
+
+func (h *SMSHandler) publish(ctx context.Context, envelope models.MessageEnvelope) error {
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err()
+}
+
+// Status receives delivery status callbacks and reports them as receipts.
+func (h *SMSHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !h.verified(w, r) {
+		return
+	}
+	ctx := r.Context()
+	var status string
+	switch r.PostForm.Get("MessageStatus") {
+	case "delivered":
+		status = receipts.StatusDelivered
+	case "failed", "undelivered":
+		status = receipts.StatusFailed
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	id, err := h.rdb.Get(ctx, smsSentPrefix+r.PostForm.Get("MessageSid")).Result()
+	if err == nil {
+		code, _ := strconv.Atoi(r.PostForm.Get("ErrorCode"))
+		if err := receipts.Report(ctx, h.rdb, id, status, "twilio", code, r.PostForm.Get("MessageStatus")); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliver forwards orchestrator responses for SMS sessions to Twilio until
+// ctx is done.
+func (h *SMSHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.SMSSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		to, ok := adapters.SMSRecipient(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		if !sends.push(msg.Channel, func() { h.send(ctx, to, resp) }) {
+			log.Printf("SMS send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *SMSHandler) send(ctx context.Context, to string, resp models.WSResponse) {
+	// SMS has no typing indicator, and a dropped connection means nothing
+	switch resp.Type {
+	case "message", "notice", "error":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, smsClaimPrefix+resp.ID, 1, smsClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	text := adapters.SMSText(resp)
+	limit := twilio.MaxMessageLength
+	if h.singleSegment {
+		// The answer was fitted to one segment; the reply options only go
+		// along if they still fit
+		if twilio.Segments(text) > 1 {
+			text = resp.Text
+		}
+		limit = twilio.SegmentLimit(text)
+	}
+	encoding := twilio.Encoding(text)
+	var err error
+	for _, part := range twilio.Split(text, limit) {
+		var sid string
+		sid, err = h.client.SendSMS(ctx, h.from, to, part, h.publicURL+"/sms/status")
+		if err != nil {
+			break
+		}
+		smsSegmentsTotal.Add(float64(twilio.Segments(part)), encoding)
+		if resp.ID != "" {
+			h.rdb.Set(ctx, smsSentPrefix+sid, resp.ID, smsSentTTL)
+		}
+	}
+	if err == nil {
+		// Delivery is confirmed later by a status callback
+		return
+	}
+
+	log.Printf("SMS send failed for response %s: %v", resp.ID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, smsClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var apiErr *twilio.APIError
+	if errors.As(err, &apiErr) {
+		code, desc = apiErr.Code, apiErr.Message
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "twilio", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
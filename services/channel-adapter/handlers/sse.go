@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"channel-adapter/adapters"
+	"channel-adapter/attachments"
+	"channel-adapter/hostevents"
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+)
+
+const (
+	// Comment lines keep proxies from closing an idle stream
+	sseHeartbeat = 15 * time.Second
+	// The web widget retries after this long when the stream drops
+	sseRetryMS = 3000
+)
+
+var activeStreams = metrics.NewGaugeVec("channel_adapter_sse_active_streams",
+	"Currently open Server-Sent Events streams.")
+
+// SSEHandler is the web channel for clients behind proxies that block
+// WebSockets. Responses stream from GET /sse as events named after the frame
+// type, carrying the same JSON as WebSocket frames; messages are sent with
+// POST /sse/messages?session_id=… using the WebSocket message body.
+type SSEHandler struct {
+	ws *WSHandler
+}
+
+// NewSSEHandler shares ws's origin policy, geo lookup and attachment store.
+func NewSSEHandler(ws *WSHandler) *SSEHandler {
+	return &SSEHandler{ws: ws}
+}
+
+// Stream serves GET /sse. Without session_id a new session is started; the
+// first event is always connected, carrying the session ID to post with.
+func (h *SSEHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httperr.Write(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	if !h.ws.allowConnect(w, r, "sse") {
+		return
+	}
+	user, ok := h.ws.authenticate(w, r)
+	if !ok {
+		return
+	}
+	protocol, _, err := negotiateProtocol(r)
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session_id")
+	resumed := sessionID != ""
+	if !resumed {
+		sessionID = uuid.New().String()
+	} else if !validWebSessionID(sessionID) {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid session_id")
+		return
+	}
+	sessionKey, ok := h.ws.openSession(r.Context(), r, sessionID, user, resumed)
+	if !ok {
+		httperr.Write(w, r, http.StatusForbidden, "session belongs to another client")
+		return
+	}
+	if !h.ws.track() {
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "server is shutting down", time.Second)
+		return
+	}
+	defer h.ws.open.Done()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Subscribe before the connected event so nothing sent in between is lost
+	pubsub := h.ws.rdb.Subscribe(ctx, fmt.Sprintf("response:%s", sessionID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("Failed to subscribe for SSE session %s: %v", sessionID, err)
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to reach message broker", 5*time.Second)
+		return
+	}
+
+	for k, v := range instanceHeader(r) {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if sessionKey != "" {
+		http.SetCookie(w, sessionCookie(sessionID, sessionKey))
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMS)
+
+	activeStreams.Add(1)
+	defer activeStreams.Add(-1)
+	ended := false
+	defer func() {
+		// Unsubscribe first, so the session only counts its other connections
+		pubsub.Close()
+		h.ws.hostDisconnected(sessionID, ended)
+	}()
+	h.ws.hosts.Connected(ctx, sessionID)
+
+	var token string
+	if resumed {
+		token = r.URL.Query().Get("resume")
+	}
+	cursor := h.ws.resumeCursor(ctx, sessionID, token)
+	var returning bool
+	var welcome *models.WSResponse
+	if resumed {
+		returning, welcome = h.ws.returning(ctx, sessionID)
+	}
+	connID := uuid.New().String()
+	h.ws.online(ctx, sessionID, connID, "sse", webUserID(user), time.Now())
+	if err := writeEvent(w, models.WSResponse{
+		Type:        "connected",
+		SessionID:   sessionID,
+		Instance:    InstanceID,
+		Reconnect:   reconnectHint(sessionID),
+		Returning:   returning,
+		Connection:  connID,
+		Protocol:    protocol,
+		SessionKey:  sessionKey,
+		ResumeToken: cursor,
+	}); err != nil {
+		return
+	}
+	if welcome != nil {
+		writeEvent(w, *welcome)
+	}
+	if !resumed {
+		if frame, ok := h.ws.hostEvent(sessionID, hostevents.Started, ""); ok {
+			writeEvent(w, frame)
+		}
+	}
+	// As on the WebSocket, held and buffered frames go out first and acks
+	// are opt-in
+	explicitAcks := r.URL.Query().Get("acks") == "true"
+	redelivered := make(map[string]bool)
+	order := frameOrder{cursor: cursor}
+	for _, resp := range h.ws.resumeFrames(ctx, sessionID, cursor, resumed, token != "") {
+		if err := writeEvent(w, resp); err != nil {
+			return
+		}
+		order.sent(resp)
+		if held(resp) {
+			redeliveredTotal.Inc()
+			redelivered[resp.ID] = true
+			if !explicitAcks {
+				h.ws.acknowledge(ctx, sessionID, resp.ID, true)
+			}
+		}
+		if resp.Type == "terminated" {
+			ended = true
+			flusher.Flush()
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.ws.closing:
+			// EventSource reconnects after the retry interval
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			if ownEcho(resp, connID) {
+				continue
+			}
+			for _, resp := range h.ws.inOrder(ctx, sessionID, &order, resp) {
+				if redelivered[resp.ID] {
+					continue
+				}
+				if err := writeEvent(w, resp); err != nil {
+					log.Printf("Failed to write SSE event: %v", err)
+					return
+				}
+				order.sent(resp)
+				if held(resp) && !explicitAcks {
+					h.ws.acknowledge(ctx, sessionID, resp.ID, false)
+				}
+				if frame, ok := h.ws.lifecycleFor(ctx, sessionID, resp); ok {
+					writeEvent(w, frame)
+				}
+				if resp.Type == "terminated" {
+					ended = true
+					flusher.Flush()
+					return
+				}
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// Submit serves POST /sse/messages. The body is a WebSocket message: text,
+// attachment, page context, feedback, an ack or a typing indicator.
+func (h *SSEHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	sessionID := r.URL.Query().Get("session_id")
+	if !validWebSessionID(sessionID) {
+		httperr.Write(w, r, http.StatusBadRequest, "a valid session_id is required")
+		return
+	}
+	user, ok := h.ws.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if !h.ws.claimSession(r.Context(), sessionID, user, sessionKeyFrom(r, sessionID)) {
+		httperr.Write(w, r, http.StatusForbidden, "session belongs to another client")
+		return
+	}
+	var incoming models.WSIncoming
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.ws.maxFrameSize)).Decode(&incoming); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid message format. Send JSON with a 'text' field.")
+		return
+	}
+
+	if incoming.Replay != "" {
+		httperr.Write(w, r, http.StatusBadRequest, "reopen the stream with resume to have frames sent again")
+		return
+	}
+
+	client := adapters.ClientInfoFromRequest(r.Context(), r, h.ws.geo)
+	// The stream's connection, from its connected event, so the echo of
+	// the message skips it
+	connID := r.URL.Query().Get("connection")
+	if !validSessionID(connID) {
+		connID = ""
+	}
+	if err := h.ws.submit(r.Context(), sessionID, connID, user, incoming, client); err != nil {
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			httperr.WriteRetry(w, r, http.StatusTooManyRequests, rateLimitedFrame(limited).Text, limited.RetryAfter)
+			return
+		}
+		var bad *ValidationError
+		if errors.As(err, &bad) {
+			status := http.StatusBadRequest
+			if bad.Reason == "too_long" {
+				status = http.StatusRequestEntityTooLarge
+			}
+			httperr.Write(w, r, status, bad.Text)
+			return
+		}
+		if errors.Is(err, errPublish) {
+			log.Printf("Failed to publish to stream: %v", err)
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "Sorry, I'm having trouble processing your message. Please try again.", 5*time.Second)
+			return
+		}
+		log.Printf("Rejected attachment for session %s: %v", sessionID, err)
+		if errors.Is(err, attachments.ErrScanFailed) {
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, attachmentError(err), 5*time.Second)
+			return
+		}
+		httperr.Write(w, r, http.StatusBadRequest, attachmentError(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Preflight answers CORS preflight requests for the JSON POST.
+func (h *SSEHandler) Preflight(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Session-Key")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowCORS applies the WebSocket origin policy and, for browsers on
+// another origin, the CORS headers EventSource and fetch need.
+func (h *WSHandler) allowCORS(w http.ResponseWriter, r *http.Request) bool {
+	if !h.checkOrigin(r) {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", "Origin")
+	}
+	return true
+}
+
+func writeEvent(w http.ResponseWriter, resp models.WSResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if resp.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", resp.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", resp.Type, data)
+	return err
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/status"
+	"channel-adapter/watchdog"
+)
+
+// Written by the orchestrator's publisher, newest first; keep the field
+// layout in sync.
+const deliveryFailuresKey = "delivery:failures"
+
+// A channel is degraded after this many failed deliveries in failureWindow.
+const (
+	failureThreshold = 3
+	failureWindow    = 5 * time.Minute
+)
+
+// statusCacheTTL bounds how often /status reaches Redis, however many
+// widgets poll it.
+const statusCacheTTL = 5 * time.Second
+
+// StatusHandler serves GET /status, the components' health and the last
+// hour's incidents, for the widget to show a degraded-service banner before
+// the user runs into it. Nothing in it is private, so any origin may read it.
+type StatusHandler struct {
+	rdb   *redis.Client
+	board *status.Board
+
+	mu       sync.Mutex
+	cached   *status.Summary
+	cachedAt time.Time
+}
+
+func NewStatusHandler(rdb *redis.Client) *StatusHandler {
+	return &StatusHandler{rdb: rdb, board: status.NewBoard(rdb)}
+}
+
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=15")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.summary(r.Context()))
+}
+
+// summary is the board's summary with Redis itself added. When Redis can't
+// be reached that is all there is to say.
+func (h *StatusHandler) summary(ctx context.Context) *status.Summary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cached != nil && time.Since(h.cachedAt) < statusCacheTTL {
+		return h.cached
+	}
+	now := time.Now().UTC()
+	redisUp := status.Component{Name: "redis", Status: status.Operational, Since: now, UpdatedAt: now}
+	s, err := h.board.Summary(ctx)
+	if err != nil {
+		log.Printf("Failed to load status: %v", err)
+		redisUp.Status, redisUp.Detail = status.Down, "messages can't be received"
+		s = &status.Summary{Status: status.Down, Incidents: []status.Incident{}, UpdatedAt: now}
+	}
+	s.Components = append([]status.Component{redisUp}, s.Components...)
+	h.cached, h.cachedAt = s, time.Now()
+	return s
+}
+
+// Checks are the components this adapter reports: the end-to-end pipeline
+// when dog probes it, and every channel it serves, judged by the
+// orchestrator's recent delivery failures.
+func (h *StatusHandler) Checks(dog *watchdog.Watchdog, channels []string) map[string]status.Check {
+	checks := make(map[string]status.Check)
+	if dog != nil {
+		checks["pipeline"] = func(context.Context) (string, string) {
+			if !dog.Status().Healthy {
+				return status.Down, "messages are not being answered"
+			}
+			return status.Operational, ""
+		}
+	}
+	for _, name := range channels {
+		checks["channel:"+name] = func(ctx context.Context) (string, string) {
+			return h.channelStatus(ctx, name)
+		}
+	}
+	return checks
+}
+
+func (h *StatusHandler) channelStatus(ctx context.Context, channel string) (string, string) {
+	raw, err := h.rdb.LRange(ctx, deliveryFailuresKey, 0, 99).Result()
+	if err != nil {
+		return status.Unknown, ""
+	}
+	failed := 0
+	for _, r := range raw {
+		var f struct {
+			Channel   string    `json:"channel"`
+			UpdatedAt time.Time `json:"updated_at"`
+		}
+		if json.Unmarshal([]byte(r), &f) != nil || f.Channel != channel {
+			continue
+		}
+		if time.Since(f.UpdatedAt) > failureWindow {
+			// Newest first, so the rest are older
+			break
+		}
+		failed++
+	}
+	if failed >= failureThreshold {
+		return status.Degraded, "some replies are not being delivered"
+	}
+	return status.Operational, ""
+}
+
+// PublishPage writes the summary to dir as status.json and a static
+// index.html every status.ReportInterval until ctx is done, for hosting the
+// status page outside the adapter.
+func (h *StatusHandler) PublishPage(ctx context.Context, dir string) {
+	ticker := time.NewTicker(status.ReportInterval)
+	defer ticker.Stop()
+	for {
+		if err := h.writePage(ctx, dir); err != nil {
+			log.Printf("Failed to write status page: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *StatusHandler) writePage(ctx context.Context, dir string) error {
+	s := h.summary(ctx)
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	var page bytes.Buffer
+	if err := statusPage.Execute(&page, s); err != nil {
+		return fmt.Errorf("failed to render status page: %w", err)
+	}
+	for name, body := range map[string][]byte{"status.json": data, "index.html": page.Bytes()} {
+		// Replace the file whole, so it's never served half-written
+		tmp := filepath.Join(dir, "."+name+".tmp")
+		if err := os.WriteFile(tmp, body, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"when": func(t time.Time) string { return t.Format("15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>Maya status</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:2rem auto;padding:0 1rem;color:#222}
+.operational{color:#1a7f37}.degraded,.unknown{color:#9a6700}.maintenance{color:#0969da}.down{color:#cf222e}
+li{margin:.3rem 0}
+</style>
+</head>
+<body>
+<h1>Maya is <span class="{{.Status}}">{{.Status}}</span></h1>
+<h2>Components</h2>
+<ul>
+{{range .Components}}<li>{{.Name}}: <span class="{{.Status}}">{{.Status}}</span>{{with .Detail}} — {{.}}{{end}}</li>
+{{end}}</ul>
+<h2>Last hour</h2>
+{{if .Incidents}}<ul>
+{{range .Incidents}}<li>{{.Component}} <span class="{{.Status}}">{{.Status}}</span> from {{when .StartedAt}}{{with .ResolvedAt}} until {{when .}}{{else}}, ongoing{{end}}{{with .Detail}} — {{.}}{{end}}</li>
+{{end}}</ul>{{else}}<p>No incidents.</p>{{end}}
+<p><small>Updated {{when .UpdatedAt}}</small></p>
+</body>
+</html>
+`))
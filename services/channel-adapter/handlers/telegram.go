@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+	"channel-adapter/telegram"
+)
+
+const (
+	telegramPollTimeout = 50 * time.Second
+	// Claims stop several adapter replicas from sending the same reply
+	telegramClaimPrefix = "telegram:claim:"
+	telegramClaimTTL    = time.Hour
+	maxTelegramBody     = 1 << 20
+	// Sent message IDs per answer, so a correction can edit it in place
+	telegramSentPrefix = "telegram:sent:"
+	telegramSentTTL    = 7 * 24 * time.Hour
+)
+
+// TelegramHandler receives Telegram updates, by webhook or long polling, and
+// publishes them on msg:inbound like the web channel. Replies are picked up
+// from pub/sub by session prefix and sent through the Bot API.
+type TelegramHandler struct {
+	rdb    *redis.Client
+	bot    *telegram.Bot
+	secret string
+}
+
+func NewTelegramHandler(rdb *redis.Client, bot *telegram.Bot, secret string) *TelegramHandler {
+	return &TelegramHandler{rdb: rdb, bot: bot, secret: secret}
+}
+
+// ServeHTTP is the webhook endpoint. Telegram retries non-2xx responses, so
+// only failures worth retrying return an error status.
+func (h *TelegramHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	got := []byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token"))
+	if subtle.ConstantTimeCompare(got, []byte(h.secret)) != 1 {
+		httperr.Write(w, r, http.StatusUnauthorized, "invalid secret token")
+		return
+	}
+	var update telegram.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTelegramBody)).Decode(&update); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid update")
+		return
+	}
+	if err := h.handleUpdate(r.Context(), update); err != nil {
+		log.Printf("Failed to publish Telegram update %d: %v", update.UpdateID, err)
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to accept update", 5*time.Second)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Poll receives updates with getUpdates when no webhook is configured. Only
+// one replica may poll a bot at a time.
+func (h *TelegramHandler) Poll(ctx context.Context) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := h.bot.GetUpdates(ctx, offset, telegramPollTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Telegram getUpdates failed: %v", err)
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
+		for _, u := range updates {
+			if err := h.handleUpdate(ctx, u); err != nil {
+				log.Printf("Failed to publish Telegram update %d: %v", u.UpdateID, err)
+				break
+			}
+			offset = u.UpdateID + 1
+		}
+	}
+}
+
+// Receive takes updates by webhook when a secret is configured, and by long
+// polling otherwise.
+func (h *TelegramHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	if h.secret != "" {
+		mux.Handle("POST /telegram/webhook", h)
+		return nil
+	}
+	log.Println("TELEGRAM_WEBHOOK_SECRET not set, receiving Telegram updates by long polling")
+	go h.Poll(ctx)
+	return nil
+}
+
+// Normalize takes one Update as JSON.
+func (h *TelegramHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	var u telegram.Update
+	if err := json.Unmarshal(payload, &u); err != nil {
+		return nil, fmt.Errorf("invalid update: %w", err)
+	}
+	if envelope, ok := normalizeUpdate(u); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func normalizeUpdate(u telegram.Update) (models.MessageEnvelope, bool) {
+	switch {
+	case u.Message != nil:
+		return adapters.NormalizeTelegramMessage(u.Message)
+	case u.CallbackQuery != nil:
+		return adapters.NormalizeTelegramCallback(u.CallbackQuery)
+	}
+	return models.MessageEnvelope{}, false
+}
+
+func (h *TelegramHandler) handleUpdate(ctx context.Context, u telegram.Update) error {
+	if cb := u.CallbackQuery; cb != nil {
+		if err := h.bot.AnswerCallbackQuery(ctx, cb.ID); err != nil {
+			log.Printf("Failed to answer Telegram callback %s: %v", cb.ID, err)
+		}
+	}
+	envelope, ok := normalizeUpdate(u)
+	if !ok {
+		return nil
+	}
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err()
+}
+
+// Deliver forwards orchestrator responses for Telegram sessions to the Bot
+// API until ctx is done.
+func (h *TelegramHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.TelegramSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		chatID, ok := adapters.TelegramChatID(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		if !sends.push(msg.Channel, func() { h.send(ctx, chatID, resp) }) {
+			log.Printf("Telegram send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *TelegramHandler) send(ctx context.Context, chatID int64, resp models.WSResponse) {
+	switch resp.Type {
+	case "typing":
+		if err := h.bot.SendTyping(ctx, chatID); err != nil {
+			log.Printf("Telegram typing failed for chat %d: %v", chatID, err)
+		}
+		return
+	case "message", "notice", "error", "terminated", "correction":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, telegramClaimPrefix+resp.ID, 1, telegramClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	if resp.Type == "correction" {
+		if h.edit(ctx, chatID, resp) {
+			if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "telegram", 0, ""); err != nil {
+				log.Printf("%v", err)
+			}
+			return
+		}
+		resp = adapters.AsNotice(resp)
+	}
+
+	text, keyboard, images := adapters.TelegramReply(resp)
+	ids, err := h.bot.SendMessage(ctx, chatID, text, keyboard)
+	if resp.Type == "message" && len(ids) > 0 {
+		key := telegramSentPrefix + adapters.AnswerID(resp.ID)
+		values := make([]interface{}, len(ids))
+		for i, id := range ids {
+			values[i] = id
+		}
+		pipe := h.rdb.Pipeline()
+		pipe.RPush(ctx, key, values...)
+		pipe.Expire(ctx, key, telegramSentTTL)
+		pipe.Exec(ctx)
+	}
+	if err == nil {
+		// The answer is delivered; a retry would send its text again, so a
+		// missing photo is only logged
+		for _, img := range images {
+			if err := h.bot.SendPhoto(ctx, chatID, img.URL, img.Alt); err != nil {
+				log.Printf("Telegram photo failed for chat %d: %v", chatID, err)
+			}
+		}
+		if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "telegram", 0, ""); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+
+	log.Printf("Telegram send failed for chat %d: %v", chatID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, telegramClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var apiErr *telegram.APIError
+	if errors.As(err, &apiErr) {
+		code, desc = apiErr.Code, apiErr.Description
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "telegram", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// edit replaces the corrected answer's text in place and deletes its other
+// parts. It returns false when the answer's messages are unknown or can't
+// be edited, so the correction is sent as a new message instead.
+func (h *TelegramHandler) edit(ctx context.Context, chatID int64, resp models.WSResponse) bool {
+	if resp.Corrects == "" || len([]rune(resp.Text)) > telegram.MaxMessageLength {
+		return false
+	}
+	var ids []int64
+	err := h.rdb.LRange(ctx, telegramSentPrefix+adapters.AnswerID(resp.Corrects), 0, -1).ScanSlice(&ids)
+	if err != nil || len(ids) == 0 {
+		return false
+	}
+	if err := h.bot.EditMessageText(ctx, chatID, ids[0], resp.Text); err != nil {
+		log.Printf("Telegram edit failed for chat %d: %v", chatID, err)
+		return false
+	}
+	for _, id := range ids[1:] {
+		if err := h.bot.DeleteMessage(ctx, chatID, id); err != nil {
+			log.Printf("Telegram delete failed for chat %d: %v", chatID, err)
+		}
+	}
+	return true
+}
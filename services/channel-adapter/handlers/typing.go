@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+const (
+	// Agent consoles and analytics subscribe to typing:{session_id}, or
+	// typing:* for every session
+	typingPrefix = "typing:"
+	// Indicators repeated faster than this are dropped, across connections
+	// and replicas
+	typingInterval = 2 * time.Second
+)
+
+var typingTotal = metrics.NewCounterVec("channel_adapter_typing_indicators_total",
+	"Client typing indicators, by outcome.", "outcome")
+
+// publishTyping tells subscribers that the session's user is composing a
+// message. Nothing is queued: with no subscriber the indicator is lost.
+func (h *WSHandler) publishTyping(ctx context.Context, sessionID, user string) {
+	first, err := h.rdb.SetNX(ctx, typingPrefix+"throttle:"+sessionID, 1, typingInterval).Result()
+	if err != nil {
+		log.Printf("Failed to throttle typing indicator for session %s: %v", sessionID, err)
+		return
+	}
+	if !first {
+		typingTotal.Inc("throttled")
+		return
+	}
+	data, err := json.Marshal(models.TypingEvent{
+		SessionID: sessionID,
+		UserID:    webUserID(user),
+		Channel:   "web",
+		At:        time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Failed to marshal typing indicator: %v", err)
+		return
+	}
+	if err := h.rdb.Publish(ctx, typingPrefix+sessionID, data).Err(); err != nil {
+		log.Printf("Failed to publish typing indicator for session %s: %v", sessionID, err)
+		return
+	}
+	typingTotal.Inc("published")
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"channel-adapter/attachments"
+	"channel-adapter/blobstore"
+	"channel-adapter/httperr"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// Multipart headers and boundaries on top of the file itself
+const uploadOverhead = 64 << 10
+
+var uploadsTotal = metrics.NewCounterVec("channel_adapter_uploads_total",
+	"Files uploaded by web users, by transport and outcome.", "transport", "outcome")
+
+// EnableObjectStorage keeps attachment bytes in blobs instead of Redis.
+func (h *WSHandler) EnableObjectStorage(blobs blobstore.Store) {
+	h.attachments.EnableObjectStorage(blobs)
+}
+
+// UploadHandler takes files from web users ahead of the message that sends
+// them: each upload returns an attachment whose id the client puts in the
+// attachments of its next message.
+type UploadHandler struct {
+	ws *WSHandler
+}
+
+// NewUploadHandler shares ws's origin policy, token verifier, rate limits
+// and attachment store.
+func NewUploadHandler(ws *WSHandler) *UploadHandler {
+	return &UploadHandler{ws: ws}
+}
+
+// Upload serves POST /v1/uploads?session_id=…, a multipart form with the
+// file in its "file" field. It answers 201 with the stored attachment.
+func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	sessionID := r.URL.Query().Get("session_id")
+	if !validWebSessionID(sessionID) {
+		httperr.Write(w, r, http.StatusBadRequest, "a valid session_id is required")
+		return
+	}
+	user, ok := h.ws.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if !h.ws.claimSession(r.Context(), sessionID, user, sessionKeyFrom(r, sessionID)) {
+		httperr.Write(w, r, http.StatusForbidden, "session belongs to another client")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(attachments.MaxUploadSize)+uploadOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			uploadsTotal.Inc("http", "refused")
+			httperr.Write(w, r, http.StatusRequestEntityTooLarge, attachmentError(attachments.ErrTooLarge))
+			return
+		}
+		httperr.Write(w, r, http.StatusBadRequest, `Send the file as multipart/form-data in a field named "file".`)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(attachments.MaxUploadSize)+1))
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "failed to read the upload")
+		return
+	}
+
+	att, err := h.ws.upload(r.Context(), sessionID, header.Filename, header.Header.Get("Content-Type"), data, "http")
+	if err != nil {
+		var limited *RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			httperr.WriteRetry(w, r, http.StatusTooManyRequests, rateLimitedFrame(limited).Text, limited.RetryAfter)
+		case errors.Is(err, attachments.ErrTooLarge):
+			httperr.Write(w, r, http.StatusRequestEntityTooLarge, attachmentError(err))
+		case errors.Is(err, attachments.ErrUnsupported):
+			httperr.Write(w, r, http.StatusUnsupportedMediaType, attachmentError(err))
+		case errors.Is(err, attachments.ErrMismatch), errors.Is(err, attachments.ErrInfected):
+			httperr.Write(w, r, http.StatusUnprocessableEntity, attachmentError(err))
+		default:
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, attachmentError(err), 5*time.Second)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(att)
+}
+
+// Preflight answers CORS preflight requests for the upload POST.
+func (h *UploadHandler) Preflight(w http.ResponseWriter, r *http.Request) {
+	if !h.ws.allowCORS(w, r) {
+		httperr.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Session-Key")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadFrame stores a binary WebSocket frame as an upload and answers with
+// an uploaded frame carrying the attachment, or an error frame. Frames have
+// no file name or declared type; the type is sniffed.
+func (h *WSHandler) uploadFrame(ctx context.Context, sessionID string, data []byte) models.WSResponse {
+	att, err := h.upload(ctx, sessionID, "", "", data, "websocket")
+	if err != nil {
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			return rateLimitedFrame(limited)
+		}
+		return models.WSResponse{Type: "error", Text: attachmentError(err)}
+	}
+	payload, err := json.Marshal(att)
+	if err != nil {
+		log.Printf("Failed to marshal attachment: %v", err)
+		return models.WSResponse{Type: "error", Text: attachmentError(err)}
+	}
+	return models.WSResponse{Type: "uploaded", SessionID: sessionID, Data: payload}
+}
+
+// upload stores a file for the session. Uploads count towards the session's
+// message allowance, since each is usually followed by a message.
+func (h *WSHandler) upload(ctx context.Context, sessionID, name, declaredType string, data []byte, transport string) (models.Attachment, error) {
+	if err := h.allowSessionMessage(ctx, sessionID); err != nil {
+		uploadsTotal.Inc(transport, "rate_limited")
+		return models.Attachment{}, err
+	}
+	att, err := h.attachments.Upload(ctx, sessionID, name, declaredType, data)
+	if err != nil {
+		log.Printf("Rejected upload for session %s: %v", sessionID, err)
+		uploadsTotal.Inc(transport, "refused")
+		return models.Attachment{}, err
+	}
+	uploadsTotal.Inc(transport, "stored")
+	return att, nil
+}
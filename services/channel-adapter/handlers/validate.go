@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// MaxMessageLength bounds the text of a web message, in characters; main
+// sets it from the environment.
+var MaxMessageLength = 4000
+
+const (
+	maxSchemaSize   = 16 << 10
+	maxSessionID    = 128
+	maxMessageIDRef = 128
+	maxAttachments  = 5
+)
+
+var messagesInvalid = metrics.NewCounterVec("channel_adapter_messages_invalid_total",
+	"Web messages refused as malformed or too large, by reason.", "reason")
+
+var reportReasons = map[string]bool{"harmful": true, "wrong": true, "offensive": true, "other": true}
+
+// ValidationError is a web message refused before it was published. Its
+// text is meant for the user.
+type ValidationError struct {
+	Reason string
+	Text   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid message (%s)", e.Reason)
+}
+
+func invalidMessage(reason, text string) error {
+	messagesInvalid.Inc(reason)
+	return &ValidationError{Reason: reason, Text: text}
+}
+
+// checkSchema checks a response_schema from any channel, returning nil for
+// an absent or null one. The orchestrator validates the schema itself.
+func checkSchema(raw json.RawMessage) (json.RawMessage, error) {
+	schema := bytes.TrimSpace(raw)
+	switch {
+	case len(schema) == 0 || bytes.Equal(schema, []byte("null")):
+		return nil, nil
+	case len(schema) > maxSchemaSize:
+		return nil, invalidMessage("schema", fmt.Sprintf("response_schema must be at most %d bytes.", maxSchemaSize))
+	case schema[0] != '{':
+		return nil, invalidMessage("schema", "response_schema must be a JSON object.")
+	}
+	return raw, nil
+}
+
+// validateIncoming checks every field of a web message, and trims its text,
+// so nothing malformed reaches msg:inbound.
+func validateIncoming(in *models.WSIncoming) error {
+	switch in.Type {
+	case "", "typing":
+	case "edit", "delete":
+		if !validMessageRef(in.MessageID) {
+			return invalidMessage("edit", "An edit or deletion needs the message_id of one of your messages.")
+		}
+	default:
+		return invalidMessage("type", `type must be "typing", "edit", "delete" or left out.`)
+	}
+	if !utf8.ValidString(in.Text) {
+		return invalidMessage("encoding", "Messages must be UTF-8 text.")
+	}
+	in.Text = strings.TrimSpace(in.Text)
+	if strings.ContainsFunc(in.Text, isControl) {
+		return invalidMessage("control_characters", "Your message contains characters that can't be sent.")
+	}
+	if n := utf8.RuneCountInString(in.Text); n > MaxMessageLength {
+		return invalidMessage("too_long", fmt.Sprintf("Your message is too long (%d characters). Please keep it under %d.", n, MaxMessageLength))
+	}
+	if in.Type == "edit" && in.Text == "" {
+		return invalidMessage("edit", "An edited message can't be empty; delete it instead.")
+	}
+
+	schema, err := checkSchema(in.ResponseSchema)
+	if err != nil {
+		return err
+	}
+	in.ResponseSchema = schema
+
+	if fb := in.Feedback; fb != nil {
+		if !validMessageRef(fb.MessageID) || (fb.Rating != "up" && fb.Rating != "down") {
+			return invalidMessage("feedback", `Feedback needs the message_id of an answer and a rating of "up" or "down".`)
+		}
+	}
+	if rep := in.Report; rep != nil {
+		if !validMessageRef(rep.MessageID) || !reportReasons[rep.Reason] {
+			return invalidMessage("report", `A report needs the message_id of an answer and a reason of "harmful", "wrong", "offensive" or "other".`)
+		}
+		if !utf8.ValidString(rep.Comment) {
+			return invalidMessage("encoding", "Messages must be UTF-8 text.")
+		}
+	}
+	if in.Ack != "" && !validMessageRef(in.Ack) {
+		return invalidMessage("ack", "ack must be the id of a frame.")
+	}
+	if in.MergeSession != "" && !validWebSessionID(in.MergeSession) {
+		return invalidMessage("session_id", "merge_session is not a valid session ID.")
+	}
+	if att := in.Attachment; att != nil && att.Data == "" {
+		return invalidMessage("attachment", "The attachment is empty.")
+	}
+	if len(in.Attachments) > maxAttachments {
+		return invalidMessage("attachment", fmt.Sprintf("A message can carry at most %d attachments.", maxAttachments))
+	}
+	for _, id := range in.Attachments {
+		// Attachment ids are the UUIDs uploads return, never another key
+		if _, err := uuid.Parse(id); err != nil || len(id) != 36 {
+			return invalidMessage("attachment", "attachments must be ids returned by an upload.")
+		}
+	}
+	return nil
+}
+
+// isControl reports control characters other than tabs and line breaks.
+func isControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+}
+
+func validMessageRef(id string) bool {
+	return id != "" && len(id) <= maxMessageIDRef && !strings.ContainsFunc(id, isControl)
+}
+
+// validSessionID accepts simple IDs such as connection IDs, but nothing
+// that could reshape a Redis key or channel. Web session IDs are UUIDs; see
+// validWebSessionID.
+func validSessionID(id string) bool {
+	if id == "" || len(id) > maxSessionID {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
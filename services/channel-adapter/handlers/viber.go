@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+	"channel-adapter/viber"
+)
+
+const (
+	// Viber retries callbacks that are not answered with 200, so inbound
+	// message tokens are remembered for a day to drop duplicates
+	viberSeenPrefix  = "viber:seen:"
+	viberSeenTTL     = 24 * time.Hour
+	viberClaimPrefix = "viber:claim:"
+	viberClaimTTL    = time.Hour
+	// Receipt callbacks refer to Viber message tokens; this maps them back to
+	// the orchestrator's response ID
+	viberSentPrefix = "viber:sent:"
+	viberSentTTL    = 7 * 24 * time.Hour
+
+	// Sends in flight at once, across chats
+	viberSenders = 4
+	maxViberBody = 1 << 20
+)
+
+// ViberHandler receives Viber bot callbacks and publishes messages on
+// msg:inbound. Replies are sent through the REST API, in order per chat,
+// with quick replies from structured responses shown as a keyboard.
+type ViberHandler struct {
+	rdb     *redis.Client
+	client  *viber.Client
+	token   string
+	welcome string
+}
+
+func NewViberHandler(rdb *redis.Client, client *viber.Client, token, welcome string) *ViberHandler {
+	return &ViberHandler{
+		rdb:     rdb,
+		client:  client,
+		token:   token,
+		welcome: welcome,
+	}
+}
+
+func (h *ViberHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxViberBody))
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if !viber.VerifySignature(h.token, body, r.Header.Get("X-Viber-Content-Signature")) {
+		httperr.Write(w, r, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	var ev viber.Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid callback")
+		return
+	}
+
+	ctx := r.Context()
+	switch ev.Event {
+	case viber.EventMessage:
+		if err := h.handleMessage(ctx, ev); err != nil {
+			log.Printf("Failed to accept Viber message: %v", err)
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to accept message", 5*time.Second)
+			return
+		}
+	case viber.EventConversationStarted:
+		// The only message allowed before the user subscribes is the one
+		// returned in this response
+		if h.welcome != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(h.client.Welcome(h.welcome))
+			return
+		}
+	case viber.EventDelivered:
+		h.report(ctx, ev.MessageToken, receipts.StatusDelivered, 0, "")
+	case viber.EventFailed:
+		h.report(ctx, ev.MessageToken, receipts.StatusFailed, 0, ev.Desc)
+	case viber.EventUnsubscribed:
+		log.Printf("Viber user %s unsubscribed", ev.UserID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Receive serves the callback URL.
+func (h *ViberHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	mux.Handle("POST /viber/webhook", h)
+	return nil
+}
+
+// Normalize takes one callback body.
+func (h *ViberHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	var ev viber.Event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, fmt.Errorf("invalid callback: %w", err)
+	}
+	if ev.Event != viber.EventMessage {
+		return nil, nil
+	}
+	if envelope, ok := adapters.NormalizeViberMessage(ev); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *ViberHandler) handleMessage(ctx context.Context, ev viber.Event) error {
+	envelope, ok := adapters.NormalizeViberMessage(ev)
+	if !ok {
+		return nil
+	}
+	seenKey := viberSeenPrefix + strconv.FormatInt(ev.MessageToken, 10)
+	fresh, err := h.rdb.SetNX(ctx, seenKey, 1, viberSeenTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return nil
+	}
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	err = h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err()
+	if err != nil {
+		// Let Viber's retry through
+		h.rdb.Del(ctx, seenKey)
+		return err
+	}
+	return nil
+}
+
+// report turns a delivered or failed callback into a receipt.
+func (h *ViberHandler) report(ctx context.Context, token int64, status string, code int, desc string) {
+	id, err := h.rdb.Get(ctx, viberSentPrefix+strconv.FormatInt(token, 10)).Result()
+	if err != nil {
+		return
+	}
+	if err := receipts.Report(ctx, h.rdb, id, status, "viber", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Register sets the bot's webhook to url, retrying until Viber can reach it
+// or ctx is done.
+func (h *ViberHandler) Register(ctx context.Context, url string) {
+	for attempt := 1; ; attempt++ {
+		err := h.client.SetWebhook(ctx, url)
+		if err == nil {
+			log.Printf("Viber webhook set to %s", url)
+			return
+		}
+		log.Printf("Failed to set Viber webhook (attempt %d): %v", attempt, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(time.Duration(attempt)*5*time.Second, time.Minute)):
+		}
+	}
+}
+
+// Deliver sends orchestrator responses for Viber sessions, in order per
+// chat, until ctx is done.
+func (h *ViberHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.ViberSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(viberSenders)
+	for msg := range redisconn.Channel(pubsub) {
+		to, ok := adapters.ViberRecipient(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		// Viber has no typing indicator for bots
+		switch resp.Type {
+		case "message", "notice", "error", "terminated":
+		default:
+			continue
+		}
+		if resp.Text == "" {
+			continue
+		}
+		if !sends.push(to, func() { h.send(ctx, to, resp) }) {
+			log.Printf("Viber send queue full, dropping response %s", resp.ID)
+			if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "viber", 0, "adapter send queue full"); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}
+}
+
+func (h *ViberHandler) send(ctx context.Context, to string, resp models.WSResponse) {
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, viberClaimPrefix+resp.ID, 1, viberClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	kb, tracking := adapters.ViberKeyboard(resp)
+	tokens, err := h.client.SendText(ctx, to, adapters.WithLinks(resp.Text, adapters.Rich(resp)), kb, tracking)
+	if resp.ID != "" {
+		for _, t := range tokens {
+			h.rdb.Set(ctx, viberSentPrefix+strconv.FormatInt(t, 10), resp.ID, viberSentTTL)
+		}
+	}
+	if err == nil {
+		// Delivery is confirmed later by a delivered callback
+		return
+	}
+
+	log.Printf("Viber send failed for response %s: %v", resp.ID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, viberClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var apiErr *viber.APIError
+	if errors.As(err, &apiErr) {
+		code, desc = apiErr.Code, apiErr.Message
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "viber", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
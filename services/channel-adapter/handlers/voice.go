@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+	"channel-adapter/twilio"
+	"channel-adapter/voice"
+)
+
+const (
+	// The TwiML for a call carries a one-time token that the media stream
+	// must present, since stream connections are not signed
+	voiceStreamPrefix = "voice:stream:"
+	voiceStreamTTL    = 5 * time.Minute
+	// Audio is sent to Twilio in one-second chunks
+	voiceChunkBytes = voice.SampleRate
+
+	voiceUnavailable = "Sorry, we can't take your call right now. Please try again later."
+)
+
+var voiceUtterances = metrics.NewCounterVec("channel_adapter_voice_utterances_total",
+	"Caller utterances by transcription result.", "result")
+
+var voiceUpgrader = websocket.Upgrader{
+	// Media streams come from Twilio, not browsers
+	CheckOrigin: func(r *http.Request) bool { return true },
+	Error:       upgradeError,
+}
+
+// VoiceHandler answers Twilio Voice calls. Each call is connected to a media
+// stream: caller audio is split into utterances, transcribed by the STT hook
+// and published on msg:inbound, and answers on the call's response channel
+// are synthesized by the TTS hook and played back. Callers can interrupt an
+// answer by speaking.
+type VoiceHandler struct {
+	rdb       *redis.Client
+	client    *twilio.Client
+	publicURL string
+	stt       voice.Transcriber
+	tts       voice.Synthesizer
+	language  string
+	greeting  string
+}
+
+// NewVoiceHandler needs the public base URL Twilio calls, both to verify
+// webhook signatures and to tell Twilio where the media stream is.
+func NewVoiceHandler(rdb *redis.Client, client *twilio.Client, publicURL string, stt voice.Transcriber, tts voice.Synthesizer, language, greeting string) *VoiceHandler {
+	return &VoiceHandler{
+		rdb:       rdb,
+		client:    client,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		stt:       stt,
+		tts:       tts,
+		language:  language,
+		greeting:  greeting,
+	}
+}
+
+// Inbound is the voice webhook for the Twilio number.
+func (h *VoiceHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	if !verifyTwilio(w, r, h.client.AuthToken(), h.publicURL) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	callSID := r.PostForm.Get("CallSid")
+	if callSID == "" {
+		io.WriteString(w, twilio.SayTwiML(voiceUnavailable))
+		return
+	}
+	token := uuid.New().String()
+	if err := h.rdb.Set(r.Context(), voiceStreamPrefix+callSID, token, voiceStreamTTL).Err(); err != nil {
+		log.Printf("Failed to register voice stream for call %s: %v", callSID, err)
+		io.WriteString(w, twilio.SayTwiML(voiceUnavailable))
+		return
+	}
+	io.WriteString(w, twilio.StreamTwiML(h.streamURL(), map[string]string{
+		"token": token,
+		"from":  r.PostForm.Get("From"),
+	}))
+}
+
+func (h *VoiceHandler) streamURL() string {
+	u := h.publicURL + "/voice/stream"
+	if rest, ok := strings.CutPrefix(u, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(u, "http://"); ok {
+		return "ws://" + rest
+	}
+	return u
+}
+
+// voiceCall is one connected media stream.
+type voiceCall struct {
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	streamSid string
+	callSID   string
+	from      string
+
+	playMu  sync.Mutex
+	playing string // name of the last mark sent, or empty when silent
+	marks   int
+}
+
+func (c *voiceCall) send(ev twilio.StreamEvent) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(ev)
+}
+
+// Stream serves the media stream WebSocket Twilio opens for each call.
+func (h *VoiceHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := voiceUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Voice stream upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	call, err := h.start(ctx, conn)
+	if err != nil {
+		log.Printf("Rejected voice stream: %v", err)
+		return
+	}
+	sessionID := adapters.VoiceSessionID(call.callSID)
+	log.Printf("Voice call %s connected", call.callSID)
+
+	pubsub := h.rdb.Subscribe(ctx, fmt.Sprintf("response:%s", sessionID))
+	defer pubsub.Close()
+	go h.speakResponses(ctx, cancel, call, pubsub)
+
+	if h.greeting != "" {
+		h.say(ctx, call, h.greeting)
+	}
+
+	// Utterances are transcribed in order by one worker so a slow STT call
+	// cannot reorder the caller's questions
+	utterances := make(chan []byte, 8)
+	defer close(utterances)
+	go func() {
+		for u := range utterances {
+			h.transcribe(ctx, call, u)
+		}
+	}()
+
+	seg := voice.NewSegmenter()
+	for {
+		var ev twilio.StreamEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			if u := seg.Flush(); u != nil {
+				utterances <- u
+			}
+			log.Printf("Voice call %s ended: %v", call.callSID, err)
+			return
+		}
+		switch ev.Event {
+		case twilio.StreamMedia:
+			audio, err := ev.Audio()
+			if err != nil {
+				continue
+			}
+			for _, u := range seg.Write(audio) {
+				select {
+				case utterances <- u:
+				default:
+					voiceUtterances.Inc("dropped")
+				}
+			}
+			if seg.Speaking() {
+				h.interrupt(call)
+			}
+		case twilio.StreamMark:
+			if ev.Mark != nil {
+				call.playMu.Lock()
+				if call.playing == ev.Mark.Name {
+					call.playing = ""
+				}
+				call.playMu.Unlock()
+			}
+		case twilio.StreamStop:
+			if u := seg.Flush(); u != nil {
+				utterances <- u
+			}
+			log.Printf("Voice call %s ended", call.callSID)
+			return
+		}
+	}
+}
+
+// start waits for the stream's start event and checks its token.
+func (h *VoiceHandler) start(ctx context.Context, conn *websocket.Conn) (*voiceCall, error) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var ev twilio.StreamEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			return nil, err
+		}
+		if ev.Event != twilio.StreamStart || ev.Start == nil {
+			continue
+		}
+		want, err := h.rdb.GetDel(ctx, voiceStreamPrefix+ev.Start.CallSid).Result()
+		if err != nil || want == "" || want != ev.Start.CustomParameters["token"] {
+			return nil, fmt.Errorf("invalid stream token for call %s", ev.Start.CallSid)
+		}
+		return &voiceCall{
+			conn:      conn,
+			streamSid: ev.Start.StreamSid,
+			callSID:   ev.Start.CallSid,
+			from:      ev.Start.CustomParameters["from"],
+		}, nil
+	}
+}
+
+func (h *VoiceHandler) transcribe(ctx context.Context, call *voiceCall, audio []byte) {
+	text, err := h.stt.Transcribe(ctx, audio, h.language)
+	if err != nil {
+		voiceUtterances.Inc("failed")
+		log.Printf("Failed to transcribe utterance on call %s: %v", call.callSID, err)
+		return
+	}
+	envelope, ok := adapters.NormalizeVoiceTranscript(call.callSID, call.from, text, h.language)
+	if !ok {
+		voiceUtterances.Inc("empty")
+		return
+	}
+	voiceUtterances.Inc("transcribed")
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish voice message: %v", err)
+		h.say(ctx, call, "Sorry, I'm having trouble processing your question. Please try again.")
+	}
+}
+
+// speakResponses plays every user-visible frame for the call. Typing frames
+// are skipped; accepted frames tell the caller to hold on.
+func (h *VoiceHandler) speakResponses(ctx context.Context, cancel context.CancelFunc, call *voiceCall, pubsub *redis.PubSub) {
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				log.Printf("Failed to unmarshal response: %v", err)
+				continue
+			}
+			resp = adapters.AsNotice(resp)
+			switch resp.Type {
+			case "message", "notice", "accepted", "error":
+				h.say(ctx, call, resp.Text)
+			case "terminated":
+				h.say(ctx, call, resp.Text)
+				cancel()
+				call.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// say synthesizes text and queues it on the call, followed by a mark so we
+// know when it has finished playing.
+func (h *VoiceHandler) say(ctx context.Context, call *voiceCall, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	audio, err := h.tts.Synthesize(ctx, text, h.language)
+	if err != nil {
+		log.Printf("Failed to synthesize speech for call %s: %v", call.callSID, err)
+		return
+	}
+	for len(audio) > 0 {
+		n := min(len(audio), voiceChunkBytes)
+		if err := call.send(twilio.MediaEvent(call.streamSid, audio[:n])); err != nil {
+			return
+		}
+		audio = audio[n:]
+	}
+	call.playMu.Lock()
+	call.marks++
+	name := fmt.Sprintf("answer-%d", call.marks)
+	call.playing = name
+	call.playMu.Unlock()
+	call.send(twilio.MarkEvent(call.streamSid, name))
+}
+
+// interrupt stops playback when the caller starts talking over it.
+func (h *VoiceHandler) interrupt(call *voiceCall) {
+	call.playMu.Lock()
+	playing := call.playing != ""
+	call.playing = ""
+	call.playMu.Unlock()
+	if playing {
+		call.send(twilio.ClearEvent(call.streamSid))
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/httperr"
+	"channel-adapter/jwt"
+	"channel-adapter/metrics"
+)
+
+const (
+	// The signed-in user a web session belongs to, so it can't be resumed
+	// by anyone else
+	sessionOwnerPrefix = "web:owner:"
+	sessionOwnerTTL    = 30 * 24 * time.Hour
+)
+
+var webAuthTotal = metrics.NewCounterVec("channel_adapter_web_auth_total",
+	"Web connections and messages by authentication outcome.", "outcome")
+
+// EnableAuth identifies web users by a bearer token verified with v, sent
+// in the Authorization header or, since browsers can't set headers on a
+// WebSocket handshake, the token query parameter. Without a token a client
+// gets a guest session, or is refused if required is set.
+func (h *WSHandler) EnableAuth(v *jwt.Verifier, required bool) {
+	h.auth, h.authRequired = v, required
+}
+
+// authenticate returns the user making the request, or "" for a guest. It
+// writes the error response itself when the request is refused.
+func (h *WSHandler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.auth == nil {
+		return "", true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		if h.authRequired {
+			webAuthTotal.Inc("missing")
+			httperr.Write(w, r, http.StatusUnauthorized, "authentication required")
+			return "", false
+		}
+		webAuthTotal.Inc("guest")
+		return "", true
+	}
+	user, err := h.auth.Verify(r.Context(), token)
+	if errors.Is(err, jwt.ErrInvalid) {
+		webAuthTotal.Inc("invalid")
+		httperr.Write(w, r, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+	if err != nil {
+		log.Printf("Failed to verify web token: %v", err)
+		webAuthTotal.Inc("error")
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to verify token", 5*time.Second)
+		return "", false
+	}
+	webAuthTotal.Inc("authenticated")
+	return user, true
+}
+
+// openSession binds the session a connection opens to its client, and
+// reports whether the client may use it. A new session gets a session key,
+// returned for the connected frame; resuming one takes its key, unless the
+// session is the signed-in user's own.
+func (h *WSHandler) openSession(ctx context.Context, r *http.Request, sessionID, user string, resumed bool) (string, bool) {
+	owned, allowed := h.sessionOwner(ctx, sessionID, user)
+	if !allowed {
+		return "", false
+	}
+	var issued string
+	if !owned {
+		ok, bound := false, false
+		if resumed {
+			ok, bound = h.checkSessionKey(ctx, sessionID, sessionKeyFrom(r, sessionID))
+		}
+		switch {
+		case ok:
+		case bound:
+			return "", false
+		case resumed && h.hasHistory(ctx, sessionID):
+			sessionKeysTotal.Inc("unbound")
+			return "", false
+		default:
+			// New, or a session ID the client picked that was never used
+			key, err := h.issueSessionKey(ctx, sessionID)
+			if err != nil {
+				log.Printf("Failed to issue key for session %s: %v", sessionID, err)
+				return "", false
+			}
+			issued = key
+		}
+	}
+	h.bindOwner(ctx, sessionID, user)
+	return issued, true
+}
+
+// claimSession reports whether a request that presents key may use an
+// existing session: it must be the signed-in user's own session or key must
+// be its session key. A guest session taken over by a user who signs in
+// becomes theirs.
+func (h *WSHandler) claimSession(ctx context.Context, sessionID, user, key string) bool {
+	owned, allowed := h.sessionOwner(ctx, sessionID, user)
+	if !allowed {
+		return false
+	}
+	if !owned {
+		if ok, _ := h.checkSessionKey(ctx, sessionID, key); !ok {
+			return false
+		}
+	}
+	h.bindOwner(ctx, sessionID, user)
+	return true
+}
+
+// sessionOwner reports whether sessionID is the signed-in user's own, and
+// whether user may use it at all: a signed-in user's session is only theirs.
+func (h *WSHandler) sessionOwner(ctx context.Context, sessionID, user string) (owned, allowed bool) {
+	if h.auth == nil {
+		return false, true
+	}
+	owner, err := h.rdb.Get(ctx, sessionOwnerPrefix+sessionID).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to load owner of session %s: %v", sessionID, err)
+		return false, false
+	}
+	if owner == "" {
+		// The owner is forgotten after a while, but a conversation a user
+		// took part in stays theirs for as long as its transcript is kept
+		past, err := h.rdb.HGet(ctx, transcriptMetaPrefix+sessionID, "user_id").Result()
+		if err == nil && past != webUserID(user) {
+			webAuthTotal.Inc("wrong_owner")
+			return false, false
+		}
+		return err == nil && user != "", true
+	}
+	if owner != user {
+		webAuthTotal.Inc("wrong_owner")
+		return false, false
+	}
+	return true, true
+}
+
+func (h *WSHandler) bindOwner(ctx context.Context, sessionID, user string) {
+	if h.auth != nil && user != "" {
+		h.rdb.Set(ctx, sessionOwnerPrefix+sessionID, user, sessionOwnerTTL)
+	}
+}
+
+// webUserID is the envelope user ID for an authenticated web user.
+func webUserID(user string) string {
+	if user == "" {
+		return "anonymous"
+	}
+	return "web:" + user
+}
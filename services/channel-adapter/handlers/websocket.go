@@ -3,91 +3,270 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
 
 	"channel-adapter/adapters"
+	"channel-adapter/attachments"
+	"channel-adapter/hostevents"
+	"channel-adapter/httperr"
+	"channel-adapter/jwt"
 	"channel-adapter/models"
+	"channel-adapter/redisconn"
 )
 
-const streamKey = "msg:inbound"
+const (
+	streamKey      = "msg:inbound"
+	feedbackStream = "msg:feedback"
+	reportsStream  = "msg:reports"
+	// Large enough for a base64-encoded screenshot attachment; bigger files
+	// are uploaded over HTTP
+	DefaultMaxFrameSize = 4 << 20
+)
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // overridden at handler level
-	},
+// upgradeError replaces gorilla's plain-text handshake errors, such as a
+// rejected origin, with the standard error body.
+func upgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	httperr.Write(w, r, status, reason.Error())
 }
 
 type WSHandler struct {
-	rdb            *redis.Client
-	allowedOrigins map[string]bool
+	rdb          *redis.Client
+	origins      *OriginAllowlist
+	geo          adapters.GeoResolver
+	attachments  *attachments.Store
+	hosts        *hostevents.Notifier
+	connectLimit int
+	auth         *jwt.Verifier
+	authRequired bool
+	msgRate      int
+	msgBurst     int
+	welcomeAfter time.Duration
+	welcomeText  string
+	upgrader     websocket.Upgrader
+	maxFrameSize int64
+	// Shutdown sets draining and closes closing; open counts connections
+	drainMu  sync.RWMutex
+	draining bool
+	closing  chan struct{}
+	open     sync.WaitGroup
 }
 
-func NewWSHandler(rdb *redis.Client, allowedOrigins []string) *WSHandler {
-	origins := make(map[string]bool)
-	for _, o := range allowedOrigins {
-		origins[o] = true
-	}
-	return &WSHandler{rdb: rdb, allowedOrigins: origins}
+func NewWSHandler(rdb *redis.Client, origins *OriginAllowlist) *WSHandler {
+	h := &WSHandler{rdb: rdb, origins: origins, attachments: attachments.NewStore(rdb), closing: make(chan struct{}), maxFrameSize: DefaultMaxFrameSize}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin, Error: upgradeError}
+	return h
 }
 
-func (h *WSHandler) checkOrigin(r *http.Request) bool {
-	if len(h.allowedOrigins) == 0 {
-		return true
+// TransportConfig tunes WebSocket connections. Zero fields keep the
+// defaults: gorilla/websocket's 4 KB buffers, no handshake timeout and
+// DefaultMaxFrameSize.
+type TransportConfig struct {
+	// ReadBufferSize and WriteBufferSize are the I/O buffers each
+	// connection holds; smaller ones save memory with many idle
+	// connections, larger ones save syscalls on big frames.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// HandshakeTimeout bounds the upgrade.
+	HandshakeTimeout time.Duration
+	// MaxFrameSize is the largest frame accepted, in bytes; larger ones
+	// close the connection with 1009. It also caps SSE message bodies.
+	MaxFrameSize int64
+}
+
+// ConfigureTransport replaces the connection defaults with the non-zero
+// fields of cfg. Call it before serving.
+func (h *WSHandler) ConfigureTransport(cfg TransportConfig) {
+	if cfg.ReadBufferSize > 0 {
+		h.upgrader.ReadBufferSize = cfg.ReadBufferSize
+	}
+	if cfg.WriteBufferSize > 0 {
+		h.upgrader.WriteBufferSize = cfg.WriteBufferSize
 	}
-	origin := r.Header.Get("Origin")
-	if origin == "" {
-		return true // allow non-browser clients
+	if cfg.HandshakeTimeout > 0 {
+		h.upgrader.HandshakeTimeout = cfg.HandshakeTimeout
+	}
+	if cfg.MaxFrameSize > 0 {
+		h.maxFrameSize = cfg.MaxFrameSize
 	}
-	return h.allowedOrigins[origin]
 }
 
-func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	upgrader.CheckOrigin = h.checkOrigin
+// EnableAttachmentScanning checks every attachment for malware before it is
+// stored or forwarded.
+func (h *WSHandler) EnableAttachmentScanning(scanner attachments.Scanner) {
+	h.attachments.EnableScanning(scanner)
+}
+
+// EnableGeo adds a rough client location to envelope metadata.
+func (h *WSHandler) EnableGeo(geo adapters.GeoResolver) {
+	h.geo = geo
+}
+
+func (h *WSHandler) checkOrigin(r *http.Request) bool {
+	return h.origins.Allow(r.Header.Get("Origin"))
+}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.allowConnect(w, r, "websocket") {
+		return
+	}
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	protocol, subprotocol, err := negotiateProtocol(r)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer conn.Close()
 
 	// Determine session ID
 	sessionID := r.URL.Query().Get("session_id")
-	if sessionID == "" {
+	resumed := sessionID != ""
+	if !resumed {
 		sessionID = uuid.New().String()
+	} else if !validWebSessionID(sessionID) {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid session_id")
+		return
+	}
+	sessionKey, ok := h.openSession(r.Context(), r, sessionID, user, resumed)
+	if !ok {
+		httperr.Write(w, r, http.StatusForbidden, "session belongs to another client")
+		return
+	}
+	if !h.track() {
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "server is shutting down", time.Second)
+		return
 	}
+	defer h.open.Done()
+
+	header := instanceHeader(r)
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	if sessionKey != "" {
+		header.Add("Set-Cookie", sessionCookie(sessionID, sessionKey).String())
+	}
+	raw, err := h.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		log.Printf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	defer raw.Close()
+	raw.SetReadLimit(h.maxFrameSize)
+	conn := newWSConn(raw)
 
 	// Send connected message
+	var token string
+	if resumed {
+		token = r.URL.Query().Get("resume")
+	}
+	cursor := h.resumeCursor(r.Context(), sessionID, token)
+	var returning bool
+	var welcome *models.WSResponse
+	if resumed {
+		returning, welcome = h.returning(r.Context(), sessionID)
+	}
+	connID := uuid.New().String()
 	connMsg := models.WSResponse{
-		Type:      "connected",
-		SessionID: sessionID,
+		Type:        "connected",
+		SessionID:   sessionID,
+		Instance:    InstanceID,
+		Reconnect:   reconnectHint(sessionID),
+		Returning:   returning,
+		Connection:  connID,
+		Protocol:    protocol,
+		SessionKey:  sessionKey,
+		ResumeToken: cursor,
 	}
 	if err := conn.WriteJSON(connMsg); err != nil {
 		log.Printf("Failed to send connected message: %v", err)
 		return
 	}
+	if welcome != nil {
+		conn.WriteJSON(*welcome)
+	}
+
+	client := adapters.ClientInfoFromRequest(r.Context(), r, h.geo)
+
+	var closeErr error
+	var ended atomic.Bool
+	connectedAt := trackConnect(r.Context(), h.rdb, sessionID, resumed)
+	defer func() {
+		trackDisconnect(h.rdb, sessionID, connectedAt, closeErr)
+		h.hostDisconnected(sessionID, ended.Load())
+	}()
+	h.hosts.Connected(r.Context(), sessionID)
+	if !resumed {
+		if frame, ok := h.hostEvent(sessionID, hostevents.Started, ""); ok {
+			conn.WriteJSON(frame)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
+	go conn.keepalive(ctx)
+	h.online(ctx, sessionID, connID, "websocket", webUserID(user), connectedAt)
 
 	// Subscribe to response channel
 	responseCh := fmt.Sprintf("response:%s", sessionID)
 	pubsub := h.rdb.Subscribe(ctx, responseCh)
 	defer pubsub.Close()
 
+	// Frames held or buffered while the client was away go out before new
+	// ones. Frames published after subscribing can arrive both ways; the
+	// pub/sub copy is skipped.
+	explicitAcks := r.URL.Query().Get("acks") == "true"
+	redelivered := make(map[string]bool)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("Failed to subscribe for session %s: %v", sessionID, err)
+		return
+	}
+	order := frameOrder{cursor: cursor}
+	for _, resp := range h.resumeFrames(ctx, sessionID, cursor, resumed, token != "") {
+		if err := conn.WriteJSON(resp); err != nil {
+			log.Printf("Failed to write to WebSocket: %v", err)
+			return
+		}
+		order.sent(resp)
+		if held(resp) {
+			redeliveredTotal.Inc()
+			redelivered[resp.ID] = true
+			if !explicitAcks {
+				h.acknowledge(ctx, sessionID, resp.ID, true)
+			}
+		}
+		if resp.Type == "terminated" {
+			ended.Store(true)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session terminated"),
+				time.Now().Add(time.Second))
+			return
+		}
+	}
+
 	// Forward responses from Redis pub/sub to WebSocket
 	go func() {
-		ch := pubsub.Channel()
+		ch := redisconn.Channel(pubsub)
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-h.closing:
+				reapedTotal.Inc("shutdown")
+				conn.closeForShutdown()
+				return
 			case msg, ok := <-ch:
 				if !ok {
 					return
@@ -97,19 +276,64 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					log.Printf("Failed to unmarshal response: %v", err)
 					continue
 				}
-				if err := conn.WriteJSON(resp); err != nil {
-					log.Printf("Failed to write to WebSocket: %v", err)
-					cancel()
-					return
+				if ownEcho(resp, connID) {
+					continue
+				}
+				for _, resp := range h.inOrder(ctx, sessionID, &order, resp) {
+					if redelivered[resp.ID] {
+						continue
+					}
+					if err := conn.WriteJSON(resp); err != nil {
+						log.Printf("Failed to write to WebSocket: %v", err)
+						cancel()
+						return
+					}
+					order.sent(resp)
+					if held(resp) && !explicitAcks {
+						h.acknowledge(ctx, sessionID, resp.ID, false)
+					}
+					if frame, ok := h.lifecycleFor(ctx, sessionID, resp); ok {
+						conn.WriteJSON(frame)
+					}
+					if resp.Type == "terminated" {
+						ended.Store(true)
+						conn.WriteControl(websocket.CloseMessage,
+							websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session terminated"),
+							time.Now().Add(time.Second))
+						cancel()
+						conn.Close()
+						return
+					}
 				}
 			}
 		}
 	}()
 
 	// Read messages from WebSocket and publish to Redis Streams
+	allowance := h.newBucket()
 	for {
-		_, message, err := conn.ReadMessage()
+		typ, message, err := conn.ReadMessage()
 		if err != nil {
+			closeErr = err
+			select {
+			case <-h.closing:
+				// Closed by Shutdown; the client may not have replied
+				closeErr = &websocket.CloseError{Code: websocket.CloseServiceRestart}
+				return
+			default:
+			}
+			if errors.Is(err, websocket.ErrReadLimit) {
+				// The library has already closed with 1009 (message too big)
+				messagesInvalid.Inc("frame_too_large")
+				log.Printf("Closed session %s: frame over %d bytes", sessionID, h.maxFrameSize)
+				return
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// No pong within PongWait: the client is gone
+				reapedTotal.Inc("pong_timeout")
+				return
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				log.Printf("WebSocket closed unexpectedly: %v", err)
 			}
@@ -117,8 +341,26 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var incoming models.WSIncoming
-		if err := json.Unmarshal(message, &incoming); err != nil {
-			log.Printf("Invalid message format: %v", err)
+		decodeErr := json.Unmarshal(message, &incoming)
+
+		// Acks and typing indicators are sent all the time, so they don't use
+		// up the allowance; typing indicators are throttled on their own
+		var limited *RateLimitError
+		signal := decodeErr == nil && (incoming.Ack != "" || incoming.Type == "typing")
+		if typ != websocket.TextMessage || !signal {
+			if err := h.allowConnMessage(allowance); errors.As(err, &limited) {
+				conn.WriteJSON(rateLimitedFrame(limited))
+				continue
+			}
+		}
+		if typ == websocket.BinaryMessage {
+			// A binary frame is a file upload, referenced by a later message
+			conn.WriteJSON(h.uploadFrame(ctx, sessionID, message))
+			continue
+		}
+
+		if decodeErr != nil {
+			log.Printf("Invalid message format: %v", decodeErr)
 			conn.WriteJSON(models.WSResponse{
 				Type: "error",
 				Text: "Invalid message format. Send JSON with a 'text' field.",
@@ -126,30 +368,232 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		if incoming.Text == "" {
+		if incoming.Replay != "" {
+			// Asked for again after a gap in seq; the client drops what it has
+			if _, _, ok := parseStreamID(incoming.Replay); !ok {
+				conn.WriteJSON(models.WSResponse{Type: "error", Text: "replay must be a resume_token."})
+				continue
+			}
+			for _, resp := range h.resumeFrames(ctx, sessionID, incoming.Replay, false, false) {
+				conn.WriteJSON(resp)
+			}
 			continue
 		}
 
-		// Normalize to envelope
-		envelope := adapters.NormalizeWebMessage(sessionID, incoming.Text)
-		envelopeJSON, err := json.Marshal(envelope)
-		if err != nil {
-			log.Printf("Failed to marshal envelope: %v", err)
-			continue
+		if err := h.submit(ctx, sessionID, connID, user, incoming, client); err != nil {
+			if errors.As(err, &limited) {
+				conn.WriteJSON(rateLimitedFrame(limited))
+				continue
+			}
+			var bad *ValidationError
+			if errors.As(err, &bad) {
+				conn.WriteJSON(models.WSResponse{Type: "error", Text: bad.Text})
+				continue
+			}
+			if errors.Is(err, errPublish) {
+				log.Printf("Failed to publish to stream: %v", err)
+				conn.WriteJSON(models.WSResponse{
+					Type: "error",
+					Text: "Sorry, I'm having trouble processing your message. Please try again.",
+				})
+				continue
+			}
+			log.Printf("Rejected attachment for session %s: %v", sessionID, err)
+			conn.WriteJSON(models.WSResponse{Type: "error", Text: attachmentError(err)})
 		}
+	}
+}
 
-		// Publish to Redis Streams
-		if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
-			Stream: streamKey,
-			Values: map[string]interface{}{
-				"envelope": string(envelopeJSON),
-			},
-		}).Err(); err != nil {
-			log.Printf("Failed to publish to stream: %v", err)
-			conn.WriteJSON(models.WSResponse{
-				Type: "error",
-				Text: "Sorry, I'm having trouble processing your message. Please try again.",
-			})
+// errPublish wraps failures to reach msg:inbound, as opposed to a rejected
+// attachment.
+var errPublish = errors.New("failed to publish message")
+
+// submit publishes one client message, from a WebSocket frame or an SSE
+// companion POST, on msg:inbound. connID is the connection it came from, if
+// known, and user the authenticated user, or "" for a guest.
+func (h *WSHandler) submit(ctx context.Context, sessionID, connID, user string, incoming models.WSIncoming, client adapters.ClientInfo) error {
+	if err := validateIncoming(&incoming); err != nil {
+		return err
+	}
+	if incoming.Ack != "" {
+		// An ack frame carries nothing else
+		h.acknowledge(ctx, sessionID, incoming.Ack, true)
+		return nil
+	}
+	if incoming.Type == "typing" {
+		h.publishTyping(ctx, sessionID, user)
+		return nil
+	}
+	if err := h.allowSessionMessage(ctx, sessionID); err != nil {
+		return err
+	}
+	if incoming.Feedback != nil {
+		publishFeedback(ctx, h.rdb, sessionID, incoming.Feedback)
+		return nil
+	}
+	if incoming.Report != nil {
+		h.publishReport(ctx, sessionID, incoming.Report)
+		return nil
+	}
+	if incoming.Type == "edit" || incoming.Type == "delete" {
+		// The orchestrator tells every connection, so there is no echo
+		text := incoming.Text
+		if incoming.Type == "delete" {
+			text = ""
+		}
+		envelope := adapters.NormalizeWebMessage(sessionID, text, client)
+		envelope.UserID = webUserID(user)
+		envelope.Content.Type = incoming.Type
+		envelope.Edits = incoming.MessageID
+		return h.publish(ctx, envelope)
+	}
+	if incoming.MergeSession != "" && incoming.MergeSession != sessionID {
+		if !h.claimSession(ctx, incoming.MergeSession, user, incoming.MergeKey) {
+			log.Printf("Refused to merge session %s into %s: it belongs to another user", incoming.MergeSession, sessionID)
+			return nil
+		}
+		envelope := adapters.NormalizeWebMessage(sessionID, "", client)
+		envelope.UserID = webUserID(user)
+		envelope.Content.Type = "merge"
+		envelope.MergeFrom = incoming.MergeSession
+		return h.publish(ctx, envelope)
+	}
+
+	if incoming.Text == "" && incoming.Attachment == nil && len(incoming.Attachments) == 0 {
+		return nil
+	}
+
+	var atts []models.Attachment
+	if incoming.Attachment != nil {
+		att, err := h.attachments.Save(ctx, sessionID, incoming.Attachment)
+		if err != nil {
+			return err
+		}
+		atts = append(atts, att)
+	}
+	for _, id := range incoming.Attachments {
+		att, err := h.attachments.Lookup(ctx, sessionID, id)
+		if err != nil {
+			return err
 		}
+		atts = append(atts, att)
+	}
+
+	// Normalize to envelope
+	envelope := adapters.NormalizeWebMessage(sessionID, incoming.Text, client)
+	envelope.UserID = webUserID(user)
+	envelope.ResponseSchema = incoming.ResponseSchema
+	envelope.PageContext = adapters.SanitizePageContext(incoming.PageContext)
+	envelope.Attachments = atts
+	if envelope.Content.Text == "" {
+		envelope.Content = sharedContent(atts)
+	}
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return nil
+	}
+	if err := h.publish(ctx, envelope); err != nil {
+		return err
+	}
+	if envelope.Command == "" {
+		h.echo(ctx, envelope, incoming.Text, connID)
+	}
+	return nil
+}
+
+func (h *WSHandler) publish(ctx context.Context, envelope models.MessageEnvelope) error {
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPublish, err)
+	}
+
+	// Publish to Redis Streams
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{
+			"envelope": string(envelopeJSON),
+		},
+	}).Err(); err != nil {
+		return fmt.Errorf("%w: %v", errPublish, err)
+	}
+	return nil
+}
+
+// publishFeedback forwards a rating to the orchestrator, where thumbs-down
+// answers feed the knowledge gap report.
+func publishFeedback(ctx context.Context, rdb *redis.Client, sessionID string, fb *models.WSFeedback) {
+	if fb.MessageID == "" || (fb.Rating != "up" && fb.Rating != "down") {
+		return
+	}
+	if err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: feedbackStream,
+		MaxLen: 100000,
+		Approx: true,
+		Values: map[string]interface{}{
+			"session_id": sessionID,
+			"message_id": fb.MessageID,
+			"rating":     fb.Rating,
+			"tenant_id":  adapters.Tenant,
+		},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish feedback: %v", err)
+	}
+}
+
+// publishReport forwards a user's report on an answer to the orchestrator,
+// which stores it with the conversation and alerts operators.
+func (h *WSHandler) publishReport(ctx context.Context, sessionID string, rep *models.WSReport) {
+	if rep.MessageID == "" {
+		return
+	}
+	// The orchestrator keeps less than this; it only bounds the stream entry
+	const maxComment = 4 << 10
+	comment := rep.Comment
+	if len(comment) > maxComment {
+		comment = strings.ToValidUTF8(comment[:maxComment], "")
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: reportsStream,
+		MaxLen: 100000,
+		Approx: true,
+		Values: map[string]interface{}{
+			"session_id": sessionID,
+			"message_id": rep.MessageID,
+			"reason":     rep.Reason,
+			"comment":    comment,
+			"channel":    "web",
+			"tenant_id":  adapters.Tenant,
+		},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish report: %v", err)
+	}
+}
+
+// sharedContent stands in for the text of a message that only carries
+// attachments.
+func sharedContent(atts []models.Attachment) models.MessageContent {
+	if len(atts) > 0 && atts[0].Kind == models.AttachmentDocument {
+		return models.MessageContent{Type: "file", Text: "(shared a file)"}
+	}
+	if len(atts) > 0 && atts[0].Kind == models.AttachmentImage {
+		return models.MessageContent{Type: "image", Text: "(shared an image)"}
+	}
+	return models.MessageContent{Type: "image", Text: "(shared a screenshot)"}
+}
+
+func attachmentError(err error) string {
+	switch {
+	case errors.Is(err, attachments.ErrNoConsent):
+		return "Please confirm you want to share the screenshot."
+	case errors.Is(err, attachments.ErrTooLarge):
+		return "That file is too large. Please try a smaller one."
+	case errors.Is(err, attachments.ErrUnsupported):
+		return "Only images (PNG, JPEG, WebP or GIF), PDFs and plain text files can be attached."
+	case errors.Is(err, attachments.ErrMismatch), errors.Is(err, attachments.ErrInfected):
+		return "That file was blocked by our security checks and wasn't shared."
+	case errors.Is(err, attachments.ErrScanFailed):
+		return "We couldn't check that file right now. Please try again in a moment."
+	case errors.Is(err, attachments.ErrNotFound):
+		return "That upload has expired or doesn't belong to this conversation. Please upload it again."
 	}
+	return "Sorry, the file couldn't be attached. Please try again."
 }
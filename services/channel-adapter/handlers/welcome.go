@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+)
+
+// Written by the orchestrator's session manager: the topic the
+// conversation is on, whose "opening" is its first question; keep the
+// field layout in sync.
+const (
+	sessionPrefix  = "session:"
+	segmentsSuffix = ":segments"
+)
+
+// DefaultWelcomeBack is the welcome_back text; {topic} is replaced with
+// what the conversation was about.
+const DefaultWelcomeBack = "Welcome back! We were talking about “{topic}”. Ask me anything to carry on."
+
+var welcomeBacksTotal = metrics.NewCounterVec("channel_adapter_welcome_backs_total",
+	"Welcome-back frames sent to users returning to a web session.")
+
+// EnableWelcomeBack greets users who return to a session after being away
+// for at least after with text, a reminder of what they were discussing.
+func (h *WSHandler) EnableWelcomeBack(after time.Duration, text string) {
+	h.welcomeAfter, h.welcomeText = after, text
+}
+
+// returning reports whether a resumed session already has a conversation,
+// so the widget skips its greeting, and returns the welcome_back frame to
+// send when the user was away long enough.
+func (h *WSHandler) returning(ctx context.Context, sessionID string) (bool, *models.WSResponse) {
+	meta, err := h.rdb.HGetAll(ctx, transcriptMetaPrefix+sessionID).Result()
+	if err != nil {
+		log.Printf("Failed to load conversation of session %s: %v", sessionID, err)
+		return false, nil
+	}
+	if turns, _ := strconv.Atoi(meta["turns"]); turns == 0 {
+		return false, nil
+	}
+	if h.welcomeAfter <= 0 {
+		return true, nil
+	}
+	last, _ := strconv.ParseInt(meta["last_active"], 10, 64)
+	if time.Since(time.Unix(last, 0)) < h.welcomeAfter {
+		return true, nil
+	}
+	// The current topic is more telling than the conversation's first
+	// question
+	topic := meta["title"]
+	if data, err := h.rdb.Get(ctx, sessionPrefix+sessionID+segmentsSuffix).Bytes(); err == nil {
+		var seg struct {
+			Opening string `json:"opening"`
+		}
+		if json.Unmarshal(data, &seg) == nil && seg.Opening != "" {
+			topic = seg.Opening
+		}
+	} else if err != redis.Nil {
+		log.Printf("Failed to load topic of session %s: %v", sessionID, err)
+	}
+	if topic == "" {
+		return true, nil
+	}
+	welcomeBacksTotal.Inc()
+	return true, &models.WSResponse{
+		Type:      "welcome_back",
+		SessionID: sessionID,
+		Text:      strings.ReplaceAll(h.welcomeText, "{topic}", topic),
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/httperr"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+	"channel-adapter/whatsapp"
+)
+
+const (
+	// Meta redelivers webhooks it considers failed, so inbound message IDs
+	// are remembered for a day to drop duplicates
+	whatsappSeenPrefix  = "whatsapp:seen:"
+	whatsappSeenTTL     = 24 * time.Hour
+	whatsappClaimPrefix = "whatsapp:claim:"
+	whatsappClaimTTL    = time.Hour
+	// Status webhooks refer to WhatsApp message IDs; this maps them back to
+	// the orchestrator's response ID for receipts
+	whatsappSentPrefix = "whatsapp:sent:"
+	whatsappSentTTL    = 7 * 24 * time.Hour
+
+	// Sends in flight at once, across chats
+	whatsappSenders = 8
+	maxWhatsAppBody = 1 << 20
+)
+
+// WhatsAppHandler receives Cloud API webhooks and publishes messages on
+// msg:inbound. Unlike a WebSocket there is no connection to write replies
+// to, so Deliver queues them per chat and sends them through the Graph API,
+// reporting the outcome as delivery receipts.
+type WhatsAppHandler struct {
+	rdb         *redis.Client
+	client      *whatsapp.Client
+	appSecret   string
+	verifyToken string
+}
+
+func NewWhatsAppHandler(rdb *redis.Client, client *whatsapp.Client, appSecret, verifyToken string) *WhatsAppHandler {
+	return &WhatsAppHandler{
+		rdb:         rdb,
+		client:      client,
+		appSecret:   appSecret,
+		verifyToken: verifyToken,
+	}
+}
+
+// ServeHTTP answers Meta's subscription handshake (GET) and webhook
+// notifications (POST).
+func (h *WhatsAppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		h.verify(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWhatsAppBody))
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if !whatsapp.VerifySignature(h.appSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		httperr.Write(w, r, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	var hook whatsapp.Webhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid webhook")
+		return
+	}
+	for _, entry := range hook.Entry {
+		for _, change := range entry.Changes {
+			if err := h.handleValue(r.Context(), change.Value); err != nil {
+				log.Printf("Failed to accept WhatsApp webhook: %v", err)
+				httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to accept webhook", 5*time.Second)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *WhatsAppHandler) verify(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := []byte(q.Get("hub.verify_token"))
+	if q.Get("hub.mode") != "subscribe" || subtle.ConstantTimeCompare(token, []byte(h.verifyToken)) != 1 {
+		httperr.Write(w, r, http.StatusForbidden, "verification failed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+// Receive serves the webhook.
+func (h *WhatsAppHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	mux.Handle("/whatsapp/webhook", h)
+	return nil
+}
+
+// Normalize takes a webhook notification body.
+func (h *WhatsAppHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	var hook whatsapp.Webhook
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return nil, fmt.Errorf("invalid webhook: %w", err)
+	}
+	var out []models.MessageEnvelope
+	for _, entry := range hook.Entry {
+		for _, change := range entry.Changes {
+			for _, msg := range change.Value.Messages {
+				if envelope, ok := whatsappEnvelope(change.Value, msg); ok {
+					out = append(out, envelope)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func whatsappEnvelope(v whatsapp.Value, msg whatsapp.Message) (models.MessageEnvelope, bool) {
+	var contact *whatsapp.Contact
+	for i := range v.Contacts {
+		if v.Contacts[i].WaID == msg.From {
+			contact = &v.Contacts[i]
+		}
+	}
+	return adapters.NormalizeWhatsAppMessage(msg, contact, v.Metadata.PhoneNumberID)
+}
+
+func (h *WhatsAppHandler) handleValue(ctx context.Context, v whatsapp.Value) error {
+	for _, msg := range v.Messages {
+		envelope, ok := whatsappEnvelope(v, msg)
+		if !ok {
+			continue
+		}
+		fresh, err := h.rdb.SetNX(ctx, whatsappSeenPrefix+msg.ID, 1, whatsappSeenTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			continue
+		}
+		if slashCommand(ctx, h.rdb, &envelope) {
+			continue
+		}
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		err = h.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: streamKey,
+			Values: map[string]interface{}{"envelope": string(data)},
+		}).Err()
+		if err != nil {
+			// Let Meta's redelivery through
+			h.rdb.Del(ctx, whatsappSeenPrefix+msg.ID)
+			return err
+		}
+		go func(id string) {
+			if err := h.client.MarkRead(context.WithoutCancel(ctx), id); err != nil {
+				log.Printf("Failed to mark WhatsApp message read: %v", err)
+			}
+		}(msg.ID)
+	}
+	for _, st := range v.Statuses {
+		h.handleStatus(ctx, st)
+	}
+	return nil
+}
+
+// handleStatus turns Meta's asynchronous delivery statuses into receipts.
+func (h *WhatsAppHandler) handleStatus(ctx context.Context, st whatsapp.Status) {
+	var status string
+	code, desc := 0, ""
+	switch st.Status {
+	case "delivered":
+		status = receipts.StatusDelivered
+	case "failed":
+		status = receipts.StatusFailed
+		if len(st.Errors) > 0 {
+			code, desc = st.Errors[0].Code, st.Errors[0].Title
+		}
+	default:
+		return
+	}
+	id, err := h.rdb.Get(ctx, whatsappSentPrefix+st.ID).Result()
+	if err != nil {
+		return
+	}
+	if err := receipts.Report(ctx, h.rdb, id, status, "whatsapp", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// Deliver sends orchestrator responses for WhatsApp sessions, in order per
+// chat, until ctx is done.
+func (h *WhatsAppHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.WhatsAppSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(whatsappSenders)
+	for msg := range redisconn.Channel(pubsub) {
+		to, ok := adapters.WhatsAppRecipient(strings.TrimPrefix(msg.Channel, "response:"))
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		// WhatsApp has no typing indicator for business messages
+		switch resp.Type {
+		case "message", "notice", "error", "terminated":
+		default:
+			continue
+		}
+		if resp.Text == "" {
+			continue
+		}
+		if !sends.push(to, func() { h.send(ctx, to, resp) }) {
+			log.Printf("WhatsApp send queue full, dropping response %s", resp.ID)
+			if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "whatsapp", 0, "adapter send queue full"); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}
+}
+
+func (h *WhatsAppHandler) send(ctx context.Context, to string, resp models.WSResponse) {
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, whatsappClaimPrefix+resp.ID, 1, whatsappClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	ids, err := h.client.SendText(ctx, to, adapters.PlainText(resp))
+	if resp.ID != "" {
+		for _, wamid := range ids {
+			h.rdb.Set(ctx, whatsappSentPrefix+wamid, resp.ID, whatsappSentTTL)
+		}
+	}
+	if err == nil {
+		// Delivery is confirmed later by a status webhook
+		return
+	}
+
+	log.Printf("WhatsApp send failed for response %s: %v", resp.ID, err)
+	// Release the claim so the orchestrator's retry can be sent
+	if resp.ID != "" {
+		h.rdb.Del(ctx, whatsappClaimPrefix+resp.ID)
+	}
+	code, desc := 0, err.Error()
+	var apiErr *whatsapp.APIError
+	if errors.As(err, &apiErr) {
+		code, desc = apiErr.Code, apiErr.Message
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "whatsapp", code, desc); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/httperr"
+)
+
+// widgetConfigsKey is written by the orchestrator admin API.
+const widgetConfigsKey = "widget:configs"
+
+// WidgetConfig is the public part of a site's widget setup; who edited it
+// stays in the admin API.
+type WidgetConfig struct {
+	Colors struct {
+		Primary    string `json:"primary,omitempty"`
+		Background string `json:"background,omitempty"`
+		Text       string `json:"text,omitempty"`
+	} `json:"colors"`
+	LogoURL  string          `json:"logo_url,omitempty"`
+	Greeting string          `json:"greeting,omitempty"`
+	Position string          `json:"position,omitempty"`
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+// WidgetConfigHandler serves GET /widget/config?key=SITE_KEY to the
+// embedded widget. Site keys are public, so any origin may read them.
+type WidgetConfigHandler struct {
+	rdb *redis.Client
+}
+
+func NewWidgetConfigHandler(rdb *redis.Client) *WidgetConfigHandler {
+	return &WidgetConfigHandler{rdb: rdb}
+}
+
+func (h *WidgetConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = r.Header.Get("X-Site-Key")
+	}
+	if key == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "key is required")
+		return
+	}
+
+	data, err := h.rdb.HGet(r.Context(), widgetConfigsKey, key).Bytes()
+	if err == redis.Nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown site key")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load widget config: %v", err)
+		httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "failed to load widget config", 5*time.Second)
+		return
+	}
+	var cfg WidgetConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		log.Printf("Invalid widget config for %s: %v", key, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "invalid widget config")
+		return
+	}
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "invalid widget config")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	// Branding changes show up within a minute without every page view
+	// reaching Redis
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
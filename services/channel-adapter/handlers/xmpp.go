@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/adapters"
+	"channel-adapter/models"
+	"channel-adapter/receipts"
+	"channel-adapter/redisconn"
+	"channel-adapter/xmpp"
+)
+
+const (
+	xmppClaimPrefix = "xmpp:claim:"
+	xmppClaimTTL    = time.Hour
+)
+
+// XMPPHandler publishes chat messages sent to the bot's JID on msg:inbound
+// and replies to the client the user last wrote from.
+type XMPPHandler struct {
+	rdb    *redis.Client
+	client *xmpp.Client
+
+	mu sync.Mutex
+	// Full JID each session last wrote from
+	resources map[string]string
+}
+
+func NewXMPPHandler(rdb *redis.Client, cfg xmpp.Config) (*XMPPHandler, error) {
+	h := &XMPPHandler{rdb: rdb, resources: make(map[string]string)}
+	client, err := xmpp.NewClient(cfg, h.handleMessage)
+	if err != nil {
+		return nil, err
+	}
+	h.client = client
+	return h, nil
+}
+
+// Run holds the XMPP stream until ctx is done.
+func (h *XMPPHandler) Run(ctx context.Context) {
+	h.client.Run(ctx)
+}
+
+// Receive connects to the server.
+func (h *XMPPHandler) Receive(ctx context.Context, mux *http.ServeMux) error {
+	go h.Run(ctx)
+	return nil
+}
+
+// Normalize takes one <message/> stanza.
+func (h *XMPPHandler) Normalize(ctx context.Context, payload []byte) ([]models.MessageEnvelope, error) {
+	msg, ok, err := xmpp.ParseMessage(payload, h.client.JID())
+	if err != nil || !ok {
+		return nil, err
+	}
+	if envelope, ok := adapters.NormalizeXMPPMessage(msg); ok {
+		return []models.MessageEnvelope{envelope}, nil
+	}
+	return nil, nil
+}
+
+func (h *XMPPHandler) handleMessage(ctx context.Context, msg xmpp.Message) {
+	envelope, ok := adapters.NormalizeXMPPMessage(msg)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.resources[envelope.SessionID] = msg.From
+	h.mu.Unlock()
+
+	if slashCommand(ctx, h.rdb, &envelope) {
+		return
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to marshal envelope: %v", err)
+		return
+	}
+	if err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish XMPP message from %s: %v", xmpp.Bare(msg.From), err)
+		h.client.Send(msg.From, "Sorry, I'm having trouble processing your message. Please try again.")
+	}
+}
+
+// Deliver forwards orchestrator responses for XMPP sessions until ctx is
+// done.
+func (h *XMPPHandler) Deliver(ctx context.Context) {
+	pubsub := subscribeResponses(ctx, h.rdb, adapters.XMPPSessionPrefix)
+	defer pubsub.Close()
+	sends := newSendQueue(0)
+	for msg := range redisconn.Channel(pubsub) {
+		sessionID := strings.TrimPrefix(msg.Channel, "response:")
+		jid, ok := adapters.XMPPJIDFromSession(sessionID)
+		if !ok {
+			continue
+		}
+		var resp models.WSResponse
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			log.Printf("Failed to unmarshal response: %v", err)
+			continue
+		}
+		resp = adapters.AsNotice(resp)
+		if !sends.push(msg.Channel, func() { h.send(ctx, sessionID, jid, resp) }) {
+			log.Printf("XMPP send queue full, dropping response %s", resp.ID)
+		}
+	}
+}
+
+func (h *XMPPHandler) send(ctx context.Context, sessionID, jid string, resp models.WSResponse) {
+	switch resp.Type {
+	case "message", "notice", "error", "terminated":
+	default:
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+	if resp.ID != "" {
+		claimed, err := h.rdb.SetNX(ctx, xmppClaimPrefix+resp.ID, 1, xmppClaimTTL).Result()
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	// Only the replica that saw the message knows the user's resource; the
+	// bare JID reaches whichever client the server prefers
+	h.mu.Lock()
+	if full, ok := h.resources[sessionID]; ok {
+		jid = full
+	}
+	h.mu.Unlock()
+	if err := h.client.Send(jid, adapters.PlainText(resp)); err != nil {
+		log.Printf("XMPP send to %s failed: %v", xmpp.Bare(jid), err)
+		if resp.ID != "" {
+			h.rdb.Del(ctx, xmppClaimPrefix+resp.ID)
+		}
+		if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusFailed, "xmpp", 0, err.Error()); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
+	if err := receipts.Report(ctx, h.rdb, resp.ID, receipts.StatusDelivered, "xmpp", 0, ""); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package hostevents tells the site hosting the web widget when a
+// conversation starts, ends or is handed off to a person, so site owners can
+// run their own flows (an NPS survey, a ticket form). Events are signed and
+// delivered two ways: as a lifecycle frame the widget forwards to the host
+// page with postMessage, and as a webhook to the site's backend.
+package hostevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+)
+
+const (
+	Started = "conversation.started"
+	Ended   = "conversation.ended"
+	Handoff = "conversation.handoff"
+
+	// SignatureHeader carries "t=<unix>,v1=<hex HMAC-SHA256 of t.payload>"
+	SignatureHeader = "X-Maya-Signature"
+
+	// Sessions disconnected longer than the reconnect window have ended;
+	// replicas claim them from this set with ZREM so each fires once
+	disconnectedKey = "web:disconnected"
+
+	// A frame relayed to several connections of a session fires one webhook
+	oncePrefix = "web:hostevent:"
+	onceTTL    = time.Minute
+
+	queueSize    = 1000
+	maxAttempts  = 3
+	sweepEvery   = 30 * time.Second
+	sweepBatch   = 100
+	deliveryWait = 10 * time.Second
+)
+
+var webhooksTotal = metrics.NewCounterVec("channel_adapter_host_webhooks_total",
+	"Lifecycle webhooks to the hosting site by event and outcome.", "event", "outcome")
+
+// Event is the signed payload. Reason says why a conversation ended
+// (terminated or idle) or was handed off.
+type Event struct {
+	Type       string    `json:"type"`
+	SessionID  string    `json:"session_id"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Signed is what the widget posts to the host page. The host verifies
+// Signature over Payload on its backend before trusting it.
+type Signed struct {
+	Event     string `json:"event"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type Notifier struct {
+	rdb        *redis.Client
+	url        string
+	secret     []byte
+	idleAfter  time.Duration
+	queue      chan Event
+	httpClient *http.Client
+}
+
+// NewNotifier signs events with secret and, when webhookURL is set, posts them
+// there. Disconnected sessions count as ended after idleAfter.
+func NewNotifier(rdb *redis.Client, webhookURL, secret string, idleAfter time.Duration) *Notifier {
+	return &Notifier{
+		rdb:        rdb,
+		url:        webhookURL,
+		secret:     []byte(secret),
+		idleAfter:  idleAfter,
+		queue:      make(chan Event, queueSize),
+		httpClient: &http.Client{Timeout: deliveryWait},
+	}
+}
+
+// Sign returns the payload and its signature for ev.
+func (n *Notifier) Sign(ev Event) (Signed, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return Signed{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return Signed{Event: ev.Type, Payload: string(payload), Signature: n.signature(payload, time.Now())}, nil
+}
+
+func (n *Notifier) signature(payload []byte, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify signs ev and queues its webhook. It returns the signed event for
+// the widget, or false if n is nil.
+func (n *Notifier) Notify(ev Event) (Signed, bool) {
+	if n == nil {
+		return Signed{}, false
+	}
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = time.Now().UTC()
+	}
+	signed, err := n.Sign(ev)
+	if err != nil {
+		log.Printf("Failed to sign %s event: %v", ev.Type, err)
+		return Signed{}, false
+	}
+	if n.url != "" {
+		select {
+		case n.queue <- ev:
+		default:
+			webhooksTotal.Inc(ev.Type, "dropped")
+		}
+	}
+	return signed, true
+}
+
+// NotifyOnce is Notify for an event that several connections of a session
+// see, such as a handoff shown in two tabs: each gets the signed event for
+// its host page, but only the first with key queues the webhook.
+func (n *Notifier) NotifyOnce(ctx context.Context, ev Event, key string) (Signed, bool) {
+	if n == nil {
+		return Signed{}, false
+	}
+	if key != "" {
+		first, err := n.rdb.SetNX(ctx, oncePrefix+ev.SessionID+":"+key, 1, onceTTL).Result()
+		if err == nil && !first {
+			if ev.OccurredAt.IsZero() {
+				ev.OccurredAt = time.Now().UTC()
+			}
+			signed, err := n.Sign(ev)
+			if err != nil {
+				log.Printf("Failed to sign %s event: %v", ev.Type, err)
+				return Signed{}, false
+			}
+			return signed, true
+		}
+	}
+	return n.Notify(ev)
+}
+
+// Connected and Disconnected track when a web session may have ended.
+func (n *Notifier) Connected(ctx context.Context, sessionID string) {
+	if n == nil {
+		return
+	}
+	n.rdb.ZRem(ctx, disconnectedKey, sessionID)
+}
+
+func (n *Notifier) Disconnected(ctx context.Context, sessionID string) {
+	if n == nil {
+		return
+	}
+	n.rdb.ZAdd(ctx, disconnectedKey, redis.Z{Score: float64(time.Now().Unix()), Member: sessionID})
+}
+
+// Run delivers webhooks and fires ended events for sessions that did not
+// reconnect in time, until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	sweep := time.NewTicker(sweepEvery)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-n.queue:
+			n.deliver(ctx, ev)
+		case <-sweep.C:
+			n.sweep(ctx)
+		}
+	}
+}
+
+func (n *Notifier) sweep(ctx context.Context) {
+	cutoff := time.Now().Add(-n.idleAfter).Unix()
+	ids, err := n.rdb.ZRangeByScore(ctx, disconnectedKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(cutoff, 10),
+		Count: sweepBatch,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to scan disconnected sessions: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if claimed, err := n.rdb.ZRem(ctx, disconnectedKey, id).Result(); err != nil || claimed == 0 {
+			continue
+		}
+		n.Notify(Event{Type: Ended, SessionID: id, Reason: "idle"})
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, ev Event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	backoff := time.Second
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = n.post(ctx, payload)
+		if err == nil {
+			webhooksTotal.Inc(ev.Type, "delivered")
+			return
+		}
+		if attempt < maxAttempts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+	webhooksTotal.Inc(ev.Type, "failed")
+	log.Printf("Failed to deliver %s webhook for session %s: %v", ev.Type, ev.SessionID, err)
+}
+
+func (n *Notifier) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Signed at send time so retries carry a fresh timestamp
+	req.Header.Set(SignatureHeader, n.signature(payload, time.Now()))
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
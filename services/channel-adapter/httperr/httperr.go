@@ -0,0 +1,103 @@
+// Package httperr gives every HTTP endpoint the same error body:
+//
+//	{"code": "invalid_request", "message": "...", "correlation_id": "...", "retry_after": 5}
+//
+// The correlation ID is taken from the X-Correlation-ID or X-Request-ID
+// request header, or generated, and echoed in the X-Correlation-ID response
+// header so callers can quote it when reporting a problem.
+package httperr
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const header = "X-Correlation-ID"
+
+type ctxKey struct{}
+
+type Body struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	CorrelationID string `json:"correlation_id"`
+	// RetryAfter is in seconds, mirroring the Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// WithCorrelationID assigns each request a correlation ID.
+func WithCorrelationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if id == "" {
+			id = r.Header.Get("X-Request-ID")
+		}
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		w.Header().Set(header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, id)))
+	})
+}
+
+// CorrelationID returns the request's correlation ID, for logging.
+func CorrelationID(r *http.Request) string {
+	if id, ok := r.Context().Value(ctxKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Write sends an error with a code derived from status.
+func Write(w http.ResponseWriter, r *http.Request, status int, message string) {
+	WriteCode(w, r, status, codeFor(status), message)
+}
+
+func WriteCode(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	write(w, status, Body{Code: code, Message: message, CorrelationID: CorrelationID(r)})
+}
+
+// WriteRetry tells the caller when to try again, for 429 and 503 responses.
+func WriteRetry(w http.ResponseWriter, r *http.Request, status int, message string, after time.Duration) {
+	secs := int(math.Ceil(after.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	write(w, status, Body{Code: codeFor(status), Message: message, CorrelationID: CorrelationID(r), RetryAfter: secs})
+}
+
+func write(w http.ResponseWriter, status int, b Body) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(b)
+}
+
+func codeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	if status >= 500 {
+		return "internal"
+	}
+	return "error"
+}
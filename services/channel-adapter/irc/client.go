@@ -0,0 +1,353 @@
+// Package irc is a minimal IRC client for the bot: it keeps one connection
+// to a network, joins configured channels and passes on every PRIVMSG.
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Lines are at most 512 bytes with CRLF; leave room for the prefix the
+	// server adds when relaying our messages
+	MaxText = 400
+
+	dialTimeout = 15 * time.Second
+	// Servers ping every few minutes; a connection silent for longer is dead
+	readTimeout = 5 * time.Minute
+	// RFC 1459 flood control: each line costs two seconds, and a client may
+	// run at most ten seconds ahead before the server drops it
+	linePenalty = 2 * time.Second
+	maxPenalty  = 10 * time.Second
+)
+
+// Message is a PRIVMSG. Target is a channel, or our own nick for a direct
+// message.
+type Message struct {
+	Nick   string
+	Target string
+	Text   string
+}
+
+// Private reports whether the message was sent directly to the bot.
+func (m Message) Private() bool {
+	return !strings.HasPrefix(m.Target, "#") && !strings.HasPrefix(m.Target, "&")
+}
+
+type Config struct {
+	Addr     string
+	TLS      bool
+	Nick     string
+	Channels []string
+	// Password identifies the nick with NickServ once connected.
+	Password string
+}
+
+// Client keeps a connection open, reconnecting with backoff after drops.
+type Client struct {
+	cfg       Config
+	onMessage func(context.Context, Message)
+
+	mu      sync.Mutex
+	conn    net.Conn
+	nick    string
+	next    time.Time
+	writeMu sync.Mutex
+}
+
+func NewClient(cfg Config, onMessage func(context.Context, Message)) *Client {
+	return &Client{cfg: cfg, onMessage: onMessage, nick: cfg.Nick}
+}
+
+// Nick is the bot's current nick, which differs from the configured one if
+// that was taken.
+func (c *Client) Nick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// Run connects and reconnects until ctx is done.
+func (c *Client) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("IRC connection to %s lost, reconnecting in %s: %v", c.cfg.Addr, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 5*time.Minute)
+	}
+}
+
+func (c *Client) session(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if c.cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.cfg.Addr, nil)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.cfg.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c.mu.Lock()
+	c.conn = conn
+	c.nick = c.cfg.Nick
+	c.next = time.Time{}
+	c.mu.Unlock()
+
+	if err := c.write("NICK " + c.cfg.Nick); err != nil {
+		return err
+	}
+	if err := c.write("USER " + c.cfg.Nick + " 0 * :Maya"); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(conn, 4096)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if err := c.handle(ctx, parseLine(strings.TrimRight(line, "\r\n"))); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) handle(ctx context.Context, l line) error {
+	switch l.command {
+	case "PING":
+		return c.write("PONG :" + l.trailing())
+	case "001":
+		if len(l.params) > 0 {
+			c.mu.Lock()
+			c.nick = l.params[0]
+			c.mu.Unlock()
+		}
+		log.Printf("IRC connected to %s as %s", c.cfg.Addr, c.Nick())
+		if c.cfg.Password != "" {
+			c.write("PRIVMSG NickServ :IDENTIFY " + c.cfg.Password)
+		}
+		for _, ch := range c.cfg.Channels {
+			if err := c.write("JOIN " + ch); err != nil {
+				return err
+			}
+		}
+	case "433":
+		// Nick in use: try another until one is free
+		c.mu.Lock()
+		c.nick += "_"
+		nick := c.nick
+		c.mu.Unlock()
+		return c.write("NICK " + nick)
+	case "NICK":
+		if strings.EqualFold(l.nick(), c.Nick()) {
+			c.mu.Lock()
+			c.nick = l.trailing()
+			c.mu.Unlock()
+		}
+	case "PRIVMSG":
+		if msg, ok := privmsg(l, c.Nick()); ok {
+			go c.onMessage(ctx, msg)
+		}
+	case "ERROR":
+		return errors.New(l.trailing())
+	}
+	return nil
+}
+
+// Privmsg sends text to target, one PRIVMSG per line, split to fit.
+func (c *Client) Privmsg(ctx context.Context, target, text string) error {
+	for _, line := range Split(text, MaxText) {
+		if err := c.pace(ctx); err != nil {
+			return err
+		}
+		if err := c.write("PRIVMSG " + target + " :" + line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pace waits until the flood penalty allows another line.
+func (c *Client) pace(ctx context.Context) error {
+	c.mu.Lock()
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	c.next = c.next.Add(linePenalty)
+	wait := c.next.Sub(now) - maxPenalty
+	c.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (c *Client) write(s string) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := conn.Write([]byte(s + "\r\n"))
+	return err
+}
+
+// Split breaks text into lines of at most limit bytes, at newlines and
+// otherwise at the last space, never inside a UTF-8 sequence.
+func Split(text string, limit int) []string {
+	var out []string
+	for _, para := range strings.Split(text, "\n") {
+		para = strings.TrimSpace(para)
+		for len(para) > limit {
+			cut := strings.LastIndexByte(para[:limit+1], ' ')
+			if cut <= 0 {
+				cut = limit
+				for cut > 0 && !utf8.RuneStart(para[cut]) {
+					cut--
+				}
+			}
+			out = append(out, strings.TrimSpace(para[:cut]))
+			para = strings.TrimSpace(para[cut:])
+		}
+		if para != "" {
+			out = append(out, para)
+		}
+	}
+	return out
+}
+
+// StripFormatting removes mIRC bold, colour, italic, underline and reverse
+// codes.
+func StripFormatting(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 0x02, 0x0f, 0x11, 0x16, 0x1d, 0x1e, 0x1f:
+			continue
+		case 0x03:
+			// Colour code: up to two digits, optionally ",bg" with two more
+			j := i + 1
+			for n := 0; n < 2 && j < len(s) && isDigit(s[j]); n++ {
+				j++
+			}
+			if j < len(s) && s[j] == ',' && j+1 < len(s) && isDigit(s[j+1]) {
+				j++
+				for n := 0; n < 2 && j < len(s) && isDigit(s[j]); n++ {
+					j++
+				}
+			}
+			i = j - 1
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ParseMessage parses a raw PRIVMSG line as the bot named botNick would
+// receive it. Anything else, including the bot's own messages and CTCP
+// requests, is not a Message.
+func ParseMessage(raw, botNick string) (Message, bool) {
+	l := parseLine(raw)
+	if l.command != "PRIVMSG" {
+		return Message{}, false
+	}
+	return privmsg(l, botNick)
+}
+
+func privmsg(l line, botNick string) (Message, bool) {
+	if len(l.params) < 2 || strings.EqualFold(l.nick(), botNick) {
+		return Message{}, false
+	}
+	text := l.trailing()
+	// CTCP requests such as VERSION are not conversation
+	if strings.HasPrefix(text, "\x01") {
+		return Message{}, false
+	}
+	return Message{Nick: l.nick(), Target: l.params[0], Text: StripFormatting(text)}, true
+}
+
+// line is one parsed protocol message.
+type line struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+func parseLine(s string) line {
+	var l line
+	if strings.HasPrefix(s, "@") {
+		// IRCv3 message tags are not used
+		_, s, _ = strings.Cut(s, " ")
+	}
+	if strings.HasPrefix(s, ":") {
+		l.prefix, s, _ = strings.Cut(s[1:], " ")
+	}
+	for s != "" {
+		if strings.HasPrefix(s, ":") {
+			l.params = append(l.params, s[1:])
+			break
+		}
+		var p string
+		p, s, _ = strings.Cut(s, " ")
+		if p == "" {
+			continue
+		}
+		if l.command == "" {
+			l.command = strings.ToUpper(p)
+		} else {
+			l.params = append(l.params, p)
+		}
+	}
+	return l
+}
+
+func (l line) nick() string {
+	nick, _, _ := strings.Cut(l.prefix, "!")
+	return nick
+}
+
+func (l line) trailing() string {
+	if len(l.params) == 0 {
+		return ""
+	}
+	return l.params[len(l.params)-1]
+}
@@ -0,0 +1,176 @@
+// Package jwt verifies the bearer tokens a host site issues to its signed-in
+// users, so web sessions can be tied to a known user ID. Tokens are signed
+// with a shared secret (HS256) or with keys published as a JWKS (RS256,
+// ES256).
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Leeway absorbs clock skew between the token issuer and us.
+var Leeway = time.Minute
+
+var ErrInvalid = errors.New("invalid token")
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+type Verifier struct {
+	secret   []byte
+	keys     *KeySet
+	issuer   string
+	audience string
+}
+
+// NewVerifier accepts HS256 tokens signed with secret and RS256 or ES256
+// tokens signed with a key from the JWKS at jwksURL; either may be empty.
+// When issuer or audience are set, tokens must carry them.
+func NewVerifier(secret, jwksURL, issuer, audience string) *Verifier {
+	v := &Verifier{issuer: issuer, audience: audience}
+	if secret != "" {
+		v.secret = []byte(secret)
+	}
+	if jwksURL != "" {
+		v.keys = NewKeySet(jwksURL)
+	}
+	return v
+}
+
+// Verify checks token's signature and claims and returns its subject.
+func (v *Verifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed signature", ErrInvalid)
+	}
+	if err := v.verifySignature(ctx, h, parts[0]+"."+parts[1], sig); err != nil {
+		return "", err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if c.ExpiresAt == nil {
+		return "", fmt.Errorf("%w: no expiry", ErrInvalid)
+	}
+	if now.After(unix(*c.ExpiresAt).Add(Leeway)) {
+		return "", fmt.Errorf("%w: expired", ErrInvalid)
+	}
+	if c.NotBefore != nil && now.Add(Leeway).Before(unix(*c.NotBefore)) {
+		return "", fmt.Errorf("%w: not valid yet", ErrInvalid)
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return "", fmt.Errorf("%w: wrong issuer", ErrInvalid)
+	}
+	if v.audience != "" && !hasAudience(c.Audience, v.audience) {
+		return "", fmt.Errorf("%w: wrong audience", ErrInvalid)
+	}
+	if c.Subject == "" {
+		return "", fmt.Errorf("%w: no subject", ErrInvalid)
+	}
+	return c.Subject, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, signed string, sig []byte) error {
+	sum := sha256.Sum256([]byte(signed))
+	switch h.Alg {
+	case "HS256":
+		if v.secret == nil {
+			break
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return fmt.Errorf("%w: bad signature", ErrInvalid)
+		}
+		return nil
+	case "RS256", "ES256":
+		if v.keys == nil {
+			break
+		}
+		key, err := v.keys.Key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if h.Alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// JWS carries the raw r || s, not ASN.1
+			if h.Alg == "ES256" && len(sig) == 64 {
+				r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+				if ecdsa.Verify(key, sum[:], r, s) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+	return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalid, h.Alg)
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	return nil
+}
+
+// hasAudience handles aud as either a string or an array of strings.
+func hasAudience(raw json.RawMessage, want string) bool {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return one == want
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, a := range many {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unix(sec float64) time.Time {
+	return time.Unix(int64(sec), 0)
+}
@@ -1,16 +1,49 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 
+	"channel-adapter/adapters"
+	"channel-adapter/apikeys"
+	"channel-adapter/attachments"
+	"channel-adapter/audit"
+	"channel-adapter/blobstore"
+	"channel-adapter/channels"
+	"channel-adapter/discord"
+	"channel-adapter/email"
+	"channel-adapter/gbm"
 	"channel-adapter/handlers"
+	"channel-adapter/hostevents"
+	"channel-adapter/httperr"
+	"channel-adapter/irc"
+	"channel-adapter/jwt"
+	"channel-adapter/metrics"
+	chatv1 "channel-adapter/proto/chat/v1"
+	"channel-adapter/realip"
+	"channel-adapter/redisconn"
+	"channel-adapter/status"
+	"channel-adapter/telegram"
+	"channel-adapter/twilio"
+	"channel-adapter/viber"
+	"channel-adapter/voice"
+	"channel-adapter/watchdog"
+	"channel-adapter/whatsapp"
+	"channel-adapter/xmpp"
 )
 
 func main() {
@@ -27,24 +60,448 @@ func main() {
 	if allowedOriginsStr != "" {
 		allowedOrigins = strings.Split(allowedOriginsStr, ",")
 	}
+	adapters.Tenant = os.Getenv("TENANT_ID")
+	handlers.InstanceID = os.Getenv("INSTANCE_ID")
+	handlers.HelpText = envOr("HELP_MESSAGE", handlers.HelpText)
+	if err := adapters.SetIDFormat(os.Getenv("MESSAGE_ID_FORMAT")); err != nil {
+		log.Fatalf("Invalid MESSAGE_ID_FORMAT: %v", err)
+	}
+	if handlers.InstanceID == "" {
+		handlers.InstanceID, _ = os.Hostname()
+	}
+	if handlers.InstanceID == "" {
+		handlers.InstanceID = uuid.New().String()[:8]
+	}
 
-	opts, err := redis.ParseURL(redisURL)
+	redisOpts, err := redisconn.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Redis settings: %v", err)
+	}
+	rdb, err := redisconn.NewClient(redisURL, redisOpts)
 	if err != nil {
 		log.Fatalf("Invalid REDIS_URL: %v", err)
 	}
-	rdb := redis.NewClient(opts)
+	go redisconn.Keepalive(context.Background(), rdb, redisOpts.Keepalive)
+	if redisOpts.Keepalive > 0 {
+		redisconn.PubSubKeepalive = redisOpts.Keepalive
+	}
 
-	wsHandler := handlers.NewWSHandler(rdb, allowedOrigins)
+	origins, err := handlers.NewOriginAllowlist(allowedOrigins, os.Getenv("ALLOWED_ORIGINS_STRICT") == "true")
+	if err != nil {
+		log.Fatalf("Invalid ALLOWED_ORIGINS: %v", err)
+	}
+	wsHandler := handlers.NewWSHandler(rdb, origins)
+	// Attachments are scanned by a clamd sidecar or a scanning API
+	if addr := os.Getenv("CLAMAV_ADDR"); addr != "" {
+		wsHandler.EnableAttachmentScanning(attachments.NewClamAV(addr))
+	} else if scanURL := os.Getenv("ATTACHMENT_SCAN_URL"); scanURL != "" {
+		wsHandler.EnableAttachmentScanning(attachments.NewHTTPScanner(scanURL))
+	}
+	blobs, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid attachment storage: %v", err)
+	}
+	if blobs != nil {
+		wsHandler.EnableObjectStorage(blobs)
+	}
+	if v := os.Getenv("UPLOAD_MAX_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid UPLOAD_MAX_SIZE: must be a positive number of bytes")
+		}
+		attachments.MaxUploadSize = n
+	}
+	if geoURL := os.Getenv("GEOIP_URL"); geoURL != "" {
+		wsHandler.EnableGeo(adapters.NewHTTPGeoResolver(geoURL))
+	}
+	connectsPerMinute, err := strconv.Atoi(envOr("WS_CONNECTS_PER_MINUTE", "0"))
+	if err != nil || connectsPerMinute < 0 {
+		log.Fatalf("Invalid WS_CONNECTS_PER_MINUTE: must be a non-negative integer")
+	}
+	if connectsPerMinute > 0 {
+		wsHandler.EnableConnectLimit(connectsPerMinute)
+	}
+	if v := os.Getenv("WS_MAX_MESSAGE_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid WS_MAX_MESSAGE_LENGTH: must be a positive integer")
+		}
+		handlers.MaxMessageLength = n
+	}
+	messagesPerMinute, err := strconv.Atoi(envOr("WS_MESSAGES_PER_MINUTE", "30"))
+	if err != nil || messagesPerMinute < 0 {
+		log.Fatalf("Invalid WS_MESSAGES_PER_MINUTE: must be a non-negative integer")
+	}
+	messageBurst, err := strconv.Atoi(envOr("WS_MESSAGE_BURST", "10"))
+	if err != nil || messageBurst < 1 {
+		log.Fatalf("Invalid WS_MESSAGE_BURST: must be a positive integer")
+	}
+	if messagesPerMinute > 0 {
+		wsHandler.EnableMessageLimit(messagesPerMinute, messageBurst)
+	}
+	for env, d := range map[string]*time.Duration{
+		"WS_PING_INTERVAL": &handlers.PingInterval,
+		"WS_PONG_WAIT":     &handlers.PongWait,
+		"WS_WRITE_TIMEOUT": &handlers.WriteTimeout,
+		"WS_IDLE_TIMEOUT":  &handlers.IdleTimeout,
+	} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed < 0 {
+				log.Fatalf("Invalid %s: %q", env, v)
+			}
+			*d = parsed
+		}
+	}
+	var transport handlers.TransportConfig
+	for env, n := range map[string]*int{
+		"WS_READ_BUFFER_SIZE":  &transport.ReadBufferSize,
+		"WS_WRITE_BUFFER_SIZE": &transport.WriteBufferSize,
+	} {
+		if v := os.Getenv(env); v != "" {
+			if *n, err = strconv.Atoi(v); err != nil || *n < 1 {
+				log.Fatalf("Invalid %s: must be a positive number of bytes", env)
+			}
+		}
+	}
+	if v := os.Getenv("WS_HANDSHAKE_TIMEOUT"); v != "" {
+		if transport.HandshakeTimeout, err = time.ParseDuration(v); err != nil || transport.HandshakeTimeout <= 0 {
+			log.Fatalf("Invalid WS_HANDSHAKE_TIMEOUT: %q", v)
+		}
+	}
+	if v := os.Getenv("WS_MAX_FRAME_SIZE"); v != "" {
+		if transport.MaxFrameSize, err = strconv.ParseInt(v, 10, 64); err != nil || transport.MaxFrameSize < 1 {
+			log.Fatalf("Invalid WS_MAX_FRAME_SIZE: must be a positive number of bytes")
+		}
+	}
+	wsHandler.ConfigureTransport(transport)
+	if v := os.Getenv("WS_MIN_PROTOCOL"); v != "" {
+		if handlers.MinProtocol, err = strconv.Atoi(v); err != nil || handlers.MinProtocol < 0 || handlers.MinProtocol > handlers.ProtocolVersion {
+			log.Fatalf("Invalid WS_MIN_PROTOCOL: must be between 0 and %d", handlers.ProtocolVersion)
+		}
+	}
+	if handlers.PingInterval <= 0 || handlers.PongWait <= handlers.PingInterval || handlers.WriteTimeout <= 0 {
+		log.Fatalf("Invalid WebSocket keepalive: WS_PING_INTERVAL and WS_WRITE_TIMEOUT must be positive and WS_PONG_WAIT longer than WS_PING_INTERVAL")
+	}
+	jwtSecret, jwksURL := os.Getenv("WS_JWT_SECRET"), os.Getenv("WS_JWKS_URL")
+	if jwtSecret != "" || jwksURL != "" {
+		verifier := jwt.NewVerifier(jwtSecret, jwksURL, os.Getenv("WS_JWT_ISSUER"), os.Getenv("WS_JWT_AUDIENCE"))
+		wsHandler.EnableAuth(verifier, os.Getenv("WS_AUTH_REQUIRED") == "true")
+	} else if os.Getenv("WS_AUTH_REQUIRED") == "true" {
+		log.Fatalf("WS_AUTH_REQUIRED needs WS_JWT_SECRET or WS_JWKS_URL")
+	}
+	if secret := os.Getenv("HOST_EVENTS_SECRET"); secret != "" {
+		// A web session that stays away past the reconnect window has ended
+		hosts := hostevents.NewNotifier(rdb, os.Getenv("HOST_WEBHOOK_URL"), secret, handlers.ReconnectWindow)
+		go hosts.Run(context.Background())
+		wsHandler.EnableHostEvents(hosts)
+	}
+	// Remind users returning to a session after a while what it was about
+	if v := os.Getenv("WELCOME_BACK_AFTER"); v != "" {
+		after, err := time.ParseDuration(v)
+		if err != nil || after <= 0 {
+			log.Fatalf("Invalid WELCOME_BACK_AFTER: %q", v)
+		}
+		wsHandler.EnableWelcomeBack(after, envOr("WELCOME_BACK_MESSAGE", handlers.DefaultWelcomeBack))
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/ws", wsHandler)
+	sse := handlers.NewSSEHandler(wsHandler)
+	mux.HandleFunc("GET /sse", sse.Stream)
+	mux.HandleFunc("POST /sse/messages", sse.Submit)
+	mux.HandleFunc("OPTIONS /sse/messages", sse.Preflight)
+	uploads := handlers.NewUploadHandler(wsHandler)
+	mux.HandleFunc("POST /v1/uploads", uploads.Upload)
+	mux.HandleFunc("OPTIONS /v1/uploads", uploads.Preflight)
+	mux.Handle("GET /widget/config", handlers.NewWidgetConfigHandler(rdb))
+	statusHandler := handlers.NewStatusHandler(rdb)
+	mux.Handle("GET /status", statusHandler)
+	if jwtSecret != "" || jwksURL != "" {
+		conversations := handlers.NewConversationsHandler(wsHandler)
+		mux.HandleFunc("GET /v1/conversations", conversations.List)
+		mux.HandleFunc("GET /v1/conversations/{id}", conversations.Get)
+		mux.HandleFunc("OPTIONS /v1/conversations", conversations.Preflight)
+		mux.HandleFunc("OPTIONS /v1/conversations/{id}", conversations.Preflight)
+	}
+	if os.Getenv("ENABLE_CONFORMANCE") == "true" {
+		mux.Handle("/ws/conformance", handlers.NewConformanceHandler())
+	}
+	// CHANNELS names the messaging platforms this instance runs, e.g.
+	// "telegram,whatsapp"; by default every configured one does
+	var enabled []string
+	if v := os.Getenv("CHANNELS"); v != "" {
+		enabled = strings.Split(v, ",")
+	}
+	registry := channels.NewRegistry(enabled)
+	registerChannels(registry, rdb)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := registry.Start(ctx, mux); err != nil {
+		log.Fatalf("Invalid channel settings: %v", err)
+	}
+	if os.Getenv("ENABLE_CONFORMANCE") == "true" {
+		mux.Handle("POST /conformance/normalize/{channel}", handlers.NewNormalizeHandler(registry))
+	}
+	// API keys are issued through the orchestrator admin API
+	useAPIKeys := os.Getenv("API_KEYS") == "true"
+	var grpcServer *http.Server
+	if token := os.Getenv("CHAT_API_TOKEN"); token != "" || useAPIKeys {
+		timeout, err := time.ParseDuration(envOr("CHAT_API_TIMEOUT", "30s"))
+		if err != nil {
+			log.Fatalf("Invalid CHAT_API_TIMEOUT: %v", err)
+		}
+		chat := handlers.NewChatHandler(rdb, token, timeout)
+		if useAPIKeys {
+			chat.EnableAPIKeys(apikeys.NewAuthenticator(rdb))
+		}
+		mux.Handle("POST /v1/chat", chat)
+		// gRPC is served over cleartext HTTP/2 on its own port; put TLS in
+		// front of it in the load balancer
+		if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+			grpcServer = &http.Server{
+				Addr:      fmt.Sprintf(":%s", grpcPort),
+				Handler:   chatv1.NewHandler(handlers.NewChatService(chat)),
+				Protocols: new(http.Protocols),
+			}
+			grpcServer.Protocols.SetUnencryptedHTTP2(true)
+		}
+	}
+	if useAPIKeys {
+		// Human agents sign in with keys that have the agent scope
+		mux.Handle("/ws/agent", handlers.NewAgentHandler(wsHandler, apikeys.NewAuthenticator(rdb), audit.NewLog(rdb)))
+	}
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 
+	// End-to-end pipeline probe backing /readyz
+	probeInterval, err := time.ParseDuration(envOr("PROBE_INTERVAL", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid PROBE_INTERVAL: %v", err)
+	}
+	var dog *watchdog.Watchdog
+	if probeInterval > 0 {
+		dog = watchdog.NewWatchdog(rdb, probeInterval, 10*time.Second)
+		go dog.Run(context.Background())
+		mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			st := dog.Status()
+			w.Header().Set("Content-Type", "application/json")
+			if !st.Healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			json.NewEncoder(w).Encode(st)
+		})
+	}
+	// Report the pipeline and every channel here, web included, for /status
+	go status.NewBoard(rdb).Run(ctx, statusHandler.Checks(dog, append([]string{"web"}, registry.Running()...)))
+	if dir := os.Getenv("STATUS_PAGE_DIR"); dir != "" {
+		go statusHandler.PublishPage(ctx, dir)
+	}
+
+	// TRUSTED_PROXIES lists the load balancers whose forwarding headers are
+	// believed; by default any private or loopback peer is
+	var trusted []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trusted = strings.Split(v, ",")
+	}
+	proxies, err := realip.NewResolver(trusted)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: proxies.Middleware(httperr.WithCorrelationID(mux)),
+	}
+
+	// Graceful shutdown: stop taking platform messages and let in-flight
+	// deliveries finish, close web connections once their messages are
+	// published, then stop the HTTP server
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		log.Println("Shutting down...")
+		cancel()
+		if err := registry.Stop(10 * time.Second); err != nil {
+			log.Printf("%v", err)
+		}
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer drainCancel()
+		if err := wsHandler.Shutdown(drainCtx); err != nil {
+			log.Printf("%v", err)
+		}
+		if err := server.Shutdown(drainCtx); err != nil {
+			log.Printf("Failed to stop HTTP server: %v", err)
+			server.Close()
+		}
+		if grpcServer != nil {
+			// Chat streams stay open until the client leaves, so don't wait
+			grpcServer.Close()
+		}
+	}()
+
+	if grpcServer != nil {
+		go func() {
+			log.Printf("gRPC chat listening on %s", grpcServer.Addr)
+			if err := grpcServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatalf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Channel adapter listening on :%s", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux); err != nil {
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
+	<-stopped
+}
+
+// registerChannels registers every messaging platform with the settings it
+// reads. A factory returns nil when its channel is not configured.
+func registerChannels(registry *channels.Registry, rdb *redis.Client) {
+	registry.Register("telegram", func() (channels.Adapter, error) {
+		token := os.Getenv("TELEGRAM_BOT_TOKEN")
+		if token == "" {
+			return nil, nil
+		}
+		return handlers.NewTelegramHandler(rdb, telegram.NewBot(token, os.Getenv("TELEGRAM_API_BASE")), os.Getenv("TELEGRAM_WEBHOOK_SECRET")), nil
+	})
+	registry.Register("email", func() (channels.Adapter, error) {
+		imapURL := os.Getenv("EMAIL_IMAP_URL")
+		if imapURL == "" {
+			return nil, nil
+		}
+		mailbox, err := email.ParseMailbox(imapURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_IMAP_URL: %w", err)
+		}
+		sender, err := email.NewSender(os.Getenv("EMAIL_SMTP_URL"), os.Getenv("EMAIL_FROM"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_SMTP_URL: %w", err)
+		}
+		pollInterval, err := time.ParseDuration(envOr("EMAIL_POLL_INTERVAL", "30s"))
+		if err != nil || pollInterval <= 0 {
+			return nil, fmt.Errorf("invalid EMAIL_POLL_INTERVAL: %q", os.Getenv("EMAIL_POLL_INTERVAL"))
+		}
+		return handlers.NewEmailHandler(rdb, mailbox, sender, pollInterval), nil
+	})
+	registry.Register("sms", func() (channels.Adapter, error) {
+		sid := os.Getenv("TWILIO_ACCOUNT_SID")
+		if sid == "" {
+			return nil, nil
+		}
+		publicURL := os.Getenv("TWILIO_PUBLIC_URL")
+		if publicURL == "" {
+			return nil, errors.New("TWILIO_PUBLIC_URL is required to verify Twilio webhooks")
+		}
+		client := twilio.NewClient(sid, os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_API_BASE"))
+		sms := handlers.NewSMSHandler(rdb, client, os.Getenv("TWILIO_FROM_NUMBER"), publicURL, os.Getenv("SMS_SINGLE_SEGMENT") == "true")
+		if sttURL := os.Getenv("VOICE_STT_URL"); sttURL != "" {
+			ttsURL := os.Getenv("VOICE_TTS_URL")
+			if ttsURL == "" {
+				return nil, errors.New("VOICE_TTS_URL is required for the voice channel")
+			}
+			sms.EnableVoice(handlers.NewVoiceHandler(rdb, client, publicURL,
+				voice.NewHTTPTranscriber(sttURL),
+				voice.NewHTTPSynthesizer(ttsURL, os.Getenv("VOICE_TTS_VOICE")),
+				envOr("VOICE_LANGUAGE", "en"), envOr("VOICE_GREETING", "Hi, this is Maya from Mandala Foods. How can I help you?")))
+		}
+		return sms, nil
+	})
+	registry.Register("discord", func() (channels.Adapter, error) {
+		token := os.Getenv("DISCORD_BOT_TOKEN")
+		if token == "" {
+			return nil, nil
+		}
+		return handlers.NewDiscordHandler(rdb, discord.NewClient(token, os.Getenv("DISCORD_API_BASE")), token), nil
+	})
+	registry.Register("irc", func() (channels.Adapter, error) {
+		addr := os.Getenv("IRC_SERVER")
+		if addr == "" {
+			return nil, nil
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IRC_SERVER, expected host:port: %w", err)
+		}
+		var ircChannels []string
+		if v := os.Getenv("IRC_CHANNELS"); v != "" {
+			ircChannels = strings.Split(v, ",")
+		}
+		return handlers.NewIRCHandler(rdb, envOr("IRC_NETWORK", host), irc.Config{
+			Addr:     addr,
+			TLS:      os.Getenv("IRC_TLS") != "false",
+			Nick:     envOr("IRC_NICK", "maya"),
+			Channels: ircChannels,
+			Password: os.Getenv("IRC_PASSWORD"),
+		}), nil
+	})
+	registry.Register("xmpp", func() (channels.Adapter, error) {
+		jid := os.Getenv("XMPP_JID")
+		if jid == "" {
+			return nil, nil
+		}
+		xc, err := handlers.NewXMPPHandler(rdb, xmpp.Config{
+			JID:       jid,
+			Password:  os.Getenv("XMPP_PASSWORD"),
+			Resource:  os.Getenv("XMPP_RESOURCE"),
+			Addr:      os.Getenv("XMPP_SERVER"),
+			DirectTLS: os.Getenv("XMPP_DIRECT_TLS") == "true",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid XMPP_JID: %w", err)
+		}
+		return xc, nil
+	})
+	registry.Register("gbm", func() (channels.Adapter, error) {
+		keyFile := os.Getenv("GBM_SERVICE_ACCOUNT_KEY")
+		if keyFile == "" {
+			return nil, nil
+		}
+		clientToken := os.Getenv("GBM_CLIENT_TOKEN")
+		if clientToken == "" {
+			return nil, errors.New("GBM_CLIENT_TOKEN is required to verify Business Messages webhooks")
+		}
+		tokens, err := gbm.NewTokenSource(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GBM_SERVICE_ACCOUNT_KEY: %w", err)
+		}
+		return handlers.NewGBMHandler(rdb, gbm.NewClient(tokens, os.Getenv("GBM_API_BASE")), clientToken), nil
+	})
+	registry.Register("viber", func() (channels.Adapter, error) {
+		token := os.Getenv("VIBER_AUTH_TOKEN")
+		if token == "" {
+			return nil, nil
+		}
+		client := viber.NewClient(token, envOr("VIBER_SENDER_NAME", "Maya"), os.Getenv("VIBER_API_BASE"))
+		vb := handlers.NewViberHandler(rdb, client, token, os.Getenv("VIBER_WELCOME_MESSAGE"))
+		if webhookURL := os.Getenv("VIBER_WEBHOOK_URL"); webhookURL != "" {
+			go vb.Register(context.Background(), webhookURL)
+		}
+		return vb, nil
+	})
+	registry.Register("whatsapp", func() (channels.Adapter, error) {
+		token := os.Getenv("WHATSAPP_ACCESS_TOKEN")
+		if token == "" {
+			return nil, nil
+		}
+		appSecret := os.Getenv("WHATSAPP_APP_SECRET")
+		if appSecret == "" {
+			return nil, errors.New("WHATSAPP_APP_SECRET is required to verify WhatsApp webhooks")
+		}
+		client := whatsapp.NewClient(token, os.Getenv("WHATSAPP_PHONE_NUMBER_ID"), os.Getenv("WHATSAPP_API_BASE"))
+		return handlers.NewWhatsAppHandler(rdb, client, appSecret, os.Getenv("WHATSAPP_VERIFY_TOKEN")), nil
+	})
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
@@ -0,0 +1,53 @@
+package metrics
+
+import "sync"
+
+// Other is the label value that stands in for values over a Limiter's cap.
+const Other = "other"
+
+// Limiter caps the distinct values of a label fed from request data, such
+// as a tenant ID, so a flood of new values can't grow the registry without
+// bound. Safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	allowed map[string]bool
+	seen    map[string]bool
+	max     int
+}
+
+// NewLimiter passes the listed values through and folds every other one
+// into Other. With no list, the first max distinct values are passed
+// through instead.
+func NewLimiter(max int, allow ...string) *Limiter {
+	l := &Limiter{seen: map[string]bool{}, max: max}
+	if len(allow) > 0 {
+		l.allowed = map[string]bool{}
+		for _, v := range allow {
+			l.allowed[v] = true
+		}
+	}
+	return l
+}
+
+// Value returns the label value to record for v; "" becomes "none".
+func (l *Limiter) Value(v string) string {
+	if v == "" {
+		return "none"
+	}
+	if l.allowed != nil {
+		if l.allowed[v] {
+			return v
+		}
+		return Other
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[v] {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return Other
+	}
+	l.seen[v] = true
+	return v
+}
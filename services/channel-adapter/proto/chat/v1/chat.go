@@ -0,0 +1,252 @@
+// Package chatv1 implements the messages and the ChatService of chat.proto.
+// The module has no protobuf or gRPC runtime, so the encoding is written by
+// hand from the .proto; keep the field numbers in sync with it. Envelope,
+// which only stream consumers use, is not implemented.
+package chatv1
+
+import "fmt"
+
+// ClientMessage is one frame from the client. Exactly one of its fields is
+// set, as with the oneof in chat.proto.
+type ClientMessage struct {
+	Open     *Open
+	Message  *UserMessage
+	Feedback *Feedback
+	Edit     *Edit
+}
+
+type Open struct {
+	SessionID     string
+	WidgetVersion string
+	PageURL       string
+	TimeZone      string
+	ResumeToken   string
+	Protocol      int32
+	SessionKey    string
+}
+
+type UserMessage struct {
+	Text           string
+	ResponseSchema []byte
+	PageContext    *PageContext
+	Attachment     *Attachment
+}
+
+type PageContext struct {
+	URL          string
+	Title        string
+	SelectedText string
+}
+
+type Attachment struct {
+	Kind    string
+	Data    []byte
+	Consent bool
+}
+
+type Rating int32
+
+const (
+	RatingUnspecified Rating = 0
+	RatingUp          Rating = 1
+	RatingDown        Rating = 2
+)
+
+type Feedback struct {
+	MessageID string
+	Rating    Rating
+}
+
+type Edit struct {
+	MessageID string
+	Text      string
+	Delete    bool
+}
+
+// ServerMessage mirrors a WebSocket frame; see chat.proto.
+type ServerMessage struct {
+	ID           string
+	Type         string
+	Text         string
+	SessionID    string
+	Data         []byte
+	Part         int32
+	Parts        int32
+	Instance     string
+	Reconnect    *ReconnectHint
+	ResumeToken  string
+	Returning    bool
+	Connection   string
+	Protocol     int32
+	SessionKey   string
+	Seq          int64
+	Role         string
+	Agent        string
+	Rich         []byte
+	Corrects     string
+	RetryAfterMS int64
+}
+
+type ReconnectHint struct {
+	Instance        string
+	Query           string
+	Cookie          string
+	ValidForSeconds int32
+}
+
+// Unmarshal decodes a client frame. Unknown fields are ignored.
+func (m *ClientMessage) Unmarshal(b []byte) error {
+	*m = ClientMessage{}
+	return eachField(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			m.Open, m.Message, m.Feedback, m.Edit = new(Open), nil, nil, nil
+			err = m.Open.unmarshal(f.bytes)
+		case 2:
+			m.Open, m.Message, m.Feedback, m.Edit = nil, new(UserMessage), nil, nil
+			err = m.Message.unmarshal(f.bytes)
+		case 3:
+			m.Open, m.Message, m.Feedback, m.Edit = nil, nil, new(Feedback), nil
+			err = m.Feedback.unmarshal(f.bytes)
+		case 4:
+			m.Open, m.Message, m.Feedback, m.Edit = nil, nil, nil, new(Edit)
+			err = m.Edit.unmarshal(f.bytes)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode ClientMessage field %d: %w", f.num, err)
+		}
+		return nil
+	})
+}
+
+func (m *Open) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.SessionID = f.string()
+		case 2:
+			m.WidgetVersion = f.string()
+		case 3:
+			m.PageURL = f.string()
+		case 4:
+			m.TimeZone = f.string()
+		case 5:
+			m.ResumeToken = f.string()
+		case 6:
+			m.Protocol = f.int32()
+		case 7:
+			m.SessionKey = f.string()
+		}
+		return nil
+	})
+}
+
+func (m *UserMessage) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Text = f.string()
+		case 2:
+			m.ResponseSchema = f.bytes
+		case 3:
+			m.PageContext = new(PageContext)
+			return m.PageContext.unmarshal(f.bytes)
+		case 4:
+			m.Attachment = new(Attachment)
+			return m.Attachment.unmarshal(f.bytes)
+		}
+		return nil
+	})
+}
+
+func (m *PageContext) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.URL = f.string()
+		case 2:
+			m.Title = f.string()
+		case 3:
+			m.SelectedText = f.string()
+		}
+		return nil
+	})
+}
+
+func (m *Attachment) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Kind = f.string()
+		case 2:
+			m.Data = f.bytes
+		case 3:
+			m.Consent = f.bool()
+		}
+		return nil
+	})
+}
+
+func (m *Feedback) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.MessageID = f.string()
+		case 2:
+			m.Rating = Rating(f.int32())
+		}
+		return nil
+	})
+}
+
+func (m *Edit) unmarshal(b []byte) error {
+	return eachField(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.MessageID = f.string()
+		case 2:
+			m.Text = f.string()
+		case 3:
+			m.Delete = f.bool()
+		}
+		return nil
+	})
+}
+
+// Marshal encodes a server frame.
+func (m *ServerMessage) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.ID)
+	b = appendString(b, 2, m.Type)
+	b = appendString(b, 3, m.Text)
+	b = appendString(b, 4, m.SessionID)
+	b = appendBytes(b, 5, m.Data)
+	b = appendInt(b, 6, int64(m.Part))
+	b = appendInt(b, 7, int64(m.Parts))
+	b = appendString(b, 8, m.Instance)
+	if m.Reconnect != nil {
+		b = appendMessage(b, 9, m.Reconnect.marshal())
+	}
+	b = appendString(b, 10, m.ResumeToken)
+	b = appendBool(b, 11, m.Returning)
+	b = appendString(b, 12, m.Connection)
+	b = appendInt(b, 13, int64(m.Protocol))
+	b = appendString(b, 14, m.SessionKey)
+	b = appendInt(b, 15, m.Seq)
+	b = appendString(b, 16, m.Role)
+	b = appendString(b, 17, m.Agent)
+	b = appendBytes(b, 18, m.Rich)
+	b = appendString(b, 19, m.Corrects)
+	b = appendInt(b, 20, m.RetryAfterMS)
+	return b
+}
+
+func (m *ReconnectHint) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Instance)
+	b = appendString(b, 2, m.Query)
+	b = appendString(b, 3, m.Cookie)
+	b = appendInt(b, 4, int64(m.ValidForSeconds))
+	return b
+}
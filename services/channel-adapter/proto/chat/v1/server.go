@@ -0,0 +1,188 @@
+package chatv1
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChatPath is the HTTP/2 path gRPC clients call Chat on.
+const ChatPath = "/mandala.chat.v1.ChatService/Chat"
+
+// MaxMessageSize bounds a client frame, like the WebSocket frame limit.
+var MaxMessageSize = 4 << 20
+
+// Code is a gRPC status code.
+type Code int
+
+const (
+	OK                Code = 0
+	Canceled          Code = 1
+	InvalidArgument   Code = 3
+	DeadlineExceeded  Code = 4
+	PermissionDenied  Code = 7
+	ResourceExhausted Code = 8
+	Unimplemented     Code = 12
+	Internal          Code = 13
+	Unavailable       Code = 14
+	Unauthenticated   Code = 16
+)
+
+// Error is an RPC failure with the status code the client is sent.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", e.Code, e.Message)
+}
+
+func Errorf(code Code, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ChatServiceServer is implemented by the service behind NewHandler.
+type ChatServiceServer interface {
+	Chat(stream ChatStream) error
+}
+
+// ChatStream is the server side of one Chat call. Recv returns io.EOF once
+// the client has closed its side.
+type ChatStream interface {
+	Context() context.Context
+	Recv() (*ClientMessage, error)
+	Send(*ServerMessage) error
+	// Header returns the request metadata, e.g. authorization.
+	Header() http.Header
+}
+
+// NewHandler serves srv over gRPC. It must be mounted on a server that
+// speaks HTTP/2, with TLS or cleartext (h2c).
+func NewHandler(srv ChatServiceServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requires HTTP/2 and application/grpc", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		if r.Method != http.MethodPost || r.URL.Path != ChatPath {
+			writeStatus(w, Errorf(Unimplemented, "unknown method %s", r.URL.Path))
+			return
+		}
+		if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+			writeStatus(w, Errorf(Unimplemented, "compression %q is not supported", enc))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		stream := &serverStream{w: w, r: r, flusher: flusher}
+		err := srv.Chat(stream)
+		if err != nil && r.Context().Err() == nil {
+			log.Printf("gRPC Chat ended: %v", err)
+		}
+		writeStatus(w, err)
+	})
+}
+
+type serverStream struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+func (s *serverStream) Context() context.Context { return s.r.Context() }
+func (s *serverStream) Header() http.Header      { return s.r.Header }
+
+// Recv reads one length-prefixed message: a compression flag, a 4-byte
+// big-endian length and the protobuf bytes.
+func (s *serverStream) Recv() (*ClientMessage, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(s.r.Body, prefix[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, Errorf(Canceled, "failed to read message: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if uint64(size) > uint64(MaxMessageSize) {
+		return nil, Errorf(ResourceExhausted, "message of %d bytes is over the %d byte limit", size, MaxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(s.r.Body, data); err != nil {
+		return nil, Errorf(Canceled, "failed to read message: %v", err)
+	}
+	var m ClientMessage
+	if err := m.Unmarshal(data); err != nil {
+		return nil, Errorf(InvalidArgument, "%v", err)
+	}
+	return &m, nil
+}
+
+// Send writes one message. It is safe to call from several goroutines.
+func (s *serverStream) Send(m *ServerMessage) error {
+	data := m.Marshal()
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(frame); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// writeStatus ends the call with err's status in the trailers. Before the
+// response has started this makes a trailers-only response.
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := OK, ""
+	var rpcErr *Error
+	switch {
+	case err == nil:
+	case errors.As(err, &rpcErr):
+		code, msg = rpcErr.Code, rpcErr.Message
+	case errors.Is(err, context.Canceled):
+		code, msg = Canceled, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		code, msg = DeadlineExceeded, err.Error()
+	default:
+		code, msg = Internal, err.Error()
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(msg))
+	}
+}
+
+// encodeMessage percent-encodes grpc-message as the gRPC spec requires.
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+// Package realip recovers the client address behind load balancers. Proxy
+// headers are only believed when the connection comes from a trusted proxy,
+// and the chain is read from the right so a client can't forge its way past
+// the hops that actually handled the request.
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultTrusted covers loopback and private ranges, where ingress
+// controllers and cloud load balancers usually connect from.
+var DefaultTrusted = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+	"::1/128", "fc00::/7",
+}
+
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver trusts proxies in the given CIDRs; bare IPs are accepted as
+// single hosts. With none, DefaultTrusted is used.
+func NewResolver(cidrs []string) (*Resolver, error) {
+	if len(cidrs) == 0 {
+		cidrs = DefaultTrusted
+	}
+	var r Resolver
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+		}
+		r.trusted = append(r.trusted, n)
+	}
+	return &r, nil
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of whoever sent the request: the peer itself
+// unless it is a trusted proxy, otherwise the nearest untrusted hop from the
+// Forwarded or X-Forwarded-For chain, or X-Real-IP.
+func (r *Resolver) ClientIP(req *http.Request) net.IP {
+	peer := parseHost(req.RemoteAddr)
+	if peer == nil || !r.isTrusted(peer) {
+		return peer
+	}
+	chain := forwardedFor(req.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		for _, v := range req.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				chain = append(chain, parseHost(strings.TrimSpace(hop)))
+			}
+		}
+	}
+	if len(chain) > 0 {
+		last := peer
+		for i := len(chain) - 1; i >= 0; i-- {
+			if chain[i] == nil {
+				// Garbage in the chain: nothing to its left can be believed
+				return last
+			}
+			if !r.isTrusted(chain[i]) {
+				return chain[i]
+			}
+			last = chain[i]
+		}
+		return last
+	}
+	if ip := parseHost(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// Middleware rewrites RemoteAddr to the bare client IP, so rate limiting,
+// logging and geo lookup downstream all see the real client.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ip := r.ClientIP(req); ip != nil {
+			req.RemoteAddr = ip.String()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// forwardedFor extracts the for= addresses from RFC 7239 Forwarded headers,
+// in order. Obfuscated identifiers such as "unknown" come back as nil.
+func forwardedFor(values []string) []net.IP {
+	var out []net.IP
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+				out = append(out, parseHost(strings.Trim(val, `"`)))
+			}
+		}
+	}
+	return out
+}
+
+// parseHost accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port".
+func parseHost(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
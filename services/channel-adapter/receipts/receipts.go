@@ -0,0 +1,39 @@
+// Package receipts reports platform delivery outcomes to the orchestrator on
+// the delivery:receipts stream, where they are classified and retried.
+package receipts
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	stream = "delivery:receipts"
+
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Report records the outcome for response id. Responses without an ID
+// (typing indicators) are not tracked and are ignored.
+func Report(ctx context.Context, rdb *redis.Client, id, status, platform string, code int, description string) error {
+	if id == "" {
+		return nil
+	}
+	err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{
+			"id":          id,
+			"status":      status,
+			"platform":    platform,
+			"code":        code,
+			"description": description,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to report receipt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package redisconn builds the Redis client from the environment, with
+// settings for serverless providers such as Upstash that close idle
+// connections and bill per request.
+package redisconn
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+)
+
+var keepaliveFailures = metrics.NewCounterVec("redis_keepalive_failures_total",
+	"Failed keepalive pings to Redis.")
+
+// PubSubKeepalive is how long a subscription may go without traffic before
+// its connection is pinged. Main sets it from REDIS_KEEPALIVE; the default
+// is go-redis's own.
+var PubSubKeepalive = 3 * time.Second
+
+type Options struct {
+	// Keepalive pings the server this often so the provider doesn't drop
+	// the connection while idle. Each ping is a billed request; 0 disables.
+	Keepalive time.Duration
+	// IdleTimeout discards pooled connections idle this long, which should be
+	// shorter than the provider's own idle cutoff so we never reuse a
+	// connection it has already closed.
+	IdleTimeout time.Duration
+	MaxRetries  int
+}
+
+// OptionsFromEnv reads REDIS_KEEPALIVE, REDIS_IDLE_TIMEOUT and
+// REDIS_MAX_RETRIES.
+func OptionsFromEnv() (Options, error) {
+	o := Options{IdleTimeout: 30 * time.Minute, MaxRetries: 3}
+	var err error
+	if v := os.Getenv("REDIS_KEEPALIVE"); v != "" {
+		if o.Keepalive, err = time.ParseDuration(v); err != nil {
+			return o, fmt.Errorf("invalid REDIS_KEEPALIVE: %w", err)
+		}
+	}
+	if v := os.Getenv("REDIS_IDLE_TIMEOUT"); v != "" {
+		if o.IdleTimeout, err = time.ParseDuration(v); err != nil {
+			return o, fmt.Errorf("invalid REDIS_IDLE_TIMEOUT: %w", err)
+		}
+	}
+	if v := os.Getenv("REDIS_MAX_RETRIES"); v != "" {
+		if o.MaxRetries, err = strconv.Atoi(v); err != nil {
+			return o, fmt.Errorf("invalid REDIS_MAX_RETRIES: %w", err)
+		}
+	}
+	return o, nil
+}
+
+// NewClient parses url and applies o. Retries use exponential backoff so a
+// provider-side connection reset is retried on a fresh connection.
+func NewClient(url string, o Options) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	opts.ConnMaxIdleTime = o.IdleTimeout
+	opts.MaxRetries = o.MaxRetries
+	opts.MinRetryBackoff = 100 * time.Millisecond
+	opts.MaxRetryBackoff = 2 * time.Second
+	return redis.NewClient(opts), nil
+}
+
+// Channel returns pubsub's messages, pinging its connection every
+// PubSubKeepalive while it is idle. Subscriptions hold their own
+// connections, which Keepalive's pings through the pool never reach.
+func Channel(pubsub *redis.PubSub) <-chan *redis.Message {
+	return pubsub.Channel(redis.WithChannelHealthCheckInterval(PubSubKeepalive))
+}
+
+// Keepalive pings rdb every interval until ctx is done, logging only when
+// the connection goes down or comes back.
+func Keepalive(ctx context.Context, rdb *redis.Client, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	healthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := rdb.Ping(ctx).Err()
+		switch {
+		case err != nil && ctx.Err() == nil:
+			keepaliveFailures.Inc()
+			if healthy {
+				log.Printf("Redis keepalive failed: %v", err)
+			}
+			healthy = false
+		case err == nil && !healthy:
+			log.Println("Redis keepalive recovered")
+			healthy = true
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPoll caps how long a fake getUpdates holds the adapter's long poll.
+const maxPoll = 30 * time.Second
+
+// Platform fakes the APIs the adapter replies through and logs every call,
+// so a reply can be checked without it reaching anyone. Point the adapter at
+// it with TELEGRAM_API_BASE=<url>/telegram and WHATSAPP_API_BASE=<url>/whatsapp;
+// Slack's Web API is under <url>/slack/api.
+type Platform struct {
+	mux *http.ServeMux
+}
+
+func NewPlatform() *Platform {
+	p := &Platform{mux: http.NewServeMux()}
+	p.mux.HandleFunc("POST /telegram/{bot}/{method}", p.telegram)
+	p.mux.HandleFunc("POST /whatsapp/{phone}/messages", p.whatsapp)
+	p.mux.HandleFunc("POST /slack/api/{method}", p.slack)
+	return p
+}
+
+func (p *Platform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+func (p *Platform) telegram(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.PathValue("bot"), "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	method := r.PathValue("method")
+	params := readParams(r)
+	var result interface{} = true
+	switch method {
+	case "getUpdates":
+		// Nothing arrives by polling; simulated updates come by webhook
+		timeout, _ := params["timeout"].(float64)
+		select {
+		case <-time.After(min(time.Duration(timeout)*time.Second, maxPoll)):
+		case <-r.Context().Done():
+			return
+		}
+		result = []interface{}{}
+	case "sendMessage":
+		logCall("telegram", method, params)
+		result = map[string]interface{}{
+			"message_id": nextID(),
+			"chat":       map[string]interface{}{"id": params["chat_id"], "type": "private"},
+			"date":       time.Now().Unix(),
+			"text":       params["text"],
+		}
+	default:
+		logCall("telegram", method, params)
+	}
+	writeJSON(w, map[string]interface{}{"ok": true, "result": result})
+}
+
+func (p *Platform) whatsapp(w http.ResponseWriter, r *http.Request) {
+	params := readParams(r)
+	if params["status"] == "read" {
+		writeJSON(w, map[string]interface{}{"success": true})
+		return
+	}
+	logCall("whatsapp", "messages", params)
+	writeJSON(w, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"messages":          []map[string]string{{"id": fmt.Sprintf("wamid.sim%d", nextID())}},
+	})
+}
+
+func (p *Platform) slack(w http.ResponseWriter, r *http.Request) {
+	method := r.PathValue("method")
+	params := readParams(r)
+	logCall("slack", method, params)
+	writeJSON(w, map[string]interface{}{
+		"ok":      true,
+		"channel": params["channel"],
+		"ts":      fmt.Sprintf("%d.%06d", time.Now().Unix(), nextID()%1000000),
+	})
+}
+
+// readParams takes a JSON body; form-encoded calls are read as single
+// values.
+func readParams(r *http.Request) map[string]interface{} {
+	params := map[string]interface{}{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		r.ParseForm()
+		for k := range r.PostForm {
+			params[k] = r.PostForm.Get(k)
+		}
+		return params
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	json.Unmarshal(body, &params)
+	return params
+}
+
+func logCall(platform, method string, params map[string]interface{}) {
+	data, _ := json.MarshalIndent(params, "", "  ")
+	log.Printf("%s %s:\n%s", platform, method, data)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
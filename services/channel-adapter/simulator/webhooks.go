@@ -0,0 +1,165 @@
+// Package simulator stands in for third-party messaging platforms while a
+// channel is developed locally: it builds and signs the webhook payloads
+// each platform would send, and fakes the platform APIs the adapter replies
+// through, so no real bot or business account is needed.
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Webhook is one simulated platform request, ready to send to an adapter.
+type Webhook struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// ids numbers simulated updates and messages, starting from the clock so
+// restarts don't reuse IDs the adapter has already deduplicated.
+var ids = atomic.Int64{}
+
+func init() {
+	ids.Store(time.Now().Unix())
+}
+
+func nextID() int64 {
+	return ids.Add(1)
+}
+
+func jsonWebhook(path string, payload interface{}) Webhook {
+	// Payloads are built from maps of plain values and always marshal
+	body, _ := json.Marshal(payload)
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	return Webhook{Path: path, Header: h, Body: body}
+}
+
+// TelegramMessage is an update carrying a private chat message. secret is
+// the adapter's TELEGRAM_WEBHOOK_SECRET.
+func TelegramMessage(chatID int64, text, secret string) Webhook {
+	wh := jsonWebhook("/telegram/webhook", map[string]interface{}{
+		"update_id": nextID(),
+		"message":   telegramMessage(chatID, text),
+	})
+	wh.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	return wh
+}
+
+// TelegramCallback is an update for a tap on an inline keyboard button that
+// carries data.
+func TelegramCallback(chatID int64, data, secret string) Webhook {
+	wh := jsonWebhook("/telegram/webhook", map[string]interface{}{
+		"update_id": nextID(),
+		"callback_query": map[string]interface{}{
+			"id":      strconv.FormatInt(nextID(), 10),
+			"from":    telegramUser(chatID),
+			"message": telegramMessage(chatID, ""),
+			"data":    data,
+		},
+	})
+	wh.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	return wh
+}
+
+func telegramUser(id int64) map[string]interface{} {
+	return map[string]interface{}{"id": id, "is_bot": false, "first_name": "Sim", "language_code": "en"}
+}
+
+func telegramMessage(chatID int64, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"message_id": nextID(),
+		"from":       telegramUser(chatID),
+		"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+		"date":       time.Now().Unix(),
+		"text":       text,
+	}
+}
+
+// WhatsAppMessage is a Cloud API notification of a text message from the
+// number from, signed with the adapter's WHATSAPP_APP_SECRET.
+func WhatsAppMessage(from, name, text, phoneNumberID, appSecret string) Webhook {
+	wh := jsonWebhook("/whatsapp/webhook", map[string]interface{}{
+		"object": "whatsapp_business_account",
+		"entry": []map[string]interface{}{{
+			"id": "sim-waba",
+			"changes": []map[string]interface{}{{
+				"field": "messages",
+				"value": map[string]interface{}{
+					"messaging_product": "whatsapp",
+					"metadata":          map[string]string{"phone_number_id": phoneNumberID},
+					"contacts":          []map[string]interface{}{{"wa_id": from, "profile": map[string]string{"name": name}}},
+					"messages": []map[string]interface{}{{
+						"from":      from,
+						"id":        fmt.Sprintf("wamid.sim%d", nextID()),
+						"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+						"type":      "text",
+						"text":      map[string]string{"body": text},
+					}},
+				},
+			}},
+		}},
+	})
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(wh.Body)
+	wh.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return wh
+}
+
+// SlackMessage is an Events API message event, signed the way Slack signs
+// requests with an app's signing secret.
+func SlackMessage(team, channel, user, text, signingSecret string) Webhook {
+	id := nextID()
+	wh := jsonWebhook("/slack/events", map[string]interface{}{
+		"type":       "event_callback",
+		"team_id":    team,
+		"event_id":   fmt.Sprintf("EvSIM%d", id),
+		"event_time": time.Now().Unix(),
+		"event": map[string]interface{}{
+			"type":         "message",
+			"channel":      channel,
+			"channel_type": "im",
+			"user":         user,
+			"text":         text,
+			"ts":           fmt.Sprintf("%d.%06d", time.Now().Unix(), id%1000000),
+		},
+	})
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(wh.Body)
+	wh.Header.Set("X-Slack-Request-Timestamp", ts)
+	wh.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return wh
+}
+
+// Send posts wh to the adapter at baseURL and returns its status and body.
+func Send(ctx context.Context, baseURL string, wh Webhook) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+wh.Path, bytes.NewReader(wh.Body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = wh.Header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
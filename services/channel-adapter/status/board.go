@@ -0,0 +1,243 @@
+// Package status keeps the health of the assistant's components in Redis,
+// where the channel adapter's public /status endpoint summarizes it for the
+// widget. Each service reports the components it can see; a change of
+// status is recorded as an event, so the last hour's incidents can be shown
+// next to the current state. The package is shared by the orchestrator and
+// the channel adapter; keep the copies identical.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Statuses, from best to worst.
+const (
+	Operational = "operational"
+	Unknown     = "unknown"
+	Degraded    = "degraded"
+	Maintenance = "maintenance"
+	Down        = "down"
+)
+
+const (
+	componentPrefix = "status:component:"
+	componentsKey   = "status:components"
+	eventsStream    = "status:events"
+	eventsMaxLen    = 1000
+)
+
+// ReportInterval is how often Run reports; a component not reported for
+// StaleAfter is shown as unknown. History is how far back incidents go.
+var (
+	ReportInterval = 15 * time.Second
+	StaleAfter     = time.Minute
+	History        = time.Hour
+)
+
+var rank = map[string]int{Operational: 0, Unknown: 1, Degraded: 2, Maintenance: 3, Down: 4}
+
+// Worse reports whether status a is worse than b.
+func Worse(a, b string) bool {
+	return rank[a] > rank[b]
+}
+
+// Component is a component's latest reported status. Since is when it
+// changed to it.
+type Component struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	Since     time.Time `json:"since"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Incident is a stretch of time a component was not operational.
+// ResolvedAt is nil while it lasts.
+type Incident struct {
+	Component  string     `json:"component"`
+	Status     string     `json:"status"`
+	Detail     string     `json:"detail,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Summary is what /status returns. Status is the worst of the components',
+// with unknown ones counted as degraded.
+type Summary struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components"`
+	Incidents  []Incident  `json:"incidents"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Check returns a component's status and, when it isn't operational, why.
+type Check func(ctx context.Context) (status, detail string)
+
+type Board struct {
+	rdb *redis.Client
+}
+
+func NewBoard(rdb *redis.Client) *Board {
+	return &Board{rdb: rdb}
+}
+
+// Report records a component's status. Every replica reports what it sees;
+// the latest report wins.
+func (b *Board) Report(ctx context.Context, name, status, detail string) error {
+	key := componentPrefix + name
+	now := time.Now().UTC()
+	err := b.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		c := Component{Name: name, Status: status, Detail: detail, Since: now, UpdatedAt: now}
+		prev, err := load(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		changed := prev == nil || prev.Status != status
+		if !changed {
+			c.Since = prev.Since
+		}
+		data, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("failed to marshal component status: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			pipe.SAdd(ctx, componentsKey, name)
+			// A component seen for the first time is only news if it's
+			// not operational
+			if changed && (prev != nil || status != Operational) {
+				pipe.XAdd(ctx, &redis.XAddArgs{
+					Stream: eventsStream,
+					MaxLen: eventsMaxLen,
+					Approx: true,
+					Values: map[string]interface{}{"component": name, "status": status, "detail": detail},
+				})
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		// Another replica reported at the same instant
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to report %s status: %w", name, err)
+	}
+	return nil
+}
+
+// Run reports the checked components every ReportInterval until ctx is
+// done.
+func (b *Board) Run(ctx context.Context, checks map[string]Check) {
+	ticker := time.NewTicker(ReportInterval)
+	defer ticker.Stop()
+	for {
+		for name, check := range checks {
+			status, detail := check(ctx)
+			if err := b.Report(ctx, name, status, detail); err != nil {
+				log.Printf("Failed to report component status: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Summary returns every reported component and the incidents that were
+// ongoing during the last History, oldest first.
+func (b *Board) Summary(ctx context.Context) (*Summary, error) {
+	names, err := b.rdb.SMembers(ctx, componentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list components: %w", err)
+	}
+	sort.Strings(names)
+	now := time.Now().UTC()
+	s := &Summary{Status: Operational, Components: []Component{}, Incidents: []Incident{}, UpdatedAt: now}
+	for _, name := range names {
+		c, err := load(ctx, b.rdb, componentPrefix+name)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			continue
+		}
+		if now.Sub(c.UpdatedAt) > StaleAfter {
+			c.Status, c.Detail = Unknown, "not reported recently"
+		}
+		s.Components = append(s.Components, *c)
+		status := c.Status
+		if status == Unknown {
+			status = Degraded
+		}
+		if Worse(status, s.Status) {
+			s.Status = status
+		}
+	}
+
+	// The stream is short, so read all of it to find incidents that began
+	// before the window
+	events, err := b.rdb.XRange(ctx, eventsStream, "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load status events: %w", err)
+	}
+	cutoff := now.Add(-History)
+	var incidents []Incident
+	open := make(map[string]int)
+	for _, e := range events {
+		msPart, _, _ := strings.Cut(e.ID, "-")
+		ms, _ := strconv.ParseInt(msPart, 10, 64)
+		at := time.UnixMilli(ms).UTC()
+		name, _ := e.Values["component"].(string)
+		status, _ := e.Values["status"].(string)
+		detail, _ := e.Values["detail"].(string)
+		i, ongoing := open[name]
+		switch {
+		case ongoing && status == Operational:
+			incidents[i].ResolvedAt = &at
+			delete(open, name)
+		case ongoing:
+			// Still the same incident; keep its worst status
+			if Worse(status, incidents[i].Status) {
+				incidents[i].Status, incidents[i].Detail = status, detail
+			}
+		case status != Operational:
+			open[name] = len(incidents)
+			incidents = append(incidents, Incident{Component: name, Status: status, Detail: detail, StartedAt: at})
+		}
+	}
+	for _, inc := range incidents {
+		if inc.ResolvedAt == nil || inc.ResolvedAt.After(cutoff) {
+			s.Incidents = append(s.Incidents, inc)
+		}
+	}
+	return s, nil
+}
+
+func load(ctx context.Context, c redis.Cmdable, key string) (*Component, error) {
+	data, err := c.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load component status: %w", err)
+	}
+	var comp Component
+	if err := json.Unmarshal(data, &comp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal component status: %w", err)
+	}
+	return &comp, nil
+}
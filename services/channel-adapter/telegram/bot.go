@@ -0,0 +1,212 @@
+// Package telegram is a minimal Bot API client covering what the adapter
+// needs: receiving updates, sending and editing text, photos, inline
+// keyboards and chat actions.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultAPIBase = "https://api.telegram.org"
+
+type User struct {
+	ID           int64  `json:"id"`
+	IsBot        bool   `json:"is_bot"`
+	LanguageCode string `json:"language_code"`
+}
+
+type Chat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Date      int64  `json:"date"`
+	Text      string `json:"text"`
+	Caption   string `json:"caption"`
+}
+
+// CallbackQuery is a tap on an inline keyboard button.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message"`
+	Data    string   `json:"data"`
+}
+
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message"`
+	CallbackQuery *CallbackQuery `json:"callback_query"`
+}
+
+// InlineButton opens URL when set and otherwise sends CallbackData back as a
+// callback query.
+type InlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+type InlineKeyboard struct {
+	Rows [][]InlineButton `json:"inline_keyboard"`
+}
+
+// MaxCallbackData is the limit on a button's callback data, in bytes.
+const MaxCallbackData = 64
+
+// APIError is a Bot API failure. Code is the HTTP-style error_code Telegram
+// returns, which delivery receipts classify.
+type APIError struct {
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram API error %d: %s", e.Code, e.Description)
+}
+
+type Bot struct {
+	base   string
+	client *http.Client
+}
+
+func NewBot(token, apiBase string) *Bot {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Bot{
+		base:   strings.TrimRight(apiBase, "/") + "/bot" + token,
+		client: &http.Client{Timeout: 70 * time.Second},
+	}
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (b *Bot) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", method, err)
+	}
+	// Errors leave out the URL, which holds the bot token
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.base+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", method, withoutURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, withoutURL(err))
+	}
+	defer resp.Body.Close()
+
+	var ar apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if !ar.OK {
+		return &APIError{Code: ar.ErrorCode, Description: ar.Description, RetryAfter: time.Duration(ar.Parameters.RetryAfter) * time.Second}
+	}
+	if out != nil {
+		if err := json.Unmarshal(ar.Result, out); err != nil {
+			return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// withoutURL unwraps a *url.Error, whose text includes the request URL.
+func withoutURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
+
+// MaxMessageLength is the Bot API limit on message text, in characters.
+const MaxMessageLength = 4096
+
+// SendMessage sends text, split into several messages if it is too long.
+// The keyboard, if any, is attached to the last part. It returns the IDs of
+// the messages sent, which are also returned when a later part fails.
+func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string, keyboard *InlineKeyboard) ([]int64, error) {
+	var ids []int64
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(len(runes), MaxMessageLength)
+		params := map[string]interface{}{"chat_id": chatID, "text": string(runes[:n])}
+		if n == len(runes) && keyboard != nil {
+			params["reply_markup"] = keyboard
+		}
+		var sent Message
+		if err := b.call(ctx, "sendMessage", params, &sent); err != nil {
+			return ids, err
+		}
+		ids = append(ids, sent.MessageID)
+		runes = runes[n:]
+	}
+	return ids, nil
+}
+
+// EditMessageText replaces the text of a message the bot sent, removing its
+// keyboard.
+func (b *Bot) EditMessageText(ctx context.Context, chatID, messageID int64, text string) error {
+	return b.call(ctx, "editMessageText", map[string]interface{}{"chat_id": chatID, "message_id": messageID, "text": text}, nil)
+}
+
+// DeleteMessage deletes a message the bot sent. Telegram only allows this
+// for 48 hours.
+func (b *Bot) DeleteMessage(ctx context.Context, chatID, messageID int64) error {
+	return b.call(ctx, "deleteMessage", map[string]interface{}{"chat_id": chatID, "message_id": messageID}, nil)
+}
+
+// SendPhoto sends an image Telegram fetches from url.
+func (b *Bot) SendPhoto(ctx context.Context, chatID int64, url, caption string) error {
+	params := map[string]interface{}{"chat_id": chatID, "photo": url}
+	if caption != "" {
+		params["caption"] = caption
+	}
+	return b.call(ctx, "sendPhoto", params, nil)
+}
+
+// AnswerCallbackQuery stops the loading indicator on a tapped button.
+func (b *Bot) AnswerCallbackQuery(ctx context.Context, id string) error {
+	return b.call(ctx, "answerCallbackQuery", map[string]interface{}{"callback_query_id": id}, nil)
+}
+
+// SendTyping shows the typing indicator for about five seconds.
+func (b *Bot) SendTyping(ctx context.Context, chatID int64) error {
+	return b.call(ctx, "sendChatAction", map[string]interface{}{"chat_id": chatID, "action": "typing"}, nil)
+}
+
+// GetUpdates long-polls for updates after offset.
+func (b *Bot) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	var updates []Update
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &updates)
+	return updates, err
+}
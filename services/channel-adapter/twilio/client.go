@@ -0,0 +1,196 @@
+// Package twilio is a minimal Twilio client: webhook signature validation,
+// SMS segmentation and sending through the REST API, and the TwiML and media
+// stream messages for voice calls.
+package twilio
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultAPIBase = "https://api.twilio.com/2010-04-01"
+
+const (
+	// MaxMessageLength is the longest body Twilio accepts; longer texts are
+	// sent as several messages
+	MaxMessageLength = 1600
+	gsmSegment       = 160
+	gsmConcatSegment = 153
+	ucsSegment       = 70
+	ucsConcatSegment = 67
+)
+
+// gsmChars is the GSM 03.38 basic character set. Text using anything else
+// (e.g. Devanagari) is sent as UCS-2, with far shorter segments.
+const gsmChars = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsmExtended characters take two septets.
+const gsmExtended = "^{}\\[~]|€\f"
+
+// ValidateSignature checks X-Twilio-Signature: an HMAC-SHA1 over the full
+// webhook URL followed by each POST parameter name and value, sorted by name.
+func ValidateSignature(authToken, fullURL string, params url.Values, signature string) bool {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(fullURL)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Segments is how many SMS segments text is billed and delivered as.
+func Segments(text string) int {
+	gsm, units := true, 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsmChars, r):
+			units++
+		case strings.ContainsRune(gsmExtended, r):
+			units += 2
+		default:
+			gsm = false
+		}
+	}
+	if !gsm {
+		units = len([]rune(text))
+		if units <= ucsSegment {
+			return 1
+		}
+		return (units + ucsConcatSegment - 1) / ucsConcatSegment
+	}
+	if units <= gsmSegment {
+		return 1
+	}
+	return (units + gsmConcatSegment - 1) / gsmConcatSegment
+}
+
+// Encoding is "gsm" when text fits the GSM 03.38 alphabet, otherwise "ucs2".
+func Encoding(text string) string {
+	for _, r := range text {
+		if !strings.ContainsRune(gsmChars, r) && !strings.ContainsRune(gsmExtended, r) {
+			return "ucs2"
+		}
+	}
+	return "gsm"
+}
+
+// SegmentLimit is the most characters of text's encoding that fit in one
+// unconcatenated SMS.
+func SegmentLimit(text string) int {
+	if Encoding(text) == "ucs2" {
+		return ucsSegment
+	}
+	return gsmSegment
+}
+
+// Split breaks text into messages of at most limit characters, preferring
+// to break between words.
+func Split(text string, limit int) []string {
+	var parts []string
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == ' ' || runes[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// APIError is a REST failure. Code is Twilio's error code (e.g. 21610 for
+// a recipient who replied STOP), which delivery receipts classify.
+type APIError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("twilio API error %d (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+type Client struct {
+	base       string
+	accountSID string
+	authToken  string
+	client     *http.Client
+}
+
+func NewClient(accountSID, authToken, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{
+		base:       strings.TrimRight(apiBase, "/"),
+		accountSID: accountSID,
+		authToken:  authToken,
+		client:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// AuthToken is used to validate webhook signatures.
+func (c *Client) AuthToken() string {
+	return c.authToken
+}
+
+// SendSMS sends one message and returns its SID. statusCallback, when set,
+// receives delivery status updates for it.
+func (c *Client) SendSMS(ctx context.Context, from, to, body, statusCallback string) (string, error) {
+	form := url.Values{"From": {from}, "To": {to}, "Body": {body}}
+	if statusCallback != "" {
+		form.Set("StatusCallback", statusCallback)
+	}
+	endpoint := c.base + "/Accounts/" + c.accountSID + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(c.accountSID, c.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("messages request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode messages response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", &APIError{Status: resp.StatusCode, Code: out.Code, Message: out.Message}
+	}
+	return out.SID, nil
+}
@@ -0,0 +1,101 @@
+package twilio
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"sort"
+	"strings"
+)
+
+// StreamTwiML answers a voice call by connecting it to a bidirectional media
+// stream at streamURL (wss://). params are passed to the stream's start
+// event as customParameters.
+func StreamTwiML(streamURL string, params map[string]string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Response><Connect><Stream url="`)
+	xml.EscapeText(&b, []byte(streamURL))
+	b.WriteString(`">`)
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(`<Parameter name="`)
+		xml.EscapeText(&b, []byte(k))
+		b.WriteString(`" value="`)
+		xml.EscapeText(&b, []byte(params[k]))
+		b.WriteString(`"/>`)
+	}
+	b.WriteString(`</Stream></Connect></Response>`)
+	return b.String()
+}
+
+// SayTwiML speaks text and hangs up, for calls that cannot be streamed.
+func SayTwiML(text string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Response><Say>`)
+	xml.EscapeText(&b, []byte(text))
+	b.WriteString(`</Say><Hangup/></Response>`)
+	return b.String()
+}
+
+// Media stream events. Audio in both directions is 8kHz mono mu-law, base64
+// encoded.
+const (
+	StreamConnected = "connected"
+	StreamStart     = "start"
+	StreamMedia     = "media"
+	StreamMark      = "mark"
+	StreamStop      = "stop"
+	StreamClear     = "clear"
+)
+
+// StreamEvent is a message on a Twilio media stream WebSocket.
+type StreamEvent struct {
+	Event     string       `json:"event"`
+	StreamSid string       `json:"streamSid,omitempty"`
+	Start     *StreamInfo  `json:"start,omitempty"`
+	Media     *StreamAudio `json:"media,omitempty"`
+	Mark      *StreamLabel `json:"mark,omitempty"`
+}
+
+type StreamInfo struct {
+	StreamSid        string            `json:"streamSid"`
+	CallSid          string            `json:"callSid"`
+	CustomParameters map[string]string `json:"customParameters"`
+}
+
+type StreamAudio struct {
+	Track   string `json:"track,omitempty"`
+	Payload string `json:"payload"`
+}
+
+type StreamLabel struct {
+	Name string `json:"name"`
+}
+
+// Audio decodes an inbound media payload.
+func (e StreamEvent) Audio() ([]byte, error) {
+	if e.Media == nil {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(e.Media.Payload)
+}
+
+// MediaEvent plays mu-law audio to the caller.
+func MediaEvent(streamSid string, audio []byte) StreamEvent {
+	return StreamEvent{Event: StreamMedia, StreamSid: streamSid, Media: &StreamAudio{Payload: base64.StdEncoding.EncodeToString(audio)}}
+}
+
+// MarkEvent is echoed back by Twilio once the audio sent before it has
+// played.
+func MarkEvent(streamSid, name string) StreamEvent {
+	return StreamEvent{Event: StreamMark, StreamSid: streamSid, Mark: &StreamLabel{Name: name}}
+}
+
+// ClearEvent drops audio that has been sent but not yet played, so the
+// caller can interrupt.
+func ClearEvent(streamSid string) StreamEvent {
+	return StreamEvent{Event: StreamClear, StreamSid: streamSid}
+}
@@ -0,0 +1,241 @@
+// Package viber is a minimal Viber REST bot API client: callback payload
+// types, signature verification and sending text messages with keyboards.
+package viber
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultAPIBase = "https://chatapi.viber.com/pa"
+
+const (
+	// MaxMessageLength is Viber's limit on text message bodies.
+	MaxMessageLength = 7000
+	// MaxButtons is the most buttons a keyboard may carry.
+	MaxButtons = 24
+	// maxTrackingData is Viber's limit on tracking_data.
+	maxTrackingData = 4096
+)
+
+// Callback events.
+const (
+	EventWebhook             = "webhook"
+	EventMessage             = "message"
+	EventSubscribed          = "subscribed"
+	EventUnsubscribed        = "unsubscribed"
+	EventConversationStarted = "conversation_started"
+	EventDelivered           = "delivered"
+	EventSeen                = "seen"
+	EventFailed              = "failed"
+)
+
+type User struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Country  string `json:"country"`
+}
+
+type Message struct {
+	Type         string `json:"type"`
+	Text         string `json:"text"`
+	TrackingData string `json:"tracking_data,omitempty"`
+}
+
+// Event is the body of a Viber callback. Which fields are set depends on
+// Event: Sender and Message for messages, User for subscriptions and
+// conversation starts, UserID for receipts and unsubscribes.
+type Event struct {
+	Event        string   `json:"event"`
+	Timestamp    int64    `json:"timestamp"`
+	MessageToken int64    `json:"message_token"`
+	Sender       *User    `json:"sender,omitempty"`
+	User         *User    `json:"user,omitempty"`
+	UserID       string   `json:"user_id,omitempty"`
+	Message      *Message `json:"message,omitempty"`
+	Subscribed   bool     `json:"subscribed,omitempty"`
+	Desc         string   `json:"desc,omitempty"`
+}
+
+// Button is a keyboard button. Tapping a reply button sends ActionBody back
+// as a text message.
+type Button struct {
+	Columns    int    `json:"Columns,omitempty"`
+	Rows       int    `json:"Rows,omitempty"`
+	ActionType string `json:"ActionType"`
+	ActionBody string `json:"ActionBody"`
+	Text       string `json:"Text"`
+	TextSize   string `json:"TextSize,omitempty"`
+}
+
+type Keyboard struct {
+	Type          string   `json:"Type"`
+	DefaultHeight bool     `json:"DefaultHeight"`
+	Buttons       []Button `json:"Buttons"`
+}
+
+// NewKeyboard lays out reply buttons, side by side when there are up to
+// three short labels and one per row otherwise.
+func NewKeyboard(labels, values []string) *Keyboard {
+	n := min(len(labels), MaxButtons)
+	if n == 0 {
+		return nil
+	}
+	cols := 6
+	if n <= 3 {
+		cols = 6 / n
+		for _, l := range labels[:n] {
+			if len([]rune(l)) > 12 {
+				cols = 6
+			}
+		}
+	}
+	kb := &Keyboard{Type: "keyboard", Buttons: make([]Button, n)}
+	for i := 0; i < n; i++ {
+		kb.Buttons[i] = Button{Columns: cols, Rows: 1, ActionType: "reply", ActionBody: values[i], Text: labels[i], TextSize: "regular"}
+	}
+	return kb
+}
+
+// VerifySignature checks X-Viber-Content-Signature, the hex HMAC-SHA256 of
+// the raw body keyed with the bot's auth token.
+func VerifySignature(token string, body []byte, header string) bool {
+	got, err := hex.DecodeString(header)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// APIError is a non-zero Viber status. Code is the Viber status code, which
+// delivery receipts classify (e.g. 6 when the user unsubscribed).
+type APIError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("viber API error %d (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+type Client struct {
+	base       string
+	token      string
+	senderName string
+	client     *http.Client
+}
+
+func NewClient(token, senderName, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{
+		base:       strings.TrimRight(apiBase, "/"),
+		token:      token,
+		senderName: senderName,
+		client:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Welcome is a message to return in the response to a conversation_started
+// callback, which Viber shows before the user subscribes.
+func (c *Client) Welcome(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"sender": map[string]string{"name": c.senderName},
+		"type":   "text",
+		"text":   text,
+	}
+}
+
+// SetWebhook points the bot's callbacks at url. Viber calls url with a
+// webhook event before answering, so the server must already be listening.
+func (c *Client) SetWebhook(ctx context.Context, url string) error {
+	_, err := c.post(ctx, "/set_webhook", map[string]interface{}{
+		"url":         url,
+		"event_types": []string{EventDelivered, EventFailed, EventSubscribed, EventUnsubscribed, EventConversationStarted},
+		"send_name":   true,
+	})
+	return err
+}
+
+// SendText sends text to a Viber user, split into several messages if it is
+// too long. The keyboard, if any, is attached to the last part, and
+// trackingData comes back on the user's next message. It returns the
+// message tokens of the parts sent.
+func (c *Client) SendText(ctx context.Context, to, text string, kb *Keyboard, trackingData string) ([]int64, error) {
+	if len(trackingData) > maxTrackingData {
+		trackingData = ""
+	}
+	var tokens []int64
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(len(runes), MaxMessageLength)
+		payload := map[string]interface{}{
+			"receiver": to,
+			"sender":   map[string]string{"name": c.senderName},
+			"type":     "text",
+			"text":     string(runes[:n]),
+		}
+		if n == len(runes) {
+			if kb != nil {
+				payload["keyboard"] = kb
+			}
+			if trackingData != "" {
+				payload["tracking_data"] = trackingData
+			}
+		}
+		token, err := c.post(ctx, "/send_message", payload)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+		runes = runes[n:]
+	}
+	return tokens, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, payload map[string]interface{}) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Viber-Auth-Token", c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s request failed: %w", strings.TrimPrefix(path, "/"), err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Status        int    `json:"status"`
+		StatusMessage string `json:"status_message"`
+		MessageToken  int64  `json:"message_token"`
+	}
+	if resp.StatusCode >= 300 {
+		return 0, &APIError{Status: resp.StatusCode, Code: resp.StatusCode, Message: resp.Status}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("failed to decode %s response: %w", strings.TrimPrefix(path, "/"), err)
+	}
+	if out.Status != 0 {
+		return 0, &APIError{Status: resp.StatusCode, Code: out.Status, Message: out.StatusMessage}
+	}
+	return out.MessageToken, nil
+}
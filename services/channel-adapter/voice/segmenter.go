@@ -0,0 +1,122 @@
+package voice
+
+import (
+	"math"
+	"time"
+)
+
+// Utterance detection tunables. A frame is speech when its RMS level is at
+// least SpeechLevel (of 32767); an utterance starts after SpeechStart of
+// speech and ends after SilenceEnd of silence, or at MaxUtterance.
+var (
+	SpeechLevel  = 600.0
+	SpeechStart  = 60 * time.Millisecond
+	SilenceEnd   = 800 * time.Millisecond
+	MaxUtterance = 15 * time.Second
+)
+
+const frameDuration = 20 * time.Millisecond
+
+// Segmenter splits a caller's audio into utterances by energy. It is not
+// safe for concurrent use.
+type Segmenter struct {
+	buf      []byte
+	pending  []byte
+	speaking bool
+	voiced   time.Duration
+	silent   time.Duration
+}
+
+func NewSegmenter() *Segmenter {
+	return &Segmenter{}
+}
+
+// Speaking reports whether the caller is mid-utterance, for barge-in.
+func (s *Segmenter) Speaking() bool {
+	return s.speaking
+}
+
+// Write feeds audio and returns the utterances it completed.
+func (s *Segmenter) Write(audio []byte) [][]byte {
+	s.pending = append(s.pending, audio...)
+	var out [][]byte
+	for len(s.pending) >= FrameBytes {
+		frame := s.pending[:FrameBytes]
+		if u := s.frame(frame); u != nil {
+			out = append(out, u)
+		}
+		s.pending = s.pending[FrameBytes:]
+	}
+	return out
+}
+
+// Flush returns any utterance in progress, e.g. when the call ends.
+func (s *Segmenter) Flush() []byte {
+	if !s.speaking {
+		return nil
+	}
+	return s.end()
+}
+
+func (s *Segmenter) frame(frame []byte) []byte {
+	voiced := rms(frame) >= SpeechLevel
+	if !s.speaking {
+		if !voiced {
+			s.voiced = 0
+			s.buf = s.buf[:0]
+			return nil
+		}
+		// Keep the onset so the first syllable isn't clipped
+		s.buf = append(s.buf, frame...)
+		s.voiced += frameDuration
+		if s.voiced >= SpeechStart {
+			s.speaking = true
+			s.silent = 0
+		}
+		return nil
+	}
+
+	s.buf = append(s.buf, frame...)
+	if voiced {
+		s.silent = 0
+	} else {
+		s.silent += frameDuration
+	}
+	length := time.Duration(len(s.buf)/FrameBytes) * frameDuration
+	if s.silent >= SilenceEnd || length >= MaxUtterance {
+		return s.end()
+	}
+	return nil
+}
+
+func (s *Segmenter) end() []byte {
+	u := make([]byte, len(s.buf))
+	copy(u, s.buf)
+	s.buf = s.buf[:0]
+	s.speaking = false
+	s.voiced = 0
+	s.silent = 0
+	return u
+}
+
+func rms(frame []byte) float64 {
+	var sum float64
+	for _, b := range frame {
+		v := float64(decodeMulaw(b))
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
+
+// decodeMulaw converts a G.711 mu-law sample to 16-bit linear PCM.
+func decodeMulaw(u byte) int16 {
+	u = ^u
+	exponent := (u >> 4) & 0x07
+	mantissa := int(u & 0x0F)
+	sample := ((mantissa << 3) + 0x84) << exponent
+	sample -= 0x84
+	if u&0x80 != 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
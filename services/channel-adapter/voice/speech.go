@@ -0,0 +1,124 @@
+// Package voice holds the speech hooks for the telephony channel: detecting
+// utterances in caller audio, and the STT and TTS services that turn them
+// into text and answers back into audio. Audio is 8kHz mono mu-law, the
+// format of Twilio media streams, so nothing is resampled here.
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	SampleRate = 8000
+	// FrameBytes is 20ms of mu-law audio, the size Twilio sends and expects
+	FrameBytes = 160
+
+	maxSpeechBytes = 8 << 20
+)
+
+// Transcriber converts an utterance to text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, language string) (string, error)
+}
+
+// Synthesizer converts text to mu-law audio.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text, language string) ([]byte, error)
+}
+
+// HTTPTranscriber posts raw mu-law audio (Content-Type audio/basic) to a
+// speech-to-text service, with sample_rate and language query parameters,
+// and expects {"text": "..."} back.
+type HTTPTranscriber struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewHTTPTranscriber(url string) *HTTPTranscriber {
+	return &HTTPTranscriber{url: url, httpClient: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (t *HTTPTranscriber) Transcribe(ctx context.Context, audio []byte, language string) (string, error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return "", fmt.Errorf("invalid STT URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("sample_rate", fmt.Sprint(SampleRate))
+	q.Set("language", language)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(audio))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "audio/basic")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("STT request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("STT returned %d: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode STT response: %w", err)
+	}
+	return out.Text, nil
+}
+
+// HTTPSynthesizer posts {"text","voice","language","format":"mulaw",
+// "sample_rate":8000} to a text-to-speech service and expects raw mu-law
+// audio back.
+type HTTPSynthesizer struct {
+	url        string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewHTTPSynthesizer(url, voice string) *HTTPSynthesizer {
+	return &HTTPSynthesizer{url: url, voice: voice, httpClient: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (s *HTTPSynthesizer) Synthesize(ctx context.Context, text, language string) ([]byte, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"text":        text,
+		"voice":       s.voice,
+		"language":    language,
+		"format":      "mulaw",
+		"sample_rate": SampleRate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TTS request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("TTS returned %d: %s", resp.StatusCode, msg)
+	}
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, maxSpeechBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TTS audio: %w", err)
+	}
+	return audio, nil
+}
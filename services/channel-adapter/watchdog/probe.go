@@ -0,0 +1,160 @@
+// Package watchdog probes the full message path end to end: it publishes a
+// synthetic envelope to the inbound stream, the orchestrator answers it from
+// a built-in mock backend, and the reply must arrive back on pub/sub.
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"channel-adapter/metrics"
+	"channel-adapter/models"
+	"channel-adapter/redisconn"
+)
+
+const (
+	streamKey     = "msg:inbound"
+	probeSession  = "probe-"
+	failThreshold = 3
+)
+
+var (
+	probesTotal = metrics.NewCounterVec("channel_adapter_pipeline_probes_total",
+		"End-to-end pipeline probes by outcome.", "outcome")
+	probeLatency = metrics.NewHistogramVec("channel_adapter_pipeline_probe_latency_seconds",
+		"Round-trip latency of successful pipeline probes.", metrics.DefBuckets)
+	pipelineHealthy = metrics.NewGaugeVec("channel_adapter_pipeline_healthy",
+		"1 if the most recent pipeline probes succeeded, 0 otherwise.")
+)
+
+// Status is the latest probe result, reported on /readyz.
+type Status struct {
+	Healthy   bool      `json:"healthy"`
+	LastProbe time.Time `json:"last_probe,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	Failures  int       `json:"consecutive_failures"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type Watchdog struct {
+	rdb      *redis.Client
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	status Status
+}
+
+func NewWatchdog(rdb *redis.Client, interval, timeout time.Duration) *Watchdog {
+	return &Watchdog{rdb: rdb, interval: interval, timeout: timeout}
+}
+
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.record(w.Probe(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status reports health. The pipeline stays healthy through isolated
+// failures and is unhealthy after failThreshold in a row, or if probes have
+// stopped running.
+func (w *Watchdog) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := w.status
+	if !st.LastProbe.IsZero() && time.Since(st.LastProbe) > 3*w.interval+w.timeout {
+		st.Healthy = false
+		st.LastError = "probes are stale"
+	}
+	return st
+}
+
+func (w *Watchdog) record(latency time.Duration, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.LastProbe = time.Now().UTC()
+	if err != nil {
+		probesTotal.Inc("error")
+		log.Printf("Pipeline probe failed: %v", err)
+		w.status.Failures++
+		w.status.LastError = err.Error()
+	} else {
+		probesTotal.Inc("ok")
+		probeLatency.Observe(latency.Seconds())
+		w.status.Failures = 0
+		w.status.LastError = ""
+		w.status.LatencyMs = latency.Milliseconds()
+	}
+	w.status.Healthy = w.status.Failures < failThreshold
+	if w.status.Healthy {
+		pipelineHealthy.Set(1)
+	} else {
+		pipelineHealthy.Set(0)
+	}
+}
+
+// Probe sends one synthetic message and waits for its reply.
+func (w *Watchdog) Probe(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	sessionID := probeSession + uuid.New().String()
+	pubsub := w.rdb.Subscribe(ctx, "response:"+sessionID)
+	defer pubsub.Close()
+	// Wait for the subscription to be active so the reply can't be missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return 0, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	envelope := models.MessageEnvelope{
+		MessageID: uuid.New().String(),
+		SessionID: sessionID,
+		Channel:   "probe",
+		UserID:    "anonymous",
+		Timestamp: time.Now().UTC(),
+		Content:   models.MessageContent{Type: "text", Text: "probe"},
+		Probe:     true,
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal probe: %w", err)
+	}
+
+	start := time.Now()
+	if err := w.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		return 0, fmt.Errorf("failed to publish probe: %w", err)
+	}
+
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("no reply within %s", w.timeout)
+		case msg := <-ch:
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				continue
+			}
+			if resp.Type == "probe" && resp.Text == envelope.MessageID {
+				return time.Since(start), nil
+			}
+		}
+	}
+}
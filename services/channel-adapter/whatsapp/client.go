@@ -0,0 +1,197 @@
+// Package whatsapp is a minimal WhatsApp Business Cloud API client: webhook
+// payload types, signature verification and sending text messages through
+// the Graph API.
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultAPIBase = "https://graph.facebook.com/v20.0"
+
+// MaxMessageLength is the Cloud API limit on text message bodies.
+const MaxMessageLength = 4096
+
+type Text struct {
+	Body string `json:"body"`
+}
+
+type Message struct {
+	From      string `json:"from"`
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Text      *Text  `json:"text,omitempty"`
+}
+
+type Contact struct {
+	WaID    string `json:"wa_id"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+type StatusError struct {
+	Code  int    `json:"code"`
+	Title string `json:"title"`
+}
+
+// Status reports the fate of a message we sent: sent, delivered, read or
+// failed.
+type Status struct {
+	ID          string        `json:"id"`
+	Status      string        `json:"status"`
+	RecipientID string        `json:"recipient_id"`
+	Errors      []StatusError `json:"errors,omitempty"`
+}
+
+type Value struct {
+	Metadata struct {
+		PhoneNumberID string `json:"phone_number_id"`
+	} `json:"metadata"`
+	Contacts []Contact `json:"contacts,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+	Statuses []Status  `json:"statuses,omitempty"`
+}
+
+// Webhook is the body of a Cloud API webhook notification.
+type Webhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string `json:"field"`
+			Value Value  `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header Meta computes over
+// the raw body with the app secret.
+func VerifySignature(appSecret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// APIError is a Graph API failure. Code is the Cloud API error code, which
+// delivery receipts classify (e.g. 131047 for an expired session window).
+type APIError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("whatsapp API error %d (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+type Client struct {
+	base          string
+	token         string
+	phoneNumberID string
+	client        *http.Client
+}
+
+func NewClient(token, phoneNumberID, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{
+		base:          strings.TrimRight(apiBase, "/"),
+		token:         token,
+		phoneNumberID: phoneNumberID,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SendText sends text to the WhatsApp user, split into several messages if it
+// is too long. It returns the WhatsApp message IDs of the parts sent.
+func (c *Client) SendText(ctx context.Context, to, text string) ([]string, error) {
+	var ids []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := min(len(runes), MaxMessageLength)
+		id, err := c.send(ctx, map[string]interface{}{
+			"messaging_product": "whatsapp",
+			"recipient_type":    "individual",
+			"to":                to,
+			"type":              "text",
+			"text":              map[string]interface{}{"body": string(runes[:n]), "preview_url": false},
+		})
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+		runes = runes[n:]
+	}
+	return ids, nil
+}
+
+// MarkRead marks an inbound message as read, showing blue ticks to the user.
+func (c *Client) MarkRead(ctx context.Context, messageID string) error {
+	_, err := c.send(ctx, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"status":            "read",
+		"message_id":        messageID,
+	})
+	return err
+}
+
+func (c *Client) send(ctx context.Context, payload map[string]interface{}) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/"+c.phoneNumberID+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("messages request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+		Error *struct {
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode messages response: %w", err)
+	}
+	if out.Error != nil {
+		return "", &APIError{Status: resp.StatusCode, Code: out.Error.Code, Message: out.Error.Message}
+	}
+	if resp.StatusCode >= 300 {
+		return "", &APIError{Status: resp.StatusCode, Code: resp.StatusCode, Message: resp.Status}
+	}
+	if len(out.Messages) == 0 {
+		return "", nil
+	}
+	return out.Messages[0].ID, nil
+}
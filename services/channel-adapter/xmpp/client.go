@@ -0,0 +1,464 @@
+// Package xmpp is a minimal XMPP client (RFC 6120/6121) for the bot: it
+// logs in over STARTTLS with SASL PLAIN, accepts every presence
+// subscription so users can add the bot to their roster, and passes on chat
+// messages.
+package xmpp
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	nsStream  = "http://etherx.jabber.org/streams"
+	nsTLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsSASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsBind    = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsSession = "urn:ietf:params:xml:ns:xmpp-session"
+
+	dialTimeout = 15 * time.Second
+	// Whitespace keepalives stop NATs and servers from dropping an idle
+	// stream, and surface dead connections as write errors
+	keepalive = time.Minute
+)
+
+// Message is an incoming chat message. From is the sender's full JID.
+type Message struct {
+	From string
+	Text string
+}
+
+type Config struct {
+	// JID is the bot's bare JID, e.g. maya@example.com.
+	JID      string
+	Password string
+	Resource string
+	// Addr overrides the server found through the domain's SRV records.
+	Addr string
+	// DirectTLS connects with TLS straight away (XEP-0368, usually port
+	// 5223) instead of upgrading with STARTTLS.
+	DirectTLS bool
+}
+
+// Client keeps a stream open, reconnecting with backoff after drops.
+type Client struct {
+	cfg       Config
+	domain    string
+	onMessage func(context.Context, Message)
+
+	mu   sync.Mutex
+	conn net.Conn
+	jid  string
+}
+
+func NewClient(cfg Config, onMessage func(context.Context, Message)) (*Client, error) {
+	local, domain, ok := strings.Cut(Bare(cfg.JID), "@")
+	if !ok || local == "" || domain == "" {
+		return nil, fmt.Errorf("invalid JID %q", cfg.JID)
+	}
+	if cfg.Resource == "" {
+		cfg.Resource = "maya"
+	}
+	return &Client{cfg: cfg, domain: domain, onMessage: onMessage}, nil
+}
+
+// Bare strips the resource from a JID and lowercases it; the local part and
+// domain are case-insensitive.
+func Bare(jid string) string {
+	bare, _, _ := strings.Cut(jid, "/")
+	return strings.ToLower(bare)
+}
+
+// Run connects and reconnects until ctx is done.
+func (c *Client) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("XMPP connection for %s lost, reconnecting in %s: %v", c.cfg.JID, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 5*time.Minute)
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	addr := c.cfg.Addr
+	if addr == "" {
+		addr = net.JoinHostPort(c.domain, "5222")
+		service := "xmpp-client"
+		if c.cfg.DirectTLS {
+			addr, service = net.JoinHostPort(c.domain, "5223"), "xmpps-client"
+		}
+		if _, srvs, err := net.DefaultResolver.LookupSRV(ctx, service, "tcp", c.domain); err == nil && len(srvs) > 0 {
+			addr = net.JoinHostPort(strings.TrimSuffix(srvs[0].Target, "."), fmt.Sprint(srvs[0].Port))
+		}
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if c.cfg.DirectTLS {
+		return tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.domain})
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+func (c *Client) session(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() { c.current().Close() }()
+	c.setConn(conn)
+	stop := context.AfterFunc(ctx, func() { c.current().Close() })
+	defer stop()
+
+	dec, err := c.negotiate()
+	if err != nil {
+		return err
+	}
+	log.Printf("XMPP connected as %s", c.JID())
+	if err := c.write("<presence/>"); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(keepalive)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				c.write(" ")
+			}
+		}
+	}()
+
+	for {
+		start, err := nextStart(dec)
+		if err != nil {
+			return err
+		}
+		if err := c.handle(ctx, dec, start); err != nil {
+			return err
+		}
+	}
+}
+
+// negotiate takes a fresh connection through STARTTLS, authentication and
+// resource binding, and returns the decoder positioned for stanzas.
+func (c *Client) negotiate() (*xml.Decoder, error) {
+	dec, f, err := c.openStream()
+	if err != nil {
+		return nil, err
+	}
+	if !c.cfg.DirectTLS {
+		if f.StartTLS == nil {
+			return nil, errors.New("server does not offer STARTTLS")
+		}
+		if err := c.write("<starttls xmlns='" + nsTLS + "'/>"); err != nil {
+			return nil, err
+		}
+		start, err := nextStart(dec)
+		if err != nil {
+			return nil, err
+		}
+		if start.Name.Local != "proceed" {
+			return nil, errors.New("server refused STARTTLS")
+		}
+		tlsConn := tls.Client(c.current(), &tls.Config{ServerName: c.domain})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		c.setConn(tlsConn)
+		if dec, f, err = c.openStream(); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Mechanisms == nil || !contains(f.Mechanisms.Mechanism, "PLAIN") {
+		return nil, errors.New("server does not offer SASL PLAIN")
+	}
+	local, _, _ := strings.Cut(Bare(c.cfg.JID), "@")
+	creds := base64.StdEncoding.EncodeToString([]byte("\x00" + local + "\x00" + c.cfg.Password))
+	if err := c.write("<auth xmlns='" + nsSASL + "' mechanism='PLAIN'>" + creds + "</auth>"); err != nil {
+		return nil, err
+	}
+	start, err := nextStart(dec)
+	if err != nil {
+		return nil, err
+	}
+	if start.Name.Local != "success" {
+		return nil, errors.New("authentication failed")
+	}
+	dec.Skip()
+	if dec, f, err = c.openStream(); err != nil {
+		return nil, err
+	}
+
+	if f.Bind == nil {
+		return nil, errors.New("server does not offer resource binding")
+	}
+	if err := c.write("<iq type='set' id='bind'><bind xmlns='" + nsBind + "'><resource>" + escape(c.cfg.Resource) + "</resource></bind></iq>"); err != nil {
+		return nil, err
+	}
+	var res iq
+	if err := decodeNext(dec, &res); err != nil {
+		return nil, err
+	}
+	if res.Type != "result" || res.Bind == nil {
+		return nil, errors.New("resource binding failed")
+	}
+	c.mu.Lock()
+	c.jid = res.Bind.JID
+	c.mu.Unlock()
+	// Legacy session establishment, still required by some older servers
+	if f.Session != nil && f.Session.Optional == nil {
+		if err := c.write("<iq type='set' id='session'><session xmlns='" + nsSession + "'/></iq>"); err != nil {
+			return nil, err
+		}
+	}
+	return dec, nil
+}
+
+// openStream sends a stream header and reads the server's features.
+func (c *Client) openStream() (*xml.Decoder, *features, error) {
+	header := "<?xml version='1.0'?><stream:stream to='" + escape(c.domain) +
+		"' xmlns='jabber:client' xmlns:stream='" + nsStream + "' version='1.0'>"
+	if err := c.write(header); err != nil {
+		return nil, nil, err
+	}
+	dec := xml.NewDecoder(c.current())
+	start, err := nextStart(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if start.Name.Space != nsStream || start.Name.Local != "stream" {
+		return nil, nil, fmt.Errorf("unexpected <%s> instead of a stream", start.Name.Local)
+	}
+	var f features
+	if err := decodeNext(dec, &f); err != nil {
+		return nil, nil, fmt.Errorf("failed to read stream features: %w", err)
+	}
+	return dec, &f, nil
+}
+
+func (c *Client) handle(ctx context.Context, dec *xml.Decoder, start xml.StartElement) error {
+	switch start.Name.Local {
+	case "message":
+		var m message
+		if err := dec.DecodeElement(&m, &start); err != nil {
+			return err
+		}
+		if msg, ok := m.chat(c.cfg.JID); ok {
+			go c.onMessage(ctx, msg)
+		}
+	case "presence":
+		var p presence
+		if err := dec.DecodeElement(&p, &start); err != nil {
+			return err
+		}
+		return c.handlePresence(p)
+	case "iq":
+		var q iq
+		if err := dec.DecodeElement(&q, &start); err != nil {
+			return err
+		}
+		switch {
+		case q.Type == "get" && q.Ping != nil:
+			return c.write("<iq type='result' id='" + escape(q.ID) + "' to='" + escape(q.From) + "'/>")
+		case q.Type == "get" || q.Type == "set":
+			// Every request must be answered, even ones we don't support
+			return c.write("<iq type='error' id='" + escape(q.ID) + "' to='" + escape(q.From) + "'><error type='cancel'>" +
+				"<service-unavailable xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'/></error></iq>")
+		}
+	case "error":
+		if start.Name.Space == nsStream {
+			var e streamError
+			dec.DecodeElement(&e, &start)
+			return fmt.Errorf("stream error: %s", e.condition())
+		}
+		return dec.Skip()
+	default:
+		return dec.Skip()
+	}
+	return nil
+}
+
+// handlePresence approves subscription requests and subscribes back, so the
+// bot shows up online in the user's roster.
+func (c *Client) handlePresence(p presence) error {
+	to := escape(Bare(p.From))
+	switch p.Type {
+	case "subscribe":
+		log.Printf("XMPP subscription from %s accepted", Bare(p.From))
+		if err := c.write("<presence to='" + to + "' type='subscribed'/>"); err != nil {
+			return err
+		}
+		return c.write("<presence to='" + to + "' type='subscribe'/>")
+	case "unsubscribe":
+		return c.write("<presence to='" + to + "' type='unsubscribed'/>")
+	}
+	return nil
+}
+
+// Send delivers a chat message to jid.
+func (c *Client) Send(jid, text string) error {
+	return c.write("<message to='" + escape(jid) + "' type='chat' id='" + uuid.New().String() + "'><body>" + escape(text) + "</body></message>")
+}
+
+// JID is the full JID the server bound for this connection.
+func (c *Client) JID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.jid
+}
+
+func (c *Client) current() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+func (c *Client) setConn(conn net.Conn) {
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+}
+
+func (c *Client) write(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+func nextStart(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, errors.New("server closed the stream")
+			}
+		}
+	}
+}
+
+func decodeNext(dec *xml.Decoder, v interface{}) error {
+	start, err := nextStart(dec)
+	if err != nil {
+		return err
+	}
+	return dec.DecodeElement(v, &start)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type features struct {
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms *struct {
+		Mechanism []string `xml:"mechanism"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind    *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session *struct {
+		Optional *struct{} `xml:"optional"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+}
+
+type message struct {
+	From string `xml:"from,attr"`
+	Type string `xml:"type,attr"`
+	Body string `xml:"body"`
+}
+
+// chat returns the message if it is one for botJID to answer. Chat states
+// and receipts arrive as messages without a body; group chat is not
+// supported.
+func (m message) chat(botJID string) (Message, bool) {
+	if m.Body == "" || m.Type == "error" || m.Type == "groupchat" || Bare(m.From) == Bare(botJID) {
+		return Message{}, false
+	}
+	return Message{From: m.From, Text: m.Body}, true
+}
+
+// ParseMessage decodes a single <message/> stanza as botJID would receive
+// it, reporting false for stanzas it would not answer.
+func ParseMessage(stanza []byte, botJID string) (Message, bool, error) {
+	var m message
+	if err := xml.Unmarshal(stanza, &m); err != nil {
+		return Message{}, false, fmt.Errorf("invalid stanza: %w", err)
+	}
+	msg, ok := m.chat(botJID)
+	return msg, ok, nil
+}
+
+type presence struct {
+	From string `xml:"from,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type iq struct {
+	ID   string `xml:"id,attr"`
+	From string `xml:"from,attr"`
+	Type string `xml:"type,attr"`
+	Bind *struct {
+		JID string `xml:"jid"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Ping *struct{} `xml:"urn:xmpp:ping ping"`
+}
+
+type streamError struct {
+	Inner []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (e streamError) condition() string {
+	for _, in := range e.Inner {
+		if in.XMLName.Local != "text" {
+			return in.XMLName.Local
+		}
+	}
+	return "unknown"
+}
@@ -1,13 +1,19 @@
+import json
 import logging
 import os
+import re
 from fastapi import APIRouter, HTTPException, Header, UploadFile, File, BackgroundTasks
+from fastapi.responses import StreamingResponse
+from starlette.concurrency import iterate_in_threadpool
 import tempfile
 import shutil
 
-from schemas.message import ChatRequest, ChatResponse
-from rag.pipeline import run_pipeline
+from schemas.message import ChatRequest, ChatResponse, EvaluateRequest, EvaluateResponse, EmbedRequest, EmbedResponse, SummarizeRequest, SummarizeResponse, ClassifyRequest, ClassifyResponse
+from rag.pipeline import run_pipeline, stream_pipeline, structure_answer
 from rag.ingestion import ingest_file
+from rag.embeddings import GeminiRESTEmbeddings
 from llm.client import get_llm
+from llm.judge import judge_response
 
 logger = logging.getLogger(__name__)
 
@@ -27,11 +33,29 @@ async def chat(request: ChatRequest):
         result = await run_pipeline(
             message=request.message,
             conversation_history=history,
+            fast=request.fast,
+            session_summary=request.session_summary,
+            page_context=request.page_context.model_dump() if request.page_context else None,
+            tone=request.tone,
+            max_sentences=request.max_sentences,
+            decompose=request.decompose,
+            attachments=[a.model_dump() for a in request.attachments],
+            time_zone=request.time_zone,
+            local_time=request.local_time,
+            operator_notes=request.operator_notes,
         )
     except Exception as e:
         logger.error(f"Pipeline error: {e}", exc_info=True)
         raise HTTPException(status_code=500, detail="Failed to generate response")
 
+    structured = None
+    if request.response_schema:
+        try:
+            structured = await structure_answer(request.message, result["response"], request.response_schema)
+        except Exception as e:
+            logger.error(f"Structured output error: {e}", exc_info=True)
+            raise HTTPException(status_code=422, detail="Failed to produce structured output")
+
     llm = get_llm()
     model_name = getattr(llm, "model", None) or getattr(llm, "model_name", "unknown")
 
@@ -40,9 +64,134 @@ async def chat(request: ChatRequest):
         response=result["response"],
         sources=result["sources"],
         model_used=str(model_name),
+        structured=structured,
+        usage=result.get("usage"),
     )
 
 
+@router.post("/chat/stream")
+async def chat_stream(request: ChatRequest):
+    """Answer like /chat, streamed as newline-delimited JSON: {"delta": ...}
+    objects as the answer is generated, then the ChatResponse fields with
+    "done": true, or {"error": ...} if generation fails midway. A structured
+    answer is built from the whole answer and sent in the done event.
+    Decomposition needs the whole answer, so it isn't offered."""
+    llm = get_llm()
+    model_name = getattr(llm, "model", None) or getattr(llm, "model_name", "unknown")
+
+    async def events():
+        try:
+            async for event in iterate_in_threadpool(stream_pipeline(
+                message=request.message,
+                conversation_history=[msg.model_dump() for msg in request.conversation_history],
+                fast=request.fast,
+                session_summary=request.session_summary,
+                page_context=request.page_context.model_dump() if request.page_context else None,
+                tone=request.tone,
+                max_sentences=request.max_sentences,
+                attachments=[a.model_dump() for a in request.attachments],
+                time_zone=request.time_zone,
+                local_time=request.local_time,
+                operator_notes=request.operator_notes,
+            )):
+                if event.get("done"):
+                    event = {**event, "session_id": request.session_id, "model_used": str(model_name)}
+                    if request.response_schema:
+                        try:
+                            event["structured"] = await structure_answer(request.message, event["response"], request.response_schema)
+                        except Exception as e:
+                            logger.error(f"Structured output error: {e}", exc_info=True)
+                            yield json.dumps({"error": "Failed to produce structured output"}) + "\n"
+                            return
+                yield json.dumps(event) + "\n"
+        except Exception as e:
+            logger.error(f"Pipeline error: {e}", exc_info=True)
+            yield json.dumps({"error": "Failed to generate response"}) + "\n"
+
+    return StreamingResponse(events(), media_type="application/x-ndjson")
+
+
+@router.post("/evaluate", response_model=EvaluateResponse)
+async def evaluate(request: EvaluateRequest):
+    try:
+        result = judge_response(request.question, request.answer, request.sources)
+    except Exception as e:
+        logger.error(f"Evaluation error: {e}", exc_info=True)
+        raise HTTPException(status_code=500, detail="Failed to evaluate response")
+
+    return EvaluateResponse(**result)
+
+
+SUMMARIZE_PROMPT = """Shorten this answer from Maya, the Mandala Foods assistant, so it fits in
+{max_chars} characters for an SMS. Keep the facts that answer the question, drop greetings
+and formatting, and write plain text in the same language.
+
+Answer: {text}"""
+
+
+@router.post("/summarize", response_model=SummarizeResponse)
+async def summarize(request: SummarizeRequest):
+    try:
+        result = get_llm(fast=True).invoke(
+            SUMMARIZE_PROMPT.format(max_chars=request.max_chars, text=request.text)
+        )
+    except Exception as e:
+        logger.error(f"Summarize error: {e}", exc_info=True)
+        raise HTTPException(status_code=500, detail="Failed to summarize")
+
+    text = result.content if isinstance(result.content, str) else str(result.content)
+    return SummarizeResponse(summary=text.strip())
+
+
+CLASSIFY_PROMPT = """Classify the intent of this message sent to Maya, the Mandala Foods
+assistant. Choose exactly one label from: {labels}.
+
+Respond with JSON only: {{"label": "<label>", "confidence": <0.0-1.0>}}
+
+Message: {text}"""
+
+
+@router.post("/classify", response_model=ClassifyResponse)
+async def classify(request: ClassifyRequest):
+    if not request.labels:
+        raise HTTPException(status_code=400, detail="labels are required")
+    try:
+        result = get_llm(fast=True).invoke(
+            CLASSIFY_PROMPT.format(labels=", ".join(request.labels), text=request.text)
+        )
+    except Exception as e:
+        logger.error(f"Classify error: {e}", exc_info=True)
+        raise HTTPException(status_code=500, detail="Failed to classify message")
+
+    text = result.content if isinstance(result.content, str) else str(result.content)
+    match = re.search(r"\{.*\}", text, re.DOTALL)
+    try:
+        data = json.loads(match.group(0)) if match else {}
+        label = str(data.get("label", "")).strip()
+        confidence = float(data.get("confidence", 0.0))
+    except (ValueError, AttributeError, TypeError):
+        label, confidence = "", 0.0
+
+    # The model may answer outside the taxonomy; the caller maps that to its
+    # fallback label
+    if label not in request.labels:
+        return ClassifyResponse(label="", confidence=0.0)
+    return ClassifyResponse(label=label, confidence=max(0.0, min(1.0, confidence)))
+
+
+@router.post("/embed", response_model=EmbedResponse)
+async def embed(request: EmbedRequest):
+    if len(request.texts) > 100:
+        raise HTTPException(status_code=400, detail="At most 100 texts per request")
+    try:
+        vectors = GeminiRESTEmbeddings().embed_for_clustering(request.texts)
+    except Exception as e:
+        logger.error(f"Embedding error: {e}", exc_info=True)
+        raise HTTPException(status_code=500, detail="Failed to embed texts")
+
+    return EmbedResponse(embeddings=vectors)
+
+
 @router.post("/admin/ingest")
 async def admin_ingest(
     background_tasks: BackgroundTasks,
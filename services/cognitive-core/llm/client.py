@@ -2,14 +2,21 @@ import os
 from langchain_core.language_models import BaseChatModel
 
 
-def get_llm() -> BaseChatModel:
+def _model(env: str, default: str, fast: bool) -> str:
+    """FAST_MODEL, when set, overrides the provider model for fast-path requests."""
+    if fast and os.getenv("FAST_MODEL"):
+        return os.getenv("FAST_MODEL")
+    return os.getenv(env, default)
+
+
+def get_llm(fast: bool = False) -> BaseChatModel:
     """Factory function to get the LLM based on LLM_PROVIDER env var."""
     provider = os.getenv("LLM_PROVIDER", "anthropic").lower()
 
     if provider == "anthropic":
         from langchain_anthropic import ChatAnthropic
         return ChatAnthropic(
-            model=os.getenv("ANTHROPIC_MODEL", "claude-sonnet-4-20250514"),
+            model=_model("ANTHROPIC_MODEL", "claude-sonnet-4-20250514", fast),
             api_key=os.getenv("ANTHROPIC_API_KEY"),
             temperature=0.3,
             max_tokens=1024,
@@ -17,7 +24,7 @@ def get_llm() -> BaseChatModel:
     elif provider == "openai":
         from langchain_openai import ChatOpenAI
         return ChatOpenAI(
-            model=os.getenv("OPENAI_MODEL", "gpt-4o-mini"),
+            model=_model("OPENAI_MODEL", "gpt-4o-mini", fast),
             api_key=os.getenv("OPENAI_API_KEY"),
             temperature=0.3,
             max_tokens=1024,
@@ -25,7 +32,7 @@ def get_llm() -> BaseChatModel:
     elif provider == "gemini":
         from langchain_google_genai import ChatGoogleGenerativeAI
         return ChatGoogleGenerativeAI(
-            model=os.getenv("GEMINI_MODEL", "gemini-2.0-flash"),
+            model=_model("GEMINI_MODEL", "gemini-2.0-flash", fast),
             google_api_key=os.getenv("GOOGLE_API_KEY"),
             temperature=0.3,
             max_output_tokens=1024,
@@ -33,7 +40,7 @@ def get_llm() -> BaseChatModel:
     elif provider == "claude-code":
         from langchain_openai import ChatOpenAI
         return ChatOpenAI(
-            model=os.getenv("CLAUDE_CODE_MODEL", "claude-sonnet-4-6"),
+            model=_model("CLAUDE_CODE_MODEL", "claude-sonnet-4-6", fast),
             base_url=os.getenv("CLAUDE_CODE_BASE_URL", "https://claude.mandalafoods.co/v1"),
             api_key=os.getenv("CLAUDE_CODE_API_KEY", "dummy"),
             temperature=0.3,
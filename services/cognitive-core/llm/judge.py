@@ -0,0 +1,44 @@
+import json
+import logging
+import re
+
+from llm.client import get_llm
+
+logger = logging.getLogger(__name__)
+
+JUDGE_PROMPT = """You are reviewing answers given by Maya, a nutrition assistant for Mandala Foods Nepal.
+Rate the answer to the user's question on a scale from 1 (unusable) to 5 (excellent), considering
+relevance, factual grounding in the cited sources, and helpfulness. Penalize invented facts, links
+or phone numbers.
+
+Question: {question}
+
+Cited sources: {sources}
+
+Answer: {answer}
+
+Reply with JSON only: {{"score": <1-5>, "reasoning": "<one sentence>"}}"""
+
+
+def judge_response(question: str, answer: str, sources: list[str]) -> dict:
+    """Ask the LLM to grade an answer. Returns {"score": float 0-1, "reasoning": str}."""
+    llm = get_llm()
+    prompt = JUDGE_PROMPT.format(
+        question=question,
+        answer=answer,
+        sources=", ".join(sources) if sources else "none",
+    )
+    result = llm.invoke(prompt)
+    text = result.content if isinstance(result.content, str) else str(result.content)
+
+    match = re.search(r"\{.*\}", text, re.DOTALL)
+    if not match:
+        raise ValueError(f"Judge returned no JSON: {text[:200]}")
+    data = json.loads(match.group(0))
+
+    score = float(data.get("score", 0))
+    score = min(max(score, 1.0), 5.0)
+    return {
+        "score": (score - 1.0) / 4.0,
+        "reasoning": str(data.get("reasoning", "")),
+    }
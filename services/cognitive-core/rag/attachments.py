@@ -0,0 +1,82 @@
+"""Turn files the user uploaded into text the retrieval chain can use.
+
+Images are described by a vision-capable LLM call, and the text of PDFs and
+plain text files is extracted, so the rest of the pipeline keeps working on
+a text question.
+"""
+import base64
+import binascii
+import io
+import logging
+
+from langchain_core.messages import HumanMessage
+from pypdf import PdfReader
+
+from llm.client import get_llm
+
+logger = logging.getLogger(__name__)
+
+# Bounds on what one attachment adds to the prompt
+MAX_DOCUMENT_CHARS = 6000
+MAX_PDF_PAGES = 20
+
+IMAGE_PROMPT = """The user sent this image to Maya, the Mandala Foods nutrition assistant.
+Describe what it shows that matters for answering them: any product, its packaging and label,
+ingredients or nutrition facts you can read, and any text. Transcribe label text exactly.
+Do not answer the user or give advice. Reply with the description only."""
+
+
+def _describe_image(attachment: dict, raw: bytes, usage) -> str:
+    url = f"data:{attachment['content_type']};base64,{base64.b64encode(raw).decode()}"
+    message = HumanMessage(content=[
+        {"type": "text", "text": IMAGE_PROMPT},
+        {"type": "image_url", "image_url": {"url": url}},
+    ])
+    result = get_llm().invoke([message], config={"callbacks": [usage]})
+    content = result.content
+    if not isinstance(content, str):
+        content = "".join(part.get("text", "") if isinstance(part, dict) else str(part) for part in content)
+    return content.strip()
+
+
+def _document_text(attachment: dict, raw: bytes) -> str:
+    if attachment["content_type"] == "application/pdf":
+        reader = PdfReader(io.BytesIO(raw))
+        text = "\n".join(page.extract_text() or "" for page in reader.pages[:MAX_PDF_PAGES])
+    else:
+        text = raw.decode("utf-8", errors="replace")
+    text = text.strip()
+    if len(text) > MAX_DOCUMENT_CHARS:
+        text = text[:MAX_DOCUMENT_CHARS] + "\n[...]"
+    return text
+
+
+def describe_attachments(attachments: list[dict] | None, usage) -> str | None:
+    """Describe each attachment as a labelled block of text. Files that
+    can't be read are mentioned as such, so the answer can say so."""
+    blocks = []
+    for i, attachment in enumerate(attachments or [], 1):
+        label = attachment.get("name") or f"attachment {i}"
+        try:
+            raw = base64.b64decode(attachment["data"], validate=True)
+            if attachment.get("kind") == "image" or attachment["content_type"].startswith("image/"):
+                blocks.append(f"The user attached an image ({label}). It shows:\n{_describe_image(attachment, raw, usage)}")
+            else:
+                text = _document_text(attachment, raw)
+                if text:
+                    blocks.append(f'The user attached a document ({label}). Its text:\n"""\n{text}\n"""')
+                else:
+                    blocks.append(f"The user attached a document ({label}) with no readable text.")
+        except (binascii.Error, KeyError) as e:
+            logger.warning(f"Invalid attachment {label}: {e}")
+        except Exception as e:
+            logger.warning(f"Failed to read attachment {label}: {e}")
+            blocks.append(f"The user attached a file ({label}) that could not be read.")
+    return "\n\n".join(blocks) or None
+
+
+def with_attachments(message: str, described: str | None) -> str:
+    """Prefix the question with what the user's attachments contain."""
+    if not described:
+        return message
+    return f"{described}\n\n{message}"
@@ -36,3 +36,6 @@ class GeminiRESTEmbeddings(Embeddings):
 
     def embed_query(self, text: str) -> List[float]:
         return self._embed(text, "RETRIEVAL_QUERY")
+
+    def embed_for_clustering(self, texts: List[str]) -> List[List[float]]:
+        return [self._embed(t, "CLUSTERING") for t in texts]
@@ -1,9 +1,18 @@
+import asyncio
+import json
 import logging
+import re
+import threading
+from datetime import datetime
+
 from langchain.chains import ConversationalRetrievalChain
+from langchain.chains.conversational_retrieval.prompts import CONDENSE_QUESTION_PROMPT
 from langchain.memory import ConversationBufferWindowMemory
+from langchain_core.callbacks import BaseCallbackHandler
 from langchain_core.messages import HumanMessage, AIMessage
 
 from llm.client import get_llm
+from rag.attachments import describe_attachments, with_attachments
 from rag.retriever import get_retriever
 
 logger = logging.getLogger(__name__)
@@ -16,11 +25,48 @@ code-switches between Nepali and English, respond in the same language they used
 Always base your answers on the retrieved product information provided to you.
 Never make up nutritional claims not present in the context."""
 
+TONE_INSTRUCTIONS = {
+    "formal": "Write in a formal, professional register. Avoid slang, exclamation marks and emojis.",
+    "friendly": "Write in a warm, friendly and conversational way.",
+    "concise": "Be brief: answer directly, without greetings or filler.",
+}
 
-def build_chain(conversation_history: list[dict] | None = None):
-    """Build a ConversationalRetrievalChain with memory from request history."""
-    llm = get_llm()
-    retriever = get_retriever(k=4)
+
+class UsageCounter(BaseCallbackHandler):
+    """Adds up the tokens of every LLM call a chain makes."""
+
+    def __init__(self):
+        self.prompt_tokens = 0
+        self.completion_tokens = 0
+        self.reported = False
+        # Parts of a decomposed question are answered in parallel threads
+        self._lock = threading.Lock()
+
+    def on_llm_end(self, response, **kwargs):
+        for generations in response.generations:
+            for gen in generations:
+                usage = getattr(getattr(gen, "message", None), "usage_metadata", None)
+                if usage:
+                    with self._lock:
+                        self.prompt_tokens += usage.get("input_tokens", 0)
+                        self.completion_tokens += usage.get("output_tokens", 0)
+                        self.reported = True
+
+
+def build_chain(
+    conversation_history: list[dict] | None = None,
+    fast: bool = False,
+    session_summary: str | None = None,
+    tone: str | None = None,
+    max_sentences: int | None = None,
+):
+    """Build a ConversationalRetrievalChain with memory from request history.
+
+    The fast path retrieves fewer chunks so requests with a tight deadline
+    finish sooner.
+    """
+    llm = get_llm(fast=fast)
+    retriever = get_retriever(k=2 if fast else 4)
 
     memory = ConversationBufferWindowMemory(
         k=10,
@@ -29,6 +75,10 @@ def build_chain(conversation_history: list[dict] | None = None):
         output_key="answer",
     )
 
+    # Earlier topics are only passed as a summary, ahead of the active topic's turns
+    if session_summary:
+        memory.chat_memory.add_message(AIMessage(content=session_summary))
+
     # Populate memory from conversation history
     if conversation_history:
         for msg in conversation_history:
@@ -42,15 +92,19 @@ def build_chain(conversation_history: list[dict] | None = None):
         retriever=retriever,
         memory=memory,
         return_source_documents=True,
-        combine_docs_chain_kwargs={"prompt": _build_prompt()},
+        combine_docs_chain_kwargs={"prompt": _build_prompt(tone, max_sentences)},
         verbose=False,
     )
     return chain
 
 
-def _build_prompt():
+def _build_prompt(tone: str | None = None, max_sentences: int | None = None):
     from langchain.prompts import PromptTemplate
+    style = TONE_INSTRUCTIONS.get(tone or "", "")
+    if max_sentences:
+        style = f"{style} Answer in at most {max_sentences} sentences.".strip()
     template = f"""{SYSTEM_PROMPT}
+{style}
 
 Context from knowledge base:
 {{context}}
@@ -64,25 +118,276 @@ Answer:"""
     )
 
 
+def _with_page_context(message: str, page_context: dict | None) -> str:
+    """Prefix the question with what the user is looking at on the website."""
+    if not page_context:
+        return message
+    lines = []
+    title, url = page_context.get("title"), page_context.get("url")
+    page = f"{title} ({url})" if title and url else title or url
+    if page:
+        lines.append(f"The user is viewing the page: {page}")
+    if page_context.get("selected_text"):
+        lines.append(f'The user has selected this text on the page: "{page_context["selected_text"]}"')
+    if not lines:
+        return message
+    return "\n".join(lines) + f"\n\n{message}"
+
+
+def _with_local_time(message: str, time_zone: str | None, local_time: str | None) -> str:
+    """Prefix the question with the user's clock, so relative times such as
+    "tomorrow" or "at 9am" are read in their time zone."""
+    if not local_time:
+        return message
+    try:
+        now = datetime.fromisoformat(local_time)
+    except ValueError:
+        return message
+    zone = f" ({time_zone})" if time_zone else ""
+    return f"The user's local time is {now:%A, %d %B %Y, %H:%M}{zone}.\n\n{message}"
+
+
+def _with_operator_notes(message: str, operator_notes: list[str] | None) -> str:
+    """Prefix the question with what support agents noted about the
+    conversation. The notes are background for the answer, not something to
+    repeat to the user."""
+    if not operator_notes:
+        return message
+    notes = "\n".join(f"- {note}" for note in operator_notes)
+    return (
+        "Notes from the support team about this conversation (background only; "
+        f"do not quote or mention them to the user):\n{notes}\n\n{message}"
+    )
+
+
+DECOMPOSE_PROMPT = """Split this message sent to Maya, the Mandala Foods assistant, into the separate
+questions it asks. Rewrite each so it can be answered on its own, in the user's language, and
+keep questions that belong together as one. If it asks a single question, return just that.
+
+Respond with JSON only: {{"questions": ["<question>", ...]}}
+
+Message: {message}"""
+
+# More parts than this are folded back into one answer
+MAX_PARTS = 4
+
+
+def _may_be_compound(message: str) -> bool:
+    """Cheap check before spending an LLM call on splitting the message."""
+    return message.count("?") >= 2 or len(message) > 300
+
+
+def split_questions(message: str, usage: UsageCounter) -> list[str]:
+    """Break a compound message into standalone questions with a fast LLM call.
+    Returns a single question when the message can't or needn't be split."""
+    try:
+        result = get_llm(fast=True).invoke(
+            DECOMPOSE_PROMPT.format(message=message),
+            config={"callbacks": [usage]},
+        )
+        text = result.content if isinstance(result.content, str) else str(result.content)
+        match = re.search(r"\{.*\}", text, re.DOTALL)
+        data = json.loads(match.group(0)) if match else {}
+        questions = [str(q).strip() for q in data.get("questions", []) if str(q).strip()]
+    except Exception as e:
+        logger.warning(f"Question decomposition failed, answering as one: {e}")
+        return [message]
+    if len(questions) < 2 or len(questions) > MAX_PARTS:
+        return [message]
+    return questions
+
+
+def _answer(
+    question: str,
+    conversation_history: list[dict] | None,
+    fast: bool,
+    session_summary: str | None,
+    page_context: dict | None,
+    tone: str | None,
+    max_sentences: int | None,
+    usage: UsageCounter,
+    described: str | None = None,
+    time_zone: str | None = None,
+    local_time: str | None = None,
+    operator_notes: list[str] | None = None,
+) -> tuple[str, list[str]]:
+    chain = build_chain(
+        conversation_history,
+        fast=fast,
+        session_summary=session_summary,
+        tone=tone,
+        max_sentences=max_sentences,
+    )
+    result = chain.invoke(
+        {"question": _with_operator_notes(_with_local_time(
+            with_attachments(_with_page_context(question, page_context), described), time_zone, local_time,
+        ), operator_notes)},
+        config={"callbacks": [usage]},
+    )
+
+    return result["answer"], _sources(result.get("source_documents"))
+
+
+def _sources(docs) -> list[str]:
+    sources = []
+    for doc in docs or []:
+        source = doc.metadata.get("source", "unknown")
+        page = doc.metadata.get("page")
+        if page is not None:
+            source = f"{source}_page_{page}"
+        if source not in sources:
+            sources.append(source)
+    return sources
+
+
 async def run_pipeline(
     message: str,
     conversation_history: list[dict] | None = None,
+    fast: bool = False,
+    session_summary: str | None = None,
+    page_context: dict | None = None,
+    tone: str | None = None,
+    max_sentences: int | None = None,
+    decompose: bool = False,
+    attachments: list[dict] | None = None,
+    time_zone: str | None = None,
+    local_time: str | None = None,
+    operator_notes: list[str] | None = None,
 ) -> dict:
-    """Run the RAG pipeline and return response with sources."""
-    chain = build_chain(conversation_history)
-    result = chain.invoke({"question": message})
+    """Run the RAG pipeline and return response with sources.
+
+    With decompose, a message asking several questions is split and each
+    part is answered on its own, concurrently, as a numbered section. The
+    fast path never splits. Attachments are read once and given to every
+    part.
+    """
+    usage = UsageCounter()
+    questions = [message]
+    if decompose and not fast and _may_be_compound(message):
+        questions = await asyncio.to_thread(split_questions, message, usage)
+    described = await asyncio.to_thread(describe_attachments, attachments, usage) if attachments else None
+
+    answers = await asyncio.gather(*[
+        asyncio.to_thread(
+            _answer, q, conversation_history, fast, session_summary,
+            page_context, tone, max_sentences, usage, described, time_zone, local_time, operator_notes,
+        )
+        for q in questions
+    ])
 
     sources = []
-    if result.get("source_documents"):
-        for doc in result["source_documents"]:
-            source = doc.metadata.get("source", "unknown")
-            page = doc.metadata.get("page")
-            if page is not None:
-                source = f"{source}_page_{page}"
-            if source not in sources:
-                sources.append(source)
+    for _, part_sources in answers:
+        sources.extend(s for s in part_sources if s not in sources)
+    if len(answers) == 1:
+        response = answers[0][0]
+    else:
+        response = "\n\n".join(
+            f"{i}. {q}\n{answer.strip()}" for i, (q, (answer, _)) in enumerate(zip(questions, answers), 1)
+        )
 
     return {
-        "response": result["answer"],
+        "response": response,
         "sources": sources,
+        "usage": {
+            "prompt_tokens": usage.prompt_tokens,
+            "completion_tokens": usage.completion_tokens,
+        } if usage.reported else None,
+    }
+
+
+def _text(content) -> str:
+    """Message content as text; some providers stream lists of content blocks."""
+    if isinstance(content, str):
+        return content
+    return "".join(part.get("text", "") if isinstance(part, dict) else str(part) for part in content)
+
+
+def _condense_question(
+    question: str,
+    conversation_history: list[dict] | None,
+    session_summary: str | None,
+    fast: bool,
+    usage: UsageCounter,
+) -> str:
+    """Rewrite a follow-up as a standalone question, as the retrieval chain does."""
+    lines = [f"Assistant: {session_summary}"] if session_summary else []
+    # The chain's memory keeps the last 10 exchanges
+    for msg in (conversation_history or [])[-20:]:
+        role = {"user": "Human", "assistant": "Assistant"}.get(msg["role"])
+        if role:
+            lines.append(f"{role}: {msg['content']}")
+    if not lines:
+        return question
+    result = get_llm(fast=fast).invoke(
+        CONDENSE_QUESTION_PROMPT.format(chat_history="\n".join(lines), question=question),
+        config={"callbacks": [usage]},
+    )
+    return _text(result.content).strip() or question
+
+
+def stream_pipeline(
+    message: str,
+    conversation_history: list[dict] | None = None,
+    fast: bool = False,
+    session_summary: str | None = None,
+    page_context: dict | None = None,
+    tone: str | None = None,
+    max_sentences: int | None = None,
+    attachments: list[dict] | None = None,
+    time_zone: str | None = None,
+    local_time: str | None = None,
+    operator_notes: list[str] | None = None,
+):
+    """Run the RAG pipeline, yielding {"delta": text} as the answer is
+    generated and then {"done": True, ...} with what run_pipeline returns."""
+    usage = UsageCounter()
+    described = describe_attachments(attachments, usage) if attachments else None
+    question = _condense_question(
+        _with_operator_notes(
+            _with_local_time(with_attachments(_with_page_context(message, page_context), described), time_zone, local_time),
+            operator_notes,
+        ),
+        conversation_history, session_summary, fast, usage,
+    )
+    docs = get_retriever(k=2 if fast else 4).invoke(question)
+    prompt = _build_prompt(tone, max_sentences).format(
+        context="\n\n".join(doc.page_content for doc in docs),
+        question=question,
+    )
+
+    parts = []
+    for chunk in get_llm(fast=fast).stream(prompt, config={"callbacks": [usage]}):
+        text = _text(chunk.content)
+        if text:
+            parts.append(text)
+            yield {"delta": text}
+
+    yield {
+        "done": True,
+        "response": "".join(parts),
+        "sources": _sources(docs),
+        "usage": {
+            "prompt_tokens": usage.prompt_tokens,
+            "completion_tokens": usage.completion_tokens,
+        } if usage.reported else None,
     }
+
+
+STRUCTURED_PROMPT = """Using only the answer below, fill in the requested JSON structure.
+Leave fields you cannot fill from the answer empty rather than guessing.
+
+Question: {question}
+
+Answer: {answer}"""
+
+
+async def structure_answer(message: str, answer: str, schema: dict) -> dict:
+    """Convert a free-text RAG answer into JSON matching the caller's schema."""
+    llm = get_llm()
+    if "title" not in schema:
+        schema = {**schema, "title": "StructuredAnswer"}
+    structured_llm = llm.with_structured_output(schema)
+    result = await structured_llm.ainvoke(STRUCTURED_PROMPT.format(question=message, answer=answer))
+    if not isinstance(result, dict):
+        raise ValueError(f"Structured output was not an object: {type(result).__name__}")
+    return result
@@ -8,9 +8,20 @@ class MessageContent(BaseModel):
     text: str
 
 
+class ClientContext(BaseModel):
+    # What the web client's handshake said about it; ip is only set on
+    # envelopes, never on chat requests
+    user_agent: Optional[str] = None
+    accept_language: Optional[str] = None
+    ip: Optional[str] = None
+    app_version: Optional[str] = None
+    widget_version: Optional[str] = None
+
+
 class MessageMetadata(BaseModel):
     language: str = "en"
     platform_data: dict = {}
+    client: Optional[ClientContext] = None
 
 
 class MessageEnvelope(BaseModel):
@@ -23,17 +34,70 @@ class MessageEnvelope(BaseModel):
     metadata: MessageMetadata = MessageMetadata()
 
 
+class PageContext(BaseModel):
+    url: Optional[str] = None
+    title: Optional[str] = None
+    selected_text: Optional[str] = None
+
+
+class Attachment(BaseModel):
+    name: Optional[str] = None
+    # "image" or "document"
+    kind: str
+    content_type: str
+    # Base64-encoded file bytes
+    data: str
+
+
 class ConversationMessage(BaseModel):
     role: str
     content: str
 
 
+class Features(BaseModel):
+    # Flags that are on and the session's experiment variants, resolved by
+    # the orchestrator when the message arrived
+    flags: dict[str, bool] = {}
+    experiments: dict[str, str] = {}
+    resolved_at: Optional[str] = None
+
+
 class ChatRequest(BaseModel):
     session_id: str
     message: str
     conversation_history: list[ConversationMessage] = []
     channel: str = "web"
     language: str = "en"
+    response_schema: Optional[dict] = None
+    # Set by the orchestrator when the channel's deadline is tight
+    fast: bool = False
+    # Recap of earlier topics whose turns are not in conversation_history
+    session_summary: Optional[str] = None
+    # The web page the user is viewing, so "this section" can be resolved
+    page_context: Optional[PageContext] = None
+    # House style for the tenant and channel
+    tone: Optional[str] = None
+    max_sentences: Optional[int] = None
+    # Answer each question of a compound message as its own numbered part
+    decompose: bool = False
+    # Images and documents the user uploaded with the message
+    attachments: list[Attachment] = []
+    # The user's IANA time zone and their local time (RFC 3339), so
+    # "tomorrow" or "at 9am" is read on their clock
+    time_zone: Optional[str] = None
+    local_time: Optional[str] = None
+    # Notes support agents shared with the assistant; background only
+    operator_notes: list[str] = []
+    # Feature flags and experiment variants in effect for this message; use
+    # these rather than local configuration so answers match the record
+    features: Optional[Features] = None
+    # The user's browser or app, for answers that depend on the device
+    client: Optional[ClientContext] = None
+
+
+class Usage(BaseModel):
+    prompt_tokens: int = 0
+    completion_tokens: int = 0
 
 
 class ChatResponse(BaseModel):
@@ -41,3 +105,44 @@ class ChatResponse(BaseModel):
     response: str
     sources: list[str] = []
     model_used: str
+    structured: Optional[dict] = None
+    # Tokens the answer took, when the provider reports them
+    usage: Optional[Usage] = None
+
+
+class EvaluateRequest(BaseModel):
+    question: str
+    answer: str
+    sources: list[str] = []
+
+
+class EvaluateResponse(BaseModel):
+    score: float
+    reasoning: str
+
+
+class EmbedRequest(BaseModel):
+    texts: list[str]
+
+
+class EmbedResponse(BaseModel):
+    embeddings: list[list[float]]
+
+
+class SummarizeRequest(BaseModel):
+    text: str
+    max_chars: int = 1600
+
+
+class SummarizeResponse(BaseModel):
+    summary: str
+
+
+class ClassifyRequest(BaseModel):
+    text: str
+    labels: list[str]
+
+
+class ClassifyResponse(BaseModel):
+    label: str
+    confidence: float = 0.0
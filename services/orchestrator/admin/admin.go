@@ -0,0 +1,385 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"orchestrator/apikeys"
+	"orchestrator/archive"
+	"orchestrator/attachment"
+	"orchestrator/audit"
+	"orchestrator/backend"
+	"orchestrator/campaign"
+	"orchestrator/deadletter"
+	"orchestrator/delivery"
+	"orchestrator/evaluation"
+	"orchestrator/gaps"
+	"orchestrator/httperr"
+	"orchestrator/intent"
+	"orchestrator/live"
+	"orchestrator/locks"
+	"orchestrator/maintenance"
+	"orchestrator/models"
+	"orchestrator/notes"
+	"orchestrator/override"
+	"orchestrator/presence"
+	"orchestrator/region"
+	"orchestrator/reports"
+	"orchestrator/rules"
+	"orchestrator/session"
+	"orchestrator/sla"
+	"orchestrator/smoke"
+	"orchestrator/widget"
+)
+
+// Drainer reports how many messages are currently being processed.
+type Drainer interface {
+	InFlight() int
+}
+
+// Deps are the collaborators the admin API operates on.
+type Deps struct {
+	Maintenance *maintenance.Switch
+	Publisher   *delivery.Publisher
+	Drainer     Drainer
+	Backends    *backend.Selector
+	Evaluator   *evaluation.Evaluator
+	Region      *region.Coordinator
+	Overrides   *override.Store
+	Rules       *rules.Engine
+	Attachments *attachment.Store
+	Gaps        *gaps.Tracker
+	Intents     *intent.Classifier
+	Live        *live.Tracker
+	Archive     *archive.Store
+	Audit       *audit.Log
+	Campaigns   *campaign.Store
+	Smoke       *smoke.Runner
+	Widgets     *widget.Store
+	Sessions    *session.Manager
+	Reports     *reports.Store
+	APIKeys     *apikeys.Store
+	Notes       *notes.Store
+	DeadLetters *deadletter.Store
+	Locks       *locks.Store
+	SLA         *sla.Tracker
+	Presence    *presence.Registry
+}
+
+type Handler struct {
+	token     string
+	operators []operator
+	Deps
+	mux *http.ServeMux
+}
+
+func NewHandler(token string, deps Deps) *Handler {
+	h := &Handler{
+		token: token,
+		Deps:  deps,
+		mux:   http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /admin/maintenance", h.getMaintenance)
+	h.mux.HandleFunc("PUT /admin/maintenance", h.setMaintenance)
+	h.mux.HandleFunc("POST /admin/sessions/terminate", h.terminateSessions)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/handoff", h.handoffSession)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/pickup", h.pickupSession)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/resolve", h.resolveSession)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/sla", h.getSLA)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/merge", h.mergeSession)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/lock", h.getLock)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/lock", h.acquireLock)
+	h.mux.HandleFunc("PUT /admin/sessions/{id}/lock", h.renewLock)
+	h.mux.HandleFunc("DELETE /admin/sessions/{id}/lock", h.releaseLock)
+	h.mux.HandleFunc("GET /admin/campaigns", h.listCampaigns)
+	h.mux.HandleFunc("POST /admin/campaigns", h.createCampaign)
+	h.mux.HandleFunc("GET /admin/campaigns/{id}", h.getCampaign)
+	h.mux.HandleFunc("POST /admin/campaigns/{id}/approve", h.approveCampaign)
+	h.mux.HandleFunc("POST /admin/campaigns/{id}/reject", h.rejectCampaign)
+	h.mux.HandleFunc("GET /admin/canary", h.getCanary)
+	h.mux.HandleFunc("GET /admin/live", h.getLive)
+	h.mux.HandleFunc("GET /admin/presence", h.listOnline)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/presence", h.getPresence)
+	h.mux.HandleFunc("GET /admin/delivery/failures", h.getDeliveryFailures)
+	h.mux.HandleFunc("GET /admin/deadletters", h.listDeadLetters)
+	h.mux.HandleFunc("POST /admin/deadletters/redrive", h.redriveDeadLetters)
+	h.mux.HandleFunc("GET /admin/deadletters/{id}", h.getDeadLetter)
+	h.mux.HandleFunc("GET /admin/delivery/{id}", h.getDeliveryStatus)
+	h.mux.HandleFunc("GET /admin/messages/external/{channel}/{id}", h.getExternalMessage)
+	h.mux.HandleFunc("POST /admin/messages/{id}/correction", h.correctMessage)
+	h.mux.HandleFunc("GET /admin/region", h.getRegion)
+	h.mux.HandleFunc("POST /admin/region/promote", h.promoteRegion)
+	h.mux.HandleFunc("GET /admin/evaluations/summary", h.getEvaluationSummary)
+	h.mux.HandleFunc("GET /admin/evaluations/{message_id}", h.getEvaluation)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/transcript", h.getTranscript)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/access-log", h.getAccessLog)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/notes", h.listNotes)
+	h.mux.HandleFunc("POST /admin/sessions/{id}/notes", h.addNote)
+	h.mux.HandleFunc("DELETE /admin/sessions/{id}/notes/{note}", h.deleteNote)
+	h.mux.HandleFunc("GET /admin/access-reasons", h.listAccessReasons)
+	h.mux.HandleFunc("GET /admin/sessions/{id}/attachments", h.listAttachments)
+	h.mux.HandleFunc("GET /admin/attachments/quarantine", h.listQuarantine)
+	h.mux.HandleFunc("GET /admin/attachments/{id}", h.getAttachment)
+	h.mux.HandleFunc("GET /admin/gaps", h.getGaps)
+	h.mux.HandleFunc("GET /admin/reports", h.listReports)
+	h.mux.HandleFunc("GET /admin/reports/{id}", h.getReport)
+	h.mux.HandleFunc("GET /admin/analytics/intents", h.getIntentTrends)
+	h.mux.HandleFunc("GET /admin/overrides", h.listOverrides)
+	h.mux.HandleFunc("GET /admin/overrides/{id}", h.getOverride)
+	h.mux.HandleFunc("PUT /admin/overrides/{id}", h.putOverride)
+	h.mux.HandleFunc("DELETE /admin/overrides/{id}", h.deleteOverride)
+	h.mux.HandleFunc("GET /admin/rules", h.listRules)
+	h.mux.HandleFunc("POST /admin/rules/test", h.testRules)
+	h.mux.HandleFunc("GET /admin/rules/{id}", h.getRule)
+	h.mux.HandleFunc("PUT /admin/rules/{id}", h.putRule)
+	h.mux.HandleFunc("DELETE /admin/rules/{id}", h.deleteRule)
+	h.mux.HandleFunc("GET /admin/widget-configs", h.listWidgetConfigs)
+	h.mux.HandleFunc("GET /admin/widget-configs/{key}", h.getWidgetConfig)
+	h.mux.HandleFunc("PUT /admin/widget-configs/{key}", h.putWidgetConfig)
+	h.mux.HandleFunc("DELETE /admin/widget-configs/{key}", h.deleteWidgetConfig)
+	h.mux.HandleFunc("GET /admin/api-keys", h.listAPIKeys)
+	h.mux.HandleFunc("POST /admin/api-keys", h.createAPIKey)
+	h.mux.HandleFunc("DELETE /admin/api-keys/{id}", h.revokeAPIKey)
+	h.mux.HandleFunc("GET /admin/smoke", h.getSmokeReport)
+	h.mux.HandleFunc("POST /admin/smoke/run", h.runSmoke)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actor := h.authenticate(r)
+	if actor == "" {
+		httperr.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	h.mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+}
+
+type maintenanceStatus struct {
+	maintenance.Mode
+	InFlight int  `json:"in_flight"`
+	Drained  bool `json:"drained"`
+}
+
+func (h *Handler) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	mode, err := h.Maintenance.Get(r.Context())
+	if err != nil {
+		log.Printf("Failed to load maintenance mode: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load maintenance mode")
+		return
+	}
+	n, err := h.Maintenance.InFlight(r.Context())
+	if err != nil {
+		log.Printf("Failed to load maintenance mode: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load maintenance mode")
+		return
+	}
+	writeJSON(w, http.StatusOK, maintenanceStatus{Mode: mode, InFlight: n, Drained: mode.Enabled && n == 0})
+}
+
+type setMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+	Notify  bool   `json:"notify"`
+}
+
+func (h *Handler) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req setMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx := r.Context()
+	mode := maintenance.Mode{Enabled: req.Enabled, Message: req.Message}
+	if err := h.Maintenance.Set(ctx, mode); err != nil {
+		log.Printf("Failed to set maintenance mode: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to set maintenance mode")
+		return
+	}
+	mode, _ = h.Maintenance.Get(ctx)
+	log.Printf("Maintenance mode set to %v", mode.Enabled)
+
+	notified := 0
+	if req.Notify && mode.Enabled {
+		sessions, err := h.Publisher.ActiveSessions(ctx)
+		if err == nil {
+			notified, err = h.Publisher.Broadcast(ctx, "web", sessions, models.WSResponse{Type: "notice", Text: mode.Message})
+		}
+		if err != nil {
+			log.Printf("Failed to notify active sessions: %v", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"mode": mode, "notified": notified})
+}
+
+type terminateRequest struct {
+	SessionIDs []string `json:"session_ids"`
+	All        bool     `json:"all"`
+	Reason     string   `json:"reason"`
+}
+
+func (h *Handler) terminateSessions(w http.ResponseWriter, r *http.Request) {
+	var req terminateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	ctx := r.Context()
+	sessions := req.SessionIDs
+	if req.All {
+		var err error
+		sessions, err = h.Publisher.ActiveSessions(ctx)
+		if err != nil {
+			log.Printf("Failed to list active sessions: %v", err)
+			httperr.Write(w, r, http.StatusInternalServerError, "failed to list active sessions")
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "This conversation has been closed by an administrator."
+	}
+
+	terminated, err := h.Publisher.Broadcast(ctx, "web", sessions, models.WSResponse{Type: "terminated", Text: req.Reason})
+	if err != nil {
+		log.Printf("Failed to terminate sessions: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"requested": len(sessions), "terminated": terminated})
+}
+
+type handoffRequest struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// handoffSession tells a web session that a person is taking over, which
+// also notifies the hosting site, and starts its pickup timer.
+func (h *Handler) handoffSession(w http.ResponseWriter, r *http.Request) {
+	var req handoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Message == "" {
+		req.Message = "You're being connected to a member of our team."
+	}
+	data, _ := json.Marshal(map[string]string{"reason": req.Reason})
+	sessionID := r.PathValue("id")
+	if _, err := h.Publisher.Send(r.Context(), "web", sessionID, models.WSResponse{
+		Type:      "handoff",
+		SessionID: sessionID,
+		Text:      req.Message,
+		Data:      data,
+	}); err != nil {
+		log.Printf("Failed to hand off session %s: %v", sessionID, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to hand off session")
+		return
+	}
+	h.SLA.HandedOff(r.Context(), sessionID, time.Now())
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sessionID})
+}
+
+func (h *Handler) getCanary(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"percent":  h.Backends.CanaryPercent(),
+		"backends": h.Backends.Snapshot(),
+	})
+}
+
+func (h *Handler) getDeliveryFailures(w http.ResponseWriter, r *http.Request) {
+	failures, err := h.Publisher.Failures(r.Context(), 100)
+	if err != nil {
+		log.Printf("Failed to load delivery failures: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load delivery failures")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"failures": failures})
+}
+
+func (h *Handler) getDeliveryStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := h.Publisher.GetStatus(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load delivery status: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load delivery status")
+		return
+	}
+	if st == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown delivery")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (h *Handler) getRegion(w http.ResponseWriter, r *http.Request) {
+	if h.Region == nil {
+		httperr.Write(w, r, http.StatusNotFound, "multi-region disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"region": h.Region.Name(),
+		"role":   h.Region.Role(),
+		"epoch":  h.Region.Epoch(),
+	})
+}
+
+func (h *Handler) promoteRegion(w http.ResponseWriter, r *http.Request) {
+	if h.Region == nil {
+		httperr.Write(w, r, http.StatusNotFound, "multi-region disabled")
+		return
+	}
+	epoch, err := h.Region.Promote(r.Context())
+	if err != nil {
+		log.Printf("Failed to promote region: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to promote region")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"region": h.Region.Name(), "role": h.Region.Role(), "epoch": epoch})
+}
+
+// getLive is a cheap snapshot for status wallboards, meant to be polled.
+func (h *Handler) getLive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, h.Live.Snapshot(h.Drainer.InFlight()))
+}
+
+func (h *Handler) getEvaluationSummary(w http.ResponseWriter, r *http.Request) {
+	if h.Evaluator == nil {
+		httperr.Write(w, r, http.StatusNotFound, "evaluation disabled")
+		return
+	}
+	avg, n := h.Evaluator.RollingAverage()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rolling_average": avg, "window": n})
+}
+
+func (h *Handler) getEvaluation(w http.ResponseWriter, r *http.Request) {
+	if h.Evaluator == nil {
+		httperr.Write(w, r, http.StatusNotFound, "evaluation disabled")
+		return
+	}
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "session_id is required")
+		return
+	}
+	score, err := h.Evaluator.Load(r.Context(), sessionID, r.PathValue("message_id"))
+	if err != nil {
+		log.Printf("Failed to load evaluation: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load evaluation")
+		return
+	}
+	if score == nil {
+		httperr.Write(w, r, http.StatusNotFound, "message was not evaluated")
+		return
+	}
+	writeJSON(w, http.StatusOK, score)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/apikeys"
+	"orchestrator/httperr"
+)
+
+func (h *Handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.APIKeys.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list API keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// createAPIKey issues a key for a partner integration. The key is in the
+// response and nowhere else; a lost key is revoked and replaced.
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var k apikeys.Key
+	if err := json.NewDecoder(r.Body).Decode(&k); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := apikeys.Validate(k); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	k.CreatedBy = actor(ctx)
+	secret, created, err := h.APIKeys.Create(ctx, k)
+	if err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to create API key")
+		return
+	}
+	log.Printf("API key %s (%s) created by %s", created.ID, created.Name, created.CreatedBy)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"key": secret, "api_key": created})
+}
+
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	k, err := h.APIKeys.Revoke(ctx, r.PathValue("id"), actor(ctx))
+	if errors.Is(err, apikeys.ErrNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke API key: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to revoke API key")
+		return
+	}
+	log.Printf("API key %s (%s) revoked by %s", k.ID, k.Name, k.RevokedBy)
+	writeJSON(w, http.StatusOK, k)
+}
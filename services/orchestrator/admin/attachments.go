@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"orchestrator/httperr"
+)
+
+// listAttachments lets the agent console show what a user shared.
+func (h *Handler) listAttachments(w http.ResponseWriter, r *http.Request) {
+	if !h.audited(w, r, r.PathValue("id"), "attachments") {
+		return
+	}
+	atts, err := h.Attachments.ForSession(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to list attachments: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list attachments")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"attachments": atts})
+}
+
+// getAttachment serves the raw file for display in the agent console.
+func (h *Handler) getAttachment(w http.ResponseWriter, r *http.Request) {
+	info, data, err := h.Attachments.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load attachment: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load attachment")
+		return
+	}
+	if info == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown or expired attachment")
+		return
+	}
+	if !h.audited(w, r, info.SessionID, "attachment:"+info.ID) {
+		return
+	}
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(data)
+}
+
+const maxQuarantineListed = 200
+
+// listQuarantine shows rejected attachments for security review.
+func (h *Handler) listQuarantine(w http.ResponseWriter, r *http.Request) {
+	atts, err := h.Attachments.Quarantined(r.Context(), maxQuarantineListed)
+	if err != nil {
+		log.Printf("Failed to list quarantined attachments: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list quarantined attachments")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"attachments": atts})
+}
@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"orchestrator/campaign"
+	"orchestrator/httperr"
+)
+
+const maxCampaignsListed = 100
+
+type createCampaignRequest struct {
+	Channel    string   `json:"channel"`
+	Text       string   `json:"text"`
+	SessionIDs []string `json:"session_ids"`
+	AllActive  bool     `json:"all_active"`
+}
+
+// createCampaign sends text to the listed sessions, or to every connected
+// web session, after approval if the audience is large.
+func (h *Handler) createCampaign(w http.ResponseWriter, r *http.Request) {
+	var req createCampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "text is required")
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = "web"
+	}
+
+	ctx := r.Context()
+	sessions := req.SessionIDs
+	if req.AllActive {
+		if req.Channel != "web" {
+			httperr.Write(w, r, http.StatusBadRequest, "all_active is only supported for web")
+			return
+		}
+		var err error
+		sessions, err = h.Publisher.ActiveSessions(ctx)
+		if err != nil {
+			log.Printf("Failed to list active sessions: %v", err)
+			httperr.Write(w, r, http.StatusInternalServerError, "failed to list active sessions")
+			return
+		}
+	}
+	if len(sessions) == 0 {
+		httperr.Write(w, r, http.StatusBadRequest, "the campaign has no recipients")
+		return
+	}
+
+	c, err := h.Campaigns.Create(ctx, actor(ctx), req.Channel, req.Text, sessions)
+	if err != nil {
+		log.Printf("Failed to create campaign: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to create campaign")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, c)
+}
+
+func (h *Handler) listCampaigns(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Campaigns.List(r.Context(), maxCampaignsListed)
+	if err != nil {
+		log.Printf("Failed to list campaigns: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list campaigns")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"campaigns": all})
+}
+
+func (h *Handler) getCampaign(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Campaigns.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load campaign: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load campaign")
+		return
+	}
+	if c == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown campaign")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+type reviewCampaignRequest struct {
+	Note string `json:"note"`
+}
+
+func (h *Handler) approveCampaign(w http.ResponseWriter, r *http.Request) {
+	h.reviewCampaign(w, r, h.Campaigns.Approve)
+}
+
+func (h *Handler) rejectCampaign(w http.ResponseWriter, r *http.Request) {
+	h.reviewCampaign(w, r, h.Campaigns.Reject)
+}
+
+// reviewCampaign requires an operator's own token: the shared admin token
+// can't tell the reviewer apart from the requester.
+func (h *Handler) reviewCampaign(w http.ResponseWriter, r *http.Request, review func(ctx context.Context, id, actor, note string) (*campaign.Campaign, error)) {
+	ctx := r.Context()
+	reviewer := actor(ctx)
+	if reviewer == "admin" || strings.HasPrefix(reviewer, "admin (") {
+		httperr.Write(w, r, http.StatusForbidden, "campaign reviews need an operator token from ADMIN_OPERATORS")
+		return
+	}
+	var req reviewCampaignRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	c, err := review(ctx, r.PathValue("id"), reviewer, req.Note)
+	switch {
+	case errors.Is(err, campaign.ErrNotFound):
+		httperr.Write(w, r, http.StatusNotFound, "unknown campaign")
+	case errors.Is(err, campaign.ErrNotPending):
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, campaign.ErrSelfApproval):
+		httperr.Write(w, r, http.StatusForbidden, err.Error())
+	case err != nil:
+		log.Printf("Failed to review campaign: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to review campaign")
+	default:
+		writeJSON(w, http.StatusOK, c)
+	}
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchestrator/archive"
+	"orchestrator/httperr"
+	"orchestrator/models"
+)
+
+type correctionRequest struct {
+	Text string `json:"text"`
+}
+
+// correctMessage replaces a delivered answer. The correction goes to the
+// session on the channel the answer was sent on; channels that can edit sent
+// messages update it in place, others send the text as a correction notice.
+// It is recorded in the transcript and the prompt context so later answers
+// build on the corrected one.
+func (h *Handler) correctMessage(w http.ResponseWriter, r *http.Request) {
+	var req correctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		httperr.Write(w, r, http.StatusBadRequest, `body must be {"text": "<corrected answer>"}`)
+		return
+	}
+	ctx := r.Context()
+	// Parts of a split answer are numbered after a dot; correct the whole
+	// answer
+	id, _, _ := strings.Cut(r.PathValue("id"), ".")
+	st, err := h.Publisher.GetStatus(ctx, id)
+	if err != nil {
+		log.Printf("Failed to load delivery status: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load message")
+		return
+	}
+	if st == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown or expired message")
+		return
+	}
+
+	res, err := h.Publisher.Send(ctx, st.Channel, st.SessionID, models.WSResponse{
+		Type:      "correction",
+		Text:      req.Text,
+		SessionID: st.SessionID,
+		Corrects:  id,
+	})
+	if err != nil {
+		log.Printf("Failed to send correction for %s: %v", id, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to send correction")
+		return
+	}
+	if err := h.Sessions.Record(ctx, st.SessionID, archive.Turn{
+		MessageID: id,
+		Role:      "assistant",
+		Content:   req.Text,
+		Channel:   st.Channel,
+		Tags:      []string{"correction"},
+		Timestamp: time.Now().UTC(),
+	}); err != nil {
+		log.Printf("Failed to record correction for %s: %v", id, err)
+	}
+	log.Printf("Answer %s in session %s corrected by %s", id, st.SessionID, actor(ctx))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"corrects":   id,
+		"session_id": st.SessionID,
+		"queued":     res.Queued,
+		"delivered":  res.Delivered,
+	})
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/deadletter"
+	"orchestrator/httperr"
+)
+
+const (
+	maxDeadLettersListed = 200
+	maxRedriven          = 100
+)
+
+type redriveRequest struct {
+	IDs []string `json:"ids"`
+	deadletter.Transform
+	DryRun bool `json:"dry_run"`
+}
+
+// listDeadLetters lists dead-lettered messages with their IDs but not their
+// content, so it is not audited.
+func (h *Handler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	all, err := h.DeadLetters.List(r.Context(), maxDeadLettersListed)
+	if err != nil {
+		log.Printf("Failed to list dead letters: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list dead letters")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dead_letters": all})
+}
+
+// getDeadLetter returns a dead letter with its envelope, audited like a
+// transcript read.
+func (h *Handler) getDeadLetter(w http.ResponseWriter, r *http.Request) {
+	l, err := h.DeadLetters.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, deadletter.ErrNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load dead letter: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load dead letter")
+		return
+	}
+	if !h.audited(w, r, l.SessionID, "dead_letter") {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, l)
+}
+
+// redriveDeadLetters applies the request's transformation to each listed
+// letter and requeues it. With dry_run the transformed envelopes are only
+// validated.
+func (h *Handler) redriveDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var req redriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxRedriven {
+		httperr.Write(w, r, http.StatusBadRequest, "between 1 and 100 ids are required")
+		return
+	}
+	if req.Flow != "" {
+		if _, ok := h.Rules.FlowURL(req.Flow); !ok {
+			httperr.Write(w, r, http.StatusBadRequest, "unknown flow "+req.Flow)
+			return
+		}
+	}
+	results, err := h.DeadLetters.Redrive(r.Context(), req.IDs, req.Transform, req.DryRun)
+	if err != nil {
+		// Letters before the failure were requeued; report them too
+		log.Printf("Failed to re-drive dead letters: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"results": results, "error": "failed to re-drive dead letters"})
+		return
+	}
+	if !req.DryRun {
+		log.Printf("%s re-drove %d dead letters (set %d fields, flow %q)", actor(r.Context()), len(req.IDs), len(req.Set), req.Flow)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results, "dry_run": req.DryRun})
+}
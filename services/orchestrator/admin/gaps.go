@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"orchestrator/httperr"
+)
+
+const (
+	defaultGapDays   = 7
+	defaultGapTopics = 20
+)
+
+// getGaps serves the "top unanswered topics" report, covering the last week
+// unless ?days= says otherwise.
+func (h *Handler) getGaps(w http.ResponseWriter, r *http.Request) {
+	if h.Gaps == nil {
+		httperr.Write(w, r, http.StatusNotFound, "knowledge gap tracking disabled")
+		return
+	}
+	days, limit := defaultGapDays, defaultGapTopics
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 90 {
+			httperr.Write(w, r, http.StatusBadRequest, "days must be between 1 and 90")
+			return
+		}
+		days = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			httperr.Write(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	report, err := h.Gaps.Report(r.Context(), since, r.URL.Query().Get("tenant"), limit)
+	if err != nil {
+		log.Printf("Failed to build knowledge gap report: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to build knowledge gap report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"orchestrator/httperr"
+)
+
+const defaultIntentDays = 7
+
+// getIntentTrends serves intent volume over time. ?interval=hour buckets by
+// hour instead of day.
+func (h *Handler) getIntentTrends(w http.ResponseWriter, r *http.Request) {
+	if h.Intents == nil {
+		httperr.Write(w, r, http.StatusNotFound, "intent analytics disabled")
+		return
+	}
+	days := defaultIntentDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 90 {
+			httperr.Write(w, r, http.StatusBadRequest, "days must be between 1 and 90")
+			return
+		}
+		days = n
+	}
+	interval := 24 * time.Hour
+	switch r.URL.Query().Get("interval") {
+	case "", "day":
+	case "hour":
+		interval = time.Hour
+	default:
+		httperr.Write(w, r, http.StatusBadRequest, "interval must be hour or day")
+		return
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	trends, err := h.Intents.Trends(r.Context(), since, interval, r.URL.Query().Get("tenant"))
+	if err != nil {
+		log.Printf("Failed to load intent trends: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load intent trends")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"labels": h.Intents.Labels(), "trends": trends})
+}
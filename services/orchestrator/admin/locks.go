@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"orchestrator/httperr"
+	"orchestrator/locks"
+)
+
+type lockRequest struct {
+	Holder     string `json:"holder"`
+	Reason     string `json:"reason"`
+	Token      string `json:"token"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+// getLock shows who holds the session's lock and how many messages wait
+// for it.
+func (h *Handler) getLock(w http.ResponseWriter, r *http.Request) {
+	l, err := h.Locks.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load session lock: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load session lock")
+		return
+	}
+	if l == nil {
+		httperr.Write(w, r, http.StatusNotFound, "session is not locked")
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// acquireLock pauses the bot for the session. The response holds the token
+// needed to renew and release the lock; a session already locked gets 409
+// with its current holder.
+func (h *Handler) acquireLock(w http.ResponseWriter, r *http.Request) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Holder == "" {
+		req.Holder = actor(r.Context())
+	}
+	l, err := h.Locks.Acquire(r.Context(), r.PathValue("id"), req.Holder, req.Reason, time.Duration(req.TTLSeconds)*time.Second)
+	if errors.Is(err, locks.ErrLocked) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "lock": l})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to lock session: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to lock session")
+		return
+	}
+	writeJSON(w, http.StatusCreated, l)
+}
+
+// renewLock extends the lease of the lock held with the request's token.
+func (h *Handler) renewLock(w http.ResponseWriter, r *http.Request) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	l, err := h.Locks.Renew(r.Context(), r.PathValue("id"), req.Token, time.Duration(req.TTLSeconds)*time.Second)
+	if errors.Is(err, locks.ErrNotHeld) {
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to renew session lock: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to renew session lock")
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// releaseLock resumes the bot for the session and requeues the messages
+// that arrived while it was locked. Holders pass their token; the shared
+// admin token may release any lock without one.
+func (h *Handler) releaseLock(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	token := r.URL.Query().Get("token")
+	if token == "" && actor(r.Context()) != "admin" {
+		httperr.Write(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+	n, err := h.Locks.Release(r.Context(), sessionID, token)
+	if errors.Is(err, locks.ErrNotHeld) {
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to release session lock: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to release session lock")
+		return
+	}
+	if token == "" {
+		log.Printf("Lock on session %s released by %s without its token", sessionID, actor(r.Context()))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"requeued": n})
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/httperr"
+	"orchestrator/session"
+)
+
+type mergeRequest struct {
+	// From is the duplicate session folded into the one in the path.
+	From string `json:"from"`
+}
+
+// mergeSession combines a user's duplicate session into this one. Both
+// transcripts are read, so it needs an access reason like a transcript read
+// and is audited against both sessions.
+func (h *Handler) mergeSession(w http.ResponseWriter, r *http.Request) {
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" {
+		httperr.Write(w, r, http.StatusBadRequest, `body must be {"from": "<session id>"}`)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if !h.audited(w, r, sessionID, "merge") || !h.audited(w, r, req.From, "merge") {
+		return
+	}
+
+	res, err := h.Sessions.Merge(r.Context(), sessionID, req.From)
+	if errors.Is(err, session.ErrSameSession) {
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to merge session %s into %s: %v", req.From, sessionID, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to merge sessions")
+		return
+	}
+	log.Printf("Session %s merged into %s by %s (%d turns)", res.MergedFrom, res.SessionID, actor(r.Context()), res.Turns)
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+
+	"orchestrator/httperr"
+)
+
+// getExternalMessage finds our processing record for a platform message ID,
+// e.g. a WhatsApp wamid a customer quotes to support. It returns IDs and the
+// answer's delivery status but no message content, so it is not audited;
+// use the transcript endpoint to read the conversation.
+func (h *Handler) getExternalMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ref, err := h.Archive.LookupExternal(ctx, r.PathValue("channel"), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to look up external message: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to look up message")
+		return
+	}
+	if ref == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown or expired external ID")
+		return
+	}
+	// The answer is published under the inbound message ID
+	delivery, err := h.Publisher.GetStatus(ctx, ref.MessageID)
+	if err != nil {
+		log.Printf("Failed to load delivery status: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": ref, "delivery": delivery})
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/httperr"
+	"orchestrator/notes"
+)
+
+type addNoteRequest struct {
+	Text   string `json:"text"`
+	Shared bool   `json:"share_with_assistant"`
+}
+
+// listNotes shows a session's operator notes. They may hold what the user
+// told an agent, so reads are audited like transcripts.
+func (h *Handler) listNotes(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if !h.audited(w, r, sessionID, "notes") {
+		return
+	}
+	all, err := h.Notes.List(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("Failed to list notes: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list notes")
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"notes": all})
+}
+
+// addNote attaches a note to the session, written by the calling operator.
+func (h *Handler) addNote(w http.ResponseWriter, r *http.Request) {
+	var req addNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	sessionID := r.PathValue("id")
+	note, err := h.Notes.Add(r.Context(), sessionID, actor(r.Context()), req.Text, req.Shared)
+	switch {
+	case errors.Is(err, notes.ErrEmpty):
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, notes.ErrTooMany):
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		log.Printf("Failed to add note: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to add note")
+		return
+	}
+	log.Printf("Note %s added to session %s by %s (shared: %t)", note.ID, sessionID, note.Author, note.Shared)
+	writeJSON(w, http.StatusCreated, note)
+}
+
+// deleteNote removes a note. Named operators may only delete their own; the
+// shared admin token may delete any.
+func (h *Handler) deleteNote(w http.ResponseWriter, r *http.Request) {
+	author := actor(r.Context())
+	if author == "admin" {
+		author = ""
+	}
+	err := h.Notes.Delete(r.Context(), r.PathValue("id"), r.PathValue("note"), author)
+	switch {
+	case errors.Is(err, notes.ErrNotFound):
+		httperr.Write(w, r, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, notes.ErrForbidden):
+		httperr.Write(w, r, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		log.Printf("Failed to delete note: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to delete note")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchestrator/httperr"
+	"orchestrator/override"
+)
+
+const maxOverrideIDLen = 64
+
+func (h *Handler) listOverrides(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Overrides.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list overrides: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list overrides")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"overrides": all})
+}
+
+func (h *Handler) getOverride(w http.ResponseWriter, r *http.Request) {
+	o, err := h.Overrides.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load override: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load override")
+		return
+	}
+	if o == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown override")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"override": o, "active": o.Active(time.Now())})
+}
+
+type putOverrideRequest struct {
+	Intent         string     `json:"intent"`
+	Questions      []string   `json:"questions"`
+	Answer         string     `json:"answer"`
+	EffectiveFrom  time.Time  `json:"effective_from"`
+	EffectiveUntil *time.Time `json:"effective_until"`
+	Author         string     `json:"author"`
+}
+
+// putOverride adds a new version. Questions and intent are replaced only when
+// provided, so rewording an answer doesn't require resending them.
+func (h *Handler) putOverride(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" || len(id) > maxOverrideIDLen || strings.ContainsAny(id, " /") {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid override id")
+		return
+	}
+	var req putOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Answer) == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "answer is required")
+		return
+	}
+	if req.EffectiveUntil != nil && !req.EffectiveUntil.After(req.EffectiveFrom) {
+		httperr.Write(w, r, http.StatusBadRequest, "effective_until must be after effective_from")
+		return
+	}
+
+	ctx := r.Context()
+	existing, err := h.Overrides.Get(ctx, id)
+	if err != nil {
+		log.Printf("Failed to load override: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load override")
+		return
+	}
+	if existing == nil && len(req.Questions) == 0 {
+		httperr.Write(w, r, http.StatusBadRequest, "questions are required for a new override")
+		return
+	}
+
+	o, err := h.Overrides.Put(ctx, id, req.Intent, req.Questions, override.Version{
+		Answer:         req.Answer,
+		EffectiveFrom:  req.EffectiveFrom,
+		EffectiveUntil: req.EffectiveUntil,
+		Author:         req.Author,
+	})
+	if err != nil {
+		log.Printf("Failed to save override: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to save override")
+		return
+	}
+	log.Printf("Override %s updated to v%d", id, len(o.Versions))
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (h *Handler) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.Overrides.Delete(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to delete override: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to delete override")
+		return
+	}
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "unknown override")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
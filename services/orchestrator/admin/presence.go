@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"orchestrator/httperr"
+)
+
+// listOnline shows the web sessions that have a connection open, with the
+// adapter replica holding each connection.
+func (h *Handler) listOnline(w http.ResponseWriter, r *http.Request) {
+	if h.Presence == nil {
+		httperr.Write(w, r, http.StatusNotFound, "presence disabled")
+		return
+	}
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+	sessions, err := h.Presence.Online(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to list online sessions: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list online sessions")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+// getPresence shows the session's open connections.
+func (h *Handler) getPresence(w http.ResponseWriter, r *http.Request) {
+	if h.Presence == nil {
+		httperr.Write(w, r, http.StatusNotFound, "presence disabled")
+		return
+	}
+	sessionID := r.PathValue("id")
+	s, err := h.Presence.Get(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("Failed to load presence: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load presence")
+		return
+	}
+	if s == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"session_id": sessionID, "online": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"session_id": sessionID, "online": true, "connections": s.Connections})
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/httperr"
+	"orchestrator/reports"
+)
+
+const maxReportsListed = 200
+
+// listReports lists reported answers without their conversation, so it is
+// not audited.
+func (h *Handler) listReports(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Reports.List(r.Context(), maxReportsListed)
+	if err != nil {
+		log.Printf("Failed to list reports: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list reports")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"reports": all})
+}
+
+// getReport returns a report with the conversation that led to it, audited
+// like a transcript read.
+func (h *Handler) getReport(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.Reports.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, reports.ErrNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load report: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load report")
+		return
+	}
+	if !h.audited(w, r, rep.SessionID, "report") {
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
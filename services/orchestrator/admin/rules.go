@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"orchestrator/httperr"
+	"orchestrator/rules"
+)
+
+const maxRuleIDLen = 64
+
+func (h *Handler) listRules(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Rules.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list rules: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rules": all})
+}
+
+func (h *Handler) getRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := h.Rules.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load rule: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load rule")
+		return
+	}
+	if rule == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown rule")
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// putRule creates or replaces a rule. It takes effect on every replica
+// immediately.
+func (h *Handler) putRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" || len(id) > maxRuleIDLen || strings.ContainsAny(id, " /") {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid rule id")
+		return
+	}
+	var rule rules.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	rule.ID = id
+	if err := h.Rules.Validate(rule); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.Rules.Put(r.Context(), rule); err != nil {
+		log.Printf("Failed to save rule: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to save rule")
+		return
+	}
+	log.Printf("Rule %s saved (%s)", id, rule.Action)
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) deleteRule(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.Rules.Delete(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to delete rule: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to delete rule")
+		return
+	}
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "unknown rule")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
+
+type testRulesRequest struct {
+	Text    string `json:"text"`
+	Tenant  string `json:"tenant"`
+	Channel string `json:"channel"`
+}
+
+// testRules shows what the active rules would do with a message, without
+// sending anything.
+func (h *Handler) testRules(w http.ResponseWriter, r *http.Request) {
+	var req testRulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = "web"
+	}
+	writeJSON(w, http.StatusOK, h.Rules.DryRun(req.Tenant, req.Channel, req.Text))
+}
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"orchestrator/httperr"
+)
+
+// getSLA shows the session's conversation timers against its targets.
+func (h *Handler) getSLA(w http.ResponseWriter, r *http.Request) {
+	if h.SLA == nil {
+		httperr.Write(w, r, http.StatusNotFound, "SLA tracking disabled")
+		return
+	}
+	timers, err := h.SLA.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load SLA timers: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load SLA timers")
+		return
+	}
+	if timers == nil {
+		httperr.Write(w, r, http.StatusNotFound, "no conversation running")
+		return
+	}
+	writeJSON(w, http.StatusOK, timers)
+}
+
+// pickupSession records that the calling agent took over a handed-off
+// conversation, stopping its pickup timer.
+func (h *Handler) pickupSession(w http.ResponseWriter, r *http.Request) {
+	if h.SLA == nil {
+		httperr.Write(w, r, http.StatusNotFound, "SLA tracking disabled")
+		return
+	}
+	sessionID := r.PathValue("id")
+	ok, err := h.SLA.PickedUp(r.Context(), sessionID, actor(r.Context()), time.Now())
+	if err != nil {
+		log.Printf("Failed to record pickup: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to record pickup")
+		return
+	}
+	if !ok {
+		httperr.Write(w, r, http.StatusConflict, "session was not handed off")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sessionID})
+}
+
+// resolveSession ends the session's conversation, stopping its resolution
+// timer.
+func (h *Handler) resolveSession(w http.ResponseWriter, r *http.Request) {
+	if h.SLA == nil {
+		httperr.Write(w, r, http.StatusNotFound, "SLA tracking disabled")
+		return
+	}
+	sessionID := r.PathValue("id")
+	ok, err := h.SLA.Resolved(r.Context(), sessionID, time.Now())
+	if err != nil {
+		log.Printf("Failed to resolve session: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to resolve session")
+		return
+	}
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "no conversation running")
+		return
+	}
+	log.Printf("Session %s resolved by %s", sessionID, actor(r.Context()))
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sessionID})
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/httperr"
+	"orchestrator/smoke"
+)
+
+// runSmoke plays the smoke test scenarios against this deployment and
+// answers 503 if any failed, so a rollout can gate on `curl --fail`.
+func (h *Handler) runSmoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rep, err := h.Smoke.Run(ctx, actor(ctx))
+	if errors.Is(err, smoke.ErrRunning) {
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to run smoke tests: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to run smoke tests")
+		return
+	}
+	status := http.StatusOK
+	if !rep.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, rep)
+}
+
+func (h *Handler) getSmokeReport(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.Smoke.Latest(r.Context())
+	if err != nil {
+		log.Printf("Failed to load smoke test report: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load smoke test report")
+		return
+	}
+	if rep == nil {
+		httperr.Write(w, r, http.StatusNotFound, "no smoke test has run yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
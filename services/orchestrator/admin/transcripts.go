@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"orchestrator/audit"
+	"orchestrator/httperr"
+)
+
+type actorKey struct{}
+
+// AddOperators gives named operators their own admin tokens, so audit
+// records say who read a transcript rather than just "admin".
+func (h *Handler) AddOperators(tokens map[string]string) {
+	for name, token := range tokens {
+		h.operators = append(h.operators, operator{name: name, token: token})
+	}
+}
+
+type operator struct {
+	name  string
+	token string
+}
+
+// authenticate returns the actor for the request's bearer token, or "" if
+// it matches none.
+func (h *Handler) authenticate(r *http.Request) string {
+	got := []byte(r.Header.Get("Authorization"))
+	actor := ""
+	for _, op := range h.operators {
+		if subtle.ConstantTimeCompare(got, []byte("Bearer "+op.token)) == 1 {
+			actor = op.name
+		}
+	}
+	if actor == "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+h.token)) == 1 {
+		actor = "admin"
+		// The shared token can't identify a person; keep what the caller says
+		if claimed := strings.TrimSpace(r.Header.Get("X-Actor")); claimed != "" {
+			actor = "admin (" + claimed + ")"
+		}
+	}
+	return actor
+}
+
+func actor(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
+
+// audited records a read of sessionID's data before it is served. The
+// caller must pass a reason code (?reason= or X-Access-Reason); reads that
+// cannot be logged are refused.
+func (h *Handler) audited(w http.ResponseWriter, r *http.Request, sessionID, resource string) bool {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = r.Header.Get("X-Access-Reason")
+	}
+	if _, ok := audit.Reasons[reason]; !ok {
+		httperr.Write(w, r, http.StatusBadRequest, "a valid access reason is required")
+		return false
+	}
+	err := h.Audit.Record(r.Context(), audit.Access{
+		Actor:         actor(r.Context()),
+		SessionID:     sessionID,
+		Resource:      resource,
+		Reason:        reason,
+		Note:          r.URL.Query().Get("note"),
+		RemoteAddr:    r.RemoteAddr,
+		CorrelationID: httperr.CorrelationID(r),
+	})
+	if err != nil {
+		log.Printf("Failed to audit %s access to session %s: %v", resource, sessionID, err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to record access")
+		return false
+	}
+	return true
+}
+
+func (h *Handler) getTranscript(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if !h.audited(w, r, sessionID, "transcript") {
+		return
+	}
+	turns, err := h.Archive.Load(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("Failed to load transcript: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load transcript")
+		return
+	}
+	if len(turns) == 0 {
+		httperr.Write(w, r, http.StatusNotFound, "unknown or anonymized session")
+		return
+	}
+	// Exports carry the operators' notes alongside the conversation
+	sessionNotes, err := h.Notes.List(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("Failed to load notes: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load notes")
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"session_id": sessionID, "turns": turns, "notes": sessionNotes})
+}
+
+func (h *Handler) getAccessLog(w http.ResponseWriter, r *http.Request) {
+	history, err := h.Audit.ForSession(r.Context(), r.PathValue("id"))
+	if err != nil {
+		log.Printf("Failed to load access history: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load access history")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"accesses": history})
+}
+
+func (h *Handler) listAccessReasons(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"reasons": audit.Reasons})
+}
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchestrator/httperr"
+	"orchestrator/widget"
+)
+
+const maxSiteKeyLen = 128
+
+func (h *Handler) listWidgetConfigs(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Widgets.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list widget configs: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to list widget configs")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"configs": all})
+}
+
+func (h *Handler) getWidgetConfig(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Widgets.Get(r.Context(), r.PathValue("key"))
+	if err != nil {
+		log.Printf("Failed to load widget config: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to load widget config")
+		return
+	}
+	if c == nil {
+		httperr.Write(w, r, http.StatusNotFound, "unknown site key")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// putWidgetConfig replaces a site's widget config. Embedded widgets pick it
+// up on their next page load.
+func (h *Handler) putWidgetConfig(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" || len(key) > maxSiteKeyLen || strings.ContainsAny(key, " /") {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid site key")
+		return
+	}
+	var c widget.Config
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := widget.Validate(c); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	c.SiteKey = key
+	c.UpdatedBy = actor(ctx)
+	c.UpdatedAt = time.Now().UTC()
+	if err := h.Widgets.Put(ctx, c); err != nil {
+		log.Printf("Failed to save widget config: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to save widget config")
+		return
+	}
+	log.Printf("Widget config for %s saved by %s", key, c.UpdatedBy)
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) deleteWidgetConfig(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.Widgets.Delete(r.Context(), r.PathValue("key"))
+	if err != nil {
+		log.Printf("Failed to delete widget config: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to delete widget config")
+		return
+	}
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "unknown site key")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
@@ -0,0 +1,204 @@
+package anonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/archive"
+)
+
+const (
+	anonPrefix = "anon:transcript:"
+	batchSize  = 100
+)
+
+var piiPatterns = []struct {
+	re   *regexp.Regexp
+	mask string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[email]"},
+	{regexp.MustCompile(`\+?\d[\d\s\-().]{7,}\d`), "[phone]"},
+	{regexp.MustCompile(`https?://\S+\?\S+`), "[url]"},
+}
+
+// Record is an anonymized transcript, safe for analytics and evaluation.
+type Record struct {
+	PseudoSessionID string         `json:"pseudo_session_id"`
+	AnonymizedAt    time.Time      `json:"anonymized_at"`
+	Turns           []archive.Turn `json:"turns"`
+}
+
+// Job pseudonymizes user and session identifiers and scrubs PII from
+// transcripts that have been idle longer than maxAge. The original transcript
+// is removed once the anonymized copy is written.
+type Job struct {
+	rdb      *redis.Client
+	archive  *archive.Store
+	secret   []byte
+	maxAge   time.Duration
+	interval time.Duration
+	sink     func(context.Context, Record)
+}
+
+func NewJob(rdb *redis.Client, store *archive.Store, secret string, maxAge, interval time.Duration) *Job {
+	return &Job{
+		rdb:      rdb,
+		archive:  store,
+		secret:   []byte(secret),
+		maxAge:   maxAge,
+		interval: interval,
+	}
+}
+
+// OnAnonymized registers sink to receive each anonymized record, e.g. to
+// sample it for training data.
+func (j *Job) OnAnonymized(sink func(context.Context, Record)) {
+	j.sink = sink
+}
+
+func (j *Job) Run(ctx context.Context) {
+	log.Printf("Anonymization job started (max age %s)", j.maxAge)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if n, err := j.RunOnce(ctx); err != nil {
+			log.Printf("Anonymization run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Anonymized %d transcripts", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce anonymizes every transcript idle past maxAge. A session that
+// fails is logged and left for the next run; the rest go ahead.
+func (j *Job) RunOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-j.maxAge)
+	total, failed := 0, 0
+	for {
+		// Failed sessions stay in the index ahead of the rest, so skip them
+		ids, err := j.archive.IdleSince(ctx, cutoff, int64(failed), batchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			if err := j.anonymize(ctx, id); err != nil {
+				if ctx.Err() != nil {
+					return total, ctx.Err()
+				}
+				log.Printf("Failed to anonymize session %s: %v", id, err)
+				failed++
+				continue
+			}
+			total++
+		}
+	}
+	if failed > 0 {
+		return total, fmt.Errorf("failed to anonymize %d sessions", failed)
+	}
+	return total, nil
+}
+
+func (j *Job) anonymize(ctx context.Context, sessionID string) error {
+	turns, err := j.archive.Load(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := j.archive.ForgetExternal(ctx, turns); err != nil {
+		return err
+	}
+	for i := range turns {
+		turns[i].UserID = j.pseudonym(turns[i].UserID)
+		// Platform IDs such as Telegram's chat ID identify the user
+		turns[i].ExternalID = ""
+		turns[i].Content = ScrubPII(turns[i].Content)
+	}
+
+	rec := Record{
+		PseudoSessionID: j.pseudonym(sessionID),
+		AnonymizedAt:    time.Now().UTC(),
+		Turns:           turns,
+	}
+	if err := j.store(ctx, rec); err != nil {
+		return err
+	}
+	if j.sink != nil {
+		j.sink(ctx, rec)
+	}
+	return j.archive.Delete(ctx, sessionID)
+}
+
+// store saves rec, appending its turns to an earlier record of the same
+// session, which was anonymized before the conversation resumed.
+func (j *Job) store(ctx context.Context, rec Record) error {
+	key := anonPrefix + rec.PseudoSessionID
+	err := j.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		stored := rec
+		prev, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			var earlier Record
+			if err := json.Unmarshal(prev, &earlier); err != nil {
+				return fmt.Errorf("failed to unmarshal earlier record: %w", err)
+			}
+			// A run that stored the record but failed to delete the
+			// transcript sends the same turns again
+			stored.Turns = earlier.Turns
+			for _, t := range rec.Turns {
+				if n := len(earlier.Turns); n == 0 || t.Timestamp.After(earlier.Turns[n-1].Timestamp) {
+					stored.Turns = append(stored.Turns, t)
+				}
+			}
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return fmt.Errorf("failed to marshal record: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to store anonymized transcript: %w", err)
+	}
+	return nil
+}
+
+// pseudonym is a keyed hash so the same user maps to the same pseudonym across
+// transcripts without being reversible by anyone lacking the secret.
+func (j *Job) pseudonym(id string) string {
+	if id == "" || id == "anonymous" {
+		return id
+	}
+	mac := hmac.New(sha256.New, j.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// ScrubPII masks emails, phone numbers and URLs carrying query strings.
+func ScrubPII(text string) string {
+	for _, p := range piiPatterns {
+		text = p.re.ReplaceAllString(text, p.mask)
+	}
+	return text
+}
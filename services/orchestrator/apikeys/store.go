@@ -0,0 +1,186 @@
+// Package apikeys issues and revokes the API keys partner integrations use
+// on the channel adapter's non-browser endpoints. Only a hash of each key is
+// stored; the key itself is shown once, when it is created.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// keysKey and hashesKey are read by the channel adapter; keep the field
+// layout in sync.
+const (
+	keysKey   = "apikeys"
+	hashesKey = "apikeys:hashes"
+	// Keys are recognizable in logs and secret scanners by this prefix
+	secretPrefix = "mk_"
+	maxNameLen   = 100
+)
+
+// DefaultRatePerMinute applies to keys created without a rate limit.
+var DefaultRatePerMinute = 60
+
+// Scopes are what a key may be allowed to do: "chat" is POST /v1/chat and
+// "stream" its streamed answers and the streaming gRPC chat service; "agent"
+// is the agent console, /ws/agent, for a human agent named by the key.
+var Scopes = []string{"chat", "stream", "agent"}
+
+var ErrNotFound = errors.New("unknown API key")
+
+// Key describes an issued key. Prefix is the start of the key, enough for a
+// partner to tell which of theirs it is.
+type Key struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Prefix        string     `json:"prefix"`
+	Hash          string     `json:"hash"`
+	Scopes        []string   `json:"scopes"`
+	RatePerMinute int        `json:"rate_per_minute"`
+	CreatedBy     string     `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedBy     string     `json:"revoked_by,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Validate checks the fields an operator sets.
+func Validate(k Key) error {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" || len(k.Name) > maxNameLen {
+		return fmt.Errorf("name is required and at most %d characters", maxNameLen)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("scopes must list at least one of %s", strings.Join(Scopes, ", "))
+	}
+	for _, s := range k.Scopes {
+		if !known(s) {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	if k.RatePerMinute < 0 {
+		return errors.New("rate_per_minute must not be negative")
+	}
+	return nil
+}
+
+func known(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// Create issues a key for k's name, scopes and rate limit and returns the
+// key itself along with its record.
+func (s *Store) Create(ctx context.Context, k Key) (string, *Key, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	k.ID = uuid.New().String()
+	k.Name = strings.TrimSpace(k.Name)
+	k.Prefix = secret[:len(secretPrefix)+6]
+	k.Hash = Hash(secret)
+	if k.RatePerMinute == 0 {
+		k.RatePerMinute = DefaultRatePerMinute
+	}
+	k.CreatedAt = time.Now().UTC()
+	k.RevokedBy, k.RevokedAt = "", nil
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal API key: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, keysKey, k.ID, data)
+	pipe.HSet(ctx, hashesKey, k.Hash, k.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", nil, fmt.Errorf("failed to save API key: %w", err)
+	}
+	return secret, &k, nil
+}
+
+// List returns every key, revoked ones included, for auditing.
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	raw, err := s.rdb.HGetAll(ctx, keysKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+	out := make([]Key, 0, len(raw))
+	for id, data := range raw {
+		var k Key
+		if err := json.Unmarshal([]byte(data), &k); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal API key %s: %w", id, err)
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*Key, error) {
+	data, err := s.rdb.HGet(ctx, keysKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	var k Key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+	}
+	return &k, nil
+}
+
+// Revoke stops the key working at once. Its record is kept so past traffic
+// can still be attributed.
+func (s *Store) Revoke(ctx context.Context, id, by string) (*Key, error) {
+	k, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if k.RevokedAt != nil {
+		return k, nil
+	}
+	now := time.Now().UTC()
+	k.RevokedBy, k.RevokedAt = by, &now
+	data, err := json.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal API key: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HDel(ctx, hashesKey, k.Hash)
+	pipe.HSet(ctx, keysKey, k.ID, data)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return k, nil
+}
+
+// Hash is how a key is looked up without storing it.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// metaPrefix and userIndexPrefix are read by the channel adapter to list a
+// signed-in user's conversations; keep the field layout in sync. The summary
+// hash holds the title (the user's first message), user_id, channel, the
+// number of turns and started_at and last_active in Unix seconds.
+const (
+	metaPrefix      = "transcript:meta:"
+	userIndexPrefix = "transcripts:user:"
+	maxTitleRunes   = 80
+)
+
+// indexConversation updates the summary of sessionID for turns just
+// appended, and lists the session under the user who took part in it.
+func indexConversation(ctx context.Context, pipe redis.Pipeliner, sessionID string, turns []Turn) {
+	key := metaPrefix + sessionID
+	first, last := turns[0].Timestamp, turns[0].Timestamp
+	var firstQuestion, user string
+	for _, t := range turns {
+		if t.Timestamp.Before(first) {
+			first = t.Timestamp
+		}
+		if t.Timestamp.After(last) {
+			last = t.Timestamp
+		}
+		if t.Role != "user" {
+			continue
+		}
+		if firstQuestion == "" {
+			firstQuestion = t.Content
+		}
+		if user == "" && t.UserID != "anonymous" {
+			user = t.UserID
+		}
+	}
+	if firstQuestion != "" {
+		pipe.HSetNX(ctx, key, "title", title(firstQuestion))
+	}
+	if user != "" {
+		pipe.HSetNX(ctx, key, "user_id", user)
+		pipe.ZAdd(ctx, userIndexPrefix+user, redis.Z{Score: float64(last.Unix()), Member: sessionID})
+	}
+	pipe.HSetNX(ctx, key, "started_at", first.Unix())
+	pipe.HSet(ctx, key, "last_active", last.Unix(), "channel", turns[len(turns)-1].Channel)
+	pipe.HIncrBy(ctx, key, "turns", int64(len(turns)))
+}
+
+func title(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if r := []rune(content); len(r) > maxTitleRunes {
+		return string(r[:maxTitleRunes-1]) + "…"
+	}
+	return content
+}
+
+// unindexConversation drops sessionID's summary and its entry in its user's
+// list.
+func (s *Store) unindexConversation(ctx context.Context, pipe redis.Pipeliner, sessionID string) {
+	if user, err := s.rdb.HGet(ctx, metaPrefix+sessionID, "user_id").Result(); err == nil {
+		pipe.ZRem(ctx, userIndexPrefix+user, sessionID)
+	}
+	pipe.Del(ctx, metaPrefix+sessionID)
+}
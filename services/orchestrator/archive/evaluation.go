@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// evaluationAttempts bounds retries when turns are appended while a score
+// is being attached.
+const evaluationAttempts = 5
+
+// ErrNoTurn means the transcript has no answer with the given message ID.
+var ErrNoTurn = errors.New("no archived answer for message")
+
+// Evaluation is the quality score of an answer, kept on its turn so it
+// lasts as long as the transcript and moves with it when anonymized.
+type Evaluation struct {
+	Overall     float64   `json:"overall"`
+	JudgeScore  *float64  `json:"judge_score,omitempty"`
+	Refusal     bool      `json:"refusal,omitempty"`
+	Reported    string    `json:"reported,omitempty"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// SetEvaluation attaches e to the session's answer with messageID, the last
+// assistant turn carrying it. It returns ErrNoTurn if there is none.
+func (s *Store) SetEvaluation(ctx context.Context, sessionID, messageID string, e Evaluation) error {
+	sessionID, err := s.Resolve(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	key := transcriptPrefix + sessionID
+	set := func(tx *redis.Tx) error {
+		raw, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		for i := len(raw) - 1; i >= 0; i-- {
+			var t Turn
+			if err := json.Unmarshal([]byte(raw[i]), &t); err != nil {
+				return fmt.Errorf("failed to unmarshal turn: %w", err)
+			}
+			if t.MessageID != messageID || t.Role != "assistant" {
+				continue
+			}
+			t.Evaluation = &e
+			data, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("failed to marshal turn: %w", err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LSet(ctx, key, int64(i), string(data))
+				return nil
+			})
+			return err
+		}
+		return ErrNoTurn
+	}
+	for i := 0; i < evaluationAttempts; i++ {
+		err := s.rdb.Watch(ctx, set, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrNoTurn) {
+			return fmt.Errorf("failed to archive evaluation: %w", err)
+		}
+		return err
+	}
+	return fmt.Errorf("failed to archive evaluation: transcript kept changing")
+}
+
+// LoadEvaluation returns the evaluation of the session's answer with
+// messageID, or nil if it was not evaluated.
+func (s *Store) LoadEvaluation(ctx context.Context, sessionID, messageID string) (*Evaluation, error) {
+	turns, err := s.Load(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(turns) - 1; i >= 0; i-- {
+		if t := turns[i]; t.MessageID == messageID && t.Role == "assistant" {
+			return t.Evaluation, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const externalPrefix = "extid:"
+
+// ExternalTTL is how long a platform message ID can be looked up. The index
+// links platform IDs to sessions, so main caps it at ANONYMIZE_AFTER.
+var ExternalTTL = 30 * 24 * time.Hour
+
+// ExternalRef ties a platform's message ID to our message and session IDs.
+type ExternalRef struct {
+	Channel    string    `json:"channel"`
+	ExternalID string    `json:"external_id"`
+	MessageID  string    `json:"message_id"`
+	SessionID  string    `json:"session_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+func externalKey(channel, externalID string) string {
+	return externalPrefix + channel + ":" + externalID
+}
+
+// IndexExternal records ref so support can find our processing record from
+// the ID a user or platform reports. Platform IDs are only unique within a
+// channel, so the channel is part of the key.
+func (s *Store) IndexExternal(ctx context.Context, ref ExternalRef) error {
+	key := externalKey(ref.Channel, ref.ExternalID)
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key,
+		"message_id", ref.MessageID,
+		"session_id", ref.SessionID,
+		"received_at", ref.ReceivedAt.Format(time.RFC3339Nano),
+	)
+	pipe.Expire(ctx, key, ExternalTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to index external ID: %w", err)
+	}
+	return nil
+}
+
+// LookupExternal returns nil if the ID is unknown or has expired.
+func (s *Store) LookupExternal(ctx context.Context, channel, externalID string) (*ExternalRef, error) {
+	vals, err := s.rdb.HGetAll(ctx, externalKey(channel, externalID)).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && len(vals) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up external ID: %w", err)
+	}
+	ref := &ExternalRef{
+		Channel:    channel,
+		ExternalID: externalID,
+		MessageID:  vals["message_id"],
+		SessionID:  vals["session_id"],
+	}
+	ref.ReceivedAt, _ = time.Parse(time.RFC3339Nano, vals["received_at"])
+	return ref, nil
+}
+
+// ForgetExternal removes the index entries of the turns' platform IDs, so
+// they no longer lead to the session once it is anonymized.
+func (s *Store) ForgetExternal(ctx context.Context, turns []Turn) error {
+	var keys []string
+	for _, t := range turns {
+		if t.ExternalID != "" {
+			keys = append(keys, externalKey(t.Channel, t.ExternalID))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to remove external IDs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	aliasPrefix = "transcript:alias:"
+	// Merging A into B and later B into C leaves a chain; it is followed at
+	// most this far
+	maxAliasHops = 5
+	mergeRetries = 3
+)
+
+// AliasTTL is how long a merged-away session keeps pointing at the session
+// it was merged into.
+var AliasTTL = 90 * 24 * time.Hour
+
+// Resolve returns the session a merged-away session now lives in, or
+// sessionID itself if it was never merged.
+func (s *Store) Resolve(ctx context.Context, sessionID string) (string, error) {
+	id := sessionID
+	for i := 0; i < maxAliasHops; i++ {
+		next, err := s.rdb.Get(ctx, aliasPrefix+id).Result()
+		if err == redis.Nil {
+			return id, nil
+		}
+		if err != nil {
+			return sessionID, fmt.Errorf("failed to resolve session alias: %w", err)
+		}
+		id = next
+	}
+	return id, nil
+}
+
+// Merge moves the duplicate's transcript into the canonical one, interleaved
+// by timestamp, and leaves an alias so the duplicate ID keeps resolving to
+// the canonical session. It returns the merged transcript.
+func (s *Store) Merge(ctx context.Context, canonicalID, duplicateID string) ([]Turn, error) {
+	var merged []Turn
+	canonicalKey, duplicateKey := transcriptPrefix+canonicalID, transcriptPrefix+duplicateID
+	txf := func(tx *redis.Tx) error {
+		canonical, err := s.Load(ctx, canonicalID)
+		if err != nil {
+			return err
+		}
+		duplicate, err := s.Load(ctx, duplicateID)
+		if err != nil {
+			return err
+		}
+		merged = append(canonical, duplicate...)
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Timestamp.Before(merged[j].Timestamp)
+		})
+
+		values := make([]interface{}, 0, len(merged))
+		for _, t := range merged {
+			data, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("failed to marshal turn: %w", err)
+			}
+			values = append(values, string(data))
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, canonicalKey, duplicateKey)
+			s.unindexConversation(ctx, pipe, canonicalID)
+			s.unindexConversation(ctx, pipe, duplicateID)
+			if len(values) > 0 {
+				pipe.RPush(ctx, canonicalKey, values...)
+				last := merged[len(merged)-1].Timestamp
+				pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(last.Unix()), Member: canonicalID})
+				indexConversation(ctx, pipe, canonicalID, merged)
+			}
+			pipe.ZRem(ctx, indexKey, duplicateID)
+			pipe.Set(ctx, aliasPrefix+duplicateID, canonicalID, AliasTTL)
+			return nil
+		})
+		return err
+	}
+
+	// A turn appended while we were reading would be lost, so retry instead
+	for i := 0; i < mergeRetries; i++ {
+		err := s.rdb.Watch(ctx, txf, canonicalKey, duplicateKey)
+		if err == nil {
+			return merged, nil
+		}
+		if !errors.Is(err, redis.TxFailedErr) {
+			return nil, fmt.Errorf("failed to merge transcripts: %w", err)
+		}
+	}
+	return nil, errors.New("failed to merge transcripts: sessions kept changing")
+}
@@ -0,0 +1,40 @@
+package archive
+
+// ApplyRevisions returns a transcript as the user left it: deleted messages
+// and exchanges that an edit was answered in place of are dropped, and edits
+// of older messages are applied.
+func ApplyRevisions(turns []Turn) []Turn {
+	type edit struct {
+		at      int
+		content string
+	}
+	deleted := map[string]bool{}
+	answeredAt := map[string]int{}
+	edited := map[string]edit{}
+	for i, t := range turns {
+		switch {
+		case t.Edits == "":
+		case t.Deleted:
+			deleted[t.Edits] = true
+		case t.MessageID == t.Edits:
+			answeredAt[t.Edits] = i
+		default:
+			edited[t.Edits] = edit{at: i, content: t.Content}
+		}
+	}
+
+	var out []Turn
+	for i, t := range turns {
+		if t.Edits != "" && t.MessageID != t.Edits || deleted[t.MessageID] {
+			continue
+		}
+		if at, ok := answeredAt[t.MessageID]; ok && i < at {
+			continue
+		}
+		if e, ok := edited[t.MessageID]; ok && t.Role == "user" && e.at > i {
+			t.Content = e.content
+		}
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	transcriptPrefix = "transcript:"
+	indexKey         = "transcripts:index"
+)
+
+// Turn is a single archived message. Unlike the session history it is never
+// truncated and carries the user and timestamp needed for retention.
+type Turn struct {
+	MessageID string `json:"message_id,omitempty"`
+	// ExternalID is the platform's ID for an inbound message.
+	ExternalID string    `json:"external_id,omitempty"`
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	UserID     string    `json:"user_id"`
+	Channel    string    `json:"channel"`
+	Backend    string    `json:"backend,omitempty"`
+	Intent     string    `json:"intent,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	// ModelUsed, LatencyMS and the token counts are set on generated answers.
+	ModelUsed        string `json:"model_used,omitempty"`
+	LatencyMS        int64  `json:"latency_ms,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	// Attachments are IDs of files stored with the message, e.g. screenshots.
+	Attachments []string `json:"attachments,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Flags and Experiments are what was in effect for the message: the
+	// flags that were on and the session's experiment variants.
+	Flags       []string          `json:"flags,omitempty"`
+	Experiments map[string]string `json:"experiments,omitempty"`
+	// Edits is set on a user turn that replaced an earlier message of the
+	// user, or withdrew it when Deleted; the earlier turn is kept.
+	Edits   string `json:"edits,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+	// Evaluation is set on an answer once the evaluator has scored it.
+	Evaluation *Evaluation `json:"evaluation,omitempty"`
+}
+
+// Store keeps the full transcript of every session in Redis, indexed by last
+// activity so retention jobs can find stale transcripts cheaply.
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+func (s *Store) Append(ctx context.Context, sessionID string, turns ...Turn) error {
+	if len(turns) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(turns))
+	last := time.Time{}
+	for _, t := range turns {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("failed to marshal turn: %w", err)
+		}
+		values = append(values, string(data))
+		if t.Timestamp.After(last) {
+			last = t.Timestamp
+		}
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.RPush(ctx, transcriptPrefix+sessionID, values...)
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(last.Unix()), Member: sessionID})
+	indexConversation(ctx, pipe, sessionID, turns)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to archive turns: %w", err)
+	}
+	return nil
+}
+
+// Load returns the session's transcript. A session that was merged away
+// returns the transcript it was merged into.
+func (s *Store) Load(ctx context.Context, sessionID string) ([]Turn, error) {
+	raw, err := s.rdb.LRange(ctx, transcriptPrefix+sessionID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcript: %w", err)
+	}
+	if len(raw) == 0 {
+		if id, err := s.Resolve(ctx, sessionID); err == nil && id != sessionID {
+			return s.Load(ctx, id)
+		}
+	}
+	turns := make([]Turn, 0, len(raw))
+	for _, r := range raw {
+		var t Turn
+		if err := json.Unmarshal([]byte(r), &t); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal turn: %w", err)
+		}
+		turns = append(turns, t)
+	}
+	return turns, nil
+}
+
+// IdleSince returns up to limit session IDs whose last activity is before
+// cutoff, least recent first, skipping the first offset.
+func (s *Store) IdleSince(ctx context.Context, cutoff time.Time, offset, limit int64) ([]string, error) {
+	ids, err := s.rdb.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("(%d", cutoff.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transcript index: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *Store) Delete(ctx context.Context, sessionID string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, transcriptPrefix+sessionID)
+	pipe.ZRem(ctx, indexKey, sessionID)
+	s.unindexConversation(ctx, pipe, sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete transcript: %w", err)
+	}
+	return nil
+}
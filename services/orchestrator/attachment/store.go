@@ -0,0 +1,149 @@
+// Package attachment reads attachments stored by channel-adapter so the
+// agent console can display them through the admin API, and so uploads can
+// be passed to cognitive-core.
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/blobstore"
+)
+
+const (
+	blobPrefix       = "attachment:"
+	sessionPrefix    = "attachments:session:"
+	quarantinePrefix = "attachment:quarantine:"
+	quarantineIndex  = "attachments:quarantine"
+)
+
+type Info struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"session_id"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name,omitempty"`
+	// Reason is set on quarantined attachments.
+	Reason string `json:"reason,omitempty"`
+}
+
+type Store struct {
+	rdb   *redis.Client
+	blobs blobstore.Store
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// EnableObjectStorage reads the bytes of attachments that channel-adapter
+// put in object storage. It must be the store channel-adapter writes to.
+func (s *Store) EnableObjectStorage(blobs blobstore.Store) {
+	s.blobs = blobs
+}
+
+// Get returns the attachment and its bytes, or nil if it has expired.
+func (s *Store) Get(ctx context.Context, id string) (*Info, []byte, error) {
+	fields, err := s.rdb.HGetAll(ctx, blobPrefix+id).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load attachment: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil, nil
+	}
+	info := parse(id, fields)
+	location, ok := fields["location"]
+	if !ok {
+		return info, []byte(fields["data"]), nil
+	}
+	if s.blobs == nil || s.blobs.Name() != fields["storage"] {
+		return nil, nil, fmt.Errorf("attachment %s is in %s storage, which is not configured", id, fields["storage"])
+	}
+	data, err := s.blobs.Get(ctx, location)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load attachment: %w", err)
+	}
+	return info, data, nil
+}
+
+// ForSession lists a session's attachments that have not yet expired.
+func (s *Store) ForSession(ctx context.Context, sessionID string) ([]Info, error) {
+	ids, err := s.rdb.LRange(ctx, sessionPrefix+sessionID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	out := make([]Info, 0, len(ids))
+	for _, id := range ids {
+		vals, err := s.rdb.HMGet(ctx, blobPrefix+id, metaFields...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load attachment: %w", err)
+		}
+		fields := make(map[string]string, len(metaFields))
+		for i, k := range metaFields {
+			if v, ok := vals[i].(string); ok {
+				fields[k] = v
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		out = append(out, *parse(id, fields))
+	}
+	return out, nil
+}
+
+// Quarantined lists attachments that failed the channel adapter's type or
+// malware checks, newest first. Their bytes are never served.
+func (s *Store) Quarantined(ctx context.Context, limit int64) ([]Info, error) {
+	ids, err := s.rdb.LRange(ctx, quarantineIndex, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined attachments: %w", err)
+	}
+	fieldNames := append(slices.Clone(metaFields), "reason")
+	out := make([]Info, 0, len(ids))
+	for _, id := range ids {
+		vals, err := s.rdb.HMGet(ctx, quarantinePrefix+id, fieldNames...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load quarantined attachment: %w", err)
+		}
+		fields := make(map[string]string, len(fieldNames))
+		for i, k := range fieldNames {
+			if v, ok := vals[i].(string); ok {
+				fields[k] = v
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		info := parse(id, fields)
+		info.Reason = fields["reason"]
+		out = append(out, *info)
+	}
+	return out, nil
+}
+
+var metaFields = []string{"session_id", "kind", "content_type", "size", "created_at", "name"}
+
+func parse(id string, fields map[string]string) *Info {
+	info := &Info{
+		ID:          id,
+		SessionID:   fields["session_id"],
+		Kind:        fields["kind"],
+		ContentType: fields["content_type"],
+		Name:        fields["name"],
+	}
+	info.Size, _ = strconv.Atoi(fields["size"])
+	info.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+	return info
+}
@@ -0,0 +1,90 @@
+// Package audit records who read customer conversations, when and why, so
+// compliance reviews can account for every access to a transcript.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	accessStream  = "audit:access"
+	sessionPrefix = "audit:session:"
+	// Access history outlives transcripts; it is trimmed, never expired
+	streamMaxLen  = 1000000
+	sessionMaxLen = 1000
+)
+
+// Reasons an operator may give for reading a transcript.
+var Reasons = map[string]string{
+	"support_request":  "answering a customer support request",
+	"quality_review":   "reviewing answer quality",
+	"incident":         "investigating an incident",
+	"legal_request":    "responding to a legal or regulatory request",
+	"customer_request": "fulfilling the customer's own data request",
+}
+
+// Access is one read of a session's transcript or attachments.
+type Access struct {
+	Actor         string    `json:"actor"`
+	SessionID     string    `json:"session_id"`
+	Resource      string    `json:"resource"`
+	Reason        string    `json:"reason"`
+	Note          string    `json:"note,omitempty"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+type Log struct {
+	rdb *redis.Client
+}
+
+func NewLog(rdb *redis.Client) *Log {
+	return &Log{rdb: rdb}
+}
+
+// Record appends a to the audit stream and the session's access history.
+// Callers must not serve the data if it fails.
+func (l *Log) Record(ctx context.Context, a Access) error {
+	if a.At.IsZero() {
+		a.At = time.Now().UTC()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal access: %w", err)
+	}
+	pipe := l.rdb.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: accessStream,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"access": string(data)},
+	})
+	pipe.LPush(ctx, sessionPrefix+a.SessionID, data)
+	pipe.LTrim(ctx, sessionPrefix+a.SessionID, 0, sessionMaxLen-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
+
+// ForSession returns a session's access history, most recent first.
+func (l *Log) ForSession(ctx context.Context, sessionID string) ([]Access, error) {
+	raw, err := l.rdb.LRange(ctx, sessionPrefix+sessionID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load access history: %w", err)
+	}
+	out := make([]Access, 0, len(raw))
+	for _, r := range raw {
+		var a Access
+		if err := json.Unmarshal([]byte(r), &a); err == nil {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
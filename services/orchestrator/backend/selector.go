@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"orchestrator/metrics"
+)
+
+const (
+	Stable = "stable"
+	Canary = "canary"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec("orchestrator_backend_requests_total",
+		"Cognitive-core requests by backend and outcome.", "backend", "outcome")
+	requestLatency = metrics.NewHistogramVec("orchestrator_backend_latency_seconds",
+		"Cognitive-core request latency by backend.", metrics.DefBuckets, "backend")
+)
+
+type Backend struct {
+	Name string
+	URL  string
+}
+
+// Stats is a running summary used to compare the canary against stable.
+type Stats struct {
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// Selector routes a fixed percentage of sessions, plus any explicitly listed
+// test sessions, to the canary backend. Bucketing hashes the session ID so a
+// conversation never flips between backends mid-session.
+type Selector struct {
+	stable   Backend
+	canary   Backend
+	percent  uint32
+	sessions map[string]bool
+
+	mu      sync.Mutex
+	totals  map[string]*Stats
+	latency map[string]time.Duration
+}
+
+func NewSelector(stableURL, canaryURL string, percent int, testSessions []string) *Selector {
+	sessions := make(map[string]bool)
+	for _, s := range testSessions {
+		sessions[s] = true
+	}
+	if canaryURL == "" {
+		percent = 0
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return &Selector{
+		stable:   Backend{Name: Stable, URL: stableURL},
+		canary:   Backend{Name: Canary, URL: canaryURL},
+		percent:  uint32(percent),
+		sessions: sessions,
+		totals:   map[string]*Stats{Stable: {}, Canary: {}},
+		latency:  map[string]time.Duration{},
+	}
+}
+
+func (s *Selector) Pick(sessionID string) Backend {
+	if s.canary.URL == "" {
+		return s.stable
+	}
+	if s.sessions[sessionID] {
+		return s.canary
+	}
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	if h.Sum32()%100 < s.percent {
+		return s.canary
+	}
+	return s.stable
+}
+
+func (s *Selector) Observe(name string, d time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	requestsTotal.Inc(name, outcome)
+	requestLatency.Observe(d.Seconds(), name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.totals[name]
+	if !ok {
+		st = &Stats{}
+		s.totals[name] = st
+	}
+	st.Requests++
+	if err != nil {
+		st.Errors++
+	}
+	s.latency[name] += d
+}
+
+func (s *Selector) Snapshot() map[string]Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Stats, len(s.totals))
+	for name, st := range s.totals {
+		snap := *st
+		if snap.Requests > 0 {
+			snap.ErrorRate = float64(snap.Errors) / float64(snap.Requests)
+			snap.AvgLatencyMs = float64(s.latency[name].Milliseconds()) / float64(snap.Requests)
+		}
+		out[name] = snap
+	}
+	return out
+}
+
+// ExpectedLatency is the running average latency of the named backend, or
+// zero before any requests have completed.
+func (s *Selector) ExpectedLatency(name string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.totals[name]
+	if !ok || st.Requests == 0 {
+		return 0
+	}
+	return s.latency[name] / time.Duration(st.Requests)
+}
+
+func (s *Selector) CanaryPercent() int {
+	return int(s.percent)
+}
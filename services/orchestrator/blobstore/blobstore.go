@@ -0,0 +1,121 @@
+// Package blobstore keeps attachment bytes outside Redis, in a local
+// directory or an S3-compatible bucket. The channel adapter writes objects
+// and the orchestrator reads them, so both must be configured with the same
+// ATTACHMENT_STORAGE; keep this package in sync between the services.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for objects that don't exist, e.g. because
+// the bucket's lifecycle rule has expired them.
+var ErrNotFound = errors.New("object not found")
+
+// Store holds objects under keys such as "{session_id}/{attachment_id}".
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Name identifies the store in the attachment metadata, e.g. "s3".
+	Name() string
+}
+
+// FromEnv reads ATTACHMENT_STORAGE: "redis" (the default, keeping bytes in
+// Redis and returning a nil Store), "local" with ATTACHMENT_DIR, or "s3"
+// with ATTACHMENT_S3_BUCKET, ATTACHMENT_S3_PREFIX, ATTACHMENT_S3_ENDPOINT,
+// AWS_REGION and the AWS_* credentials.
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("ATTACHMENT_STORAGE"); kind {
+	case "", "redis":
+		return nil, nil
+	case "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			return nil, errors.New("ATTACHMENT_DIR is required for local attachment storage")
+		}
+		return NewLocal(dir)
+	case "s3":
+		cfg := S3Config{
+			Bucket:       os.Getenv("ATTACHMENT_S3_BUCKET"),
+			Prefix:       os.Getenv("ATTACHMENT_S3_PREFIX"),
+			Endpoint:     os.Getenv("ATTACHMENT_S3_ENDPOINT"),
+			Region:       os.Getenv("AWS_REGION"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if cfg.Region == "" {
+			cfg.Region = "us-east-1"
+		}
+		if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return nil, errors.New("ATTACHMENT_S3_BUCKET, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for S3 attachment storage")
+		}
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("invalid ATTACHMENT_STORAGE %q: use redis, local or s3", kind)
+	}
+}
+
+// Local stores objects as files under a directory, which must be a volume
+// shared by the channel adapter and the orchestrator.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) Name() string { return "local" }
+
+func (l *Local) Put(ctx context.Context, key, contentType string, data []byte) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+	// Written aside and renamed, so a reader never sees half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write attachment: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write attachment: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return data, nil
+}
+
+// path maps key into the directory, refusing keys that would escape it.
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.dir, clean), nil
+}
@@ -0,0 +1,280 @@
+// Package campaign sends one message to many sessions at once. Large
+// campaigns can be held until a second operator approves them, and every
+// step is recorded so a send can always be traced to who asked for it and
+// who let it go out.
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/delivery"
+	"orchestrator/models"
+)
+
+const (
+	StatusPending  = "pending_approval"
+	StatusRejected = "rejected"
+	StatusSending  = "sending"
+	StatusSent     = "sent"
+	StatusFailed   = "failed"
+
+	campaignPrefix = "campaign:"
+	audiencePrefix = "campaign:audience:"
+	// Sorted by creation time for listing
+	indexKey = "campaigns"
+	// Every transition is also appended here for compliance review
+	eventsStream = "audit:campaigns"
+	eventsMaxLen = 100000
+	// Finished campaigns and their audiences are kept this long
+	retention = 90 * 24 * time.Hour
+)
+
+var (
+	ErrNotFound     = errors.New("unknown campaign")
+	ErrNotPending   = errors.New("campaign is not awaiting approval")
+	ErrSelfApproval = errors.New("a campaign cannot be approved by the operator who requested it")
+)
+
+// Event is one step in a campaign's history.
+type Event struct {
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Note   string    `json:"note,omitempty"`
+}
+
+type Campaign struct {
+	ID           string     `json:"id"`
+	Channel      string     `json:"channel"`
+	Text         string     `json:"text"`
+	AudienceSize int        `json:"audience_size"`
+	Status       string     `json:"status"`
+	RequestedBy  string     `json:"requested_by"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+	Delivered    int        `json:"delivered"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SentAt       *time.Time `json:"sent_at,omitempty"`
+	History      []Event    `json:"history"`
+}
+
+type Store struct {
+	rdb         *redis.Client
+	publisher   *delivery.Publisher
+	minAudience int
+}
+
+// NewStore holds campaigns reaching minAudience sessions or more for
+// approval; 0 sends every campaign straight away.
+func NewStore(rdb *redis.Client, publisher *delivery.Publisher, minAudience int) *Store {
+	return &Store{rdb: rdb, publisher: publisher, minAudience: minAudience}
+}
+
+// RequiresApproval reports whether a campaign to size sessions is held.
+func (s *Store) RequiresApproval(size int) bool {
+	return s.minAudience > 0 && size >= s.minAudience
+}
+
+// Create records a campaign to sessionIDs, which are fixed now so the
+// approver reviews exactly who will receive it. Campaigns that don't need
+// approval start sending immediately.
+func (s *Store) Create(ctx context.Context, actor, channel, text string, sessionIDs []string) (*Campaign, error) {
+	now := time.Now().UTC()
+	c := &Campaign{
+		ID:           uuid.New().String(),
+		Channel:      channel,
+		Text:         text,
+		AudienceSize: len(sessionIDs),
+		Status:       StatusPending,
+		RequestedBy:  actor,
+		CreatedAt:    now,
+	}
+	c.History = append(c.History, Event{At: now, Actor: actor, Action: "requested"})
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal campaign: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, campaignPrefix+c.ID, data, retention)
+	if len(sessionIDs) > 0 {
+		members := make([]interface{}, len(sessionIDs))
+		for i, id := range sessionIDs {
+			members[i] = id
+		}
+		pipe.RPush(ctx, audiencePrefix+c.ID, members...)
+		pipe.Expire(ctx, audiencePrefix+c.ID, retention)
+	}
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(now.Unix()), Member: c.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to save campaign: %w", err)
+	}
+	s.audit(ctx, c.ID, c.History[0])
+
+	if s.RequiresApproval(c.AudienceSize) {
+		log.Printf("Campaign %s to %d sessions held for approval", c.ID, c.AudienceSize)
+		return c, nil
+	}
+	return s.transition(ctx, c.ID, Event{Actor: actor, Action: "auto_approved"}, StatusSending)
+}
+
+// Approve releases a pending campaign. The approver must not be the
+// operator who requested it.
+func (s *Store) Approve(ctx context.Context, id, actor, note string) (*Campaign, error) {
+	return s.transition(ctx, id, Event{Actor: actor, Action: "approved", Note: note}, StatusSending)
+}
+
+func (s *Store) Reject(ctx context.Context, id, actor, note string) (*Campaign, error) {
+	return s.transition(ctx, id, Event{Actor: actor, Action: "rejected", Note: note}, StatusRejected)
+}
+
+// transition moves a pending campaign to status, watching its key so two
+// operators acting at once cannot both release it.
+func (s *Store) transition(ctx context.Context, id string, ev Event, status string) (*Campaign, error) {
+	key := campaignPrefix + id
+	var out *Campaign
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		c, err := load(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if c.Status != StatusPending {
+			return ErrNotPending
+		}
+		reviewed := ev.Action != "auto_approved"
+		if ev.Action == "approved" && ev.Actor == c.RequestedBy {
+			return ErrSelfApproval
+		}
+		ev.At = time.Now().UTC()
+		c.Status = status
+		if reviewed {
+			c.ReviewedBy = ev.Actor
+		}
+		c.History = append(c.History, ev)
+		data, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("failed to marshal campaign: %w", err)
+		}
+		if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, retention)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to save campaign: %w", err)
+		}
+		out = c
+		return nil
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		// Another operator reviewed it first
+		return nil, ErrNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, id, ev)
+	log.Printf("Campaign %s %s by %s", id, ev.Action, ev.Actor)
+	if status == StatusSending {
+		sending := *out
+		sending.History = slices.Clone(out.History)
+		go s.send(context.WithoutCancel(ctx), &sending)
+	}
+	return out, nil
+}
+
+// send delivers the campaign to its audience and records the outcome.
+func (s *Store) send(ctx context.Context, c *Campaign) {
+	sessions, err := s.rdb.LRange(ctx, audiencePrefix+c.ID, 0, -1).Result()
+	if err == nil {
+		c.Delivered, err = s.publisher.Broadcast(ctx, c.Channel, sessions, models.WSResponse{Type: "message", Text: c.Text})
+	}
+	now := time.Now().UTC()
+	ev := Event{At: now, Actor: "system", Action: "sent", Note: fmt.Sprintf("%d of %d delivered", c.Delivered, c.AudienceSize)}
+	c.Status = StatusSent
+	c.SentAt = &now
+	if err != nil {
+		log.Printf("Campaign %s failed: %v", c.ID, err)
+		c.Status = StatusFailed
+		c.Error = err.Error()
+		ev.Action = "failed"
+	}
+	c.History = append(c.History, ev)
+	data, mErr := json.Marshal(c)
+	if mErr != nil {
+		return
+	}
+	if err := s.rdb.Set(ctx, campaignPrefix+c.ID, data, retention).Err(); err != nil {
+		log.Printf("Failed to save campaign %s: %v", c.ID, err)
+	}
+	s.audit(ctx, c.ID, ev)
+	log.Printf("Campaign %s %s: %s", c.ID, c.Status, ev.Note)
+}
+
+// Get returns nil if the campaign does not exist.
+func (s *Store) Get(ctx context.Context, id string) (*Campaign, error) {
+	c, err := load(ctx, s.rdb, campaignPrefix+id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return c, err
+}
+
+// List returns the most recent campaigns first.
+func (s *Store) List(ctx context.Context, limit int64) ([]Campaign, error) {
+	ids, err := s.rdb.ZRevRange(ctx, indexKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	out := make([]Campaign, 0, len(ids))
+	for _, id := range ids {
+		c, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			// Expired; drop it from the index
+			s.rdb.ZRem(ctx, indexKey, id)
+			continue
+		}
+		out = append(out, *c)
+	}
+	return out, nil
+}
+
+func load(ctx context.Context, rdb redis.Cmdable, key string) (*Campaign, error) {
+	data, err := rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load campaign: %w", err)
+	}
+	var c Campaign
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal campaign: %w", err)
+	}
+	return &c, nil
+}
+
+func (s *Store) audit(ctx context.Context, id string, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	if err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStream,
+		MaxLen: eventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"campaign": id, "event": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to audit campaign %s: %v", id, err)
+	}
+}
@@ -0,0 +1,136 @@
+// Package corehttp provides the HTTP clients used to call cognitive-core.
+// They share one transport so connections are pooled across the router,
+// evaluator, gap tracker and intent classifier instead of each message
+// risking a fresh TCP and TLS handshake under load.
+//
+// HTTP/2 is negotiated over TLS (https:// core URLs). Plain http:// URLs use
+// HTTP/1.1 keep-alive, since the standard client does not speak cleartext
+// HTTP/2.
+package corehttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"orchestrator/metrics"
+)
+
+var (
+	connectionsTotal = metrics.NewCounterVec("orchestrator_core_connections_total",
+		"Connections obtained for cognitive-core requests, by whether a pooled connection was reused.", "reused")
+	tlsHandshakesTotal = metrics.NewCounterVec("orchestrator_core_tls_handshakes_total",
+		"TLS handshakes performed for cognitive-core requests.")
+	requestsTotal = metrics.NewCounterVec("orchestrator_core_requests_total",
+		"Cognitive-core responses by HTTP protocol version.", "proto")
+)
+
+type Options struct {
+	// MaxConnsPerHost caps connections to each core host; requests beyond it
+	// wait for a free connection. 0 means no limit.
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is how many idle connections are kept for reuse.
+	// Go's default of 2 is what causes new handshakes under concurrency.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	HTTP2               bool
+}
+
+// OptionsFromEnv reads CORE_MAX_CONNS_PER_HOST, CORE_MAX_IDLE_CONNS_PER_HOST,
+// CORE_IDLE_CONN_TIMEOUT and CORE_HTTP2.
+func OptionsFromEnv() (Options, error) {
+	o := defaults()
+	var err error
+	if v := os.Getenv("CORE_MAX_CONNS_PER_HOST"); v != "" {
+		if o.MaxConnsPerHost, err = strconv.Atoi(v); err != nil {
+			return o, fmt.Errorf("invalid CORE_MAX_CONNS_PER_HOST: %w", err)
+		}
+	}
+	if v := os.Getenv("CORE_MAX_IDLE_CONNS_PER_HOST"); v != "" {
+		if o.MaxIdleConnsPerHost, err = strconv.Atoi(v); err != nil {
+			return o, fmt.Errorf("invalid CORE_MAX_IDLE_CONNS_PER_HOST: %w", err)
+		}
+	}
+	if v := os.Getenv("CORE_IDLE_CONN_TIMEOUT"); v != "" {
+		if o.IdleConnTimeout, err = time.ParseDuration(v); err != nil {
+			return o, fmt.Errorf("invalid CORE_IDLE_CONN_TIMEOUT: %w", err)
+		}
+	}
+	if v := os.Getenv("CORE_HTTP2"); v != "" {
+		if o.HTTP2, err = strconv.ParseBool(v); err != nil {
+			return o, fmt.Errorf("invalid CORE_HTTP2: %w", err)
+		}
+	}
+	return o, nil
+}
+
+func defaults() Options {
+	return Options{MaxConnsPerHost: 128, MaxIdleConnsPerHost: 64, IdleConnTimeout: 90 * time.Second, HTTP2: true}
+}
+
+var (
+	mu     sync.Mutex
+	shared http.RoundTripper = newTransport(defaults())
+)
+
+// Configure replaces the shared transport. Call it before building any
+// clients; clients already built keep the transport they were given.
+func Configure(o Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	shared = newTransport(o)
+}
+
+// NewClient returns a client on the shared transport.
+func NewClient(timeout time.Duration) *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return &http.Client{Timeout: timeout, Transport: shared}
+}
+
+func newTransport(o Options) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     o.HTTP2,
+		MaxIdleConns:          max(o.MaxIdleConnsPerHost*4, 100),
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if !o.HTTP2 {
+		// A non-nil empty map disables HTTP/2 upgrades over TLS
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return instrumented{t}
+}
+
+// instrumented counts connection reuse and TLS handshakes per request.
+type instrumented struct {
+	next http.RoundTripper
+}
+
+func (t instrumented) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connectionsTotal.Inc(strconv.FormatBool(info.Reused))
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tlsHandshakesTotal.Inc()
+		},
+	}
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil {
+		requestsTotal.Inc(resp.Proto)
+	}
+	return resp, err
+}
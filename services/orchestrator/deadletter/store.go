@@ -0,0 +1,269 @@
+// Package deadletter keeps inbound messages the orchestrator gave up on,
+// such as poison messages that failed every delivery, so operators can
+// inspect them, fix them and send them through again.
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	Stream = "msg:deadletter"
+	// Re-driven messages go back on the router's inbound stream
+	inboundStream = "msg:inbound"
+	maxKept       = 10000
+)
+
+var (
+	deadTotal = metrics.NewCounterVec("orchestrator_dead_letters_total",
+		"Inbound messages moved to the dead-letter stream, by reason.", "reason")
+	redrivenTotal = metrics.NewCounterVec("orchestrator_dead_letters_redriven_total",
+		"Dead-lettered messages re-driven, by outcome (requeued, invalid, or checked on a dry run).", "outcome")
+)
+
+var ErrNotFound = errors.New("unknown dead letter")
+
+// Letter is one dead-lettered message. Envelope is the raw stream payload,
+// which need not be valid JSON; lists leave it out.
+type Letter struct {
+	ID         string    `json:"id"`
+	SourceID   string    `json:"source_id"`
+	Reason     string    `json:"reason"`
+	Deliveries int64     `json:"deliveries"`
+	DeadAt     time.Time `json:"dead_at"`
+	MessageID  string    `json:"message_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	Envelope   string    `json:"envelope,omitempty"`
+}
+
+// Transform is applied to an envelope before it is re-driven. Set replaces
+// fields by JSON path, e.g. "metadata.language", with a null value removing
+// the field; Flow routes the message to a named flow backend instead of the
+// default one.
+type Transform struct {
+	Set  map[string]json.RawMessage `json:"set,omitempty"`
+	Flow string                     `json:"flow,omitempty"`
+}
+
+// Result is what re-driving one letter did, or on a dry run would do.
+type Result struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id,omitempty"`
+	// RequeuedAs is the message's new ID on msg:inbound
+	RequeuedAs string `json:"requeued_as,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// Add dead-letters the envelope read from msg:inbound as sourceID.
+func (s *Store) Add(ctx context.Context, sourceID, envelope, reason string, deliveries int64) error {
+	if err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: Stream,
+		MaxLen: maxKept,
+		Approx: true,
+		Values: map[string]interface{}{
+			"envelope":   envelope,
+			"source_id":  sourceID,
+			"reason":     reason,
+			"deliveries": deliveries,
+			"dead_at":    time.Now().UTC().Format(time.RFC3339),
+		},
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to dead-letter message: %w", err)
+	}
+	deadTotal.Inc(reason)
+	return nil
+}
+
+// List returns up to count letters, newest first, without their envelopes.
+func (s *Store) List(ctx context.Context, count int64) ([]Letter, error) {
+	entries, err := s.rdb.XRevRangeN(ctx, Stream, "+", "-", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	out := make([]Letter, 0, len(entries))
+	for _, e := range entries {
+		l := letter(e)
+		l.Envelope = ""
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*Letter, error) {
+	entries, err := s.rdb.XRangeN(ctx, Stream, id, id, 1).Result()
+	if err != nil {
+		// An ID that isn't a stream ID can't name a letter
+		if strings.Contains(err.Error(), "Invalid stream ID") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load dead letter: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	l := letter(entries[0])
+	return &l, nil
+}
+
+// Redrive applies t to each letter's envelope and puts it back on
+// msg:inbound, removing it from the dead letters. A letter whose envelope
+// isn't valid after the transformation stays where it is. With dryRun
+// nothing is sent or removed; the results say what would happen.
+func (s *Store) Redrive(ctx context.Context, ids []string, t Transform, dryRun bool) ([]Result, error) {
+	results := make([]Result, 0, len(ids))
+	for _, id := range ids {
+		res := Result{ID: id}
+		l, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		res.MessageID = l.MessageID
+		envelope, err := t.Apply(l.Envelope)
+		if err != nil {
+			res.Error = err.Error()
+			redrivenTotal.Inc("invalid")
+			results = append(results, res)
+			continue
+		}
+		if dryRun {
+			redrivenTotal.Inc("dry_run")
+			results = append(results, res)
+			continue
+		}
+		newID, err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: inboundStream,
+			Values: map[string]interface{}{"envelope": envelope},
+		}).Result()
+		if err != nil {
+			return results, fmt.Errorf("failed to requeue %s: %w", id, err)
+		}
+		if err := s.rdb.XDel(ctx, Stream, id).Err(); err != nil {
+			return results, fmt.Errorf("failed to remove requeued %s: %w", id, err)
+		}
+		res.RequeuedAs = newID
+		redrivenTotal.Inc("requeued")
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// Apply returns the envelope with t's changes, after checking the result is
+// an envelope the router can process.
+func (t Transform) Apply(envelope string) (string, error) {
+	data := []byte(envelope)
+	if len(t.Set) > 0 || t.Flow != "" {
+		dec := json.NewDecoder(strings.NewReader(envelope))
+		// Numbers are kept as written
+		dec.UseNumber()
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return "", fmt.Errorf("envelope is not a JSON object: %w", err)
+		}
+		for path, raw := range t.Set {
+			var v interface{}
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			if err := dec.Decode(&v); err != nil {
+				return "", fmt.Errorf("invalid value for %s: %w", path, err)
+			}
+			if err := setPath(doc, path, v); err != nil {
+				return "", err
+			}
+		}
+		if t.Flow != "" {
+			doc["flow"] = t.Flow
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return "", fmt.Errorf("failed to marshal envelope: %w", err)
+		}
+	}
+	var e models.MessageEnvelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return "", fmt.Errorf("invalid envelope: %w", err)
+	}
+	switch {
+	case e.MessageID == "":
+		return "", errors.New("invalid envelope: message_id is required")
+	case e.SessionID == "":
+		return "", errors.New("invalid envelope: session_id is required")
+	case e.Channel == "":
+		return "", errors.New("invalid envelope: channel is required")
+	}
+	return string(data), nil
+}
+
+// setPath sets the dotted path in doc to v, creating objects on the way; a
+// nil v deletes the field.
+func setPath(doc map[string]interface{}, path string, v interface{}) error {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	for i, k := range keys[:len(keys)-1] {
+		next, ok := doc[k].(map[string]interface{})
+		if !ok {
+			if doc[k] != nil {
+				return fmt.Errorf("cannot set %s: %s is not an object", path, strings.Join(keys[:i+1], "."))
+			}
+			next = map[string]interface{}{}
+			doc[k] = next
+		}
+		doc = next
+	}
+	last := keys[len(keys)-1]
+	if v == nil {
+		delete(doc, last)
+	} else {
+		doc[last] = v
+	}
+	return nil
+}
+
+func letter(e redis.XMessage) Letter {
+	str := func(k string) string {
+		v, _ := e.Values[k].(string)
+		return v
+	}
+	l := Letter{ID: e.ID, SourceID: str("source_id"), Reason: str("reason"), Envelope: str("envelope")}
+	l.Deliveries, _ = strconv.ParseInt(str("deliveries"), 10, 64)
+	l.DeadAt, _ = time.Parse(time.RFC3339, str("dead_at"))
+	// What can be read of a broken envelope helps find the conversation
+	var head struct {
+		MessageID string `json:"message_id"`
+		SessionID string `json:"session_id"`
+		Channel   string `json:"channel"`
+	}
+	if json.Unmarshal([]byte(l.Envelope), &head) == nil {
+		l.MessageID, l.SessionID, l.Channel = head.MessageID, head.SessionID, head.Channel
+	}
+	return l
+}
@@ -0,0 +1,226 @@
+// Package degrade decides how much work the orchestrator does per message
+// when cognitive-core is failing or the inbound queue is backing up, so
+// overload degrades service in known steps instead of timing out at random.
+package degrade
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"orchestrator/metrics"
+)
+
+// Level is a rung of the ladder, from full service down.
+type Level int
+
+const (
+	// Full answers every message with cognitive-core.
+	Full Level = iota
+	// FAQOnly answers with pinned answers and a busy notice otherwise.
+	FAQOnly
+	// Static answers every message with the busy notice.
+	Static
+)
+
+func (l Level) String() string {
+	switch l {
+	case FAQOnly:
+		return "faq_only"
+	case Static:
+		return "static"
+	}
+	return "full"
+}
+
+// Message is the notice for messages that can't be answered at l.
+func (l Level) Message() string {
+	if l == Static {
+		return StaticMessage
+	}
+	return FAQOnlyMessage
+}
+
+// Thresholds for stepping down; main sets them from the environment.
+// Backend health is judged on the calls of the last Window, once there are
+// MinSamples of them. Lag is inbound messages no replica has read yet.
+var (
+	Window       = time.Minute
+	MinSamples   = 5
+	ErrorRate    = 0.5
+	SlowLatency  = 20 * time.Second
+	FAQLag       = int64(100)
+	StaticLag    = int64(500)
+	RecoverAfter = time.Minute
+	// ProbeInterval is how often a message is let through to cognitive-core
+	// while only pinned answers are served, to tell when it has recovered
+	ProbeInterval = 10 * time.Second
+)
+
+// The notices sent instead of a generated answer at each degraded level.
+var (
+	FAQOnlyMessage = "Maya is very busy right now and can only answer common questions. Please try again in a few minutes."
+	StaticMessage  = "Maya is very busy right now. Please try again in a few minutes."
+)
+
+const maxSamples = 1000
+
+var (
+	levelGauge = metrics.NewGaugeVec("orchestrator_degradation_level",
+		"Current degradation level: 0 full, 1 faq_only, 2 static.")
+	transitionsTotal = metrics.NewCounterVec("orchestrator_degradation_transitions_total",
+		"Changes of degradation level.", "from", "to")
+)
+
+type sample struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// Status is the current level and why it was entered.
+type Status struct {
+	Mode   string    `json:"mode"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Ladder moves down as soon as a threshold is crossed, and back up one
+// level at a time once conditions have been healthy for RecoverAfter.
+// Levels are per replica: each judges the backend by its own calls.
+type Ladder struct {
+	mu           sync.Mutex
+	level        Level
+	reason       string
+	since        time.Time
+	healthySince time.Time
+	samples      []sample
+	lag          int64
+	lastProbe    time.Time
+}
+
+func NewLadder() *Ladder {
+	levelGauge.Set(0)
+	return &Ladder{since: time.Now().UTC()}
+}
+
+// Observe records the outcome of a cognitive-core call. It is nil-safe.
+func (l *Ladder) Observe(latency time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples = append(l.samples, sample{at: time.Now(), latency: latency, failed: err != nil})
+	if len(l.samples) > maxSamples {
+		l.samples = l.samples[len(l.samples)-maxSamples:]
+	}
+	l.evaluate(time.Now())
+}
+
+// ObserveLag records the inbound queue lag.
+func (l *Ladder) ObserveLag(lag int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lag = lag
+	l.evaluate(time.Now())
+}
+
+// Level returns the level to serve a message at. While only pinned answers
+// are served, one message every ProbeInterval is still served in full.
+func (l *Ladder) Level() Level {
+	if l == nil {
+		return Full
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evaluate(now)
+	if l.level == FAQOnly && now.Sub(l.lastProbe) >= ProbeInterval {
+		l.lastProbe = now
+		return Full
+	}
+	return l.level
+}
+
+func (l *Ladder) Status() Status {
+	if l == nil {
+		return Status{Mode: Full.String()}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evaluate(time.Now())
+	return Status{Mode: l.level.String(), Reason: l.reason, Since: l.since}
+}
+
+// evaluate moves to the level current conditions call for. l.mu is held.
+func (l *Ladder) evaluate(now time.Time) {
+	cutoff := now.Add(-Window)
+	i := 0
+	for i < len(l.samples) && l.samples[i].at.Before(cutoff) {
+		i++
+	}
+	l.samples = l.samples[i:]
+
+	target, reason := Full, ""
+	if n := len(l.samples); n >= MinSamples {
+		var failed int
+		var total time.Duration
+		for _, s := range l.samples {
+			if s.failed {
+				failed++
+			}
+			total += s.latency
+		}
+		rate, avg := float64(failed)/float64(n), total/time.Duration(n)
+		if rate >= ErrorRate || avg >= SlowLatency {
+			target = FAQOnly
+			reason = fmt.Sprintf("cognitive-core unhealthy: %.0f%% errors, %s average over the last %d calls", rate*100, avg.Round(time.Millisecond), n)
+		}
+	}
+	if l.lag >= StaticLag {
+		target, reason = Static, fmt.Sprintf("inbound lag of %d messages", l.lag)
+	} else if l.lag >= FAQLag && target < FAQOnly {
+		target, reason = FAQOnly, fmt.Sprintf("inbound lag of %d messages", l.lag)
+	}
+
+	switch {
+	case target > l.level:
+		l.move(target, reason, now)
+	case target < l.level:
+		if l.healthySince.IsZero() {
+			l.healthySince = now
+		}
+		if now.Sub(l.healthySince) >= RecoverAfter {
+			if next := l.level - 1; next > target {
+				l.move(next, "recovering", now)
+			} else {
+				l.move(target, reason, now)
+			}
+		}
+	default:
+		l.healthySince = time.Time{}
+		if reason != "" {
+			l.reason = reason
+		}
+	}
+}
+
+func (l *Ladder) move(to Level, reason string, now time.Time) {
+	log.Printf("Degradation level %s -> %s: %s", l.level, to, orNone(reason))
+	transitionsTotal.Inc(l.level.String(), to.String())
+	levelGauge.Set(float64(to))
+	l.level, l.reason, l.since = to, reason, now.UTC()
+	l.healthySince = time.Time{}
+}
+
+func orNone(reason string) string {
+	if reason == "" {
+		return "conditions healthy"
+	}
+	return reason
+}
@@ -0,0 +1,85 @@
+package delivery
+
+import "strings"
+
+// Class groups outbound failures by what the operator can do about them.
+type Class string
+
+const (
+	ClassTransient        Class = "transient"
+	ClassRateLimited      Class = "rate_limited"
+	ClassNoRecipient      Class = "no_recipient"
+	ClassBlocked          Class = "blocked"
+	ClassWindowExpired    Class = "window_expired"
+	ClassInvalidRecipient Class = "invalid_recipient"
+	ClassRetriesExhausted Class = "retries_exhausted"
+)
+
+// Permanent reports whether retrying can never succeed.
+func (c Class) Permanent() bool {
+	switch c {
+	case ClassBlocked, ClassWindowExpired, ClassInvalidRecipient, ClassRetriesExhausted:
+		return true
+	}
+	return false
+}
+
+// Classify maps a provider error (HTTP status or platform error code plus
+// description) to a failure class. Unknown errors are treated as transient so
+// they are retried a bounded number of times.
+func Classify(platform string, code int, description string) Class {
+	desc := strings.ToLower(description)
+	switch platform {
+	case "telegram":
+		switch {
+		case code == 403 && (strings.Contains(desc, "blocked") || strings.Contains(desc, "deactivated")):
+			return ClassBlocked
+		case code == 400 && strings.Contains(desc, "chat not found"):
+			return ClassInvalidRecipient
+		case code == 429:
+			return ClassRateLimited
+		}
+	case "whatsapp":
+		switch code {
+		case 131047:
+			return ClassWindowExpired
+		case 131026, 131021:
+			return ClassInvalidRecipient
+		case 131031:
+			return ClassBlocked
+		case 130429, 131048, 131056:
+			return ClassRateLimited
+		}
+	case "viber":
+		switch code {
+		case 6, 7:
+			return ClassBlocked
+		case 5, 11:
+			return ClassInvalidRecipient
+		case 12:
+			return ClassRateLimited
+		}
+		if strings.Contains(desc, "not subscribed") {
+			return ClassBlocked
+		}
+	case "twilio":
+		switch code {
+		case 21610:
+			return ClassBlocked
+		case 21211, 21614, 30005, 30006:
+			return ClassInvalidRecipient
+		case 20429, 14107:
+			return ClassRateLimited
+		}
+	}
+
+	switch {
+	case code == 429:
+		return ClassRateLimited
+	case code == 403:
+		return ClassBlocked
+	case code == 404 || code == 410:
+		return ClassInvalidRecipient
+	}
+	return ClassTransient
+}
@@ -0,0 +1,198 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	responsePrefix = "response:"
+	queueSize      = 10000
+)
+
+// ErrQueueFull means a rate-limited channel has more queued messages than it
+// can drain; callers should retry later.
+var ErrQueueFull = errors.New("outbound queue is full")
+
+var (
+	sentTotal = metrics.NewCounterVec("orchestrator_outbound_sent_total",
+		"Outbound responses published by channel.", "channel")
+	droppedTotal = metrics.NewCounterVec("orchestrator_outbound_dropped_total",
+		"Outbound responses dropped because the channel queue was full.", "channel")
+	queueDepth = metrics.NewGaugeVec("orchestrator_outbound_queue_depth",
+		"Outbound responses waiting for a rate-limit slot.", "channel")
+)
+
+type outbound struct {
+	sessionID string
+	resp      models.WSResponse
+}
+
+type channelQueue struct {
+	name    string
+	limiter *limiter
+	items   chan outbound
+}
+
+// Publisher is the single outbound path for responses. Channels with a
+// configured rate are paced through a FIFO queue so bursts (broadcasts,
+// busy periods) stay under the platform's limits; other channels publish
+// immediately.
+type Publisher struct {
+	rdb    *redis.Client
+	queues map[string]*channelQueue
+}
+
+func NewPublisher(rdb *redis.Client, limits map[string]float64) *Publisher {
+	p := &Publisher{rdb: rdb, queues: make(map[string]*channelQueue)}
+	for name, rate := range limits {
+		p.queues[name] = &channelQueue{
+			name:    name,
+			limiter: newLimiter(rate, int(rate)),
+			items:   make(chan outbound, queueSize),
+		}
+	}
+	return p
+}
+
+// Run drains the paced queues and sends due retries until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) {
+	for _, q := range p.queues {
+		go p.drain(ctx, q)
+	}
+	go p.retryDue(ctx)
+}
+
+func (p *Publisher) drain(ctx context.Context, q *channelQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.items:
+			queueDepth.Set(float64(len(q.items)), q.name)
+			if err := q.limiter.wait(ctx); err != nil {
+				return
+			}
+			if _, err := p.publish(ctx, q.name, item.sessionID, item.resp); err != nil {
+				log.Printf("Failed to publish queued response: %v", err)
+			}
+		}
+	}
+}
+
+// Result describes what happened to a sent response.
+type Result struct {
+	Queued    bool
+	Delivered bool
+}
+
+// Send publishes resp to the session on the given channel, or queues it if
+// the channel is rate limited.
+func (p *Publisher) Send(ctx context.Context, channel, sessionID string, resp models.WSResponse) (Result, error) {
+	if q, ok := p.queues[channel]; ok {
+		select {
+		case q.items <- outbound{sessionID: sessionID, resp: resp}:
+			queueDepth.Set(float64(len(q.items)), channel)
+			return Result{Queued: true}, nil
+		default:
+			droppedTotal.Inc(channel)
+			return Result{}, fmt.Errorf("%w: %s", ErrQueueFull, channel)
+		}
+	}
+	delivered, err := p.publish(ctx, channel, sessionID, resp)
+	return Result{Delivered: delivered}, err
+}
+
+func (p *Publisher) publish(ctx context.Context, channel, sessionID string, resp models.WSResponse) (bool, error) {
+	// Only user-visible content is tracked; typing indicators are best effort
+	tracked := resp.Type == "message" || resp.Type == "notice" || resp.Type == "correction"
+	if tracked && resp.ID == "" {
+		resp.ID = uuid.New().String()
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	// The buffered copy goes first, so a client that subscribes meanwhile
+	// finds it when it replays
+	if heldChannels[channel] && replayed(resp) {
+		p.buffer(ctx, sessionID, &resp, data)
+		if data, err = json.Marshal(resp); err != nil {
+			return false, fmt.Errorf("failed to marshal response: %w", err)
+		}
+	}
+	if !tracked {
+		n, err := p.rdb.Publish(ctx, responsePrefix+sessionID, string(data)).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to publish response: %w", err)
+		}
+		return n > 0, nil
+	}
+	if heldChannels[channel] {
+		p.hold(ctx, sessionID, resp.ID, data)
+	}
+	return p.attempt(ctx, Status{ID: resp.ID, SessionID: sessionID, Channel: channel}, data)
+}
+
+func (p *Publisher) attempt(ctx context.Context, st Status, payload []byte) (bool, error) {
+	st.Attempts++
+	n, err := p.rdb.Publish(ctx, responsePrefix+st.SessionID, string(payload)).Result()
+	if err != nil {
+		p.fail(ctx, st, ClassTransient, err.Error(), payload)
+		return false, fmt.Errorf("failed to publish response: %w", err)
+	}
+	sentTotal.Inc(st.Channel)
+	if n == 0 && heldChannels[st.Channel] {
+		// Redelivered from the held responses once the client reconnects
+		st.State = StatePending
+		st.Reason = "no connected client for session"
+		p.setStatus(ctx, st, payload)
+		return false, nil
+	}
+	if n == 0 {
+		p.fail(ctx, st, ClassNoRecipient, "no connected client for session", payload)
+		return false, nil
+	}
+	st.State = StateSent
+	p.setStatus(ctx, st, payload)
+	return true, nil
+}
+
+// ActiveSessions lists sessions that currently have a subscribed client.
+func (p *Publisher) ActiveSessions(ctx context.Context) ([]string, error) {
+	channels, err := p.rdb.PubSubChannels(ctx, responsePrefix+"*").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active sessions: %w", err)
+	}
+	ids := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		ids = append(ids, ch[len(responsePrefix):])
+	}
+	return ids, nil
+}
+
+// Broadcast sends resp to each of the given sessions and returns how many
+// were delivered to a subscriber or queued for delivery.
+func (p *Publisher) Broadcast(ctx context.Context, channel string, sessionIDs []string, resp models.WSResponse) (int, error) {
+	sent := 0
+	for _, id := range sessionIDs {
+		resp.SessionID = id
+		res, err := p.Send(ctx, channel, id, resp)
+		if err != nil {
+			return sent, fmt.Errorf("failed to send to session %s: %w", id, err)
+		}
+		if res.Delivered || res.Queued {
+			sent++
+		}
+	}
+	return sent, nil
+}
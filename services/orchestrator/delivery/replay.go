@@ -0,0 +1,58 @@
+package delivery
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/models"
+)
+
+// Read by the channel adapter when a web client reconnects with a resume
+// token or a frame arrives ahead of an earlier one; keep the field layout in
+// sync.
+const (
+	replayPrefix = "web:replay:"
+	seqPrefix    = "web:seq:"
+	replayMaxLen = 200
+	seqTTL       = 24 * time.Hour
+)
+
+// ReplayWindow is how long a session's replay buffer outlives its latest
+// frame.
+var ReplayWindow = 15 * time.Minute
+
+// bufferScript numbers a frame and appends it to the replay stream in one
+// step, so sequence numbers and entry IDs are in the same order however
+// many publishers share the session.
+var bufferScript = redis.NewScript(`
+local seq = redis.call("INCR", KEYS[2])
+redis.call("EXPIRE", KEYS[2], ARGV[4])
+local id = redis.call("XADD", KEYS[1], "MAXLEN", "~", ARGV[2], "*", "frame", ARGV[1], "seq", seq)
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return {id, seq}
+`)
+
+// replayed reports whether a frame type is kept for replay. Typing
+// indicators and deltas are stale by the time a client is back, and the
+// finished answer is replayed anyway.
+func replayed(resp models.WSResponse) bool {
+	return resp.Type != "typing" && resp.Type != "delta"
+}
+
+// buffer appends resp to the session's replay stream and sets its resume
+// token to the entry ID, which orders replay, and its sequence number, which
+// lets clients spot a frame they missed. Frames that can't be buffered are
+// still sent, without either.
+func (p *Publisher) buffer(ctx context.Context, sessionID string, resp *models.WSResponse, data []byte) {
+	res, err := bufferScript.Run(ctx, p.rdb, []string{replayPrefix + sessionID, seqPrefix + sessionID},
+		string(data), replayMaxLen, int(ReplayWindow.Seconds()), int(seqTTL.Seconds())).Slice()
+	if err != nil || len(res) != 2 {
+		log.Printf("Failed to buffer response for session %s: %v", sessionID, err)
+		return
+	}
+	resp.ResumeToken, _ = res[0].(string)
+	resp.Seq, _ = res[1].(int64)
+}
@@ -0,0 +1,284 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+const (
+	statusPrefix   = "delivery:status:"
+	statusTTL      = 7 * 24 * time.Hour
+	failuresKey    = "delivery:failures"
+	failuresMax    = 1000
+	receiptsStream = "delivery:receipts"
+	receiptsGroup  = "orchestrator-receipts"
+	maxAttempts    = 4
+	retryBase      = 5 * time.Second
+	// Pending retries, scored by when they are due, so they survive a
+	// restart; their payload stays on the status hash
+	retriesKey = "delivery:retries"
+	retryPoll  = time.Second
+	retryBatch = 100
+)
+
+const (
+	StateSent      = "sent"
+	StateDelivered = "delivered"
+	StateRetrying  = "retrying"
+	StateFailed    = "failed"
+	// StatePending is a held response waiting for its client to reconnect
+	StatePending = "pending"
+)
+
+// ReadBlock is how long each receipts XREADGROUP waits for new receipts.
+var ReadBlock = 5 * time.Second
+
+// ConsumerName identifies this replica in the receipts consumer group; main
+// sets it to the replica's CONSUMER_NAME.
+var ConsumerName = "orchestrator-1"
+
+var failuresTotal = metrics.NewCounterVec("orchestrator_delivery_failures_total",
+	"Outbound delivery failures by channel and class.", "channel", "class")
+
+// Status is the delivery state of one outbound response.
+type Status struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Channel   string    `json:"channel"`
+	State     string    `json:"state"`
+	Class     Class     `json:"class,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Attempts  int       `json:"attempts"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Receipt is what channel adapters report on delivery:receipts after trying
+// to hand a response to the platform.
+type Receipt struct {
+	ID          string
+	Status      string
+	Platform    string
+	Code        int
+	Description string
+}
+
+func (p *Publisher) setStatus(ctx context.Context, st Status, payload []byte) {
+	st.UpdatedAt = time.Now().UTC()
+	key := statusPrefix + st.ID
+	fields := map[string]interface{}{
+		"session_id": st.SessionID,
+		"channel":    st.Channel,
+		"state":      st.State,
+		"class":      string(st.Class),
+		"reason":     st.Reason,
+		"attempts":   st.Attempts,
+		"updated_at": st.UpdatedAt.Format(time.RFC3339),
+	}
+	if payload != nil {
+		fields["payload"] = string(payload)
+	}
+	pipe := p.rdb.Pipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, statusTTL)
+	if st.State == StateFailed {
+		data, _ := json.Marshal(st)
+		pipe.LPush(ctx, failuresKey, data)
+		pipe.LTrim(ctx, failuresKey, 0, failuresMax-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record delivery status for %s: %v", st.ID, err)
+	}
+}
+
+// GetStatus returns the recorded delivery state of an outbound response.
+func (p *Publisher) GetStatus(ctx context.Context, id string) (*Status, error) {
+	vals, err := p.rdb.HGetAll(ctx, statusPrefix+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load delivery status: %w", err)
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	attempts, _ := strconv.Atoi(vals["attempts"])
+	updated, _ := time.Parse(time.RFC3339, vals["updated_at"])
+	return &Status{
+		ID:        id,
+		SessionID: vals["session_id"],
+		Channel:   vals["channel"],
+		State:     vals["state"],
+		Class:     Class(vals["class"]),
+		Reason:    vals["reason"],
+		Attempts:  attempts,
+		UpdatedAt: updated,
+	}, nil
+}
+
+// Failures lists the most recent permanent delivery failures for the
+// operator console.
+func (p *Publisher) Failures(ctx context.Context, limit int64) ([]Status, error) {
+	raw, err := p.rdb.LRange(ctx, failuresKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load delivery failures: %w", err)
+	}
+	out := make([]Status, 0, len(raw))
+	for _, r := range raw {
+		var st Status
+		if err := json.Unmarshal([]byte(r), &st); err == nil {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// fail records a failed attempt and schedules a retry for transient classes.
+// Permanent failures, and transient ones that exhaust their attempts, are
+// surfaced on the failures list instead of being retried forever.
+func (p *Publisher) fail(ctx context.Context, st Status, class Class, reason string, payload []byte) {
+	failuresTotal.Inc(st.Channel, string(class))
+	st.Class = class
+	st.Reason = reason
+	if !class.Permanent() && st.Attempts >= maxAttempts {
+		st.Class = ClassRetriesExhausted
+	}
+	if st.Class.Permanent() {
+		st.State = StateFailed
+		p.setStatus(ctx, st, nil)
+		log.Printf("Delivery %s to session %s failed permanently: %s (%s)", st.ID, st.SessionID, st.Class, reason)
+		return
+	}
+
+	st.State = StateRetrying
+	p.setStatus(ctx, st, payload)
+	due := time.Now().Add(retryBase * time.Duration(1<<(st.Attempts-1)))
+	err := p.rdb.ZAdd(context.WithoutCancel(ctx), retriesKey, redis.Z{Score: float64(due.UnixMilli()), Member: st.ID}).Err()
+	if err != nil {
+		log.Printf("Failed to schedule retry of delivery %s: %v", st.ID, err)
+	}
+}
+
+// retryDue polls delivery:retries and resends the responses that are due
+// until ctx is done. Each retry is claimed by removing it from the set, so
+// only one replica sends it.
+func (p *Publisher) retryDue(ctx context.Context) {
+	ticker := time.NewTicker(retryPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ids, err := p.rdb.ZRangeByScore(ctx, retriesKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Count: retryBatch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to load due delivery retries: %v", err)
+			}
+			continue
+		}
+		for _, id := range ids {
+			if claimed, err := p.rdb.ZRem(ctx, retriesKey, id).Result(); err != nil || claimed == 0 {
+				continue
+			}
+			p.retry(ctx, id)
+		}
+	}
+}
+
+func (p *Publisher) retry(ctx context.Context, id string) {
+	st, err := p.GetStatus(ctx, id)
+	if err != nil {
+		log.Printf("Failed to retry delivery %s: %v", id, err)
+		return
+	}
+	// Expired, or delivered after all since the retry was scheduled
+	if st == nil || st.State != StateRetrying {
+		return
+	}
+	payload, err := p.rdb.HGet(ctx, statusPrefix+id, "payload").Bytes()
+	if err != nil {
+		log.Printf("Failed to load payload of delivery %s: %v", id, err)
+		return
+	}
+	p.attempt(ctx, *st, payload)
+}
+
+// ConsumeReceipts applies adapter-reported delivery outcomes.
+func (p *Publisher) ConsumeReceipts(ctx context.Context) {
+	err := p.rdb.XGroupCreateMkStream(ctx, receiptsStream, receiptsGroup, "$").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		log.Printf("Failed to create receipts consumer group: %v", err)
+		return
+	}
+	for {
+		streams, err := p.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    receiptsGroup,
+			Consumer: ConsumerName,
+			Streams:  []string{receiptsStream, ">"},
+			Count:    50,
+			Block:    ReadBlock,
+		}).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error reading receipts: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				p.applyReceipt(ctx, parseReceipt(msg.Values))
+				p.rdb.XAck(ctx, receiptsStream, receiptsGroup, msg.ID)
+			}
+		}
+	}
+}
+
+func parseReceipt(v map[string]interface{}) Receipt {
+	str := func(k string) string {
+		s, _ := v[k].(string)
+		return s
+	}
+	code, _ := strconv.Atoi(str("code"))
+	return Receipt{
+		ID:          str("id"),
+		Status:      str("status"),
+		Platform:    str("platform"),
+		Code:        code,
+		Description: str("description"),
+	}
+}
+
+func (p *Publisher) applyReceipt(ctx context.Context, rc Receipt) {
+	if rc.ID == "" {
+		return
+	}
+	st, err := p.GetStatus(ctx, rc.ID)
+	if err != nil || st == nil {
+		return
+	}
+	if rc.Status == StateDelivered {
+		st.State = StateDelivered
+		st.Class = ""
+		st.Reason = ""
+		p.setStatus(ctx, *st, nil)
+		return
+	}
+	payload, _ := p.rdb.HGet(ctx, statusPrefix+rc.ID, "payload").Bytes()
+	p.fail(ctx, *st, Classify(rc.Platform, rc.Code, rc.Description), rc.Description, payload)
+}
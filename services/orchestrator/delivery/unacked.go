@@ -0,0 +1,42 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Read and cleared by the channel adapter; keep the field layout in sync.
+const (
+	unackedPrefix = "web:unacked:"
+	unackedTTL    = 24 * time.Hour
+)
+
+// heldChannels keep every tracked response until the client acknowledges
+// it, so one sent while the client was away is redelivered when it
+// reconnects instead of being retried into the void.
+var heldChannels = map[string]bool{"web": true}
+
+// unacked is a held response: its frame and when it was sent, which orders
+// redelivery.
+type unacked struct {
+	At    int64           `json:"at"`
+	Frame json.RawMessage `json:"frame"`
+}
+
+// hold stores payload until the session's client acknowledges id.
+func (p *Publisher) hold(ctx context.Context, sessionID, id string, payload []byte) {
+	data, err := json.Marshal(unacked{At: time.Now().UnixMilli(), Frame: payload})
+	if err != nil {
+		log.Printf("Failed to marshal held response %s: %v", id, err)
+		return
+	}
+	key := unackedPrefix + sessionID
+	pipe := p.rdb.Pipeline()
+	pipe.HSet(ctx, key, id, data)
+	pipe.Expire(ctx, key, unackedTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to hold response %s for session %s: %v", id, sessionID, err)
+	}
+}
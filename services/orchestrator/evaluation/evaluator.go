@@ -0,0 +1,349 @@
+package evaluation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/archive"
+	"orchestrator/corehttp"
+	"orchestrator/metrics"
+)
+
+const (
+	resultsStream = "eval:results"
+	alertsStream  = "ops:alerts"
+	queueSize     = 256
+	judgeTimeout  = 60 * time.Second
+	alertCooldown = 30 * time.Minute
+)
+
+var (
+	evaluatedTotal = metrics.NewCounterVec("orchestrator_evaluations_total",
+		"Responses scored by the quality evaluator.", "outcome")
+	rollingScore = metrics.NewGaugeVec("orchestrator_quality_score",
+		"Rolling average overall quality score (0-1).")
+)
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://[^\s)\]>"']+`)
+	refusalPhrases = []string{
+		"i don't know",
+		"i do not know",
+		"i'm not sure",
+		"i cannot help",
+		"i can't help",
+		"i am unable",
+		"i'm unable",
+		"outside my scope",
+	}
+)
+
+// Sample is a delivered response queued for evaluation.
+type Sample struct {
+	MessageID string
+	SessionID string
+	TenantID  string
+	Question  string
+	Answer    string
+	Sources   []string
+	// Reported is the reason a user gave for reporting the answer, if any.
+	Reported string
+}
+
+// Score is a full evaluation, as published on eval:results. Its summary is
+// stored on the answer's archived turn.
+type Score struct {
+	MessageID      string    `json:"message_id"`
+	SessionID      string    `json:"session_id"`
+	Length         int       `json:"length"`
+	LengthOK       bool      `json:"length_ok"`
+	Refusal        bool      `json:"refusal"`
+	UnverifiedURLs []string  `json:"unverified_urls,omitempty"`
+	JudgeScore     *float64  `json:"judge_score,omitempty"`
+	JudgeReasoning string    `json:"judge_reasoning,omitempty"`
+	JudgeError     string    `json:"judge_error,omitempty"`
+	Overall        float64   `json:"overall"`
+	Reported       string    `json:"reported,omitempty"`
+	EvaluatedAt    time.Time `json:"evaluated_at"`
+}
+
+// Evaluator scores a random sample of responses off the hot path using
+// heuristics plus an LLM-as-judge call, and raises an alert when the rolling
+// average drops below a threshold.
+type Evaluator struct {
+	rdb        *redis.Client
+	archive    *archive.Store
+	judgeURL   string
+	httpClient *http.Client
+	sampleRate float64
+	threshold  float64
+	queue      chan Sample
+	onScored   func(context.Context, Sample, Score)
+
+	mu        sync.Mutex
+	window    []float64
+	windowPos int
+	lastAlert time.Time
+}
+
+func NewEvaluator(rdb *redis.Client, archiveStore *archive.Store, judgeURL string, sampleRate, threshold float64, window int) *Evaluator {
+	return &Evaluator{
+		rdb:        rdb,
+		archive:    archiveStore,
+		judgeURL:   judgeURL,
+		httpClient: corehttp.NewClient(judgeTimeout),
+		sampleRate: sampleRate,
+		threshold:  threshold,
+		queue:      make(chan Sample, queueSize),
+		window:     make([]float64, 0, window),
+	}
+}
+
+// Submit queues s for evaluation if it is sampled. It never blocks.
+func (e *Evaluator) Submit(s Sample) {
+	if e == nil || rand.Float64() >= e.sampleRate {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+		evaluatedTotal.Inc("dropped")
+	}
+}
+
+// Review queues s for evaluation whatever the sample rate, e.g. because a
+// user reported it. It never blocks.
+func (e *Evaluator) Review(s Sample) {
+	select {
+	case e.queue <- s:
+	default:
+		evaluatedTotal.Inc("dropped")
+	}
+}
+
+// OnScored registers fn to receive every score after it is stored.
+func (e *Evaluator) OnScored(fn func(context.Context, Sample, Score)) {
+	e.onScored = fn
+}
+
+func (e *Evaluator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-e.queue:
+			score := e.evaluate(ctx, s)
+			if err := e.store(ctx, score); err != nil {
+				log.Printf("Failed to store evaluation for %s: %v", s.MessageID, err)
+			}
+			e.track(ctx, score.Overall)
+			if e.onScored != nil {
+				e.onScored(ctx, s, score)
+			}
+		}
+	}
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, s Sample) Score {
+	score := Heuristics(s.Answer, s.Sources)
+	score.MessageID = s.MessageID
+	score.SessionID = s.SessionID
+	score.Reported = s.Reported
+	score.EvaluatedAt = time.Now().UTC()
+
+	overall := 1.0
+	if !score.LengthOK {
+		overall -= 0.2
+	}
+	if score.Refusal {
+		overall -= 0.3
+	}
+	if len(score.UnverifiedURLs) > 0 {
+		overall -= 0.3
+	}
+
+	judged, reasoning, err := e.judge(ctx, s)
+	if err != nil {
+		score.JudgeError = err.Error()
+		evaluatedTotal.Inc("heuristic_only")
+	} else {
+		score.JudgeScore = &judged
+		score.JudgeReasoning = reasoning
+		overall = (overall + judged) / 2
+		evaluatedTotal.Inc("judged")
+	}
+	if overall < 0 {
+		overall = 0
+	}
+	score.Overall = overall
+	return score
+}
+
+// Heuristics applies the cheap, deterministic checks.
+func Heuristics(answer string, sources []string) Score {
+	n := len([]rune(answer))
+	lower := strings.ToLower(answer)
+	refusal := false
+	for _, p := range refusalPhrases {
+		if strings.Contains(lower, p) {
+			refusal = true
+			break
+		}
+	}
+
+	var unverified []string
+	for _, u := range urlPattern.FindAllString(answer, -1) {
+		found := false
+		for _, src := range sources {
+			if strings.Contains(src, u) || strings.Contains(u, src) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unverified = append(unverified, u)
+		}
+	}
+
+	return Score{
+		Length:         n,
+		LengthOK:       n >= 20 && n <= 2000,
+		Refusal:        refusal,
+		UnverifiedURLs: unverified,
+	}
+}
+
+type judgeRequest struct {
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Sources  []string `json:"sources"`
+}
+
+type judgeResponse struct {
+	Score     float64 `json:"score"`
+	Reasoning string  `json:"reasoning"`
+}
+
+func (e *Evaluator) judge(ctx context.Context, s Sample) (float64, string, error) {
+	body, err := json.Marshal(judgeRequest{Question: s.Question, Answer: s.Answer, Sources: s.Sources})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to marshal judge request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.judgeURL+"/evaluate", bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create judge request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("judge request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read judge response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("judge returned %d: %s", resp.StatusCode, string(data))
+	}
+	var jr judgeResponse
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return 0, "", fmt.Errorf("failed to unmarshal judge response: %w", err)
+	}
+	return jr.Score, jr.Reasoning, nil
+}
+
+func (e *Evaluator) store(ctx context.Context, score Score) error {
+	data, err := json.Marshal(score)
+	if err != nil {
+		return fmt.Errorf("failed to marshal score: %w", err)
+	}
+	err = e.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: resultsStream,
+		MaxLen: 100000,
+		Approx: true,
+		Values: map[string]interface{}{"score": string(data)},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish score: %w", err)
+	}
+	return e.archive.SetEvaluation(ctx, score.SessionID, score.MessageID, archive.Evaluation{
+		Overall:     score.Overall,
+		JudgeScore:  score.JudgeScore,
+		Refusal:     score.Refusal,
+		Reported:    score.Reported,
+		EvaluatedAt: score.EvaluatedAt,
+	})
+}
+
+// Load returns the evaluation archived with a session's answer, or nil if it
+// was not sampled.
+func (e *Evaluator) Load(ctx context.Context, sessionID, messageID string) (*archive.Evaluation, error) {
+	return e.archive.LoadEvaluation(ctx, sessionID, messageID)
+}
+
+// RollingAverage returns the average overall score over the current window.
+func (e *Evaluator) RollingAverage() (float64, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return average(e.window), len(e.window)
+}
+
+func (e *Evaluator) track(ctx context.Context, overall float64) {
+	e.mu.Lock()
+	if len(e.window) < cap(e.window) {
+		e.window = append(e.window, overall)
+	} else {
+		e.window[e.windowPos] = overall
+		e.windowPos = (e.windowPos + 1) % len(e.window)
+	}
+	avg := average(e.window)
+	full := len(e.window) == cap(e.window)
+	alert := full && avg < e.threshold && time.Since(e.lastAlert) > alertCooldown
+	if alert {
+		e.lastAlert = time.Now()
+	}
+	e.mu.Unlock()
+
+	rollingScore.Set(avg)
+	if !alert {
+		return
+	}
+	log.Printf("ALERT: rolling quality score %.2f below threshold %.2f", avg, e.threshold)
+	if err := e.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: alertsStream,
+		MaxLen: 10000,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":      "quality_regression",
+			"score":     fmt.Sprintf("%.3f", avg),
+			"threshold": fmt.Sprintf("%.3f", e.threshold),
+		},
+	}).Err(); err != nil {
+		log.Printf("Failed to publish quality alert: %v", err)
+	}
+}
+
+func average(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
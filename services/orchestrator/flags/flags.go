@@ -0,0 +1,194 @@
+// Package flags resolves feature flags and experiment variants once per
+// message, when the orchestrator takes it off the stream. The result is
+// stamped on the envelope, archived with the user's turn and sent to
+// cognitive-core, so every stage handling the message sees the same values,
+// even while replicas run different FEATURE_FLAGS files during a rollout.
+// A session keeps the variant it was first assigned for as long as the
+// session lives, so an experiment's arms don't mix within a conversation.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	assignedPrefix = "flags:assigned:"
+	// Matches the session manager's session TTL
+	assignedTTL = 24 * time.Hour
+)
+
+var assignmentsTotal = metrics.NewCounterVec("orchestrator_experiment_assignments_total",
+	"Sessions assigned to an experiment variant, by experiment and variant.", "experiment", "variant")
+
+// Flag is a feature switch. An enabled flag is on for Percent of sessions,
+// or all of them when Percent is 0, limited to Tenants and Channels when
+// set.
+type Flag struct {
+	Enabled  bool     `json:"enabled"`
+	Percent  int      `json:"percent,omitempty"`
+	Tenants  []string `json:"tenants,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// Experiment splits sessions between variants in proportion to their
+// weights. Sessions outside Tenants or Channels, when set, are not enrolled.
+type Experiment struct {
+	Variants map[string]int `json:"variants"`
+	Tenants  []string       `json:"tenants,omitempty"`
+	Channels []string       `json:"channels,omitempty"`
+}
+
+// Config is the FEATURE_FLAGS file.
+type Config struct {
+	Flags       map[string]Flag       `json:"flags"`
+	Experiments map[string]Experiment `json:"experiments"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature flags: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse feature flags: %w", err)
+	}
+	return &cfg, nil
+}
+
+type variant struct {
+	name   string
+	weight int
+}
+
+type experiment struct {
+	Experiment
+	variants []variant
+	total    int
+}
+
+type Resolver struct {
+	rdb         *redis.Client
+	flags       map[string]Flag
+	experiments map[string]experiment
+}
+
+func NewResolver(rdb *redis.Client, cfg Config) (*Resolver, error) {
+	r := &Resolver{rdb: rdb, flags: cfg.Flags, experiments: map[string]experiment{}}
+	for name, f := range cfg.Flags {
+		if f.Percent < 0 || f.Percent > 100 {
+			return nil, fmt.Errorf("flag %s: percent must be between 0 and 100", name)
+		}
+	}
+	for name, e := range cfg.Experiments {
+		x := experiment{Experiment: e}
+		for v, w := range e.Variants {
+			if w < 0 {
+				return nil, fmt.Errorf("experiment %s: variant %s has a negative weight", name, v)
+			}
+			x.variants = append(x.variants, variant{v, w})
+			x.total += w
+		}
+		if x.total == 0 {
+			return nil, fmt.Errorf("experiment %s: needs a variant with a positive weight", name)
+		}
+		// Map order is random; buckets must not move between replicas
+		sort.Slice(x.variants, func(i, j int) bool { return x.variants[i].name < x.variants[j].name })
+		r.experiments[name] = x
+	}
+	return r, nil
+}
+
+// Resolve returns the flags and variants that apply to the message. Flags
+// are evaluated afresh, so turning one off takes effect on the next message;
+// variants already assigned to the session are kept.
+func (r *Resolver) Resolve(ctx context.Context, envelope *models.MessageEnvelope) (*models.Features, error) {
+	f := &models.Features{ResolvedAt: time.Now().UTC()}
+	for name, flag := range r.flags {
+		if !flag.Enabled || !applies(flag.Tenants, flag.Channels, envelope) {
+			continue
+		}
+		if flag.Percent == 0 || bucket("flag:"+name+":"+envelope.SessionID, 100) < flag.Percent {
+			if f.Flags == nil {
+				f.Flags = map[string]bool{}
+			}
+			f.Flags[name] = true
+		}
+	}
+	if len(r.experiments) == 0 {
+		return f, nil
+	}
+
+	key := assignedPrefix + envelope.SessionID
+	assigned, err := r.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return f, fmt.Errorf("failed to load experiment assignments: %w", err)
+	}
+	fresh := map[string]interface{}{}
+	for name, x := range r.experiments {
+		if !applies(x.Tenants, x.Channels, envelope) {
+			continue
+		}
+		v, ok := assigned[name]
+		if _, known := x.Variants[v]; !ok || !known {
+			v = x.pick(name, envelope.SessionID)
+			fresh[name] = v
+		}
+		if f.Experiments == nil {
+			f.Experiments = map[string]string{}
+		}
+		f.Experiments[name] = v
+	}
+	if len(fresh) > 0 {
+		// Replicas racing on a session's first message compute the same
+		// buckets, so whichever write lands is right
+		pipe := r.rdb.TxPipeline()
+		pipe.HSet(ctx, key, fresh)
+		pipe.Expire(ctx, key, assignedTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return f, fmt.Errorf("failed to store experiment assignments: %w", err)
+		}
+		for name, v := range fresh {
+			assignmentsTotal.Inc(name, v.(string))
+		}
+	}
+	return f, nil
+}
+
+// pick places the session in a variant by hashing it, so a session gets the
+// same variant on every replica.
+func (x experiment) pick(name, sessionID string) string {
+	n := bucket("experiment:"+name+":"+sessionID, x.total)
+	for _, v := range x.variants {
+		if n < v.weight {
+			return v.name
+		}
+		n -= v.weight
+	}
+	return x.variants[len(x.variants)-1].name
+}
+
+func bucket(s string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % uint32(n))
+}
+
+func applies(tenants, channels []string, envelope *models.MessageEnvelope) bool {
+	if len(tenants) > 0 && !slices.Contains(tenants, envelope.TenantID) {
+		return false
+	}
+	return len(channels) == 0 || slices.Contains(channels, envelope.Channel)
+}
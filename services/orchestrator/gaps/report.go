@@ -0,0 +1,353 @@
+package gaps
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Questions at least this similar to a topic's centroid join the topic
+	similarityThreshold = 0.82
+	maxReportEvents     = 5000
+	embedBatch          = 100
+	embeddingPrefix     = "gaps:embedding:"
+	// As long as the longest report, so precomputed vectors are still there
+	embeddingTTL     = 90 * 24 * time.Hour
+	examplesPerTopic = 5
+	// EmbedNew's progress through gaps:events, and the lock that lets one
+	// replica embed each minute
+	embedCursorKey = "gaps:embedded"
+	embedLockKey   = "gaps:embed:lock"
+	embedEvery     = time.Minute
+)
+
+// Topic is a cluster of similar unanswered questions.
+type Topic struct {
+	Question  string         `json:"question"`
+	Count     int            `json:"count"`
+	Sessions  int            `json:"sessions"`
+	Reasons   map[string]int `json:"reasons"`
+	Examples  []string       `json:"examples"`
+	FirstSeen time.Time      `json:"first_seen"`
+	LastSeen  time.Time      `json:"last_seen"`
+}
+
+type Report struct {
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	Total  int       `json:"total"`
+	Topics []Topic   `json:"topics"`
+}
+
+// question is one asked question after merging every gap recorded for it.
+type question struct {
+	messageID string
+	sessionID string
+	text      string
+	reasons   map[string]bool
+	at        time.Time
+}
+
+type cluster struct {
+	centroid []float64
+	members  []int
+	vectors  [][]float64
+}
+
+// Report clusters the questions recorded since the given time and returns
+// the largest topics first. An empty tenant includes every tenant. Vectors
+// come from EmbedNew's cache; only questions it has not reached yet are
+// embedded here.
+func (t *Tracker) Report(ctx context.Context, since time.Time, tenant string, limit int) (*Report, error) {
+	now := time.Now().UTC()
+	msgs, err := t.rdb.XRevRangeN(ctx, eventsStream, "+", strconv.FormatInt(since.UnixMilli(), 10), maxReportEvents).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read knowledge gaps: %w", err)
+	}
+
+	questions := mergeEvents(msgs, tenant)
+	report := &Report{Since: since, Until: now, Total: len(questions), Topics: []Topic{}}
+	if len(questions) == 0 {
+		return report, nil
+	}
+	texts := make([]string, len(questions))
+	for i, q := range questions {
+		texts[i] = q.text
+	}
+	vectors, err := t.embeddings(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range clusterVectors(vectors) {
+		report.Topics = append(report.Topics, topicFor(c, questions))
+	}
+	sort.Slice(report.Topics, func(i, j int) bool {
+		if report.Topics[i].Count != report.Topics[j].Count {
+			return report.Topics[i].Count > report.Topics[j].Count
+		}
+		return report.Topics[i].LastSeen.After(report.Topics[j].LastSeen)
+	})
+	if limit > 0 && len(report.Topics) > limit {
+		report.Topics = report.Topics[:limit]
+	}
+	return report, nil
+}
+
+func mergeEvents(msgs []redis.XMessage, tenant string) []*question {
+	byID := make(map[string]*question)
+	var out []*question
+	for _, m := range msgs {
+		str := func(k string) string {
+			s, _ := m.Values[k].(string)
+			return s
+		}
+		if tenant != "" && str("tenant_id") != tenant {
+			continue
+		}
+		id := str("message_id")
+		q, ok := byID[id]
+		if !ok || id == "" {
+			at, _ := time.Parse(time.RFC3339, str("at"))
+			q = &question{messageID: id, sessionID: str("session_id"), text: str("question"), reasons: map[string]bool{}, at: at}
+			byID[id] = q
+			out = append(out, q)
+		}
+		q.reasons[str("reason")] = true
+	}
+	return out
+}
+
+// clusterVectors greedily assigns each vector to the most similar existing
+// cluster, or starts a new one. It is order dependent but cheap, which is
+// enough for a weekly report of a few thousand questions.
+func clusterVectors(vectors [][]float64) []*cluster {
+	var clusters []*cluster
+	for i, v := range vectors {
+		var best *cluster
+		bestSim := similarityThreshold
+		for _, c := range clusters {
+			if sim := cosine(v, c.centroid); sim >= bestSim {
+				best, bestSim = c, sim
+			}
+		}
+		if best == nil {
+			best = &cluster{centroid: make([]float64, len(v))}
+			clusters = append(clusters, best)
+		}
+		best.members = append(best.members, i)
+		best.vectors = append(best.vectors, v)
+		n := float64(len(best.members))
+		for d := range best.centroid {
+			best.centroid[d] += (v[d] - best.centroid[d]) / n
+		}
+	}
+	return clusters
+}
+
+func topicFor(c *cluster, questions []*question) Topic {
+	topic := Topic{Count: len(c.members), Reasons: map[string]int{}}
+	sessions := map[string]bool{}
+	seen := map[string]bool{}
+	bestSim := -1.0
+	for k, i := range c.members {
+		q := questions[i]
+		sessions[q.sessionID] = true
+		for r := range q.reasons {
+			topic.Reasons[r]++
+		}
+		// The question closest to the centroid names the topic
+		if sim := cosine(c.vectors[k], c.centroid); sim > bestSim {
+			topic.Question, bestSim = q.text, sim
+		}
+		key := strings.ToLower(strings.TrimSpace(q.text))
+		if !seen[key] && len(topic.Examples) < examplesPerTopic {
+			seen[key] = true
+			topic.Examples = append(topic.Examples, q.text)
+		}
+		if topic.FirstSeen.IsZero() || q.at.Before(topic.FirstSeen) {
+			topic.FirstSeen = q.at
+		}
+		if q.at.After(topic.LastSeen) {
+			topic.LastSeen = q.at
+		}
+	}
+	topic.Sessions = len(sessions)
+	return topic
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// EmbedNew embeds the questions of newly recorded gaps every minute until
+// ctx is done, so a report finds their vectors cached instead of embedding
+// thousands of questions inside the admin request.
+func (t *Tracker) EmbedNew(ctx context.Context) {
+	ticker := time.NewTicker(embedEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := t.embedNew(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to embed knowledge gaps: %v", err)
+		}
+	}
+}
+
+// embedNew embeds up to maxReportEvents questions past the cursor.
+func (t *Tracker) embedNew(ctx context.Context) error {
+	locked, err := t.rdb.SetNX(ctx, embedLockKey, ConsumerName, embedEvery).Result()
+	if err != nil {
+		return fmt.Errorf("failed to take embed lock: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+
+	start := "-"
+	cursor, err := t.rdb.Get(ctx, embedCursorKey).Result()
+	switch {
+	case err == nil:
+		start = "(" + cursor
+	case err != redis.Nil:
+		return fmt.Errorf("failed to load embed cursor: %w", err)
+	}
+	for done := 0; done < maxReportEvents; done += embedBatch {
+		msgs, err := t.rdb.XRangeN(ctx, eventsStream, start, "+", embedBatch).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read knowledge gaps: %w", err)
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		var texts []string
+		for _, m := range msgs {
+			if q, _ := m.Values["question"].(string); q != "" {
+				texts = append(texts, q)
+			}
+		}
+		if len(texts) > 0 {
+			if _, err := t.embeddings(ctx, texts); err != nil {
+				return err
+			}
+		}
+		cursor = msgs[len(msgs)-1].ID
+		if err := t.rdb.Set(ctx, embedCursorKey, cursor, 0).Err(); err != nil {
+			return fmt.Errorf("failed to save embed cursor: %w", err)
+		}
+		start = "(" + cursor
+	}
+	return nil
+}
+
+// embeddings returns a vector per text, reusing cached vectors so repeated
+// reports only embed new questions.
+func (t *Tracker) embeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(text))))
+		keys[i] = embeddingPrefix + hex.EncodeToString(sum[:])
+	}
+	cached, err := t.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cached embeddings: %w", err)
+	}
+
+	out := make([][]float64, len(texts))
+	var missing []int
+	for i, c := range cached {
+		if s, ok := c.(string); ok && json.Unmarshal([]byte(s), &out[i]) == nil {
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	for start := 0; start < len(missing); start += embedBatch {
+		batch := missing[start:min(start+embedBatch, len(missing))]
+		batchTexts := make([]string, len(batch))
+		for k, i := range batch {
+			batchTexts[k] = texts[i]
+		}
+		vectors, err := t.embed(ctx, batchTexts)
+		if err != nil {
+			return nil, err
+		}
+		pipe := t.rdb.Pipeline()
+		for k, i := range batch {
+			out[i] = vectors[k]
+			data, _ := json.Marshal(vectors[k])
+			pipe.Set(ctx, keys[i], data, embeddingTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to cache embeddings: %w", err)
+		}
+	}
+	return out, nil
+}
+
+type embedRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type embedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func (t *Tracker) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(embedRequest{Texts: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embed request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.embedURL+"/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embed request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embed request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("embed returned %d: %s", resp.StatusCode, string(data))
+	}
+	var er embedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal embed response: %w", err)
+	}
+	if len(er.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embed returned %d vectors for %d texts", len(er.Embeddings), len(texts))
+	}
+	return er.Embeddings, nil
+}
@@ -0,0 +1,188 @@
+// Package gaps tracks questions the genie failed to answer well and groups
+// them into topics, so content teams know what to add to the knowledge base.
+package gaps
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/anonymize"
+	"orchestrator/archive"
+	"orchestrator/corehttp"
+	"orchestrator/evaluation"
+	"orchestrator/metrics"
+)
+
+const (
+	eventsStream   = "gaps:events"
+	eventsMaxLen   = 100000
+	feedbackStream = "msg:feedback"
+	feedbackGroup  = "orchestrator-feedback"
+)
+
+// ConsumerName identifies this replica in the feedback consumer group; main
+// sets it to the replica's CONSUMER_NAME.
+var ConsumerName = "orchestrator-1"
+
+// Reasons a question is counted as unanswered.
+const (
+	ReasonRefusal   = "refusal"
+	ReasonNoSources = "no_sources"
+	ReasonLowScore  = "low_score"
+	ReasonNegative  = "negative_feedback"
+)
+
+var gapsTotal = metrics.NewCounterVec("orchestrator_knowledge_gaps_total",
+	"Questions recorded as knowledge gaps, by reason.", "reason")
+
+// Gap is one question that was not answered well. Questions are PII-scrubbed
+// before they are stored.
+type Gap struct {
+	MessageID string
+	SessionID string
+	TenantID  string
+	Question  string
+	Reason    string
+	At        time.Time
+}
+
+type Tracker struct {
+	rdb        *redis.Client
+	archive    *archive.Store
+	embedURL   string
+	httpClient *http.Client
+}
+
+// NewTracker records gaps in Redis. embedURL is the cognitive-core base URL
+// whose /embed endpoint is used to cluster questions for reports.
+func NewTracker(rdb *redis.Client, archiveStore *archive.Store, embedURL string) *Tracker {
+	return &Tracker{
+		rdb:        rdb,
+		archive:    archiveStore,
+		embedURL:   embedURL,
+		httpClient: corehttp.NewClient(60 * time.Second),
+	}
+}
+
+// Record stores g. It is nil-safe so callers need not check whether gap
+// tracking is enabled.
+func (t *Tracker) Record(ctx context.Context, g Gap) {
+	if t == nil || strings.TrimSpace(g.Question) == "" {
+		return
+	}
+	if g.At.IsZero() {
+		g.At = time.Now().UTC()
+	}
+	err := t.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStream,
+		MaxLen: eventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"message_id": g.MessageID,
+			"session_id": g.SessionID,
+			"tenant_id":  g.TenantID,
+			"question":   anonymize.ScrubPII(g.Question),
+			"reason":     g.Reason,
+			"at":         g.At.Format(time.RFC3339),
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("Failed to record knowledge gap for %s: %v", g.MessageID, err)
+		return
+	}
+	gapsTotal.Inc(g.Reason)
+}
+
+// Observe checks a delivered answer for signs the genie did not know: an
+// "I don't know" style reply, or one with no supporting sources.
+func (t *Tracker) Observe(ctx context.Context, g Gap, answer string, sources []string) {
+	if t == nil {
+		return
+	}
+	switch {
+	case evaluation.Heuristics(answer, sources).Refusal:
+		g.Reason = ReasonRefusal
+	case len(sources) == 0:
+		g.Reason = ReasonNoSources
+	default:
+		return
+	}
+	t.Record(ctx, g)
+}
+
+// ObserveScore records answers the evaluator scored below threshold. It is
+// registered with Evaluator.OnScored.
+func (t *Tracker) ObserveScore(threshold float64) func(context.Context, evaluation.Sample, evaluation.Score) {
+	return func(ctx context.Context, s evaluation.Sample, score evaluation.Score) {
+		if score.Overall >= threshold {
+			return
+		}
+		t.Record(ctx, Gap{MessageID: s.MessageID, SessionID: s.SessionID, TenantID: s.TenantID, Question: s.Question, Reason: ReasonLowScore})
+	}
+}
+
+// ConsumeFeedback records thumbs-down ratings from the web widget, published
+// by the channel adapter on msg:feedback.
+func (t *Tracker) ConsumeFeedback(ctx context.Context) {
+	err := t.rdb.XGroupCreateMkStream(ctx, feedbackStream, feedbackGroup, "$").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		log.Printf("Failed to create feedback consumer group: %v", err)
+		return
+	}
+	for ctx.Err() == nil {
+		streams, err := t.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    feedbackGroup,
+			Consumer: ConsumerName,
+			Streams:  []string{feedbackStream, ">"},
+			Count:    50,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				log.Printf("Error reading feedback: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if err := t.handleFeedback(ctx, msg.Values); err != nil {
+					log.Printf("Failed to handle feedback %s: %v", msg.ID, err)
+				}
+				t.rdb.XAck(ctx, feedbackStream, feedbackGroup, msg.ID)
+			}
+		}
+	}
+}
+
+func (t *Tracker) handleFeedback(ctx context.Context, values map[string]interface{}) error {
+	rating, _ := values["rating"].(string)
+	if rating != "down" {
+		return nil
+	}
+	sessionID, _ := values["session_id"].(string)
+	messageID, _ := values["message_id"].(string)
+	tenantID, _ := values["tenant_id"].(string)
+	// Later parts of a split answer carry a ".N" suffix
+	if i := strings.LastIndex(messageID, "."); i > 0 {
+		messageID = messageID[:i]
+	}
+	turns, err := t.archive.Load(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to load transcript: %w", err)
+	}
+	// The rated answer shares its message ID with the question it answered
+	for _, turn := range turns {
+		if turn.MessageID == messageID && turn.Role == "user" {
+			t.Record(ctx, Gap{MessageID: messageID, SessionID: sessionID, TenantID: tenantID, Question: turn.Content, Reason: ReasonNegative})
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package intent labels inbound messages with an intent from a configurable
+// taxonomy and keeps hourly counts for trend reports.
+package intent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/corehttp"
+	"orchestrator/metrics"
+)
+
+const (
+	// Other is recorded when the classifier fails or answers outside the
+	// taxonomy
+	Other           = "other"
+	countsPrefix    = "intents:"
+	allTenants      = "_all"
+	countsTTL       = 90 * 24 * time.Hour
+	classifyTimeout = 5 * time.Second
+	maxClassifyText = 1000
+)
+
+// DefaultLabels is the taxonomy used when none is configured.
+var DefaultLabels = []string{
+	"order_status",
+	"product_info",
+	"nutrition",
+	"pricing",
+	"shipping",
+	"returns",
+	"complaint",
+	"account",
+	"greeting",
+}
+
+var intentsTotal = metrics.NewCounterVec("orchestrator_intents_total",
+	"Inbound messages by classified intent.", "intent")
+
+type Classifier struct {
+	rdb        *redis.Client
+	coreURL    string
+	labels     []string
+	httpClient *http.Client
+}
+
+// NewClassifier labels messages using cognitive-core's /classify endpoint at
+// coreURL. Other is always part of the taxonomy.
+func NewClassifier(rdb *redis.Client, coreURL string, labels []string) *Classifier {
+	if len(labels) == 0 {
+		labels = DefaultLabels
+	}
+	taxonomy := make([]string, 0, len(labels)+1)
+	for _, l := range labels {
+		if l = strings.TrimSpace(l); l != "" && l != Other {
+			taxonomy = append(taxonomy, l)
+		}
+	}
+	return &Classifier{
+		rdb:        rdb,
+		coreURL:    coreURL,
+		labels:     append(taxonomy, Other),
+		httpClient: corehttp.NewClient(classifyTimeout),
+	}
+}
+
+// Labels returns the taxonomy, including Other.
+func (c *Classifier) Labels() []string {
+	return c.labels
+}
+
+// Pending is a classification running alongside answer generation.
+type Pending struct {
+	done  chan struct{}
+	label string
+}
+
+// Wait returns the intent, blocking until classification finishes. It is
+// nil-safe and returns "" when intent analytics is disabled.
+func (p *Pending) Wait() string {
+	if p == nil {
+		return ""
+	}
+	<-p.done
+	return p.label
+}
+
+// Start classifies text in the background and counts the result for tenant.
+// It never fails: errors are logged and recorded as Other.
+func (c *Classifier) Start(ctx context.Context, tenant, text string) *Pending {
+	if c == nil {
+		return nil
+	}
+	p := &Pending{done: make(chan struct{})}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer close(p.done)
+		label, err := c.classify(ctx, text)
+		if err != nil {
+			log.Printf("Failed to classify intent: %v", err)
+		}
+		if label == "" {
+			label = Other
+		}
+		p.label = label
+		c.count(ctx, tenant, label, time.Now().UTC())
+	}()
+	return p
+}
+
+type classifyRequest struct {
+	Text   string   `json:"text"`
+	Labels []string `json:"labels"`
+}
+
+type classifyResponse struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (c *Classifier) classify(ctx context.Context, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", nil
+	}
+	if r := []rune(text); len(r) > maxClassifyText {
+		text = string(r[:maxClassifyText])
+	}
+	body, err := json.Marshal(classifyRequest{Text: text, Labels: c.labels})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal classify request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.coreURL+"/classify", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create classify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("classify request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", fmt.Errorf("failed to read classify response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("classify returned %d", resp.StatusCode)
+	}
+	var cr classifyResponse
+	if err := json.Unmarshal(data, &cr); err != nil {
+		return "", fmt.Errorf("failed to unmarshal classify response: %w", err)
+	}
+	for _, l := range c.labels {
+		if l == cr.Label {
+			return l, nil
+		}
+	}
+	return "", nil
+}
+
+func hourKey(tenant string, t time.Time) string {
+	return countsPrefix + tenant + ":" + t.UTC().Format("2006010215")
+}
+
+// count adds label to the hourly totals, both overall and for tenant.
+func (c *Classifier) count(ctx context.Context, tenant, label string, at time.Time) {
+	intentsTotal.Inc(label)
+	if tenant == "" {
+		tenant = "default"
+	}
+	pipe := c.rdb.Pipeline()
+	for _, key := range []string{hourKey(allTenants, at), hourKey(tenant, at)} {
+		pipe.HIncrBy(ctx, key, label, 1)
+		pipe.Expire(ctx, key, countsTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to count intent %s: %v", label, err)
+	}
+}
@@ -0,0 +1,119 @@
+package intent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Labels need this many messages in the latest interval to trend
+	trendingMinCount = 5
+	trendingMax      = 10
+)
+
+// Bucket is the intent counts for one interval.
+type Bucket struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// Trending is a label whose volume in the latest interval is above its
+// average over the earlier intervals of the report.
+type Trending struct {
+	Label    string  `json:"label"`
+	Latest   int     `json:"latest"`
+	Baseline float64 `json:"baseline"`
+	Change   float64 `json:"change"`
+}
+
+type Trends struct {
+	Since    time.Time      `json:"since"`
+	Interval string         `json:"interval"`
+	Tenant   string         `json:"tenant,omitempty"`
+	Totals   map[string]int `json:"totals"`
+	Series   []Bucket       `json:"series"`
+	Trending []Trending     `json:"trending"`
+}
+
+// Trends aggregates counts from since until now into hourly or daily
+// buckets. An empty tenant covers all tenants.
+func (c *Classifier) Trends(ctx context.Context, since time.Time, interval time.Duration, tenant string) (*Trends, error) {
+	name := "hour"
+	if interval >= 24*time.Hour {
+		interval, name = 24*time.Hour, "day"
+	} else {
+		interval = time.Hour
+	}
+	key := tenant
+	if key == "" {
+		key = allTenants
+	}
+
+	now := time.Now().UTC()
+	since = since.UTC().Truncate(interval)
+	var hours []time.Time
+	for h := since; !h.After(now); h = h.Add(time.Hour) {
+		hours = append(hours, h)
+	}
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(hours))
+	for i, h := range hours {
+		cmds[i] = pipe.HGetAll(ctx, hourKey(key, h))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load intent counts: %w", err)
+	}
+
+	tr := &Trends{Since: since, Interval: name, Tenant: tenant, Totals: map[string]int{}}
+	var cur *Bucket
+	for i, h := range hours {
+		start := h.Truncate(interval)
+		if cur == nil || !cur.Start.Equal(start) {
+			tr.Series = append(tr.Series, Bucket{Start: start, Counts: map[string]int{}})
+			cur = &tr.Series[len(tr.Series)-1]
+		}
+		for label, v := range cmds[i].Val() {
+			n, _ := strconv.Atoi(v)
+			cur.Counts[label] += n
+			cur.Total += n
+			tr.Totals[label] += n
+		}
+	}
+	tr.Trending = trending(tr.Series)
+	return tr, nil
+}
+
+// trending compares the latest bucket with the mean of the ones before it.
+func trending(series []Bucket) []Trending {
+	if len(series) < 2 {
+		return []Trending{}
+	}
+	latest := series[len(series)-1]
+	earlier := series[:len(series)-1]
+	out := []Trending{}
+	for label, n := range latest.Counts {
+		if n < trendingMinCount {
+			continue
+		}
+		sum := 0
+		for _, b := range earlier {
+			sum += b.Counts[label]
+		}
+		baseline := float64(sum) / float64(len(earlier))
+		if float64(n) <= baseline {
+			continue
+		}
+		out = append(out, Trending{Label: label, Latest: n, Baseline: baseline, Change: (float64(n) - baseline) / max(baseline, 1)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Change > out[j].Change })
+	if len(out) > trendingMax {
+		out = out[:trendingMax]
+	}
+	return out
+}
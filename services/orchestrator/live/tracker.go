@@ -0,0 +1,159 @@
+// Package live keeps a rolling in-memory view of traffic for status
+// wallboards: who is talking to the genie right now and how fast it answers.
+package live
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Window is how far back a snapshot looks
+	Window     = 5 * time.Minute
+	topTenants = 5
+)
+
+type bucket struct {
+	minute   int64
+	messages int
+	answered int
+	latency  time.Duration
+	tenants  map[string]int
+}
+
+type activity struct {
+	channel string
+	last    time.Time
+}
+
+type TenantVolume struct {
+	Tenant   string `json:"tenant"`
+	Messages int    `json:"messages"`
+}
+
+// Snapshot summarizes the last Window of traffic.
+type Snapshot struct {
+	GeneratedAt       time.Time      `json:"generated_at"`
+	WindowSeconds     int            `json:"window_seconds"`
+	ActiveSessions    map[string]int `json:"active_sessions"`
+	TotalActive       int            `json:"total_active_sessions"`
+	MessagesPerMinute float64        `json:"messages_per_minute"`
+	MessagesLastMin   int            `json:"messages_last_minute"`
+	AvgLatencyMs      float64        `json:"avg_latency_ms"`
+	InFlight          int            `json:"in_flight"`
+	TopTenants        []TenantVolume `json:"top_tenants"`
+}
+
+// Tracker counts messages in per-minute buckets. A session is active if it
+// sent a message within the window. Counts are per orchestrator instance.
+type Tracker struct {
+	mu       sync.Mutex
+	buckets  []bucket
+	sessions map[string]activity
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		buckets:  make([]bucket, int(Window/time.Minute)),
+		sessions: make(map[string]activity),
+	}
+}
+
+// Message records an inbound message. It is nil-safe.
+func (t *Tracker) Message(channel, tenant, sessionID string) {
+	if t == nil {
+		return
+	}
+	if tenant == "" {
+		tenant = "default"
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(now)
+	b.messages++
+	b.tenants[tenant]++
+	t.sessions[sessionID] = activity{channel: channel, last: now}
+}
+
+// Answered records how long a message took from receipt to reply.
+func (t *Tracker) Answered(latency time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(time.Now())
+	b.answered++
+	b.latency += latency
+}
+
+// bucket returns the current minute's bucket, recycling a stale one.
+func (t *Tracker) bucket(now time.Time) *bucket {
+	minute := now.Unix() / 60
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute, tenants: make(map[string]int)}
+	}
+	return b
+}
+
+func (t *Tracker) Snapshot(inFlight int) Snapshot {
+	now := time.Now()
+	minute := now.Unix() / 60
+	snap := Snapshot{
+		GeneratedAt:    now.UTC(),
+		WindowSeconds:  int(Window.Seconds()),
+		ActiveSessions: map[string]int{},
+		InFlight:       inFlight,
+		TopTenants:     []TenantVolume{},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, a := range t.sessions {
+		if now.Sub(a.last) > Window {
+			delete(t.sessions, id)
+			continue
+		}
+		snap.ActiveSessions[a.channel]++
+		snap.TotalActive++
+	}
+
+	var messages, answered int
+	var latency time.Duration
+	tenants := map[string]int{}
+	for _, b := range t.buckets {
+		if minute-b.minute >= int64(len(t.buckets)) {
+			continue
+		}
+		messages += b.messages
+		answered += b.answered
+		latency += b.latency
+		for tenant, n := range b.tenants {
+			tenants[tenant] += n
+		}
+		// The previous full minute, so the figure doesn't dip at :00
+		if b.minute == minute-1 {
+			snap.MessagesLastMin = b.messages
+		}
+	}
+	snap.MessagesPerMinute = float64(messages) / Window.Minutes()
+	if answered > 0 {
+		snap.AvgLatencyMs = float64(latency.Milliseconds()) / float64(answered)
+	}
+	for tenant, n := range tenants {
+		snap.TopTenants = append(snap.TopTenants, TenantVolume{Tenant: tenant, Messages: n})
+	}
+	sort.Slice(snap.TopTenants, func(i, j int) bool {
+		if snap.TopTenants[i].Messages != snap.TopTenants[j].Messages {
+			return snap.TopTenants[i].Messages > snap.TopTenants[j].Messages
+		}
+		return snap.TopTenants[i].Tenant < snap.TopTenants[j].Tenant
+	})
+	if len(snap.TopTenants) > topTenants {
+		snap.TopTenants = snap.TopTenants[:topTenants]
+	}
+	return snap
+}
@@ -0,0 +1,306 @@
+// Package locks lets external automation, such as bulk imports, migrations
+// or agent tools, pause the bot for a session while it changes the session
+// out of band. While a session is locked its inbound messages are queued
+// instead of answered; releasing the lock, or letting it expire, puts them
+// back on msg:inbound in the order they arrived.
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+const (
+	lockPrefix  = "session:lock:"
+	queuePrefix = "session:lockq:"
+	// Lock expiry times by session, for the sweeper
+	expiryKey = "session:locks"
+	// Queued messages go back on the router's inbound stream
+	inboundStream = "msg:inbound"
+	maxQueued     = 500
+	sweepInterval = 15 * time.Second
+)
+
+// DefaultTTL and MaxTTL bound a lease; holders renew to keep it longer.
+var (
+	DefaultTTL = 5 * time.Minute
+	MaxTTL     = time.Hour
+)
+
+var (
+	ErrLocked    = errors.New("session is locked by another holder")
+	ErrNotHeld   = errors.New("lock is not held with this token")
+	ErrQueueFull = errors.New("session has too many queued messages")
+)
+
+var (
+	queuedTotal = metrics.NewCounterVec("orchestrator_locked_messages_total",
+		"Inbound messages queued because their session was locked.")
+	releasesTotal = metrics.NewCounterVec("orchestrator_session_lock_releases_total",
+		"Session locks ended, by whether they were released or expired.", "outcome")
+)
+
+// Lock is a lease on a session. Token proves ownership; it is only
+// returned to the caller that acquired the lock.
+type Lock struct {
+	SessionID  string    `json:"session_id"`
+	Token      string    `json:"token,omitempty"`
+	Holder     string    `json:"holder"`
+	Reason     string    `json:"reason,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Queued is how many messages are waiting for the lock to end
+	Queued int64 `json:"queued"`
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// Acquire locks the session for ttl. If another holder has it, the current
+// lock is returned, without its token, with ErrLocked.
+func (s *Store) Acquire(ctx context.Context, sessionID, holder, reason string, ttl time.Duration) (*Lock, error) {
+	ttl = clampTTL(ttl)
+	now := time.Now().UTC()
+	l := Lock{
+		SessionID:  sessionID,
+		Token:      uuid.New().String(),
+		Holder:     holder,
+		Reason:     reason,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lock: %w", err)
+	}
+	ok, err := s.rdb.SetNX(ctx, lockPrefix+sessionID, data, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	if !ok {
+		cur, err := s.Get(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return cur, ErrLocked
+	}
+	if err := s.rdb.ZAdd(ctx, expiryKey, redis.Z{Score: float64(l.ExpiresAt.UnixMilli()), Member: sessionID}).Err(); err != nil {
+		log.Printf("Failed to schedule expiry of lock on %s: %v", sessionID, err)
+	}
+	log.Printf("Session %s locked by %s for %s", sessionID, holder, ttl)
+	return &l, nil
+}
+
+// Get returns the session's lock without its token, or nil if it has none.
+func (s *Store) Get(ctx context.Context, sessionID string) (*Lock, error) {
+	data, err := s.rdb.Get(ctx, lockPrefix+sessionID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lock: %w", err)
+	}
+	var l Lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lock: %w", err)
+	}
+	l.Token = ""
+	if l.Queued, err = s.rdb.LLen(ctx, queuePrefix+sessionID).Result(); err != nil {
+		return nil, fmt.Errorf("failed to count queued messages: %w", err)
+	}
+	return &l, nil
+}
+
+// Renew extends the lease held with token to ttl from now.
+func (s *Store) Renew(ctx context.Context, sessionID, token string, ttl time.Duration) (*Lock, error) {
+	ttl = clampTTL(ttl)
+	key := lockPrefix + sessionID
+	var out Lock
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		l, err := held(ctx, tx, key, token)
+		if err != nil {
+			return err
+		}
+		l.ExpiresAt = time.Now().UTC().Add(ttl)
+		data, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("failed to marshal lock: %w", err)
+		}
+		if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, ttl)
+			pipe.ZAdd(ctx, expiryKey, redis.Z{Score: float64(l.ExpiresAt.UnixMilli()), Member: sessionID})
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to renew lock: %w", err)
+		}
+		out = *l
+		return nil
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		// Released or taken over while renewing
+		return nil, ErrNotHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Release ends the lock held with token, or whatever lock the session has
+// when token is "", and requeues the messages that waited for it. It returns
+// how many were requeued.
+func (s *Store) Release(ctx context.Context, sessionID, token string) (int, error) {
+	key := lockPrefix + sessionID
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		if token != "" {
+			if _, err := held(ctx, tx, key, token); err != nil {
+				return err
+			}
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, expiryKey, sessionID)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return 0, ErrNotHeld
+	}
+	if err != nil {
+		return 0, err
+	}
+	releasesTotal.Inc("released")
+	log.Printf("Session %s unlocked", sessionID)
+	return s.requeue(ctx, sessionID)
+}
+
+// Hold queues the envelope if the session is locked, reporting whether it
+// did. Queued messages are acknowledged by the caller like handled ones.
+func (s *Store) Hold(ctx context.Context, sessionID, envelope string) (bool, error) {
+	n, err := holdScript.Run(ctx, s.rdb, []string{lockPrefix + sessionID, queuePrefix + sessionID}, envelope, maxQueued).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to check session lock: %w", err)
+	}
+	switch n {
+	case 0:
+		return false, nil
+	case -1:
+		return true, ErrQueueFull
+	}
+	queuedTotal.Inc()
+	return true, nil
+}
+
+// Sweep requeues the messages of locks that expired without being released,
+// until ctx is done. Run it on every replica; each expired lock is handled
+// by one.
+func (s *Store) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		expired, err := s.rdb.ZRangeByScore(ctx, expiryKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to list expired session locks: %v", err)
+			continue
+		}
+		for _, sessionID := range expired {
+			// Whichever replica removes the entry requeues the messages
+			if n, err := s.rdb.ZRem(ctx, expiryKey, sessionID).Result(); err != nil || n == 0 {
+				continue
+			}
+			releasesTotal.Inc("expired")
+			n, err := s.requeue(ctx, sessionID)
+			if err != nil {
+				log.Printf("Failed to requeue messages of session %s: %v", sessionID, err)
+				continue
+			}
+			log.Printf("Lock on session %s expired; requeued %d messages", sessionID, n)
+		}
+	}
+}
+
+// requeue moves the session's queued messages back to msg:inbound, oldest
+// first.
+func (s *Store) requeue(ctx context.Context, sessionID string) (int, error) {
+	n := 0
+	for {
+		envelope, err := s.rdb.LPop(ctx, queuePrefix+sessionID).Result()
+		if err == redis.Nil {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("failed to read queued message: %w", err)
+		}
+		if err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: inboundStream,
+			Values: map[string]interface{}{"envelope": envelope},
+		}).Err(); err != nil {
+			// Put it back so the next release or sweep retries it
+			s.rdb.LPush(ctx, queuePrefix+sessionID, envelope)
+			return n, fmt.Errorf("failed to requeue message: %w", err)
+		}
+		n++
+	}
+}
+
+// held loads the lock at key, if token holds it.
+func held(ctx context.Context, tx *redis.Tx, key, token string) (*Lock, error) {
+	data, err := tx.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotHeld
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lock: %w", err)
+	}
+	var l Lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lock: %w", err)
+	}
+	if l.Token != token {
+		return nil, ErrNotHeld
+	}
+	return &l, nil
+}
+
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultTTL
+	}
+	return min(ttl, MaxTTL)
+}
+
+// holdScript queues ARGV[1] on KEYS[2] while KEYS[1] exists, returning the
+// queue length, 0 when unlocked, or -1 when the queue is full.
+var holdScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("LLEN", KEYS[2]) >= tonumber(ARGV[2]) then
+	return -1
+end
+return redis.call("RPUSH", KEYS[2], ARGV[1])
+`)
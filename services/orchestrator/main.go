@@ -8,12 +8,52 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/redis/go-redis/v9"
-
+	"orchestrator/admin"
+	"orchestrator/anonymize"
+	"orchestrator/apikeys"
+	"orchestrator/archive"
+	"orchestrator/attachment"
+	"orchestrator/audit"
+	"orchestrator/backend"
+	"orchestrator/blobstore"
+	"orchestrator/campaign"
+	"orchestrator/corehttp"
+	"orchestrator/deadletter"
+	"orchestrator/degrade"
+	"orchestrator/delivery"
+	"orchestrator/evaluation"
+	"orchestrator/flags"
+	"orchestrator/gaps"
+	"orchestrator/httperr"
+	"orchestrator/intent"
+	"orchestrator/live"
+	"orchestrator/locks"
+	"orchestrator/maintenance"
+	"orchestrator/metrics"
+	"orchestrator/migrate"
+	"orchestrator/notes"
+	"orchestrator/override"
+	"orchestrator/policy"
+	"orchestrator/presence"
+	"orchestrator/redisconn"
+	"orchestrator/region"
+	"orchestrator/reports"
 	"orchestrator/router"
+	"orchestrator/rules"
 	"orchestrator/session"
+	"orchestrator/sla"
+	"orchestrator/smoke"
+	"orchestrator/status"
+	"orchestrator/tone"
+	"orchestrator/training"
+	"orchestrator/trigger"
+	"orchestrator/verify"
+	"orchestrator/widget"
 )
 
 func main() {
@@ -25,16 +65,177 @@ func main() {
 	if cognitiveURL == "" {
 		cognitiveURL = "http://localhost:8083"
 	}
+	canaryURL := os.Getenv("CANARY_COGNITIVE_CORE_URL")
+	canaryPercent, err := strconv.Atoi(envOr("CANARY_PERCENT", "0"))
+	if err != nil {
+		log.Fatalf("Invalid CANARY_PERCENT: %v", err)
+	}
+	var canarySessions []string
+	if v := os.Getenv("CANARY_SESSIONS"); v != "" {
+		canarySessions = strings.Split(v, ",")
+	}
+	shadowURL := os.Getenv("SHADOW_COGNITIVE_CORE_URL")
+	shadowPercent, err := strconv.Atoi(envOr("SHADOW_PERCENT", "100"))
+	if err != nil {
+		log.Fatalf("Invalid SHADOW_PERCENT: %v", err)
+	}
+	contextTokens, err := strconv.Atoi(envOr("CONTEXT_TOKEN_BUDGET", "2000"))
+	if err != nil || contextTokens < 100 {
+		log.Fatalf("Invalid CONTEXT_TOKEN_BUDGET: %v", err)
+	}
+	session.ContextTokens = contextTokens
+	if v := os.Getenv("DEFAULT_TIME_ZONE"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_TIME_ZONE: %v", err)
+		}
+		session.DefaultTimeZone = loc
+	}
+	evalSampleRate, err := strconv.ParseFloat(envOr("EVAL_SAMPLE_RATE", "0"), 64)
+	if err != nil {
+		log.Fatalf("Invalid EVAL_SAMPLE_RATE: %v", err)
+	}
+	evalThreshold, err := strconv.ParseFloat(envOr("EVAL_ALERT_THRESHOLD", "0.6"), 64)
+	if err != nil {
+		log.Fatalf("Invalid EVAL_ALERT_THRESHOLD: %v", err)
+	}
+	verifyMode, err := verify.ParseMode(envOr("LINK_VERIFY_MODE", verify.ModeFlag))
+	if err != nil {
+		log.Fatalf("Invalid LINK_VERIFY_MODE: %v", err)
+	}
+	allowedLinkDomains := strings.Split(envOr("LINK_ALLOWLIST", "mandalafoods.co"), ",")
+	var allowedPhones []string
+	if v := os.Getenv("PHONE_ALLOWLIST"); v != "" {
+		allowedPhones = strings.Split(v, ",")
+	}
+	triggerToken := os.Getenv("TRIGGER_TOKEN")
+	triggerTemplates, err := trigger.LoadTemplates(os.Getenv("TRIGGER_TEMPLATES"))
+	if err != nil {
+		log.Fatalf("Invalid TRIGGER_TEMPLATES: %v", err)
+	}
+	var policyConfig *policy.Config
+	if path := os.Getenv("TOPIC_POLICIES"); path != "" {
+		policyConfig, err = policy.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Invalid TOPIC_POLICIES: %v", err)
+		}
+	}
+	toneConfig := &tone.Config{}
+	if path := os.Getenv("TONE_PROFILES"); path != "" {
+		toneConfig, err = tone.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Invalid TONE_PROFILES: %v", err)
+		}
+	}
+	// RULE_FLOWS="returns=http://returns-core:8083" names the cognitive-core
+	// deployments operator rules can route messages to
+	ruleFlows := map[string]string{}
+	if v := os.Getenv("RULE_FLOWS"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			name, url, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || name == "" || url == "" {
+				log.Fatalf("Invalid RULE_FLOWS entry %q", pair)
+			}
+			ruleFlows[name] = url
+		}
+	}
+	deliveryLimits, err := delivery.ParseLimits(os.Getenv("DELIVERY_RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("Invalid DELIVERY_RATE_LIMITS: %v", err)
+	}
+	campaignApprovalMin, err := strconv.Atoi(envOr("CAMPAIGN_APPROVAL_MIN_AUDIENCE", "0"))
+	if err != nil || campaignApprovalMin < 0 {
+		log.Fatalf("Invalid CAMPAIGN_APPROVAL_MIN_AUDIENCE: must be a non-negative integer")
+	}
+	// Each replica needs its own consumer name; pod hostnames are unique
+	consumerName := os.Getenv("CONSUMER_NAME")
+	if consumerName == "" {
+		consumerName, _ = os.Hostname()
+	}
+	if consumerName != "" {
+		router.ConsumerName = consumerName
+		gaps.ConsumerName = consumerName
+		delivery.ConsumerName = consumerName
+		reports.ConsumerName = consumerName
+	}
+	claimIdle, err := time.ParseDuration(envOr("CLAIM_IDLE", "2m"))
+	if err != nil || claimIdle < 10*time.Second {
+		log.Fatalf("Invalid CLAIM_IDLE: must be a duration of at least 10s")
+	}
+	router.ClaimIdle = claimIdle
+	shutdownGrace, err := time.ParseDuration(envOr("SHUTDOWN_GRACE", "25s"))
+	if err != nil || shutdownGrace < 0 {
+		log.Fatalf("Invalid SHUTDOWN_GRACE: %v", err)
+	}
+	if router.ScaleMinReplicas, err = strconv.Atoi(envOr("SCALE_MIN_REPLICAS", "1")); err != nil || router.ScaleMinReplicas < 0 {
+		log.Fatalf("Invalid SCALE_MIN_REPLICAS: must be a non-negative integer")
+	}
+	if router.ScaleMaxReplicas, err = strconv.Atoi(envOr("SCALE_MAX_REPLICAS", "10")); err != nil || router.ScaleMaxReplicas < max(router.ScaleMinReplicas, 1) {
+		log.Fatalf("Invalid SCALE_MAX_REPLICAS: must be at least SCALE_MIN_REPLICAS and 1")
+	}
+	if router.ScaleDrainTime, err = time.ParseDuration(envOr("SCALE_DRAIN_TIME", "30s")); err != nil || router.ScaleDrainTime <= 0 {
+		log.Fatalf("Invalid SCALE_DRAIN_TIME: must be a positive duration")
+	}
+	if locks.MaxTTL, err = time.ParseDuration(envOr("SESSION_LOCK_MAX_TTL", "1h")); err != nil || locks.MaxTTL <= 0 {
+		log.Fatalf("Invalid SESSION_LOCK_MAX_TTL: must be a positive duration")
+	}
+	locks.DefaultTTL = min(locks.DefaultTTL, locks.MaxTTL)
+	if degrade.ErrorRate, err = strconv.ParseFloat(envOr("DEGRADE_ERROR_RATE", "0.5"), 64); err != nil || degrade.ErrorRate <= 0 || degrade.ErrorRate > 1 {
+		log.Fatalf("Invalid DEGRADE_ERROR_RATE: must be above 0 and at most 1")
+	}
+	if degrade.SlowLatency, err = time.ParseDuration(envOr("DEGRADE_LATENCY", "20s")); err != nil || degrade.SlowLatency <= 0 {
+		log.Fatalf("Invalid DEGRADE_LATENCY: must be a positive duration")
+	}
+	if degrade.FAQLag, err = strconv.ParseInt(envOr("DEGRADE_FAQ_LAG", "100"), 10, 64); err != nil || degrade.FAQLag < 1 {
+		log.Fatalf("Invalid DEGRADE_FAQ_LAG: must be a positive integer")
+	}
+	if degrade.StaticLag, err = strconv.ParseInt(envOr("DEGRADE_STATIC_LAG", "500"), 10, 64); err != nil || degrade.StaticLag < degrade.FAQLag {
+		log.Fatalf("Invalid DEGRADE_STATIC_LAG: must be at least DEGRADE_FAQ_LAG")
+	}
+	regionName := os.Getenv("REGION")
+	regionRole := envOr("REGION_ROLE", region.RolePrimary)
+	peerRedisURL := os.Getenv("PEER_REDIS_URL")
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8082"
 	}
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	anonymizeAfter, err := time.ParseDuration(envOr("ANONYMIZE_AFTER", "0"))
+	if err != nil {
+		log.Fatalf("Invalid ANONYMIZE_AFTER: %v", err)
+	}
+	anonymizeSecret := os.Getenv("ANONYMIZE_SECRET")
+	if anonymizeAfter > 0 && anonymizeSecret == "" {
+		log.Fatalf("ANONYMIZE_SECRET is required when ANONYMIZE_AFTER is set")
+	}
+	if anonymizeAfter > 0 {
+		archive.ExternalTTL = min(archive.ExternalTTL, anonymizeAfter)
+	}
+
+	trainingDir := os.Getenv("TRAINING_DATA_DIR")
+	trainingSampleRate, err := strconv.ParseFloat(envOr("TRAINING_SAMPLE_RATE", "0.1"), 64)
+	if err != nil || trainingSampleRate < 0 || trainingSampleRate > 1 {
+		log.Fatalf("Invalid TRAINING_SAMPLE_RATE: must be between 0 and 1")
+	}
+	if trainingDir != "" && anonymizeAfter == 0 {
+		log.Fatalf("TRAINING_DATA_DIR requires ANONYMIZE_AFTER; only anonymized conversations are sampled")
+	}
 
-	opts, err := redis.ParseURL(redisURL)
+	redisOpts, err := redisconn.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Redis settings: %v", err)
+	}
+	router.ReadBlock = redisOpts.ReadBlock
+	delivery.ReadBlock = redisOpts.ReadBlock
+	coreOpts, err := corehttp.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid cognitive-core client settings: %v", err)
+	}
+	corehttp.Configure(coreOpts)
+	rdb, err := redisconn.NewClient(redisURL, redisOpts)
 	if err != nil {
 		log.Fatalf("Invalid REDIS_URL: %v", err)
 	}
-	rdb := redis.NewClient(opts)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -44,9 +245,138 @@ func main() {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 	log.Println("Connected to Redis")
+	go redisconn.Keepalive(ctx, rdb, redisOpts.Keepalive)
+	if redisOpts.Keepalive > 0 {
+		redisconn.PubSubKeepalive = redisOpts.Keepalive
+	}
+
+	// Upgrade stored data before anything reads it
+	if os.Getenv("SKIP_MIGRATIONS") != "true" {
+		migrations, err := migrate.NewRunner(rdb, migrate.All)
+		if err != nil {
+			log.Fatalf("Invalid migrations: %v", err)
+		}
+		if err := migrations.Run(ctx); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	}
 
-	sessionMgr := session.NewManager(rdb)
-	r := router.New(rdb, sessionMgr, cognitiveURL)
+	archiveStore := archive.NewStore(rdb)
+	sessionMgr := session.NewManager(rdb, archiveStore)
+
+	// Active/passive multi-region: fence writes and replicate to the peer
+	var coordinator *region.Coordinator
+	if regionName != "" {
+		coordinator = region.NewCoordinator(rdb, regionName, regionRole)
+		var replicator *region.Replicator
+		if peerRedisURL != "" {
+			peer, err := redisconn.NewClient(peerRedisURL, redisOpts)
+			if err != nil {
+				log.Fatalf("Invalid PEER_REDIS_URL: %v", err)
+			}
+			go redisconn.Keepalive(ctx, peer, redisOpts.Keepalive)
+			coordinator.EnablePeer(peer)
+			replicator = region.NewReplicator(coordinator, peer)
+		}
+		if err := coordinator.Init(ctx); err != nil {
+			log.Fatalf("Failed to initialize region: %v", err)
+		}
+		if replicator != nil {
+			go replicator.Run(ctx)
+		}
+		sessionMgr.EnableRegion(coordinator, replicator)
+		go coordinator.WatchPromotion(ctx)
+	}
+	overrides := override.NewStore(rdb)
+	maintenanceSwitch := maintenance.NewSwitch(rdb)
+	backends := backend.NewSelector(cognitiveURL, canaryURL, canaryPercent, canarySessions)
+	if canaryURL != "" {
+		log.Printf("Canary routing enabled: %d%% of sessions to %s", backends.CanaryPercent(), canaryURL)
+	}
+	publisher := delivery.NewPublisher(rdb, deliveryLimits)
+	publisher.Run(ctx)
+	go publisher.ConsumeReceipts(ctx)
+	r := router.New(rdb, sessionMgr, maintenanceSwitch, publisher, backends)
+	if coordinator != nil {
+		r.EnableRegion(coordinator)
+	}
+	if policyConfig != nil {
+		policies, err := policy.NewEngine(rdb, *policyConfig)
+		if err != nil {
+			log.Fatalf("Invalid TOPIC_POLICIES: %v", err)
+		}
+		r.EnablePolicy(policies)
+	}
+	styles, err := tone.NewEngine(*toneConfig)
+	if err != nil {
+		log.Fatalf("Invalid TONE_PROFILES: %v", err)
+	}
+	r.EnableTone(styles)
+	r.EnableOverrides(overrides)
+	ruleEngine := rules.NewEngine(rdb, ruleFlows)
+	if err := ruleEngine.Reload(ctx); err != nil {
+		log.Printf("Failed to load rules: %v", err)
+	}
+	go ruleEngine.Watch(ctx)
+	r.EnableRules(ruleEngine)
+	if path := os.Getenv("FEATURE_FLAGS"); path != "" {
+		flagConfig, err := flags.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Invalid FEATURE_FLAGS: %v", err)
+		}
+		features, err := flags.NewResolver(rdb, *flagConfig)
+		if err != nil {
+			log.Fatalf("Invalid FEATURE_FLAGS: %v", err)
+		}
+		r.EnableFeatures(features)
+	}
+	liveStats := live.NewTracker()
+	r.EnableLiveStats(liveStats)
+	// Tenant IDs come from the envelope, so their labels are capped: only
+	// METRICS_TENANTS when set, else the first METRICS_MAX_TENANTS seen
+	maxTenants, err := strconv.Atoi(envOr("METRICS_MAX_TENANTS", "20"))
+	if err != nil || maxTenants < 0 {
+		log.Fatalf("Invalid METRICS_MAX_TENANTS: %v", err)
+	}
+	var metricTenants []string
+	if v := os.Getenv("METRICS_TENANTS"); v != "" {
+		metricTenants = strings.Split(v, ",")
+	}
+	if maxTenants > 0 || len(metricTenants) > 0 {
+		r.EnableTenantMetrics(metrics.NewLimiter(maxTenants, metricTenants...))
+	}
+	if os.Getenv("COALESCE_REQUESTS") != "false" {
+		r.EnableCoalescing()
+	}
+	if os.Getenv("DECOMPOSE_QUESTIONS") == "true" {
+		r.EnableDecomposition()
+	}
+	// Uploads go to cognitive-core with their message; the bytes are read
+	// from wherever channel-adapter stored them
+	attachments := attachment.NewStore(rdb)
+	blobs, err := blobstore.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid attachment storage: %v", err)
+	}
+	if blobs != nil {
+		attachments.EnableObjectStorage(blobs)
+	}
+	if os.Getenv("FORWARD_ATTACHMENTS") != "false" {
+		r.EnableAttachments(attachments)
+	}
+	var ladder *degrade.Ladder
+	if os.Getenv("DEGRADATION_LADDER") != "false" {
+		ladder = degrade.NewLadder()
+		r.EnableDegradation(ladder)
+	}
+	// cognitive-core's health as seen here, for the channel adapter's /status
+	statusBoard := status.NewBoard(rdb)
+	go statusBoard.Run(ctx, map[string]status.Check{"cognitive_core": cognitiveCoreStatus(maintenanceSwitch, ladder)})
+	r.EnableVerification(verify.NewVerifier(rdb, verifyMode, allowedLinkDomains, allowedPhones))
+	if shadowURL != "" {
+		r.EnableShadow(shadowURL, shadowPercent)
+		log.Printf("Shadow mirroring enabled: %d%% of sessions to %s", shadowPercent, shadowURL)
+	}
 
 	// Create consumer group
 	if err := r.EnsureConsumerGroup(ctx); err != nil {
@@ -55,6 +385,98 @@ func main() {
 
 	// Start consumer loop in background
 	go r.ConsumeLoop(ctx)
+	go maintenanceSwitch.Report(ctx, router.ConsumerName, r.InFlight)
+	go r.WatchScaling(ctx)
+	log.Printf("Consuming msg:inbound as %s", router.ConsumerName)
+
+	scenarios, err := smoke.LoadScenarios(os.Getenv("SMOKE_SCENARIOS"))
+	if err != nil {
+		log.Fatalf("Failed to load smoke test scenarios: %v", err)
+	}
+	smokeRunner, err := smoke.NewRunner(rdb, scenarios)
+	if err != nil {
+		log.Fatalf("Invalid smoke test scenarios: %v", err)
+	}
+	// SMOKE_ON_START=true checks a fresh deploy end to end; the result is
+	// logged and kept for GET /admin/smoke
+	if os.Getenv("SMOKE_ON_START") == "true" {
+		go func() {
+			rep, err := smokeRunner.Run(ctx, "startup")
+			if err != nil {
+				log.Printf("Startup smoke test not run: %v", err)
+				return
+			}
+			log.Printf("Startup smoke test passed=%v (%d scenarios)", rep.Passed, len(rep.Scenarios))
+		}()
+	}
+
+	var intents *intent.Classifier
+	if os.Getenv("ENABLE_INTENT_ANALYTICS") == "true" {
+		var labels []string
+		if v := os.Getenv("INTENT_LABELS"); v != "" {
+			labels = strings.Split(v, ",")
+		}
+		intents = intent.NewClassifier(rdb, cognitiveURL, labels)
+		r.EnableIntents(intents)
+	}
+	var gapTracker *gaps.Tracker
+	if os.Getenv("ENABLE_KNOWLEDGE_GAPS") == "true" {
+		gapTracker = gaps.NewTracker(rdb, archiveStore, cognitiveURL)
+		r.EnableGapTracking(gapTracker)
+		go gapTracker.ConsumeFeedback(ctx)
+		go gapTracker.EmbedNew(ctx)
+	}
+
+	var evaluator *evaluation.Evaluator
+	if evalSampleRate > 0 {
+		evaluator = evaluation.NewEvaluator(rdb, archiveStore, cognitiveURL, evalSampleRate, evalThreshold, 50)
+		if gapTracker != nil {
+			evaluator.OnScored(gapTracker.ObserveScore(evalThreshold))
+		}
+		r.EnableEvaluation(evaluator)
+		go evaluator.Run(ctx)
+	}
+
+	reportStore := reports.NewStore(rdb, archiveStore)
+	if evaluator != nil {
+		reportStore.EnableEvaluation(evaluator)
+	}
+	r.EnableReports(reportStore)
+	go reportStore.Consume(ctx)
+
+	noteStore := notes.NewStore(rdb)
+	r.EnableNotes(noteStore)
+	deadLetters := deadletter.NewStore(rdb)
+	r.EnableDeadLetters(deadLetters)
+	sessionLocks := locks.NewStore(rdb)
+	r.EnableLocks(sessionLocks)
+	go sessionLocks.Sweep(ctx)
+	var slaTracker *sla.Tracker
+	if path := os.Getenv("SLA_TARGETS"); path != "" {
+		slaConfig, err := sla.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Invalid SLA_TARGETS: %v", err)
+		}
+		if slaTracker, err = sla.NewTracker(rdb, *slaConfig); err != nil {
+			log.Fatalf("Invalid SLA_TARGETS: %v", err)
+		}
+		r.EnableSLA(slaTracker)
+		go slaTracker.Watch(ctx)
+	}
+
+	// Pseudonymize transcripts past the retention age
+	if anonymizeAfter > 0 {
+		job := anonymize.NewJob(rdb, archiveStore, anonymizeSecret, anonymizeAfter, time.Hour)
+		if trainingDir != "" {
+			sampler, err := training.NewSampler(trainingDir, trainingSampleRate, evalThreshold)
+			if err != nil {
+				log.Fatalf("Failed to set up training sampling: %v", err)
+			}
+			job.OnAnonymized(sampler.Sample)
+			log.Printf("Sampling %.1f%% of anonymized conversations into %s", trainingSampleRate*100, trainingDir)
+		}
+		go job.Run(ctx)
+	}
 
 	// Health endpoint
 	mux := http.NewServeMux()
@@ -62,10 +484,86 @@ func main() {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
+	// Ready while Redis is reachable, whatever the degradation mode
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		status := http.StatusOK
+		body := map[string]interface{}{"ready": true, "degradation": ladder.Status()}
+		if err := rdb.Ping(req.Context()).Err(); err != nil {
+			status = http.StatusServiceUnavailable
+			body["ready"] = false
+			body["error"] = "redis unreachable"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+	mux.Handle("/metrics", metrics.Handler())
+	// For KEDA's metrics-api scaler (valueLocation: desired_replicas)
+	mux.HandleFunc("/scaling", func(w http.ResponseWriter, req *http.Request) {
+		sig := r.Scaling()
+		if sig == nil {
+			httperr.Write(w, req, http.StatusServiceUnavailable, "scaling signal not computed yet")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sig)
+	})
+	if triggerToken != "" {
+		triggers, err := trigger.NewHandler(publisher, sessionMgr, triggerToken, triggerTemplates)
+		if err != nil {
+			log.Fatalf("Failed to load trigger templates: %v", err)
+		}
+		mux.Handle("/v1/triggers", triggers)
+	}
+	if adminToken != "" {
+		adminHandler := admin.NewHandler(adminToken, admin.Deps{
+			Maintenance: maintenanceSwitch,
+			Publisher:   publisher,
+			Drainer:     r,
+			Backends:    backends,
+			Evaluator:   evaluator,
+			Region:      coordinator,
+			Overrides:   overrides,
+			Rules:       ruleEngine,
+			Attachments: attachments,
+			Gaps:        gapTracker,
+			Intents:     intents,
+			Live:        liveStats,
+			Archive:     archiveStore,
+			Audit:       audit.NewLog(rdb),
+			Campaigns:   campaign.NewStore(rdb, publisher, campaignApprovalMin),
+			Smoke:       smokeRunner,
+			Widgets:     widget.NewStore(rdb),
+			Sessions:    sessionMgr,
+			Reports:     reportStore,
+			APIKeys:     apikeys.NewStore(rdb),
+			Notes:       noteStore,
+			DeadLetters: deadLetters,
+			Locks:       sessionLocks,
+			SLA:         slaTracker,
+			Presence:    presence.NewRegistry(rdb),
+		})
+		// ADMIN_OPERATORS="alice:token1,bob:token2" gives each operator a
+		// token of their own so transcript reads are attributed to them
+		if ops := os.Getenv("ADMIN_OPERATORS"); ops != "" {
+			tokens := map[string]string{}
+			for _, pair := range strings.Split(ops, ",") {
+				name, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+				if !ok || name == "" || token == "" {
+					log.Fatalf("Invalid ADMIN_OPERATORS entry %q", pair)
+				}
+				tokens[name] = token
+			}
+			adminHandler.AddOperators(tokens)
+		}
+		mux.Handle("/admin/", adminHandler)
+	} else {
+		log.Println("ADMIN_TOKEN not set, admin API disabled")
+	}
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
-		Handler: mux,
+		Handler: httperr.WithCorrelationID(mux),
 	}
 
 	// Graceful shutdown
@@ -74,6 +572,8 @@ func main() {
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
 		log.Println("Shutting down...")
+		// Finish or hand back in-flight messages before Redis goes away
+		r.Shutdown(shutdownGrace)
 		cancel()
 		server.Close()
 	}()
@@ -83,3 +583,27 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// cognitiveCoreStatus reports maintenance mode and the degradation level as
+// cognitive-core's status.
+func cognitiveCoreStatus(sw *maintenance.Switch, ladder *degrade.Ladder) status.Check {
+	return func(ctx context.Context) (string, string) {
+		if mode, err := sw.Get(ctx); err == nil && mode.Enabled {
+			return status.Maintenance, mode.Message
+		}
+		switch ladder.Level() {
+		case degrade.FAQOnly:
+			return status.Degraded, "only common questions are being answered"
+		case degrade.Static:
+			return status.Down, "answers are paused while the service recovers"
+		}
+		return status.Operational, ""
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
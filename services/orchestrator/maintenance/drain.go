@@ -0,0 +1,59 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// inFlightKey maps each replica to how many messages it is processing,
+	// so drain state doesn't depend on which replica the admin API reaches
+	inFlightKey = "maintenance:in_flight"
+	reportEvery = 2 * time.Second
+	// Replicas that stopped reporting are dropped from the count
+	staleReport = 15 * time.Second
+)
+
+type report struct {
+	InFlight int       `json:"in_flight"`
+	At       time.Time `json:"at"`
+}
+
+// Report publishes this replica's in-flight count until ctx is cancelled.
+func (s *Switch) Report(ctx context.Context, replica string, inFlight func() int) {
+	ticker := time.NewTicker(reportEvery)
+	defer ticker.Stop()
+	for {
+		data, _ := json.Marshal(report{InFlight: inFlight(), At: time.Now().UTC()})
+		if err := s.rdb.HSet(ctx, inFlightKey, replica, data).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to report in-flight messages: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			s.rdb.HDel(context.Background(), inFlightKey, replica)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// InFlight returns how many messages all replicas are processing.
+func (s *Switch) InFlight(ctx context.Context) (int, error) {
+	reports, err := s.rdb.HGetAll(ctx, inFlightKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load in-flight messages: %w", err)
+	}
+	total := 0
+	for replica, data := range reports {
+		var r report
+		if json.Unmarshal([]byte(data), &r) != nil || time.Since(r.At) > staleReport {
+			s.rdb.HDel(ctx, inFlightKey, replica)
+			continue
+		}
+		total += r.InFlight
+	}
+	return total, nil
+}
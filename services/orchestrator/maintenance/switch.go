@@ -0,0 +1,64 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	modeKey = "maintenance:mode"
+
+	DefaultMessage = "Maya is getting an upgrade and will be back soon. Please try again in a few minutes."
+)
+
+type Mode struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// Switch stores maintenance mode in Redis so every orchestrator replica sees
+// the same state.
+type Switch struct {
+	rdb *redis.Client
+}
+
+func NewSwitch(rdb *redis.Client) *Switch {
+	return &Switch{rdb: rdb}
+}
+
+func (s *Switch) Get(ctx context.Context) (Mode, error) {
+	data, err := s.rdb.Get(ctx, modeKey).Bytes()
+	if err == redis.Nil {
+		return Mode{}, nil
+	}
+	if err != nil {
+		return Mode{}, fmt.Errorf("failed to load maintenance mode: %w", err)
+	}
+	var m Mode
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Mode{}, fmt.Errorf("failed to unmarshal maintenance mode: %w", err)
+	}
+	return m, nil
+}
+
+func (s *Switch) Set(ctx context.Context, m Mode) error {
+	if m.Enabled && m.Message == "" {
+		m.Message = DefaultMessage
+	}
+	if m.Enabled && m.Since.IsZero() {
+		m.Since = time.Now().UTC()
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance mode: %w", err)
+	}
+	if err := s.rdb.Set(ctx, modeKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save maintenance mode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// All is every migration, in the order they were added. Append new ones with
+// the next version; never renumber or remove an applied migration.
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		// Marks deployments that predate the runner; there is nothing to move
+		Up: func(ctx context.Context, rdb *redis.Client) error { return nil },
+	},
+}
@@ -0,0 +1,112 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	scanBatch   = 500
+	streamBatch = 1000
+)
+
+// escapeGlob quotes the characters SCAN MATCH treats as wildcards.
+func escapeGlob(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(s)
+}
+
+// scanPrefix calls fn for every key starting with prefix.
+func scanPrefix(ctx context.Context, rdb *redis.Client, prefix string, fn func(key string) error) error {
+	iter := rdb.Scan(ctx, 0, escapeGlob(prefix)+"*", scanBatch).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan %s*: %w", prefix, err)
+	}
+	return nil
+}
+
+// RenamePrefix moves every key under oldPrefix to newPrefix, keeping TTLs.
+// A key whose new name already exists is left in place, so re-running
+// after a partial failure never overwrites migrated data.
+func RenamePrefix(ctx context.Context, rdb *redis.Client, oldPrefix, newPrefix string) error {
+	return scanPrefix(ctx, rdb, oldPrefix, func(key string) error {
+		target := newPrefix + strings.TrimPrefix(key, oldPrefix)
+		if err := rdb.RenameNX(ctx, key, target).Err(); err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to rename %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// Reencode rewrites the string value of every key under prefix with fn,
+// keeping TTLs. fn returns nil to leave a value unchanged, e.g. because it
+// is already in the new format.
+func Reencode(ctx context.Context, rdb *redis.Client, prefix string, fn func(key string, value []byte) ([]byte, error)) error {
+	return scanPrefix(ctx, rdb, prefix, func(key string) error {
+		if t, err := rdb.Type(ctx, key).Result(); err != nil || t != "string" {
+			return err
+		}
+		value, err := rdb.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		out, err := fn(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to re-encode %s: %w", key, err)
+		}
+		if out == nil {
+			return nil
+		}
+		if err := rdb.SetArgs(ctx, key, out, redis.SetArgs{KeepTTL: true}).Err(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// MoveStream copies every entry of stream from into stream to, preserving IDs,
+// then deletes from. Consumer groups are not copied; create them on the new
+// stream starting at "0" so pending work is picked up again.
+func MoveStream(ctx context.Context, rdb *redis.Client, from, to string) error {
+	last, err := rdb.XRevRangeN(ctx, to, "+", "-", 1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", to, err)
+	}
+	// Resume after what a previous attempt already copied
+	start := "-"
+	if len(last) > 0 {
+		start = "(" + last[0].ID
+	}
+	for {
+		msgs, err := rdb.XRangeN(ctx, from, start, "+", streamBatch).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", from, err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		pipe := rdb.Pipeline()
+		for _, m := range msgs {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: to, ID: m.ID, Values: m.Values})
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", from, to, err)
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+	if err := rdb.Del(ctx, from).Err(); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", from, err)
+	}
+	return nil
+}
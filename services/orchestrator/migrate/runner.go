@@ -0,0 +1,116 @@
+// Package migrate upgrades data in Redis when key layouts or encodings
+// change. Migrations run in version order at startup, once per deployment:
+// applied versions are recorded in Redis and a lock keeps replicas from
+// running them concurrently.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	appliedKey   = "migrations:applied"
+	lockKey      = "migrations:lock"
+	lockTTL      = 10 * time.Minute
+	lockWaitPoll = 2 * time.Second
+)
+
+// Migration is one storage change. Up must be safe to re-run after a partial
+// failure, since it is retried on the next start.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, rdb *redis.Client) error
+}
+
+type Runner struct {
+	rdb        *redis.Client
+	migrations []Migration
+}
+
+func NewRunner(rdb *redis.Client, migrations []Migration) (*Runner, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			return nil, fmt.Errorf("migration %q needs a positive version and an Up func", m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return &Runner{rdb: rdb, migrations: sorted}, nil
+}
+
+// Applied returns the versions already applied, with when they ran.
+func (r *Runner) Applied(ctx context.Context) (map[int]time.Time, error) {
+	vals, err := r.rdb.HGetAll(ctx, appliedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	out := make(map[int]time.Time, len(vals))
+	for k, v := range vals {
+		version, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, v)
+		out[version] = at
+	}
+	return out, nil
+}
+
+// Run applies pending migrations. If another replica holds the lock it waits
+// for that replica to finish, so no instance serves traffic on old data.
+func (r *Runner) Run(ctx context.Context) error {
+	for {
+		ok, err := r.rdb.SetNX(ctx, lockKey, time.Now().UTC().Format(time.RFC3339), lockTTL).Result()
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		log.Println("Waiting for another instance to finish migrations...")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockWaitPoll):
+		}
+	}
+	defer r.rdb.Del(context.WithoutCancel(ctx), lockKey)
+
+	applied, err := r.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	known := map[int]bool{}
+	for _, m := range r.migrations {
+		known[m.Version] = true
+		if _, done := applied[m.Version]; done {
+			continue
+		}
+		log.Printf("Applying migration %d (%s)", m.Version, m.Name)
+		start := time.Now()
+		if err := m.Up(ctx, r.rdb); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if err := r.rdb.HSet(ctx, appliedKey, strconv.Itoa(m.Version), time.Now().UTC().Format(time.RFC3339)).Err(); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+		log.Printf("Applied migration %d in %s", m.Version, time.Since(start).Round(time.Millisecond))
+	}
+	for v := range applied {
+		if !known[v] {
+			log.Printf("Warning: Redis has migration %d applied, which this build does not know; is this a downgrade?", v)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type MessageContent struct {
 	Type string `json:"type"`
@@ -10,6 +13,41 @@ type MessageContent struct {
 type MessageMetadata struct {
 	Language     string                 `json:"language"`
 	PlatformData map[string]interface{} `json:"platform_data"`
+	// Client describes the web client the message came from.
+	Client *ClientContext `json:"client,omitempty"`
+}
+
+// ClientContext is what a web client's handshake said about it, for
+// personalizing answers and debugging. IP is the client's own address,
+// resolved through trusted proxies; it is not passed to cognitive-core.
+type ClientContext struct {
+	UserAgent      string `json:"user_agent,omitempty"`
+	AcceptLanguage string `json:"accept_language,omitempty"`
+	IP             string `json:"ip,omitempty"`
+	// AppVersion is the host app's version, for widgets embedded in a
+	// native app; WidgetVersion is the widget's own.
+	AppVersion    string `json:"app_version,omitempty"`
+	WidgetVersion string `json:"widget_version,omitempty"`
+}
+
+// PageContext describes what the web user is looking at when they ask.
+type PageContext struct {
+	URL          string `json:"url,omitempty"`
+	Title        string `json:"title,omitempty"`
+	SelectedText string `json:"selected_text,omitempty"`
+}
+
+// Attachment is metadata for a file stored alongside a message. The bytes
+// stay in Redis under attachment:{id}, or in object storage at the location
+// recorded there.
+type Attachment struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Name is the uploaded file's name, if the client gave one.
+	Name string `json:"name,omitempty"`
 }
 
 type MessageEnvelope struct {
@@ -20,11 +58,114 @@ type MessageEnvelope struct {
 	Timestamp time.Time       `json:"timestamp"`
 	Content   MessageContent  `json:"content"`
 	Metadata  MessageMetadata `json:"metadata"`
+
+	// ExternalID is the platform's own ID for the message, such as a
+	// WhatsApp wamid or Telegram "chat:message", kept next to MessageID so
+	// support can trace a platform message to our processing record.
+	ExternalID string `json:"external_id,omitempty"`
+
+	// TenantID identifies the brand or customer deployment the message
+	// belongs to. Empty means the default tenant.
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// ResponseSchema, when set, asks for a structured JSON answer matching
+	// this JSON Schema instead of free text.
+	ResponseSchema json.RawMessage `json:"response_schema,omitempty"`
+
+	// Deadline is when the channel needs a response by. Adapters set it from
+	// platform constraints (e.g. Slack's 3s ack window).
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Probe marks a synthetic health-check message. The orchestrator answers
+	// it from a mock backend without touching sessions or cognitive-core.
+	Probe bool `json:"probe,omitempty"`
+
+	// MergeFrom asks for an earlier session of the same user to be folded
+	// into this one. The channel adapter sets it only once the client has
+	// shown that session is theirs, with its session key (MergeKey) or as
+	// its signed-in owner; its ID alone is not enough.
+	MergeFrom string `json:"merge_from,omitempty"`
+
+	// Agent names the human agent who wrote the message on the agent
+	// console. It is their reply to the user, delivered as it is instead of
+	// being answered.
+	Agent string `json:"agent,omitempty"`
+
+	// Edits is the ID of an earlier message of the user that this one
+	// replaces, with Content.Type "edit", or withdraws, with "delete".
+	Edits string `json:"edits,omitempty"`
+
+	// Command is a slash command the adapter recognized, such as "reset",
+	// with its argument in Content.Text and Content.Type "command". The
+	// orchestrator carries it out instead of answering.
+	Command string `json:"command,omitempty"`
+
+	// PageContext is the page the user was viewing, sent by the web widget.
+	PageContext *PageContext `json:"page_context,omitempty"`
+
+	// TimeZone is the user's IANA time zone, e.g. "Asia/Kathmandu", when the
+	// widget or the channel profile reveals it.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Tags label the message for reporting, e.g. set by operator rules.
+	Tags []string `json:"tags,omitempty"`
+
+	// Stream asks for the answer as delta frames while it is generated,
+	// ahead of the usual message frame.
+	Stream bool `json:"stream,omitempty"`
+
+	// Flow routes the message to a named flow backend, as an operator rule
+	// would; set when an operator re-drives a dead-lettered message.
+	Flow string `json:"flow,omitempty"`
+
+	// Features are the feature flags and experiment variants resolved when
+	// the orchestrator took the message. Once set they are not resolved
+	// again, so every stage sees the same values.
+	Features *Features `json:"features,omitempty"`
+}
+
+// Features lists the flags that are on and the variant of each experiment
+// the session is enrolled in.
+type Features struct {
+	Flags       map[string]bool   `json:"flags,omitempty"`
+	Experiments map[string]string `json:"experiments,omitempty"`
+	ResolvedAt  time.Time         `json:"resolved_at"`
+}
+
+// On reports whether the flag is on; a nil Features has none on.
+func (f *Features) On(flag string) bool {
+	return f != nil && f.Flags[flag]
+}
+
+// Variant is the session's variant of the experiment, or "".
+func (f *Features) Variant(experiment string) string {
+	if f == nil {
+		return ""
+	}
+	return f.Experiments[experiment]
 }
 
 type ConversationMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Topic is the conversation segment the message belongs to.
+	Topic int `json:"topic,omitempty"`
+
+	// The rest is provenance kept with the session for transcripts and
+	// analytics. Prompt drops it before the history goes to cognitive-core.
+	MessageID        string     `json:"message_id,omitempty"`
+	Timestamp        *time.Time `json:"timestamp,omitempty"`
+	ModelUsed        string     `json:"model_used,omitempty"`
+	LatencyMS        int64      `json:"latency_ms,omitempty"`
+	PromptTokens     int        `json:"prompt_tokens,omitempty"`
+	CompletionTokens int        `json:"completion_tokens,omitempty"`
+}
+
+// Prompt is the part of the message the model sees.
+func (m ConversationMessage) Prompt() ConversationMessage {
+	return ConversationMessage{Role: m.Role, Content: m.Content, Topic: m.Topic}
 }
 
 type ChatRequest struct {
@@ -33,6 +174,41 @@ type ChatRequest struct {
 	ConversationHistory []ConversationMessage `json:"conversation_history"`
 	Channel             string                `json:"channel"`
 	Language            string                `json:"language"`
+	ResponseSchema      json.RawMessage       `json:"response_schema,omitempty"`
+	Fast                bool                  `json:"fast,omitempty"`
+	// SessionSummary recaps earlier topics whose turns are not in
+	// ConversationHistory.
+	SessionSummary string       `json:"session_summary,omitempty"`
+	PageContext    *PageContext `json:"page_context,omitempty"`
+	// Tone and MaxSentences are style hints for the tenant and channel.
+	Tone         string `json:"tone,omitempty"`
+	MaxSentences int    `json:"max_sentences,omitempty"`
+	// Decompose answers each question of a compound message separately.
+	Decompose bool `json:"decompose,omitempty"`
+	// Attachments are the images and documents the user uploaded with the
+	// message.
+	Attachments []ChatAttachment `json:"attachments,omitempty"`
+	// TimeZone is the user's IANA zone and LocalTime the time there when
+	// the message arrived (RFC 3339), for "tomorrow" or "at 9am".
+	TimeZone  string `json:"time_zone,omitempty"`
+	LocalTime string `json:"local_time,omitempty"`
+	// OperatorNotes are notes support agents shared with the assistant as
+	// background; they must not be quoted to the user.
+	OperatorNotes []string `json:"operator_notes,omitempty"`
+	// Features are the flags and experiment variants stamped on the message
+	// at ingestion.
+	Features *Features `json:"features,omitempty"`
+	// Client is the web client's context, without its IP.
+	Client *ClientContext `json:"client,omitempty"`
+}
+
+// ChatAttachment is an uploaded file for cognitive-core to read; Data is
+// base64-encoded in JSON.
+type ChatAttachment struct {
+	Name        string `json:"name,omitempty"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
 }
 
 type ChatResponse struct {
@@ -40,10 +216,115 @@ type ChatResponse struct {
 	Response  string   `json:"response"`
 	Sources   []string `json:"sources"`
 	ModelUsed string   `json:"model_used"`
+
+	Structured json.RawMessage `json:"structured,omitempty"`
+	Usage      *Usage          `json:"usage,omitempty"`
+
+	// Backend identifies which cognitive-core deployment produced the response.
+	Backend string `json:"backend,omitempty"`
+}
+
+// Usage is the model tokens an answer took, when cognitive-core reports it.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 type WSResponse struct {
-	Type      string `json:"type"`
-	Text      string `json:"text,omitempty"`
-	SessionID string `json:"session_id,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Rich      *RichContent    `json:"rich,omitempty"`
+	// Role is "agent" on messages a human agent wrote, with Agent naming
+	// them; it is omitted on the assistant's own.
+	Role  string `json:"role,omitempty"`
+	Agent string `json:"agent,omitempty"`
+	// Corrects is set on correction frames: the ID of the delivered answer
+	// whose text they replace.
+	Corrects string `json:"corrects,omitempty"`
+	// RetryAfterMS is set on rate_limited frames: how long to wait before
+	// sending again.
+	RetryAfterMS int64 `json:"retry_after_ms,omitempty"`
+
+	// Part and Parts number the frames of an answer that was split because
+	// it was too long for one message. Both are omitted for a single frame.
+	Part  int `json:"part,omitempty"`
+	Parts int `json:"parts,omitempty"`
+
+	// Usage is set on the message frame of a streamed answer: the tokens it
+	// took, when the model reports them.
+	Usage *Usage `json:"usage,omitempty"`
+	// Backend is set on generated answers: the cognitive-core deployment
+	// and version that produced them, e.g. "canary@1.4.0".
+	Backend string `json:"backend,omitempty"`
+
+	// Instance and Reconnect are only set on connected frames: the adapter
+	// replica holding the connection, and how to get back to it. Returning
+	// says the session already has a conversation, so the widget skips its
+	// greeting.
+	Instance  string         `json:"instance,omitempty"`
+	Reconnect *ReconnectHint `json:"reconnect,omitempty"`
+	Returning bool           `json:"returning,omitempty"`
+
+	// Connection identifies a web connection: the receiving one on
+	// connected frames, the sending one on user_message frames.
+	Connection string `json:"connection,omitempty"`
+
+	// Protocol is set on connected frames: the web protocol version the
+	// connection is served.
+	Protocol int `json:"protocol,omitempty"`
+
+	// SessionKey is set on the connected frame of a new web session. The
+	// client must present it to reconnect to the session or post to it.
+	SessionKey string `json:"session_key,omitempty"`
+
+	// Seq numbers the frames of a web session that are kept for replay,
+	// from 1 and without gaps, so a client can tell when it missed one.
+	Seq int64 `json:"seq,omitempty"`
+
+	// ResumeToken marks the frame's place in a web session's replay buffer.
+	// A client that reconnects with the latest token it saw is sent the
+	// frames it missed.
+	ResumeToken string `json:"resume_token,omitempty"`
+}
+
+// RichContent is the channel-neutral form of what an answer shows besides
+// its text. Each channel renders what it supports and degrades the rest to
+// text.
+type RichContent struct {
+	Buttons   []Button   `json:"buttons,omitempty"`
+	Images    []Image    `json:"images,omitempty"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Button is a suggested reply that sends Value when tapped, or a link when
+// URL is set.
+type Button struct {
+	Text  string `json:"text"`
+	Value string `json:"value,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+type Image struct {
+	URL string `json:"url"`
+	Alt string `json:"alt,omitempty"`
+}
+
+// Citation is a document the answer was drawn from. URL is only set for
+// sources that can be opened.
+type Citation struct {
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+}
+
+// ReconnectHint tells clients and load balancers how to return a session to
+// the same adapter replica. Either add Query to the WebSocket URL or let the
+// load balancer route on Cookie, which is set on the handshake response.
+type ReconnectHint struct {
+	Instance        string `json:"instance"`
+	Query           string `json:"query"`
+	Cookie          string `json:"cookie"`
+	ValidForSeconds int    `json:"valid_for_seconds"`
 }
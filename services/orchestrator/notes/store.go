@@ -0,0 +1,153 @@
+// Package notes keeps operators' private notes on sessions, such as what an
+// agent promised before handing a conversation back. Notes are shown in the
+// console and transcript exports; only notes marked Shared reach
+// cognitive-core, and none are ever sent to the user.
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	notesPrefix   = "notes:"
+	maxNoteRunes  = 2000
+	maxNotesKept  = 100
+	maxSharedSent = 10
+)
+
+// Retention is how long a session's notes outlive the last one added.
+var Retention = 90 * 24 * time.Hour
+
+var (
+	ErrNotFound  = errors.New("unknown note")
+	ErrEmpty     = errors.New("note text is required")
+	ErrTooMany   = errors.New("session has too many notes")
+	ErrForbidden = errors.New("note belongs to another operator")
+)
+
+// Note is one operator note. Shared notes are given to the assistant as
+// background for its answers.
+type Note struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	Shared    bool      `json:"share_with_assistant"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps each session's notes in one hash keyed by note ID.
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+// Add records a note by author on the session.
+func (s *Store) Add(ctx context.Context, sessionID, author, text string, shared bool) (*Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmpty
+	}
+	if r := []rune(text); len(r) > maxNoteRunes {
+		text = string(r[:maxNoteRunes])
+	}
+	key := notesPrefix + sessionID
+	n, err := s.rdb.HLen(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count notes: %w", err)
+	}
+	if n >= maxNotesKept {
+		return nil, ErrTooMany
+	}
+	note := Note{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Author:    author,
+		Text:      text,
+		Shared:    shared,
+		CreatedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(note)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal note: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, note.ID, data)
+	pipe.Expire(ctx, key, Retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store note: %w", err)
+	}
+	return &note, nil
+}
+
+// List returns the session's notes, oldest first.
+func (s *Store) List(ctx context.Context, sessionID string) ([]Note, error) {
+	raw, err := s.rdb.HVals(ctx, notesPrefix+sessionID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notes: %w", err)
+	}
+	out := make([]Note, 0, len(raw))
+	for _, r := range raw {
+		var n Note
+		if err := json.Unmarshal([]byte(r), &n); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal note: %w", err)
+		}
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Shared returns the text of the session's most recent shared notes, oldest
+// first, for cognitive-core.
+func (s *Store) Shared(ctx context.Context, sessionID string) ([]string, error) {
+	all, err := s.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, n := range all {
+		if n.Shared {
+			out = append(out, n.Text)
+		}
+	}
+	if len(out) > maxSharedSent {
+		out = out[len(out)-maxSharedSent:]
+	}
+	return out, nil
+}
+
+// Delete removes a note. Only its author may delete it, unless author is "".
+func (s *Store) Delete(ctx context.Context, sessionID, id, author string) error {
+	key := notesPrefix + sessionID
+	data, err := s.rdb.HGet(ctx, key, id).Bytes()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load note: %w", err)
+	}
+	var n Note
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("failed to unmarshal note: %w", err)
+	}
+	if author != "" && n.Author != author {
+		return ErrForbidden
+	}
+	if err := s.rdb.HDel(ctx, key, id).Err(); err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package override holds editorially approved answers that are returned
+// verbatim instead of an LLM generation, e.g. for legal or pricing questions.
+package override
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/textnorm"
+)
+
+const (
+	overridesKey = "overrides"
+	// versionKey is bumped on every change, so replicas know when their
+	// cached overrides are stale
+	versionKey = "overrides:version"
+	// putAttempts bounds retries of an edit that raced another one
+	putAttempts = 5
+)
+
+// Version is one approved wording of an answer. Versions are never edited;
+// a change adds a new version, optionally scheduled for a future date.
+type Version struct {
+	Version        int        `json:"version"`
+	Answer         string     `json:"answer"`
+	EffectiveFrom  time.Time  `json:"effective_from"`
+	EffectiveUntil *time.Time `json:"effective_until,omitempty"`
+	Author         string     `json:"author,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Override pins an answer for any message containing one of its questions.
+type Override struct {
+	ID        string    `json:"id"`
+	Intent    string    `json:"intent"`
+	Questions []string  `json:"questions"`
+	Versions  []Version `json:"versions"`
+}
+
+// Active returns the newest version in effect at t, or nil.
+func (o *Override) Active(t time.Time) *Version {
+	for i := len(o.Versions) - 1; i >= 0; i-- {
+		v := &o.Versions[i]
+		if v.EffectiveFrom.After(t) {
+			continue
+		}
+		if v.EffectiveUntil != nil && !t.Before(*v.EffectiveUntil) {
+			continue
+		}
+		return v
+	}
+	return nil
+}
+
+// Store keeps overrides in a single Redis hash so every replica sees edits
+// immediately. Match works from a cached copy that is reloaded when the
+// version counter moves, so a lookup is one small read.
+type Store struct {
+	rdb *redis.Client
+
+	mu            sync.Mutex
+	cached        []Override
+	cachedVersion int64
+	loaded        bool
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+func (s *Store) List(ctx context.Context) ([]Override, error) {
+	raw, err := s.rdb.HGetAll(ctx, overridesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overrides: %w", err)
+	}
+	out := make([]Override, 0, len(raw))
+	for id, data := range raw {
+		var o Override
+		if err := json.Unmarshal([]byte(data), &o); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal override %s: %w", id, err)
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// Get returns nil if the override does not exist.
+func (s *Store) Get(ctx context.Context, id string) (*Override, error) {
+	data, err := s.rdb.HGet(ctx, overridesKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load override: %w", err)
+	}
+	var o Override
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal override: %w", err)
+	}
+	return &o, nil
+}
+
+// Put creates the override or updates its questions, and appends v as the
+// next version. A zero EffectiveFrom means effective immediately. Concurrent
+// edits of the same override each get a version of their own.
+func (s *Store) Put(ctx context.Context, id, intent string, questions []string, v Version) (*Override, error) {
+	var o *Override
+	put := func(tx *redis.Tx) error {
+		o = &Override{ID: id}
+		data, err := tx.HGet(ctx, overridesKey, id).Bytes()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to load override: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, o); err != nil {
+				return fmt.Errorf("failed to unmarshal override: %w", err)
+			}
+		}
+		if intent != "" {
+			o.Intent = intent
+		}
+		if len(questions) > 0 {
+			o.Questions = questions
+		}
+
+		now := time.Now().UTC()
+		next := v
+		next.Version = len(o.Versions) + 1
+		next.CreatedAt = now
+		if next.EffectiveFrom.IsZero() {
+			next.EffectiveFrom = now
+		}
+		o.Versions = append(o.Versions, next)
+
+		if data, err = json.Marshal(o); err != nil {
+			return fmt.Errorf("failed to marshal override: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, overridesKey, id, data)
+			pipe.Incr(ctx, versionKey)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < putAttempts; i++ {
+		err := s.rdb.Watch(ctx, put, overridesKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save override: %w", err)
+		}
+		return o, nil
+	}
+	return nil, fmt.Errorf("failed to save override: too many concurrent edits")
+}
+
+func (s *Store) Delete(ctx context.Context, id string) (bool, error) {
+	pipe := s.rdb.TxPipeline()
+	del := pipe.HDel(ctx, overridesKey, id)
+	pipe.Incr(ctx, versionKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to delete override: %w", err)
+	}
+	return del.Val() > 0, nil
+}
+
+// current returns the overrides, reloading them only when they changed
+// since the last load.
+func (s *Store) current(ctx context.Context) ([]Override, error) {
+	version, err := s.rdb.Get(ctx, versionKey).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load overrides version: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded && s.cachedVersion == version {
+		return s.cached, nil
+	}
+	all, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cached, s.cachedVersion, s.loaded = all, version, true
+	return all, nil
+}
+
+// Match finds the override whose question appears in text, preferring the
+// longest (most specific) question, and returns its version in effect at t.
+func (s *Store) Match(ctx context.Context, text string, t time.Time) (*Override, *Version, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+	all, err := s.current(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg := " " + textnorm.Normalize(text) + " "
+	var best *Override
+	var bestVersion *Version
+	bestLen := 0
+	for i := range all {
+		o := &all[i]
+		v := o.Active(t)
+		if v == nil {
+			continue
+		}
+		for _, q := range o.Questions {
+			nq := textnorm.Normalize(q)
+			if nq == "" || len(nq) <= bestLen {
+				continue
+			}
+			if strings.Contains(msg, " "+nq+" ") {
+				best, bestVersion, bestLen = o, v, len(nq)
+			}
+		}
+	}
+	return best, bestVersion, nil
+}
@@ -0,0 +1,185 @@
+// Package policy enforces per-tenant banned topics before a message reaches
+// cognitive-core. It is deliberately independent of the model's own
+// guardrails: classification is a local keyword match, so a refusal is
+// deterministic, cheap and auditable.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/textnorm"
+)
+
+const (
+	DefaultTenant = "default"
+
+	eventsStream = "policy:events"
+	eventsMaxLen = 10000
+)
+
+var refusalsTotal = metrics.NewCounterVec("orchestrator_policy_refusals_total",
+	"Messages refused by topic policy, by tenant and topic.", "tenant", "topic")
+
+type Topic struct {
+	// Keywords are words or phrases, matched on whole words of the
+	// normalized message.
+	Keywords []string `json:"keywords"`
+	// Refusal is a text/template rendered with .Topic and .Tenant.
+	Refusal string `json:"refusal"`
+}
+
+// DefaultTopics can be banned by name without defining them in the config;
+// none is banned unless a tenant lists it. They match phrases that ask for
+// advice about the user's own health or legal matters, not single words, so
+// that questions about curing meat or a medicine-free diet still go through.
+var DefaultTopics = map[string]Topic{
+	"medical": {
+		Keywords: []string{"medical advice", "diagnose me", "diagnose my", "my diagnosis", "my symptoms", "prescribe me", "my prescription", "my medication", "my medicine", "what dosage should", "what dose should i", "should i stop taking", "can i stop taking", "side effects of my", "treatment for my", "मेरो औषधि", "मेरो रोग"},
+		Refusal:  "I can't give medical advice. For questions about a health condition or medication, please consult a doctor. I'm happy to help with Mandala Foods products and their nutrition facts.",
+	},
+	"legal": {
+		Keywords: []string{"legal advice", "my lawyer", "hire a lawyer", "my attorney", "file a lawsuit", "can i sue", "should i sue", "take them to court", "contract dispute", "कानुनी सल्लाह", "मुद्दा हाल्ने"},
+		Refusal:  "I can't give legal advice. Please consult a qualified lawyer. I'm happy to help with questions about Mandala Foods products.",
+	},
+	"political": {
+		Keywords: []string{"the election", "vote for", "political party", "prime minister", "parliament", "politician", "चुनाव", "राजनीति"},
+		Refusal:  "I don't discuss politics. I'm happy to help with questions about Mandala Foods products.",
+	},
+}
+
+// Config is the TOPIC_POLICIES file. Tenants map a tenant ID to the topic
+// names it bans; tenants not listed fall back to "default". A listed
+// tenant bans only the topics it names, so [] bans nothing.
+type Config struct {
+	Topics  map[string]Topic    `json:"topics"`
+	Tenants map[string][]string `json:"tenants"`
+}
+
+type compiledTopic struct {
+	name     string
+	keywords []string
+	refusal  *template.Template
+}
+
+// Decision describes why a message was refused.
+type Decision struct {
+	Topic   string
+	Keyword string
+	Refusal string
+}
+
+type Engine struct {
+	rdb     *redis.Client
+	tenants map[string][]compiledTopic
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policies: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %w", err)
+	}
+	return &cfg, nil
+}
+
+func NewEngine(rdb *redis.Client, cfg Config) (*Engine, error) {
+	topics := make(map[string]Topic, len(DefaultTopics)+len(cfg.Topics))
+	for k, v := range DefaultTopics {
+		topics[k] = v
+	}
+	for k, v := range cfg.Topics {
+		topics[k] = v
+	}
+
+	e := &Engine{rdb: rdb, tenants: make(map[string][]compiledTopic)}
+	for tenant, names := range cfg.Tenants {
+		e.tenants[tenant] = []compiledTopic{}
+		for _, name := range names {
+			t, ok := topics[name]
+			if !ok {
+				return nil, fmt.Errorf("tenant %s bans unknown topic %q", tenant, name)
+			}
+			tmpl, err := template.New(name).Option("missingkey=zero").Parse(t.Refusal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid refusal for %s: %w", name, err)
+			}
+			ct := compiledTopic{name: name, refusal: tmpl}
+			for _, kw := range t.Keywords {
+				if n := textnorm.Normalize(kw); n != "" {
+					ct.keywords = append(ct.keywords, n)
+				}
+			}
+			e.tenants[tenant] = append(e.tenants[tenant], ct)
+		}
+	}
+	return e, nil
+}
+
+// Check classifies text against the tenant's banned topics. It returns nil
+// when the message may proceed.
+func (e *Engine) Check(tenant, text string) *Decision {
+	if e == nil {
+		return nil
+	}
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	topics, ok := e.tenants[tenant]
+	if !ok {
+		topics = e.tenants[DefaultTenant]
+	}
+
+	msg := " " + textnorm.Normalize(text) + " "
+	for _, t := range topics {
+		for _, kw := range t.keywords {
+			if !strings.Contains(msg, " "+kw+" ") {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := t.refusal.Execute(&buf, map[string]string{"Topic": t.name, "Tenant": tenant}); err != nil {
+				buf.Reset()
+				buf.WriteString("Sorry, I can't help with that topic.")
+			}
+			return &Decision{Topic: t.name, Keyword: kw, Refusal: buf.String()}
+		}
+	}
+	return nil
+}
+
+// Record logs a refusal to the policy:events stream for audit.
+func (e *Engine) Record(ctx context.Context, tenant, sessionID, messageID string, d *Decision) error {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	refusalsTotal.Inc(tenant, d.Topic)
+	err := e.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStream,
+		MaxLen: eventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"tenant":     tenant,
+			"session_id": sessionID,
+			"message_id": messageID,
+			"topic":      d.Topic,
+			"keyword":    d.Keyword,
+			"timestamp":  time.Now().UTC().Format(time.RFC3339),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to record policy event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package presence reads the registry of open web connections that the
+// channel adapter keeps, to tell which sessions have a user on them right
+// now and on which adapter replica, for proactive messages and handoffs.
+package presence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Written by the channel adapter, which refreshes each connection's entry
+// while it is open; keep the field layout in sync.
+const (
+	connPrefix    = "presence:conn:"
+	sessionPrefix = "presence:session:"
+	onlineKey     = "presence:online"
+	entryTTL      = 90 * time.Second
+)
+
+// Connection is one open web connection.
+type Connection struct {
+	ID          string    `json:"id"`
+	Instance    string    `json:"instance"`
+	Transport   string    `json:"transport"`
+	UserID      string    `json:"user_id"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Session is a session with at least one open connection.
+type Session struct {
+	SessionID   string       `json:"session_id"`
+	Connections []Connection `json:"connections"`
+}
+
+type Registry struct {
+	rdb *redis.Client
+}
+
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{rdb: rdb}
+}
+
+// Online lists up to limit sessions that are online, most recently active
+// first.
+func (r *Registry) Online(ctx context.Context, limit int) ([]Session, error) {
+	cutoff := time.Now().Add(-entryTTL).UnixMilli()
+	// Sessions whose entries have all expired; their replica died or they
+	// closed without another connection
+	if err := r.rdb.ZRemRangeByScore(ctx, onlineKey, "-inf", "("+strconv.FormatInt(cutoff, 10)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to prune presence: %w", err)
+	}
+	// Sessions may turn out to be offline, so read more than asked for
+	ids, err := r.rdb.ZRevRange(ctx, onlineKey, 0, int64(2*limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list online sessions: %w", err)
+	}
+	out := []Session{}
+	for _, id := range ids {
+		if len(out) == limit {
+			break
+		}
+		s, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			out = append(out, *s)
+		}
+	}
+	return out, nil
+}
+
+// Get returns the session's open connections, oldest first, or nil when it
+// has none.
+func (r *Registry) Get(ctx context.Context, sessionID string) (*Session, error) {
+	key := sessionPrefix + sessionID
+	ids, err := r.rdb.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load connections: %w", err)
+	}
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, connPrefix+id)
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to load connections: %w", err)
+		}
+	}
+	s := Session{SessionID: sessionID}
+	var gone []interface{}
+	for i, cmd := range cmds {
+		f := cmd.Val()
+		if len(f) == 0 {
+			gone = append(gone, ids[i])
+			continue
+		}
+		s.Connections = append(s.Connections, Connection{
+			ID:          ids[i],
+			Instance:    f["instance"],
+			Transport:   f["transport"],
+			UserID:      f["user_id"],
+			ConnectedAt: unixMilli(f["connected_at"]),
+			LastSeen:    unixMilli(f["seen"]),
+		})
+	}
+	if len(gone) > 0 {
+		r.rdb.SRem(ctx, key, gone...)
+	}
+	if len(s.Connections) == 0 {
+		r.rdb.ZRem(ctx, onlineKey, sessionID)
+		return nil, nil
+	}
+	sort.Slice(s.Connections, func(i, j int) bool {
+		return s.Connections[i].ConnectedAt.Before(s.Connections[j].ConnectedAt)
+	})
+	return &s, nil
+}
+
+func unixMilli(v string) time.Time {
+	ms, _ := strconv.ParseInt(v, 10, 64)
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,231 @@
+// Package region implements active/passive multi-region operation.
+//
+// Each region runs a full stack against its own Redis. Exactly one region is
+// active: it consumes msg:inbound, writes session state locally and
+// replicates those writes asynchronously to the standby region's Redis. The
+// standby keeps its consumer idle until it receives a promotion signal.
+//
+// Consistency trade-offs:
+//
+//   - Replication is asynchronous, so a promotion can lose the writes still in
+//     flight (RPO is the replication lag, typically well under a second). A
+//     lost write costs at most the last turn of a conversation.
+//   - Promotion takes a fencing epoch above both regions' and records it in
+//     both Redis instances, or in the peer's on the next replicated write if
+//     the peer can't be reached. Every replicated write carries the writer's
+//     epoch and is rejected if the target has seen a newer one, so a
+//     partitioned former primary cannot overwrite state written after
+//     failover. The same check fences local writes, and a region whose writes
+//     are rejected demotes itself.
+//   - Nothing here elects a leader automatically: promotion is an explicit
+//     operator (or external health checker) decision, which avoids split
+//     brain at the cost of manual failover.
+package region
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/redisconn"
+)
+
+const (
+	epochKey      = "region:epoch"
+	activeKey     = "region:active"
+	promoteSignal = "region:promote"
+
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+)
+
+// fencedSet writes KEYS[1] only if the fencing epoch stored at KEYS[2] is not
+// newer than ARGV[3], and raises the stored epoch to ARGV[3]. Returns 1 on
+// success, 0 if fenced.
+var fencedSet = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[2]) or '0')
+if current > tonumber(ARGV[3]) then
+	return 0
+end
+if current < tonumber(ARGV[3]) then
+	redis.call('SET', KEYS[2], ARGV[3])
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// raiseEpoch sets the epoch at KEYS[1] to ARGV[1] unless it is already at
+// least that. Returns the epoch stored afterwards.
+var raiseEpoch = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+	return tonumber(ARGV[1])
+end
+return current
+`)
+
+// ErrFenced is returned when a write carries a stale epoch.
+var ErrFenced = fmt.Errorf("write rejected: a newer region epoch is active")
+
+// Coordinator tracks this region's role and fencing epoch.
+type Coordinator struct {
+	rdb    *redis.Client
+	peer   *redis.Client
+	name   string
+	active atomic.Bool
+	epoch  atomic.Int64
+}
+
+func NewCoordinator(rdb *redis.Client, name, role string) *Coordinator {
+	c := &Coordinator{rdb: rdb, name: name}
+	c.active.Store(role != RoleStandby)
+	return c
+}
+
+// EnablePeer lets promotion read and record the fencing epoch in the peer
+// region's Redis.
+func (c *Coordinator) EnablePeer(peer *redis.Client) {
+	c.peer = peer
+}
+
+// Init loads the current epoch. A primary that finds another region recorded
+// as active, or the peer region on a newer epoch, starts as standby rather
+// than fighting over it.
+func (c *Coordinator) Init(ctx context.Context) error {
+	epoch, err := c.rdb.Get(ctx, epochKey).Int64()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to load region epoch: %w", err)
+	}
+	c.epoch.Store(epoch)
+	if peerEpoch, ok := c.peerEpoch(ctx); ok && peerEpoch > epoch {
+		c.active.Store(false)
+	}
+
+	owner, err := c.rdb.Get(ctx, activeKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to load active region: %w", err)
+	}
+	if owner == "" && c.active.Load() {
+		if err := c.rdb.Set(ctx, activeKey, c.name, 0).Err(); err != nil {
+			return fmt.Errorf("failed to record active region: %w", err)
+		}
+	} else if owner != "" && owner != c.name {
+		c.active.Store(false)
+	}
+	log.Printf("Region %s starting as %s (epoch %d)", c.name, c.Role(), epoch)
+	return nil
+}
+
+func (c *Coordinator) Name() string { return c.name }
+
+func (c *Coordinator) Epoch() int64 { return c.epoch.Load() }
+
+func (c *Coordinator) IsActive() bool { return c.active.Load() }
+
+func (c *Coordinator) Role() string {
+	if c.IsActive() {
+		return RolePrimary
+	}
+	return RoleStandby
+}
+
+// Promote makes this region active under a new fencing epoch, above both
+// regions' current ones.
+func (c *Coordinator) Promote(ctx context.Context) (int64, error) {
+	local, err := c.rdb.Get(ctx, epochKey).Int64()
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to load region epoch: %w", err)
+	}
+	epoch := max(local, c.Epoch())
+	if peerEpoch, ok := c.peerEpoch(ctx); ok {
+		epoch = max(epoch, peerEpoch)
+	}
+	epoch++
+	stored, err := raiseEpoch.Run(ctx, c.rdb, []string{epochKey}, epoch).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump region epoch: %w", err)
+	}
+	if stored != epoch {
+		return 0, fmt.Errorf("region epoch moved to %d during promotion", stored)
+	}
+	if c.peer != nil {
+		// Otherwise the first replicated write raises it
+		if err := raiseEpoch.Run(ctx, c.peer, []string{epochKey}, epoch).Err(); err != nil {
+			log.Printf("Failed to record epoch %d in the peer region: %v", epoch, err)
+		}
+	}
+	if err := c.rdb.Set(ctx, activeKey, c.name, 0).Err(); err != nil {
+		return 0, fmt.Errorf("failed to record active region: %w", err)
+	}
+	c.epoch.Store(epoch)
+	c.active.Store(true)
+	log.Printf("Region %s promoted to primary (epoch %d)", c.name, epoch)
+	return epoch, nil
+}
+
+// peerEpoch reads the peer region's fencing epoch, if there is a peer and it
+// can be reached.
+func (c *Coordinator) peerEpoch(ctx context.Context) (int64, bool) {
+	if c.peer == nil {
+		return 0, false
+	}
+	epoch, err := c.peer.Get(ctx, epochKey).Int64()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to load the peer region's epoch: %v", err)
+		return 0, false
+	}
+	return epoch, true
+}
+
+// Demote stops this region from processing, e.g. after it has been fenced.
+func (c *Coordinator) Demote(reason string) {
+	if c.active.Swap(false) {
+		log.Printf("Region %s demoted to standby: %s", c.name, reason)
+	}
+}
+
+// WatchPromotion promotes this region when its name is published on the
+// region:promote channel, so an external failover controller can trigger it.
+func (c *Coordinator) WatchPromotion(ctx context.Context) {
+	pubsub := c.rdb.Subscribe(ctx, promoteSignal)
+	defer pubsub.Close()
+	ch := redisconn.Channel(pubsub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload != c.name || c.IsActive() {
+				continue
+			}
+			if _, err := c.Promote(ctx); err != nil {
+				log.Printf("Promotion failed: %v", err)
+			}
+		}
+	}
+}
+
+// FencedSet writes key=value on rdb unless rdb has seen a newer epoch than
+// this region's. ttlMs of 0 means no expiry.
+func (c *Coordinator) FencedSet(ctx context.Context, rdb *redis.Client, key string, value []byte, ttlMs int64) error {
+	ok, err := fencedSet.Run(ctx, rdb, []string{key, epochKey}, value, strconv.FormatInt(ttlMs, 10), c.Epoch()).Int()
+	if err != nil {
+		return fmt.Errorf("fenced write failed: %w", err)
+	}
+	if ok == 0 {
+		return ErrFenced
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package region
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+const replicationQueue = 10000
+
+var (
+	replicatedTotal = metrics.NewCounterVec("orchestrator_region_replicated_total",
+		"Session writes replicated to the standby region by outcome.", "outcome")
+	replicationLag = metrics.NewGaugeVec("orchestrator_region_replication_lag_seconds",
+		"Age of the most recently replicated write when it was applied.")
+)
+
+type write struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+	at    time.Time
+}
+
+// Replicator asynchronously copies session writes to the peer region's
+// Redis. Writes are applied with the fencing check, so once the peer has been
+// promoted our stale writes are rejected and this region demotes itself.
+type Replicator struct {
+	coord *Coordinator
+	peer  *redis.Client
+	queue chan write
+}
+
+func NewReplicator(coord *Coordinator, peer *redis.Client) *Replicator {
+	return &Replicator{coord: coord, peer: peer, queue: make(chan write, replicationQueue)}
+}
+
+// Replicate enqueues a write. It never blocks; if the queue is full the write
+// is dropped and the standby will be behind until the key is written again.
+func (r *Replicator) Replicate(key string, value []byte, ttl time.Duration) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.queue <- write{key: key, value: value, ttl: ttl, at: time.Now()}:
+	default:
+		replicatedTotal.Inc("dropped")
+	}
+}
+
+func (r *Replicator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case w := <-r.queue:
+			err := r.coord.FencedSet(ctx, r.peer, w.key, w.value, w.ttl.Milliseconds())
+			switch {
+			case errors.Is(err, ErrFenced):
+				replicatedTotal.Inc("fenced")
+				r.coord.Demote("peer region has a newer epoch")
+			case err != nil:
+				replicatedTotal.Inc("error")
+				log.Printf("Replication of %s failed: %v", w.key, err)
+			default:
+				replicatedTotal.Inc("ok")
+				replicationLag.Set(time.Since(w.at).Seconds())
+			}
+		}
+	}
+}
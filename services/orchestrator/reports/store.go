@@ -0,0 +1,285 @@
+// Package reports keeps answers users flagged as harmful or wrong, together
+// with the conversation that led to them, and alerts operators so they can
+// review each one.
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/archive"
+	"orchestrator/evaluation"
+	"orchestrator/metrics"
+)
+
+// ConsumerName identifies this replica in the reports consumer group; main
+// sets it to the replica's CONSUMER_NAME.
+var ConsumerName = "orchestrator-1"
+
+const (
+	reportsStream = "msg:reports"
+	reportsGroup  = "orchestrator-reports"
+	reportPrefix  = "report:"
+	// One report per answer and session; more taps are not new information
+	dedupePrefix = "report:dedupe:"
+	// Sorted by report time for listing
+	indexKey     = "reports"
+	alertsStream = "ops:alerts"
+	// Turns of the conversation kept with a report, up to the answer
+	contextTurns    = 10
+	maxCommentRunes = 1000
+)
+
+// Retention is how long reports are kept.
+var Retention = 180 * 24 * time.Hour
+
+// Reasons users can give.
+var Reasons = []string{"harmful", "wrong", "offensive", "other"}
+
+var (
+	ErrNotFound      = errors.New("unknown report")
+	ErrUnknownAnswer = errors.New("reported answer is not in the transcript")
+	ErrDuplicate     = errors.New("answer was already reported")
+)
+
+var reportsTotal = metrics.NewCounterVec("orchestrator_abuse_reports_total",
+	"Answers reported by users, by reason.", "reason")
+
+// Report is an answer a user flagged. Question, Answer and Context are copied
+// from the transcript when the report is filed, so it survives retention and
+// later edits of the conversation.
+type Report struct {
+	ID         string         `json:"id"`
+	MessageID  string         `json:"message_id"`
+	SessionID  string         `json:"session_id"`
+	TenantID   string         `json:"tenant_id,omitempty"`
+	Channel    string         `json:"channel"`
+	UserID     string         `json:"user_id,omitempty"`
+	Reason     string         `json:"reason"`
+	Comment    string         `json:"comment,omitempty"`
+	Question   string         `json:"question"`
+	Answer     string         `json:"answer"`
+	Context    []archive.Turn `json:"context"`
+	ReportedAt time.Time      `json:"reported_at"`
+}
+
+// Summary is a report without the conversation, for listing.
+type Summary struct {
+	ID         string    `json:"id"`
+	MessageID  string    `json:"message_id"`
+	SessionID  string    `json:"session_id"`
+	Channel    string    `json:"channel"`
+	Reason     string    `json:"reason"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+type Store struct {
+	rdb       *redis.Client
+	archive   *archive.Store
+	evaluator *evaluation.Evaluator
+}
+
+func NewStore(rdb *redis.Client, archive *archive.Store) *Store {
+	return &Store{rdb: rdb, archive: archive}
+}
+
+// EnableEvaluation has every reported answer scored by ev, whatever its
+// sample rate.
+func (s *Store) EnableEvaluation(ev *evaluation.Evaluator) {
+	s.evaluator = ev
+}
+
+// NormalizeReason maps what the user sent to one of Reasons.
+func NormalizeReason(reason string) string {
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	for _, r := range Reasons {
+		if r == reason {
+			return r
+		}
+	}
+	return "other"
+}
+
+// File records a report. An empty MessageID reports the session's latest
+// answer. Only MessageID, SessionID, TenantID, Channel, UserID, Reason and
+// Comment are taken from r; the rest is filled in from the transcript.
+func (s *Store) File(ctx context.Context, r Report) (*Report, error) {
+	// Later parts of a split answer carry a ".N" suffix
+	r.MessageID, _, _ = strings.Cut(r.MessageID, ".")
+	turns, err := s.archive.Load(ctx, r.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	end := -1
+	for i := len(turns) - 1; i >= 0; i-- {
+		t := turns[i]
+		if t.Role == "assistant" && (r.MessageID == "" || t.MessageID == r.MessageID) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, ErrUnknownAnswer
+	}
+	answer := turns[end]
+	r.MessageID, r.Answer = answer.MessageID, answer.Content
+	// The answer shares its message ID with the question it answered
+	for i := end; i >= 0; i-- {
+		if turns[i].Role == "user" && turns[i].MessageID == answer.MessageID {
+			r.Question = turns[i].Content
+			break
+		}
+	}
+	r.Context = turns[max(0, end+1-contextTurns) : end+1]
+	r.Reason = NormalizeReason(r.Reason)
+	r.Comment = strings.TrimSpace(r.Comment)
+	if c := []rune(r.Comment); len(c) > maxCommentRunes {
+		r.Comment = string(c[:maxCommentRunes])
+	}
+	if r.Channel == "" {
+		r.Channel = answer.Channel
+	}
+
+	fresh, err := s.rdb.SetNX(ctx, dedupePrefix+r.SessionID+":"+r.MessageID, 1, Retention).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record report: %w", err)
+	}
+	if !fresh {
+		return nil, ErrDuplicate
+	}
+
+	r.ID = uuid.New().String()
+	r.ReportedAt = time.Now().UTC()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, reportPrefix+r.ID, data, Retention)
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(r.ReportedAt.Unix()), Member: r.ID})
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: alertsStream,
+		MaxLen: 10000,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":       "abuse_report",
+			"report_id":  r.ID,
+			"session_id": r.SessionID,
+			"message_id": r.MessageID,
+			"reason":     r.Reason,
+		},
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.rdb.Del(ctx, dedupePrefix+r.SessionID+":"+r.MessageID)
+		return nil, fmt.Errorf("failed to store report: %w", err)
+	}
+	reportsTotal.Inc(r.Reason)
+	log.Printf("ALERT: answer %s in session %s reported as %s", r.MessageID, r.SessionID, r.Reason)
+
+	if s.evaluator != nil {
+		s.evaluator.Review(evaluation.Sample{
+			MessageID: r.MessageID,
+			SessionID: r.SessionID,
+			TenantID:  r.TenantID,
+			Question:  r.Question,
+			Answer:    r.Answer,
+			Reported:  r.Reason,
+		})
+	}
+	return &r, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*Report, error) {
+	data, err := s.rdb.Get(ctx, reportPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report: %w", err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal report: %w", err)
+	}
+	return &r, nil
+}
+
+// List returns the most recent reports first.
+func (s *Store) List(ctx context.Context, limit int64) ([]Summary, error) {
+	ids, err := s.rdb.ZRevRange(ctx, indexKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	out := make([]Summary, 0, len(ids))
+	for _, id := range ids {
+		r, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// Expired; drop it from the index
+			s.rdb.ZRem(ctx, indexKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Summary{ID: r.ID, MessageID: r.MessageID, SessionID: r.SessionID, Channel: r.Channel, Reason: r.Reason, ReportedAt: r.ReportedAt})
+	}
+	return out, nil
+}
+
+// Consume files the reports the web widget sends, published by the channel
+// adapter on msg:reports.
+func (s *Store) Consume(ctx context.Context) {
+	err := s.rdb.XGroupCreateMkStream(ctx, reportsStream, reportsGroup, "$").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		log.Printf("Failed to create reports consumer group: %v", err)
+		return
+	}
+	for ctx.Err() == nil {
+		streams, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    reportsGroup,
+			Consumer: ConsumerName,
+			Streams:  []string{reportsStream, ">"},
+			Count:    50,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				log.Printf("Error reading reports: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if _, err := s.File(ctx, parseReport(msg.Values)); err != nil && !errors.Is(err, ErrDuplicate) {
+					log.Printf("Failed to file report %s: %v", msg.ID, err)
+				}
+				s.rdb.XAck(ctx, reportsStream, reportsGroup, msg.ID)
+			}
+		}
+	}
+}
+
+func parseReport(v map[string]interface{}) Report {
+	str := func(k string) string {
+		s, _ := v[k].(string)
+		return s
+	}
+	return Report{
+		MessageID: str("message_id"),
+		SessionID: str("session_id"),
+		TenantID:  str("tenant_id"),
+		Channel:   str("channel"),
+		UserID:    str("user_id"),
+		Reason:    str("reason"),
+		Comment:   str("comment"),
+	}
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"orchestrator/archive"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+var agentRepliesTotal = metrics.NewCounterVec("orchestrator_agent_replies_total",
+	"Replies human agents wrote on the agent console, by channel.", "channel")
+
+// deliverAgentReply sends a human agent's reply to the user as it is and
+// records it in the transcript. An agent's first reply to a handed-off
+// conversation also stops its pickup timer.
+func (r *Router) deliverAgentReply(ctx context.Context, envelope *models.MessageEnvelope) {
+	sessionID := envelope.SessionID
+	now := time.Now().UTC()
+	if err := r.sessionMgr.Record(ctx, sessionID,
+		archive.Turn{MessageID: envelope.MessageID, Role: "agent", Content: envelope.Content.Text, UserID: envelope.UserID, Channel: envelope.Channel, Backend: "agent:" + envelope.Agent, Timestamp: now},
+	); err != nil {
+		log.Printf("Failed to record conversation: %v", err)
+	}
+	if r.sla != nil {
+		if _, err := r.sla.PickedUp(ctx, sessionID, envelope.Agent, now); err != nil {
+			log.Printf("Failed to record pickup of session %s: %v", sessionID, err)
+		}
+	}
+	agentRepliesTotal.Inc(envelope.Channel)
+	r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
+		ID:        envelope.MessageID,
+		Type:      "message",
+		Text:      envelope.Content.Text,
+		SessionID: sessionID,
+		Role:      "agent",
+		Agent:     envelope.Agent,
+	})
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"context"
+	"log"
+
+	"orchestrator/attachment"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+// Bounds what one request to cognitive-core carries; further attachments
+// are left out.
+const maxForwardedBytes = 20 << 20
+
+var forwardedAttachments = metrics.NewCounterVec("orchestrator_attachments_forwarded_total",
+	"Uploaded attachments passed to cognitive-core, by outcome.", "outcome")
+
+// EnableAttachments passes the images and documents users upload to
+// cognitive-core with their message.
+func (r *Router) EnableAttachments(s *attachment.Store) {
+	r.attachments = s
+}
+
+// chatAttachments loads the uploads of envelope for cognitive-core.
+// Screenshots are shared for support agents only and are not forwarded.
+func (r *Router) chatAttachments(ctx context.Context, envelope *models.MessageEnvelope) []models.ChatAttachment {
+	if r.attachments == nil {
+		return nil
+	}
+	var out []models.ChatAttachment
+	total := 0
+	for _, a := range envelope.Attachments {
+		if a.Kind != "image" && a.Kind != "document" {
+			continue
+		}
+		if total+a.Size > maxForwardedBytes {
+			log.Printf("Not forwarding attachment %s of message %s: over %d bytes in total", a.ID, envelope.MessageID, maxForwardedBytes)
+			forwardedAttachments.Inc("too_large")
+			continue
+		}
+		info, data, err := r.attachments.Get(ctx, a.ID)
+		if err != nil {
+			log.Printf("Failed to load attachment %s: %v", a.ID, err)
+			forwardedAttachments.Inc("error")
+			continue
+		}
+		if info == nil || info.SessionID != envelope.SessionID {
+			forwardedAttachments.Inc("expired")
+			continue
+		}
+		total += len(data)
+		out = append(out, models.ChatAttachment{
+			Name:        info.Name,
+			Kind:        info.Kind,
+			ContentType: info.ContentType,
+			Data:        data,
+		})
+		forwardedAttachments.Inc("forwarded")
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	// maxResponseBytes caps how much of a cognitive-core response is read,
+	// so a runaway generation can't exhaust memory
+	maxResponseBytes = 1 << 20
+	// maxAnswerRunes caps an answer before it is split for delivery
+	maxAnswerRunes = 12000
+	// smsMaxRunes is the longest concatenated SMS Twilio will send
+	smsMaxRunes = 1600
+)
+
+// chunkLimits is the longest single message frame per channel. Channels not
+// listed are sent whole; their adapters split to the platform's own limits.
+var chunkLimits = map[string]int{
+	"web": 4000,
+}
+
+var oversizedTotal = metrics.NewCounterVec("orchestrator_oversized_answers_total",
+	"Answers that were truncated, split or summarized for delivery.", "action")
+
+// readLimited reads at most maxResponseBytes of body and fails if there was
+// more.
+func readLimited(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseBytes {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxResponseBytes)
+	}
+	return data, nil
+}
+
+// fitAnswer shortens text for the channel: SMS answers are summarized to fit
+// one concatenated message, and anything longer than maxAnswerRunes is cut
+// at a sentence boundary.
+func (r *Router) fitAnswer(ctx context.Context, channel, coreURL, text string) string {
+	if channel == "sms" && len([]rune(text)) > smsMaxRunes {
+		summary, err := r.summarize(ctx, coreURL, text, smsMaxRunes)
+		if err == nil && summary != "" && len([]rune(summary)) <= smsMaxRunes {
+			oversizedTotal.Inc("summarized")
+			return summary
+		}
+		if err != nil {
+			log.Printf("Failed to summarize answer for SMS: %v", err)
+		}
+		oversizedTotal.Inc("truncated")
+		return truncate(text, smsMaxRunes)
+	}
+	if len([]rune(text)) > maxAnswerRunes {
+		oversizedTotal.Inc("truncated")
+		return truncate(text, maxAnswerRunes)
+	}
+	return text
+}
+
+// publishAnswer sends resp as one frame, or as several numbered frames if
+// the text is longer than the channel allows. Part IDs after the first are
+// suffixed ".2", ".3"… so each part is tracked separately.
+func (r *Router) publishAnswer(ctx context.Context, channel, sessionID string, resp models.WSResponse) {
+	limit, ok := chunkLimits[channel]
+	if !ok || len([]rune(resp.Text)) <= limit {
+		r.publishResponse(ctx, channel, sessionID, resp)
+		return
+	}
+	parts := splitText(resp.Text, limit)
+	oversizedTotal.Inc("split")
+	for i, text := range parts {
+		part := resp
+		part.Text = text
+		part.Part, part.Parts = i+1, len(parts)
+		if i > 0 && resp.ID != "" {
+			part.ID = fmt.Sprintf("%s.%d", resp.ID, i+1)
+		}
+		// Structured data belongs to the whole answer; send it once complete
+		if i < len(parts)-1 {
+			part.Data, part.Rich = nil, nil
+		}
+		r.publishResponse(ctx, channel, sessionID, part)
+	}
+}
+
+// splitText breaks text into pieces of at most limit runes, preferring
+// paragraph, line, sentence and then word boundaries.
+func splitText(text string, limit int) []string {
+	var parts []string
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > limit {
+		cut := breakPoint(runes[:limit])
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// breakPoint returns where to end a piece taken from window. It only looks
+// at the second half so pieces don't come out tiny.
+func breakPoint(window []rune) int {
+	s := string(window)
+	half := len(string(window[:len(window)/2]))
+	for _, sep := range []string{"\n\n", "\n", ". ", "। ", "? ", "! "} {
+		if i := strings.LastIndex(s, sep); i >= half {
+			return len([]rune(s[:i+len(sep)]))
+		}
+	}
+	for i := len(window) - 1; i >= len(window)/2; i-- {
+		if unicode.IsSpace(window[i]) {
+			return i + 1
+		}
+	}
+	return len(window)
+}
+
+// truncate cuts text to at most limit runes at a sentence boundary where
+// possible, marking the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	window := runes[:limit-1]
+	return strings.TrimSpace(string(window[:breakPoint(window)])) + "…"
+}
+
+type summarizeRequest struct {
+	Text     string `json:"text"`
+	MaxChars int    `json:"max_chars"`
+}
+
+type summarizeResponse struct {
+	Summary string `json:"summary"`
+}
+
+func (r *Router) summarize(ctx context.Context, coreURL, text string, maxChars int) (string, error) {
+	body, err := json.Marshal(summarizeRequest{Text: text, MaxChars: maxChars})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal summarize request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, coreURL+"/summarize", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create summarize request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("summarize request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read summarize response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("summarize returned %d", resp.StatusCode)
+	}
+	var sr summarizeResponse
+	if err := json.Unmarshal(data, &sr); err != nil {
+		return "", fmt.Errorf("failed to unmarshal summarize response: %w", err)
+	}
+	return strings.TrimSpace(sr.Summary), nil
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"orchestrator/backend"
+	"orchestrator/metrics"
+	"orchestrator/models"
+	"orchestrator/textnorm"
+)
+
+var coalescedTotal = metrics.NewCounterVec("orchestrator_coalesced_requests_total",
+	"Cognitive-core calls by whether they started a call or joined an identical one in flight.", "role")
+
+// flight is one cognitive-core call shared by every session asking the same
+// question while it runs.
+type flight struct {
+	done chan struct{}
+	resp *models.ChatResponse
+	err  error
+}
+
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// EnableCoalescing shares one cognitive-core call between sessions that ask
+// the same question at the same time, such as after an announcement. Only
+// opening questions coalesce, since later ones depend on the conversation.
+func (r *Router) EnableCoalescing() {
+	r.flights = &flightGroup{flights: make(map[string]*flight)}
+}
+
+// callCoalesced is callCognitiveCore, joining an identical call if one is in
+// flight. The shared call is detached from any one caller's deadline; each
+// caller stops waiting at its own.
+func (r *Router) callCoalesced(ctx context.Context, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error) {
+	key, ok := coalesceKey(be, req)
+	if r.flights == nil || !ok {
+		return r.callCognitiveCore(ctx, be, req)
+	}
+
+	g := r.flights
+	g.mu.Lock()
+	f, joined := g.flights[key]
+	if !joined {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+	}
+	g.mu.Unlock()
+
+	if joined {
+		coalescedTotal.Inc("follower")
+	} else {
+		coalescedTotal.Inc("leader")
+		go func() {
+			f.resp, f.err = r.callCognitiveCore(context.WithoutCancel(ctx), be, req)
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	// Each caller post-processes its own copy of the answer
+	resp := *f.resp
+	resp.SessionID = req.SessionID
+	resp.Sources = append([]string(nil), f.resp.Sources...)
+	return &resp, nil
+}
+
+// coalesceKey identifies requests that must get the same answer. Requests
+// with conversation context, attachments or operator notes are never
+// coalesced.
+func coalesceKey(be backend.Backend, req models.ChatRequest) (string, bool) {
+	if len(req.ConversationHistory) > 0 || req.SessionSummary != "" || len(req.Attachments) > 0 || len(req.OperatorNotes) > 0 {
+		return "", false
+	}
+	// "Opening hours?" and "opening hours" coalesce
+	question := textnorm.Normalize(req.Message)
+	if question == "" {
+		return "", false
+	}
+	// Requests under different flags or variants may be answered differently
+	var flags map[string]bool
+	var variants map[string]string
+	if req.Features != nil {
+		flags, variants = req.Features.Flags, req.Features.Experiments
+	}
+	data, err := json.Marshal(struct {
+		Backend      string              `json:"b"`
+		Question     string              `json:"q"`
+		Channel      string              `json:"c"`
+		Language     string              `json:"l"`
+		Schema       json.RawMessage     `json:"s,omitempty"`
+		Fast         bool                `json:"f"`
+		Page         *models.PageContext `json:"p,omitempty"`
+		Tone         string              `json:"t"`
+		MaxSentences int                 `json:"m"`
+		Decompose    bool                `json:"d"`
+		TimeZone     string              `json:"z,omitempty"`
+		Flags        map[string]bool     `json:"ff,omitempty"`
+		Variants     map[string]string   `json:"fv,omitempty"`
+	}{be.URL, question, req.Channel, req.Language, req.ResponseSchema, req.Fast, req.PageContext, req.Tone, req.MaxSentences, req.Decompose, req.TimeZone, flags, variants})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
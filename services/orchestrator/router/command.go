@@ -0,0 +1,72 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"orchestrator/models"
+	"orchestrator/session"
+	"orchestrator/tone"
+)
+
+// runCommand carries out a slash command the channel adapter recognized:
+// /reset starts the conversation over, /language and /persona set how the
+// session's answers are written. The user gets a notice either way.
+func (r *Router) runCommand(ctx context.Context, envelope *models.MessageEnvelope) {
+	sessionID := envelope.SessionID
+	arg := envelope.Content.Text
+	resp := models.WSResponse{Type: "notice", SessionID: sessionID}
+	var err error
+	switch envelope.Command {
+	case "reset":
+		turn := userTurn(envelope, "")
+		turn.Content = "/reset"
+		err = r.sessionMgr.Reset(ctx, sessionID, turn)
+		resp.Text = "Okay, let's start over. What would you like to know?"
+		resp.Data, _ = json.Marshal(map[string]string{"command": "reset"})
+	case "language", "persona":
+		var prefs session.Preferences
+		prefs, err = r.sessionMgr.Preferences(ctx, sessionID)
+		if err != nil {
+			break
+		}
+		if resp.Text = setPreference(&prefs, envelope.Command, arg); resp.Text == "" {
+			log.Printf("Ignoring /%s %q in session %s", envelope.Command, arg, sessionID)
+			return
+		}
+		err = r.sessionMgr.SetPreferences(ctx, sessionID, prefs)
+	default:
+		log.Printf("Ignoring unknown command %q in session %s", envelope.Command, sessionID)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to run /%s in session %s: %v", envelope.Command, sessionID, err)
+		resp = models.WSResponse{Type: "error", Text: "Sorry, I couldn't do that. Please try again.", SessionID: sessionID}
+	} else {
+		log.Printf("Ran /%s in session %s", envelope.Command, sessionID)
+	}
+	r.publishResponse(ctx, envelope.Channel, sessionID, resp)
+}
+
+// setPreference applies /language or /persona to prefs and returns the
+// confirmation for the user, or "" for an argument the adapter should have
+// refused.
+func setPreference(prefs *session.Preferences, command, arg string) string {
+	switch {
+	case command == "language" && arg == "auto":
+		prefs.Language = ""
+		return "Okay, I'll answer in the usual language again."
+	case command == "language" && arg != "":
+		prefs.Language = arg
+		return fmt.Sprintf("Okay, I'll answer in “%s” from now on.", arg)
+	case command == "persona" && arg == "default":
+		prefs.Persona = ""
+		return "Okay, I'll answer in my usual style again."
+	case command == "persona" && (arg == tone.Formal || arg == tone.Friendly || arg == tone.Concise):
+		prefs.Persona = arg
+		return fmt.Sprintf("Okay, I'll keep my answers %s from now on.", arg)
+	}
+	return ""
+}
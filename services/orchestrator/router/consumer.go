@@ -0,0 +1,190 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+// ConsumerName identifies this replica in the consumer group; main sets it
+// from the environment. Replicas must not share a name, or they would share
+// each other's pending messages.
+var ConsumerName = "orchestrator-1"
+
+// A message is leased to the replica that read it for as long as that
+// replica keeps it idle for less than ClaimIdle; the lease is renewed while
+// the message is processed. An expired lease means the replica is gone, and
+// the message is claimed by another one. Messages delivered MaxDeliveries
+// times without being acknowledged are poison: they are acknowledged and
+// dead-lettered.
+var (
+	ClaimIdle     = 2 * time.Minute
+	MaxDeliveries = int64(5)
+)
+
+const (
+	claimInterval = 30 * time.Second
+	claimBatch    = 10
+	// Consumers left by replicas that scaled down are removed once idle
+	staleConsumer = time.Hour
+)
+
+var reclaimedTotal = metrics.NewCounterVec("orchestrator_messages_reclaimed_total",
+	"Pending messages taken over from another replica, by outcome.", "outcome")
+
+// process handles msg while holding its lease.
+func (r *Router) process(ctx context.Context, msg redis.XMessage) {
+	lctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go r.holdLease(lctx, msg.ID)
+	r.handleMessage(ctx, msg)
+}
+
+// holdLease renews the lease on id until ctx is done, so a slow answer is
+// not mistaken for an abandoned one.
+func (r *Router) holdLease(ctx context.Context, id string) {
+	ticker := time.NewTicker(ClaimIdle / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Claiming our own message resets its idle time
+			if err := r.rdb.XClaimJustID(ctx, &redis.XClaimArgs{
+				Stream:   streamKey,
+				Group:    consumerGroup,
+				Consumer: ConsumerName,
+				Messages: []string{id},
+			}).Err(); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to renew lease on %s: %v", id, err)
+			}
+		}
+	}
+}
+
+// claimExpired takes over messages whose lease has expired and returns them
+// for processing. Poison messages are dead-lettered.
+func (r *Router) claimExpired(ctx context.Context) []redis.XMessage {
+	pending, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamKey,
+		Group:  consumerGroup,
+		Idle:   ClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  claimBatch,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to list pending messages: %v", err)
+		return nil
+	}
+	var ids []string
+	for _, p := range pending {
+		if p.RetryCount >= MaxDeliveries {
+			log.Printf("Dropping message %s: delivered %d times without being processed", p.ID, p.RetryCount)
+			reclaimedTotal.Inc("dropped")
+			r.deadLetter(ctx, p.ID, "", "max_deliveries", p.RetryCount)
+			r.rdb.XAck(ctx, streamKey, consumerGroup, p.ID)
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	msgs, err := r.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   streamKey,
+		Group:    consumerGroup,
+		Consumer: ConsumerName,
+		MinIdle:  ClaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to claim pending messages: %v", err)
+		return nil
+	}
+	for _, msg := range msgs {
+		log.Printf("Claimed message %s after its lease expired", msg.ID)
+		reclaimedTotal.Inc("claimed")
+	}
+	r.removeStaleConsumers(ctx)
+	return msgs
+}
+
+// removeStaleConsumers deletes consumers with nothing pending that have
+// been idle for a long time, so the group lists only live replicas.
+func (r *Router) removeStaleConsumers(ctx context.Context) {
+	consumers, err := r.rdb.XInfoConsumers(ctx, streamKey, consumerGroup).Result()
+	if err != nil {
+		log.Printf("Failed to list consumers: %v", err)
+		return
+	}
+	for _, c := range consumers {
+		if c.Name == ConsumerName || c.Pending > 0 || c.Idle < staleConsumer {
+			continue
+		}
+		if err := r.rdb.XGroupDelConsumer(ctx, streamKey, consumerGroup, c.Name).Err(); err != nil {
+			log.Printf("Failed to remove consumer %s: %v", c.Name, err)
+			continue
+		}
+		log.Printf("Removed stale consumer %s", c.Name)
+	}
+}
+
+// Shutdown stops taking new messages and waits up to grace for the one in
+// progress. A message still unanswered by then is abandoned without an
+// acknowledgement, and the leases on everything this replica holds are
+// released so another replica claims it straight away.
+func (r *Router) Shutdown(grace time.Duration) {
+	r.stopOnce.Do(func() { close(r.stop) })
+	select {
+	case <-r.consuming:
+	case <-time.After(grace):
+		log.Printf("Abandoning in-flight messages after %s", grace)
+		r.abandon()
+		<-r.consuming
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pending, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   streamKey,
+		Group:    consumerGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    1000,
+		Consumer: ConsumerName,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to list pending messages: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		if err := r.rdb.XGroupDelConsumer(ctx, streamKey, consumerGroup, ConsumerName).Err(); err != nil {
+			log.Printf("Failed to leave consumer group: %v", err)
+		}
+		return
+	}
+	// Back-dating the idle time expires the lease; go-redis has no IDLE
+	// option on XCLAIM
+	args := []interface{}{"XCLAIM", streamKey, consumerGroup, ConsumerName, 0}
+	for _, p := range pending {
+		args = append(args, p.ID)
+	}
+	args = append(args, "IDLE", ClaimIdle.Milliseconds(), "JUSTID")
+	if err := r.rdb.Do(ctx, args...).Err(); err != nil {
+		log.Printf("Failed to release %d leases: %v", len(pending), err)
+		return
+	}
+	log.Printf("Released %d pending messages to other replicas", len(pending))
+}
+
+// abandoned reports whether processing was cut short by Shutdown, in which
+// case the message must be left pending rather than answered with an error.
+func (r *Router) abandoned() bool {
+	return r.work.Err() != nil
+}
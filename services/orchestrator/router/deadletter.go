@@ -0,0 +1,37 @@
+package router
+
+import (
+	"context"
+	"log"
+
+	"orchestrator/deadletter"
+)
+
+// EnableDeadLetters keeps messages the router gives up on in s, where
+// operators can fix and re-drive them, instead of dropping them.
+func (r *Router) EnableDeadLetters(s *deadletter.Store) {
+	r.deadLetters = s
+}
+
+// deadLetter keeps the inbound message id. Its envelope is read back from
+// the stream when envelope is "".
+func (r *Router) deadLetter(ctx context.Context, id, envelope, reason string, deliveries int64) {
+	if r.deadLetters == nil {
+		return
+	}
+	if envelope == "" {
+		entries, err := r.rdb.XRangeN(ctx, streamKey, id, id, 1).Result()
+		if err != nil {
+			log.Printf("Failed to read message %s to dead-letter: %v", id, err)
+			return
+		}
+		if len(entries) == 0 {
+			log.Printf("Message %s was trimmed from the stream before it could be dead-lettered", id)
+			return
+		}
+		envelope, _ = entries[0].Values["envelope"].(string)
+	}
+	if err := r.deadLetters.Add(ctx, id, envelope, reason, deliveries); err != nil {
+		log.Printf("Failed to keep message %s: %v", id, err)
+	}
+}
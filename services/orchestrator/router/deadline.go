@@ -0,0 +1,80 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"orchestrator/backend"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	// Budgets below this ask cognitive-core for its fast path (smaller
+	// retrieval and, if configured, a smaller model).
+	fastPathBudget = 10 * time.Second
+	acceptedText   = "Got it! I'm working on your answer and will reply shortly."
+)
+
+var deadlineOutcomes = metrics.NewCounterVec("orchestrator_deadline_outcomes_total",
+	"How messages with a deadline were handled.", "outcome")
+
+// callWithDeadline enforces the envelope's deadline. If the expected backend
+// latency already exceeds the budget, or the call runs out of time, the
+// channel gets an "accepted" frame so it can acknowledge the platform in time,
+// and the answer follows when the call completes. A budget already used up
+// gets no "accepted" frame, since the platform has stopped waiting.
+func (r *Router) callWithDeadline(ctx context.Context, envelope *models.MessageEnvelope, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error) {
+	if envelope.Deadline == nil {
+		return r.callCore(ctx, envelope, be, req)
+	}
+
+	budget := time.Until(*envelope.Deadline)
+	expected := r.backends.ExpectedLatency(be.Name)
+	if budget <= 0 || (expected > 0 && budget < expected) {
+		deadlineOutcomes.Inc("async")
+		if budget > 0 {
+			r.publishAccepted(ctx, envelope)
+		}
+		req.Fast = true
+		return r.callCore(ctx, envelope, be, req)
+	}
+
+	req.Fast = budget < fastPathBudget
+	type result struct {
+		resp *models.ChatResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := r.callCore(ctx, envelope, be, req)
+		done <- result{resp, err}
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		if req.Fast {
+			deadlineOutcomes.Inc("fast_path")
+		} else {
+			deadlineOutcomes.Inc("in_budget")
+		}
+		return res.resp, res.err
+	case <-timer.C:
+		// The call keeps running and its answer, streamed or not, follows
+		// the "accepted" frame
+		deadlineOutcomes.Inc("timeout_async")
+		r.publishAccepted(ctx, envelope)
+		res := <-done
+		return res.resp, res.err
+	}
+}
+
+func (r *Router) publishAccepted(ctx context.Context, envelope *models.MessageEnvelope) {
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+		Type:      "accepted",
+		Text:      acceptedText,
+		SessionID: envelope.SessionID,
+	})
+}
@@ -0,0 +1,28 @@
+package router
+
+import (
+	"context"
+
+	"orchestrator/degrade"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+var degradedAnswers = metrics.NewCounterVec("orchestrator_degraded_answers_total",
+	"Messages answered with the busy notice instead of cognitive-core, by degradation level.", "level")
+
+// EnableDegradation serves messages at the level l allows, and feeds it
+// cognitive-core outcomes and inbound lag.
+func (r *Router) EnableDegradation(l *degrade.Ladder) {
+	r.ladder = l
+}
+
+// answerBusy tells the user the genie can't answer them right now.
+func (r *Router) answerBusy(ctx context.Context, envelope *models.MessageEnvelope, level degrade.Level) {
+	degradedAnswers.Inc(level.String())
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+		Type:      "notice",
+		Text:      level.Message(),
+		SessionID: envelope.SessionID,
+	})
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+	"orchestrator/session"
+)
+
+var revisionsTotal = metrics.NewCounterVec("orchestrator_message_revisions_total",
+	"Edits and deletions users made to their earlier messages, by outcome.", "outcome")
+
+// reviseMessage applies an edit or deletion the user made to one of their
+// earlier messages and tells the session's connections. It reports whether
+// the edit is to be answered as a message: an edit of the latest message
+// regenerates its answer, so the envelope then takes over the edited
+// message's ID and the answer replaces the old one.
+func (r *Router) reviseMessage(ctx context.Context, envelope *models.MessageEnvelope) bool {
+	sessionID := envelope.SessionID
+	turn := userTurn(envelope, "")
+	resp := models.WSResponse{ID: envelope.Edits, SessionID: sessionID}
+	var regenerate bool
+	var err error
+	switch envelope.Content.Type {
+	case "delete":
+		resp.Type = "deleted"
+		err = r.sessionMgr.Delete(ctx, sessionID, turn)
+	default:
+		resp.Type, resp.Text = "edited", envelope.Content.Text
+		regenerate, err = r.sessionMgr.Edit(ctx, sessionID, turn)
+	}
+	if errors.Is(err, session.ErrMessageNotFound) {
+		revisionsTotal.Inc("not_found")
+		r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
+			Type:      "error",
+			Text:      "That message can't be changed anymore.",
+			SessionID: sessionID,
+		})
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to revise message %s of session %s: %v", envelope.Edits, sessionID, err)
+		r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
+			Type:      "error",
+			Text:      "Sorry, your change couldn't be saved. Please try again.",
+			SessionID: sessionID,
+		})
+		return false
+	}
+
+	outcome := resp.Type
+	if regenerate {
+		outcome = "regenerated"
+	}
+	revisionsTotal.Inc(outcome)
+	log.Printf("Message %s of session %s %s", envelope.Edits, sessionID, outcome)
+	r.publishResponse(ctx, envelope.Channel, sessionID, resp)
+	if regenerate {
+		envelope.MessageID = envelope.Edits
+		envelope.Content.Type = "text"
+	}
+	return regenerate
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"orchestrator/flags"
+	"orchestrator/models"
+)
+
+// EnableFeatures stamps every message with the feature flags and experiment
+// variants f resolves for it.
+func (r *Router) EnableFeatures(f *flags.Resolver) {
+	r.features = f
+}
+
+// stampFeatures resolves the message's flags at ingestion. An envelope that
+// arrives already stamped by an upstream service keeps its features.
+func (r *Router) stampFeatures(ctx context.Context, envelope *models.MessageEnvelope) {
+	if r.features == nil || envelope.Features != nil {
+		return
+	}
+	f, err := r.features.Resolve(ctx, envelope)
+	if err != nil {
+		log.Printf("Failed to resolve features for message %s: %v", envelope.MessageID, err)
+	}
+	envelope.Features = f
+}
+
+// featureRecord is how the features are archived with a turn.
+func featureRecord(f *models.Features) ([]string, map[string]string) {
+	if f == nil {
+		return nil, nil
+	}
+	var on []string
+	for name, ok := range f.Flags {
+		if ok {
+			on = append(on, name)
+		}
+	}
+	sort.Strings(on)
+	return on, f.Experiments
+}
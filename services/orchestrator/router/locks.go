@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"orchestrator/locks"
+)
+
+// EnableLocks queues the messages of sessions locked in s until the lock is
+// released, instead of answering them.
+func (r *Router) EnableLocks(s *locks.Store) {
+	r.locks = s
+}
+
+// holdLocked reports whether the message was set aside because its session
+// is locked: queued, or dead-lettered when the queue is full so it can't
+// race the lock holder. If the lock can't be checked the message is
+// processed, as it would be without locks.
+func (r *Router) holdLocked(ctx context.Context, id, sessionID, envelope string) bool {
+	if r.locks == nil {
+		return false
+	}
+	held, err := r.locks.Hold(ctx, sessionID, envelope)
+	if errors.Is(err, locks.ErrQueueFull) {
+		r.deadLetter(ctx, id, envelope, "session_locked", 1)
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to hold message of locked session %s: %v", sessionID, err)
+		return false
+	}
+	return held
+}
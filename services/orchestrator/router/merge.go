@@ -0,0 +1,31 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"orchestrator/models"
+	"orchestrator/session"
+)
+
+// mergeSession handles a user's request, sent by the widget when it finds an
+// earlier session ID, to continue that conversation in this session.
+func (r *Router) mergeSession(ctx context.Context, envelope *models.MessageEnvelope) {
+	res, err := r.sessionMgr.Merge(ctx, envelope.SessionID, envelope.MergeFrom)
+	if errors.Is(err, session.ErrSameSession) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to merge session %s into %s: %v", envelope.MergeFrom, envelope.SessionID, err)
+		return
+	}
+	log.Printf("Session %s merged into %s at the user's request (%d turns)", res.MergedFrom, res.SessionID, res.Turns)
+	data, _ := json.Marshal(res)
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+		Type:      "merged",
+		SessionID: envelope.SessionID,
+		Data:      data,
+	})
+}
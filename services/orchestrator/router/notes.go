@@ -0,0 +1,26 @@
+package router
+
+import (
+	"context"
+	"log"
+
+	"orchestrator/notes"
+)
+
+// EnableNotes gives cognitive-core the operator notes marked for sharing
+// with the assistant, such as "already refunded order 1234".
+func (r *Router) EnableNotes(s *notes.Store) {
+	r.notes = s
+}
+
+func (r *Router) sharedNotes(ctx context.Context, sessionID string) []string {
+	if r.notes == nil {
+		return nil
+	}
+	shared, err := r.notes.Shared(ctx, sessionID)
+	if err != nil {
+		log.Printf("Failed to load notes for session %s: %v", sessionID, err)
+		return nil
+	}
+	return shared
+}
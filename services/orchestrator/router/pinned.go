@@ -0,0 +1,57 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"orchestrator/archive"
+	"orchestrator/intent"
+	"orchestrator/metrics"
+	"orchestrator/models"
+	"orchestrator/override"
+)
+
+var overrideHits = metrics.NewCounterVec("orchestrator_override_hits_total",
+	"Messages answered with an editorially pinned answer, by override.", "override")
+
+// EnableOverrides answers messages matching a pinned question from store
+// instead of calling cognitive-core.
+func (r *Router) EnableOverrides(store *override.Store) {
+	r.overrides = store
+}
+
+// answerPinned delivers an approved answer verbatim. It returns false if no
+// override applies and the message should go to cognitive-core.
+func (r *Router) answerPinned(ctx context.Context, envelope *models.MessageEnvelope, pending *intent.Pending) bool {
+	// A pinned answer cannot satisfy a caller-supplied schema
+	if len(envelope.ResponseSchema) > 0 {
+		return false
+	}
+	ov, v, err := r.overrides.Match(ctx, envelope.Content.Text, time.Now())
+	if err != nil {
+		log.Printf("Failed to match overrides: %v", err)
+		return false
+	}
+	if v == nil {
+		return false
+	}
+	overrideHits.Inc(ov.ID)
+	log.Printf("Answering %s with override %s v%d", envelope.MessageID, ov.ID, v.Version)
+
+	sessionID := envelope.SessionID
+	if err := r.sessionMgr.Record(ctx, sessionID,
+		userTurn(envelope, pending.Wait()),
+		archive.Turn{MessageID: envelope.MessageID, Role: "assistant", Content: v.Answer, UserID: envelope.UserID, Channel: envelope.Channel, Backend: fmt.Sprintf("override:%s@v%d", ov.ID, v.Version), Timestamp: time.Now().UTC()},
+	); err != nil {
+		log.Printf("Failed to record conversation: %v", err)
+	}
+	r.publishAnswer(ctx, envelope.Channel, sessionID, models.WSResponse{
+		ID:        envelope.MessageID,
+		Type:      "message",
+		Text:      v.Answer,
+		SessionID: sessionID,
+	})
+	return true
+}
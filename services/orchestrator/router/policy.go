@@ -0,0 +1,45 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"orchestrator/archive"
+	"orchestrator/intent"
+	"orchestrator/models"
+	"orchestrator/policy"
+)
+
+// EnablePolicy refuses messages on topics the tenant has banned.
+func (r *Router) EnablePolicy(engine *policy.Engine) {
+	r.policy = engine
+}
+
+// refuseBanned answers with the tenant's refusal template if the message
+// touches a banned topic. It returns false if the message may proceed.
+func (r *Router) refuseBanned(ctx context.Context, envelope *models.MessageEnvelope, pending *intent.Pending) bool {
+	d := r.policy.Check(envelope.TenantID, envelope.Content.Text)
+	if d == nil {
+		return false
+	}
+	log.Printf("Refusing %s: banned topic %s", envelope.MessageID, d.Topic)
+	if err := r.policy.Record(ctx, envelope.TenantID, envelope.SessionID, envelope.MessageID, d); err != nil {
+		log.Printf("Failed to record policy event: %v", err)
+	}
+
+	sessionID := envelope.SessionID
+	if err := r.sessionMgr.Record(ctx, sessionID,
+		userTurn(envelope, pending.Wait()),
+		archive.Turn{MessageID: envelope.MessageID, Role: "assistant", Content: d.Refusal, UserID: envelope.UserID, Channel: envelope.Channel, Backend: "policy:" + d.Topic, Timestamp: time.Now().UTC()},
+	); err != nil {
+		log.Printf("Failed to record conversation: %v", err)
+	}
+	r.publishAnswer(ctx, envelope.Channel, sessionID, models.WSResponse{
+		ID:        envelope.MessageID,
+		Type:      "message",
+		Text:      d.Refusal,
+		SessionID: sessionID,
+	})
+	return true
+}
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"context"
+
+	"orchestrator/models"
+)
+
+// answerProbe replies to a channel-adapter watchdog probe through the normal
+// publish path. A mock backend that echoes the message ID stands in for
+// cognitive-core, so the probe measures the bridge rather than the LLM.
+func (r *Router) answerProbe(ctx context.Context, envelope *models.MessageEnvelope) {
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+		Type:      "probe",
+		Text:      envelope.MessageID,
+		SessionID: envelope.SessionID,
+	})
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	"orchestrator/models"
+	"orchestrator/reports"
+)
+
+// EnableReports lets users report the previous answer with a /report
+// command, for channels without a report button.
+func (r *Router) EnableReports(s *reports.Store) {
+	r.reports = s
+}
+
+// reportCommand recognizes "/report [reason] [comment]". The reason is one
+// of reports.Reasons; anything else is taken as the comment.
+func reportCommand(text string) (reason, comment string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "/report") {
+		return "", "", false
+	}
+	fields = fields[1:]
+	if len(fields) > 0 && slices.Contains(reports.Reasons, strings.ToLower(fields[0])) {
+		reason, fields = fields[0], fields[1:]
+	}
+	return reason, strings.Join(fields, " "), true
+}
+
+func (r *Router) fileReport(ctx context.Context, envelope *models.MessageEnvelope, reason, comment string) {
+	resp := models.WSResponse{Type: "notice", SessionID: envelope.SessionID}
+	rep, err := r.reports.File(ctx, reports.Report{
+		SessionID: envelope.SessionID,
+		TenantID:  envelope.TenantID,
+		Channel:   envelope.Channel,
+		UserID:    envelope.UserID,
+		Reason:    reason,
+		Comment:   comment,
+	})
+	switch {
+	case err == nil:
+		log.Printf("Report %s filed by command in session %s", rep.ID, envelope.SessionID)
+		resp.Text = "Thanks for letting us know. Someone from our team will review that answer."
+	case errors.Is(err, reports.ErrDuplicate):
+		resp.Text = "You've already reported that answer. Thanks!"
+	case errors.Is(err, reports.ErrUnknownAnswer):
+		resp.Text = "There's no answer to report yet."
+	default:
+		log.Printf("Failed to file report in session %s: %v", envelope.SessionID, err)
+		resp.Type, resp.Text = "error", "Sorry, I couldn't record your report. Please try again."
+	}
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, resp)
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"orchestrator/models"
+)
+
+// buttonKeys are the fields of a structured response read as suggested
+// replies, in order of preference.
+var buttonKeys = []string{"quick_replies", "buttons", "options"}
+
+// pageSuffix is how cognitive-core names a page of an indexed document,
+// e.g. "rates.pdf_page_3".
+var pageSuffix = regexp.MustCompile(`^(.+)_page_(\d+)$`)
+
+// richContent builds the channel-neutral rich part of an answer from its
+// sources and structured payload, or nil if there is none.
+func richContent(resp *models.ChatResponse) *models.RichContent {
+	rc := &models.RichContent{}
+	seen := map[string]bool{}
+	for _, src := range resp.Sources {
+		src = strings.TrimSpace(src)
+		if src == "" || seen[src] {
+			continue
+		}
+		seen[src] = true
+		rc.Citations = append(rc.Citations, citation(src))
+	}
+
+	var fields map[string]json.RawMessage
+	if len(resp.Structured) > 0 && json.Unmarshal(resp.Structured, &fields) == nil {
+		for _, key := range buttonKeys {
+			if rc.Buttons = buttons(fields[key]); len(rc.Buttons) > 0 {
+				break
+			}
+		}
+		rc.Images = images(fields["images"])
+	}
+
+	if len(rc.Buttons) == 0 && len(rc.Images) == 0 && len(rc.Citations) == 0 {
+		return nil
+	}
+	return rc
+}
+
+func citation(src string) models.Citation {
+	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+		return models.Citation{Title: src, URL: src}
+	}
+	if m := pageSuffix.FindStringSubmatch(src); m != nil {
+		return models.Citation{Title: m[1] + ", page " + m[2]}
+	}
+	return models.Citation{Title: src}
+}
+
+// buttons reads an array of labels or of {"text","value","url"} objects. A
+// button without a value or URL sends its label.
+func buttons(raw json.RawMessage) []models.Button {
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil {
+		return nil
+	}
+	var out []models.Button
+	for _, item := range items {
+		var b models.Button
+		var s string
+		if json.Unmarshal(item, &s) == nil {
+			b.Text = s
+		} else if json.Unmarshal(item, &b) != nil {
+			continue
+		}
+		if b.Text = strings.TrimSpace(b.Text); b.Text == "" {
+			continue
+		}
+		if b.Value == "" && b.URL == "" {
+			b.Value = b.Text
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// images reads an array of URLs or of {"url","alt"} objects.
+func images(raw json.RawMessage) []models.Image {
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil {
+		return nil
+	}
+	var out []models.Image
+	for _, item := range items {
+		var img models.Image
+		var s string
+		if json.Unmarshal(item, &s) == nil {
+			img.URL = s
+		} else if json.Unmarshal(item, &img) != nil {
+			continue
+		}
+		if strings.HasPrefix(img.URL, "https://") {
+			out = append(out, img)
+		}
+	}
+	return out
+}
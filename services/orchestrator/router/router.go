@@ -5,38 +5,106 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"orchestrator/archive"
+	"orchestrator/attachment"
+	"orchestrator/backend"
+	"orchestrator/corehttp"
+	"orchestrator/deadletter"
+	"orchestrator/degrade"
+	"orchestrator/delivery"
+	"orchestrator/evaluation"
+	"orchestrator/flags"
+	"orchestrator/gaps"
+	"orchestrator/intent"
+	"orchestrator/live"
+	"orchestrator/locks"
+	"orchestrator/maintenance"
+	"orchestrator/metrics"
 	"orchestrator/models"
+	"orchestrator/notes"
+	"orchestrator/override"
+	"orchestrator/policy"
+	"orchestrator/region"
+	"orchestrator/reports"
+	"orchestrator/rules"
+	"orchestrator/schema"
 	"orchestrator/session"
+	"orchestrator/shadow"
+	"orchestrator/sla"
+	"orchestrator/tone"
+	"orchestrator/verify"
 )
 
 const (
 	streamKey      = "msg:inbound"
 	consumerGroup  = "orchestrator-group"
-	consumerName   = "orchestrator-1"
-	responsePrefix = "response:"
 	httpTimeout    = 60 * time.Second
 )
 
+// ReadBlock is how long each XREADGROUP waits for new messages.
+var ReadBlock = 5 * time.Second
+
 type Router struct {
 	rdb            *redis.Client
 	sessionMgr     *session.Manager
-	cognitiveURL   string
+	maintenance    *maintenance.Switch
+	publisher      *delivery.Publisher
+	backends       *backend.Selector
+	shadow         *shadow.Mirror
+	evaluator      *evaluation.Evaluator
+	verifier       *verify.Verifier
+	region         *region.Coordinator
+	overrides      *override.Store
+	policy         *policy.Engine
+	rules          *rules.Engine
+	gaps           *gaps.Tracker
+	intents        *intent.Classifier
+	tone           *tone.Engine
+	decompose      bool
+	ladder         *degrade.Ladder
+	attachments    *attachment.Store
+	live           *live.Tracker
+	reports        *reports.Store
+	notes          *notes.Store
+	tenants        *metrics.Limiter
+	features       *flags.Resolver
+	deadLetters    *deadletter.Store
+	locks          *locks.Store
+	sla            *sla.Tracker
+	flights        *flightGroup
 	httpClient     *http.Client
+	inFlight       atomic.Int32
+	// Shutdown closes stop to end ConsumeLoop, which closes consuming on
+	// return; messages are processed under work, cancelled to abandon them
+	stop           chan struct{}
+	stopOnce       sync.Once
+	consuming      chan struct{}
+	work           context.Context
+	abandon        context.CancelFunc
+	scaling        atomic.Pointer[ScalingSignal]
 }
 
-func New(rdb *redis.Client, sessionMgr *session.Manager, cognitiveURL string) *Router {
+func New(rdb *redis.Client, sessionMgr *session.Manager, sw *maintenance.Switch, publisher *delivery.Publisher, backends *backend.Selector) *Router {
+	work, abandon := context.WithCancel(context.Background())
 	return &Router{
 		rdb:        rdb,
 		sessionMgr: sessionMgr,
-		cognitiveURL: cognitiveURL,
-		httpClient: &http.Client{Timeout: httpTimeout},
+		maintenance: sw,
+		publisher:  publisher,
+		backends:   backends,
+		httpClient: corehttp.NewClient(httpTimeout),
+		stop:       make(chan struct{}),
+		consuming:  make(chan struct{}),
+		work:       work,
+		abandon:    abandon,
 	}
 }
 
@@ -48,8 +116,76 @@ func (r *Router) EnsureConsumerGroup(ctx context.Context) error {
 	return nil
 }
 
+// EnableShadow mirrors percent of sessions' requests to url for offline
+// comparison. Shadow responses are recorded but never delivered.
+func (r *Router) EnableShadow(url string, percent int) {
+	r.shadow = shadow.NewMirror(r.rdb, url, percent, r.callCognitiveCore)
+}
+
+// EnableEvaluation submits delivered responses to ev for quality scoring.
+func (r *Router) EnableEvaluation(ev *evaluation.Evaluator) {
+	r.evaluator = ev
+}
+
+// EnableGapTracking records questions the genie could not answer for the
+// knowledge gap report.
+func (r *Router) EnableGapTracking(t *gaps.Tracker) {
+	r.gaps = t
+}
+
+// EnableIntents classifies every inbound message with c and archives the
+// intent with it.
+func (r *Router) EnableIntents(c *intent.Classifier) {
+	r.intents = c
+}
+
+// EnableLiveStats feeds message volume and latency to t for the live
+// snapshot endpoint.
+func (r *Router) EnableLiveStats(t *live.Tracker) {
+	r.live = t
+}
+
+// EnableTone shapes generated answers to each tenant's and channel's style.
+func (r *Router) EnableTone(e *tone.Engine) {
+	r.tone = e
+}
+
+// EnableDecomposition has cognitive-core split messages asking several
+// questions and answer each as a numbered part.
+func (r *Router) EnableDecomposition() {
+	r.decompose = true
+}
+
+// EnableVerification post-processes responses with v before delivery.
+func (r *Router) EnableVerification(v *verify.Verifier) {
+	r.verifier = v
+}
+
+// EnableRegion makes the consumer idle whenever this region is standby.
+func (r *Router) EnableRegion(coord *region.Coordinator) {
+	r.region = coord
+}
+
+// InFlight reports how many messages are currently being processed.
+func (r *Router) InFlight() int {
+	return int(r.inFlight.Load())
+}
+
+// ConsumeLoop reads msg:inbound until ctx is cancelled or Shutdown is
+// called, taking over messages abandoned by other replicas as it goes.
 func (r *Router) ConsumeLoop(ctx context.Context) {
 	log.Println("Starting consumer loop...")
+	defer close(r.consuming)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var lastClaim time.Time
 	for {
 		select {
 		case <-ctx.Done():
@@ -57,12 +193,24 @@ func (r *Router) ConsumeLoop(ctx context.Context) {
 		default:
 		}
 
+		if r.region != nil && !r.region.IsActive() {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		if time.Since(lastClaim) >= claimInterval {
+			lastClaim = time.Now()
+			for _, msg := range r.claimExpired(ctx) {
+				r.process(r.work, msg)
+			}
+		}
+
 		streams, err := r.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
 			Group:    consumerGroup,
-			Consumer: consumerName,
+			Consumer: ConsumerName,
 			Streams:  []string{streamKey, ">"},
 			Count:    1,
-			Block:    5 * time.Second,
+			Block:    ReadBlock,
 		}).Result()
 
 		if err == redis.Nil || err != nil && ctx.Err() != nil {
@@ -76,13 +224,35 @@ func (r *Router) ConsumeLoop(ctx context.Context) {
 
 		for _, stream := range streams {
 			for _, msg := range stream.Messages {
-				r.handleMessage(ctx, msg)
+				r.process(r.work, msg)
 			}
 		}
 	}
 }
 
+// inMaintenance reports whether the message was answered with the
+// maintenance notice instead of being sent to cognitive-core. It is kept as
+// a dead letter so it can be redriven once maintenance ends; messages
+// already being answered finish, so the replica drains.
+func (r *Router) inMaintenance(ctx context.Context, id, envelopeJSON string, envelope *models.MessageEnvelope) bool {
+	mode, err := r.maintenance.Get(ctx)
+	if err != nil {
+		log.Printf("Failed to check maintenance mode: %v", err)
+	}
+	if !mode.Enabled {
+		return false
+	}
+	r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+		Type:      "notice",
+		Text:      mode.Message,
+		SessionID: envelope.SessionID,
+	})
+	r.deadLetter(ctx, id, envelopeJSON, "maintenance", 1)
+	return true
+}
+
 func (r *Router) handleMessage(ctx context.Context, msg redis.XMessage) {
+	received := time.Now()
 	envelopeJSON, ok := msg.Values["envelope"].(string)
 	if !ok {
 		log.Printf("Invalid message format, missing envelope field: %s", msg.ID)
@@ -93,23 +263,139 @@ func (r *Router) handleMessage(ctx context.Context, msg redis.XMessage) {
 	var envelope models.MessageEnvelope
 	if err := json.Unmarshal([]byte(envelopeJSON), &envelope); err != nil {
 		log.Printf("Failed to unmarshal envelope: %v", err)
+		r.deadLetter(ctx, msg.ID, envelopeJSON, "invalid_envelope", 1)
 		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
 		return
 	}
 
 	sessionID := envelope.SessionID
-	log.Printf("Processing message %s for session %s", envelope.MessageID, sessionID)
+
+	if envelope.Probe {
+		r.answerProbe(ctx, &envelope)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	if r.holdLocked(ctx, msg.ID, sessionID, envelopeJSON) {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	if envelope.MergeFrom != "" {
+		r.mergeSession(ctx, &envelope)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	if envelope.Agent != "" {
+		r.deliverAgentReply(ctx, &envelope)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	if envelope.Command != "" {
+		r.runCommand(ctx, &envelope)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	// Checked before anything is published or the session is changed
+	if len(envelope.ResponseSchema) > 0 {
+		if err := schema.Check(envelope.ResponseSchema); err != nil {
+			r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
+				Type: "error",
+				Text: fmt.Sprintf("Invalid response_schema: %v", err),
+			})
+			r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+			return
+		}
+	}
+	if envelope.Edits != "" && !r.reviseMessage(ctx, &envelope) {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	if reason, comment, ok := reportCommand(envelope.Content.Text); ok && r.reports != nil {
+		r.fileReport(ctx, &envelope, reason, comment)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+
+	if r.inMaintenance(ctx, msg.ID, envelopeJSON, &envelope) {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+
+	r.startSLA(ctx, &envelope, received)
+
+	level := r.ladder.Level()
+	if level == degrade.Static {
+		r.answerBusy(ctx, &envelope, level)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+
+	r.inFlight.Add(1)
+	defer r.inFlight.Add(-1)
+	r.live.Message(envelope.Channel, envelope.TenantID, sessionID)
+	r.tenantMessage(&envelope)
+	r.stampFeatures(ctx, &envelope)
+	// Classified alongside generation so it adds no latency to the answer
+	pending := r.intents.Start(ctx, envelope.TenantID, envelope.Content.Text)
+
+	if err := r.sessionMgr.BindUser(ctx, envelope.UserID, sessionID, envelope.Channel); err != nil {
+		log.Printf("Failed to bind user: %v", err)
+	}
+
+	if envelope.ExternalID != "" {
+		if err := r.sessionMgr.TraceExternal(ctx, archive.ExternalRef{
+			Channel:    envelope.Channel,
+			ExternalID: envelope.ExternalID,
+			MessageID:  envelope.MessageID,
+			SessionID:  sessionID,
+			ReceivedAt: received.UTC(),
+		}); err != nil {
+			log.Printf("Failed to index external ID: %v", err)
+		}
+		log.Printf("Processing message %s (%s %s) for session %s", envelope.MessageID, envelope.Channel, envelope.ExternalID, sessionID)
+	} else {
+		log.Printf("Processing message %s for session %s", envelope.MessageID, sessionID)
+	}
+
+	// Operator rules can answer, block, tag or reroute the message before
+	// anything is sent, so a silent block leaves no typing indicator behind
+	flow, handled := r.applyRules(ctx, &envelope, pending)
+	if handled {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
 
 	// Publish typing indicator
-	r.publishResponse(ctx, sessionID, models.WSResponse{Type: "typing"})
+	r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{Type: "typing"})
 
-	// Load conversation history
-	history, err := r.sessionMgr.LoadHistory(ctx, sessionID)
+	// Only the active topic's turns go into the prompt; earlier topics are
+	// summarized
+	if err := r.sessionMgr.Segment(ctx, sessionID, envelope.Content.Text); err != nil {
+		log.Printf("Failed to segment conversation: %v", err)
+	}
+	history, summary, err := r.sessionMgr.ActiveContext(ctx, sessionID)
 	if err != nil {
 		log.Printf("Failed to load history: %v", err)
 		history = []models.ConversationMessage{}
 	}
 
+	// Banned topics are refused regardless of what cognitive-core would say
+	if r.refuseBanned(ctx, &envelope, pending) {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+
+	// Editorially pinned answers take precedence over generation
+	if r.answerPinned(ctx, &envelope, pending) {
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+	// Only pinned answers are served while cognitive-core is struggling
+	if level == degrade.FAQOnly {
+		r.answerBusy(ctx, &envelope, level)
+		r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+		return
+	}
+
 	// Build request for cognitive-core
 	chatReq := models.ChatRequest{
 		SessionID:           sessionID,
@@ -117,13 +403,53 @@ func (r *Router) handleMessage(ctx context.Context, msg redis.XMessage) {
 		ConversationHistory: history,
 		Channel:             envelope.Channel,
 		Language:            envelope.Metadata.Language,
+		ResponseSchema:      envelope.ResponseSchema,
+		SessionSummary:      summary,
+		PageContext:         pageContext(&envelope),
+		Attachments:         r.chatAttachments(ctx, &envelope),
+		OperatorNotes:       r.sharedNotes(ctx, sessionID),
+		Features:            envelope.Features,
+		Client:              clientContext(&envelope),
+	}
+	style := r.tone.Resolve(envelope.TenantID, envelope.Channel)
+	if prefs, err := r.sessionMgr.Preferences(ctx, sessionID); err != nil {
+		log.Printf("Failed to load preferences: %v", err)
+	} else {
+		if prefs.Language != "" {
+			chatReq.Language = prefs.Language
+		}
+		if prefs.Persona != "" {
+			style = style.WithTone(prefs.Persona)
+		}
+	}
+	chatReq.Tone = style.Tone
+	chatReq.MaxSentences = style.MaxSentences
+	chatReq.Decompose = r.decompose
+	if loc, err := r.sessionMgr.TimeZone(ctx, sessionID, envelope.TimeZone); err != nil {
+		log.Printf("Failed to resolve time zone: %v", err)
+	} else if loc != nil {
+		chatReq.TimeZone = loc.String()
+		chatReq.LocalTime = received.In(loc).Format(time.RFC3339)
 	}
 
 	// Call cognitive-core
-	chatResp, err := r.callCognitiveCore(ctx, chatReq)
+	be := r.backends.Pick(sessionID)
+	if flow != nil {
+		be = *flow
+	}
+	start := time.Now()
+	chatResp, err := r.callWithDeadline(ctx, &envelope, be, chatReq)
+	latency := time.Since(start)
+	r.backends.Observe(be.Name, latency, err)
+	if err != nil && r.abandoned() {
+		log.Printf("Abandoned message %s on shutdown", envelope.MessageID)
+		return
+	}
+	r.ladder.Observe(latency, err)
 	if err != nil {
-		log.Printf("Cognitive core error: %v", err)
-		r.publishResponse(ctx, sessionID, models.WSResponse{
+		log.Printf("Cognitive core error (%s): %v", be.Name, err)
+		r.tenantError(&envelope, "cognitive_core")
+		r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
 			Type: "error",
 			Text: "Sorry, I'm having trouble responding right now. Please try again.",
 		})
@@ -131,29 +457,87 @@ func (r *Router) handleMessage(ctx context.Context, msg redis.XMessage) {
 		return
 	}
 
-	// Save conversation history
-	if err := r.sessionMgr.AppendMessages(ctx, sessionID, envelope.Content.Text, chatResp.Response); err != nil {
-		log.Printf("Failed to save history: %v", err)
+	// Structured answers must match the caller's schema before we return them
+	if len(chatReq.ResponseSchema) > 0 {
+		if err := schema.Validate(chatReq.ResponseSchema, chatResp.Structured); err != nil {
+			log.Printf("Structured output for %s failed validation: %v", envelope.MessageID, err)
+			r.tenantError(&envelope, "schema")
+			r.publishResponse(ctx, envelope.Channel, sessionID, models.WSResponse{
+				Type: "error",
+				Text: "Sorry, I couldn't produce an answer in the requested format.",
+			})
+			r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
+			return
+		}
+	}
+
+	r.shadow.Submit(envelope.MessageID, chatReq, chatResp, latency)
+
+	// Strip or flag links and phone numbers we cannot verify
+	verified, findings := r.verifier.Process(ctx, chatResp.Response)
+	if len(findings) > 0 {
+		log.Printf("Unverified contacts in response to %s: %v", envelope.MessageID, findings)
+		chatResp.Response = verified
+	}
+
+	chatResp.Response = style.Apply(chatResp.Response)
+	chatResp.Response = r.fitAnswer(ctx, envelope.Channel, be.URL, chatResp.Response)
+
+	// Record the exchange in the transcript and the prompt context
+	now := time.Now().UTC()
+	if err := r.sessionMgr.Record(ctx, sessionID,
+		userTurn(&envelope, pending.Wait()),
+		answerTurn(&envelope, chatResp, now, latency),
+	); err != nil {
+		log.Printf("Failed to record conversation: %v", err)
 	}
 
-	// Publish response
-	r.publishResponse(ctx, sessionID, models.WSResponse{
+	// Publish response. Its ID is the inbound message ID so feedback on the
+	// answer can be tied back to the question.
+	answer := models.WSResponse{
+		ID:        envelope.MessageID,
 		Type:      "message",
 		Text:      chatResp.Response,
 		SessionID: sessionID,
+		Data:      chatResp.Structured,
+		Rich:      richContent(chatResp),
+		Backend:   chatResp.Backend,
+	}
+	if envelope.Stream {
+		answer.Usage = chatResp.Usage
+	}
+	r.publishAnswer(ctx, envelope.Channel, sessionID, answer)
+	r.live.Answered(time.Since(received))
+	r.tenantAnswered(&envelope, chatResp, time.Since(received))
+	r.sla.Responded(ctx, sessionID, time.Now())
+
+	r.gaps.Observe(ctx, gaps.Gap{
+		MessageID: envelope.MessageID,
+		SessionID: sessionID,
+		TenantID:  envelope.TenantID,
+		Question:  envelope.Content.Text,
+	}, chatResp.Response, chatResp.Sources)
+
+	r.evaluator.Submit(evaluation.Sample{
+		MessageID: envelope.MessageID,
+		SessionID: sessionID,
+		TenantID:  envelope.TenantID,
+		Question:  envelope.Content.Text,
+		Answer:    chatResp.Response,
+		Sources:   chatResp.Sources,
 	})
 
 	// Acknowledge the stream message
 	r.rdb.XAck(ctx, streamKey, consumerGroup, msg.ID)
 }
 
-func (r *Router) callCognitiveCore(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+func (r *Router) callCognitiveCore(ctx context.Context, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/chat", r.cognitiveURL)
+	url := fmt.Sprintf("%s/chat", be.URL)
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -166,30 +550,76 @@ func (r *Router) callCognitiveCore(ctx context.Context, req models.ChatRequest)
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := readLimited(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cognitive-core returned %d: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("cognitive-core returned %d: %s", resp.StatusCode, truncate(string(respBody), 512))
 	}
 
 	var chatResp models.ChatResponse
 	if err := json.Unmarshal(respBody, &chatResp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
+	chatResp.Backend = be.Name
+	if v := resp.Header.Get("X-Backend-Version"); v != "" {
+		chatResp.Backend = fmt.Sprintf("%s@%s", be.Name, v)
+	}
 	return &chatResp, nil
 }
 
-func (r *Router) publishResponse(ctx context.Context, sessionID string, resp models.WSResponse) {
-	data, err := json.Marshal(resp)
-	if err != nil {
-		log.Printf("Failed to marshal response: %v", err)
-		return
+// userTurn is the archived record of the inbound message.
+func userTurn(envelope *models.MessageEnvelope, intent string) archive.Turn {
+	t := archive.Turn{MessageID: envelope.MessageID, ExternalID: envelope.ExternalID, Role: "user", Content: envelope.Content.Text, UserID: envelope.UserID, Channel: envelope.Channel, Intent: intent, Timestamp: envelope.Timestamp}
+	for _, a := range envelope.Attachments {
+		t.Attachments = append(t.Attachments, a.ID)
+	}
+	t.Tags = envelope.Tags
+	t.Flags, t.Experiments = featureRecord(envelope.Features)
+	t.Edits, t.Deleted = envelope.Edits, envelope.Content.Type == "delete"
+	return t
+}
+
+// answerTurn is the archived record of a generated answer, with the model,
+// latency and tokens that produced it.
+func answerTurn(envelope *models.MessageEnvelope, chatResp *models.ChatResponse, at time.Time, latency time.Duration) archive.Turn {
+	t := archive.Turn{MessageID: envelope.MessageID, Role: "assistant", Content: chatResp.Response, UserID: envelope.UserID, Channel: envelope.Channel, Backend: chatResp.Backend, Timestamp: at}
+	t.ModelUsed = chatResp.ModelUsed
+	t.Flags, t.Experiments = featureRecord(envelope.Features)
+	t.LatencyMS = latency.Milliseconds()
+	if u := chatResp.Usage; u != nil {
+		t.PromptTokens, t.CompletionTokens = u.PromptTokens, u.CompletionTokens
+	}
+	return t
+}
+
+// pageContext prefers what the widget sent with the message, falling back to
+// the page the widget was opened on.
+func pageContext(envelope *models.MessageEnvelope) *models.PageContext {
+	if envelope.PageContext != nil {
+		return envelope.PageContext
+	}
+	if ref, ok := envelope.Metadata.PlatformData["referrer"].(string); ok && ref != "" {
+		return &models.PageContext{URL: ref}
+	}
+	return nil
+}
+
+// clientContext is what cognitive-core may know about the web client: not
+// its IP, which stays on the envelope for debugging.
+func clientContext(envelope *models.MessageEnvelope) *models.ClientContext {
+	if envelope.Metadata.Client == nil {
+		return nil
 	}
-	channel := fmt.Sprintf("%s%s", responsePrefix, sessionID)
-	if err := r.rdb.Publish(ctx, channel, string(data)).Err(); err != nil {
+	c := *envelope.Metadata.Client
+	c.IP = ""
+	return &c
+}
+
+func (r *Router) publishResponse(ctx context.Context, channel, sessionID string, resp models.WSResponse) {
+	if _, err := r.publisher.Send(ctx, channel, sessionID, resp); err != nil {
 		log.Printf("Failed to publish response: %v", err)
 	}
 }
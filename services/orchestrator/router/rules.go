@@ -0,0 +1,73 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"orchestrator/archive"
+	"orchestrator/backend"
+	"orchestrator/intent"
+	"orchestrator/models"
+	"orchestrator/rules"
+)
+
+// EnableRules evaluates operator rules on every message before generation.
+func (r *Router) EnableRules(engine *rules.Engine) {
+	r.rules = engine
+}
+
+// applyRules tags the envelope with what the rules decided. It returns true
+// if a reply or block rule handled the message, or else the flow backend the
+// message was routed to, if any.
+func (r *Router) applyRules(ctx context.Context, envelope *models.MessageEnvelope, pending *intent.Pending) (*backend.Backend, bool) {
+	res := r.rules.Evaluate(envelope.TenantID, envelope.Channel, envelope.Content.Text)
+	envelope.Tags = append(envelope.Tags, res.Tags...)
+	// Like a pinned answer, a reply cannot satisfy a caller-supplied schema
+	if res.Reply != nil && !res.Blocked && len(envelope.ResponseSchema) > 0 {
+		res.Reply = nil
+	}
+
+	if res.Reply == nil {
+		flow := res.Flow
+		if envelope.Flow != "" {
+			// Chosen by an operator re-driving the message
+			flow = envelope.Flow
+		}
+		if flow == "" {
+			return nil, false
+		}
+		url, ok := r.rules.FlowURL(flow)
+		if !ok {
+			log.Printf("Unknown flow %s for %s; using the default backend", flow, envelope.MessageID)
+			return nil, false
+		}
+		log.Printf("Routing %s to flow %s", envelope.MessageID, flow)
+		return &backend.Backend{Name: "flow:" + flow, URL: url}, false
+	}
+
+	ruleID := res.RuleID()
+	sessionID := envelope.SessionID
+	if res.Blocked {
+		log.Printf("Blocked %s by rule %s", envelope.MessageID, ruleID)
+		envelope.Tags = append(envelope.Tags, "blocked")
+	} else {
+		log.Printf("Answering %s with rule %s", envelope.MessageID, ruleID)
+	}
+	turns := []archive.Turn{userTurn(envelope, pending.Wait())}
+	if *res.Reply != "" {
+		turns = append(turns, archive.Turn{MessageID: envelope.MessageID, Role: "assistant", Content: *res.Reply, UserID: envelope.UserID, Channel: envelope.Channel, Backend: "rule:" + ruleID, Timestamp: time.Now().UTC()})
+	}
+	if err := r.sessionMgr.Record(ctx, sessionID, turns...); err != nil {
+		log.Printf("Failed to record conversation: %v", err)
+	}
+	if *res.Reply != "" {
+		r.publishAnswer(ctx, envelope.Channel, sessionID, models.WSResponse{
+			ID:        envelope.MessageID,
+			Type:      "message",
+			Text:      *res.Reply,
+			SessionID: sessionID,
+		})
+	}
+	return nil, true
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"orchestrator/metrics"
+)
+
+// Bounds and targets for the replica count suggested to autoscalers; main
+// sets them from the environment. DrainTime is how soon a backlog should be
+// cleared, and Utilization how busy replicas may be at steady state.
+var (
+	ScaleMinReplicas = 1
+	ScaleMaxReplicas = 10
+	ScaleDrainTime   = 30 * time.Second
+	ScaleUtilization = 0.7
+)
+
+const (
+	scalingInterval = 15 * time.Second
+	// Assumed until this replica has answered something
+	defaultLatency = 2 * time.Second
+)
+
+var (
+	desiredReplicas = metrics.NewGaugeVec("orchestrator_desired_replicas",
+		"Replicas needed for the current inbound load, for autoscalers.")
+	streamLag = metrics.NewGaugeVec("orchestrator_inbound_lag",
+		"Inbound messages not yet read by any replica.")
+	streamPending = metrics.NewGaugeVec("orchestrator_inbound_pending",
+		"Inbound messages read but not yet acknowledged.")
+	streamConsumers = metrics.NewGaugeVec("orchestrator_inbound_consumers",
+		"Replicas registered in the inbound consumer group.")
+)
+
+// ScalingSignal is what an autoscaler needs to size the orchestrator. Each
+// replica computes it from the shared queue, so any one can be asked.
+type ScalingSignal struct {
+	DesiredReplicas int       `json:"desired_replicas"`
+	Consumers       int64     `json:"consumers"`
+	Lag             int64     `json:"lag"`
+	Pending         int64     `json:"pending"`
+	ArrivalPerSec   float64   `json:"arrival_per_sec"`
+	AvgLatencyMs    float64   `json:"avg_latency_ms"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WatchScaling refreshes the scaling signal until ctx is cancelled.
+func (r *Router) WatchScaling(ctx context.Context) {
+	var lastAdded int64
+	var lastAt time.Time
+	ticker := time.NewTicker(scalingInterval)
+	defer ticker.Stop()
+	for {
+		info, err := r.rdb.XInfoStream(ctx, streamKey).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to read inbound stream info: %v", err)
+		}
+		if err == nil {
+			now := time.Now()
+			rate := 0.0
+			if !lastAt.IsZero() && info.EntriesAdded >= lastAdded {
+				rate = float64(info.EntriesAdded-lastAdded) / now.Sub(lastAt).Seconds()
+			}
+			lastAdded, lastAt = info.EntriesAdded, now
+			r.updateScaling(ctx, rate)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Router) updateScaling(ctx context.Context, rate float64) {
+	groups, err := r.rdb.XInfoGroups(ctx, streamKey).Result()
+	if err != nil {
+		log.Printf("Failed to read consumer group info: %v", err)
+		return
+	}
+	sig := ScalingSignal{ArrivalPerSec: rate, UpdatedAt: time.Now().UTC()}
+	for _, g := range groups {
+		if g.Name == consumerGroup {
+			sig.Consumers, sig.Lag, sig.Pending = g.Consumers, g.Lag, g.Pending
+		}
+	}
+
+	latency := defaultLatency
+	if r.live != nil {
+		if ms := r.live.Snapshot(r.InFlight()).AvgLatencyMs; ms > 0 {
+			latency = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	sig.AvgLatencyMs = float64(latency.Milliseconds())
+
+	// Each replica answers one message at a time, so the load is the
+	// replicas kept busy by arrivals plus those needed to clear the backlog
+	busy := rate * latency.Seconds()
+	drain := float64(sig.Lag+sig.Pending) * latency.Seconds() / ScaleDrainTime.Seconds()
+	desired := int(math.Ceil((busy + drain) / ScaleUtilization))
+	sig.DesiredReplicas = max(ScaleMinReplicas, min(desired, ScaleMaxReplicas))
+
+	desiredReplicas.Set(float64(sig.DesiredReplicas))
+	streamLag.Set(float64(sig.Lag))
+	streamPending.Set(float64(sig.Pending))
+	streamConsumers.Set(float64(sig.Consumers))
+	r.scaling.Store(&sig)
+	r.ladder.ObserveLag(sig.Lag)
+}
+
+// Scaling returns the latest scaling signal, or nil before the first one is
+// computed.
+func (r *Router) Scaling() *ScalingSignal {
+	return r.scaling.Load()
+}
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"orchestrator/models"
+	"orchestrator/sla"
+)
+
+// EnableSLA times conversations against their tenant's SLA targets in t.
+func (r *Router) EnableSLA(t *sla.Tracker) {
+	r.sla = t
+}
+
+// startSLA starts the conversation's timers when the user first wrote,
+// which is when the channel adapter took the message, so time spent queued
+// counts against the targets.
+func (r *Router) startSLA(ctx context.Context, envelope *models.MessageEnvelope, received time.Time) {
+	at := envelope.Timestamp
+	if at.IsZero() || at.After(received) {
+		at = received
+	}
+	r.sla.Started(ctx, envelope.SessionID, envelope.TenantID, at)
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchestrator/backend"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+// deltaInterval batches the tokens of a streamed answer, so each one isn't
+// a pub/sub message of its own.
+const deltaInterval = 50 * time.Millisecond
+
+var streamedAnswers = metrics.NewCounterVec("orchestrator_streamed_answers_total",
+	"Answers requested as a stream, by outcome.", "outcome")
+
+// streamEvent is a line of cognitive-core's /chat/stream response: a delta,
+// the final response with Done set, or an error.
+type streamEvent struct {
+	models.ChatResponse
+	Delta string `json:"delta"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+}
+
+// callCore calls cognitive-core, streaming the answer to the session as
+// delta frames when the envelope asks for it. A structured answer comes
+// with the final message frame, after the deltas of the text it was built
+// from.
+func (r *Router) callCore(ctx context.Context, envelope *models.MessageEnvelope, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error) {
+	if !envelope.Stream {
+		return r.callCoalesced(ctx, be, req)
+	}
+	resp, err := r.callStream(ctx, envelope, be, req)
+	if errors.Is(err, errStreamUnsupported) {
+		// A cognitive-core deployment that cannot stream this request
+		streamedAnswers.Inc("unsupported")
+		return r.callCoalesced(ctx, be, req)
+	}
+	if err != nil {
+		streamedAnswers.Inc("error")
+		return nil, err
+	}
+	streamedAnswers.Inc("streamed")
+	return resp, nil
+}
+
+var errStreamUnsupported = errors.New("cognitive-core does not stream")
+
+// callStream is callCognitiveCore over /chat/stream. Deltas are the raw
+// generation; the message frame published afterwards carries the answer
+// as verified and styled, and is what clients should keep.
+func (r *Router) callStream(ctx context.Context, envelope *models.MessageEnvelope, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error) {
+	// The stream replaces the answer's split into numbered parts
+	req.Decompose = false
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/chat/stream", be.URL)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Deployments from before streaming, or before structured streaming,
+	// which refused a schema with 400
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest && len(req.ResponseSchema) > 0 {
+		return nil, errStreamUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := readLimited(resp.Body)
+		return nil, fmt.Errorf("cognitive-core returned %d: %s", resp.StatusCode, truncate(string(data), 512))
+	}
+
+	var pending strings.Builder
+	var flushed time.Time
+	flush := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		r.publishResponse(ctx, envelope.Channel, envelope.SessionID, models.WSResponse{
+			ID:        envelope.MessageID,
+			Type:      "delta",
+			Text:      pending.String(),
+			SessionID: envelope.SessionID,
+		})
+		pending.Reset()
+		flushed = time.Now()
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxResponseBytes)
+	for scanner.Scan() {
+		var ev streamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		switch {
+		case ev.Error != "":
+			return nil, fmt.Errorf("cognitive-core stream failed: %s", ev.Error)
+		case ev.Done:
+			flush()
+			chatResp := ev.ChatResponse
+			chatResp.Backend = be.Name
+			if v := resp.Header.Get("X-Backend-Version"); v != "" {
+				chatResp.Backend = fmt.Sprintf("%s@%s", be.Name, v)
+			}
+			return &chatResp, nil
+		case ev.Delta != "":
+			pending.WriteString(ev.Delta)
+			if time.Since(flushed) >= deltaInterval {
+				flush()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil, fmt.Errorf("cognitive-core stream ended without an answer")
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"time"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+var (
+	tenantMessages = metrics.NewCounterVec("orchestrator_tenant_messages_total",
+		"Messages handed to cognitive-core, by tenant and channel.", "tenant", "channel")
+	tenantLatency = metrics.NewHistogramVec("orchestrator_tenant_answer_seconds",
+		"Time from receiving a message to publishing its answer, by tenant.", metrics.DefBuckets, "tenant")
+	tenantTokens = metrics.NewCounterVec("orchestrator_tenant_tokens_total",
+		"Tokens spent answering, by tenant and kind (prompt or completion).", "tenant", "kind")
+	tenantErrors = metrics.NewCounterVec("orchestrator_tenant_errors_total",
+		"Messages answered with an error frame, by tenant and reason.", "tenant", "reason")
+)
+
+// EnableTenantMetrics labels per-tenant metrics with the tenant IDs l lets
+// through. Off by default, since tenant IDs come from the envelope.
+func (r *Router) EnableTenantMetrics(l *metrics.Limiter) {
+	r.tenants = l
+}
+
+func (r *Router) tenantMessage(envelope *models.MessageEnvelope) {
+	if r.tenants == nil {
+		return
+	}
+	tenantMessages.Inc(r.tenants.Value(envelope.TenantID), envelope.Channel)
+}
+
+func (r *Router) tenantAnswered(envelope *models.MessageEnvelope, chatResp *models.ChatResponse, took time.Duration) {
+	if r.tenants == nil {
+		return
+	}
+	tenant := r.tenants.Value(envelope.TenantID)
+	tenantLatency.Observe(took.Seconds(), tenant)
+	if u := chatResp.Usage; u != nil {
+		tenantTokens.Add(float64(u.PromptTokens), tenant, "prompt")
+		tenantTokens.Add(float64(u.CompletionTokens), tenant, "completion")
+	}
+}
+
+func (r *Router) tenantError(envelope *models.MessageEnvelope, reason string) {
+	if r.tenants == nil {
+		return
+	}
+	tenantErrors.Inc(r.tenants.Value(envelope.TenantID), reason)
+}
@@ -0,0 +1,342 @@
+// Package rules lets operators answer or steer messages deterministically
+// before they reach cognitive-core. A rule is a regular expression and an
+// action: reply with a template, tag the message, route it to a named flow,
+// or block it. Rules live in Redis and every replica reloads them as soon as
+// one is edited.
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/redisconn"
+)
+
+const (
+	Reply = "reply"
+	Tag   = "tag"
+	Route = "route"
+	Block = "block"
+
+	rulesKey = "rules"
+	// Edits are announced here so replicas reload without waiting a cycle
+	changedSignal = "rules:changed"
+	// Reload anyway in case a signal was missed while disconnected
+	reloadEvery = time.Minute
+)
+
+var hitsTotal = metrics.NewCounterVec("orchestrator_rule_hits_total",
+	"Messages matched by an operator rule, by rule and action.", "rule", "action")
+
+// Rule maps a pattern to an action. Reply and block stop evaluation; tag and
+// route apply and let later rules run, so a message can be tagged and then
+// answered. Rules run by descending Priority, then by ID.
+type Rule struct {
+	ID string `json:"id"`
+	// Pattern is a Go regular expression; prefix it with (?i) to ignore case.
+	Pattern  string   `json:"pattern"`
+	Action   string   `json:"action"`
+	Priority int      `json:"priority,omitempty"`
+	Tenants  []string `json:"tenants,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+	// Template is the reply for reply and block rules, rendered with
+	// .Match (the whole match), .Groups (named groups), .Channel and .Tenant.
+	// A block rule without one drops the message silently.
+	Template  string    `json:"template,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	Flow      string    `json:"flow,omitempty"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type compiledRule struct {
+	Rule
+	re   *regexp.Regexp
+	tmpl *template.Template
+}
+
+// Result is what the rules decided for a message. Reply is set, possibly
+// empty, when a reply or block rule matched.
+type Result struct {
+	Tags    []string `json:"tags,omitempty"`
+	Flow    string   `json:"flow,omitempty"`
+	Reply   *string  `json:"reply,omitempty"`
+	Blocked bool     `json:"blocked,omitempty"`
+	// Matched lists the IDs of every rule that applied, in order.
+	Matched []string `json:"matched,omitempty"`
+}
+
+// RuleID is the rule that stopped evaluation, or empty.
+func (r Result) RuleID() string {
+	if r.Reply == nil || len(r.Matched) == 0 {
+		return ""
+	}
+	return r.Matched[len(r.Matched)-1]
+}
+
+type Engine struct {
+	rdb   *redis.Client
+	flows map[string]string
+	rules atomic.Pointer[[]compiledRule]
+}
+
+// NewEngine routes matched messages to the cognitive-core URLs in flows,
+// keyed by flow name.
+func NewEngine(rdb *redis.Client, flows map[string]string) *Engine {
+	e := &Engine{rdb: rdb, flows: flows}
+	e.rules.Store(&[]compiledRule{})
+	return e
+}
+
+// FlowURL returns the cognitive-core URL for a flow.
+func (e *Engine) FlowURL(name string) (string, bool) {
+	url, ok := e.flows[name]
+	return url, ok
+}
+
+// Validate checks a rule before it is saved.
+func (e *Engine) Validate(r Rule) error {
+	_, err := e.compile(r)
+	return err
+}
+
+func (e *Engine) compile(r Rule) (compiledRule, error) {
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return compiledRule{}, fmt.Errorf("invalid pattern: %w", err)
+	}
+	c := compiledRule{Rule: r, re: re}
+	switch r.Action {
+	case Reply, Block:
+		if r.Action == Reply && strings.TrimSpace(r.Template) == "" {
+			return compiledRule{}, fmt.Errorf("reply rules need a template")
+		}
+		if r.Template != "" {
+			c.tmpl, err = template.New(r.ID).Option("missingkey=zero").Parse(r.Template)
+			if err != nil {
+				return compiledRule{}, fmt.Errorf("invalid template: %w", err)
+			}
+		}
+	case Tag:
+		if r.Tag == "" {
+			return compiledRule{}, fmt.Errorf("tag rules need a tag")
+		}
+	case Route:
+		if _, ok := e.flows[r.Flow]; !ok {
+			return compiledRule{}, fmt.Errorf("unknown flow %q", r.Flow)
+		}
+	default:
+		return compiledRule{}, fmt.Errorf("unknown action %q", r.Action)
+	}
+	return c, nil
+}
+
+func (e *Engine) List(ctx context.Context) ([]Rule, error) {
+	raw, err := e.rdb.HGetAll(ctx, rulesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+	out := make([]Rule, 0, len(raw))
+	for id, data := range raw {
+		var r Rule
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rule %s: %w", id, err)
+		}
+		out = append(out, r)
+	}
+	sortRules(out)
+	return out, nil
+}
+
+// Get returns nil if the rule does not exist.
+func (e *Engine) Get(ctx context.Context, id string) (*Rule, error) {
+	data, err := e.rdb.HGet(ctx, rulesKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rule: %w", err)
+	}
+	var r Rule
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rule: %w", err)
+	}
+	return &r, nil
+}
+
+// Put validates and saves r, replacing any rule with the same ID.
+func (e *Engine) Put(ctx context.Context, r Rule) error {
+	if err := e.Validate(r); err != nil {
+		return err
+	}
+	r.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rule: %w", err)
+	}
+	if err := e.rdb.HSet(ctx, rulesKey, r.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save rule: %w", err)
+	}
+	e.changed(ctx)
+	return nil
+}
+
+func (e *Engine) Delete(ctx context.Context, id string) (bool, error) {
+	n, err := e.rdb.HDel(ctx, rulesKey, id).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if n > 0 {
+		e.changed(ctx)
+	}
+	return n > 0, nil
+}
+
+func (e *Engine) changed(ctx context.Context) {
+	if err := e.Reload(ctx); err != nil {
+		log.Printf("Failed to reload rules: %v", err)
+	}
+	if err := e.rdb.Publish(ctx, changedSignal, "").Err(); err != nil {
+		log.Printf("Failed to announce rule change: %v", err)
+	}
+}
+
+// Reload replaces the active rules with those in Redis. Rules that no
+// longer compile, e.g. because their flow was removed, are skipped.
+func (e *Engine) Reload(ctx context.Context) error {
+	all, err := e.List(ctx)
+	if err != nil {
+		return err
+	}
+	compiled := make([]compiledRule, 0, len(all))
+	for _, r := range all {
+		if r.Disabled {
+			continue
+		}
+		c, err := e.compile(r)
+		if err != nil {
+			log.Printf("Skipping rule %s: %v", r.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	e.rules.Store(&compiled)
+	return nil
+}
+
+// Watch reloads rules whenever they change, until ctx is done.
+func (e *Engine) Watch(ctx context.Context) {
+	pubsub := e.rdb.Subscribe(ctx, changedSignal)
+	defer pubsub.Close()
+	ch := redisconn.Channel(pubsub)
+	ticker := time.NewTicker(reloadEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+		if err := e.Reload(ctx); err != nil {
+			log.Printf("Failed to reload rules: %v", err)
+		}
+	}
+}
+
+// Evaluate runs the active rules against a message.
+func (e *Engine) Evaluate(tenant, channel, text string) Result {
+	return e.evaluate(tenant, channel, text, true)
+}
+
+// DryRun is Evaluate without counting hits, for trying rules out.
+func (e *Engine) DryRun(tenant, channel, text string) Result {
+	return e.evaluate(tenant, channel, text, false)
+}
+
+func (e *Engine) evaluate(tenant, channel, text string, count bool) Result {
+	var res Result
+	if e == nil {
+		return res
+	}
+	for _, c := range *e.rules.Load() {
+		if len(c.Tenants) > 0 && !slices.Contains(c.Tenants, tenant) {
+			continue
+		}
+		if len(c.Channels) > 0 && !slices.Contains(c.Channels, channel) {
+			continue
+		}
+		m := c.re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		if count {
+			hitsTotal.Inc(c.ID, c.Action)
+		}
+		res.Matched = append(res.Matched, c.ID)
+		switch c.Action {
+		case Tag:
+			if !slices.Contains(res.Tags, c.Tag) {
+				res.Tags = append(res.Tags, c.Tag)
+			}
+		case Route:
+			if res.Flow == "" {
+				res.Flow = c.Flow
+			}
+		case Reply, Block:
+			reply := c.render(m, tenant, channel)
+			res.Reply = &reply
+			res.Blocked = c.Action == Block
+			return res
+		}
+	}
+	return res
+}
+
+func (c compiledRule) render(m []string, tenant, channel string) string {
+	if c.tmpl == nil {
+		return ""
+	}
+	groups := map[string]string{}
+	for i, name := range c.re.SubexpNames() {
+		if name != "" && i < len(m) {
+			groups[name] = m[i]
+		}
+	}
+	var buf bytes.Buffer
+	if err := c.tmpl.Execute(&buf, map[string]interface{}{
+		"Match":   m[0],
+		"Groups":  groups,
+		"Channel": channel,
+		"Tenant":  tenant,
+	}); err != nil {
+		log.Printf("Failed to render rule %s: %v", c.ID, err)
+		return c.Template
+	}
+	return buf.String()
+}
+
+func sortRules(rs []Rule) {
+	slices.SortFunc(rs, func(a, b Rule) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
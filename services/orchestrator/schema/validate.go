@@ -0,0 +1,125 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Validate checks data against the subset of JSON Schema that structured
+// output callers use in practice: type, properties, required, items, enum,
+// minItems/maxItems and minLength/maxLength. Unknown keywords are ignored.
+func Validate(schemaJSON, data json.RawMessage) error {
+	var s map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &s); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return validate(s, v, "$")
+}
+
+// Check reports whether schemaJSON is a usable schema object.
+func Check(schemaJSON json.RawMessage) error {
+	var s map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &s); err != nil {
+		return fmt.Errorf("schema must be a JSON object: %w", err)
+	}
+	if t, ok := s["type"].(string); ok && t != "object" {
+		return fmt.Errorf("top-level schema type must be object, got %q", t)
+	}
+	return nil
+}
+
+func validate(s map[string]interface{}, v interface{}, path string) error {
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+
+	t, _ := s["type"].(string)
+	switch t {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		if req, ok := s["required"].([]interface{}); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, ok := obj[name]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		props, _ := s["properties"].(map[string]interface{})
+		for name, sub := range props {
+			subSchema, ok := sub.(map[string]interface{})
+			val, present := obj[name]
+			if !ok || !present {
+				continue
+			}
+			if err := validate(subSchema, val, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if min, ok := s["minItems"].(float64); ok && float64(len(arr)) < min {
+			return fmt.Errorf("%s: expected at least %v items", path, min)
+		}
+		if max, ok := s["maxItems"].(float64); ok && float64(len(arr)) > max {
+			return fmt.Errorf("%s: expected at most %v items", path, max)
+		}
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+		n := float64(len([]rune(str)))
+		if min, ok := s["minLength"].(float64); ok && n < min {
+			return fmt.Errorf("%s: shorter than %v characters", path, min)
+		}
+		if max, ok := s["maxLength"].(float64); ok && n > max {
+			return fmt.Errorf("%s: longer than %v characters", path, max)
+		}
+	case "integer":
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	case "null":
+		if v != nil {
+			return fmt.Errorf("%s: expected null", path)
+		}
+	}
+	return nil
+}
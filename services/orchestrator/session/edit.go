@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	"orchestrator/archive"
+	"orchestrator/models"
+)
+
+var ErrMessageNotFound = errors.New("message is not in the conversation's context")
+
+// Edit replaces the text of one of the user's messages, named by t.Edits,
+// with t.Content. When it is the user's latest message the message and its
+// answer are dropped instead and regenerate is true: the caller answers t in
+// their place, which records it. Otherwise t is recorded in the transcript
+// and the answers that followed the message stay.
+func (m *Manager) Edit(ctx context.Context, sessionID string, t archive.Turn) (regenerate bool, err error) {
+	sessionID = m.resolve(ctx, sessionID)
+	history, err := m.LoadHistory(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	i := userMessage(history, t.Edits)
+	if i < 0 {
+		return false, ErrMessageNotFound
+	}
+	if userMessage(history[i+1:], "") < 0 {
+		return true, m.SaveHistory(ctx, sessionID, history[:i])
+	}
+
+	if err := m.transcripts.Append(ctx, sessionID, t); err != nil {
+		return false, err
+	}
+	history[i].Content = t.Content
+	return false, m.SaveHistory(ctx, sessionID, history)
+}
+
+// Delete withdraws one of the user's messages, named by t.Edits, and its
+// answer from the prompt context. The transcript keeps both and records t.
+func (m *Manager) Delete(ctx context.Context, sessionID string, t archive.Turn) error {
+	sessionID = m.resolve(ctx, sessionID)
+	history, err := m.LoadHistory(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if userMessage(history, t.Edits) < 0 {
+		return ErrMessageNotFound
+	}
+
+	if err := m.transcripts.Append(ctx, sessionID, t); err != nil {
+		return err
+	}
+	kept := history[:0]
+	for _, msg := range history {
+		// The answer shares the question's message ID
+		if msg.MessageID != t.Edits {
+			kept = append(kept, msg)
+		}
+	}
+	return m.SaveHistory(ctx, sessionID, kept)
+}
+
+// userMessage returns the index of the user's message with the given ID, or
+// of their first message when id is empty, and -1 if there is none.
+func userMessage(history []models.ConversationMessage, id string) int {
+	for i, msg := range history {
+		if msg.Role == "user" && (id == "" || msg.MessageID == id) {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,26 +3,48 @@ package session
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"orchestrator/archive"
 	"orchestrator/models"
+	"orchestrator/region"
 )
 
 const (
 	sessionTTL     = 24 * time.Hour
-	maxMessages    = 10
+	// maxMessages caps the prompt context even when turns are short
+	maxMessages    = 40
 	sessionPrefix  = "session:"
 )
 
+// ContextTokens is the approximate token budget for the prompt context.
+// Older turns beyond it are dropped from the prompt and kept only in the
+// transcript.
+var ContextTokens = 2000
+
+// Manager keeps two records of every session: the compact prompt context
+// under session:{id}, which is trimmed to fit the LLM, and the full
+// transcript in the archive, which is never truncated.
 type Manager struct {
-	rdb *redis.Client
+	rdb         *redis.Client
+	transcripts *archive.Store
+	region      *region.Coordinator
+	replicator  *region.Replicator
+}
+
+func NewManager(rdb *redis.Client, transcripts *archive.Store) *Manager {
+	return &Manager{rdb: rdb, transcripts: transcripts}
 }
 
-func NewManager(rdb *redis.Client) *Manager {
-	return &Manager{rdb: rdb}
+// EnableRegion fences session writes with the region's epoch and replicates
+// them to the standby region when repl is non-nil.
+func (m *Manager) EnableRegion(coord *region.Coordinator, repl *region.Replicator) {
+	m.region = coord
+	m.replicator = repl
 }
 
 func (m *Manager) LoadHistory(ctx context.Context, sessionID string) ([]models.ConversationMessage, error) {
@@ -54,22 +76,109 @@ func (m *Manager) SaveHistory(ctx context.Context, sessionID string, history []m
 	}
 
 	key := fmt.Sprintf("%s%s", sessionPrefix, sessionID)
-	if err := m.rdb.Set(ctx, key, data, sessionTTL).Err(); err != nil {
+	return m.write(ctx, key, data)
+}
+
+// write stores a session key, fenced and replicated in multi-region mode.
+func (m *Manager) write(ctx context.Context, key string, data []byte) error {
+	if m.region == nil {
+		if err := m.rdb.Set(ctx, key, data, sessionTTL).Err(); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+		return nil
+	}
+
+	if err := m.region.FencedSet(ctx, m.rdb, key, data, sessionTTL.Milliseconds()); err != nil {
+		if errors.Is(err, region.ErrFenced) {
+			m.region.Demote("local session write was fenced")
+		}
 		return fmt.Errorf("failed to save session: %w", err)
 	}
+	m.replicator.Replicate(key, data, sessionTTL)
 	return nil
 }
 
-func (m *Manager) AppendMessages(ctx context.Context, sessionID string, userMsg, assistantMsg string) error {
+// TraceExternal indexes a platform message ID against our message, so the
+// message can be found even if processing fails before it is recorded.
+func (m *Manager) TraceExternal(ctx context.Context, ref archive.ExternalRef) error {
+	return m.transcripts.IndexExternal(ctx, ref)
+}
+
+// Record appends turns to the session. The transcript is written first: if
+// it fails nothing is recorded, so the prompt context never holds turns the
+// authoritative record lacks.
+func (m *Manager) Record(ctx context.Context, sessionID string, turns ...archive.Turn) error {
+	sessionID = m.resolve(ctx, sessionID)
+	if err := m.transcripts.Append(ctx, sessionID, turns...); err != nil {
+		return err
+	}
+
 	history, err := m.LoadHistory(ctx, sessionID)
 	if err != nil {
 		return err
 	}
+	if len(history) == 0 {
+		// A conversation resumed after its session expired picks up its
+		// context again from the transcript, which now ends with turns
+		if past, err := m.transcripts.Load(ctx, sessionID); err == nil && len(past) > len(turns) {
+			turns = archive.ApplyRevisions(sinceReset(past))
+		}
+	}
+	seg, err := m.loadSegments(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	for _, t := range turns {
+		msg := models.ConversationMessage{
+			Role: t.Role, Content: t.Content, Topic: seg.Active,
+			MessageID: t.MessageID, ModelUsed: t.ModelUsed, LatencyMS: t.LatencyMS,
+			PromptTokens: t.PromptTokens, CompletionTokens: t.CompletionTokens,
+		}
+		if !t.Timestamp.IsZero() {
+			ts := t.Timestamp
+			msg.Timestamp = &ts
+		}
+		history = append(history, msg)
+	}
 
-	history = append(history,
-		models.ConversationMessage{Role: "user", Content: userMsg},
-		models.ConversationMessage{Role: "assistant", Content: assistantMsg},
-	)
-
+	history, dropped := fitBudget(history, ContextTokens)
+	if seg.remember(dropped) {
+		if err := m.saveSegments(ctx, sessionID, seg); err != nil {
+			return err
+		}
+	}
 	return m.SaveHistory(ctx, sessionID, history)
 }
+
+// estimateTokens is a rough count for budgeting: about four characters per
+// token for Latin text, and fewer for Devanagari, which tokenizes worse.
+func estimateTokens(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x0900 && r <= 0x097F {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return (n + 3) / 4
+}
+
+// fitBudget drops the oldest messages until history fits in budget tokens.
+// The latest exchange is always kept.
+func fitBudget(history []models.ConversationMessage, budget int) ([]models.ConversationMessage, []models.ConversationMessage) {
+	total := 0
+	keep := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		total += estimateTokens(history[i].Content)
+		if (total > budget || len(history)-i > maxMessages) && len(history)-i > 2 {
+			break
+		}
+		keep = i
+	}
+	// Don't open the prompt with an answer to a question that was dropped
+	if keep > 0 && keep < len(history)-2 && history[keep].Role == "assistant" {
+		keep++
+	}
+	return history[keep:], history[:keep]
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+var ErrSameSession = errors.New("sessions are already the same conversation")
+
+// MergeResult describes a completed merge.
+type MergeResult struct {
+	SessionID  string   `json:"session_id"`
+	MergedFrom string   `json:"merged_from"`
+	Turns      int      `json:"turns"`
+	Users      []string `json:"rebound_users,omitempty"`
+}
+
+// resolve follows merge aliases, so a tab still connected with a merged-away
+// session ID keeps adding to the canonical conversation.
+func (m *Manager) resolve(ctx context.Context, sessionID string) string {
+	id, err := m.transcripts.Resolve(ctx, sessionID)
+	if err != nil {
+		log.Printf("Failed to resolve session %s: %v", sessionID, err)
+	}
+	return id
+}
+
+// Merge folds the duplicate session into the canonical one, for a user who
+// ended up with two (cleared cookies, a second tab). The transcripts are
+// interleaved by time; the prompt context stays on the canonical session's
+// topic with the duplicate's topics summarized, unless the canonical session
+// is still empty, in which case it takes over the duplicate's context. Users
+// last seen on the duplicate are rebound to the canonical session.
+func (m *Manager) Merge(ctx context.Context, canonicalID, duplicateID string) (*MergeResult, error) {
+	canonicalID, duplicateID = m.resolve(ctx, canonicalID), m.resolve(ctx, duplicateID)
+	if canonicalID == duplicateID {
+		return nil, ErrSameSession
+	}
+
+	turns, err := m.transcripts.Merge(ctx, canonicalID, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.mergeContext(ctx, canonicalID, duplicateID); err != nil {
+		return nil, err
+	}
+
+	res := &MergeResult{SessionID: canonicalID, MergedFrom: duplicateID, Turns: len(turns)}
+	seen := map[string]bool{}
+	for _, t := range turns {
+		if seen[t.UserID] {
+			continue
+		}
+		seen[t.UserID] = true
+		b, err := m.LookupUser(ctx, t.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil || b.SessionID != duplicateID {
+			continue
+		}
+		if err := m.BindUser(ctx, t.UserID, canonicalID, b.Channel); err != nil {
+			return nil, err
+		}
+		res.Users = append(res.Users, t.UserID)
+	}
+	return res, nil
+}
+
+func (m *Manager) mergeContext(ctx context.Context, canonicalID, duplicateID string) error {
+	history, err := m.LoadHistory(ctx, canonicalID)
+	if err != nil {
+		return err
+	}
+	seg, err := m.loadSegments(ctx, canonicalID)
+	if err != nil {
+		return err
+	}
+	dupHistory, err := m.LoadHistory(ctx, duplicateID)
+	if err != nil {
+		return err
+	}
+	dupSeg, err := m.loadSegments(ctx, duplicateID)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		history, seg = dupHistory, dupSeg
+	} else {
+		closed := dupSeg.Closed
+		if dupSeg.Opening != "" {
+			closed = append(closed, truncate(dupSeg.Opening, maxOpeningLength))
+		}
+		seg.Closed = append(closed, seg.Closed...)
+		if len(seg.Closed) > maxClosedTopics {
+			seg.Closed = seg.Closed[len(seg.Closed)-maxClosedTopics:]
+		}
+	}
+	if err := m.saveSegments(ctx, canonicalID, seg); err != nil {
+		return err
+	}
+	return m.SaveHistory(ctx, canonicalID, history)
+}
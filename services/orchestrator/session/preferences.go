@@ -0,0 +1,46 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const preferencesSuffix = ":prefs"
+
+// Preferences are what the user asked for with slash commands. Zero fields
+// leave the channel's defaults alone. Like the rest of the session they
+// expire a day after they were set.
+type Preferences struct {
+	Language string `json:"language,omitempty"`
+	Persona  string `json:"persona,omitempty"`
+}
+
+// Preferences and SetPreferences follow merges to the canonical session,
+// as Reset does.
+func (m *Manager) Preferences(ctx context.Context, sessionID string) (Preferences, error) {
+	sessionID = m.resolve(ctx, sessionID)
+	var p Preferences
+	data, err := m.rdb.Get(ctx, sessionPrefix+sessionID+preferencesSuffix).Bytes()
+	if err == redis.Nil {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to load preferences: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("failed to unmarshal preferences: %w", err)
+	}
+	return p, nil
+}
+
+func (m *Manager) SetPreferences(ctx context.Context, sessionID string, p Preferences) error {
+	sessionID = m.resolve(ctx, sessionID)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+	return m.write(ctx, sessionPrefix+sessionID+preferencesSuffix, data)
+}
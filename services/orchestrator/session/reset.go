@@ -0,0 +1,36 @@
+package session
+
+import (
+	"context"
+	"slices"
+
+	"orchestrator/archive"
+)
+
+// ResetTag marks the transcript turn of a /reset.
+const ResetTag = "reset"
+
+// Reset starts the conversation over: the prompt context and its topics are
+// cleared, and t, tagged ResetTag, is recorded in the transcript, which keeps
+// the earlier turns but no longer gives them back as context.
+func (m *Manager) Reset(ctx context.Context, sessionID string, t archive.Turn) error {
+	sessionID = m.resolve(ctx, sessionID)
+	t.Tags = append(t.Tags, ResetTag)
+	if err := m.transcripts.Append(ctx, sessionID, t); err != nil {
+		return err
+	}
+	if err := m.saveSegments(ctx, sessionID, segments{}); err != nil {
+		return err
+	}
+	return m.SaveHistory(ctx, sessionID, nil)
+}
+
+// sinceReset returns the turns after the transcript's last reset.
+func sinceReset(turns []archive.Turn) []archive.Turn {
+	for i := len(turns) - 1; i >= 0; i-- {
+		if slices.Contains(turns[i].Tags, ResetTag) {
+			return turns[i+1:]
+		}
+	}
+	return turns
+}
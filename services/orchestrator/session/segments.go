@@ -0,0 +1,213 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/models"
+)
+
+const (
+	segmentsSuffix = ":segments"
+	// A message sharing less than this fraction of its words with the active
+	// topic's recent turns starts a new topic.
+	shiftOverlap     = 0.15
+	minShiftWords    = 3
+	maxClosedTopics  = 5
+	maxEarlierTurns  = 5
+	maxOpeningLength = 120
+)
+
+var (
+	shiftPhrases = []string{"another question", "different question", "new question", "change topic", "unrelated", "by the way", "btw"}
+	followUps    = map[string]bool{"it": true, "its": true, "that": true, "this": true, "those": true, "these": true, "they": true, "them": true, "and": true, "what about": true, "how about": true}
+	stopwords    = map[string]bool{
+		"the": true, "and": true, "for": true, "are": true, "you": true, "your": true, "can": true, "what": true, "which": true,
+		"how": true, "does": true, "have": true, "has": true, "with": true, "about": true, "there": true, "any": true, "tell": true,
+		"please": true, "much": true, "many": true, "from": true, "this": true, "that": true, "into": true, "like": true, "would": true,
+		"should": true, "could": true, "will": true, "was": true, "were": true, "not": true, "yes": true, "want": true, "know": true,
+	}
+)
+
+// segments tracks which topic the conversation is on. History messages are
+// tagged with the topic they belong to; earlier topics are kept only as
+// one-line summaries, as are active-topic questions trimmed from the prompt
+// context.
+type segments struct {
+	Active  int      `json:"active"`
+	Opening string   `json:"opening"`
+	Closed  []string `json:"closed,omitempty"`
+	Earlier []string `json:"earlier,omitempty"`
+}
+
+// remember keeps a line for each active-topic question in dropped. Closed
+// topics are already summarized. It reports whether anything was added.
+func (s *segments) remember(dropped []models.ConversationMessage) bool {
+	added := false
+	for _, msg := range dropped {
+		if msg.Role == "user" && msg.Topic == s.Active {
+			s.Earlier = append(s.Earlier, truncate(msg.Content, maxOpeningLength))
+			added = true
+		}
+	}
+	if len(s.Earlier) > maxEarlierTurns {
+		s.Earlier = s.Earlier[len(s.Earlier)-maxEarlierTurns:]
+	}
+	return added
+}
+
+func segmentsKey(sessionID string) string {
+	return sessionPrefix + sessionID + segmentsSuffix
+}
+
+func (m *Manager) loadSegments(ctx context.Context, sessionID string) (segments, error) {
+	var s segments
+	data, err := m.rdb.Get(ctx, segmentsKey(sessionID)).Bytes()
+	if err == redis.Nil {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to load segments: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to unmarshal segments: %w", err)
+	}
+	return s, nil
+}
+
+func (m *Manager) saveSegments(ctx context.Context, sessionID string, s segments) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal segments: %w", err)
+	}
+	return m.write(ctx, segmentsKey(sessionID), data)
+}
+
+// Segment decides whether text continues the active topic or starts a new
+// one, based on word overlap with the active topic's recent turns. Call it
+// for each user message before ActiveContext and Record.
+func (m *Manager) Segment(ctx context.Context, sessionID, text string) error {
+	sessionID = m.resolve(ctx, sessionID)
+	seg, err := m.loadSegments(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	history, err := m.LoadHistory(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	var vocab []string
+	for _, msg := range history {
+		if msg.Topic == seg.Active {
+			vocab = append(vocab, msg.Content)
+		}
+	}
+
+	switch {
+	case seg.Opening == "":
+		seg.Opening = text
+	case isShift(text, words(strings.Join(vocab, " "))):
+		seg.Closed = append(seg.Closed, truncate(seg.Opening, maxOpeningLength))
+		if len(seg.Closed) > maxClosedTopics {
+			seg.Closed = seg.Closed[len(seg.Closed)-maxClosedTopics:]
+		}
+		seg.Active++
+		seg.Opening = text
+		seg.Earlier = nil
+	default:
+		return nil
+	}
+	return m.saveSegments(ctx, sessionID, seg)
+}
+
+// ActiveContext returns only the active topic's turns, ready for the prompt,
+// plus a summary of the earlier topics in this session.
+func (m *Manager) ActiveContext(ctx context.Context, sessionID string) ([]models.ConversationMessage, string, error) {
+	sessionID = m.resolve(ctx, sessionID)
+	history, err := m.LoadHistory(ctx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	seg, err := m.loadSegments(ctx, sessionID)
+	if err != nil {
+		return history, "", err
+	}
+
+	active := make([]models.ConversationMessage, 0, len(history))
+	for _, msg := range history {
+		if msg.Topic == seg.Active {
+			active = append(active, msg.Prompt())
+		}
+	}
+	var parts []string
+	if len(seg.Closed) > 0 {
+		parts = append(parts, "Earlier in this conversation the user asked about: "+strings.Join(seg.Closed, "; ")+".")
+	}
+	if len(seg.Earlier) > 0 {
+		parts = append(parts, "Earlier on this topic the user asked: "+strings.Join(seg.Earlier, "; ")+".")
+	}
+	summary := strings.Join(parts, " ")
+	return active, summary, nil
+}
+
+func isShift(text string, vocab map[string]bool) bool {
+	norm := " " + strings.Join(strings.Fields(strings.ToLower(text)), " ") + " "
+	for _, p := range shiftPhrases {
+		if strings.Contains(norm, " "+p+" ") {
+			return true
+		}
+	}
+	if len(vocab) == 0 {
+		return false
+	}
+	for p := range followUps {
+		if strings.HasPrefix(norm, " "+p+" ") {
+			return false
+		}
+	}
+
+	msg := words(text)
+	if len(msg) < minShiftWords {
+		return false
+	}
+	shared := 0
+	for w := range msg {
+		if vocab[w] {
+			shared++
+		}
+	}
+	return float64(shared)/float64(len(msg)) < shiftOverlap
+}
+
+// words returns the content words of s. Short ASCII words and stopwords are
+// dropped; Devanagari words are kept regardless of length.
+func words(s string) map[string]bool {
+	out := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	}) {
+		if stopwords[w] {
+			continue
+		}
+		if len(w) < 3 && utf8.RuneCountInString(w) == len(w) {
+			continue
+		}
+		out[w] = true
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n]) + "…"
+}
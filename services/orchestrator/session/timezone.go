@@ -0,0 +1,47 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	// The alpine image has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const timeZoneSuffix = ":tz"
+
+// DefaultTimeZone is assumed for sessions whose zone was never revealed;
+// main sets it from the environment. nil leaves the zone out.
+var DefaultTimeZone *time.Location
+
+// TimeZone returns the session's time zone. A hint from the channel, such
+// as the widget's browser zone, replaces the stored one, so a user who
+// travels gets their current clock; messages without a hint keep it.
+func (m *Manager) TimeZone(ctx context.Context, sessionID, hint string) (*time.Location, error) {
+	key := sessionPrefix + sessionID + timeZoneSuffix
+	if hint != "" {
+		loc, err := time.LoadLocation(hint)
+		if err == nil && hint != "Local" {
+			if err := m.write(ctx, key, []byte(loc.String())); err != nil {
+				return loc, err
+			}
+			return loc, nil
+		}
+		log.Printf("Ignoring unknown time zone %q for session %s", hint, sessionID)
+	}
+	name, err := m.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return DefaultTimeZone, nil
+	}
+	if err != nil {
+		return DefaultTimeZone, fmt.Errorf("failed to load time zone: %w", err)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return DefaultTimeZone, nil
+	}
+	return loc, nil
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	userPrefix = "user:"
+	userTTL    = 90 * 24 * time.Hour
+)
+
+// UserBinding is the most recent session and channel seen for a user.
+type UserBinding struct {
+	SessionID string `redis:"session_id"`
+	Channel   string `redis:"channel"`
+}
+
+// BindUser remembers the user's latest session and channel so external
+// triggers can resume the conversation where the user last was.
+func (m *Manager) BindUser(ctx context.Context, userID, sessionID, channel string) error {
+	if userID == "" || userID == "anonymous" {
+		return nil
+	}
+	key := userPrefix + userID
+	pipe := m.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "session_id", sessionID, "channel", channel)
+	pipe.Expire(ctx, key, userTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to bind user: %w", err)
+	}
+	return nil
+}
+
+// LookupUser returns the user's binding, or nil if the user is unknown.
+func (m *Manager) LookupUser(ctx context.Context, userID string) (*UserBinding, error) {
+	var b UserBinding
+	res := m.rdb.HGetAll(ctx, userPrefix+userID)
+	if err := res.Err(); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if len(res.Val()) == 0 {
+		return nil, nil
+	}
+	if err := res.Scan(&b); err != nil {
+		return nil, fmt.Errorf("failed to scan user binding: %w", err)
+	}
+	return &b, nil
+}
@@ -0,0 +1,174 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/backend"
+	"orchestrator/metrics"
+	"orchestrator/models"
+)
+
+const (
+	resultsStream = "shadow:results"
+	resultsMaxLen = 10000
+	shadowTimeout = 90 * time.Second
+	maxConcurrent = 8
+)
+
+var (
+	shadowRequests = metrics.NewCounterVec("orchestrator_shadow_requests_total",
+		"Mirrored requests to the shadow backend by outcome.", "outcome")
+	shadowLatency = metrics.NewHistogramVec("orchestrator_shadow_latency_seconds",
+		"Shadow backend latency.", metrics.DefBuckets)
+)
+
+// CallFunc performs a chat request against a backend.
+type CallFunc func(ctx context.Context, be backend.Backend, req models.ChatRequest) (*models.ChatResponse, error)
+
+// Result is one primary/shadow comparison written to the results stream.
+type Result struct {
+	SessionID       string    `json:"session_id"`
+	MessageID       string    `json:"message_id"`
+	Message         string    `json:"message"`
+	PrimaryResponse string    `json:"primary_response"`
+	ShadowResponse  string    `json:"shadow_response,omitempty"`
+	ShadowError     string    `json:"shadow_error,omitempty"`
+	PrimaryModel    string    `json:"primary_model"`
+	ShadowModel     string    `json:"shadow_model,omitempty"`
+	PrimaryMs       int64     `json:"primary_ms"`
+	ShadowMs        int64     `json:"shadow_ms"`
+	Overlap         float64   `json:"overlap"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// Mirror duplicates a sample of chat requests to a secondary backend. Shadow
+// responses are only recorded for offline comparison and are never delivered.
+type Mirror struct {
+	rdb     *redis.Client
+	backend backend.Backend
+	percent uint32
+	call    CallFunc
+	sem     chan struct{}
+}
+
+func NewMirror(rdb *redis.Client, url string, percent int, call CallFunc) *Mirror {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return &Mirror{
+		rdb:     rdb,
+		backend: backend.Backend{Name: "shadow", URL: url},
+		percent: uint32(percent),
+		call:    call,
+		sem:     make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (m *Mirror) Enabled() bool {
+	return m != nil && m.backend.URL != "" && m.percent > 0
+}
+
+// Submit mirrors req asynchronously if the session falls in the sample. It
+// never blocks the caller: when too many shadow calls are in flight the
+// request is dropped.
+func (m *Mirror) Submit(messageID string, req models.ChatRequest, primary *models.ChatResponse, primaryLatency time.Duration) {
+	if !m.Enabled() || !m.sampled(req.SessionID) {
+		return
+	}
+	select {
+	case m.sem <- struct{}{}:
+	default:
+		shadowRequests.Inc("dropped")
+		return
+	}
+
+	go func() {
+		defer func() { <-m.sem }()
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+
+		start := time.Now()
+		resp, err := m.call(ctx, m.backend, req)
+		elapsed := time.Since(start)
+		shadowLatency.Observe(elapsed.Seconds())
+
+		res := Result{
+			SessionID:       req.SessionID,
+			MessageID:       messageID,
+			Message:         req.Message,
+			PrimaryResponse: primary.Response,
+			PrimaryModel:    primary.ModelUsed,
+			PrimaryMs:       primaryLatency.Milliseconds(),
+			ShadowMs:        elapsed.Milliseconds(),
+			Timestamp:       time.Now().UTC(),
+		}
+		if err != nil {
+			shadowRequests.Inc("error")
+			res.ShadowError = err.Error()
+		} else {
+			shadowRequests.Inc("ok")
+			res.ShadowResponse = resp.Response
+			res.ShadowModel = resp.ModelUsed
+			res.Overlap = wordOverlap(primary.Response, resp.Response)
+		}
+		m.record(ctx, res)
+	}()
+}
+
+func (m *Mirror) sampled(sessionID string) bool {
+	h := fnv.New32a()
+	h.Write([]byte("shadow:" + sessionID))
+	return h.Sum32()%100 < m.percent
+}
+
+func (m *Mirror) record(ctx context.Context, res Result) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("Failed to marshal shadow result: %v", err)
+		return
+	}
+	if err := m.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: resultsStream,
+		MaxLen: resultsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"result": string(data)},
+	}).Err(); err != nil {
+		log.Printf("Failed to record shadow result: %v", err)
+	}
+}
+
+// wordOverlap is the Jaccard similarity of the two responses' word sets, a
+// cheap first signal for how far the shadow model diverges.
+func wordOverlap(a, b string) float64 {
+	wa := wordSet(a)
+	wb := wordSet(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	inter := 0
+	for w := range wa {
+		if wb[w] {
+			inter++
+		}
+	}
+	union := len(wa) + len(wb) - inter
+	return float64(inter) / float64(union)
+}
+
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(strings.ToLower(s)) {
+		set[strings.Trim(w, ".,!?;:\"'()")] = true
+	}
+	return set
+}
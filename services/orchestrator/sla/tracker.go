@@ -0,0 +1,412 @@
+// Package sla times conversations against their tenant's service-level
+// targets: how long the user waits for a first answer, how long until the
+// conversation is resolved, and, once handed off, how long until an agent
+// picks it up. Timers live in Redis so any replica can stop them; a target
+// missed is reported once, as a breach event on sla:events.
+package sla
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+// Timer kinds
+const (
+	FirstResponse = "first_response"
+	Resolution    = "resolution"
+	Pickup        = "pickup"
+)
+
+const (
+	DefaultTenant = "default"
+
+	timersPrefix  = "sla:"
+	deadlinesKey  = "sla:deadlines"
+	eventsStream  = "sla:events"
+	eventsMaxLen  = 10000
+	sweepInterval = 15 * time.Second
+)
+
+// Retention is how long an unresolved conversation's timers are kept after
+// it started.
+var Retention = 7 * 24 * time.Hour
+
+var (
+	elapsedSeconds = metrics.NewHistogramVec("orchestrator_sla_seconds",
+		"Time to first response, resolution and agent pickup, by tenant.",
+		[]float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600, 4 * 3600, 24 * 3600}, "tenant", "kind")
+	breachesTotal = metrics.NewCounterVec("orchestrator_sla_breaches_total",
+		"SLA targets missed, by tenant and kind.", "tenant", "kind")
+)
+
+// Targets are the longest each timer may run, in seconds; 0 means no target.
+type Targets struct {
+	FirstResponse int `json:"first_response_seconds,omitempty"`
+	Resolution    int `json:"resolution_seconds,omitempty"`
+	Pickup        int `json:"pickup_seconds,omitempty"`
+}
+
+// merge overlays the targets set in o on t.
+func (t Targets) merge(o Targets) Targets {
+	if o.FirstResponse > 0 {
+		t.FirstResponse = o.FirstResponse
+	}
+	if o.Resolution > 0 {
+		t.Resolution = o.Resolution
+	}
+	if o.Pickup > 0 {
+		t.Pickup = o.Pickup
+	}
+	return t
+}
+
+func (t Targets) of(kind string) time.Duration {
+	switch kind {
+	case FirstResponse:
+		return time.Duration(t.FirstResponse) * time.Second
+	case Resolution:
+		return time.Duration(t.Resolution) * time.Second
+	case Pickup:
+		return time.Duration(t.Pickup) * time.Second
+	}
+	return 0
+}
+
+// Config is the SLA_TARGETS file. A tenant's targets override the default
+// ones they set.
+type Config struct {
+	Default Targets            `json:"default"`
+	Tenants map[string]Targets `json:"tenants"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SLA targets: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse SLA targets: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Timers are a conversation's SLA clocks. Unset times have not happened.
+type Timers struct {
+	SessionID  string    `json:"session_id"`
+	Tenant     string    `json:"tenant"`
+	Targets    Targets   `json:"targets"`
+	StartedAt  time.Time `json:"started_at"`
+	Responded  time.Time `json:"first_response_at,omitempty"`
+	HandedOff  time.Time `json:"handed_off_at,omitempty"`
+	PickedUp   time.Time `json:"picked_up_at,omitempty"`
+	Agent      string    `json:"agent,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+	// Breached lists the kinds whose target was missed
+	Breached []string `json:"breached,omitempty"`
+}
+
+type Tracker struct {
+	rdb *redis.Client
+	cfg Config
+}
+
+func NewTracker(rdb *redis.Client, cfg Config) (*Tracker, error) {
+	check := func(where string, t Targets) error {
+		if t.FirstResponse < 0 || t.Resolution < 0 || t.Pickup < 0 {
+			return fmt.Errorf("%s: targets must not be negative", where)
+		}
+		return nil
+	}
+	if err := check("default", cfg.Default); err != nil {
+		return nil, err
+	}
+	for tenant, t := range cfg.Tenants {
+		if err := check("tenant "+tenant, t); err != nil {
+			return nil, err
+		}
+	}
+	return &Tracker{rdb: rdb, cfg: cfg}, nil
+}
+
+// tenant is the tenant whose targets apply, which also labels metrics:
+// tenants without their own targets are counted under "default".
+func (t *Tracker) tenant(id string) string {
+	if _, ok := t.cfg.Tenants[id]; ok {
+		return id
+	}
+	return DefaultTenant
+}
+
+func (t *Tracker) targets(tenant string) Targets {
+	return t.cfg.Default.merge(t.cfg.Tenants[tenant])
+}
+
+// Started starts the first-response and resolution timers of the session's
+// conversation at its first message. Later messages leave running timers
+// alone; one after the conversation was resolved starts a new one. It is
+// nil-safe.
+func (t *Tracker) Started(ctx context.Context, sessionID, tenantID string, at time.Time) {
+	if t == nil {
+		return
+	}
+	tenant := t.tenant(tenantID)
+	key := timersPrefix + sessionID
+	started, err := t.rdb.HSetNX(ctx, key, "started", at.UnixMilli()).Result()
+	if err != nil {
+		log.Printf("Failed to start SLA timers of session %s: %v", sessionID, err)
+		return
+	}
+	if !started {
+		return
+	}
+	targets := t.targets(tenant)
+	pipe := t.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "tenant", tenant)
+	pipe.Expire(ctx, key, Retention)
+	t.schedule(ctx, pipe, sessionID, FirstResponse, at, targets)
+	t.schedule(ctx, pipe, sessionID, Resolution, at, targets)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to start SLA timers of session %s: %v", sessionID, err)
+	}
+}
+
+// Responded stops the first-response timer when the conversation's first
+// answer is published. It is nil-safe.
+func (t *Tracker) Responded(ctx context.Context, sessionID string, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.stop(ctx, sessionID, FirstResponse, "responded", "started", at)
+}
+
+// HandedOff starts the pickup timer when the conversation is handed to a
+// person. It is nil-safe.
+func (t *Tracker) HandedOff(ctx context.Context, sessionID string, at time.Time) {
+	if t == nil {
+		return
+	}
+	key := timersPrefix + sessionID
+	// A conversation handed off before the user wrote starts here
+	t.Started(ctx, sessionID, "", at)
+	set, err := t.rdb.HSetNX(ctx, key, "handoff", at.UnixMilli()).Result()
+	if err != nil {
+		log.Printf("Failed to start SLA pickup timer of session %s: %v", sessionID, err)
+		return
+	}
+	if !set {
+		return
+	}
+	tenant, err := t.rdb.HGet(ctx, key, "tenant").Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to start SLA pickup timer of session %s: %v", sessionID, err)
+		return
+	}
+	pipe := t.rdb.TxPipeline()
+	t.schedule(ctx, pipe, sessionID, Pickup, at, t.targets(t.tenant(tenant)))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to start SLA pickup timer of session %s: %v", sessionID, err)
+	}
+}
+
+// PickedUp stops the pickup timer when an agent takes the handed-off
+// conversation. It reports false if the conversation was not handed off.
+func (t *Tracker) PickedUp(ctx context.Context, sessionID, agent string, at time.Time) (bool, error) {
+	key := timersPrefix + sessionID
+	handoff, err := t.rdb.HExists(ctx, key, "handoff").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to load SLA timers: %w", err)
+	}
+	if !handoff {
+		return false, nil
+	}
+	if t.stop(ctx, sessionID, Pickup, "picked_up", "handoff", at) {
+		t.rdb.HSet(ctx, key, "agent", agent)
+	}
+	return true, nil
+}
+
+// Resolved stops the conversation's timers. Its next message starts a new
+// conversation. It reports false if no conversation was running.
+func (t *Tracker) Resolved(ctx context.Context, sessionID string, at time.Time) (bool, error) {
+	key := timersPrefix + sessionID
+	started, err := t.rdb.HExists(ctx, key, "started").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to load SLA timers: %w", err)
+	}
+	if !started {
+		return false, nil
+	}
+	if !t.stop(ctx, sessionID, Resolution, "resolved", "started", at) {
+		// Resolved concurrently
+		return true, nil
+	}
+	// Timers that never stopped are moot now
+	pipe := t.rdb.TxPipeline()
+	pipe.ZRem(ctx, deadlinesKey, FirstResponse+":"+sessionID, Pickup+":"+sessionID)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, fmt.Errorf("failed to clear SLA timers: %w", err)
+	}
+	return true, nil
+}
+
+// stop records that the kind's timer, started at the from field, stopped as
+// field at, reporting whether this call stopped it.
+func (t *Tracker) stop(ctx context.Context, sessionID, kind, field, from string, at time.Time) bool {
+	key := timersPrefix + sessionID
+	// Don't leave a stray hash for a timer that never started
+	running, err := t.rdb.HExists(ctx, key, from).Result()
+	if err != nil || !running {
+		return false
+	}
+	set, err := t.rdb.HSetNX(ctx, key, field, at.UnixMilli()).Result()
+	if err != nil {
+		log.Printf("Failed to stop SLA %s timer of session %s: %v", kind, sessionID, err)
+		return false
+	}
+	if !set {
+		return false
+	}
+	t.rdb.ZRem(ctx, deadlinesKey, kind+":"+sessionID)
+	vals, err := t.rdb.HMGet(ctx, key, "tenant", from).Result()
+	if err != nil {
+		log.Printf("Failed to load SLA timers of session %s: %v", sessionID, err)
+		return true
+	}
+	tenant, _ := vals[0].(string)
+	if startMs, err := strconv.ParseInt(fmt.Sprint(vals[1]), 10, 64); err == nil {
+		elapsedSeconds.Observe(at.Sub(time.UnixMilli(startMs)).Seconds(), t.tenant(tenant), kind)
+	}
+	return true
+}
+
+// schedule queues the breach check of the kind's timer, if it has a target.
+func (t *Tracker) schedule(ctx context.Context, pipe redis.Pipeliner, sessionID, kind string, at time.Time, targets Targets) {
+	target := targets.of(kind)
+	if target <= 0 {
+		return
+	}
+	pipe.ZAdd(ctx, deadlinesKey, redis.Z{Score: float64(at.Add(target).UnixMilli()), Member: kind + ":" + sessionID})
+}
+
+// Get returns the session's running conversation timers, or nil if there is
+// none.
+func (t *Tracker) Get(ctx context.Context, sessionID string) (*Timers, error) {
+	vals, err := t.rdb.HGetAll(ctx, timersPrefix+sessionID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SLA timers: %w", err)
+	}
+	if vals["started"] == "" {
+		return nil, nil
+	}
+	at := func(field string) time.Time {
+		ms, err := strconv.ParseInt(vals[field], 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.UnixMilli(ms).UTC()
+	}
+	tenant := t.tenant(vals["tenant"])
+	timers := &Timers{
+		SessionID:  sessionID,
+		Tenant:     tenant,
+		Targets:    t.targets(tenant),
+		StartedAt:  at("started"),
+		Responded:  at("responded"),
+		HandedOff:  at("handoff"),
+		PickedUp:   at("picked_up"),
+		Agent:      vals["agent"],
+		ResolvedAt: at("resolved"),
+	}
+	for _, kind := range []string{FirstResponse, Pickup, Resolution} {
+		if vals["breached_"+kind] != "" {
+			timers.Breached = append(timers.Breached, kind)
+		}
+	}
+	return timers, nil
+}
+
+// Watch reports timers that ran past their target, until ctx is done. Run
+// it on every replica; each breach is reported by one.
+func (t *Tracker) Watch(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		due, err := t.rdb.ZRangeByScore(ctx, deadlinesKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to list due SLA timers: %v", err)
+			continue
+		}
+		for _, member := range due {
+			// Whichever replica removes the entry reports the breach
+			if n, err := t.rdb.ZRem(ctx, deadlinesKey, member).Result(); err != nil || n == 0 {
+				continue
+			}
+			kind, sessionID, _ := strings.Cut(member, ":")
+			if err := t.breach(ctx, sessionID, kind); err != nil {
+				log.Printf("Failed to report SLA breach of session %s: %v", sessionID, err)
+			}
+		}
+	}
+}
+
+func (t *Tracker) breach(ctx context.Context, sessionID, kind string) error {
+	key := timersPrefix + sessionID
+	running, err := t.rdb.HExists(ctx, key, "started").Result()
+	if err != nil {
+		return fmt.Errorf("failed to load SLA timers: %w", err)
+	}
+	if !running {
+		return nil
+	}
+	set, err := t.rdb.HSetNX(ctx, key, "breached_"+kind, time.Now().UnixMilli()).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record SLA breach: %w", err)
+	}
+	if !set {
+		return nil
+	}
+	tenant, err := t.rdb.HGet(ctx, key, "tenant").Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to load SLA timers: %w", err)
+	}
+	tenant = t.tenant(tenant)
+	breachesTotal.Inc(tenant, kind)
+	log.Printf("Session %s missed its %s SLA", sessionID, kind)
+	err = t.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStream,
+		MaxLen: eventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":           "breach",
+			"kind":           kind,
+			"tenant":         tenant,
+			"session_id":     sessionID,
+			"target_seconds": int(t.targets(tenant).of(kind).Seconds()),
+			"timestamp":      time.Now().UTC().Format(time.RFC3339),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to record SLA event: %w", err)
+	}
+	return nil
+}
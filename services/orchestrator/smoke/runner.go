@@ -0,0 +1,308 @@
+// Package smoke runs scripted conversations through the live pipeline after
+// a deploy: each turn is published on the inbound stream like a real
+// message, answered by cognitive-core and checked on its way back. Unlike
+// the channel-adapter watchdog, nothing is mocked, so a pass means the
+// deployment actually answers questions.
+package smoke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+	"orchestrator/models"
+	"orchestrator/redisconn"
+)
+
+const (
+	streamKey     = "msg:inbound"
+	sessionPrefix = "smoke-"
+	latestKey     = "smoke:latest"
+	lockKey       = "smoke:lock"
+	lockTTL       = 10 * time.Minute
+	// How long one turn may take unless the step says otherwise
+	stepTimeout = 45 * time.Second
+	// Said when cognitive-core fails; never a passing answer
+	fallbackText = "Sorry, I'm having trouble responding right now."
+)
+
+// ErrRunning means another replica is already running the scenarios.
+var ErrRunning = errors.New("a smoke test run is already in progress")
+
+var scenarioPassed = metrics.NewGaugeVec("orchestrator_smoke_scenario_passed",
+	"1 if the scenario passed in the latest smoke test run, 0 otherwise.", "scenario")
+
+// Step is one user turn and what the reply must look like. Contains and
+// Excludes are matched case-insensitively.
+type Step struct {
+	Send         string   `json:"send"`
+	Contains     []string `json:"contains,omitempty"`
+	Excludes     []string `json:"excludes,omitempty"`
+	Pattern      string   `json:"pattern,omitempty"`
+	MaxLatencyMs int64    `json:"max_latency_ms,omitempty"`
+}
+
+// Scenario is a conversation; its steps share one session, so follow-ups
+// exercise history.
+type Scenario struct {
+	Name     string `json:"name"`
+	Channel  string `json:"channel,omitempty"`
+	Language string `json:"language,omitempty"`
+	Steps    []Step `json:"steps"`
+}
+
+// DefaultScenarios only assume the genie can hold a conversation, not what
+// is in the knowledge base.
+var DefaultScenarios = []Scenario{
+	{Name: "greeting", Steps: []Step{{Send: "Hello!"}}},
+	{Name: "product_question", Steps: []Step{{Send: "What products does Mandala Foods sell?"}}},
+	{Name: "follow_up", Steps: []Step{
+		{Send: "Do you sell momo masala?"},
+		{Send: "How should I store it?"},
+	}},
+}
+
+type StepResult struct {
+	Send      string `json:"send"`
+	Reply     string `json:"reply,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ScenarioResult struct {
+	Name      string       `json:"name"`
+	SessionID string       `json:"session_id"`
+	Passed    bool         `json:"passed"`
+	Steps     []StepResult `json:"steps"`
+}
+
+type Report struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Trigger    string           `json:"trigger"`
+	Passed     bool             `json:"passed"`
+	Scenarios  []ScenarioResult `json:"scenarios"`
+}
+
+type Runner struct {
+	rdb       *redis.Client
+	scenarios []Scenario
+}
+
+func NewRunner(rdb *redis.Client, scenarios []Scenario) (*Runner, error) {
+	for _, sc := range scenarios {
+		if sc.Name == "" || len(sc.Steps) == 0 {
+			return nil, fmt.Errorf("scenario %q needs a name and at least one step", sc.Name)
+		}
+		for _, st := range sc.Steps {
+			if st.Pattern != "" {
+				if _, err := regexp.Compile(st.Pattern); err != nil {
+					return nil, fmt.Errorf("invalid pattern in scenario %s: %w", sc.Name, err)
+				}
+			}
+		}
+	}
+	return &Runner{rdb: rdb, scenarios: scenarios}, nil
+}
+
+// LoadScenarios reads a JSON array of scenarios, or returns the defaults
+// when path is empty.
+func LoadScenarios(path string) ([]Scenario, error) {
+	if path == "" {
+		return DefaultScenarios, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenarios: %w", err)
+	}
+	var out []Scenario
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse scenarios: %w", err)
+	}
+	return out, nil
+}
+
+// Run plays every scenario and stores the report as the latest. Only one
+// run happens at a time across replicas.
+func (r *Runner) Run(ctx context.Context, trigger string) (*Report, error) {
+	ok, err := r.rdb.SetNX(ctx, lockKey, trigger, lockTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take smoke test lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrRunning
+	}
+	defer r.rdb.Del(context.WithoutCancel(ctx), lockKey)
+
+	rep := &Report{StartedAt: time.Now().UTC(), Trigger: trigger, Passed: true}
+	for _, sc := range r.scenarios {
+		res := r.scenario(ctx, sc)
+		if res.Passed {
+			scenarioPassed.Set(1, sc.Name)
+		} else {
+			scenarioPassed.Set(0, sc.Name)
+			rep.Passed = false
+		}
+		log.Printf("Smoke scenario %s: passed=%v", sc.Name, res.Passed)
+		rep.Scenarios = append(rep.Scenarios, res)
+	}
+	rep.FinishedAt = time.Now().UTC()
+
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := r.rdb.Set(ctx, latestKey, data, 0).Err(); err != nil {
+		log.Printf("Failed to store smoke test report: %v", err)
+	}
+	return rep, nil
+}
+
+// Latest returns the most recent report, or nil if none has run.
+func (r *Runner) Latest(ctx context.Context) (*Report, error) {
+	data, err := r.rdb.Get(ctx, latestKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load smoke test report: %w", err)
+	}
+	var rep Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal smoke test report: %w", err)
+	}
+	return &rep, nil
+}
+
+func (r *Runner) scenario(ctx context.Context, sc Scenario) ScenarioResult {
+	res := ScenarioResult{Name: sc.Name, SessionID: sessionPrefix + uuid.New().String(), Passed: true}
+	pubsub := r.rdb.Subscribe(ctx, "response:"+res.SessionID)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		res.Passed = false
+		res.Steps = append(res.Steps, StepResult{Error: fmt.Sprintf("failed to subscribe: %v", err)})
+		return res
+	}
+	ch := redisconn.Channel(pubsub)
+
+	for _, st := range sc.Steps {
+		sr := r.step(ctx, sc, res.SessionID, st, ch)
+		res.Steps = append(res.Steps, sr)
+		if sr.Error != "" {
+			// Later turns depend on this one
+			res.Passed = false
+			break
+		}
+	}
+	return res
+}
+
+func (r *Runner) step(ctx context.Context, sc Scenario, sessionID string, st Step, ch <-chan *redis.Message) StepResult {
+	sr := StepResult{Send: st.Send}
+	channel := sc.Channel
+	if channel == "" {
+		channel = "web"
+	}
+	language := sc.Language
+	if language == "" {
+		language = "en"
+	}
+	envelope := models.MessageEnvelope{
+		MessageID: uuid.New().String(),
+		SessionID: sessionID,
+		Channel:   channel,
+		UserID:    "smoke:runner",
+		Timestamp: time.Now().UTC(),
+		Content:   models.MessageContent{Type: "text", Text: st.Send},
+		Metadata:  models.MessageMetadata{Language: language},
+		Tags:      []string{"smoke"},
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		sr.Error = err.Error()
+		return sr
+	}
+
+	timeout := stepTimeout
+	if st.MaxLatencyMs > 0 {
+		timeout = time.Duration(st.MaxLatencyMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := r.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"envelope": string(data)},
+	}).Err(); err != nil {
+		sr.Error = fmt.Sprintf("failed to publish: %v", err)
+		return sr
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			sr.LatencyMs = time.Since(start).Milliseconds()
+			sr.Error = fmt.Sprintf("no reply within %s", timeout)
+			return sr
+		case msg, ok := <-ch:
+			if !ok {
+				sr.Error = "subscription closed"
+				return sr
+			}
+			var resp models.WSResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+				continue
+			}
+			switch resp.Type {
+			case "typing", "accepted":
+				continue
+			}
+			sr.LatencyMs = time.Since(start).Milliseconds()
+			sr.Reply = resp.Text
+			if err := check(st, resp); err != nil {
+				sr.Error = err.Error()
+			}
+			return sr
+		}
+	}
+}
+
+// check returns why resp does not satisfy st, or nil.
+func check(st Step, resp models.WSResponse) error {
+	if resp.Type != "message" {
+		return fmt.Errorf("got a %s frame instead of an answer", resp.Type)
+	}
+	text := strings.TrimSpace(resp.Text)
+	if text == "" {
+		return errors.New("empty answer")
+	}
+	if strings.HasPrefix(text, fallbackText) {
+		return errors.New("got the cognitive-core failure message")
+	}
+	lower := strings.ToLower(text)
+	for _, want := range st.Contains {
+		if !strings.Contains(lower, strings.ToLower(want)) {
+			return fmt.Errorf("answer does not contain %q", want)
+		}
+	}
+	for _, bad := range st.Excludes {
+		if strings.Contains(lower, strings.ToLower(bad)) {
+			return fmt.Errorf("answer contains %q", bad)
+		}
+	}
+	if st.Pattern != "" && !regexp.MustCompile(st.Pattern).MatchString(text) {
+		return fmt.Errorf("answer does not match %s", st.Pattern)
+	}
+	return nil
+}
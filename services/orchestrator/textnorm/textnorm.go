@@ -0,0 +1,27 @@
+// Package textnorm normalizes text for phrase matching, so overrides,
+// policy keywords and coalesced questions compare text the same way.
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize lowercases text and reduces punctuation and whitespace runs to a
+// single space. Marks are kept so Devanagari vowel signs survive.
+func Normalize(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
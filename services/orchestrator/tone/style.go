@@ -0,0 +1,259 @@
+// Package tone shapes generated answers to a tenant's and channel's house
+// style. The tone is sent to cognitive-core as a prompt hint; the format
+// rules are enforced here afterwards, because models follow them loosely.
+package tone
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"orchestrator/metrics"
+)
+
+// Tones cognitive-core knows how to write in.
+const (
+	Formal   = "formal"
+	Friendly = "friendly"
+	Concise  = "concise"
+)
+
+// concise answers are capped at this many sentences unless the style says
+// otherwise
+const conciseSentences = 3
+
+var adjustmentsTotal = metrics.NewCounterVec("orchestrator_tone_adjustments_total",
+	"Answers changed by the tone post-processor, by rule.", "rule")
+
+var (
+	boldPattern    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	headingPattern = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	bulletPattern  = regexp.MustCompile(`(?m)^\s*[*\-+]\s+`)
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	spacesPattern  = regexp.MustCompile(`[ \t]{2,}`)
+	orphanPattern  = regexp.MustCompile(`[ \t]+([.,!?।])`)
+)
+
+// Style is how answers on a channel should read. Zero fields leave the model's
+// output alone.
+type Style struct {
+	Tone         string `json:"tone,omitempty"`
+	MaxSentences int    `json:"max_sentences,omitempty"`
+	NoEmoji      bool   `json:"no_emoji,omitempty"`
+	// PlainText strips markdown for channels that show it literally
+	PlainText bool `json:"plain_text,omitempty"`
+}
+
+// merge overlays the fields set in o on s.
+func (s Style) merge(o Style) Style {
+	if o.Tone != "" {
+		s.Tone = o.Tone
+	}
+	if o.MaxSentences > 0 {
+		s.MaxSentences = o.MaxSentences
+	}
+	s.NoEmoji = s.NoEmoji || o.NoEmoji
+	s.PlainText = s.PlainText || o.PlainText
+	return s
+}
+
+// DefaultChannels are applied under any configured style.
+var DefaultChannels = map[string]Style{
+	"email": {NoEmoji: true},
+	"sms":   {NoEmoji: true, PlainText: true},
+	// IRC and XMPP clients don't render markdown
+	"irc":  {PlainText: true},
+	"xmpp": {PlainText: true},
+	"gbm":  {PlainText: true},
+	// Answers are spoken, so keep them short and free of markup
+	"voice": {NoEmoji: true, PlainText: true, MaxSentences: 3},
+}
+
+type TenantStyles struct {
+	Default  Style            `json:"default"`
+	Channels map[string]Style `json:"channels"`
+}
+
+// Config is the TONE_PROFILES file. A tenant's channel style overrides its
+// default, which overrides the global channel style, which overrides the
+// global default.
+type Config struct {
+	Default  Style                   `json:"default"`
+	Channels map[string]Style        `json:"channels"`
+	Tenants  map[string]TenantStyles `json:"tenants"`
+}
+
+type Engine struct {
+	cfg Config
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tone profiles: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse tone profiles: %w", err)
+	}
+	return &cfg, nil
+}
+
+func NewEngine(cfg Config) (*Engine, error) {
+	check := func(where string, s Style) error {
+		switch s.Tone {
+		case "", Formal, Friendly, Concise:
+		default:
+			return fmt.Errorf("%s: unknown tone %q", where, s.Tone)
+		}
+		if s.MaxSentences < 0 {
+			return fmt.Errorf("%s: max_sentences must not be negative", where)
+		}
+		return nil
+	}
+	if err := check("default", cfg.Default); err != nil {
+		return nil, err
+	}
+	for ch, s := range cfg.Channels {
+		if err := check("channel "+ch, s); err != nil {
+			return nil, err
+		}
+	}
+	for tenant, ts := range cfg.Tenants {
+		if err := check("tenant "+tenant, ts.Default); err != nil {
+			return nil, err
+		}
+		for ch, s := range ts.Channels {
+			if err := check("tenant "+tenant+" channel "+ch, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Engine{cfg: cfg}, nil
+}
+
+// Resolve returns the style for a tenant's channel. It is nil-safe and
+// returns the zero Style when tone shaping is disabled.
+func (e *Engine) Resolve(tenant, channel string) Style {
+	if e == nil {
+		return Style{}
+	}
+	s := DefaultChannels[channel].merge(e.cfg.Default).merge(e.cfg.Channels[channel])
+	if ts, ok := e.cfg.Tenants[tenant]; ok {
+		s = s.merge(ts.Default).merge(ts.Channels[channel])
+	}
+	if s.Tone == Concise && s.MaxSentences == 0 {
+		s.MaxSentences = conciseSentences
+	}
+	return s
+}
+
+// WithTone returns the style with its tone replaced, for a user who asked
+// for one.
+func (s Style) WithTone(t string) Style {
+	s.Tone = t
+	if t == Concise && s.MaxSentences == 0 {
+		s.MaxSentences = conciseSentences
+	}
+	return s
+}
+
+// Apply enforces the style's format rules on a generated answer.
+func (s Style) Apply(text string) string {
+	if s.PlainText {
+		if out := plain(text); out != text {
+			adjustmentsTotal.Inc("plain_text")
+			text = out
+		}
+	}
+	if s.NoEmoji {
+		if out := stripEmoji(text); out != text {
+			adjustmentsTotal.Inc("no_emoji")
+			text = out
+		}
+	}
+	if s.MaxSentences > 0 {
+		if out := firstSentences(text, s.MaxSentences); out != text {
+			adjustmentsTotal.Inc("max_sentences")
+			text = out
+		}
+	}
+	return text
+}
+
+func plain(text string) string {
+	text = linkPattern.ReplaceAllString(text, "$1 ($2)")
+	text = boldPattern.ReplaceAllString(text, "$1$2")
+	text = headingPattern.ReplaceAllString(text, "")
+	text = bulletPattern.ReplaceAllString(text, "- ")
+	return strings.ReplaceAll(text, "`", "")
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, transport, flags
+		r >= 0x2600 && r <= 0x27BF, // misc symbols and dingbats
+		r >= 0x2B00 && r <= 0x2BFF, // arrows and stars
+		r == 0x200D, r == 0x20E3,   // joiner, keycap
+		r >= 0xFE00 && r <= 0xFE0F,   // variation selectors
+		r >= 0xE0020 && r <= 0xE007F: // tag sequences
+		return true
+	}
+	return false
+}
+
+func stripEmoji(text string) string {
+	if strings.IndexFunc(text, isEmoji) < 0 {
+		return text
+	}
+	text = strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return -1
+		}
+		return r
+	}, text)
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		l = orphanPattern.ReplaceAllString(spacesPattern.ReplaceAllString(l, " "), "$1")
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// abbreviations end in a full stop that does not end the sentence.
+var abbreviations = map[string]bool{"rs": true, "e.g": true, "i.e": true, "etc": true, "approx": true, "no": true, "dr": true, "mr": true, "mrs": true, "ms": true}
+
+var listItemPattern = regexp.MustCompile(`^\s*([*\-+•]|\d+[.)])\s`)
+
+// firstSentences keeps the first n sentences. Sentences end at . ! ? or the
+// Devanagari danda followed by whitespace; each list item counts as one.
+func firstSentences(text string, n int) string {
+	runes := []rune(text)
+	count, lineStart, wordStart := 0, 0, 0
+	for i, r := range runes {
+		end := false
+		switch {
+		case r == '\n':
+			end = listItemPattern.MatchString(string(runes[lineStart:i])) && !strings.ContainsRune(".!?।", runes[max(i-1, 0)])
+			lineStart = i + 1
+		case r == '.':
+			word := strings.ToLower(string(runes[wordStart:i]))
+			end = (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) && !abbreviations[word] && strings.TrimLeft(word, "0123456789") != ""
+		case r == '!' || r == '?' || r == '।':
+			end = i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+		}
+		if unicode.IsSpace(r) || r == '(' {
+			wordStart = i + 1
+		}
+		if !end {
+			continue
+		}
+		if count++; count == n {
+			return strings.TrimSpace(string(runes[:i+1]))
+		}
+	}
+	return text
+}
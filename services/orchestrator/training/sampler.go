@@ -0,0 +1,163 @@
+// Package training builds fine-tuning datasets from anonymized transcripts.
+// It is opt-in: a deterministic share of conversations is sampled as they are
+// anonymized, labelled with the evaluation scores archived on their answers,
+// and appended as JSONL to a dataset directory (typically a mounted storage
+// bucket).
+package training
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"orchestrator/anonymize"
+	"orchestrator/archive"
+	"orchestrator/metrics"
+)
+
+const maxContextTurns = 6
+
+var examplesTotal = metrics.NewCounterVec("orchestrator_training_examples_total",
+	"Training examples written, by quality label.", "label")
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Label carries the evaluation result for the example's final answer.
+type Label struct {
+	Quality    string   `json:"quality"`
+	Overall    *float64 `json:"overall,omitempty"`
+	JudgeScore *float64 `json:"judge_score,omitempty"`
+	Refusal    bool     `json:"refusal,omitempty"`
+}
+
+// Example is one line of the dataset: the conversation up to and including
+// an assistant answer, in chat fine-tuning format.
+type Example struct {
+	PseudoSessionID string    `json:"pseudo_session_id"`
+	MessageID       string    `json:"message_id"`
+	Channel         string    `json:"channel"`
+	Language        string    `json:"language"`
+	Messages        []Message `json:"messages"`
+	Label           Label     `json:"label"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type Sampler struct {
+	dir       string
+	rate      float64
+	threshold float64
+
+	mu sync.Mutex
+}
+
+// NewSampler samples rate (0–1) of conversations into dir. Answers whose
+// archived evaluation scores at least threshold are labelled "good", the
+// rest "poor"; answers that were not evaluated are "unlabeled".
+func NewSampler(dir string, rate, threshold float64) (*Sampler, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create dataset directory: %w", err)
+	}
+	return &Sampler{dir: dir, rate: rate, threshold: threshold}, nil
+}
+
+// Sample is called for every anonymized transcript. Sampling hashes the
+// pseudonymous session ID so a conversation is either wholly in or out.
+func (s *Sampler) Sample(ctx context.Context, rec anonymize.Record) {
+	h := fnv.New32a()
+	h.Write([]byte(rec.PseudoSessionID))
+	if float64(h.Sum32()%10000) >= s.rate*10000 {
+		return
+	}
+
+	examples := s.build(rec)
+	if len(examples) == 0 {
+		return
+	}
+	if err := s.write(examples); err != nil {
+		log.Printf("Failed to write training examples: %v", err)
+	}
+}
+
+func (s *Sampler) build(rec anonymize.Record) []Example {
+	// Messages the user deleted, and the original text of ones they edited,
+	// are not what the conversation ended up as
+	turns := archive.ApplyRevisions(rec.Turns)
+	var out []Example
+	var history []Message
+	for i, t := range turns {
+		msg := Message{Role: t.Role, Content: t.Content}
+		// Pinned answers and policy refusals are not model output
+		generated := t.Role == "assistant" && !strings.HasPrefix(t.Backend, "override:") && !strings.HasPrefix(t.Backend, "policy:")
+		if generated && i > 0 && turns[i-1].Role == "user" {
+			ctxMsgs := history
+			if len(ctxMsgs) > maxContextTurns {
+				ctxMsgs = ctxMsgs[len(ctxMsgs)-maxContextTurns:]
+			}
+			msgs := append(append([]Message(nil), ctxMsgs...), msg)
+			out = append(out, Example{
+				PseudoSessionID: rec.PseudoSessionID,
+				MessageID:       t.MessageID,
+				Channel:         t.Channel,
+				Language:        language(turns[i-1].Content),
+				Messages:        msgs,
+				Label:           s.label(t),
+				CreatedAt:       t.Timestamp,
+			})
+		}
+		history = append(history, msg)
+	}
+	return out
+}
+
+func (s *Sampler) label(t archive.Turn) Label {
+	score := t.Evaluation
+	if score == nil {
+		return Label{Quality: "unlabeled"}
+	}
+	l := Label{Quality: "poor", Overall: &score.Overall, JudgeScore: score.JudgeScore, Refusal: score.Refusal}
+	if score.Overall >= s.threshold {
+		l.Quality = "good"
+	}
+	return l
+}
+
+// write appends examples to the day's dataset file.
+func (s *Sampler) write(examples []Example) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, "dataset-"+time.Now().UTC().Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, ex := range examples {
+		if err := enc.Encode(ex); err != nil {
+			return fmt.Errorf("failed to write example: %w", err)
+		}
+		examplesTotal.Inc(ex.Label.Quality)
+	}
+	return nil
+}
+
+// language tags Devanagari-script questions as Nepali.
+func language(text string) string {
+	for _, r := range text {
+		if unicode.Is(unicode.Devanagari, r) {
+			return "ne"
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,195 @@
+package trigger
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	"orchestrator/archive"
+	"orchestrator/delivery"
+	"orchestrator/httperr"
+	"orchestrator/models"
+	"orchestrator/session"
+)
+
+// DefaultTemplates are used for events that have no configured template.
+var DefaultTemplates = map[string]string{
+	"cart_abandoned": "Hi! You left {{if .item_count}}{{.item_count}} item(s){{else}}some items{{end}} in your cart. Would you like help choosing, or any questions about our products before you check out?",
+	"payment_failed": "Hi! It looks like your payment{{if .order_id}} for order {{.order_id}}{{end}} didn't go through. I can help you try again or answer any questions.",
+}
+
+// Request is the body external systems POST to fire a proactive message.
+type Request struct {
+	Event   string                 `json:"event"`
+	UserRef string                 `json:"user_ref"`
+	Channel string                 `json:"channel,omitempty"`
+	Context map[string]interface{} `json:"context"`
+}
+
+type Result struct {
+	SessionID string `json:"session_id"`
+	Channel   string `json:"channel"`
+	Resumed   bool   `json:"resumed"`
+	Delivered bool   `json:"delivered"`
+	Queued    bool   `json:"queued"`
+	Text      string `json:"text"`
+}
+
+// Handler serves POST /v1/triggers. It resumes the user's latest session
+// (or opens a new one) and sends a templated proactive message there.
+type Handler struct {
+	publisher  *delivery.Publisher
+	sessionMgr *session.Manager
+	token      string
+	templates  map[string]*template.Template
+}
+
+func NewHandler(publisher *delivery.Publisher, sessionMgr *session.Manager, token string, templates map[string]string) (*Handler, error) {
+	h := &Handler{
+		publisher:  publisher,
+		sessionMgr: sessionMgr,
+		token:      token,
+		templates:  make(map[string]*template.Template),
+	}
+	for event, text := range templates {
+		t, err := template.New(event).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %w", event, err)
+		}
+		h.templates[event] = t
+	}
+	return h, nil
+}
+
+// LoadTemplates reads event templates from a JSON file mapping event name to
+// template text, layered over DefaultTemplates.
+func LoadTemplates(path string) (map[string]string, error) {
+	out := make(map[string]string)
+	for k, v := range DefaultTemplates {
+		out[k] = v
+	}
+	if path == "" {
+		return out, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+	var custom map[string]string
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	for k, v := range custom {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httperr.Write(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	got := []byte(r.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(got, []byte("Bearer "+h.token)) != 1 {
+		httperr.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Event == "" || req.UserRef == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "event and user_ref are required")
+		return
+	}
+	tmpl, ok := h.templates[req.Event]
+	if !ok {
+		httperr.Write(w, r, http.StatusBadRequest, fmt.Sprintf("unknown event %q", req.Event))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, req.Context); err != nil {
+		log.Printf("Failed to render %s template: %v", req.Event, err)
+		httperr.Write(w, r, http.StatusBadRequest, "failed to render template")
+		return
+	}
+
+	res, err := h.fire(r, req, buf.String())
+	if err != nil {
+		log.Printf("Trigger %s for %s failed: %v", req.Event, req.UserRef, err)
+		if errors.Is(err, delivery.ErrQueueFull) {
+			httperr.WriteRetry(w, r, http.StatusServiceUnavailable, "outbound queue is full", 5*time.Second)
+			return
+		}
+		httperr.Write(w, r, http.StatusInternalServerError, "failed to deliver trigger")
+		return
+	}
+	log.Printf("Trigger %s sent to session %s (delivered=%v)", req.Event, res.SessionID, res.Delivered)
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) fire(r *http.Request, req Request, text string) (*Result, error) {
+	ctx := r.Context()
+	binding, err := h.sessionMgr.LookupUser(ctx, req.UserRef)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Text: text, Channel: req.Channel}
+	if binding != nil {
+		res.SessionID = binding.SessionID
+		res.Resumed = true
+		if res.Channel == "" {
+			res.Channel = binding.Channel
+		}
+	} else {
+		res.SessionID = uuid.New().String()
+	}
+	if res.Channel == "" {
+		res.Channel = "web"
+	}
+
+	if err := h.sessionMgr.Record(ctx, res.SessionID, archive.Turn{
+		Role:      "assistant",
+		Content:   text,
+		UserID:    req.UserRef,
+		Channel:   res.Channel,
+		Timestamp: time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+	if err := h.sessionMgr.BindUser(ctx, req.UserRef, res.SessionID, res.Channel); err != nil {
+		return nil, err
+	}
+
+	sent, err := h.publisher.Send(ctx, res.Channel, res.SessionID, models.WSResponse{
+		Type:      "message",
+		Text:      text,
+		SessionID: res.SessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Delivered = sent.Delivered
+	res.Queued = sent.Queued
+	return res, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
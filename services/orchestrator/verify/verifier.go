@@ -0,0 +1,267 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"orchestrator/metrics"
+)
+
+const (
+	// Checked links are kept as URL hashes in two sorted sets, scored by when
+	// they were checked and capped at maxCached members each
+	cacheOK     = "linkcheck:ok"
+	cacheBad    = "linkcheck:bad"
+	cacheTTL    = 24 * time.Hour
+	maxCached   = 10000
+	headTimeout = 3 * time.Second
+	// maxProbes bounds the links probed for one answer; the rest are
+	// unverified
+	maxProbes = 10
+
+	ModeOff   = "off"
+	ModeFlag  = "flag"
+	ModeStrip = "strip"
+)
+
+var (
+	urlPattern   = regexp.MustCompile(`https?://[^\s)\]>"'<]+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s\-().]{6,}\d`)
+	datePattern  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+	findingsTotal = metrics.NewCounterVec("orchestrator_unverified_contacts_total",
+		"URLs and phone numbers in responses that failed verification.", "kind", "action")
+
+	errNotPublic = errors.New("address is not public")
+)
+
+// Finding is an item in a response that could not be verified.
+type Finding struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Verifier checks URLs and phone numbers in generated answers. URLs pass if
+// their host is allowlisted or, for https links, a HEAD request to a public
+// address succeeds without following redirects; phone numbers pass only if
+// allowlisted, since there is no way to probe them.
+type Verifier struct {
+	rdb        *redis.Client
+	mode       string
+	domains    []string
+	phones     map[string]bool
+	httpClient *http.Client
+}
+
+func NewVerifier(rdb *redis.Client, mode string, domains, phones []string) *Verifier {
+	phoneSet := make(map[string]bool)
+	for _, p := range phones {
+		phoneSet[digits(p)] = true
+	}
+	var ds []string
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			ds = append(ds, d)
+		}
+	}
+	return &Verifier{
+		rdb:     rdb,
+		mode:    mode,
+		domains: ds,
+		phones:  phoneSet,
+		httpClient: &http.Client{
+			Timeout: headTimeout,
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: headTimeout, Control: publicOnly}).DialContext,
+				TLSHandshakeTimeout: headTimeout,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			// A redirect could point anywhere, including inside our network
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// publicOnly refuses connections to loopback, private, link-local and other
+// non-public addresses. It sees the resolved address, so host names that
+// resolve to one are refused too.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", errNotPublic, host)
+	}
+	// Shared address space, 100.64.0.0/10
+	if v4 := ip.To4(); v4 != nil && v4[0] == 100 && v4[1]&0xc0 == 64 {
+		return fmt.Errorf("%w: %s", errNotPublic, host)
+	}
+	return nil
+}
+
+// Process returns text with unverifiable links and numbers stripped or
+// flagged according to the configured mode.
+func (v *Verifier) Process(ctx context.Context, text string) (string, []Finding) {
+	if v == nil || v.mode == ModeOff {
+		return text, nil
+	}
+
+	verified := v.checkURLs(ctx, urlPattern.FindAllString(text, -1))
+	var findings []Finding
+	text = urlPattern.ReplaceAllStringFunc(text, func(u string) string {
+		trimmed := strings.TrimRight(u, ".,;:!?")
+		suffix := u[len(trimmed):]
+		if verified[trimmed] {
+			return u
+		}
+		findings = append(findings, Finding{Kind: "url", Value: trimmed})
+		findingsTotal.Inc("url", v.mode)
+		return v.replace(trimmed, "[link removed]") + suffix
+	})
+	text = phonePattern.ReplaceAllStringFunc(text, func(p string) string {
+		d := digits(p)
+		if len(d) < 8 || datePattern.MatchString(p) || v.phones[d] {
+			return p
+		}
+		findings = append(findings, Finding{Kind: "phone", Value: p})
+		findingsTotal.Inc("phone", v.mode)
+		return v.replace(p, "[number removed]")
+	})
+	return text, findings
+}
+
+func (v *Verifier) replace(value, stripped string) string {
+	if v.mode == ModeStrip {
+		return stripped
+	}
+	return value + " (unverified)"
+}
+
+// checkURLs verifies the distinct URLs found in an answer, probing them
+// concurrently.
+func (v *Verifier) checkURLs(ctx context.Context, found []string) map[string]bool {
+	verified := make(map[string]bool)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		probes int
+	)
+	for _, u := range found {
+		u = strings.TrimRight(u, ".,;:!?")
+		if _, seen := verified[u]; seen {
+			continue
+		}
+		verified[u] = v.allowlisted(u)
+		if verified[u] || !strings.HasPrefix(u, "https://") || probes >= maxProbes {
+			continue
+		}
+		probes++
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			ok := v.probe(ctx, u)
+			mu.Lock()
+			verified[u] = ok
+			mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+	return verified
+}
+
+func (v *Verifier) allowlisted(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range v.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// probe checks a link with a HEAD request, unless it was checked recently.
+func (v *Verifier) probe(ctx context.Context, raw string) bool {
+	sum := sha256.Sum256([]byte(raw))
+	member := hex.EncodeToString(sum[:])
+	since := time.Now().Add(-cacheTTL).Unix()
+	pipe := v.rdb.Pipeline()
+	good := pipe.ZScore(ctx, cacheOK, member)
+	bad := pipe.ZScore(ctx, cacheBad, member)
+	pipe.Exec(ctx)
+	if at, err := good.Result(); err == nil && int64(at) > since {
+		return true
+	}
+	if at, err := bad.Result(); err == nil && int64(at) > since {
+		return false
+	}
+
+	ok := v.head(ctx, raw)
+	key, other := cacheBad, cacheOK
+	if ok {
+		key, other = cacheOK, cacheBad
+	}
+	pipe = v.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: member})
+	pipe.ZRem(ctx, other, member)
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", since))
+	pipe.ZRemRangeByRank(ctx, key, 0, -maxCached-1)
+	pipe.Exec(ctx)
+	return ok
+}
+
+func (v *Verifier) head(ctx context.Context, raw string) bool {
+	ctx, cancel := context.WithTimeout(ctx, headTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, raw, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400 || resp.StatusCode == http.StatusMethodNotAllowed
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ParseMode validates a LINK_VERIFY_MODE value.
+func ParseMode(s string) (string, error) {
+	switch s {
+	case ModeOff, ModeFlag, ModeStrip:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown verification mode %q", s)
+}
@@ -0,0 +1,142 @@
+// Package widget stores the web widget's per-site branding and feature
+// switches. The channel adapter serves them from GET /widget/config, so a
+// change here reaches every embedded widget without a new bundle.
+package widget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// configsKey is read by the channel adapter; keep the field layout in sync.
+const configsKey = "widget:configs"
+
+const (
+	maxGreetingLen = 500
+	maxFeatures    = 32
+)
+
+var (
+	colorPattern   = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	featurePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	positions      = map[string]bool{"bottom-right": true, "bottom-left": true, "top-right": true, "top-left": true}
+)
+
+type Colors struct {
+	Primary    string `json:"primary,omitempty"`
+	Background string `json:"background,omitempty"`
+	Text       string `json:"text,omitempty"`
+}
+
+// Config is one site's widget setup, keyed by the public API key the site
+// embeds the widget with.
+type Config struct {
+	SiteKey  string `json:"site_key"`
+	Tenant   string `json:"tenant,omitempty"`
+	Colors   Colors `json:"colors"`
+	LogoURL  string `json:"logo_url,omitempty"`
+	Greeting string `json:"greeting,omitempty"`
+	Position string `json:"position,omitempty"`
+	// Features switches widget capabilities such as "attachments" or
+	// "feedback" on and off; the widget's defaults apply to unlisted ones.
+	Features  map[string]bool `json:"features,omitempty"`
+	UpdatedBy string          `json:"updated_by,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Validate rejects values the widget could not render safely.
+func Validate(c Config) error {
+	for name, v := range map[string]string{"primary": c.Colors.Primary, "background": c.Colors.Background, "text": c.Colors.Text} {
+		if v != "" && !colorPattern.MatchString(v) {
+			return fmt.Errorf("colors.%s must be a hex color such as #1a73e8", name)
+		}
+	}
+	if c.LogoURL != "" {
+		u, err := url.Parse(c.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("logo_url must be an https URL")
+		}
+	}
+	if utf8.RuneCountInString(c.Greeting) > maxGreetingLen {
+		return fmt.Errorf("greeting is longer than %d characters", maxGreetingLen)
+	}
+	if c.Position != "" && !positions[c.Position] {
+		return errors.New("position must be bottom-right, bottom-left, top-right or top-left")
+	}
+	if len(c.Features) > maxFeatures {
+		return fmt.Errorf("at most %d features can be set", maxFeatures)
+	}
+	for name := range c.Features {
+		if !featurePattern.MatchString(name) {
+			return fmt.Errorf("invalid feature name %q", name)
+		}
+	}
+	return nil
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{rdb: rdb}
+}
+
+func (s *Store) List(ctx context.Context) ([]Config, error) {
+	raw, err := s.rdb.HGetAll(ctx, configsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load widget configs: %w", err)
+	}
+	out := make([]Config, 0, len(raw))
+	for key, data := range raw {
+		var c Config
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal widget config %s: %w", key, err)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Get returns nil if the site has no config.
+func (s *Store) Get(ctx context.Context, siteKey string) (*Config, error) {
+	data, err := s.rdb.HGet(ctx, configsKey, siteKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load widget config: %w", err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal widget config: %w", err)
+	}
+	return &c, nil
+}
+
+func (s *Store) Put(ctx context.Context, c Config) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal widget config: %w", err)
+	}
+	if err := s.rdb.HSet(ctx, configsKey, c.SiteKey, data).Err(); err != nil {
+		return fmt.Errorf("failed to save widget config: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, siteKey string) (bool, error) {
+	n, err := s.rdb.HDel(ctx, configsKey, siteKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete widget config: %w", err)
+	}
+	return n > 0, nil
+}